@@ -0,0 +1,12 @@
+// qpsctl 是qps-counter的命令行管理工具，通过HTTP接口查询状态、调整限流和管理命名计数器
+package main
+
+import (
+	"os"
+
+	"github.com/mant7s/qps-counter/internal/ctl"
+)
+
+func main() {
+	os.Exit(ctl.Run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
@@ -7,17 +7,27 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
-	"runtime"
+	"sync"
 	"syscall"
 
 	"github.com/valyala/fasthttp"
 
+	"github.com/mant7s/qps-counter/internal/analytics"
 	"github.com/mant7s/qps-counter/internal/api"
+	"github.com/mant7s/qps-counter/internal/app"
 	"github.com/mant7s/qps-counter/internal/config"
 	"github.com/mant7s/qps-counter/internal/counter"
+	"github.com/mant7s/qps-counter/internal/events"
+	"github.com/mant7s/qps-counter/internal/health"
+	"github.com/mant7s/qps-counter/internal/ingest"
 	"github.com/mant7s/qps-counter/internal/limiter"
+	"github.com/mant7s/qps-counter/internal/loadgen"
 	"github.com/mant7s/qps-counter/internal/logger"
 	"github.com/mant7s/qps-counter/internal/metrics"
+	"github.com/mant7s/qps-counter/internal/recovery"
+	"github.com/mant7s/qps-counter/internal/replication"
+	"github.com/mant7s/qps-counter/internal/report"
+	"github.com/mant7s/qps-counter/internal/scaling"
 	"go.uber.org/zap"
 )
 
@@ -35,48 +45,79 @@ func main() {
 		}
 	}()
 
-	// 创建增强的优雅关闭管理器，使用配置的超时时间
-	gracefulShutdown := counter.NewEnhancedGracefulShutdown(cfg.Shutdown.Timeout, cfg.Shutdown.MaxWait)
-
-	qpsCounter := counter.NewCounter(&cfg.Counter)
-	defer qpsCounter.Stop()
-
-	// 创建自适应分片管理器，设置最小分片数为CPU核心数，最大分片数为CPU核心数的8倍
-	minShards := runtime.NumCPU()
-	maxShards := runtime.NumCPU() * 8
-	adaptiveManager := counter.NewAdaptiveShardingManager(qpsCounter, &cfg.Counter, minShards, maxShards)
-	defer adaptiveManager.Stop()
-
-	// 创建限流器，使用配置的参数
-	rateLimiter := limiter.NewRateLimiter(cfg.Limiter.Rate, cfg.Limiter.Burst, cfg.Limiter.Adaptive)
-	// 根据配置决定是否启用限流器
-	rateLimiter.SetEnabled(cfg.Limiter.Enabled)
-
-	// 初始化指标收集器
-	metricsCollector := metrics.NewMetrics(qpsCounter)
-	// 根据配置决定是否启用指标收集
-	if cfg.Metrics.Enabled {
-		metricsCollector.Start(cfg.Metrics.Interval)
-		defer metricsCollector.Stop()
+	// 配置文件的修改无效时继续使用之前的配置
+	config.OnReloadRejected(func(err error) {
+		logger.Warn("忽略无效的配置文件修改", zap.Error(err))
+	})
+
+	// 服务器和后台协程中的panic统一记录，次数过多时受控关闭
+	recovery.Init(cfg.Recovery)
+
+	// 按依赖顺序启动所有子系统，退出时按相反顺序停止
+	container := app.New(cfg)
+	container.Provide(modules()...)
+	if err := container.Start(); err != nil {
+		log.Fatal("Failed to start modules:", err)
 	}
+	defer container.Stop()
+
+	gracefulShutdown := app.Get[*counter.EnhancedGracefulShutdown](container, "shutdown")
+	publisher := app.Get[*replication.Publisher](container, "replication.publisher")
 
-	// 根据配置选择服务器类型
 	// 根据配置选择服务器类型
 	type Server interface {
 		ListenAndServe() error
 		Shutdown(ctx context.Context) error
 	}
 
-	var srv Server
+	// namedServer 一个监听端口及其服务器
+	type namedServer struct {
+		name string
+		port int
+		srv  Server
+	}
 
-	switch cfg.Server.ServerType {
-	case "fasthttp":
-		// 使用FastHTTP路由器
-		router := api.NewFastHTTPRouter(qpsCounter, gracefulShutdown, rateLimiter, metricsCollector, cfg.Metrics.Endpoint, cfg.Metrics.Enabled)
+	routerOpts := api.RouterOptions{
+		Counter:          app.Get[counter.Counter](container, "counter.write"),
+		GracefulShutdown: gracefulShutdown,
+		RateLimiter:      app.Get[*limiter.RateLimiter](container, "limiter"),
+		FailurePolicy:    app.Get[*limiter.FailurePolicy](container, "limiter.failure"),
+		DecisionLog:      app.Get[*analytics.DecisionLog](container, "limiter.decisions"),
+		Sharding:         app.Get[*counter.EnhancedAdaptiveShardingManager](container, "counter.adaptive"),
+		TrendTracker:     app.Get[*counter.TrendTracker](container, "counter.trend"),
+		History:          app.Get[*counter.History](container, "counter.history"),
+		Advisor:          app.Get[*scaling.Advisor](container, "scaling"),
+		Reporter:         app.Get[*report.Reporter](container, "report"),
+		TaggedCounter:    app.Get[*counter.TaggedCounter](container, "counter.tags"),
+		KeyedCounter:     app.Get[*counter.KeyedCounter](container, "counter.keys"),
+		ClientTracker:    app.Get[*counter.ClientTracker](container, "counter.clients"),
+		Latency:          app.Get[*counter.LatencyHistogram](container, "counter.latency"),
+		LatencySeries:    app.Get[*counter.LatencySeries](container, "counter.latency.series"),
+		Weighted:         app.Get[*counter.WeightedWindow](container, "counter.weighted"),
+		Registry:         app.Get[*counter.Registry](container, "registry"),
+		IngestSwitch:     app.Get[*ingest.Switch](container, "ingest.switch"),
+		Duplicates:       app.Get[*ingest.DuplicateDetector](container, "ingest.duplicates"),
+		Signatures:       app.Get[*ingest.SignatureVerifier](container, "ingest.signing"),
+		Tenants:          app.Get[*counter.TenantStore](container, "counter.tenants"),
+		LoadGenerator:    app.Get[*loadgen.Generator](container, "loadgen"),
+		Health:           app.Get[*health.Registry](container, "health"),
+		Publisher:        publisher,
+		Follower:         app.Get[*replication.Follower](container, "replication.follower"),
+		Role:             cfg.Server.Role,
+		AdminToken:       cfg.Server.AdminToken,
+		QPSPrecision:     cfg.Server.QPSPrecision,
+		RateUnit:         cfg.Server.RateUnit,
+		CacheMaxAge:      cfg.Server.CacheMaxAge,
+		Metrics:          app.Get[*metrics.Metrics](container, "metrics"),
+		MetricsEndpoint:  cfg.Metrics.Endpoint,
+		MetricsEnabled:   cfg.Metrics.Enabled,
+	}
+
+	newFastHTTPServer := func(port int, handler fasthttp.RequestHandler) Server {
 		// 配置FastHTTP服务器
 		fastSrv := &fasthttp.Server{
-			Name:               fmt.Sprintf(":%d", cfg.Server.Port),
-			Handler:            router.Handler(),
+			Name:               fmt.Sprintf(":%d", port),
+			Handler:            handler,
 			ReadTimeout:        cfg.Server.ReadTimeout,
 			WriteTimeout:       cfg.Server.WriteTimeout,
 			MaxRequestBodySize: 1024 * 1024, // 1MB
@@ -84,32 +125,56 @@ func main() {
 			DisableKeepalive:   false,
 		}
 		// 包装FastHTTP服务器以实现Server接口
-		srv = &FastHTTPServerWrapper{server: fastSrv}
-	default: // 默认使用Gin
+		return &FastHTTPServerWrapper{server: fastSrv}
+	}
+	newGinServer := func(port int) Server {
 		// 使用Gin路由器
-		router := api.NewRouter(qpsCounter, gracefulShutdown, rateLimiter, metricsCollector, cfg.Metrics.Endpoint, cfg.Metrics.Enabled)
+		router := api.NewRouter(routerOpts)
 		// 配置Gin服务器
-		ginServer := &http.Server{
-			Addr:           fmt.Sprintf(":%d", cfg.Server.Port),
+		return &http.Server{
+			Addr:           fmt.Sprintf(":%d", port),
 			Handler:        router,
 			ReadTimeout:    cfg.Server.ReadTimeout,
 			WriteTimeout:   cfg.Server.WriteTimeout,
 			MaxHeaderBytes: 1 << 20, // 1MB
 		}
-		srv = ginServer
 	}
 
-	go func() {
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatal("Server start failed", zap.Error(err))
-		}
-	}()
+	var servers []namedServer
+
+	switch cfg.Server.ServerType {
+	case "fasthttp":
+		// 使用FastHTTP路由器
+		router := api.NewFastHTTPRouter(routerOpts)
+		servers = append(servers, namedServer{"fasthttp", cfg.Server.Port, newFastHTTPServer(cfg.Server.Port, router.Handler())})
+	case "both":
+		// fasthttp只处理上报热路径，Gin在另一个端口上提供管理、查询和指标接口，两者共享同一组组件
+		router := api.NewFastHTTPRouter(routerOpts)
+		servers = append(servers,
+			namedServer{"fasthttp", cfg.Server.Port, newFastHTTPServer(cfg.Server.Port, router.CollectHandler())},
+			namedServer{"gin", cfg.Server.AdminPort, newGinServer(cfg.Server.AdminPort)})
+	default: // 默认使用Gin
+		servers = append(servers, namedServer{"gin", cfg.Server.Port, newGinServer(cfg.Server.Port)})
+	}
 
-	logger.Info("服务已启动", zap.Int("port", cfg.Server.Port), zap.String("metrics", "/metrics"))
+	for _, s := range servers {
+		go func(s namedServer) {
+			if err := s.srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatal("Server start failed", zap.String("server", s.name), zap.Error(err))
+			}
+		}(s)
+		logger.Info("服务已启动", zap.String("server", s.name), zap.Int("port", s.port), zap.String("metrics", "/metrics"))
+	}
+	if eventBus := app.Get[*events.Bus](container, "events"); eventBus != nil {
+		eventBus.Publish(events.Started(cfg))
+	}
 
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	select {
+	case <-quit:
+	case <-recovery.ShutdownRequested():
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), cfg.Shutdown.Timeout)
 	defer cancel()
@@ -119,8 +184,21 @@ func main() {
 		logger.Error("Graceful shutdown error", zap.Error(err))
 	}
 
-	// 关闭服务器
-	if err := srv.Shutdown(ctx); err != nil {
-		logger.Error("Server shutdown error", zap.Error(err))
+	// 推送最后一个增量并结束所有增量流，否则长连接会阻塞服务器关闭
+	if publisher != nil {
+		publisher.Stop()
+	}
+
+	// 同时关闭所有服务器，共享同一个超时时间
+	var wg sync.WaitGroup
+	for _, s := range servers {
+		wg.Add(1)
+		go func(s namedServer) {
+			defer wg.Done()
+			if err := s.srv.Shutdown(ctx); err != nil {
+				logger.Error("Server shutdown error", zap.String("server", s.name), zap.Error(err))
+			}
+		}(s)
 	}
+	wg.Wait()
 }
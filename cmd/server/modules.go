@@ -0,0 +1,639 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/mant7s/qps-counter/internal/analytics"
+	"github.com/mant7s/qps-counter/internal/api"
+	"github.com/mant7s/qps-counter/internal/app"
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/counter"
+	"github.com/mant7s/qps-counter/internal/events"
+	"github.com/mant7s/qps-counter/internal/health"
+	"github.com/mant7s/qps-counter/internal/ingest"
+	"github.com/mant7s/qps-counter/internal/limiter"
+	"github.com/mant7s/qps-counter/internal/loadgen"
+	"github.com/mant7s/qps-counter/internal/logger"
+	"github.com/mant7s/qps-counter/internal/metrics"
+	"github.com/mant7s/qps-counter/internal/outbound"
+	"github.com/mant7s/qps-counter/internal/replication"
+	"github.com/mant7s/qps-counter/internal/report"
+	"github.com/mant7s/qps-counter/internal/scaling"
+	"github.com/mant7s/qps-counter/internal/snapshot"
+	"github.com/mant7s/qps-counter/internal/storage"
+	"github.com/mant7s/qps-counter/internal/workers"
+	"go.uber.org/zap"
+)
+
+// modules 服务的所有子系统，新增的子系统在这里声明依赖和启用条件，不需要关心在main中的位置
+func modules() []app.Module {
+	return []app.Module{
+		{
+			// 检测卡住的后台循环，如窗口清理停止后QPS不再回落
+			Name:    "workers.watchdog",
+			Enabled: func(cfg *config.AppConfig) bool { return cfg.Watchdog.Enabled },
+			Start: func(c *app.Container) (any, error) {
+				watchdog := workers.NewWatchdog(c.Config().Watchdog)
+				c.OnStop(watchdog)
+				return watchdog, nil
+			},
+		},
+		{
+			// 增强的优雅关闭管理器，使用配置的超时时间
+			Name: "shutdown",
+			Start: func(c *app.Container) (any, error) {
+				cfg := c.Config()
+				gracefulShutdown := counter.NewEnhancedGracefulShutdown(cfg.Shutdown.Timeout, cfg.Shutdown.MaxWait)
+				gracefulShutdown.SetPolicy(cfg.Shutdown.Policy.Read, cfg.Shutdown.Policy.Write)
+				return gracefulShutdown, nil
+			},
+		},
+		{
+			// shared类型的计数器与同一台主机上嵌入计数的进程共享窗口，由本进程提供查询接口
+			Name: "counter",
+			Start: func(c *app.Container) (any, error) {
+				cfg := c.Config()
+				var qpsCounter counter.Counter
+				if cfg.Counter.Type == counter.SharedType {
+					shared, err := counter.OpenShared(&cfg.Counter)
+					if err != nil {
+						return nil, err
+					}
+					qpsCounter = shared
+				} else {
+					qpsCounter = counter.NewCounter(&cfg.Counter)
+				}
+				c.OnStop(qpsCounter)
+				// 在window_size之外同时统计counter.windows中的时间窗口
+				if len(cfg.Counter.Windows) > 0 {
+					qpsCounter = counter.NewMultiWindow(qpsCounter, &cfg.Counter)
+				}
+				return qpsCounter, nil
+			},
+		},
+		{
+			// 自适应分片管理器，分片数范围、阈值、权重和调整间隔取自counter.adaptive，
+			// 未设置时分片数为CPU核心数到其8倍，配置文件变化时重新应用；QPS加速度来自趋势跟踪器
+			Name:     "counter.adaptive",
+			Requires: []string{"counter", "counter.trend"},
+			Start: func(c *app.Container) (any, error) {
+				cfg := c.Config()
+				adaptiveManager := counter.NewEnhancedAdaptiveShardingManager(app.Get[counter.Counter](c, "counter"), &cfg.Counter, 0, 0, 0, 0)
+				adaptiveManager.SetAccelerationReader(app.Get[*counter.TrendTracker](c, "counter.trend").Acceleration)
+				adaptiveManager.Configure(cfg.Counter.Adaptive)
+				c.OnStop(adaptiveManager)
+				config.OnReload(func(next *config.AppConfig) {
+					adaptiveManager.Configure(next.Counter.Adaptive)
+				})
+				return adaptiveManager, nil
+			},
+		},
+		{
+			// QPS趋势跟踪器，提供平滑后的QPS、其变化率和最近采样的QPS加速度
+			Name:     "counter.trend",
+			Requires: []string{"counter"},
+			Start: func(c *app.Container) (any, error) {
+				cfg := c.Config()
+				trendTracker := counter.NewTrendTracker(app.Get[counter.Counter](c, "counter"), cfg.Counter.Trend.Alpha, cfg.Counter.Trend.Interval)
+				trendTracker.SetAccelerationWindow(cfg.Counter.Trend.AccelerationWindow)
+				c.OnStop(trendTracker)
+				return trendTracker, nil
+			},
+		},
+		{
+			// QPS历史记录，每秒采样一次，供查询最近一段时间的流量
+			Name:     "counter.history",
+			Requires: []string{"counter"},
+			Enabled:  func(cfg *config.AppConfig) bool { return cfg.Counter.History.Enabled },
+			Start: func(c *app.Container) (any, error) {
+				history := counter.NewHistory(app.Get[counter.Counter](c, "counter"), c.Config().Counter.History.Retention)
+				c.OnStop(history)
+				return history, nil
+			},
+		},
+		{
+			// Webhook、流量报告和限流决策投递以及增量复制订阅共用的出站客户端，按目标地址熔断并限制重试次数
+			Name: "outbound",
+			Start: func(c *app.Container) (any, error) {
+				return outbound.NewClient(c.Config().Outbound), nil
+			},
+		},
+		{
+			// 事件钩子，将流量形态变化和生命周期变化推送给外部系统
+			Name:     "events",
+			Requires: []string{"shutdown", "outbound", "counter.adaptive", "limiter"},
+			Enabled:  func(cfg *config.AppConfig) bool { return cfg.Events.Enabled },
+			Start: func(c *app.Container) (any, error) {
+				cfg := c.Config()
+				eventBus := events.NewBus(cfg.Events.QueueSize)
+				c.OnStop(eventBus)
+				eventBus.Register(events.LogHook{})
+				for _, webhook := range cfg.Events.Webhooks {
+					eventBus.Register(events.NewWebhookHook(webhook.URL, webhook.Events, webhook.Timeout, app.Get[*outbound.Client](c, "outbound")).WithSecret(webhook.Secret))
+				}
+				// 关闭开始和完成时发布事件，事件总线在关闭流程结束后才停止，完成事件可以投递出去
+				app.Get[*counter.EnhancedGracefulShutdown](c, "shutdown").SetNotify(events.ShutdownNotifier(eventBus))
+				app.Get[*counter.EnhancedAdaptiveShardingManager](c, "counter.adaptive").SetNotify(events.ShardResizeNotifier(eventBus))
+				app.Get[*limiter.RateLimiter](c, "limiter").SetNotify(events.LimiterNotifier(eventBus))
+				config.OnReload(events.ConfigReloadNotifier(eventBus, cfg))
+				return eventBus, nil
+			},
+		},
+		{
+			Name:     "events.burst",
+			Requires: []string{"counter", "events"},
+			Enabled:  func(cfg *config.AppConfig) bool { return cfg.Events.Enabled && cfg.Events.Burst.Enabled },
+			Start: func(c *app.Container) (any, error) {
+				burstDetector := events.NewBurstDetector(app.Get[counter.Counter](c, "counter"), app.Get[*events.Bus](c, "events"), c.Config().Events.Burst)
+				c.OnStop(burstDetector)
+				return burstDetector, nil
+			},
+		},
+		{
+			// 命名计数器注册表，配置了存储目录时计数器定义在重启后仍然保留
+			Name: "registry",
+			Start: func(c *app.Container) (any, error) {
+				cfg := c.Config()
+				var store storage.Storage = storage.NewMemoryStorage()
+				if cfg.Storage.Path != "" {
+					fileStore, err := storage.NewFileStorage(cfg.Storage.Path)
+					if err != nil {
+						return nil, err
+					}
+					store = fileStore
+				}
+				registry := counter.NewRegistry(cfg.Counter, store, cfg.Counter.MaxNamed)
+				if err := registry.Restore(); err != nil {
+					logger.Error("恢复命名计数器失败", zap.Error(err))
+				}
+				c.OnStop(registry)
+				return registry, nil
+			},
+		},
+		{
+			Name:  "limiter",
+			Start: startLimiter,
+		},
+		{
+			// 限流脚本处理规则无法表达的特殊情况，传给脚本的QPS为全局计数器的当前QPS
+			Name:     "limiter.script",
+			Requires: []string{"counter", "limiter"},
+			Enabled:  func(cfg *config.AppConfig) bool { return cfg.Limiter.Script.Enabled },
+			Start: func(c *app.Container) (any, error) {
+				rateLimiter := app.Get[*limiter.RateLimiter](c, "limiter")
+				qps := app.Get[counter.Counter](c, "counter").CurrentQPS
+				script, err := limiter.NewScript(c.Config().Limiter.Script, qps)
+				if err != nil {
+					return nil, err
+				}
+				rateLimiter.SetScript(script)
+				// 配置重新加载时重新编译脚本，编译失败时继续使用原来的脚本
+				config.OnReload(func(next *config.AppConfig) {
+					if !next.Limiter.Script.Enabled {
+						rateLimiter.SetScript(nil)
+						return
+					}
+					reloaded, err := limiter.NewScript(next.Limiter.Script, qps)
+					if err != nil {
+						logger.Error("重新加载限流脚本失败", zap.Error(err))
+						return
+					}
+					rateLimiter.SetScript(reloaded)
+				})
+				return script, nil
+			},
+		},
+		{
+			// 按时间段切换限流速率，如在业务低峰期放开批量上报
+			Name:     "limiter.schedule",
+			Requires: []string{"limiter"},
+			Enabled:  func(cfg *config.AppConfig) bool { return len(cfg.Limiter.Schedules) > 0 },
+			Start: func(c *app.Container) (any, error) {
+				cfg := c.Config()
+				scheduler, err := limiter.NewScheduler(app.Get[*limiter.RateLimiter](c, "limiter"), cfg.Limiter.Rate, cfg.Limiter.Burst, cfg.Limiter.Schedules, limiter.SystemClock{})
+				if err != nil {
+					return nil, err
+				}
+				c.OnStop(scheduler)
+				return scheduler, nil
+			},
+		},
+		{
+			// QPS持续超过阈值时自动启用限流器，持续低于阈值时停用
+			Name:     "limiter.auto",
+			Requires: []string{"counter", "limiter"},
+			Enabled:  func(cfg *config.AppConfig) bool { return cfg.Limiter.Auto.Enabled },
+			Start: func(c *app.Container) (any, error) {
+				qps := app.Get[counter.Counter](c, "counter").CurrentQPS
+				auto := limiter.NewAutoToggle(app.Get[*limiter.RateLimiter](c, "limiter"), c.Config().Limiter.Auto, qps, limiter.SystemClock{})
+				c.OnStop(auto)
+				return auto, nil
+			},
+		},
+		{
+			// 限流器自身出错时，/collect默认放行，管理操作默认拒绝
+			Name: "limiter.failure",
+			Start: func(c *app.Container) (any, error) {
+				cfg := c.Config()
+				return limiter.NewFailurePolicy(cfg.Limiter.Failure.Default, cfg.Limiter.Failure.Routes), nil
+			},
+		},
+		{
+			// 记录限流决策，供离线分析限流模式
+			Name:     "limiter.decisions",
+			Requires: []string{"outbound"},
+			Enabled:  func(cfg *config.AppConfig) bool { return cfg.Limiter.Decisions.Enabled },
+			Start: func(c *app.Container) (any, error) {
+				cfg := c.Config()
+				sink, err := analytics.NewSink(cfg.Limiter.Decisions, app.Get[*outbound.Client](c, "outbound"))
+				if err != nil {
+					return nil, err
+				}
+				decisionLog := analytics.NewDecisionLog(cfg.Limiter.Decisions, sink)
+				c.OnStop(decisionLog)
+				return decisionLog, nil
+			},
+		},
+		{
+			// 扩缩容建议，综合QPS、限流拒绝、CPU和内存以及趋势预测
+			Name:     "scaling",
+			Requires: []string{"counter", "counter.trend", "limiter"},
+			Enabled:  func(cfg *config.AppConfig) bool { return cfg.Scaling.Enabled },
+			Start: func(c *app.Container) (any, error) {
+				advisor := scaling.NewAdvisor(c.Config().Scaling, app.Get[counter.Counter](c, "counter"),
+					app.Get[*counter.TrendTracker](c, "counter.trend"), app.Get[*limiter.RateLimiter](c, "limiter"))
+				c.OnStop(advisor)
+				return advisor, nil
+			},
+		},
+		{
+			// 指标收集器，所有指标注册到同一个注册表，Gin和fasthttp的指标端点都从该注册表导出
+			// 未启用时为nil，其他模块照常调用Register，不会注册任何指标
+			Name:     "metrics",
+			Requires: []string{"counter", "counter.trend", "counter.adaptive", "shutdown", "limiter", "limiter.failure", "outbound"},
+			Enabled:  func(cfg *config.AppConfig) bool { return cfg.Metrics.Enabled },
+			Start: func(c *app.Container) (any, error) {
+				metricsCollector := metrics.NewMetricsWithRegistry(app.Get[counter.Counter](c, "counter"),
+					metrics.ResolveLabels(c.Config().Metrics.Labels), prometheus.NewRegistry())
+				if err := metricsCollector.Register(metrics.NewLimiterFailureCollector(app.Get[*limiter.FailurePolicy](c, "limiter.failure"))); err != nil {
+					logger.Error("注册限流器失败策略指标失败", zap.Error(err))
+				}
+				if err := metricsCollector.Register(metrics.NewRecoveryCollector()); err != nil {
+					logger.Error("注册panic指标失败", zap.Error(err))
+				}
+				if err := metricsCollector.Register(metrics.NewWorkerCollector()); err != nil {
+					logger.Error("注册后台协程指标失败", zap.Error(err))
+				}
+				if err := metricsCollector.Register(metrics.NewOverflowCollector()); err != nil {
+					logger.Error("注册计数溢出指标失败", zap.Error(err))
+				}
+				if err := metricsCollector.Register(metrics.NewLateCollector()); err != nil {
+					logger.Error("注册延迟上报指标失败", zap.Error(err))
+				}
+				if err := metricsCollector.Register(metrics.NewTrendCollector(app.Get[*counter.TrendTracker](c, "counter.trend"))); err != nil {
+					logger.Error("注册QPS趋势指标失败", zap.Error(err))
+				}
+				if err := metricsCollector.Register(metrics.NewOutboundCollector(app.Get[*outbound.Client](c, "outbound"))); err != nil {
+					logger.Error("注册出站请求指标失败", zap.Error(err))
+				}
+				if err := metricsCollector.Register(metrics.NewStatsCollector(app.Get[*limiter.RateLimiter](c, "limiter"),
+					app.Get[*counter.EnhancedAdaptiveShardingManager](c, "counter.adaptive"), app.Get[*counter.EnhancedGracefulShutdown](c, "shutdown"))); err != nil {
+					logger.Error("注册限流器、分片和关闭状态指标失败", zap.Error(err))
+				}
+				return metricsCollector, nil
+			},
+		},
+		{
+			// 按标签组合计数，并导出带标签的指标
+			Name:     "counter.tags",
+			Requires: []string{"metrics"},
+			Enabled:  func(cfg *config.AppConfig) bool { return len(cfg.Counter.Tags.Keys) > 0 },
+			Start: func(c *app.Container) (any, error) {
+				taggedCounter := counter.NewTaggedCounter(&c.Config().Counter)
+				if err := app.Get[*metrics.Metrics](c, "metrics").Register(metrics.NewTaggedCollector(taggedCounter)); err != nil {
+					logger.Error("注册标签指标失败", zap.Error(err))
+				}
+				return taggedCounter, nil
+			},
+		},
+		{
+			// 定时生成流量报告，启用事件钩子时报告中包含突增和阈值跨越事件
+			Name:     "report",
+			Requires: []string{"counter", "counter.tags", "limiter", "outbound", "events"},
+			Enabled:  func(cfg *config.AppConfig) bool { return cfg.Report.Enabled },
+			Start: func(c *app.Container) (any, error) {
+				reporter := report.NewReporter(c.Config().Report, app.Get[counter.Counter](c, "counter"),
+					app.Get[*counter.TaggedCounter](c, "counter.tags"), app.Get[*limiter.RateLimiter](c, "limiter"), app.Get[*outbound.Client](c, "outbound"))
+				c.OnStop(reporter)
+				if eventBus := app.Get[*events.Bus](c, "events"); eventBus != nil {
+					eventBus.Register(reporter)
+				}
+				return reporter, nil
+			},
+		},
+		{
+			// 采集开关，事故处理时可以通过管理接口暂停所有数据源的计数
+			Name: "ingest.switch",
+			Start: func(c *app.Container) (any, error) {
+				return ingest.NewSwitch(c.Config().Ingest.PauseMode), nil
+			},
+		},
+		{
+			// 重复上报检测，发现同一主机上多个sidecar代理重复上报相同流量，/diagnostics返回检测结果
+			Name:    "ingest.duplicates",
+			Enabled: func(cfg *config.AppConfig) bool { return cfg.Ingest.Duplicates.Enabled },
+			Start: func(c *app.Container) (any, error) {
+				detector := ingest.NewDuplicateDetector(c.Config().Ingest.Duplicates)
+				c.OnStop(detector)
+				return detector, nil
+			},
+		},
+		{
+			// 上报签名校验，拒绝不可信网段中伪造或重放的上报
+			Name:    "ingest.signing",
+			Enabled: func(cfg *config.AppConfig) bool { return cfg.Ingest.Signing.Enabled },
+			Start: func(c *app.Container) (any, error) {
+				verifier := ingest.NewSignatureVerifier(c.Config().Ingest.Signing)
+				c.OnStop(verifier)
+				return verifier, nil
+			},
+		},
+		{
+			// 租户分区，按租户分别计数和保存QPS历史，查询接口按令牌限定可见的租户
+			Name:    "counter.tenants",
+			Enabled: func(cfg *config.AppConfig) bool { return cfg.Tenants.Enabled },
+			Start: func(c *app.Container) (any, error) {
+				store := counter.NewTenantStore(&c.Config().Counter, c.Config().Tenants)
+				c.OnStop(store)
+				return store, nil
+			},
+		},
+		{
+			// 按key计数，上报数据中的key（如接口名、租户）分别统计QPS，并导出key数量、溢出和清理指标
+			Name:     "counter.keys",
+			Requires: []string{"metrics"},
+			Enabled:  func(cfg *config.AppConfig) bool { return cfg.Counter.Keys.Enabled },
+			Start: func(c *app.Container) (any, error) {
+				keyedCounter := counter.NewKeyedCounter(&c.Config().Counter)
+				if err := app.Get[*metrics.Metrics](c, "metrics").Register(metrics.NewKeysCollector(keyedCounter)); err != nil {
+					logger.Error("注册按key计数指标失败", zap.Error(err))
+				}
+				c.OnStop(keyedCounter)
+				return keyedCounter, nil
+			},
+		},
+		{
+			// 请求延迟直方图，统计上报数据中的latency_ms，/stats返回p50/p95/p99延迟
+			Name:    "counter.latency",
+			Enabled: func(cfg *config.AppConfig) bool { return cfg.Counter.Latency.Enabled },
+			Start: func(c *app.Container) (any, error) {
+				return counter.NewLatencyHistogram(&c.Config().Counter), nil
+			},
+		},
+		{
+			// 加权计数，统计上报数据中的weight，/v1/qps和/stats返回与QPS并行的加权速率，并导出加权速率指标
+			Name:     "counter.weighted",
+			Requires: []string{"metrics"},
+			Enabled:  func(cfg *config.AppConfig) bool { return cfg.Counter.Weighted.Enabled },
+			Start: func(c *app.Container) (any, error) {
+				weighted := counter.NewWeightedWindow(&c.Config().Counter)
+				if err := app.Get[*metrics.Metrics](c, "metrics").Register(metrics.NewWeightedCollector(weighted)); err != nil {
+					logger.Error("注册加权速率指标失败", zap.Error(err))
+				}
+				return weighted, nil
+			},
+		},
+		{
+			// 按key和标签组合统计的延迟直方图，GET /latency按key或标签查询延迟分布
+			Name:     "counter.latency.series",
+			Requires: []string{"counter.latency"},
+			Enabled: func(cfg *config.AppConfig) bool {
+				return cfg.Counter.Latency.Enabled && (cfg.Counter.Latency.PerKey || cfg.Counter.Latency.PerTag)
+			},
+			Start: func(c *app.Container) (any, error) {
+				return counter.NewLatencySeries(&c.Config().Counter), nil
+			},
+		},
+		{
+			// 调用方统计，用于定位流量突增的来源
+			Name:    "counter.clients",
+			Enabled: func(cfg *config.AppConfig) bool { return cfg.Counter.Clients.Enabled },
+			Start: func(c *app.Container) (any, error) {
+				clientTracker := counter.NewClientTracker(&c.Config().Counter)
+				c.OnStop(clientTracker)
+				return clientTracker, nil
+			},
+		},
+		{
+			// 增量复制的上报节点，把写入计数器的增量推送给订阅的只读副本
+			// 关闭时由main在关闭服务器之前停止，否则长连接会阻塞服务器关闭
+			Name:     "replication.publisher",
+			Requires: []string{"counter"},
+			Enabled: func(cfg *config.AppConfig) bool {
+				return cfg.Replication.Enabled && cfg.Server.Role != api.RoleQuery
+			},
+			Start: func(c *app.Container) (any, error) {
+				return replication.NewPublisher(app.Get[counter.Counter](c, "counter"), c.Config().Replication.Interval), nil
+			},
+		},
+		{
+			// query角色的只读副本订阅上报节点的增量流，不需要接收原始上报流量
+			Name:     "replication.follower",
+			Requires: []string{"counter", "outbound"},
+			Enabled: func(cfg *config.AppConfig) bool {
+				return cfg.Replication.Enabled && cfg.Server.Role == api.RoleQuery
+			},
+			Start: func(c *app.Container) (any, error) {
+				cfg := c.Config()
+				follower := replication.NewFollower(app.Get[counter.Counter](c, "counter"), cfg.Replication.Leaders, cfg.Server.AdminToken, app.Get[*outbound.Client](c, "outbound"))
+				c.OnStop(follower)
+				return follower, nil
+			},
+		},
+		{
+			// 上报写入的计数器，启用增量复制时经过上报节点的包装
+			Name:     "counter.write",
+			Requires: []string{"counter", "replication.publisher"},
+			Start: func(c *app.Container) (any, error) {
+				if publisher := app.Get[*replication.Publisher](c, "replication.publisher"); publisher != nil {
+					return counter.Counter(publisher), nil
+				}
+				return app.Get[counter.Counter](c, "counter"), nil
+			},
+		},
+		{
+			// 采集工作池，UDP、Kafka等数据源共享该工作池向计数器写入事件
+			// query角色的实例不接受上报，也不启动采集工作池
+			Name:     "ingest",
+			Requires: []string{"counter.write", "counter.tags", "counter.keys", "ingest.switch", "metrics"},
+			Enabled: func(cfg *config.AppConfig) bool {
+				return cfg.Ingest.Enabled && cfg.Server.Role != api.RoleQuery
+			},
+			Start: func(c *app.Container) (any, error) {
+				ingestPool := ingest.NewPool(c.Config().Ingest,
+					ingest.CounterSink(app.Get[counter.Counter](c, "counter.write"), app.Get[*counter.TaggedCounter](c, "counter.tags"), app.Get[*counter.KeyedCounter](c, "counter.keys")),
+					app.Get[*ingest.Switch](c, "ingest.switch"))
+				c.OnStop(ingestPool)
+				if err := app.Get[*metrics.Metrics](c, "metrics").Register(metrics.NewIngestCollector(ingestPool)); err != nil {
+					logger.Error("注册采集指标失败", zap.Error(err))
+				}
+				return ingestPool, nil
+			},
+		},
+		{
+			// 采集管道，UDP、日志文件等数据源共享解码、key归一化、采样和指标后提交到采集工作池
+			// 在工作池之后启动，关闭时先于工作池停止，数据源停止读取后工作池再处理完剩余的事件
+			Name:     "ingest.pipelines",
+			Requires: []string{"ingest", "metrics"},
+			Enabled: func(cfg *config.AppConfig) bool {
+				return cfg.Ingest.Enabled && len(cfg.Ingest.Pipelines) > 0 && cfg.Server.Role != api.RoleQuery
+			},
+			Start: func(c *app.Container) (any, error) {
+				pool := app.Get[*ingest.Pool](c, "ingest")
+				pipelines := make([]*ingest.Pipeline, 0, len(c.Config().Ingest.Pipelines))
+				for _, pipelineCfg := range c.Config().Ingest.Pipelines {
+					pipeline, err := ingest.NewPipeline(pipelineCfg, pool)
+					if err != nil {
+						return nil, err
+					}
+					c.OnStop(pipeline)
+					pipelines = append(pipelines, pipeline)
+					logger.Info("采集管道已启动",
+						zap.String("pipeline", pipelineCfg.Name),
+						zap.String("source", pipelineCfg.Source),
+						zap.String("address", pipelineCfg.Address),
+						zap.String("path", pipelineCfg.Path))
+				}
+				if err := app.Get[*metrics.Metrics](c, "metrics").Register(metrics.NewPipelineCollector(pipelines)); err != nil {
+					logger.Error("注册采集管道指标失败", zap.Error(err))
+				}
+				return pipelines, nil
+			},
+		},
+		{
+			// 内置压测，不经过网络直接向上报写入的计数器生成计数，与其他数据源一样受采集开关控制
+			// query角色的实例不接受上报，也不提供内置压测
+			Name:     "loadgen",
+			Requires: []string{"counter.write", "counter.keys", "ingest.switch"},
+			Enabled:  func(cfg *config.AppConfig) bool { return cfg.Server.Role != api.RoleQuery },
+			Start: func(c *app.Container) (any, error) {
+				generator := loadgen.NewGenerator(c.Config().LoadGen, app.Get[counter.Counter](c, "counter.write"),
+					app.Get[*counter.KeyedCounter](c, "counter.keys"), app.Get[*ingest.Switch](c, "ingest.switch"))
+				c.OnStop(generator)
+				return generator, nil
+			},
+		},
+		{
+			// 计数器快照，启动时恢复上次退出前的窗口、按key计数和QPS历史，之后定期写入；
+			// 在采集和内置压测之后停止，最后一次快照包含关闭期间写入的计数
+			Name:     "snapshot",
+			Requires: []string{"counter", "counter.keys", "counter.history", "ingest", "loadgen"},
+			Enabled:  func(cfg *config.AppConfig) bool { return cfg.Snapshot.Enabled },
+			Start: func(c *app.Container) (any, error) {
+				cfg := c.Config()
+				dir := cfg.Snapshot.Path
+				if dir == "" {
+					dir = cfg.Storage.Path
+				}
+				store, err := storage.NewFileStorage(dir)
+				if err != nil {
+					return nil, err
+				}
+				snapshotter := snapshot.NewSnapshotter(cfg.Snapshot, cfg.Counter.Precision, store, app.Get[counter.Counter](c, "counter"),
+					app.Get[*counter.KeyedCounter](c, "counter.keys"), app.Get[*counter.History](c, "counter.history"))
+				if err := snapshotter.Restore(); err != nil {
+					logger.Error("恢复计数器快照失败", zap.Error(err))
+				}
+				snapshotter.Start()
+				c.OnStop(snapshotter)
+				return snapshotter, nil
+			},
+		},
+		{
+			// 组件健康检查，/healthz 聚合各组件的状态，启用指标时同时导出每个组件的健康状态
+			// 只为已启用的组件注册检查
+			Name: "health",
+			Requires: []string{"shutdown", "limiter", "ingest", "ingest.switch", "replication.follower", "outbound", "snapshot",
+				"workers.watchdog", "metrics"},
+			Start: func(c *app.Container) (any, error) {
+				registry := health.NewRegistry()
+				registry.Register("shutdown", health.ShutdownCheck(app.Get[*counter.EnhancedGracefulShutdown](c, "shutdown")))
+				registry.Register("limiter", health.LimiterCheck(app.Get[*limiter.RateLimiter](c, "limiter")))
+				registry.Register("outbound", health.OutboundCheck(app.Get[*outbound.Client](c, "outbound")))
+				if app.Get[*workers.Watchdog](c, "workers.watchdog") != nil {
+					registry.Register("workers", health.WorkersCheck())
+				}
+				if c.Config().Server.Role != api.RoleQuery {
+					registry.Register("ingest", health.IngestCheck(app.Get[*ingest.Pool](c, "ingest"), app.Get[*ingest.Switch](c, "ingest.switch")))
+				}
+				if follower := app.Get[*replication.Follower](c, "replication.follower"); follower != nil {
+					registry.Register("replication", health.FollowerCheck(follower))
+				}
+				if snapshotter := app.Get[*snapshot.Snapshotter](c, "snapshot"); snapshotter != nil {
+					registry.Register("snapshot", health.SnapshotCheck(snapshotter))
+				}
+				if err := app.Get[*metrics.Metrics](c, "metrics").Register(metrics.NewHealthCollector(registry)); err != nil {
+					logger.Error("注册组件健康指标失败", zap.Error(err))
+				}
+				return registry, nil
+			},
+		},
+		{
+			// 组件健康检查的整体状态离开或回到healthy时发布事件
+			Name:     "events.health",
+			Requires: []string{"events", "health"},
+			Enabled:  func(cfg *config.AppConfig) bool { return cfg.Events.Enabled },
+			Start: func(c *app.Container) (any, error) {
+				healthWatcher := events.NewHealthWatcher(app.Get[*health.Registry](c, "health"), app.Get[*events.Bus](c, "events"), c.Config().Events.HealthInterval)
+				c.OnStop(healthWatcher)
+				return healthWatcher, nil
+			},
+		},
+		{
+			// 其他模块注册完指标后开始周期性采集
+			Name:     "metrics.collect",
+			Requires: []string{"metrics", "counter.tags", "ingest", "health"},
+			Enabled:  func(cfg *config.AppConfig) bool { return cfg.Metrics.Enabled },
+			Start: func(c *app.Container) (any, error) {
+				metricsCollector := app.Get[*metrics.Metrics](c, "metrics")
+				metricsCollector.Start(c.Config().Metrics.Interval)
+				c.OnStop(metricsCollector)
+				return metricsCollector, nil
+			},
+		},
+	}
+}
+
+// startLimiter 创建限流器，配置文件变化时重新应用限流规则和全局速率
+func startLimiter(c *app.Container) (any, error) {
+	cfg := c.Config()
+	rateLimiter := limiter.NewRateLimiter(cfg.Limiter.Rate, cfg.Limiter.Burst, cfg.Limiter.Adaptive)
+	// 根据配置决定是否启用限流器
+	rateLimiter.SetEnabled(cfg.Limiter.Enabled)
+	// 按字节限流时，rate和burst表示每秒字节数和突发字节数
+	if cfg.Limiter.Unit != "" {
+		rateLimiter.SetUnit(cfg.Limiter.Unit)
+	}
+	// 请求可以通过cost参数声明消耗的令牌数，未配置时默认消耗1个、最多声明100
+	rateLimiter.SetCostLimits(cfg.Limiter.DefaultCost, cfg.Limiter.MaxCost)
+	// 识别API Key和租户的请求头，限流规则匹配和决策日志共用
+	rateLimiter.SetIdentityHeaders(cfg.Limiter.KeyHeader, cfg.Limiter.TenantHeader)
+	// 按顺序匹配的限流规则，未匹配任何规则的请求使用全局的rate和burst
+	if len(cfg.Limiter.Rules) > 0 {
+		if err := rateLimiter.SetRules(limiter.RuleSpecsFromConfig(cfg.Limiter.Rules)); err != nil {
+			return nil, err
+		}
+	}
+	// 配置文件中的规则变化时才替换，未变化的规则保留令牌桶状态和通过管理接口设置的规则；
+	// 配置了时间段时全局速率由调度器管理，不随配置文件变化
+	reloadRules := limiter.RulesReloader(rateLimiter, cfg.Limiter.Rules)
+	limiterRate, limiterBurst := cfg.Limiter.Rate, cfg.Limiter.Burst
+	config.OnReload(func(next *config.AppConfig) {
+		reloadRules(next.Limiter.Rules)
+		if len(cfg.Limiter.Schedules) == 0 && (next.Limiter.Rate != limiterRate || next.Limiter.Burst != limiterBurst) {
+			limiterRate, limiterBurst = next.Limiter.Rate, next.Limiter.Burst
+			rateLimiter.SetProfile(rateLimiter.Profile(), limiterRate, limiterBurst)
+		}
+	})
+	return rateLimiter, nil
+}
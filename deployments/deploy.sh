@@ -29,7 +29,7 @@ docker-compose up -d --scale qps-counter=3
 # Health check
 echo "Checking service health..."
 for i in {1..10}; do
-    if curl -s http://localhost:8080/healthz | grep -q "OK"; then
+    if curl -sf http://localhost:8080/healthz > /dev/null; then
         echo "Service is healthy"
         break
     else
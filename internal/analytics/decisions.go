@@ -0,0 +1,186 @@
+package analytics
+
+import (
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/logger"
+	"github.com/mant7s/qps-counter/internal/workers"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultQueueSize     = 10000
+	defaultBatchSize     = 500
+	defaultFlushInterval = time.Second
+)
+
+// Decision 一次限流判断的结果
+type Decision struct {
+	Time       time.Time `json:"time"`
+	Allowed    bool      `json:"allowed"`
+	Limited    bool      `json:"limited,omitempty"`     // 超过了规则的限额，shadow动作下仍然放行
+	SampleRate float64   `json:"sample_rate,omitempty"` // 放行决策的抽样比例，离线分析时按其倒数还原放行总数
+	Rule       string    `json:"rule,omitempty"`        // 匹配的限流规则，限流器出错时为空
+	Action     string    `json:"action,omitempty"`      // 匹配的规则的动作
+	Key        string    `json:"key,omitempty"`
+	Tenant     string    `json:"tenant,omitempty"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Cost       int64     `json:"cost"`
+	Error      string    `json:"error,omitempty"` // 限流器出错时的错误，此时按失败策略决定是否放行
+}
+
+// DecisionLog 异步记录限流决策：所有拒绝和超过限额的决策，以及按比例抽样的放行，按批写入Sink
+// 请求路径上只做一次非阻塞入队，队列已满时丢弃决策；nil表示未启用，所有方法都可以在nil上调用
+type DecisionLog struct {
+	sink          Sink
+	sampleRate    float64
+	batchSize     int
+	flushInterval time.Duration
+
+	queue    chan Decision
+	worker   *workers.Worker
+	stopChan chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+
+	recorded atomic.Int64 // 入队的决策数
+	dropped  atomic.Int64 // 队列已满被丢弃的决策数
+	written  atomic.Int64 // 成功写入Sink的决策数
+	failed   atomic.Int64 // 写入失败的决策数
+}
+
+// NewDecisionLog 创建决策日志并启动写入协程，Stop时关闭sink
+func NewDecisionLog(cfg config.DecisionLogConfig, sink Sink) *DecisionLog {
+	l := &DecisionLog{
+		sink:          sink,
+		sampleRate:    cfg.SampleRate,
+		batchSize:     cfg.BatchSize,
+		flushInterval: cfg.FlushInterval,
+		stopChan:      make(chan struct{}),
+	}
+	queueSize := cfg.QueueSize
+	if queueSize <= 0 {
+		queueSize = defaultQueueSize
+	}
+	if l.batchSize <= 0 {
+		l.batchSize = defaultBatchSize
+	}
+	if l.flushInterval <= 0 {
+		l.flushInterval = defaultFlushInterval
+	}
+	l.queue = make(chan Decision, queueSize)
+
+	l.worker = workers.Register("analytics.decisions", l.flushInterval)
+	l.worker.Go(&l.wg, l.run)
+	return l
+}
+
+// Record 记录一次限流决策，未超过限额的放行决策按抽样比例记录
+func (l *DecisionLog) Record(d Decision) {
+	if l == nil {
+		return
+	}
+	if d.Allowed && !d.Limited {
+		if l.sampleRate <= 0 || (l.sampleRate < 1 && rand.Float64() >= l.sampleRate) {
+			return
+		}
+		d.SampleRate = l.sampleRate
+	}
+	if d.Time.IsZero() {
+		d.Time = time.Now()
+	}
+
+	select {
+	case l.queue <- d:
+		l.recorded.Add(1)
+	default:
+		dropped := l.dropped.Add(1)
+		if dropped%1000 == 1 { // 避免日志过多
+			logger.Warn("限流决策队列已满，丢弃决策", zap.Int64("dropped_count", dropped))
+		}
+	}
+}
+
+func (l *DecisionLog) run() {
+	ticker := time.NewTicker(l.flushInterval)
+	defer ticker.Stop()
+	batch := make([]Decision, 0, l.batchSize)
+
+	for {
+		select {
+		case d := <-l.queue:
+			batch = append(batch, d)
+			if len(batch) >= l.batchSize {
+				batch = l.flush(batch)
+			}
+		case <-ticker.C:
+			batch = l.flush(batch)
+			l.worker.Ran()
+		case <-l.stopChan:
+			// 写入队列中剩余的决策
+			for {
+				select {
+				case d := <-l.queue:
+					batch = append(batch, d)
+					if len(batch) >= l.batchSize {
+						batch = l.flush(batch)
+					}
+				default:
+					l.flush(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+// flush 写入一批决策，返回清空后的批次；写入失败时丢弃该批次
+func (l *DecisionLog) flush(batch []Decision) []Decision {
+	if len(batch) == 0 {
+		return batch
+	}
+	if err := l.sink.Write(batch); err != nil {
+		l.failed.Add(int64(len(batch)))
+		l.worker.Fail(err)
+		logger.Warn("写入限流决策失败", zap.Int("count", len(batch)), zap.Error(err))
+	} else {
+		l.written.Add(int64(len(batch)))
+	}
+	return batch[:0]
+}
+
+// GetStats 获取决策日志的统计信息
+func (l *DecisionLog) GetStats() map[string]interface{} {
+	if l == nil {
+		return map[string]interface{}{"enabled": false}
+	}
+	return map[string]interface{}{
+		"enabled":     true,
+		"sink":        l.sink.Name(),
+		"sample_rate": l.sampleRate,
+		"queued":      len(l.queue),
+		"recorded":    l.recorded.Load(),
+		"dropped":     l.dropped.Load(),
+		"written":     l.written.Load(),
+		"failed":      l.failed.Load(),
+	}
+}
+
+// Stop 停止写入协程，写入剩余的决策后关闭sink
+func (l *DecisionLog) Stop() {
+	if l == nil {
+		return
+	}
+	l.stopOnce.Do(func() {
+		close(l.stopChan)
+		l.wg.Wait()
+		if err := l.sink.Close(); err != nil {
+			logger.Warn("关闭限流决策日志失败", zap.Error(err))
+		}
+	})
+}
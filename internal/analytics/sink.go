@@ -0,0 +1,128 @@
+package analytics
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/outbound"
+)
+
+const defaultHTTPTimeout = 10 * time.Second
+
+// Sink 限流决策的写入目标，由写入协程按批调用，不需要并发安全
+type Sink interface {
+	Name() string
+	Write(batch []Decision) error
+	Close() error
+}
+
+// NewSink 按配置创建写入目标，client为nil时使用默认配置的出站客户端
+func NewSink(cfg config.DecisionLogConfig, client *outbound.Client) (Sink, error) {
+	switch cfg.Sink {
+	case "file":
+		return NewFileSink(cfg.Path)
+	case "http":
+		return NewHTTPSink(cfg.URL, client), nil
+	default:
+		return nil, fmt.Errorf("unsupported decision sink: %s", cfg.Sink)
+	}
+}
+
+// FileSink 以追加方式写入文件，每行一条JSON，可以由日志采集工具转发到Kafka等系统
+type FileSink struct {
+	file *os.File
+	w    *bufio.Writer
+}
+
+// NewFileSink 打开或创建文件
+func NewFileSink(path string) (*FileSink, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open decision log: %w", err)
+	}
+	return &FileSink{file: file, w: bufio.NewWriter(file)}, nil
+}
+
+// Name 实现Sink接口
+func (s *FileSink) Name() string {
+	return "file"
+}
+
+// Write 实现Sink接口，每批写入后刷新缓冲区
+func (s *FileSink) Write(batch []Decision) error {
+	encoder := json.NewEncoder(s.w)
+	for _, d := range batch {
+		if err := encoder.Encode(d); err != nil {
+			return fmt.Errorf("failed to write decision: %w", err)
+		}
+	}
+	return s.w.Flush()
+}
+
+// Close 实现Sink接口
+func (s *FileSink) Close() error {
+	if err := s.w.Flush(); err != nil {
+		s.file.Close()
+		return err
+	}
+	return s.file.Close()
+}
+
+// HTTPSink 将每批决策以JSON数组POST到外部端点，如分析服务或Kafka REST代理
+type HTTPSink struct {
+	url     string
+	timeout time.Duration // 单次投递的超时时间，包括重试
+	client  *outbound.Client
+}
+
+// NewHTTPSink 创建HTTP写入目标，client为nil时使用默认配置的出站客户端
+func NewHTTPSink(url string, client *outbound.Client) *HTTPSink {
+	if client == nil {
+		client = outbound.NewClient(config.OutboundConfig{})
+	}
+	return &HTTPSink{url: url, timeout: defaultHTTPTimeout, client: client}
+}
+
+// Name 实现Sink接口
+func (s *HTTPSink) Name() string {
+	return "http"
+}
+
+// Write 实现Sink接口
+func (s *HTTPSink) Write(batch []Decision) error {
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return fmt.Errorf("failed to marshal decisions: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post decisions: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Close 实现Sink接口
+func (s *HTTPSink) Close() error {
+	return nil
+}
@@ -0,0 +1,18 @@
+package api
+
+import (
+	"crypto/subtle"
+	"strings"
+)
+
+// adminAuthorized 校验 Authorization: Bearer <token> 是否为管理员令牌，未配置令牌时始终返回false
+func adminAuthorized(adminToken, authorization string) bool {
+	if adminToken == "" {
+		return false
+	}
+	token, ok := strings.CutPrefix(authorization, "Bearer ")
+	if !ok {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) == 1
+}
@@ -0,0 +1,197 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/counter"
+	"github.com/mant7s/qps-counter/internal/ingest"
+	"github.com/mant7s/qps-counter/internal/logger"
+	"go.uber.org/zap"
+)
+
+// 批量管理接口支持的操作
+const (
+	BatchSetRate       = "set_rate"       // {"op": "set_rate", "rate": N}
+	BatchToggleLimiter = "toggle_limiter" // {"op": "toggle_limiter", "enabled": true}
+	BatchPauseIngest   = "pause_ingest"   // {"op": "pause_ingest"}
+	BatchResumeIngest  = "resume_ingest"  // {"op": "resume_ingest"}
+	BatchCreateCounter = "create_counter" // {"op": "create_counter", "counter": {...}}
+
+	maxBatchOperations = 100
+)
+
+// 批量操作中每一项的执行结果
+const (
+	batchApplied    = "applied"     // 已执行
+	batchRolledBack = "rolled_back" // 已执行，因后续操作失败被撤销
+	batchSkipped    = "skipped"     // 未执行
+	batchInvalid    = "invalid"     // 校验失败，整个批次都不执行
+	batchFailed     = "failed"      // 执行失败，之前已执行的操作被撤销
+)
+
+// BatchOperation 批量管理接口中的一项操作
+type BatchOperation struct {
+	Op      string               `json:"op"`
+	Rate    config.Count         `json:"rate,omitempty"` // 整数或 "1.5k" 这样的字符串
+	Enabled *bool                `json:"enabled,omitempty"`
+	Counter *counter.CounterSpec `json:"counter,omitempty"`
+}
+
+// BatchResult 一项操作的执行结果
+type BatchResult struct {
+	Index  int    `json:"index"`
+	Op     string `json:"op"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// batchMu 串行执行批量操作，保证回滚恢复的是本批次执行之前的状态
+var batchMu sync.Mutex
+
+// adminBatch 批量操作依赖的组件
+type adminBatch struct {
+	rateLimiter  LimiterControl
+	ingestSwitch *ingest.Switch
+	registry     *counter.Registry
+}
+
+// decodeBatchRequest 解析 {"operations": [...]}
+func decodeBatchRequest(body []byte) ([]BatchOperation, error) {
+	var req struct {
+		Operations []BatchOperation `json:"operations"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, errors.New("无效的批量操作参数")
+	}
+	if len(req.Operations) == 0 {
+		return nil, errors.New("批量操作不能为空")
+	}
+	if len(req.Operations) > maxBatchOperations {
+		return nil, fmt.Errorf("批量操作数量不能超过%d", maxBatchOperations)
+	}
+	return req.Operations, nil
+}
+
+// run 先校验所有操作，全部有效时按顺序执行，任何一项执行失败时按相反顺序撤销已执行的操作
+// 返回HTTP状态码和响应体
+func (b adminBatch) run(ops []BatchOperation) (int, map[string]interface{}) {
+	results := make([]BatchResult, len(ops))
+	valid := true
+	creating := make(map[string]bool)
+	for i, op := range ops {
+		results[i] = BatchResult{Index: i, Op: op.Op, Status: batchSkipped}
+		if err := b.validate(op, creating); err != nil {
+			results[i].Status = batchInvalid
+			results[i].Error = err.Error()
+			valid = false
+		}
+	}
+	if !valid {
+		return http.StatusBadRequest, batchResponse(false, results)
+	}
+
+	batchMu.Lock()
+	defer batchMu.Unlock()
+
+	undo := make([]func(), 0, len(ops))
+	for i, op := range ops {
+		rollback, err := b.apply(op)
+		if err != nil {
+			results[i].Status = batchFailed
+			results[i].Error = err.Error()
+			for j := len(undo) - 1; j >= 0; j-- {
+				undo[j]()
+				results[j].Status = batchRolledBack
+			}
+			logger.Warn("批量管理操作执行失败，已撤销",
+				zap.Int("index", i),
+				zap.String("op", op.Op),
+				zap.Error(err))
+			return registryErrorStatus(err), batchResponse(false, results)
+		}
+		undo = append(undo, rollback)
+		results[i].Status = batchApplied
+	}
+
+	logger.Info("批量管理操作已执行", zap.Int("operations", len(ops)))
+	return http.StatusOK, batchResponse(true, results)
+}
+
+// validate 校验一项操作，creating记录本批次中已出现的计数器名称
+func (b adminBatch) validate(op BatchOperation, creating map[string]bool) error {
+	switch op.Op {
+	case BatchSetRate:
+		if op.Rate <= 0 {
+			return errors.New("速率必须大于0")
+		}
+	case BatchToggleLimiter:
+		if op.Enabled == nil {
+			return errors.New("缺少enabled参数")
+		}
+	case BatchPauseIngest, BatchResumeIngest:
+		if b.ingestSwitch == nil {
+			return errors.New("采集开关未启用")
+		}
+	case BatchCreateCounter:
+		if b.registry == nil {
+			return errors.New("命名计数器未启用")
+		}
+		if op.Counter == nil {
+			return errors.New("缺少counter参数")
+		}
+		if err := b.registry.Validate(*op.Counter); err != nil {
+			return err
+		}
+		if _, ok := b.registry.Info(op.Counter.Name); ok || creating[op.Counter.Name] {
+			return counter.ErrCounterExists
+		}
+		creating[op.Counter.Name] = true
+	default:
+		return fmt.Errorf("不支持的操作: %s", op.Op)
+	}
+	return nil
+}
+
+// apply 执行一项操作，返回撤销该操作的函数
+func (b adminBatch) apply(op BatchOperation) (func(), error) {
+	switch op.Op {
+	case BatchSetRate:
+		previous := b.rateLimiter.Rate()
+		b.rateLimiter.SetRate(int64(op.Rate))
+		return func() { b.rateLimiter.SetRate(previous) }, nil
+	case BatchToggleLimiter:
+		previous := b.rateLimiter.Enabled()
+		b.rateLimiter.SetEnabled(*op.Enabled)
+		return func() { b.rateLimiter.SetEnabled(previous) }, nil
+	case BatchPauseIngest:
+		if !b.ingestSwitch.Pause() {
+			return func() {}, nil
+		}
+		return func() { b.ingestSwitch.Resume() }, nil
+	case BatchResumeIngest:
+		if !b.ingestSwitch.Resume() {
+			return func() {}, nil
+		}
+		return func() { b.ingestSwitch.Pause() }, nil
+	case BatchCreateCounter:
+		if _, err := b.registry.Create(*op.Counter); err != nil {
+			return nil, err
+		}
+		name := op.Counter.Name
+		return func() { b.registry.Purge(name) }, nil
+	default:
+		return nil, fmt.Errorf("不支持的操作: %s", op.Op)
+	}
+}
+
+func batchResponse(applied bool, results []BatchResult) map[string]interface{} {
+	return map[string]interface{}{
+		"applied": applied,
+		"results": results,
+	}
+}
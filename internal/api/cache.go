@@ -0,0 +1,132 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/valyala/fasthttp"
+)
+
+// cacheControl 返回 /qps、/stats 和 /qps/history 的Cache-Control，
+// 未配置server.cache_max_age时为no-cache，缓存可以保存响应但每次都需要用ETag向服务端验证
+// 启用租户分区时响应因令牌而异，只允许客户端自己缓存，共享缓存不能把一个租户的响应返回给另一个租户
+func (o RouterOptions) cacheControl() string {
+	if o.CacheMaxAge <= 0 {
+		if o.Tenants != nil {
+			return "private, no-cache"
+		}
+		return "no-cache"
+	}
+	scope := "public"
+	if o.Tenants != nil {
+		scope = "private"
+	}
+	seconds := int64((o.CacheMaxAge + time.Second - 1) / time.Second)
+	return scope + ", max-age=" + strconv.FormatInt(seconds, 10)
+}
+
+// etag 返回响应体的弱ETag，相同的响应体得到相同的ETag
+// 使用弱ETag是因为响应经过压缩等转换后字节不同，但内容等价
+func etag(body []byte) string {
+	h := fnv.New64a()
+	h.Write(body)
+	return fmt.Sprintf(`W/"%016x"`, h.Sum64())
+}
+
+// etagMatches 返回If-None-Match是否匹配tag，按弱比较处理逗号分隔的列表和 *
+func etagMatches(ifNoneMatch, tag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	tag = strings.TrimPrefix(tag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheWriter 缓存Gin处理器写入的状态码和响应体，处理完成后再决定返回完整响应还是304
+type cacheWriter struct {
+	gin.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *cacheWriter) WriteHeader(code int) {
+	w.status = code
+}
+
+func (w *cacheWriter) WriteHeaderNow() {}
+
+func (w *cacheWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *cacheWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+func (w *cacheWriter) Status() int {
+	return w.status
+}
+
+func (w *cacheWriter) Size() int {
+	return w.body.Len()
+}
+
+func (w *cacheWriter) Written() bool {
+	return false
+}
+
+// cacheMiddleware 为成功的响应设置ETag和Cache-Control，
+// 请求的If-None-Match与ETag匹配时返回不带响应体的304，减少轮询面板的传输量
+func cacheMiddleware(cacheControl string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		original := c.Writer
+		w := &cacheWriter{ResponseWriter: original, status: http.StatusOK}
+		c.Writer = w
+		c.Next()
+		c.Writer = original
+
+		if w.status == http.StatusOK {
+			tag := etag(w.body.Bytes())
+			original.Header().Set("ETag", tag)
+			original.Header().Set("Cache-Control", cacheControl)
+			if etagMatches(c.GetHeader("If-None-Match"), tag) {
+				original.Header().Del("Content-Type")
+				original.WriteHeader(http.StatusNotModified)
+				original.WriteHeaderNow()
+				return
+			}
+		}
+		original.WriteHeader(w.status)
+		original.Write(w.body.Bytes())
+	}
+}
+
+// cacheFastHTTP 与cacheMiddleware相同，用于fasthttp处理器
+func cacheFastHTTP(cacheControl string, next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		next(ctx)
+		if ctx.Response.StatusCode() != http.StatusOK {
+			return
+		}
+
+		tag := etag(ctx.Response.Body())
+		ctx.Response.Header.Set("ETag", tag)
+		ctx.Response.Header.Set("Cache-Control", cacheControl)
+		if etagMatches(string(ctx.Request.Header.Peek("If-None-Match")), tag) {
+			ctx.Response.ResetBody()
+			ctx.SetStatusCode(http.StatusNotModified)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package api
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/mant7s/qps-counter/internal/counter"
+)
+
+const maxClientsTop = 100
+
+// parseTop 解析/clients的top参数，为空时返回0表示使用配置的top_n
+func parseTop(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	top, err := strconv.Atoi(value)
+	if err != nil || top <= 0 || top > maxClientsTop {
+		return 0, errors.New("top必须是1到100之间的整数")
+	}
+	return top, nil
+}
+
+// clientsResponse 构造/clients的响应
+func clientsResponse(ct *counter.ClientTracker, top int) map[string]interface{} {
+	clients := make(map[string][]counter.ClientStat, len(counter.ClientDimensions))
+	for _, dimension := range counter.ClientDimensions {
+		clients[dimension] = ct.Top(dimension, top)
+	}
+
+	stats := ct.GetStats()
+	return map[string]interface{}{
+		"clients":  clients,
+		"tracked":  stats["tracked"],
+		"overflow": stats["overflow"],
+	}
+}
@@ -0,0 +1,306 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mant7s/qps-counter/internal/analytics"
+	"github.com/mant7s/qps-counter/internal/counter"
+	"github.com/mant7s/qps-counter/internal/ingest"
+	"github.com/mant7s/qps-counter/internal/limiter"
+)
+
+// 数据上报格式版本
+const (
+	CollectVersionV1 = 1 // {"count": N}，可以附带 "key"、"latency_ms" 和 "weight"
+	CollectVersionV2 = 2 // {"version": 2, "key": "...", "count": N, "size": N, "weight": N, "latency_ms": N, "timestamp": ..., "attributes": {...}}
+
+	// CollectV2ContentType 通过Content-Type协商v2格式
+	CollectV2ContentType = "application/vnd.qps-counter.v2+json"
+
+	maxCollectKeyLength   = 256
+	maxCollectAttributes  = 16
+	maxCollectAttrKeySize = 64
+	maxCollectAttrValSize = 256
+	maxCollectLatencyMs   = float64(24 * time.Hour / time.Millisecond)
+)
+
+var errUnsupportedCollectVersion = errors.New("不支持的数据版本")
+
+// CollectRequest 归一化后的上报请求，v1与v2格式解码后统一为该结构
+type CollectRequest struct {
+	Version    int
+	Key        string
+	Count      int64
+	Size       int64 // 请求大小（字节），用于bytes单位的计数器
+	Timestamp  int64 // 事件的Unix毫秒时间戳，0表示使用服务端接收时间
+	Attributes map[string]string
+
+	Latency    time.Duration // 请求耗时，HasLatency为false时未上报
+	HasLatency bool
+
+	Weight float64 // 本次上报的总权重（如字节数、成本单位），计入加权速率，0表示未上报
+}
+
+// Amount 返回写入给定单位计数器的数量
+// bytes单位的计数器优先使用size，未提供size时使用count；其他单位使用count
+func (r CollectRequest) Amount(unit string) int64 {
+	if unit == counter.UnitBytes && r.Size > 0 {
+		return r.Size
+	}
+	return r.Count
+}
+
+// ByteCost 返回按字节限流时该请求消耗的令牌数
+// 优先使用上报的size，未提供时使用请求体的长度
+func (r CollectRequest) ByteCost(bodyLen int) int64 {
+	if r.Size > 0 {
+		return r.Size
+	}
+	return int64(bodyLen)
+}
+
+// Delay 返回事件时间早于now的时长，未携带timestamp或事件时间晚于now时返回0
+func (r CollectRequest) Delay(now time.Time) time.Duration {
+	if r.Timestamp == 0 {
+		return 0
+	}
+	return max(now.Sub(time.UnixMilli(r.Timestamp)), 0)
+}
+
+// EventTime 返回事件发生的时间，未携带timestamp或事件时间晚于now时为now
+func (r CollectRequest) EventTime(now time.Time) time.Time {
+	return now.Add(-r.Delay(now))
+}
+
+// writeCount 把上报的数量写入计数器，携带timestamp时写入事件时间所在的槽位
+// 事件时间已超出窗口等原因无法写入时丢弃并返回false，丢弃的上报不再计入其他维度
+func writeCount(target counter.Counter, req CollectRequest, amount int64) bool {
+	return counter.AddDelayed(target, amount, req.Delay(time.Now()))
+}
+
+// collectEnvelope 用于识别数据版本并解码各版本字段
+type collectEnvelope struct {
+	Version    int               `json:"version"`
+	Key        string            `json:"key"`
+	Count      *int64            `json:"count"`
+	Size       int64             `json:"size"`
+	Timestamp  int64             `json:"timestamp"`
+	Attributes map[string]string `json:"attributes"`
+	LatencyMs  *float64          `json:"latency_ms"`
+	Weight     float64           `json:"weight"`
+}
+
+// decodeCollectRequest 根据Content-Type或version字段解码上报数据
+// 未声明版本的请求按v1处理，保证已部署的agent无需改动
+func decodeCollectRequest(contentType string, body []byte) (CollectRequest, error) {
+	var envelope collectEnvelope
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return CollectRequest{}, err
+	}
+
+	version := envelope.Version
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil && mediaType == CollectV2ContentType {
+		if version != 0 && version != CollectVersionV2 {
+			return CollectRequest{}, errUnsupportedCollectVersion
+		}
+		version = CollectVersionV2
+	}
+
+	switch version {
+	case 0, CollectVersionV1:
+		req := CollectRequest{Version: CollectVersionV1, Key: envelope.Key, Timestamp: envelope.Timestamp, Weight: envelope.Weight}
+		if envelope.Count != nil {
+			req.Count = *envelope.Count
+		}
+		if len(req.Key) > maxCollectKeyLength {
+			return CollectRequest{}, fmt.Errorf("key长度不能超过%d", maxCollectKeyLength)
+		}
+		if req.Timestamp < 0 {
+			return CollectRequest{}, errors.New("timestamp不能为负数")
+		}
+		if err := req.setLatency(envelope.LatencyMs); err != nil {
+			return CollectRequest{}, err
+		}
+		if err := validateWeight(req.Weight); err != nil {
+			return CollectRequest{}, err
+		}
+		return req, nil
+	case CollectVersionV2:
+		return decodeCollectV2(envelope)
+	default:
+		return CollectRequest{}, errUnsupportedCollectVersion
+	}
+}
+
+// decodeCollectV2 校验并转换v2格式的上报数据
+func decodeCollectV2(envelope collectEnvelope) (CollectRequest, error) {
+	req := CollectRequest{
+		Version:    CollectVersionV2,
+		Key:        envelope.Key,
+		Count:      1, // v2格式count默认为1
+		Size:       envelope.Size,
+		Weight:     envelope.Weight,
+		Timestamp:  envelope.Timestamp,
+		Attributes: envelope.Attributes,
+	}
+	if envelope.Count != nil {
+		req.Count = *envelope.Count
+	}
+
+	if req.Count < 0 {
+		return CollectRequest{}, errors.New("count不能为负数")
+	}
+	if req.Size < 0 {
+		return CollectRequest{}, errors.New("size不能为负数")
+	}
+	if err := validateWeight(req.Weight); err != nil {
+		return CollectRequest{}, err
+	}
+	if len(req.Key) > maxCollectKeyLength {
+		return CollectRequest{}, fmt.Errorf("key长度不能超过%d", maxCollectKeyLength)
+	}
+	if req.Timestamp < 0 {
+		return CollectRequest{}, errors.New("timestamp不能为负数")
+	}
+	if err := req.setLatency(envelope.LatencyMs); err != nil {
+		return CollectRequest{}, err
+	}
+	if len(req.Attributes) > maxCollectAttributes {
+		return CollectRequest{}, fmt.Errorf("attributes数量不能超过%d", maxCollectAttributes)
+	}
+	for k, v := range req.Attributes {
+		if k == "" || len(k) > maxCollectAttrKeySize || len(v) > maxCollectAttrValSize {
+			return CollectRequest{}, fmt.Errorf("无效的attribute: %s", k)
+		}
+	}
+
+	return req, nil
+}
+
+// setLatency 校验并设置上报的latency_ms，未上报时不设置
+func (r *CollectRequest) setLatency(latencyMs *float64) error {
+	if latencyMs == nil {
+		return nil
+	}
+	if math.IsNaN(*latencyMs) || *latencyMs < 0 || *latencyMs > maxCollectLatencyMs {
+		return errors.New("latency_ms必须在0到86400000之间")
+	}
+	r.Latency = time.Duration(*latencyMs * float64(time.Millisecond))
+	r.HasLatency = true
+	return nil
+}
+
+// validateWeight 校验上报的weight，JSON无法表示NaN和无穷大，只需检查负数
+func validateWeight(weight float64) error {
+	if weight < 0 {
+		return errors.New("weight不能为负数")
+	}
+	return nil
+}
+
+// collectDimensions 全局计数器之外按标签组合和key计数的计数器、延迟直方图和加权计数
+// 未启用的维度为nil，写入命名计数器时为零值，nil的维度不计数
+type collectDimensions struct {
+	tagged        *counter.TaggedCounter
+	keyed         *counter.KeyedCounter
+	latency       *counter.LatencyHistogram
+	latencySeries *counter.LatencySeries
+	weighted      *counter.WeightedWindow
+	duplicates    *ingest.DuplicateDetector
+	source        string // 上报来源，用于重复上报检测
+	tenants       *counter.TenantStore
+	tenant        string // 上报计入的租户，为空时不计入任何租户
+}
+
+// duplicate 记录一次上报用于重复上报检测，返回该上报是否属于merge模式下的重复上报流，此时不再计数
+func (d collectDimensions) duplicate(req CollectRequest, amount int64) bool {
+	return d.duplicates.Observe(d.source, req.Key, amount)
+}
+
+// add 按上报数据的标签组合、key和租户计数，上报了latency_ms时在全局和按维度的直方图中各记录一次延迟，
+// 上报了weight时按事件时间计入加权速率
+func (d collectDimensions) add(req CollectRequest, amount int64) {
+	if req.HasLatency {
+		d.latency.Observe(req.Latency)
+		d.latencySeries.Observe(req.Key, req.Attributes, req.Latency)
+	}
+	if req.Weight > 0 {
+		d.weighted.Record(req.Weight, req.EventTime(time.Now()))
+	}
+	if amount <= 0 {
+		return
+	}
+	d.tagged.Add(req.Attributes, amount)
+	d.keyed.Add(req.Key, amount)
+	d.tenants.Add(d.tenant, amount)
+}
+
+// signatureErrorStatus 上报签名校验失败时的状态码，nonce记录已满时为503，其他为401
+func signatureErrorStatus(err error) int {
+	if errors.Is(err, ingest.ErrNonceCacheFull) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusUnauthorized
+}
+
+// CostParam 上报请求声明令牌消耗的查询参数，如 /collect?cost=5
+const CostParam = "cost"
+
+// requestCost 解析请求声明的令牌消耗，未声明时使用limiter.default_cost
+func requestCost(rl Allower, raw string) (int64, error) {
+	if raw == "" {
+		return rl.Cost(0)
+	}
+	declared, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || declared <= 0 {
+		return 0, fmt.Errorf("%w: %s", limiter.ErrInvalidCost, raw)
+	}
+	return rl.Cost(declared)
+}
+
+// allowLimiter 按限流规则检查是否放行cost个令牌，限流器出错时按路由的失败策略决定，判断结果写入决策日志
+func allowLimiter(rl Allower, policy *limiter.FailurePolicy, decisions *analytics.DecisionLog, req limiter.Request, cost int64, trace *decisionTrace) bool {
+	tokens := trace.limiterTokens(rl)
+	var verdict limiter.Verdict
+	allowed, err := policy.Decide(req.Path, func() (bool, error) {
+		var err error
+		verdict, err = rl.CheckRequest(req, cost)
+		return verdict.Allowed, err
+	})
+
+	decision := analytics.Decision{
+		Allowed: allowed,
+		Limited: verdict.Limited,
+		Rule:    verdict.Rule,
+		Action:  verdict.Action,
+		Key:     req.Key,
+		Tenant:  req.Tenant,
+		Method:  req.Method,
+		Path:    req.Path,
+		Cost:    cost,
+	}
+	if err != nil {
+		decision.Error = err.Error()
+		decisions.Record(decision)
+		trace.addLimiterFailure(policy.For(req.Path), err, allowed)
+		return allowed
+	}
+	decisions.Record(decision)
+	trace.addLimiter(rl, verdict, cost, tokens)
+	return allowed
+}
+
+// limiterAvailable 管理操作前检查限流器是否可用，不可用时按路由的失败策略决定是否继续
+func limiterAvailable(rl Allower, policy *limiter.FailurePolicy, path string) bool {
+	allowed, _ := policy.Decide(path, func() (bool, error) {
+		return true, rl.Err()
+	})
+	return allowed
+}
@@ -0,0 +1,160 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/mant7s/qps-counter/internal/analytics"
+	"github.com/mant7s/qps-counter/internal/counter"
+	"github.com/mant7s/qps-counter/internal/limiter"
+)
+
+const (
+	// CollectBatchNDJSONContentType 批量上报使用NDJSON时的Content-Type，每行一条上报数据
+	CollectBatchNDJSONContentType = "application/x-ndjson"
+
+	// maxCollectBatchBytes 批量上报请求体的上限，请求体按条解码，不会一次读入内存
+	maxCollectBatchBytes = 32 << 20
+	// maxCollectBatchErrors 被拒绝的条目达到该数量时中止处理
+	maxCollectBatchErrors = 100
+)
+
+var (
+	errCollectBatchNotArray    = errors.New("批量上报必须是JSON数组或NDJSON")
+	errCollectBatchTooLarge    = errors.New("批量上报请求体过大")
+	errCollectBatchTooManyErrs = errors.New("被拒绝的条目过多")
+	errCollectBatchLimited     = errors.New("请求被限流")
+)
+
+// CollectBatchError 批量上报中一条被拒绝的条目
+type CollectBatchError struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
+
+// CollectBatchResult 批量上报的处理结果
+// 中止前已写入的条目不会撤销，中止位置之后的条目都未处理
+type CollectBatchResult struct {
+	Accepted    int                 `json:"accepted"`
+	Rejected    int                 `json:"rejected"`
+	Errors      []CollectBatchError `json:"errors,omitempty"`
+	Aborted     bool                `json:"aborted"`
+	AbortIndex  *int                `json:"abort_index,omitempty"` // 第一条未处理的条目
+	AbortReason string              `json:"abort_reason,omitempty"`
+}
+
+// batchCollector 逐条解码批量上报并写入计数器
+type batchCollector struct {
+	target        counter.Counter
+	dimensions    collectDimensions
+	rateLimiter   Allower
+	limiterPolicy *limiter.FailurePolicy
+	decisions     *analytics.DecisionLog
+	request       limiter.Request // 参与限流规则匹配的请求属性
+	cost          int64           // 每条数据消耗的令牌数，按字节限流时使用每条数据的大小
+}
+
+// run 读取并处理请求体，返回HTTP状态码和处理结果
+// 单条数据无效时拒绝该条并继续；请求体格式错误、超过大小上限、拒绝条目过多或被限流时中止
+func (b batchCollector) run(contentType string, body io.Reader) (int, CollectBatchResult) {
+	var result CollectBatchResult
+	index := 0
+	abort := func(status int, err error) (int, CollectBatchResult) {
+		at := index
+		result.Aborted = true
+		result.AbortIndex = &at
+		result.AbortReason = err.Error()
+		return status, result
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	ndjson := mediaType == CollectBatchNDJSONContentType
+	decoder := json.NewDecoder(http.MaxBytesReader(nil, io.NopCloser(body), maxCollectBatchBytes))
+	if !ndjson {
+		if token, err := decoder.Token(); err != nil || token != json.Delim('[') {
+			return abort(batchDecodeStatus(err), errCollectBatchNotArray)
+		}
+	}
+
+	byteLimited := b.rateLimiter.Unit() == limiter.UnitBytes
+	unit := counter.UnitOf(b.target)
+	for ; ndjson || decoder.More(); index++ {
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			if ndjson && err == io.EOF {
+				break
+			}
+			return abort(batchDecodeStatus(err), batchDecodeError(err))
+		}
+
+		req, err := decodeCollectRequest("", raw)
+		if err != nil {
+			result.Rejected++
+			result.Errors = append(result.Errors, CollectBatchError{Index: index, Error: err.Error()})
+			if len(result.Errors) >= maxCollectBatchErrors {
+				index++
+				return abort(http.StatusBadRequest, errCollectBatchTooManyErrs)
+			}
+			continue
+		}
+
+		cost := b.cost
+		if byteLimited {
+			cost = req.ByteCost(len(raw))
+		}
+		if !allowLimiter(b.rateLimiter, b.limiterPolicy, b.decisions, b.request, cost, nil) {
+			return abort(http.StatusTooManyRequests, errCollectBatchLimited)
+		}
+
+		amount := req.Amount(unit)
+		if !b.dimensions.duplicate(req, amount) {
+			if writeCount(b.target, req, amount) {
+				b.dimensions.add(req, amount)
+			}
+		}
+		result.Accepted++
+	}
+
+	if !ndjson {
+		if _, err := decoder.Token(); err != nil {
+			return abort(batchDecodeStatus(err), batchDecodeError(err))
+		}
+	}
+	return http.StatusAccepted, result
+}
+
+// batchDecodeStatus 请求体超过上限时返回413，其他解码错误返回400
+func batchDecodeStatus(err error) int {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+func batchDecodeError(err error) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return errCollectBatchTooLarge
+	}
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// traceDetail 返回决策追踪中记录的批量处理摘要
+func (r CollectBatchResult) traceDetail() map[string]interface{} {
+	detail := map[string]interface{}{
+		"accepted": r.Accepted,
+		"rejected": r.Rejected,
+		"aborted":  r.Aborted,
+	}
+	if r.Aborted {
+		detail["abort_reason"] = r.AbortReason
+	}
+	return detail
+}
@@ -0,0 +1,11 @@
+package api
+
+// ContractVersion 公开接口响应结构的版本号，客户端可以通过 /contract-version 校验
+// 删除字段、修改字段类型等不兼容的变更需要提升该版本，新增字段不需要
+// 响应结构由 tests/contract 中的golden文件约束
+const ContractVersion = 2
+
+// contractVersionResponse 构造/contract-version的响应
+func contractVersionResponse() map[string]interface{} {
+	return map[string]interface{}{"contract_version": ContractVersion}
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/mant7s/qps-counter/internal/counter"
+)
+
+// registryErrorStatus 将命名计数器注册表的错误映射为HTTP状态码
+func registryErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, counter.ErrCounterNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, counter.ErrCounterDeleted):
+		return http.StatusGone
+	case errors.Is(err, counter.ErrCounterExists), errors.Is(err, counter.ErrTooManyCounters):
+		return http.StatusConflict
+	case errors.Is(err, counter.ErrInvalidCounterName), errors.Is(err, counter.ErrInvalidCounterSpec):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// deleteCounterResponse 删除命名计数器的响应，计数器进入保留期时附带清除时间
+func deleteCounterResponse(registry *counter.Registry, name string) map[string]interface{} {
+	resp := map[string]interface{}{"message": "计数器已删除", "name": name}
+	if info, ok := registry.Info(name); ok && info.PurgeAt != nil {
+		resp["state"] = info.State
+		resp["purge_at"] = info.PurgeAt
+	}
+	return resp
+}
+
+// countersResponse 构造/counters的分页响应，默认按名称排序
+func countersResponse(registry *counter.Registry, p pageParams) map[string]interface{} {
+	result := paginate(registry.List(), p, func(info counter.CounterInfo) pageCursor {
+		return pageCursor{Name: info.Spec.Name, QPS: float64(info.QPS)}
+	})
+	return map[string]interface{}{
+		"counters":       result.Items,
+		"next_cursor":    result.NextCursor,
+		"total_estimate": result.Total,
+	}
+}
@@ -0,0 +1,247 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/counter"
+	"github.com/mant7s/qps-counter/internal/logger"
+	"go.uber.org/zap"
+)
+
+// 声明式配置差异中的操作
+const (
+	ConfigCreate  = "create"  // 创建计数器
+	ConfigUpdate  = "update"  // 修改限流器参数
+	ConfigReplace = "replace" // 计数器定义变化，清除后按新定义重建，已有计数丢失
+	ConfigDelete  = "delete"  // 删除未列出的计数器，配置了保留期时进入保留期
+	ConfigRestore = "restore" // 恢复保留期内已删除的计数器
+)
+
+// DeclaredConfig PUT /admin/config 的声明式文档，省略的部分不受管理、保持不变
+type DeclaredConfig struct {
+	Limiter *DeclaredLimiter `json:"limiter,omitempty"`
+	// Counters 出现时（包括空数组）为完整的命名计数器集合，未列出的计数器被删除
+	Counters *[]counter.CounterSpec `json:"counters,omitempty"`
+}
+
+// DeclaredLimiter 声明的限流器参数，省略的字段保持不变
+type DeclaredLimiter struct {
+	Rate    *config.Count `json:"rate,omitempty"` // 整数或 "1.5k" 这样的字符串
+	Enabled *bool         `json:"enabled,omitempty"`
+}
+
+// ConfigChange 声明式文档与运行时状态的一项差异
+type ConfigChange struct {
+	Resource string      `json:"resource"` // limiter 或 counter
+	Name     string      `json:"name"`     // 限流器的参数名或计数器名称
+	Action   string      `json:"action"`
+	Before   interface{} `json:"before,omitempty"`
+	After    interface{} `json:"after,omitempty"`
+}
+
+// declarativeApply 将运行时状态收敛到声明式文档
+type declarativeApply struct {
+	rateLimiter LimiterControl
+	registry    *counter.Registry
+}
+
+// decodeDeclaredConfig 解析声明式文档，未知字段视为错误，避免拼写错误被静默忽略
+func decodeDeclaredConfig(body []byte) (DeclaredConfig, error) {
+	var doc DeclaredConfig
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&doc); err != nil {
+		return doc, fmt.Errorf("无效的配置文档: %v", err)
+	}
+	return doc, nil
+}
+
+// parseDryRun 解析dry_run参数，为true时只返回差异不执行
+func parseDryRun(value string) (bool, error) {
+	if value == "" {
+		return false, nil
+	}
+	dryRun, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, errors.New("无效的dry_run参数")
+	}
+	return dryRun, nil
+}
+
+// run 计算差异并按顺序执行，任何一项失败时按相反顺序撤销已执行的变更
+// 返回HTTP状态码和响应体
+func (d declarativeApply) run(doc DeclaredConfig, dryRun bool) (int, map[string]interface{}) {
+	// 与批量管理操作串行执行，保证差异基于最新状态且回滚不会覆盖其他操作
+	batchMu.Lock()
+	defer batchMu.Unlock()
+
+	changes, err := d.plan(doc)
+	if err != nil {
+		return http.StatusBadRequest, map[string]interface{}{"error": err.Error()}
+	}
+	if dryRun || len(changes) == 0 {
+		return http.StatusOK, configResponse(!dryRun, dryRun, changes)
+	}
+
+	undo := make([]func(), 0, len(changes))
+	for i, change := range changes {
+		rollback, err := d.apply(change)
+		if err != nil {
+			for j := len(undo) - 1; j >= 0; j-- {
+				undo[j]()
+			}
+			logger.Warn("声明式配置执行失败，已撤销",
+				zap.Int("index", i),
+				zap.String("resource", change.Resource),
+				zap.String("name", change.Name),
+				zap.String("action", change.Action),
+				zap.Error(err))
+			resp := configResponse(false, false, changes)
+			resp["error"] = fmt.Sprintf("%s %s %s: %v", change.Action, change.Resource, change.Name, err)
+			return registryErrorStatus(err), resp
+		}
+		undo = append(undo, rollback)
+	}
+
+	logger.Info("声明式配置已执行", zap.Int("changes", len(changes)))
+	return http.StatusOK, configResponse(true, false, changes)
+}
+
+// plan 校验文档并计算差异：限流器参数在前，随后是删除的计数器，最后按文档顺序创建、重建或恢复计数器
+func (d declarativeApply) plan(doc DeclaredConfig) ([]ConfigChange, error) {
+	var changes []ConfigChange
+
+	if l := doc.Limiter; l != nil {
+		if l.Rate != nil {
+			if *l.Rate <= 0 {
+				return nil, errors.New("速率必须大于0")
+			}
+			if rate, current := int64(*l.Rate), d.rateLimiter.Rate(); current != rate {
+				changes = append(changes, ConfigChange{Resource: "limiter", Name: "rate", Action: ConfigUpdate, Before: current, After: rate})
+			}
+		}
+		if l.Enabled != nil {
+			if current := d.rateLimiter.Enabled(); current != *l.Enabled {
+				changes = append(changes, ConfigChange{Resource: "limiter", Name: "enabled", Action: ConfigUpdate, Before: current, After: *l.Enabled})
+			}
+		}
+	}
+
+	if doc.Counters == nil {
+		return changes, nil
+	}
+	if d.registry == nil {
+		return nil, errors.New("命名计数器未启用")
+	}
+
+	declared := make(map[string]bool, len(*doc.Counters))
+	specs := make([]counter.CounterSpec, 0, len(*doc.Counters))
+	for _, spec := range *doc.Counters {
+		spec, err := d.registry.Normalize(spec)
+		if err != nil {
+			return nil, fmt.Errorf("计数器 %s: %w", spec.Name, err)
+		}
+		if declared[spec.Name] {
+			return nil, fmt.Errorf("计数器 %s 重复", spec.Name)
+		}
+		declared[spec.Name] = true
+		specs = append(specs, spec)
+	}
+
+	for _, info := range d.registry.List() {
+		if !declared[info.Spec.Name] && info.State == counter.CounterStateActive {
+			changes = append(changes, ConfigChange{Resource: "counter", Name: info.Spec.Name, Action: ConfigDelete, Before: info.Spec})
+		}
+	}
+	for _, spec := range specs {
+		info, ok := d.registry.Info(spec.Name)
+		switch {
+		case !ok:
+			changes = append(changes, ConfigChange{Resource: "counter", Name: spec.Name, Action: ConfigCreate, After: spec})
+		case info.Spec != spec:
+			changes = append(changes, ConfigChange{Resource: "counter", Name: spec.Name, Action: ConfigReplace, Before: info.Spec, After: spec})
+		case info.State == counter.CounterStateDeleted:
+			changes = append(changes, ConfigChange{Resource: "counter", Name: spec.Name, Action: ConfigRestore, After: spec})
+		}
+	}
+	return changes, nil
+}
+
+// apply 执行一项变更，返回撤销该变更的函数
+func (d declarativeApply) apply(change ConfigChange) (func(), error) {
+	if change.Resource == "limiter" {
+		switch change.Name {
+		case "rate":
+			previous := change.Before.(int64)
+			d.rateLimiter.SetRate(change.After.(int64))
+			return func() { d.rateLimiter.SetRate(previous) }, nil
+		default:
+			previous := change.Before.(bool)
+			d.rateLimiter.SetEnabled(change.After.(bool))
+			return func() { d.rateLimiter.SetEnabled(previous) }, nil
+		}
+	}
+
+	name := change.Name
+	switch change.Action {
+	case ConfigCreate:
+		if _, err := d.registry.Create(change.After.(counter.CounterSpec)); err != nil {
+			return nil, err
+		}
+		return func() { d.registry.Purge(name) }, nil
+	case ConfigDelete:
+		if err := d.registry.Delete(name); err != nil {
+			return nil, err
+		}
+		before := change.Before.(counter.CounterSpec)
+		return func() {
+			// 未配置保留期时计数器已被清除，只能按原定义重建
+			if _, err := d.registry.Undelete(name); err != nil {
+				d.registry.Create(before)
+			}
+		}, nil
+	case ConfigReplace:
+		info, _ := d.registry.Info(name)
+		if err := d.registry.Purge(name); err != nil {
+			return nil, err
+		}
+		rollback := func() {
+			d.registry.Create(info.Spec)
+			if info.State == counter.CounterStateDeleted {
+				d.registry.Delete(name)
+			}
+		}
+		if _, err := d.registry.Create(change.After.(counter.CounterSpec)); err != nil {
+			rollback()
+			return nil, err
+		}
+		return func() {
+			d.registry.Purge(name)
+			rollback()
+		}, nil
+	case ConfigRestore:
+		if _, err := d.registry.Undelete(name); err != nil {
+			return nil, err
+		}
+		return func() { d.registry.Delete(name) }, nil
+	default:
+		return nil, fmt.Errorf("不支持的操作: %s", change.Action)
+	}
+}
+
+func configResponse(applied, dryRun bool, changes []ConfigChange) map[string]interface{} {
+	if changes == nil {
+		changes = []ConfigChange{}
+	}
+	return map[string]interface{}{
+		"applied": applied,
+		"dry_run": dryRun,
+		"changes": changes,
+	}
+}
@@ -1,30 +1,195 @@
 package api
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
+	"github.com/mant7s/qps-counter/internal/analytics"
+	"github.com/mant7s/qps-counter/internal/config"
 	"github.com/mant7s/qps-counter/internal/counter"
+	"github.com/mant7s/qps-counter/internal/health"
+	"github.com/mant7s/qps-counter/internal/ingest"
 	"github.com/mant7s/qps-counter/internal/limiter"
+	"github.com/mant7s/qps-counter/internal/loadgen"
+	"github.com/mant7s/qps-counter/internal/pressure"
+	"github.com/mant7s/qps-counter/internal/replication"
+	"github.com/mant7s/qps-counter/internal/report"
+	"github.com/mant7s/qps-counter/internal/scaling"
+	"github.com/mant7s/qps-counter/internal/workers"
 	"github.com/valyala/fasthttp"
 	"net/http"
+	"time"
 )
 
 type FastHTTPHandler struct {
 	counter          counter.Counter
-	gracefulShutdown *counter.EnhancedGracefulShutdown
-	rateLimiter      *limiter.RateLimiter
+	gracefulShutdown ShutdownTracker
+	rateLimiter      Limiter
+	limiterPolicy    *limiter.FailurePolicy
+	decisions        *analytics.DecisionLog
+	sharding         *counter.EnhancedAdaptiveShardingManager
+	trendTracker     *counter.TrendTracker
+	history          *counter.History
+	taggedCounter    *counter.TaggedCounter
+	keyedCounter     *counter.KeyedCounter
+	clientTracker    *counter.ClientTracker
+	latency          *counter.LatencyHistogram
+	latencySeries    *counter.LatencySeries
+	weighted         *counter.WeightedWindow
+	registry         *counter.Registry
+	ingestSwitch     *ingest.Switch
+	duplicates       *ingest.DuplicateDetector
+	signatures       *ingest.SignatureVerifier
+	tenants          *counter.TenantStore
+	publisher        *replication.Publisher
+	follower         *replication.Follower
+	advisor          *scaling.Advisor
+	reporter         *report.Reporter
+	loadGenerator    *loadgen.Generator
+	health           *health.Registry
+	adminToken       string
+	rateFormat       rateFormat // 速率默认保留的小数位数和时间单位
 }
 
-func NewFastHTTPHandler(c counter.Counter, gs *counter.EnhancedGracefulShutdown, rl *limiter.RateLimiter) *FastHTTPHandler {
+func NewFastHTTPHandler(opts RouterOptions) *FastHTTPHandler {
 	return &FastHTTPHandler{
-		counter:          c,
-		gracefulShutdown: gs,
-		rateLimiter:      rl,
+		counter:          opts.Counter,
+		gracefulShutdown: opts.GracefulShutdown,
+		rateLimiter:      opts.RateLimiter,
+		limiterPolicy:    opts.FailurePolicy,
+		decisions:        opts.DecisionLog,
+		sharding:         opts.Sharding,
+		trendTracker:     opts.TrendTracker,
+		history:          opts.History,
+		taggedCounter:    opts.TaggedCounter,
+		keyedCounter:     opts.KeyedCounter,
+		clientTracker:    opts.ClientTracker,
+		latency:          opts.Latency,
+		latencySeries:    opts.LatencySeries,
+		weighted:         opts.Weighted,
+		registry:         opts.Registry,
+		ingestSwitch:     opts.IngestSwitch,
+		duplicates:       opts.Duplicates,
+		signatures:       opts.Signatures,
+		tenants:          opts.Tenants,
+		publisher:        opts.Publisher,
+		follower:         opts.Follower,
+		advisor:          opts.Advisor,
+		reporter:         opts.Reporter,
+		loadGenerator:    opts.LoadGenerator,
+		health:           opts.Health,
+		adminToken:       opts.AdminToken,
+		rateFormat:       opts.rateFormat(),
 	}
 }
 
 func (h *FastHTTPHandler) Collect(ctx *fasthttp.RequestCtx) {
+	h.collect(ctx, h.counter, h.dimensions())
+}
+
+// admitCollect 统计调用方并检查采集是否暂停，返回false时已写入响应
+func (h *FastHTTPHandler) admitCollect(ctx *fasthttp.RequestCtx, trace *decisionTrace) bool {
+	// 统计调用方，被暂停或限流的请求同样计入，便于定位流量突增的来源
+	h.clientTracker.RecordWith(func(apiKeyHeader string) counter.ClientIdentity {
+		return counter.ClientIdentity{
+			UserAgent: string(ctx.Request.Header.UserAgent()),
+			APIKey:    string(ctx.Request.Header.Peek(apiKeyHeader)),
+			IP:        ctx.RemoteIP().String(),
+		}
+	}, 1)
+
+	// 采集暂停期间不再计入新事件
+	if h.ingestSwitch.Paused() {
+		h.ingestSwitch.Drop()
+		trace.add("pause", map[string]interface{}{"mode": h.ingestSwitch.Mode()})
+		if h.ingestSwitch.Mode() == ingest.PauseDrop {
+			ctx.SetStatusCode(http.StatusAccepted)
+		} else {
+			ctx.SetStatusCode(http.StatusServiceUnavailable)
+			json.NewEncoder(ctx).Encode(map[string]string{"error": "采集已暂停"})
+		}
+		return false
+	}
+
+	// 启用上报签名时先校验签名，流式读取的请求体被整体读入内存，之后从PostBody读取
+	if h.signatures != nil {
+		agent := string(ctx.Request.Header.Peek(h.signatures.AgentHeader()))
+		err := h.signatures.Verify(agent,
+			string(ctx.Request.Header.Peek(ingest.TimestampHeader)),
+			string(ctx.Request.Header.Peek(ingest.NonceHeader)),
+			string(ctx.Request.Header.Peek(ingest.SignatureHeader)),
+			ingest.SignedRequest{
+				Method:   string(ctx.Method()),
+				Path:     string(ctx.URI().PathOriginal()),
+				RawQuery: string(ctx.URI().QueryString()),
+				Body:     ctx.PostBody(),
+			})
+		if err != nil {
+			trace.add("signature", map[string]interface{}{"agent": agent, "error": err.Error()})
+			ctx.SetStatusCode(signatureErrorStatus(err))
+			json.NewEncoder(ctx).Encode(map[string]string{"error": err.Error()})
+			return false
+		}
+	}
+	return true
+}
+
+// CollectBatch 批量上报，请求体为上报数据组成的JSON数组或NDJSON，按条解码并写入全局计数器
+// 服务器启用StreamRequestBody时请求体以流的方式读取
+func (h *FastHTTPHandler) CollectBatch(ctx *fasthttp.RequestCtx) {
+	trace := newDecisionTrace(debugTraceRequested(h.adminToken, string(ctx.Request.Header.Peek("Authorization")), string(ctx.Request.Header.Peek(DebugTraceHeader))), string(ctx.Path()))
+	defer func() { trace.finish(ctx.Response.StatusCode()) }()
+
+	accepted := h.gracefulShutdown.StartRequest()
+	trace.addShutdown(h.gracefulShutdown, accepted)
+	if !accepted {
+		ctx.SetStatusCode(http.StatusServiceUnavailable)
+		json.NewEncoder(ctx).Encode(map[string]string{"error": "服务正在关闭中"})
+		return
+	}
+	defer h.gracefulShutdown.EndRequest()
+
+	if !h.admitCollect(ctx, trace) {
+		return
+	}
+
+	cost, err := requestCost(h.rateLimiter, string(ctx.QueryArgs().Peek(CostParam)))
+	if err != nil {
+		ctx.SetStatusCode(http.StatusBadRequest)
+		json.NewEncoder(ctx).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	batch := batchCollector{
+		target:        h.counter,
+		dimensions:    h.dimensions(),
+		rateLimiter:   h.rateLimiter,
+		limiterPolicy: h.limiterPolicy,
+		decisions:     h.decisions,
+		request:       h.rateLimiter.Identify(string(ctx.Method()), string(ctx.Path()), requestHeader(ctx)),
+		cost:          cost,
+	}
+	batch.dimensions.source = h.reportSource(ctx)
+	batch.dimensions.tenant = h.reportTenant(ctx)
+	body := ctx.RequestBodyStream()
+	if body == nil {
+		// 服务器未启用StreamRequestBody时请求体已经读入内存
+		body = bytes.NewReader(ctx.PostBody())
+	}
+	status, result := batch.run(string(ctx.Request.Header.ContentType()), body)
+	trace.add("batch", result.traceDetail())
+	ctx.SetStatusCode(status)
+	json.NewEncoder(ctx).Encode(result)
+}
+
+func (h *FastHTTPHandler) collect(ctx *fasthttp.RequestCtx, target counter.Counter, dimensions collectDimensions) {
+	trace := newDecisionTrace(debugTraceRequested(h.adminToken, string(ctx.Request.Header.Peek("Authorization")), string(ctx.Request.Header.Peek(DebugTraceHeader))), string(ctx.Path()))
+	defer func() { trace.finish(ctx.Response.StatusCode()) }()
+
 	// 检查服务是否正在关闭中
-	if !h.gracefulShutdown.StartRequest() {
+	accepted := h.gracefulShutdown.StartRequest()
+	trace.addShutdown(h.gracefulShutdown, accepted)
+	if !accepted {
 		ctx.SetStatusCode(http.StatusServiceUnavailable)
 		json.NewEncoder(ctx).Encode(map[string]string{"error": "服务正在关闭中"})
 		return
@@ -32,56 +197,347 @@ func (h *FastHTTPHandler) Collect(ctx *fasthttp.RequestCtx) {
 	// 确保请求结束时调用EndRequest
 	defer h.gracefulShutdown.EndRequest()
 
-	// 检查是否被限流
-	if !h.rateLimiter.Allow() {
-		ctx.SetStatusCode(http.StatusTooManyRequests)
-		json.NewEncoder(ctx).Encode(map[string]string{"error": "请求被限流"})
+	if !h.admitCollect(ctx, trace) {
 		return
 	}
 
-	var req struct {
-		Count int64 `json:"count"`
+	// 检查是否被限流，请求可以通过cost参数声明消耗的令牌数；按字节限流时需要先解析出请求大小
+	limiterReq := h.rateLimiter.Identify(string(ctx.Method()), string(ctx.Path()), requestHeader(ctx))
+	byteLimited := h.rateLimiter.Unit() == limiter.UnitBytes
+	if !byteLimited {
+		cost, err := requestCost(h.rateLimiter, string(ctx.QueryArgs().Peek(CostParam)))
+		if err != nil {
+			ctx.SetStatusCode(http.StatusBadRequest)
+			json.NewEncoder(ctx).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		if !allowLimiter(h.rateLimiter, h.limiterPolicy, h.decisions, limiterReq, cost, trace) {
+			ctx.SetStatusCode(http.StatusTooManyRequests)
+			json.NewEncoder(ctx).Encode(map[string]string{"error": "请求被限流"})
+			return
+		}
 	}
 
-	if err := json.Unmarshal(ctx.PostBody(), &req); err != nil {
+	body := ctx.PostBody()
+	req, err := decodeCollectRequest(string(ctx.Request.Header.ContentType()), body)
+	if err != nil {
+		trace.add("decode", map[string]interface{}{"error": err.Error()})
 		ctx.SetStatusCode(http.StatusBadRequest)
 		json.NewEncoder(ctx).Encode(map[string]string{"error": err.Error()})
 		return
 	}
 
-	for i := int64(0); i < req.Count; i++ {
-		h.counter.Incr()
+	if byteLimited {
+		cost := req.ByteCost(len(body))
+		if !allowLimiter(h.rateLimiter, h.limiterPolicy, h.decisions, limiterReq, cost, trace) {
+			ctx.SetStatusCode(http.StatusTooManyRequests)
+			json.NewEncoder(ctx).Encode(map[string]string{"error": "请求被限流"})
+			return
+		}
+	}
+
+	amount := req.Amount(counter.UnitOf(target))
+	dimensions.source = h.reportSource(ctx)
+	dimensions.tenant = h.reportTenant(ctx)
+	if dimensions.duplicate(req, amount) {
+		trace.add("duplicate", map[string]interface{}{"source": dimensions.source, "key": req.Key})
+		ctx.SetStatusCode(http.StatusAccepted)
+		return
+	}
+	trace.addCounter(target, req, amount, dimensions)
+	if writeCount(target, req, amount) {
+		dimensions.add(req, amount)
 	}
 
 	ctx.SetStatusCode(http.StatusAccepted)
 }
 
+func (h *FastHTTPHandler) dimensions() collectDimensions {
+	return collectDimensions{tagged: h.taggedCounter, keyed: h.keyedCounter, latency: h.latency, latencySeries: h.latencySeries, weighted: h.weighted, duplicates: h.duplicates, tenants: h.tenants}
+}
+
+func (h *FastHTTPHandler) reportSource(ctx *fasthttp.RequestCtx) string {
+	if h.duplicates == nil {
+		return ""
+	}
+	if source := ctx.Request.Header.Peek(h.duplicates.SourceHeader()); len(source) > 0 {
+		return string(source)
+	}
+	return ctx.RemoteIP().String()
+}
+
+func (h *FastHTTPHandler) reportTenant(ctx *fasthttp.RequestCtx) string {
+	return collectTenant(h.tenants, h.adminToken, string(ctx.Request.Header.Peek("Authorization")), string(ctx.Request.Header.Peek(h.tenants.Header())))
+}
+
+// queryTenant 返回 /qps 和 /qps/history 查询的租户，租户令牌查询其他租户时返回403和false
+func (h *FastHTTPHandler) queryTenant(ctx *fasthttp.RequestCtx) (string, bool) {
+	scope, _ := ctx.UserValue(tenantScopeKey).(string)
+	tenant, err := queryTenant(h.tenants, scope, string(ctx.QueryArgs().Peek("tenant")))
+	if err != nil {
+		ctx.SetStatusCode(http.StatusForbidden)
+		json.NewEncoder(ctx).Encode(map[string]string{"error": err.Error()})
+		return "", false
+	}
+	return tenant, true
+}
+
 func (h *FastHTTPHandler) Query(ctx *fasthttp.RequestCtx) {
-	qps := h.counter.CurrentQPS()
+	tenant, ok := h.queryTenant(ctx)
+	if !ok {
+		return
+	}
+	if tenant != "" {
+		ctx.SetStatusCode(http.StatusOK)
+		json.NewEncoder(ctx).Encode(tenantQPSResponse(h.tenants, tenant))
+		return
+	}
+	if ctx.QueryArgs().Has("key") {
+		if h.keyedCounter == nil {
+			ctx.SetStatusCode(http.StatusServiceUnavailable)
+			json.NewEncoder(ctx).Encode(map[string]string{"error": errKeysDisabled.Error()})
+			return
+		}
+		ctx.SetStatusCode(http.StatusOK)
+		json.NewEncoder(ctx).Encode(keyQPSResponse(h.keyedCounter, string(ctx.QueryArgs().Peek("key"))))
+		return
+	}
 	ctx.SetStatusCode(http.StatusOK)
-	json.NewEncoder(ctx).Encode(map[string]interface{}{"qps": qps})
+	json.NewEncoder(ctx).Encode(legacyQPSResponse(h.counter))
+}
+
+func (h *FastHTTPHandler) QueryRate(ctx *fasthttp.RequestCtx) {
+	format, err := parseRateFormat(queryArg(ctx), h.rateFormat)
+	if err != nil {
+		ctx.SetStatusCode(http.StatusBadRequest)
+		json.NewEncoder(ctx).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	target, ok := resolveRateTarget(h.counter, h.registry, string(ctx.QueryArgs().Peek("counter")))
+	if !ok {
+		ctx.SetStatusCode(http.StatusNotFound)
+		json.NewEncoder(ctx).Encode(map[string]string{"error": counter.ErrCounterNotFound.Error()})
+		return
+	}
+	ctx.SetStatusCode(http.StatusOK)
+	json.NewEncoder(ctx).Encode(rateResponse(target, format))
+}
+
+func (h *FastHTTPHandler) QueryV1(ctx *fasthttp.RequestCtx) {
+	format, err := parseRateFormat(queryArg(ctx), h.rateFormat)
+	if err != nil {
+		ctx.SetStatusCode(http.StatusBadRequest)
+		json.NewEncoder(ctx).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	ctx.SetStatusCode(http.StatusOK)
+	json.NewEncoder(ctx).Encode(qpsResponse(h.counter, h.weighted, format))
+}
+
+// queryArg 返回读取查询参数的函数
+func queryArg(ctx *fasthttp.RequestCtx) func(key string) string {
+	return func(key string) string {
+		return string(ctx.QueryArgs().Peek(key))
+	}
+}
+
+func (h *FastHTTPHandler) QueryTrend(ctx *fasthttp.RequestCtx) {
+	if h.trendTracker == nil {
+		ctx.SetStatusCode(http.StatusServiceUnavailable)
+		json.NewEncoder(ctx).Encode(map[string]string{"error": "趋势跟踪未启用"})
+		return
+	}
+	ctx.SetStatusCode(http.StatusOK)
+	json.NewEncoder(ctx).Encode(h.trendTracker.Trend())
+}
+
+func (h *FastHTTPHandler) QueryHistory(ctx *fasthttp.RequestCtx) {
+	tenant, ok := h.queryTenant(ctx)
+	if !ok {
+		return
+	}
+	if tenant != "" {
+		status, resp := tenantHistoryResponse(h.tenants, tenant, string(ctx.QueryArgs().Peek("duration")))
+		ctx.SetStatusCode(status)
+		json.NewEncoder(ctx).Encode(resp)
+		return
+	}
+	if h.history == nil {
+		ctx.SetStatusCode(http.StatusServiceUnavailable)
+		json.NewEncoder(ctx).Encode(map[string]string{"error": errHistoryDisabled.Error()})
+		return
+	}
+	duration, err := parseHistoryDuration(string(ctx.QueryArgs().Peek("duration")), h.history.Retention())
+	if err != nil {
+		ctx.SetStatusCode(http.StatusBadRequest)
+		json.NewEncoder(ctx).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	ctx.SetStatusCode(http.StatusOK)
+	json.NewEncoder(ctx).Encode(historyResponse(h.history, duration))
+}
+
+func (h *FastHTTPHandler) ScalingAdvice(ctx *fasthttp.RequestCtx) {
+	if h.advisor == nil {
+		ctx.SetStatusCode(http.StatusServiceUnavailable)
+		json.NewEncoder(ctx).Encode(map[string]string{"error": "扩缩容建议未启用"})
+		return
+	}
+	replicas, err := parseReplicas(string(ctx.QueryArgs().Peek("replicas")))
+	if err != nil {
+		ctx.SetStatusCode(http.StatusBadRequest)
+		json.NewEncoder(ctx).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	ctx.SetStatusCode(http.StatusOK)
+	json.NewEncoder(ctx).Encode(h.advisor.Advice(replicas))
+}
+
+func (h *FastHTTPHandler) LatestReport(ctx *fasthttp.RequestCtx) {
+	if h.reporter == nil {
+		ctx.SetStatusCode(http.StatusServiceUnavailable)
+		json.NewEncoder(ctx).Encode(map[string]string{"error": "流量报告未启用"})
+		return
+	}
+	latest := h.reporter.Latest()
+	if latest == nil {
+		ctx.SetStatusCode(http.StatusNotFound)
+		json.NewEncoder(ctx).Encode(map[string]string{"error": "暂无报告"})
+		return
+	}
+	ctx.SetStatusCode(http.StatusOK)
+	json.NewEncoder(ctx).Encode(latest)
+}
+
+func (h *FastHTTPHandler) QueryTags(ctx *fasthttp.RequestCtx) {
+	if h.taggedCounter == nil {
+		ctx.SetStatusCode(http.StatusServiceUnavailable)
+		json.NewEncoder(ctx).Encode(map[string]string{"error": "标签计数未启用"})
+		return
+	}
+
+	p, err := parsePage(queryArg(ctx), SortQPS)
+	if err != nil {
+		ctx.SetStatusCode(http.StatusBadRequest)
+		json.NewEncoder(ctx).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	filter := make(map[string]string)
+	ctx.QueryArgs().VisitAll(func(key, value []byte) {
+		if _, ok := filter[string(key)]; !ok {
+			filter[string(key)] = string(value)
+		}
+	})
+
+	ctx.SetStatusCode(http.StatusOK)
+	json.NewEncoder(ctx).Encode(tagsResponse(h.taggedCounter, filter, p))
+}
+
+func (h *FastHTTPHandler) QueryLatency(ctx *fasthttp.RequestCtx) {
+	query := make(map[string]string)
+	ctx.QueryArgs().VisitAll(func(key, value []byte) {
+		if _, ok := query[string(key)]; !ok {
+			query[string(key)] = string(value)
+		}
+	})
+
+	code, resp := latencyResponse(h.latency, h.latencySeries, query)
+	ctx.SetStatusCode(code)
+	json.NewEncoder(ctx).Encode(resp)
+}
+
+func (h *FastHTTPHandler) QueryKeys(ctx *fasthttp.RequestCtx) {
+	if h.keyedCounter == nil {
+		ctx.SetStatusCode(http.StatusServiceUnavailable)
+		json.NewEncoder(ctx).Encode(map[string]string{"error": errKeysDisabled.Error()})
+		return
+	}
+	resp, err := queryKeys(h.keyedCounter, queryArg(ctx))
+	if err != nil {
+		ctx.SetStatusCode(http.StatusBadRequest)
+		json.NewEncoder(ctx).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	ctx.SetStatusCode(http.StatusOK)
+	json.NewEncoder(ctx).Encode(resp)
+}
+
+func (h *FastHTTPHandler) QueryClients(ctx *fasthttp.RequestCtx) {
+	if h.clientTracker == nil {
+		ctx.SetStatusCode(http.StatusServiceUnavailable)
+		json.NewEncoder(ctx).Encode(map[string]string{"error": "调用方统计未启用"})
+		return
+	}
+
+	top, err := parseTop(string(ctx.QueryArgs().Peek("top")))
+	if err != nil {
+		ctx.SetStatusCode(http.StatusBadRequest)
+		json.NewEncoder(ctx).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	ctx.SetStatusCode(http.StatusOK)
+	json.NewEncoder(ctx).Encode(clientsResponse(h.clientTracker, top))
+}
+
+func (h *FastHTTPHandler) ContractVersion(ctx *fasthttp.RequestCtx) {
+	ctx.SetStatusCode(http.StatusOK)
+	json.NewEncoder(ctx).Encode(contractVersionResponse())
+}
+
+func (h *FastHTTPHandler) ListWorkers(ctx *fasthttp.RequestCtx) {
+	ctx.SetStatusCode(http.StatusOK)
+	json.NewEncoder(ctx).Encode(map[string]interface{}{"workers": workers.List()})
+}
+
+func (h *FastHTTPHandler) Diagnostics(ctx *fasthttp.RequestCtx) {
+	ctx.SetStatusCode(http.StatusOK)
+	json.NewEncoder(ctx).Encode(map[string]interface{}{"duplicates": h.duplicates.GetStats(), "signing": h.signatures.GetStats()})
+}
+
+func (h *FastHTTPHandler) ShutdownStatus(ctx *fasthttp.RequestCtx) {
+	ctx.SetStatusCode(http.StatusOK)
+	json.NewEncoder(ctx).Encode(h.gracefulShutdown.Progress())
 }
 
 func (h *FastHTTPHandler) GetStats(ctx *fasthttp.RequestCtx) {
 	qps := h.counter.CurrentQPS()
-	limiterStats := h.rateLimiter.GetStats()
-	shutdownStatus := h.gracefulShutdown.Status()
-	shutdownActiveRequests := h.gracefulShutdown.ActiveRequests()
 
+	stats := map[string]interface{}{
+		"qps":      qps,
+		"counter":  h.counter.Stats(),
+		"limiter":  newLimiterStats(h.rateLimiter, h.limiterPolicy, h.decisions),
+		"shutdown": h.gracefulShutdown.Stats(),
+		"ingest":   h.ingestSwitch.GetStats(),
+		"pressure": pressure.Read(),
+		"late":     counter.LateEvents(),
+	}
+	if replicationStats := replicationStats(h.publisher, h.follower); replicationStats != nil {
+		stats["replication"] = replicationStats
+	}
+	if h.latency != nil {
+		stats["latency"] = h.latency.Stats()
+	}
+	if h.weighted != nil {
+		stats["weighted"] = h.weighted.Stats()
+	}
+	if verifier := counter.VerifierOf(h.counter); verifier != nil {
+		stats["verify"] = verifier.Stats()
+	}
+	if h.tenants != nil {
+		stats["tenants"] = h.tenants.GetStats()
+	}
 	ctx.SetStatusCode(http.StatusOK)
-	json.NewEncoder(ctx).Encode(map[string]interface{}{
-		"qps": qps,
-		"limiter": limiterStats,
-		"shutdown": map[string]interface{}{
-			"status":          shutdownStatus,
-			"active_requests": shutdownActiveRequests,
-		},
-	})
+	json.NewEncoder(ctx).Encode(stats)
+}
+
+func (h *FastHTTPHandler) GetStatsV2(ctx *fasthttp.RequestCtx) {
+	ctx.SetStatusCode(http.StatusOK)
+	json.NewEncoder(ctx).Encode(collectStats(h.counter, h.rateLimiter, h.sharding, h.gracefulShutdown))
 }
 
 func (h *FastHTTPHandler) SetLimiterRate(ctx *fasthttp.RequestCtx) {
 	var req struct {
-		Rate int64 `json:"rate"`
+		Rate config.Count `json:"rate"` // 整数或 "1.5k" 这样的字符串
 	}
 
 	if err := json.Unmarshal(ctx.PostBody(), &req); err != nil {
@@ -96,7 +552,7 @@ func (h *FastHTTPHandler) SetLimiterRate(ctx *fasthttp.RequestCtx) {
 		return
 	}
 
-	h.rateLimiter.SetRate(req.Rate)
+	h.rateLimiter.SetRate(int64(req.Rate))
 	ctx.SetStatusCode(http.StatusOK)
 	json.NewEncoder(ctx).Encode(map[string]interface{}{
 		"message":  "限流速率已更新",
@@ -123,7 +579,257 @@ func (h *FastHTTPHandler) ToggleLimiter(ctx *fasthttp.RequestCtx) {
 	})
 }
 
+func (h *FastHTTPHandler) LimiterRules(ctx *fasthttp.RequestCtx) {
+	ctx.SetStatusCode(http.StatusOK)
+	json.NewEncoder(ctx).Encode(map[string]interface{}{"rules": h.rateLimiter.Rules()})
+}
+
+func (h *FastHTTPHandler) SetLimiterRules(ctx *fasthttp.RequestCtx) {
+	rules, err := decodeLimiterRules(ctx.PostBody())
+	if err == nil {
+		err = h.rateLimiter.SetRules(rules)
+	}
+	if err != nil {
+		ctx.SetStatusCode(http.StatusBadRequest)
+		json.NewEncoder(ctx).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	ctx.SetStatusCode(http.StatusOK)
+	json.NewEncoder(ctx).Encode(map[string]interface{}{"message": "限流规则已更新", "rules": h.rateLimiter.Rules()})
+}
+
+// AdmitRead 关闭期间按查询请求的策略决定是否继续处理，拒绝时返回503和false
+func (h *FastHTTPHandler) AdmitRead(ctx *fasthttp.RequestCtx) bool {
+	if !h.gracefulShutdown.Accepts(counter.RequestRead) {
+		ctx.SetStatusCode(http.StatusServiceUnavailable)
+		json.NewEncoder(ctx).Encode(map[string]string{"error": "服务正在关闭中"})
+		return false
+	}
+	return true
+}
+
+// ScopeTenant 启用租户分区时校验查询请求的令牌，把租户令牌对应的租户保存在请求上下文中，拒绝时返回false
+func (h *FastHTTPHandler) ScopeTenant(ctx *fasthttp.RequestCtx) bool {
+	tenant, status, err := tenantScope(h.tenants, h.adminToken, string(ctx.Request.Header.Peek("Authorization")), string(ctx.Path()))
+	if err != nil {
+		ctx.SetStatusCode(status)
+		json.NewEncoder(ctx).Encode(map[string]string{"error": err.Error()})
+		return false
+	}
+	ctx.SetUserValue(tenantScopeKey, tenant)
+	return true
+}
+
+// RequireAdmin 校验管理员令牌，未通过认证时返回401和false
+// 限流器不可用且路由的失败策略为closed时返回503和false
+func (h *FastHTTPHandler) RequireAdmin(ctx *fasthttp.RequestCtx) bool {
+	if !adminAuthorized(h.adminToken, string(ctx.Request.Header.Peek("Authorization"))) {
+		ctx.SetStatusCode(http.StatusUnauthorized)
+		json.NewEncoder(ctx).Encode(map[string]string{"error": "需要管理员认证"})
+		return false
+	}
+	if !limiterAvailable(h.rateLimiter, h.limiterPolicy, string(ctx.Path())) {
+		ctx.SetStatusCode(http.StatusServiceUnavailable)
+		json.NewEncoder(ctx).Encode(map[string]string{"error": "限流器不可用"})
+		return false
+	}
+	return true
+}
+
+// AdminBatch 原子地执行一组管理操作，返回每一项的结果
+func (h *FastHTTPHandler) AdminBatch(ctx *fasthttp.RequestCtx) {
+	ops, err := decodeBatchRequest(ctx.PostBody())
+	if err != nil {
+		ctx.SetStatusCode(http.StatusBadRequest)
+		json.NewEncoder(ctx).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	batch := adminBatch{rateLimiter: h.rateLimiter, ingestSwitch: h.ingestSwitch, registry: h.registry}
+	status, resp := batch.run(ops)
+	ctx.SetStatusCode(status)
+	json.NewEncoder(ctx).Encode(resp)
+}
+
+func (h *FastHTTPHandler) ApplyConfig(ctx *fasthttp.RequestCtx) {
+	dryRun, err := parseDryRun(string(ctx.QueryArgs().Peek("dry_run")))
+	if err != nil {
+		ctx.SetStatusCode(http.StatusBadRequest)
+		json.NewEncoder(ctx).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	doc, err := decodeDeclaredConfig(ctx.PostBody())
+	if err != nil {
+		ctx.SetStatusCode(http.StatusBadRequest)
+		json.NewEncoder(ctx).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	apply := declarativeApply{rateLimiter: h.rateLimiter, registry: h.registry}
+	status, resp := apply.run(doc, dryRun)
+	ctx.SetStatusCode(status)
+	json.NewEncoder(ctx).Encode(resp)
+}
+
+// ReplicationStream 以NDJSON持续推送计数增量，供query角色的只读副本订阅
+func (h *FastHTTPHandler) ReplicationStream(ctx *fasthttp.RequestCtx) {
+	epoch, after, err := replicationCursor(string(ctx.QueryArgs().Peek("epoch")), string(ctx.QueryArgs().Peek("after")))
+	if err != nil {
+		ctx.SetStatusCode(http.StatusBadRequest)
+		json.NewEncoder(ctx).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	deltas, cancel := h.publisher.Subscribe(epoch, after)
+	conn := ctx.Conn()
+	ctx.SetStatusCode(http.StatusOK)
+	ctx.SetContentType(replication.ContentType)
+	ctx.SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer cancel()
+		// 增量流是长连接，不受服务器写超时限制
+		conn.SetWriteDeadline(time.Time{})
+
+		encoder := json.NewEncoder(w)
+		for d := range deltas {
+			if err := encoder.Encode(d); err != nil {
+				return
+			}
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	})
+}
+
+func (h *FastHTTPHandler) PauseIngest(ctx *fasthttp.RequestCtx) {
+	h.ingestSwitch.Pause()
+	ctx.SetStatusCode(http.StatusOK)
+	json.NewEncoder(ctx).Encode(map[string]interface{}{
+		"message": "采集已暂停",
+		"ingest":  h.ingestSwitch.GetStats(),
+	})
+}
+
+func (h *FastHTTPHandler) ResumeIngest(ctx *fasthttp.RequestCtx) {
+	h.ingestSwitch.Resume()
+	ctx.SetStatusCode(http.StatusOK)
+	json.NewEncoder(ctx).Encode(map[string]interface{}{
+		"message": "采集已恢复",
+		"ingest":  h.ingestSwitch.GetStats(),
+	})
+}
+
+func (h *FastHTTPHandler) StartLoadGen(ctx *fasthttp.RequestCtx) {
+	var req loadgen.Request
+	if err := json.Unmarshal(ctx.PostBody(), &req); err != nil {
+		ctx.SetStatusCode(http.StatusBadRequest)
+		json.NewEncoder(ctx).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	status, resp := startLoadGen(h.loadGenerator, req)
+	ctx.SetStatusCode(status)
+	json.NewEncoder(ctx).Encode(resp)
+}
+
+func (h *FastHTTPHandler) LoadGenStatus(ctx *fasthttp.RequestCtx) {
+	ctx.SetStatusCode(http.StatusOK)
+	json.NewEncoder(ctx).Encode(map[string]interface{}{"loadgen": h.loadGenerator.Status()})
+}
+
+func (h *FastHTTPHandler) StopLoadGen(ctx *fasthttp.RequestCtx) {
+	ctx.SetStatusCode(http.StatusOK)
+	json.NewEncoder(ctx).Encode(map[string]interface{}{
+		"message": "压测已停止",
+		"loadgen": h.loadGenerator.Cancel(),
+	})
+}
+
 func (h *FastHTTPHandler) HealthCheck(ctx *fasthttp.RequestCtx) {
+	report := h.health.Check()
+	ctx.SetStatusCode(report.StatusCode())
+	json.NewEncoder(ctx).Encode(report)
+}
+
+func (h *FastHTTPHandler) ListCounters(ctx *fasthttp.RequestCtx) {
+	p, err := parsePage(queryArg(ctx), SortName)
+	if err != nil {
+		ctx.SetStatusCode(http.StatusBadRequest)
+		json.NewEncoder(ctx).Encode(map[string]string{"error": err.Error()})
+		return
+	}
 	ctx.SetStatusCode(http.StatusOK)
-	ctx.SetBodyString("ok")
-}
\ No newline at end of file
+	json.NewEncoder(ctx).Encode(countersResponse(h.registry, p))
+}
+
+func (h *FastHTTPHandler) CreateCounter(ctx *fasthttp.RequestCtx) {
+	var spec counter.CounterSpec
+	if err := json.Unmarshal(ctx.PostBody(), &spec); err != nil {
+		ctx.SetStatusCode(http.StatusBadRequest)
+		json.NewEncoder(ctx).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	info, err := h.registry.Create(spec)
+	if err != nil {
+		ctx.SetStatusCode(registryErrorStatus(err))
+		json.NewEncoder(ctx).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	ctx.SetStatusCode(http.StatusCreated)
+	json.NewEncoder(ctx).Encode(info)
+}
+
+func (h *FastHTTPHandler) GetCounter(ctx *fasthttp.RequestCtx, name string) {
+	info, ok := h.registry.Info(name)
+	if !ok {
+		ctx.SetStatusCode(http.StatusNotFound)
+		json.NewEncoder(ctx).Encode(map[string]string{"error": counter.ErrCounterNotFound.Error()})
+		return
+	}
+	ctx.SetStatusCode(http.StatusOK)
+	json.NewEncoder(ctx).Encode(info)
+}
+
+func (h *FastHTTPHandler) DeleteCounter(ctx *fasthttp.RequestCtx, name string) {
+	if err := h.registry.Delete(name); err != nil {
+		ctx.SetStatusCode(registryErrorStatus(err))
+		json.NewEncoder(ctx).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	ctx.SetStatusCode(http.StatusOK)
+	json.NewEncoder(ctx).Encode(deleteCounterResponse(h.registry, name))
+}
+
+func (h *FastHTTPHandler) RestoreCounter(ctx *fasthttp.RequestCtx, name string) {
+	info, err := h.registry.Undelete(name)
+	if err != nil {
+		ctx.SetStatusCode(registryErrorStatus(err))
+		json.NewEncoder(ctx).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	ctx.SetStatusCode(http.StatusOK)
+	json.NewEncoder(ctx).Encode(info)
+}
+
+func (h *FastHTTPHandler) ResetCounter(ctx *fasthttp.RequestCtx) {
+	status, resp := resetCounter(h.counter, h.registry, string(ctx.QueryArgs().Peek("name")))
+	ctx.SetStatusCode(status)
+	json.NewEncoder(ctx).Encode(resp)
+}
+
+func (h *FastHTTPHandler) CollectNamed(ctx *fasthttp.RequestCtx, name string) {
+	target, err := h.registry.Writable(name)
+	if err != nil {
+		ctx.SetStatusCode(registryErrorStatus(err))
+		json.NewEncoder(ctx).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	h.collect(ctx, target, collectDimensions{})
+}
+
+// requestHeader 返回读取请求头的函数
+func requestHeader(ctx *fasthttp.RequestCtx) func(string) string {
+	return func(name string) string {
+		return string(ctx.Request.Header.Peek(name))
+	}
+}
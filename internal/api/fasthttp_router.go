@@ -1,46 +1,245 @@
 package api
 
 import (
-	"github.com/mant7s/qps-counter/internal/counter"
-	"github.com/mant7s/qps-counter/internal/limiter"
-	"github.com/mant7s/qps-counter/internal/metrics"
+	"strings"
+
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/valyala/fasthttp"
 	"github.com/valyala/fasthttp/fasthttpadaptor"
 )
 
 type FastHTTPRouter struct {
-	handler *FastHTTPHandler
+	handler         *FastHTTPHandler
+	namedCounters   bool
+	ingestAdmin     bool
+	loadgen         bool   // 是否提供内置压测接口
+	ingest          bool   // 是否提供上报接口
+	query           bool   // 是否提供查询和历史接口
+	replication     bool   // 是否提供增量流
+	cacheControl    string // /qps、/stats 和 /qps/history 响应的Cache-Control
+	metricsEndpoint string
+	metricsHandler  fasthttp.RequestHandler
+	middleware      []FastHTTPMiddleware
+}
+
+// NewFastHTTPRouter 根据选项创建fasthttp路由器
+func NewFastHTTPRouter(opts RouterOptions) *FastHTTPRouter {
+	r := &FastHTTPRouter{
+		handler:       NewFastHTTPHandler(opts),
+		namedCounters: opts.Registry != nil,
+		ingestAdmin:   opts.IngestSwitch != nil,
+		loadgen:       opts.LoadGenerator != nil,
+		ingest:        opts.servesIngest(),
+		query:         opts.servesQuery(),
+		replication:   opts.servesReplication(),
+		middleware:    opts.FastHTTPMiddleware,
+		cacheControl:  opts.cacheControl(),
+	}
+	if endpoint := opts.metricsEndpoint(); endpoint != "" {
+		r.metricsEndpoint = endpoint
+		// 使用适配器将promhttp处理器转换为fasthttp处理器
+		r.metricsHandler = fasthttpadaptor.NewFastHTTPHandler(promhttp.HandlerFor(opts.Metrics.Registry(), promhttp.HandlerOpts{}))
+	}
+	return r
 }
 
-func NewFastHTTPRouter(counter counter.Counter, gracefulShutdown *counter.EnhancedGracefulShutdown, rateLimiter *limiter.RateLimiter, metricsCollector *metrics.Metrics, metricsEndpoint string, metricsEnabled bool) *FastHTTPRouter {
-	handler := NewFastHTTPHandler(counter, gracefulShutdown, rateLimiter)
-	return &FastHTTPRouter{handler: handler}
+// wrap 按注册顺序应用中间件，第一个中间件位于最外层，panic恢复位于所有中间件之外
+func (r *FastHTTPRouter) wrap(handler fasthttp.RequestHandler) fasthttp.RequestHandler {
+	for i := len(r.middleware) - 1; i >= 0; i-- {
+		handler = r.middleware[i](handler)
+	}
+	return recoverFastHTTP(handler)
 }
 
 func (r *FastHTTPRouter) Handler() fasthttp.RequestHandler {
-	return func(ctx *fasthttp.RequestCtx) {
+	return r.wrap(func(ctx *fasthttp.RequestCtx) {
 		path := string(ctx.Path())
 		method := string(ctx.Method())
 
+		// 查询和统计接口，关闭期间按shutdown.policy.read决定是否继续处理，启用租户分区时按令牌限定可见的数据
+		if r.readPath(method, path) && (!r.handler.AdmitRead(ctx) || !r.handler.ScopeTenant(ctx)) {
+			return
+		}
+
 		switch {
-		case method == "POST" && path == "/collect":
+		case r.ingest && method == "POST" && path == "/collect":
 			r.handler.Collect(ctx)
-		case method == "GET" && path == "/qps":
-			r.handler.Query(ctx)
+		case r.ingest && method == "POST" && path == "/collect/batch":
+			r.handler.CollectBatch(ctx)
+		case r.query && method == "GET" && path == "/qps":
+			cacheFastHTTP(r.cacheControl, r.handler.Query)(ctx)
+		case r.query && method == "GET" && path == "/v1/qps":
+			r.handler.QueryV1(ctx)
+		case r.query && method == "GET" && path == "/rate":
+			r.handler.QueryRate(ctx)
+		case r.query && method == "GET" && path == "/qps/trend":
+			r.handler.QueryTrend(ctx)
+		case r.query && method == "GET" && path == "/qps/history":
+			cacheFastHTTP(r.cacheControl, r.handler.QueryHistory)(ctx)
+		case r.query && method == "GET" && path == "/qps/tags":
+			r.handler.QueryTags(ctx)
+		case r.query && method == "GET" && path == "/qps/keys":
+			r.handler.QueryKeys(ctx)
+		case r.query && method == "GET" && path == "/latency":
+			r.handler.QueryLatency(ctx)
+		case r.query && method == "GET" && path == "/clients":
+			r.handler.QueryClients(ctx)
+		case r.query && method == "GET" && path == "/scaling/advice":
+			r.handler.ScalingAdvice(ctx)
+		case r.query && method == "GET" && path == "/reports/latest":
+			r.handler.LatestReport(ctx)
 		case method == "GET" && path == "/stats":
-			r.handler.GetStats(ctx)
+			cacheFastHTTP(r.cacheControl, r.handler.GetStats)(ctx)
+		case method == "GET" && path == "/stats/v2":
+			cacheFastHTTP(r.cacheControl, r.handler.GetStatsV2)(ctx)
+		case method == "GET" && path == "/contract-version":
+			r.handler.ContractVersion(ctx)
+		case method == "GET" && path == "/debug/workers":
+			r.handler.ListWorkers(ctx)
+		case method == "GET" && path == "/diagnostics":
+			r.handler.Diagnostics(ctx)
+		case method == "GET" && path == "/shutdown/status":
+			r.handler.ShutdownStatus(ctx)
 		case method == "POST" && path == "/limiter/rate":
 			r.handler.SetLimiterRate(ctx)
 		case method == "POST" && path == "/limiter/toggle":
 			r.handler.ToggleLimiter(ctx)
 		case method == "GET" && path == "/healthz":
 			r.handler.HealthCheck(ctx)
-		case method == "GET" && path == "/metrics":
-			// 使用适配器将promhttp.Handler转换为fasthttp处理器
-			fasthttpadaptor.NewFastHTTPHandler(promhttp.Handler())(ctx)
+		case r.metricsHandler != nil && method == "GET" && path == r.metricsEndpoint:
+			r.metricsHandler(ctx)
+		case method == "POST" && path == "/counters/reset":
+			if r.handler.RequireAdmin(ctx) {
+				r.handler.ResetCounter(ctx)
+			}
+		case r.namedCounters && path == "/counters":
+			r.routeCounters(ctx, method)
+		case r.namedCounters && strings.HasPrefix(path, "/counters/"):
+			r.routeNamedCounter(ctx, method, strings.TrimPrefix(path, "/counters/"))
+		case strings.HasPrefix(path, "/admin/"):
+			r.routeAdmin(ctx, method, strings.TrimPrefix(path, "/admin/"))
 		default:
 			ctx.SetStatusCode(fasthttp.StatusNotFound)
 		}
+	})
+}
+
+// readPath 返回请求是否属于查询和统计接口
+func (r *FastHTTPRouter) readPath(method, path string) bool {
+	if method != "GET" {
+		return false
+	}
+	switch path {
+	case "/stats", "/stats/v2":
+		return true
+	case "/qps", "/v1/qps", "/rate", "/qps/trend", "/qps/history", "/qps/tags", "/qps/keys", "/latency", "/clients", "/scaling/advice", "/reports/latest":
+		return r.query
 	}
-}
\ No newline at end of file
+	if path == "/counters" || (strings.HasPrefix(path, "/counters/") && !strings.Contains(strings.TrimPrefix(path, "/counters/"), "/")) {
+		return r.query && r.namedCounters
+	}
+	return false
+}
+
+// CollectHandler 只处理上报和健康检查的请求处理器
+// 与Gin同时运行时，fasthttp只承担 /collect 等上报热路径，管理和查询接口由Gin提供
+func (r *FastHTTPRouter) CollectHandler() fasthttp.RequestHandler {
+	return r.wrap(func(ctx *fasthttp.RequestCtx) {
+		path := string(ctx.Path())
+		method := string(ctx.Method())
+
+		switch {
+		case r.ingest && method == "POST" && path == "/collect":
+			r.handler.Collect(ctx)
+		case r.ingest && method == "POST" && path == "/collect/batch":
+			r.handler.CollectBatch(ctx)
+		case method == "GET" && path == "/healthz":
+			r.handler.HealthCheck(ctx)
+		case r.ingest && r.namedCounters && method == "POST" && strings.HasPrefix(path, "/counters/"):
+			name, ok := strings.CutSuffix(strings.TrimPrefix(path, "/counters/"), "/collect")
+			if !ok || name == "" || strings.Contains(name, "/") {
+				ctx.SetStatusCode(fasthttp.StatusNotFound)
+				return
+			}
+			r.handler.CollectNamed(ctx, name)
+		default:
+			ctx.SetStatusCode(fasthttp.StatusNotFound)
+		}
+	})
+}
+
+// routeAdmin 处理 /admin/batch、/admin/config、/admin/ingest/pause、/admin/ingest/resume 和 /admin/loadgen
+func (r *FastHTTPRouter) routeAdmin(ctx *fasthttp.RequestCtx, method, action string) {
+	var handle fasthttp.RequestHandler
+	switch {
+	case r.replication && method == "GET" && action == "replication/stream":
+		handle = r.handler.ReplicationStream
+	case method == "PUT" && action == "config":
+		handle = r.handler.ApplyConfig
+	case method == "GET" && action == "limiter/rules":
+		handle = r.handler.LimiterRules
+	case method == "PUT" && action == "limiter/rules":
+		handle = r.handler.SetLimiterRules
+	case r.loadgen && method == "GET" && action == "loadgen":
+		handle = r.handler.LoadGenStatus
+	case r.loadgen && method == "DELETE" && action == "loadgen":
+		handle = r.handler.StopLoadGen
+	case method != "POST":
+	case action == "batch":
+		handle = r.handler.AdminBatch
+	case r.ingestAdmin && action == "ingest/pause":
+		handle = r.handler.PauseIngest
+	case r.ingestAdmin && action == "ingest/resume":
+		handle = r.handler.ResumeIngest
+	case r.loadgen && action == "loadgen":
+		handle = r.handler.StartLoadGen
+	}
+	if handle == nil {
+		ctx.SetStatusCode(fasthttp.StatusNotFound)
+		return
+	}
+	if !r.handler.RequireAdmin(ctx) {
+		return
+	}
+	handle(ctx)
+}
+
+// routeCounters 处理 /counters，创建计数器需要管理员令牌
+func (r *FastHTTPRouter) routeCounters(ctx *fasthttp.RequestCtx, method string) {
+	switch {
+	case r.query && method == "GET":
+		r.handler.ListCounters(ctx)
+	case method == "POST":
+		if r.handler.RequireAdmin(ctx) {
+			r.handler.CreateCounter(ctx)
+		}
+	default:
+		ctx.SetStatusCode(fasthttp.StatusNotFound)
+	}
+}
+
+// routeNamedCounter 处理 /counters/{name}、/counters/{name}/collect 和 /counters/{name}/restore，删除和恢复需要管理员令牌
+func (r *FastHTTPRouter) routeNamedCounter(ctx *fasthttp.RequestCtx, method, rest string) {
+	name, action, _ := strings.Cut(rest, "/")
+	if name == "" {
+		ctx.SetStatusCode(fasthttp.StatusNotFound)
+		return
+	}
+
+	switch {
+	case r.query && action == "" && method == "GET":
+		r.handler.GetCounter(ctx, name)
+	case action == "" && method == "DELETE":
+		if r.handler.RequireAdmin(ctx) {
+			r.handler.DeleteCounter(ctx, name)
+		}
+	case action == "restore" && method == "POST":
+		if r.handler.RequireAdmin(ctx) {
+			r.handler.RestoreCounter(ctx, name)
+		}
+	case r.ingest && action == "collect" && method == "POST":
+		r.handler.CollectNamed(ctx, name)
+	default:
+		ctx.SetStatusCode(fasthttp.StatusNotFound)
+	}
+}
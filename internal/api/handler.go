@@ -1,101 +1,503 @@
 package api
 
 import (
+	"bytes"
+	"encoding/json"
 	"github.com/gin-gonic/gin"
+	"github.com/mant7s/qps-counter/internal/analytics"
+	"github.com/mant7s/qps-counter/internal/config"
 	"github.com/mant7s/qps-counter/internal/counter"
+	"github.com/mant7s/qps-counter/internal/health"
+	"github.com/mant7s/qps-counter/internal/ingest"
 	"github.com/mant7s/qps-counter/internal/limiter"
+	"github.com/mant7s/qps-counter/internal/loadgen"
+	"github.com/mant7s/qps-counter/internal/pressure"
+	"github.com/mant7s/qps-counter/internal/replication"
+	"github.com/mant7s/qps-counter/internal/report"
+	"github.com/mant7s/qps-counter/internal/scaling"
+	"github.com/mant7s/qps-counter/internal/workers"
+	"io"
 	"net/http"
+	"time"
 )
 
 type QPSHandler struct {
-	counter         counter.Counter
-	gracefulShutdown *counter.EnhancedGracefulShutdown
-	rateLimiter      *limiter.RateLimiter
+	counter          counter.Counter
+	gracefulShutdown ShutdownTracker
+	rateLimiter      Limiter
+	limiterPolicy    *limiter.FailurePolicy
+	decisions        *analytics.DecisionLog
+	sharding         *counter.EnhancedAdaptiveShardingManager
+	trendTracker     *counter.TrendTracker
+	history          *counter.History
+	taggedCounter    *counter.TaggedCounter
+	keyedCounter     *counter.KeyedCounter
+	clientTracker    *counter.ClientTracker
+	latency          *counter.LatencyHistogram
+	latencySeries    *counter.LatencySeries
+	weighted         *counter.WeightedWindow
+	registry         *counter.Registry
+	ingestSwitch     *ingest.Switch
+	duplicates       *ingest.DuplicateDetector
+	signatures       *ingest.SignatureVerifier
+	tenants          *counter.TenantStore
+	publisher        *replication.Publisher
+	follower         *replication.Follower
+	advisor          *scaling.Advisor
+	reporter         *report.Reporter
+	loadGenerator    *loadgen.Generator
+	health           *health.Registry
+	adminToken       string
+	rateFormat       rateFormat // 速率默认保留的小数位数和时间单位
 }
 
-func NewHandler(c counter.Counter, gs *counter.EnhancedGracefulShutdown, rl *limiter.RateLimiter) *QPSHandler {
+func NewHandler(opts RouterOptions) *QPSHandler {
 	return &QPSHandler{
-		counter:         c,
-		gracefulShutdown: gs,
-		rateLimiter:      rl,
+		counter:          opts.Counter,
+		gracefulShutdown: opts.GracefulShutdown,
+		rateLimiter:      opts.RateLimiter,
+		limiterPolicy:    opts.FailurePolicy,
+		decisions:        opts.DecisionLog,
+		sharding:         opts.Sharding,
+		trendTracker:     opts.TrendTracker,
+		history:          opts.History,
+		taggedCounter:    opts.TaggedCounter,
+		keyedCounter:     opts.KeyedCounter,
+		clientTracker:    opts.ClientTracker,
+		latency:          opts.Latency,
+		latencySeries:    opts.LatencySeries,
+		weighted:         opts.Weighted,
+		registry:         opts.Registry,
+		ingestSwitch:     opts.IngestSwitch,
+		duplicates:       opts.Duplicates,
+		signatures:       opts.Signatures,
+		tenants:          opts.Tenants,
+		publisher:        opts.Publisher,
+		follower:         opts.Follower,
+		advisor:          opts.Advisor,
+		reporter:         opts.Reporter,
+		loadGenerator:    opts.LoadGenerator,
+		health:           opts.Health,
+		adminToken:       opts.AdminToken,
+		rateFormat:       opts.rateFormat(),
 	}
 }
 
 func (handler *QPSHandler) Collect(c *gin.Context) {
+	handler.collect(c, handler.counter, handler.dimensions())
+}
+
+// admitCollect 统计调用方并检查采集是否暂停，返回false时已写入响应
+func (handler *QPSHandler) admitCollect(c *gin.Context, trace *decisionTrace) bool {
+	// 统计调用方，被暂停或限流的请求同样计入，便于定位流量突增的来源
+	handler.clientTracker.RecordWith(func(apiKeyHeader string) counter.ClientIdentity {
+		return counter.ClientIdentity{
+			UserAgent: c.Request.UserAgent(),
+			APIKey:    c.GetHeader(apiKeyHeader),
+			IP:        c.RemoteIP(),
+		}
+	}, 1)
+
+	// 采集暂停期间不再计入新事件
+	if handler.ingestSwitch.Paused() {
+		handler.ingestSwitch.Drop()
+		trace.add("pause", map[string]interface{}{"mode": handler.ingestSwitch.Mode()})
+		if handler.ingestSwitch.Mode() == ingest.PauseDrop {
+			c.Status(http.StatusAccepted)
+		} else {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "采集已暂停"})
+		}
+		return false
+	}
+
+	// 启用上报签名时先校验签名，请求体读入内存后放回，后续照常读取
+	if handler.signatures != nil {
+		body, err := c.GetRawData()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return false
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		agent := c.GetHeader(handler.signatures.AgentHeader())
+		signed := ingest.SignedRequest{Method: c.Request.Method, Path: c.Request.URL.EscapedPath(), RawQuery: c.Request.URL.RawQuery, Body: body}
+		if err := handler.signatures.Verify(agent, c.GetHeader(ingest.TimestampHeader), c.GetHeader(ingest.NonceHeader), c.GetHeader(ingest.SignatureHeader), signed); err != nil {
+			trace.add("signature", map[string]interface{}{"agent": agent, "error": err.Error()})
+			c.JSON(signatureErrorStatus(err), gin.H{"error": err.Error()})
+			return false
+		}
+	}
+	return true
+}
+
+// CollectBatch 批量上报，请求体为上报数据组成的JSON数组或NDJSON，按条解码并写入全局计数器
+func (handler *QPSHandler) CollectBatch(c *gin.Context) {
+	trace := newDecisionTrace(debugTraceRequested(handler.adminToken, c.GetHeader("Authorization"), c.GetHeader(DebugTraceHeader)), c.Request.URL.Path)
+	defer func() { trace.finish(c.Writer.Status()) }()
+
+	accepted := handler.gracefulShutdown.StartRequest()
+	trace.addShutdown(handler.gracefulShutdown, accepted)
+	if !accepted {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "服务正在关闭中"})
+		return
+	}
+	defer handler.gracefulShutdown.EndRequest()
+
+	if !handler.admitCollect(c, trace) {
+		return
+	}
+
+	cost, err := requestCost(handler.rateLimiter, c.Query(CostParam))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	batch := batchCollector{
+		target:        handler.counter,
+		dimensions:    handler.dimensions(),
+		rateLimiter:   handler.rateLimiter,
+		limiterPolicy: handler.limiterPolicy,
+		decisions:     handler.decisions,
+		request:       handler.rateLimiter.Identify(c.Request.Method, c.Request.URL.Path, c.GetHeader),
+		cost:          cost,
+	}
+	batch.dimensions.source = handler.reportSource(c)
+	batch.dimensions.tenant = collectTenant(handler.tenants, handler.adminToken, c.GetHeader("Authorization"), c.GetHeader(handler.tenants.Header()))
+	status, result := batch.run(c.ContentType(), c.Request.Body)
+	trace.add("batch", result.traceDetail())
+	c.JSON(status, result)
+}
+
+// collect 将上报的计数写入目标计数器，同时按dimensions中的标签组合和key计数
+func (handler *QPSHandler) collect(c *gin.Context, target counter.Counter, dimensions collectDimensions) {
+	trace := newDecisionTrace(debugTraceRequested(handler.adminToken, c.GetHeader("Authorization"), c.GetHeader(DebugTraceHeader)), c.Request.URL.Path)
+	defer func() { trace.finish(c.Writer.Status()) }()
+
 	// 检查服务是否正在关闭中
-	if !handler.gracefulShutdown.StartRequest() {
+	accepted := handler.gracefulShutdown.StartRequest()
+	trace.addShutdown(handler.gracefulShutdown, accepted)
+	if !accepted {
 		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "服务正在关闭中"})
 		return
 	}
 	// 确保请求结束时调用EndRequest
 	defer handler.gracefulShutdown.EndRequest()
-	
-	// 检查是否被限流
-	if !handler.rateLimiter.Allow() {
-		c.JSON(http.StatusTooManyRequests, gin.H{"error": "请求被限流"})
+
+	if !handler.admitCollect(c, trace) {
 		return
 	}
-	
-	var req struct {
-		Count int64 `json:"count"`
+
+	// 检查是否被限流，请求可以通过cost参数声明消耗的令牌数；按字节限流时需要先解析出请求大小
+	limiterReq := handler.rateLimiter.Identify(c.Request.Method, c.Request.URL.Path, c.GetHeader)
+	byteLimited := handler.rateLimiter.Unit() == limiter.UnitBytes
+	if !byteLimited {
+		cost, err := requestCost(handler.rateLimiter, c.Query(CostParam))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !allowLimiter(handler.rateLimiter, handler.limiterPolicy, handler.decisions, limiterReq, cost, trace) {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "请求被限流"})
+			return
+		}
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
+	body, err := c.GetRawData()
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	for i := int64(0); i < req.Count; i++ {
-		handler.counter.Incr()
+	req, err := decodeCollectRequest(c.ContentType(), body)
+	if err != nil {
+		trace.add("decode", map[string]interface{}{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if byteLimited {
+		cost := req.ByteCost(len(body))
+		if !allowLimiter(handler.rateLimiter, handler.limiterPolicy, handler.decisions, limiterReq, cost, trace) {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "请求被限流"})
+			return
+		}
+	}
+
+	amount := req.Amount(counter.UnitOf(target))
+	dimensions.source = handler.reportSource(c)
+	dimensions.tenant = collectTenant(handler.tenants, handler.adminToken, c.GetHeader("Authorization"), c.GetHeader(handler.tenants.Header()))
+	if dimensions.duplicate(req, amount) {
+		trace.add("duplicate", map[string]interface{}{"source": dimensions.source, "key": req.Key})
+		c.Status(http.StatusAccepted)
+		return
+	}
+	trace.addCounter(target, req, amount, dimensions)
+	if writeCount(target, req, amount) {
+		dimensions.add(req, amount)
 	}
 
 	c.Status(http.StatusAccepted)
 }
 
+// dimensions 返回写入全局计数器时同时计数的标签组合和key计数器、延迟直方图、重复上报检测以及租户分区
+func (handler *QPSHandler) dimensions() collectDimensions {
+	return collectDimensions{tagged: handler.taggedCounter, keyed: handler.keyedCounter, latency: handler.latency, latencySeries: handler.latencySeries, weighted: handler.weighted, duplicates: handler.duplicates, tenants: handler.tenants}
+}
+
+// reportSource 返回重复上报检测使用的上报来源，优先使用source_header请求头，未携带时使用来源IP
+func (handler *QPSHandler) reportSource(c *gin.Context) string {
+	if handler.duplicates == nil {
+		return ""
+	}
+	if source := c.GetHeader(handler.duplicates.SourceHeader()); source != "" {
+		return source
+	}
+	return c.RemoteIP()
+}
+
+// Query 获取当前QPS及各附加窗口的QPS，key参数指定按key计数的QPS，tenant参数或租户令牌指定租户的QPS
 func (handler *QPSHandler) Query(c *gin.Context) {
-	qps := handler.counter.CurrentQPS()
-	c.JSON(http.StatusOK, gin.H{"qps": qps})
+	tenant, err := queryTenant(handler.tenants, c.GetString(tenantScopeKey), c.Query("tenant"))
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if tenant != "" {
+		c.JSON(http.StatusOK, tenantQPSResponse(handler.tenants, tenant))
+		return
+	}
+	if key, ok := c.GetQuery("key"); ok {
+		if handler.keyedCounter == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": errKeysDisabled.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, keyQPSResponse(handler.keyedCounter, key))
+		return
+	}
+	c.JSON(http.StatusOK, legacyQPSResponse(handler.counter))
+}
+
+// QueryKeys 获取QPS最高的key，top参数指定返回数量
+func (handler *QPSHandler) QueryKeys(c *gin.Context) {
+	if handler.keyedCounter == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": errKeysDisabled.Error()})
+		return
+	}
+	resp, err := queryKeys(handler.keyedCounter, c.Query)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// QueryRate 获取带计数单位的速率，counter参数指定命名计数器
+func (handler *QPSHandler) QueryRate(c *gin.Context) {
+	format, err := parseRateFormat(c.Query, handler.rateFormat)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	target, ok := resolveRateTarget(handler.counter, handler.registry, c.Query("counter"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": counter.ErrCounterNotFound.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, rateResponse(target, format))
+}
+
+// QueryV1 获取小数形式的QPS，precision参数指定小数位数，unit参数指定时间单位，format=human时附加格式化后的速率
+func (handler *QPSHandler) QueryV1(c *gin.Context) {
+	format, err := parseRateFormat(c.Query, handler.rateFormat)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, qpsResponse(handler.counter, handler.weighted, format))
+}
+
+// QueryTrend 获取平滑后的QPS及其变化率
+func (handler *QPSHandler) QueryTrend(c *gin.Context) {
+	if handler.trendTracker == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "趋势跟踪未启用"})
+		return
+	}
+	c.JSON(http.StatusOK, handler.trendTracker.Trend())
+}
+
+// QueryHistory 获取最近一段时间每秒的QPS采样，duration参数指定时长，默认为全部保留的采样
+// tenant参数或租户令牌指定租户的采样
+func (handler *QPSHandler) QueryHistory(c *gin.Context) {
+	tenant, err := queryTenant(handler.tenants, c.GetString(tenantScopeKey), c.Query("tenant"))
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if tenant != "" {
+		c.JSON(tenantHistoryResponse(handler.tenants, tenant, c.Query("duration")))
+		return
+	}
+	if handler.history == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": errHistoryDisabled.Error()})
+		return
+	}
+	duration, err := parseHistoryDuration(c.Query("duration"), handler.history.Retention())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, historyResponse(handler.history, duration))
+}
+
+// ScalingAdvice 返回扩缩容建议，replicas参数为当前副本数，未提供时使用配置的副本数
+func (handler *QPSHandler) ScalingAdvice(c *gin.Context) {
+	if handler.advisor == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "扩缩容建议未启用"})
+		return
+	}
+	replicas, err := parseReplicas(c.Query("replicas"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, handler.advisor.Advice(replicas))
+}
+
+// LatestReport 返回最近一份流量报告
+func (handler *QPSHandler) LatestReport(c *gin.Context) {
+	if handler.reporter == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "流量报告未启用"})
+		return
+	}
+	latest := handler.reporter.Latest()
+	if latest == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "暂无报告"})
+		return
+	}
+	c.JSON(http.StatusOK, latest)
+}
+
+// QueryTags 获取各标签组合的QPS，查询参数作为标签过滤条件
+func (handler *QPSHandler) QueryTags(c *gin.Context) {
+	if handler.taggedCounter == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "标签计数未启用"})
+		return
+	}
+
+	p, err := parsePage(c.Query, SortQPS)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filter := make(map[string]string)
+	for key, values := range c.Request.URL.Query() {
+		if len(values) > 0 {
+			filter[key] = values[0]
+		}
+	}
+	c.JSON(http.StatusOK, tagsResponse(handler.taggedCounter, filter, p))
+}
+
+// QueryLatency 获取延迟分布，key参数返回单个key的延迟，其他参数按标签过滤并合并匹配的组合
+func (handler *QPSHandler) QueryLatency(c *gin.Context) {
+	query := make(map[string]string)
+	for key, values := range c.Request.URL.Query() {
+		if len(values) > 0 {
+			query[key] = values[0]
+		}
+	}
+	c.JSON(latencyResponse(handler.latency, handler.latencySeries, query))
+}
+
+// QueryClients 获取窗口内各维度请求速率最高的调用方，top参数指定返回数量
+func (handler *QPSHandler) QueryClients(c *gin.Context) {
+	if handler.clientTracker == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "调用方统计未启用"})
+		return
+	}
+
+	top, err := parseTop(c.Query("top"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, clientsResponse(handler.clientTracker, top))
+}
+
+// ContractVersion 获取公开接口响应结构的版本号
+func (handler *QPSHandler) ContractVersion(c *gin.Context) {
+	c.JSON(http.StatusOK, contractVersionResponse())
+}
+
+// ListWorkers 列出所有运行中的后台协程及其最近一次执行时间和错误
+func (handler *QPSHandler) ListWorkers(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"workers": workers.List()})
+}
+
+// Diagnostics 返回配置问题的诊断结果，如疑似重复的上报流和签名校验失败的上报
+func (handler *QPSHandler) Diagnostics(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"duplicates": handler.duplicates.GetStats(), "signing": handler.signatures.GetStats()})
+}
+
+// ShutdownStatus 返回优雅关闭的进度，关闭期间不受shutdown.policy影响
+func (handler *QPSHandler) ShutdownStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, handler.gracefulShutdown.Progress())
 }
 
 // GetStats 获取系统状态信息
 func (handler *QPSHandler) GetStats(c *gin.Context) {
 	// 获取QPS计数器状态
 	qps := handler.counter.CurrentQPS()
-	
-	// 获取限流器状态
-	limiterStats := handler.rateLimiter.GetStats()
-	
-	// 获取优雅关闭状态
-	shutdownStatus := handler.gracefulShutdown.Status()
-	shutdownActiveRequests := handler.gracefulShutdown.ActiveRequests()
-	
-	c.JSON(http.StatusOK, gin.H{
-		"qps": qps,
-		"limiter": limiterStats,
-		"shutdown": map[string]interface{}{
-			"status": shutdownStatus,
-			"active_requests": shutdownActiveRequests,
-		},
-	})
+
+	stats := gin.H{
+		"qps":      qps,
+		"counter":  handler.counter.Stats(),
+		"limiter":  newLimiterStats(handler.rateLimiter, handler.limiterPolicy, handler.decisions),
+		"shutdown": handler.gracefulShutdown.Stats(),
+		"ingest":   handler.ingestSwitch.GetStats(),
+		"pressure": pressure.Read(),
+		"late":     counter.LateEvents(),
+	}
+	if replicationStats := replicationStats(handler.publisher, handler.follower); replicationStats != nil {
+		stats["replication"] = replicationStats
+	}
+	if handler.latency != nil {
+		stats["latency"] = handler.latency.Stats()
+	}
+	if handler.weighted != nil {
+		stats["weighted"] = handler.weighted.Stats()
+	}
+	if verifier := counter.VerifierOf(handler.counter); verifier != nil {
+		stats["verify"] = verifier.Stats()
+	}
+	if handler.tenants != nil {
+		stats["tenants"] = handler.tenants.GetStats()
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+// GetStatsV2 获取计数器、限流器、分片和优雅关闭的状态，响应为Stats结构
+func (handler *QPSHandler) GetStatsV2(c *gin.Context) {
+	c.JSON(http.StatusOK, collectStats(handler.counter, handler.rateLimiter, handler.sharding, handler.gracefulShutdown))
 }
 
 // SetLimiterRate 设置限流器速率
 func (handler *QPSHandler) SetLimiterRate(c *gin.Context) {
 	var req struct {
-		Rate int64 `json:"rate" binding:"required"`
+		Rate config.Count `json:"rate" binding:"required"` // 整数或 "1.5k" 这样的字符串
 	}
-	
+
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的速率参数"})
 		return
 	}
-	
+
 	if req.Rate <= 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "速率必须大于0"})
 		return
 	}
-	
-	handler.rateLimiter.SetRate(req.Rate)
+
+	handler.rateLimiter.SetRate(int64(req.Rate))
 	c.JSON(http.StatusOK, gin.H{"message": "限流速率已更新", "new_rate": req.Rate})
 }
 
@@ -104,12 +506,250 @@ func (handler *QPSHandler) ToggleLimiter(c *gin.Context) {
 	var req struct {
 		Enabled bool `json:"enabled"`
 	}
-	
+
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的参数"})
 		return
 	}
-	
+
 	handler.rateLimiter.SetEnabled(req.Enabled)
 	c.JSON(http.StatusOK, gin.H{"message": "限流器状态已更新", "enabled": req.Enabled})
 }
+
+// LimiterRules 返回按顺序匹配的限流规则及其命中次数
+func (handler *QPSHandler) LimiterRules(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"rules": handler.rateLimiter.Rules()})
+}
+
+// SetLimiterRules 替换全部限流规则
+func (handler *QPSHandler) SetLimiterRules(c *gin.Context) {
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rules, err := decodeLimiterRules(body)
+	if err == nil {
+		err = handler.rateLimiter.SetRules(rules)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "限流规则已更新", "rules": handler.rateLimiter.Rules()})
+}
+
+// AdmitRead 关闭期间按查询请求的策略决定是否继续处理，拒绝时返回503并中止请求
+func (handler *QPSHandler) AdmitRead(c *gin.Context) {
+	if !handler.gracefulShutdown.Accepts(counter.RequestRead) {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "服务正在关闭中"})
+		return
+	}
+	c.Next()
+}
+
+// ScopeTenant 启用租户分区时校验查询请求的令牌，把租户令牌对应的租户保存在请求上下文中，拒绝时中止请求
+func (handler *QPSHandler) ScopeTenant(c *gin.Context) {
+	tenant, status, err := tenantScope(handler.tenants, handler.adminToken, c.GetHeader("Authorization"), c.Request.URL.Path)
+	if err != nil {
+		c.AbortWithStatusJSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	c.Set(tenantScopeKey, tenant)
+	c.Next()
+}
+
+// RequireAdmin 校验管理员令牌，未通过认证时中止请求
+// 限流器不可用且路由的失败策略为closed时同样中止，避免在限流失效时执行开销较大的管理操作
+func (handler *QPSHandler) RequireAdmin(c *gin.Context) {
+	if !adminAuthorized(handler.adminToken, c.GetHeader("Authorization")) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "需要管理员认证"})
+		return
+	}
+	if !limiterAvailable(handler.rateLimiter, handler.limiterPolicy, c.Request.URL.Path) {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "限流器不可用"})
+		return
+	}
+	c.Next()
+}
+
+// AdminBatch 原子地执行一组管理操作，返回每一项的结果
+func (handler *QPSHandler) AdminBatch(c *gin.Context) {
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ops, err := decodeBatchRequest(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	batch := adminBatch{rateLimiter: handler.rateLimiter, ingestSwitch: handler.ingestSwitch, registry: handler.registry}
+	status, resp := batch.run(ops)
+	c.JSON(status, resp)
+}
+
+// ApplyConfig 将限流器和命名计数器收敛到声明式文档，返回差异
+func (handler *QPSHandler) ApplyConfig(c *gin.Context) {
+	dryRun, err := parseDryRun(c.Query("dry_run"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	doc, err := decodeDeclaredConfig(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	apply := declarativeApply{rateLimiter: handler.rateLimiter, registry: handler.registry}
+	status, resp := apply.run(doc, dryRun)
+	c.JSON(status, resp)
+}
+
+// ReplicationStream 以NDJSON持续推送计数增量，供query角色的只读副本订阅
+func (handler *QPSHandler) ReplicationStream(c *gin.Context) {
+	epoch, after, err := replicationCursor(c.Query("epoch"), c.Query("after"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	deltas, cancel := handler.publisher.Subscribe(epoch, after)
+	defer cancel()
+
+	// 增量流是长连接，不受服务器写超时限制
+	http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+	c.Header("Content-Type", replication.ContentType)
+	c.Status(http.StatusOK)
+
+	encoder := json.NewEncoder(c.Writer)
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case d, ok := <-deltas:
+			if !ok {
+				return false
+			}
+			return encoder.Encode(d) == nil
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
+
+// PauseIngest 暂停所有数据源的采集
+func (handler *QPSHandler) PauseIngest(c *gin.Context) {
+	handler.ingestSwitch.Pause()
+	c.JSON(http.StatusOK, gin.H{"message": "采集已暂停", "ingest": handler.ingestSwitch.GetStats()})
+}
+
+// ResumeIngest 恢复所有数据源的采集
+func (handler *QPSHandler) ResumeIngest(c *gin.Context) {
+	handler.ingestSwitch.Resume()
+	c.JSON(http.StatusOK, gin.H{"message": "采集已恢复", "ingest": handler.ingestSwitch.GetStats()})
+}
+
+// StartLoadGen 按给定速率向计数器写入计数，用于演示和CI
+func (handler *QPSHandler) StartLoadGen(c *gin.Context) {
+	var req loadgen.Request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(startLoadGen(handler.loadGenerator, req))
+}
+
+// LoadGenStatus 返回最近一次压测的状态
+func (handler *QPSHandler) LoadGenStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"loadgen": handler.loadGenerator.Status()})
+}
+
+// StopLoadGen 停止正在运行的压测
+func (handler *QPSHandler) StopLoadGen(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"message": "压测已停止", "loadgen": handler.loadGenerator.Cancel()})
+}
+
+// HealthCheck 聚合各组件的健康状态，有组件unhealthy时返回503
+func (handler *QPSHandler) HealthCheck(c *gin.Context) {
+	report := handler.health.Check()
+	c.JSON(report.StatusCode(), report)
+}
+
+// ListCounters 列出所有命名计数器
+func (handler *QPSHandler) ListCounters(c *gin.Context) {
+	p, err := parsePage(c.Query, SortName)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, countersResponse(handler.registry, p))
+}
+
+// CreateCounter 创建一个命名计数器
+func (handler *QPSHandler) CreateCounter(c *gin.Context) {
+	var spec counter.CounterSpec
+	if err := c.ShouldBindJSON(&spec); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	info, err := handler.registry.Create(spec)
+	if err != nil {
+		c.JSON(registryErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, info)
+}
+
+// GetCounter 获取一个命名计数器的状态
+func (handler *QPSHandler) GetCounter(c *gin.Context) {
+	info, ok := handler.registry.Info(c.Param("name"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": counter.ErrCounterNotFound.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, info)
+}
+
+// DeleteCounter 删除一个命名计数器
+func (handler *QPSHandler) DeleteCounter(c *gin.Context) {
+	name := c.Param("name")
+	if err := handler.registry.Delete(name); err != nil {
+		c.JSON(registryErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, deleteCounterResponse(handler.registry, name))
+}
+
+// RestoreCounter 恢复保留期内已删除的命名计数器
+func (handler *QPSHandler) RestoreCounter(c *gin.Context) {
+	info, err := handler.registry.Undelete(c.Param("name"))
+	if err != nil {
+		c.JSON(registryErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, info)
+}
+
+// ResetCounter 清空全局计数器的窗口，指定name参数时清空该命名计数器，需要管理员令牌
+func (handler *QPSHandler) ResetCounter(c *gin.Context) {
+	status, resp := resetCounter(handler.counter, handler.registry, c.Query("name"))
+	c.JSON(status, resp)
+}
+
+// CollectNamed 向命名计数器上报计数
+func (handler *QPSHandler) CollectNamed(c *gin.Context) {
+	target, err := handler.registry.Writable(c.Param("name"))
+	if err != nil {
+		c.JSON(registryErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	handler.collect(c, target, collectDimensions{})
+}
@@ -0,0 +1,33 @@
+package api
+
+import (
+	"errors"
+	"time"
+
+	"github.com/mant7s/qps-counter/internal/counter"
+)
+
+// errHistoryDisabled 未启用counter.history时查询历史返回的错误
+var errHistoryDisabled = errors.New("QPS历史记录未启用")
+
+// parseHistoryDuration 解析/qps/history的duration参数，为空时返回保留时长，超过保留时长时截断
+func parseHistoryDuration(value string, retention time.Duration) (time.Duration, error) {
+	if value == "" {
+		return retention, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return 0, errors.New("duration必须是正的时长，如 5m")
+	}
+	return min(duration, retention), nil
+}
+
+// historyResponse 构造/qps/history的响应
+func historyResponse(h *counter.History, duration time.Duration) map[string]interface{} {
+	return map[string]interface{}{
+		"duration":  duration.String(),
+		"interval":  h.Interval().String(),
+		"retention": h.Retention().String(),
+		"samples":   h.Samples(duration),
+	}
+}
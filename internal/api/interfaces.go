@@ -0,0 +1,62 @@
+package api
+
+import (
+	"github.com/mant7s/qps-counter/internal/counter"
+	"github.com/mant7s/qps-counter/internal/limiter"
+)
+
+// Allower 上报路径使用的限流判断，其他实现（如基于Redis的分布式限流器）实现该接口即可接入处理器
+type Allower interface {
+	// Identify 从请求方法、路径和请求头中提取限流规则匹配的请求属性
+	Identify(method, path string, header func(string) string) limiter.Request
+	// Cost 返回请求的令牌消耗，declared为0时使用默认消耗
+	Cost(declared int64) (int64, error)
+	// CheckRequest 按限流规则判断是否放行消耗n个令牌的请求
+	CheckRequest(req limiter.Request, n int64) (limiter.Verdict, error)
+	// Unit 返回令牌的计量单位，为limiter.UnitBytes时按请求体字节数消耗令牌
+	Unit() string
+	// Err 返回限流器当前不可用的原因，可用时返回nil
+	Err() error
+	// Stats 返回/stats和决策追踪中显示的限流器状态
+	Stats() limiter.Stats
+}
+
+// LimiterControl 管理接口使用的限流器配置
+type LimiterControl interface {
+	Rate() int64
+	SetRate(rate int64)
+	Enabled() bool
+	SetEnabled(enabled bool)
+	Rules() []limiter.RuleStatus
+	SetRules(specs []limiter.RuleSpec) error
+}
+
+// Limiter 路由器使用的限流器，limiter.RateLimiter是默认实现
+type Limiter interface {
+	Allower
+	LimiterControl
+}
+
+// RequestTracker 跟踪进行中的请求，优雅关闭开始后按请求类别拒绝新请求
+type RequestTracker interface {
+	// StartRequest 开始处理一个上报请求，正在关闭时返回false，返回true时必须调用EndRequest
+	StartRequest() bool
+	EndRequest()
+	// Accepts 返回当前是否接受给定类别（如counter.RequestRead）的请求
+	Accepts(class string) bool
+	ActiveRequests() int64
+	Status() string
+}
+
+// ShutdownTracker 路由器使用的优雅关闭，除跟踪请求外还提供 /shutdown/status 的关闭进度
+// counter.EnhancedGracefulShutdown是默认实现
+type ShutdownTracker interface {
+	RequestTracker
+	Progress() counter.ShutdownProgress
+	Stats() counter.ShutdownStats
+}
+
+var (
+	_ Limiter         = (*limiter.RateLimiter)(nil)
+	_ ShutdownTracker = (*counter.EnhancedGracefulShutdown)(nil)
+)
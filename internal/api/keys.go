@@ -0,0 +1,87 @@
+package api
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/mant7s/qps-counter/internal/counter"
+)
+
+// errKeysDisabled 未启用counter.keys时按key查询返回的错误
+var errKeysDisabled = errors.New("按key计数未启用")
+
+// keyQPSResponse 构造/qps?key=的响应，未跟踪的key的QPS为0
+func keyQPSResponse(kc *counter.KeyedCounter, key string) map[string]interface{} {
+	qps, tracked := kc.QPS(key)
+	return map[string]interface{}{
+		"key":     key,
+		"qps":     qps,
+		"tracked": tracked,
+	}
+}
+
+// keysResponse 构造/qps/keys?top=的响应，返回QPS最高的top个key，不分页
+func keysResponse(kc *counter.KeyedCounter, top int) map[string]interface{} {
+	return map[string]interface{}{
+		"keys":     kc.Top(top),
+		"tracked":  kc.KeyCount(),
+		"max_keys": kc.MaxKeys(),
+		"overflow": kc.Overflow(),
+		"evicted":  kc.Evicted(),
+	}
+}
+
+// keysPageResponse 构造/qps/keys的分页响应，默认按QPS从高到低排序
+func keysPageResponse(kc *counter.KeyedCounter, p pageParams) map[string]interface{} {
+	result := paginate(kc.Rates(), p, func(k counter.KeyQPS) pageCursor {
+		return pageCursor{Name: k.Key, QPS: float64(k.QPS)}
+	})
+	return map[string]interface{}{
+		"keys":           result.Items,
+		"next_cursor":    result.NextCursor,
+		"total_estimate": result.Total,
+		"tracked":        kc.KeyCount(),
+		"max_keys":       kc.MaxKeys(),
+		"overflow":       kc.Overflow(),
+		"evicted":        kc.Evicted(),
+	}
+}
+
+// queryKeys 解析/qps/keys的参数并构造响应，指定top时返回前top个key，否则分页返回
+func queryKeys(kc *counter.KeyedCounter, query func(string) string) (map[string]interface{}, error) {
+	if raw := query("top"); raw != "" {
+		top, err := parseTop(raw)
+		if err != nil {
+			return nil, err
+		}
+		return keysResponse(kc, top), nil
+	}
+	p, err := parsePage(query, SortQPS)
+	if err != nil {
+		return nil, err
+	}
+	return keysPageResponse(kc, p), nil
+}
+
+// tagsResponse 构造/qps/tags的分页响应，分页参数之外的查询参数作为标签过滤条件
+func tagsResponse(tc *counter.TaggedCounter, filter map[string]string, p pageParams) map[string]interface{} {
+	for _, name := range pageParamNames {
+		delete(filter, name)
+	}
+	keys := tc.Keys()
+	result := paginate(tc.Series(filter), p, func(s counter.TaggedSeries) pageCursor {
+		values := make([]string, len(keys))
+		for i, key := range keys {
+			values[i] = key + "=" + s.Tags[key]
+		}
+		return pageCursor{Name: strings.Join(values, ","), QPS: float64(s.QPS)}
+	})
+	return map[string]interface{}{
+		"keys":           keys,
+		"series":         result.Items,
+		"next_cursor":    result.NextCursor,
+		"total_estimate": result.Total,
+		"max_series":     tc.MaxSeries(),
+		"overflow":       tc.Overflow(),
+	}
+}
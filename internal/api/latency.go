@@ -0,0 +1,54 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/mant7s/qps-counter/internal/counter"
+)
+
+// errLatencyDisabled 未启用counter.latency时 /latency 返回的错误
+var errLatencyDisabled = errors.New("延迟统计未启用")
+
+// latencyResponse 构造 /latency 的响应，返回状态码和响应体
+// 没有参数时返回全局直方图；key参数返回单个key的延迟；其余参数视为标签过滤，合并匹配的标签组合
+func latencyResponse(global *counter.LatencyHistogram, series *counter.LatencySeries, query map[string]string) (int, interface{}) {
+	if global == nil {
+		return http.StatusServiceUnavailable, map[string]string{"error": errLatencyDisabled.Error()}
+	}
+
+	key, byKey := query["key"]
+	delete(query, "key")
+	switch {
+	case byKey && len(query) > 0:
+		return http.StatusBadRequest, map[string]string{"error": "key和标签过滤不能同时使用"}
+	case byKey:
+		if !series.PerKey() {
+			return http.StatusServiceUnavailable, map[string]string{"error": "按key统计延迟未启用"}
+		}
+		stats, tracked := series.KeyStats(key)
+		return http.StatusOK, map[string]interface{}{"key": key, "tracked": tracked, "latency": stats}
+	case len(query) > 0:
+		tagKeys := series.TagKeys()
+		if len(tagKeys) == 0 {
+			return http.StatusServiceUnavailable, map[string]string{"error": "按标签统计延迟未启用"}
+		}
+		for name := range query {
+			if !slices.Contains(tagKeys, name) {
+				return http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("未声明的标签: %s", name)}
+			}
+		}
+		stats, matched := series.TagStats(query)
+		return http.StatusOK, map[string]interface{}{"tags": query, "series": matched, "latency": stats}
+	}
+
+	resp := map[string]interface{}{"latency": global.Stats()}
+	if series != nil {
+		resp["series"] = series.SeriesCount()
+		resp["max_series"] = series.MaxSeries()
+		resp["overflow"] = series.Overflow()
+	}
+	return http.StatusOK, resp
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/limiter"
+)
+
+// limiterRulesRequest PUT /admin/limiter/rules 的请求体，rules为完整的规则列表
+type limiterRulesRequest struct {
+	Rules *[]ruleSpecRequest `json:"rules"`
+}
+
+// ruleSpecRequest 请求中的一条规则，rate和burst可以是整数或 "1.5k" 这样的字符串
+type ruleSpecRequest struct {
+	limiter.RuleSpec
+	Rate  config.Count `json:"rate,omitempty"`
+	Burst config.Count `json:"burst,omitempty"`
+}
+
+// decodeLimiterRules 解析规则列表，未知字段视为错误，空数组表示删除所有规则
+func decodeLimiterRules(body []byte) ([]limiter.RuleSpec, error) {
+	var req limiterRulesRequest
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		return nil, fmt.Errorf("无效的规则列表: %v", err)
+	}
+	if req.Rules == nil {
+		return nil, errors.New("缺少rules字段")
+	}
+	specs := make([]limiter.RuleSpec, len(*req.Rules))
+	for i, rule := range *req.Rules {
+		specs[i] = rule.RuleSpec
+		specs[i].Rate, specs[i].Burst = int64(rule.Rate), int64(rule.Burst)
+	}
+	return specs, nil
+}
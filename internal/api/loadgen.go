@@ -0,0 +1,20 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/mant7s/qps-counter/internal/loadgen"
+)
+
+// startLoadGen 开始一次内置压测，返回状态码和响应
+func startLoadGen(generator *loadgen.Generator, req loadgen.Request) (int, map[string]interface{}) {
+	status, err := generator.Start(req)
+	switch {
+	case errors.Is(err, loadgen.ErrRunning):
+		return http.StatusConflict, map[string]interface{}{"error": err.Error(), "loadgen": status}
+	case err != nil:
+		return http.StatusBadRequest, map[string]interface{}{"error": err.Error()}
+	}
+	return http.StatusAccepted, map[string]interface{}{"message": "压测已开始", "loadgen": status}
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mant7s/qps-counter/internal/analytics"
+	"github.com/mant7s/qps-counter/internal/counter"
+	"github.com/mant7s/qps-counter/internal/health"
+	"github.com/mant7s/qps-counter/internal/ingest"
+	"github.com/mant7s/qps-counter/internal/limiter"
+	"github.com/mant7s/qps-counter/internal/loadgen"
+	"github.com/mant7s/qps-counter/internal/metrics"
+	"github.com/mant7s/qps-counter/internal/replication"
+	"github.com/mant7s/qps-counter/internal/report"
+	"github.com/mant7s/qps-counter/internal/scaling"
+	"github.com/valyala/fasthttp"
+)
+
+// FastHTTPMiddleware fasthttp路由器的中间件，包装整个请求处理器
+type FastHTTPMiddleware func(fasthttp.RequestHandler) fasthttp.RequestHandler
+
+// 实例角色，大规模部署时上报和查询两条路径可以分别扩容
+const (
+	RoleFull   = "full"   // 同时提供上报和查询接口
+	RoleIngest = "ingest" // 只接受上报，不提供查询和历史接口
+	RoleQuery  = "query"  // 只提供查询接口，不接受上报
+)
+
+// RouterOptions 路由器依赖的组件和功能开关，Gin和fasthttp路由器共用
+// Counter、GracefulShutdown和RateLimiter是必需的，其余组件为nil时对应的接口不启用或返回503；
+// GracefulShutdown和RateLimiter是接口，测试替身或其他实现（如分布式限流器）可以直接替换默认实现
+type RouterOptions struct {
+	Counter          counter.Counter
+	GracefulShutdown ShutdownTracker // 默认实现为counter.EnhancedGracefulShutdown
+	RateLimiter      Limiter         // 默认实现为limiter.RateLimiter
+
+	TrendTracker  *counter.TrendTracker     // 为nil时 /qps/trend 返回503
+	History       *counter.History          // 为nil时 /qps/history 返回503
+	TaggedCounter *counter.TaggedCounter    // 为nil时 /qps/tags 返回503
+	KeyedCounter  *counter.KeyedCounter     // 为nil时 /qps?key= 和 /qps/keys 返回503
+	ClientTracker *counter.ClientTracker    // 为nil时 /clients 返回503
+	Latency       *counter.LatencyHistogram // 为nil时不统计上报的latency_ms，/stats 不返回latency
+	LatencySeries *counter.LatencySeries    // 为nil时不按key和标签组合统计延迟
+	Weighted      *counter.WeightedWindow   // 为nil时不统计上报的weight，/v1/qps 和 /stats 不返回weighted
+	Registry      *counter.Registry         // 为nil时不注册 /counters 接口
+	IngestSwitch  *ingest.Switch            // 为nil时不注册 /admin/ingest 接口
+	Duplicates    *ingest.DuplicateDetector // 为nil时不检测重复上报
+	Signatures    *ingest.SignatureVerifier // 为nil时不校验上报签名
+	Tenants       *counter.TenantStore      // 为nil时不按租户计数，查询接口不限定租户
+	FailurePolicy *limiter.FailurePolicy    // 限流器出错时各路由放行还是拒绝，为nil时全部放行
+	DecisionLog   *analytics.DecisionLog    // 为nil时不记录限流决策
+	Advisor       *scaling.Advisor          // 为nil时 /scaling/advice 返回503
+	Reporter      *report.Reporter          // 为nil时 /reports/latest 返回503
+	LoadGenerator *loadgen.Generator        // 为nil时不注册 /admin/loadgen 接口
+	Health        *health.Registry          // 为nil时 /healthz 只返回整体状态healthy
+
+	// Publisher 增量发布者，不为nil时注册 /admin/replication/stream，应同时作为Counter使用
+	Publisher *replication.Publisher
+	// Follower 订阅上报节点增量流的只读副本，只用于在/stats中显示订阅状态
+	Follower *replication.Follower
+	// Sharding 自适应分片管理器，为nil时 /stats/v2 不返回sharding
+	Sharding *counter.EnhancedAdaptiveShardingManager
+
+	// Role 实例角色，为空时为full；管理、状态、健康检查和指标接口在所有角色下都可用
+	Role string
+
+	// AdminToken 管理员令牌，为空时管理接口全部返回401，也不接受请求决策追踪
+	AdminToken string
+
+	// QPSPrecision /v1/qps 和 /rate 返回的速率保留的小数位数，为0时使用DefaultQPSPrecision
+	QPSPrecision int
+	// RateUnit /v1/qps 和 /rate 返回的速率的时间单位：second（默认）、minute或hour
+	RateUnit string
+	// CacheMaxAge /qps、/stats 和 /qps/history 响应的Cache-Control max-age，为0时为no-cache
+	CacheMaxAge time.Duration
+
+	Metrics         *metrics.Metrics // 为nil时不暴露指标接口
+	MetricsEndpoint string           // 指标接口路径，默认为 /metrics
+	MetricsEnabled  bool
+
+	// GinMiddleware 在panic恢复中间件之后按顺序注册到Gin路由器
+	GinMiddleware []gin.HandlerFunc
+	// FastHTTPMiddleware 按顺序包装fasthttp路由器的处理器，第一个位于最外层
+	FastHTTPMiddleware []FastHTTPMiddleware
+}
+
+// metricsEndpoint 返回指标接口路径，未启用指标时返回空字符串
+func (o RouterOptions) metricsEndpoint() string {
+	if o.Metrics == nil || !o.MetricsEnabled {
+		return ""
+	}
+	if o.MetricsEndpoint == "" {
+		return "/metrics"
+	}
+	return o.MetricsEndpoint
+}
+
+// rateFormat 返回速率默认保留的小数位数和时间单位
+func (o RouterOptions) rateFormat() rateFormat {
+	f := rateFormat{precision: o.QPSPrecision, per: o.RateUnit}
+	if f.precision <= 0 {
+		f.precision = DefaultQPSPrecision
+	}
+	if !counter.ValidPer(f.per) {
+		f.per = counter.PerSecond
+	}
+	return f
+}
+
+// servesIngest 返回是否注册上报接口
+func (o RouterOptions) servesIngest() bool {
+	return o.Role != RoleQuery
+}
+
+// servesQuery 返回是否注册查询和历史接口
+func (o RouterOptions) servesQuery() bool {
+	return o.Role != RoleIngest
+}
+
+// servesReplication 返回是否注册增量流接口，只读副本本身不发布增量
+func (o RouterOptions) servesReplication() bool {
+	return o.Publisher != nil && o.servesIngest()
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"container/heap"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strconv"
+)
+
+// 列表接口的分页参数
+const (
+	defaultPageLimit = 100
+	maxPageLimit     = 1000
+
+	SortQPS  = "qps"  // 按QPS从高到低，QPS相同时按名称排序
+	SortName = "name" // 按名称（key、标签组合或计数器名）排序
+)
+
+// 分页参数名，/qps/tags 的这些参数不作为标签过滤条件
+var pageParamNames = []string{"limit", "sort", "cursor"}
+
+var (
+	errPageLimit  = errors.New("limit必须是1到1000之间的整数")
+	errPageSort   = errors.New("sort必须是qps或name")
+	errPageCursor = errors.New("无效的cursor")
+)
+
+// pageCursor 上一页最后一项的排序键，编码后作为next_cursor返回
+// 按QPS排序时列表在两次请求之间会变化，QPS发生变化的项可能重复出现或被跳过
+type pageCursor struct {
+	Sort string  `json:"s"`
+	Name string  `json:"n"`
+	QPS  float64 `json:"q,omitempty"`
+}
+
+// pageParams 解析后的分页参数
+type pageParams struct {
+	limit int
+	sort  string
+	after *pageCursor // 为nil时从第一项开始
+}
+
+// parsePage 解析limit、sort和cursor参数，sort为空时使用defaultSort
+func parsePage(query func(string) string, defaultSort string) (pageParams, error) {
+	p := pageParams{limit: defaultPageLimit, sort: defaultSort}
+	if raw := query("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit <= 0 || limit > maxPageLimit {
+			return p, errPageLimit
+		}
+		p.limit = limit
+	}
+	switch raw := query("sort"); raw {
+	case "":
+	case SortQPS, SortName:
+		p.sort = raw
+	default:
+		return p, errPageSort
+	}
+	if raw := query("cursor"); raw != "" {
+		data, err := base64.RawURLEncoding.DecodeString(raw)
+		if err != nil {
+			return p, errPageCursor
+		}
+		var cursor pageCursor
+		if err := json.Unmarshal(data, &cursor); err != nil || cursor.Sort != p.sort {
+			return p, errPageCursor
+		}
+		p.after = &cursor
+	}
+	return p, nil
+}
+
+// less 返回a是否排在b之前
+func (p pageParams) less(a, b pageCursor) bool {
+	if p.sort == SortQPS && a.QPS != b.QPS {
+		return a.QPS > b.QPS
+	}
+	return a.Name < b.Name
+}
+
+// page 一页结果
+type page[T any] struct {
+	Items      []T
+	NextCursor string // 没有下一页时为空
+	Total      int    // 所有项的数量，列表在请求期间变化时只是估计值
+}
+
+// paginate 返回cursor之后的一页，key返回每一项的名称和QPS
+// 用堆只保留排在最前的limit+1项，不对整个列表排序，每页的开销为O(n log limit)
+func paginate[T any](items []T, p pageParams, key func(T) pageCursor) page[T] {
+	h := &pageHeap[T]{key: key, params: p}
+	for _, item := range items {
+		if p.after != nil && !p.less(*p.after, key(item)) {
+			continue
+		}
+		if h.Len() <= p.limit {
+			heap.Push(h, item)
+		} else if p.less(key(item), key(h.items[0])) {
+			h.items[0] = item
+			heap.Fix(h, 0)
+		}
+	}
+
+	selected := h.items
+	slices.SortFunc(selected, func(a, b T) int {
+		switch {
+		case p.less(key(a), key(b)):
+			return -1
+		case p.less(key(b), key(a)):
+			return 1
+		}
+		return 0
+	})
+
+	result := page[T]{Items: selected, Total: len(items)}
+	if len(selected) > p.limit {
+		result.Items = selected[:p.limit]
+		last := key(selected[p.limit-1])
+		last.Sort = p.sort
+		data, _ := json.Marshal(last)
+		result.NextCursor = base64.RawURLEncoding.EncodeToString(data)
+	}
+	return result
+}
+
+// pageHeap 按排序顺序的大顶堆，堆顶是已保留的项中排在最后的一项
+type pageHeap[T any] struct {
+	items  []T
+	key    func(T) pageCursor
+	params pageParams
+}
+
+func (h *pageHeap[T]) Len() int { return len(h.items) }
+func (h *pageHeap[T]) Less(i, j int) bool {
+	return h.params.less(h.key(h.items[j]), h.key(h.items[i]))
+}
+func (h *pageHeap[T]) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+func (h *pageHeap[T]) Push(x any)    { h.items = append(h.items, x.(T)) }
+func (h *pageHeap[T]) Pop() any {
+	last := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return last
+}
@@ -0,0 +1,105 @@
+package api
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/mant7s/qps-counter/internal/counter"
+)
+
+// 速率保留的小数位数
+const (
+	DefaultQPSPrecision = 2
+	MaxQPSPrecision     = 6
+)
+
+// FormatHuman format参数的取值，响应中附加格式化后的速率，如 "1.2k events/s"
+const FormatHuman = "human"
+
+// rateFormat /v1/qps 和 /rate 的输出格式
+type rateFormat struct {
+	precision int
+	per       string // 速率的时间单位
+	human     bool
+}
+
+// parseRateFormat 解析precision、unit和format参数，省略的参数使用配置的默认值
+// query返回查询参数的值，参数不存在时返回空字符串
+func parseRateFormat(query func(key string) string, defaults rateFormat) (rateFormat, error) {
+	f := defaults
+	if precision := query("precision"); precision != "" {
+		n, err := strconv.Atoi(precision)
+		if err != nil || n < 0 || n > MaxQPSPrecision {
+			return f, errors.New("无效的precision参数，应为0到6之间的整数")
+		}
+		f.precision = n
+	}
+	if per := query("unit"); per != "" {
+		if !counter.ValidPer(per) {
+			return f, errors.New("无效的unit参数，应为second、minute或hour")
+		}
+		f.per = per
+	}
+	switch query("format") {
+	case "":
+	case FormatHuman:
+		f.human = true
+	default:
+		return f, errors.New("无效的format参数")
+	}
+	return f, nil
+}
+
+// legacyQPSResponse 构造 /qps 的响应，配置了counter.windows时附加各窗口的整数QPS，如 qps_10s、qps_1m
+func legacyQPSResponse(c counter.Counter) map[string]interface{} {
+	windows := counter.WindowsOf(c)
+	resp := make(map[string]interface{}, len(windows)+1)
+	resp["qps"] = c.CurrentQPS()
+	for _, w := range windows {
+		resp["qps_"+w.Window] = w.QPS
+	}
+	return resp
+}
+
+// qpsResponse 构造 /v1/qps 的响应，/qps 为兼容旧客户端仍返回每秒的整数
+// 启用加权计数时附加同一窗口内的加权速率，格式与 /rate 相同
+func qpsResponse(c counter.Counter, weighted *counter.WeightedWindow, f rateFormat) map[string]interface{} {
+	rate := counter.RoundRate(counter.RatePer(counter.RateOf(c), f.per), f.precision)
+	resp := map[string]interface{}{"qps": rate, "per": f.per}
+	if f.human {
+		resp["formatted"] = counter.FormatRatePer(rate, counter.UnitOf(c), f.per)
+	}
+	if weighted != nil {
+		weightedRate := counter.RoundRate(counter.RatePer(weighted.Rate(), f.per), f.precision)
+		resp["weighted"] = map[string]interface{}{
+			"rate":      weightedRate,
+			"unit":      weighted.Unit(),
+			"per":       f.per,
+			"formatted": counter.FormatRatePer(weightedRate, weighted.Unit(), f.per),
+		}
+	}
+	return resp
+}
+
+// resolveRateTarget 根据名称选择计数器，名称为空时使用主计数器
+func resolveRateTarget(main counter.Counter, registry *counter.Registry, name string) (counter.Counter, bool) {
+	if name == "" {
+		return main, true
+	}
+	if registry == nil {
+		return nil, false
+	}
+	return registry.Get(name)
+}
+
+// rateResponse 构造带计数单位和时间单位的速率响应
+func rateResponse(c counter.Counter, f rateFormat) map[string]interface{} {
+	rate := counter.RoundRate(counter.RatePer(counter.RateOf(c), f.per), f.precision)
+	unit := counter.UnitOf(c)
+	return map[string]interface{}{
+		"rate":      rate,
+		"unit":      unit,
+		"per":       f.per,
+		"formatted": counter.FormatRatePer(rate, unit, f.per),
+	}
+}
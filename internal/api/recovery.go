@@ -0,0 +1,48 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/valyala/fasthttp"
+
+	"github.com/mant7s/qps-counter/internal/recovery"
+)
+
+// 两种HTTP服务器在panic统计中的组件名称
+const (
+	ginComponent      = "http.gin"
+	fasthttpComponent = "http.fasthttp"
+)
+
+// recoveryMiddleware 恢复请求处理中的panic，记录后返回500
+func recoveryMiddleware(c *gin.Context) {
+	defer func() {
+		if r := recover(); r != nil {
+			if err, ok := r.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				// 由net/http负责中断连接
+				panic(r)
+			}
+			recovery.Handle(ginComponent, r)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "服务器内部错误"})
+		}
+	}()
+	c.Next()
+}
+
+// recoverFastHTTP 恢复请求处理中的panic，记录后返回500
+func recoverFastHTTP(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		defer func() {
+			if r := recover(); r != nil {
+				recovery.Handle(fasthttpComponent, r)
+				ctx.ResetBody()
+				ctx.SetStatusCode(http.StatusInternalServerError)
+				json.NewEncoder(ctx).Encode(map[string]string{"error": "服务器内部错误"})
+			}
+		}()
+		next(ctx)
+	}
+}
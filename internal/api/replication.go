@@ -0,0 +1,43 @@
+package api
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/mant7s/qps-counter/internal/replication"
+)
+
+// replicationCursor 解析订阅者上次收到的增量位置，首次订阅时两个参数都为空
+func replicationCursor(epochParam, afterParam string) (int64, uint64, error) {
+	var (
+		epoch int64
+		after uint64
+		err   error
+	)
+	if epochParam != "" {
+		if epoch, err = strconv.ParseInt(epochParam, 10, 64); err != nil {
+			return 0, 0, errors.New("无效的epoch参数")
+		}
+	}
+	if afterParam != "" {
+		if after, err = strconv.ParseUint(afterParam, 10, 64); err != nil {
+			return 0, 0, errors.New("无效的after参数")
+		}
+	}
+	return epoch, after, nil
+}
+
+// replicationStats 返回增量复制的状态，未启用时返回nil
+func replicationStats(publisher *replication.Publisher, follower *replication.Follower) map[string]interface{} {
+	if publisher == nil && follower == nil {
+		return nil
+	}
+	stats := make(map[string]interface{}, 2)
+	if publisher != nil {
+		stats["publisher"] = publisher.GetStats()
+	}
+	if follower != nil {
+		stats["follower"] = follower.GetStats()
+	}
+	return stats
+}
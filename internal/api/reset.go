@@ -0,0 +1,30 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/mant7s/qps-counter/internal/counter"
+	"github.com/mant7s/qps-counter/internal/logger"
+	"go.uber.org/zap"
+)
+
+// resetCounter 清空全局计数器，name不为空时清空该命名计数器，返回状态码和响应
+func resetCounter(global counter.Counter, registry *counter.Registry, name string) (int, map[string]interface{}) {
+	if name == "" {
+		global.Reset()
+		logger.Info("全局计数器已重置")
+		return http.StatusOK, map[string]interface{}{"message": "计数器已重置", "qps": global.CurrentQPS()}
+	}
+
+	var target counter.Counter
+	ok := false
+	if registry != nil {
+		target, ok = registry.Get(name)
+	}
+	if !ok {
+		return http.StatusNotFound, map[string]interface{}{"error": counter.ErrCounterNotFound.Error()}
+	}
+	target.Reset()
+	logger.Info("命名计数器已重置", zap.String("name", name))
+	return http.StatusOK, map[string]interface{}{"message": "计数器已重置", "name": name, "qps": target.CurrentQPS()}
+}
@@ -1,35 +1,92 @@
 package api
 
 import (
-	"net/http"
-
 	"github.com/gin-gonic/gin"
-	"github.com/mant7s/qps-counter/internal/counter"
-	"github.com/mant7s/qps-counter/internal/limiter"
-	"github.com/mant7s/qps-counter/internal/metrics"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-func NewRouter(counter counter.Counter, gracefulShutdown *counter.EnhancedGracefulShutdown, rateLimiter *limiter.RateLimiter, metricsCollector *metrics.Metrics, metricsEndpoint string, metricsEnabled bool) *gin.Engine {
+// NewRouter 根据选项创建Gin路由器
+func NewRouter(opts RouterOptions) *gin.Engine {
 	router := gin.New()
-	router.Use(gin.Recovery())
+	router.Use(recoveryMiddleware)
+	router.Use(opts.GinMiddleware...)
 
-	handler := NewHandler(counter, gracefulShutdown, rateLimiter)
-	router.POST("/collect", handler.Collect)
-	router.GET("/qps", handler.Query)
-	router.GET("/stats", handler.GetStats)
+	handler := NewHandler(opts)
+	// 查询和统计接口，关闭期间按shutdown.policy.read决定是否继续处理，启用租户分区时按令牌限定可见的数据
+	reads := router.Group("", handler.AdmitRead, handler.ScopeTenant)
+	// 轮询较多的接口返回ETag，支持If-None-Match条件请求
+	cached := cacheMiddleware(opts.cacheControl())
+	reads.GET("/stats", cached, handler.GetStats)
+	reads.GET("/stats/v2", cached, handler.GetStatsV2)
+	router.GET("/contract-version", handler.ContractVersion)
+	router.GET("/debug/workers", handler.ListWorkers)
+	router.GET("/diagnostics", handler.Diagnostics)
+	router.GET("/shutdown/status", handler.ShutdownStatus)
 	router.POST("/limiter/rate", handler.SetLimiterRate)
 	router.POST("/limiter/toggle", handler.ToggleLimiter)
-	router.GET("/healthz", func(c *gin.Context) {
-		c.String(http.StatusOK, "ok")
-	})
 
-	// 添加Prometheus指标暴露端点
-	if metricsCollector != nil && metricsEnabled {
-		if metricsEndpoint == "" {
-			metricsEndpoint = "/metrics"
+	// 上报接口，query角色的实例不接受上报
+	if opts.servesIngest() {
+		router.POST("/collect", handler.Collect)
+		router.POST("/collect/batch", handler.CollectBatch)
+		if opts.Registry != nil {
+			router.POST("/counters/:name/collect", handler.CollectNamed)
+		}
+	}
+
+	// 查询和历史接口，ingest角色的实例不提供
+	if opts.servesQuery() {
+		reads.GET("/qps", cached, handler.Query)
+		reads.GET("/v1/qps", handler.QueryV1)
+		reads.GET("/rate", handler.QueryRate)
+		reads.GET("/qps/trend", handler.QueryTrend)
+		reads.GET("/qps/history", cached, handler.QueryHistory)
+		reads.GET("/qps/tags", handler.QueryTags)
+		reads.GET("/qps/keys", handler.QueryKeys)
+		reads.GET("/latency", handler.QueryLatency)
+		reads.GET("/clients", handler.QueryClients)
+		reads.GET("/scaling/advice", handler.ScalingAdvice)
+		reads.GET("/reports/latest", handler.LatestReport)
+		if opts.Registry != nil {
+			reads.GET("/counters", handler.ListCounters)
+			reads.GET("/counters/:name", handler.GetCounter)
 		}
-		router.GET(metricsEndpoint, gin.WrapH(promhttp.HandlerFor(metricsCollector.Registry(), promhttp.HandlerOpts{})))
+	}
+
+	// 清空计数器，需要管理员令牌
+	router.POST("/counters/reset", handler.RequireAdmin, handler.ResetCounter)
+
+	// 命名计数器管理，需要管理员令牌
+	if opts.Registry != nil {
+		router.POST("/counters", handler.RequireAdmin, handler.CreateCounter)
+		router.DELETE("/counters/:name", handler.RequireAdmin, handler.DeleteCounter)
+		router.POST("/counters/:name/restore", handler.RequireAdmin, handler.RestoreCounter)
+	}
+
+	// 管理接口，需要管理员令牌
+	admin := router.Group("/admin", handler.RequireAdmin)
+	admin.POST("/batch", handler.AdminBatch)
+	admin.PUT("/config", handler.ApplyConfig)
+	admin.GET("/limiter/rules", handler.LimiterRules)
+	admin.PUT("/limiter/rules", handler.SetLimiterRules)
+	if opts.IngestSwitch != nil {
+		admin.POST("/ingest/pause", handler.PauseIngest)
+		admin.POST("/ingest/resume", handler.ResumeIngest)
+	}
+	if opts.LoadGenerator != nil {
+		admin.POST("/loadgen", handler.StartLoadGen)
+		admin.GET("/loadgen", handler.LoadGenStatus)
+		admin.DELETE("/loadgen", handler.StopLoadGen)
+	}
+	if opts.servesReplication() {
+		admin.GET("/replication/stream", handler.ReplicationStream)
+	}
+
+	router.GET("/healthz", handler.HealthCheck)
+
+	// 添加Prometheus指标暴露端点
+	if endpoint := opts.metricsEndpoint(); endpoint != "" {
+		router.GET(endpoint, gin.WrapH(promhttp.HandlerFor(opts.Metrics.Registry(), promhttp.HandlerOpts{})))
 	}
 
 	return router
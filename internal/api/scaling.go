@@ -0,0 +1,18 @@
+package api
+
+import (
+	"errors"
+	"strconv"
+)
+
+// parseReplicas 解析/scaling/advice的replicas参数，为空时返回0表示使用配置的副本数
+func parseReplicas(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	replicas, err := strconv.Atoi(value)
+	if err != nil || replicas <= 0 {
+		return 0, errors.New("replicas必须是正整数")
+	}
+	return replicas, nil
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"github.com/mant7s/qps-counter/internal/analytics"
+	"github.com/mant7s/qps-counter/internal/counter"
+	"github.com/mant7s/qps-counter/internal/limiter"
+)
+
+// Stats /stats/v2 的响应，各部分都是带JSON标签的结构，qpsctl stats按该结构解码；
+// 失败策略、采集开关等尚未定义结构的状态仍由 /stats 返回
+type Stats struct {
+	QPS      int64                  `json:"qps"`
+	Counter  counter.CounterStats   `json:"counter"`
+	Limiter  limiter.Stats          `json:"limiter"`
+	Sharding *counter.ShardingStats `json:"sharding,omitempty"` // 没有自适应分片管理器时省略
+	Shutdown counter.ShutdownStats  `json:"shutdown"`
+	Late     counter.LateStats      `json:"late"`
+	Verify   *counter.VerifierStats `json:"verify,omitempty"` // 未启用计数校验时省略
+}
+
+// limiterStats /stats 中的限流器状态，在limiter.Stats的字段之外附加失败策略和决策记录
+type limiterStats struct {
+	limiter.Stats
+	FailurePolicy map[string]interface{} `json:"failure_policy"`
+	Decisions     map[string]interface{} `json:"decisions"`
+}
+
+// collectStats 读取 /stats/v2 返回的状态，sharding为nil时省略分片状态，未启用计数校验时省略校验统计
+func collectStats(c counter.Counter, rl Allower, sharding *counter.EnhancedAdaptiveShardingManager, gs ShutdownTracker) Stats {
+	stats := Stats{
+		QPS:      c.CurrentQPS(),
+		Counter:  c.Stats(),
+		Limiter:  rl.Stats(),
+		Shutdown: gs.Stats(),
+		Late:     counter.LateEvents(),
+	}
+	if sharding != nil {
+		shardingStats := sharding.Stats()
+		stats.Sharding = &shardingStats
+	}
+	if verifier := counter.VerifierOf(c); verifier != nil {
+		verifyStats := verifier.Stats()
+		stats.Verify = &verifyStats
+	}
+	return stats
+}
+
+// newLimiterStats 返回 /stats 中的限流器状态
+func newLimiterStats(rl Allower, policy *limiter.FailurePolicy, decisions *analytics.DecisionLog) limiterStats {
+	return limiterStats{
+		Stats:         rl.Stats(),
+		FailurePolicy: policy.GetStats(),
+		Decisions:     decisions.GetStats(),
+	}
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/mant7s/qps-counter/internal/counter"
+)
+
+// tenantScopeKey 请求上下文中保存租户范围的键，值为租户令牌对应的租户，管理员为空字符串
+const tenantScopeKey = "qps.tenant"
+
+var (
+	// errTenantsDisabled 未启用tenants时按租户查询返回的错误
+	errTenantsDisabled = errors.New("租户分区未启用")
+	// errTenantForbidden 租户令牌查询其他租户或全局数据时返回的错误
+	errTenantForbidden = errors.New("租户令牌只能查询本租户的 /qps 和 /qps/history")
+)
+
+// tenantPaths 租户令牌可以访问的查询接口，返回本租户的数据
+var tenantPaths = map[string]bool{
+	"/qps":         true,
+	"/qps/history": true,
+}
+
+// tenantScope 按请求的认证身份决定查询接口可以访问的数据，返回租户范围、拒绝时的状态码和错误
+// 未启用租户分区时不限制；管理员令牌不限定租户；租户令牌只能访问tenantPaths，且只能看到本租户的数据；
+// 其余请求返回401，全局数据包含所有租户的流量，不能对未认证的调用方公开
+func tenantScope(store *counter.TenantStore, adminToken, authorization, path string) (string, int, error) {
+	if store == nil || adminAuthorized(adminToken, authorization) {
+		return "", http.StatusOK, nil
+	}
+	tenant, ok := store.TenantForToken(bearerToken(authorization))
+	if !ok {
+		return "", http.StatusUnauthorized, errors.New("需要认证")
+	}
+	if !tenantPaths[path] {
+		return "", http.StatusForbidden, errTenantForbidden
+	}
+	return tenant, http.StatusOK, nil
+}
+
+// queryTenant 返回 /qps 和 /qps/history 查询的租户，为空表示查询全局数据
+// 管理员通过tenant参数指定租户；租户令牌总是查询本租户，tenant参数与之不同时返回errTenantForbidden
+func queryTenant(store *counter.TenantStore, scope, requested string) (string, error) {
+	if store == nil {
+		return "", nil
+	}
+	if scope == "" {
+		return requested, nil
+	}
+	if requested != "" && requested != scope {
+		return "", errTenantForbidden
+	}
+	return scope, nil
+}
+
+// collectTenant 返回上报计入的租户，为空时只计入全局计数器
+// 携带租户令牌时使用令牌对应的租户，忽略租户请求头；只有管理员令牌可以通过租户请求头指定任一租户；
+// 未认证的上报不计入任何租户，否则任何调用方都可以写入其他租户的分区，或用编造的租户占满max_tenants
+func collectTenant(store *counter.TenantStore, adminToken, authorization, header string) string {
+	if store == nil {
+		return ""
+	}
+	if tenant, ok := store.TenantForToken(bearerToken(authorization)); ok {
+		return tenant
+	}
+	if adminAuthorized(adminToken, authorization) {
+		return header
+	}
+	return ""
+}
+
+// bearerToken 返回 Authorization: Bearer <token> 中的令牌
+func bearerToken(authorization string) string {
+	token, _ := strings.CutPrefix(authorization, "Bearer ")
+	return token
+}
+
+// tenantQPSResponse 构造按租户查询 /qps 的响应，tracked为false表示该租户还没有计数
+func tenantQPSResponse(store *counter.TenantStore, tenant string) map[string]interface{} {
+	qps, tracked := store.QPS(tenant)
+	return map[string]interface{}{"tenant": tenant, "qps": qps, "tracked": tracked}
+}
+
+// tenantHistoryResponse 构造按租户查询 /qps/history 的响应，返回状态码和响应体
+func tenantHistoryResponse(store *counter.TenantStore, tenant, durationParam string) (int, interface{}) {
+	duration, err := parseHistoryDuration(durationParam, store.Retention())
+	if err != nil {
+		return http.StatusBadRequest, map[string]string{"error": err.Error()}
+	}
+	h := store.History(tenant)
+	if h == nil {
+		return http.StatusOK, map[string]interface{}{
+			"tenant":    tenant,
+			"duration":  duration.String(),
+			"interval":  store.Interval().String(),
+			"retention": store.Retention().String(),
+			"samples":   []counter.HistorySample{},
+		}
+	}
+	resp := historyResponse(h, duration)
+	resp["tenant"] = tenant
+	return http.StatusOK, resp
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/mant7s/qps-counter/internal/counter"
+	"github.com/mant7s/qps-counter/internal/limiter"
+	"github.com/mant7s/qps-counter/internal/logger"
+	"go.uber.org/zap"
+)
+
+// DebugTraceHeader 请求级别决策追踪的请求头，仅在携带有效管理员令牌时生效
+const DebugTraceHeader = "X-Debug-Trace"
+
+// debugTraceRequested 判断请求是否开启了决策追踪
+// 未通过管理员认证时忽略追踪请求头，按普通请求处理
+func debugTraceRequested(adminToken, authorization, debugHeader string) bool {
+	if debugHeader == "" {
+		return false
+	}
+	enabled, err := strconv.ParseBool(debugHeader)
+	if err != nil || !enabled {
+		return false
+	}
+	return adminAuthorized(adminToken, authorization)
+}
+
+// traceStep 决策过程中的一个步骤
+type traceStep struct {
+	Step   string                 `json:"step"`
+	Detail map[string]interface{} `json:"detail"`
+}
+
+// decisionTrace 记录单个请求的完整决策过程，请求结束时输出一条不受全局日志级别限制的日志
+// nil表示未开启追踪，所有方法都可以在nil上调用
+type decisionTrace struct {
+	path  string
+	start time.Time
+	steps []traceStep
+}
+
+func newDecisionTrace(enabled bool, path string) *decisionTrace {
+	if !enabled {
+		return nil
+	}
+	return &decisionTrace{path: path, start: time.Now()}
+}
+
+// add 记录一个决策步骤
+func (t *decisionTrace) add(step string, detail map[string]interface{}) {
+	if t == nil {
+		return
+	}
+	t.steps = append(t.steps, traceStep{Step: step, Detail: detail})
+}
+
+// finish 输出追踪日志
+func (t *decisionTrace) finish(status int) {
+	if t == nil {
+		return
+	}
+	logger.Trace("请求决策追踪",
+		zap.String("path", t.path),
+		zap.Int("status", status),
+		zap.Duration("elapsed", time.Since(t.start)),
+		zap.Any("steps", t.steps))
+}
+
+// limiterTokens 返回限流器当前的令牌数，未开启追踪时不读取
+func (t *decisionTrace) limiterTokens(rl Allower) interface{} {
+	if t == nil {
+		return nil
+	}
+	return rl.Stats().CurrentTokens
+}
+
+// addShutdown 记录优雅关闭检查的结果
+func (t *decisionTrace) addShutdown(gs RequestTracker, accepted bool) {
+	if t == nil {
+		return
+	}
+	t.add("shutdown", map[string]interface{}{
+		"accepted":        accepted,
+		"status":          gs.Status(),
+		"active_requests": gs.ActiveRequests(),
+	})
+}
+
+// addLimiter 记录限流判断的结果，tokens_before和tokens_after为全局令牌桶的令牌数
+func (t *decisionTrace) addLimiter(rl Allower, verdict limiter.Verdict, cost int64, tokensBefore interface{}) {
+	if t == nil {
+		return
+	}
+	stats := rl.Stats()
+	t.add("limiter", map[string]interface{}{
+		"allowed":       verdict.Allowed,
+		"rule":          verdict.Rule,
+		"action":        verdict.Action,
+		"limited":       verdict.Limited,
+		"enabled":       stats.Enabled,
+		"unit":          stats.Unit,
+		"rate":          stats.Rate,
+		"cost":          cost,
+		"tokens_before": tokensBefore,
+		"tokens_after":  stats.CurrentTokens,
+	})
+}
+
+// addLimiterFailure 记录限流器出错时按失败策略作出的决定
+func (t *decisionTrace) addLimiterFailure(policy string, err error, allowed bool) {
+	if t == nil {
+		return
+	}
+	t.add("limiter", map[string]interface{}{
+		"allowed": allowed,
+		"error":   err.Error(),
+		"policy":  policy,
+	})
+}
+
+// addCounter 记录计数写入的目标槽位
+func (t *decisionTrace) addCounter(target counter.Counter, req CollectRequest, amount int64, dimensions collectDimensions) {
+	if t == nil {
+		return
+	}
+	t.add("counter", map[string]interface{}{
+		"version":    req.Version,
+		"unit":       counter.UnitOf(target),
+		"amount":     amount,
+		"slot":       counter.SlotInfo(target),
+		"tagged":     dimensions.tagged != nil,
+		"keyed":      dimensions.keyed != nil,
+		"key":        req.Key,
+		"attributes": req.Attributes,
+	})
+}
@@ -0,0 +1,191 @@
+package app
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/logger"
+	"go.uber.org/zap"
+)
+
+// Component 有后台协程或需要释放资源的组件
+type Component interface {
+	Stop()
+}
+
+// Module 一个子系统的声明：依赖的模块、是否启用以及如何创建
+type Module struct {
+	Name     string
+	Requires []string                         // 依赖的模块，先于本模块启动，未启用的依赖取得零值
+	Enabled  func(cfg *config.AppConfig) bool // 为nil时总是启用
+	Start    func(c *Container) (any, error)  // 创建组件，需要在关闭时停止的组件通过OnStop登记
+}
+
+// Container 按依赖顺序启动模块，关闭时按登记的相反顺序停止组件
+// 依赖之间没有先后要求的模块按Provide的顺序启动
+type Container struct {
+	cfg *config.AppConfig
+
+	modules map[string]Module
+	order   []string
+	errs    []error
+
+	values  map[string]any
+	current *Module // 正在启动的模块，用于检查是否声明了依赖
+
+	mu      sync.Mutex
+	stops   []Component
+	stopped bool
+}
+
+// New 创建一个容器
+func New(cfg *config.AppConfig) *Container {
+	return &Container{
+		cfg:     cfg,
+		modules: make(map[string]Module),
+		values:  make(map[string]any),
+	}
+}
+
+// Config 返回启动时的配置
+func (c *Container) Config() *config.AppConfig {
+	return c.cfg
+}
+
+// Provide 登记模块，重复的模块名在Start时报错
+func (c *Container) Provide(modules ...Module) {
+	for _, m := range modules {
+		if _, ok := c.modules[m.Name]; ok {
+			c.errs = append(c.errs, fmt.Errorf("模块%s重复登记", m.Name))
+			continue
+		}
+		c.modules[m.Name] = m
+		c.order = append(c.order, m.Name)
+	}
+}
+
+// Start 检查依赖后按顺序启动所有模块，未启用的模块跳过
+// 某个模块启动失败时停止已经启动的组件并返回错误
+func (c *Container) Start() error {
+	if len(c.errs) > 0 {
+		return c.errs[0]
+	}
+	order, err := c.resolve()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range order {
+		m := c.modules[name]
+		if m.Enabled != nil && !m.Enabled(c.cfg) {
+			c.values[name] = nil
+			continue
+		}
+
+		c.current = &m
+		value, err := m.Start(c)
+		c.current = nil
+		if err != nil {
+			c.Stop()
+			return fmt.Errorf("启动模块%s失败: %w", name, err)
+		}
+		c.values[name] = value
+		logger.Debug("模块已启动", zap.String("module", name))
+	}
+	return nil
+}
+
+// resolve 按依赖关系排序模块，依赖不存在或存在循环依赖时返回错误
+func (c *Container) resolve() ([]string, error) {
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[string]int, len(c.modules))
+	order := make([]string, 0, len(c.modules))
+
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case done:
+			return nil
+		case visiting:
+			cycle := append(path[slices.Index(path, name):], name)
+			return fmt.Errorf("模块之间存在循环依赖: %s", strings.Join(cycle, " -> "))
+		}
+
+		state[name] = visiting
+		path = append(path, name)
+		for _, dep := range c.modules[name].Requires {
+			if _, ok := c.modules[dep]; !ok {
+				return fmt.Errorf("模块%s依赖的模块%s不存在", name, dep)
+			}
+			if err := visit(dep, path); err != nil {
+				return err
+			}
+		}
+		state[name] = done
+		order = append(order, name)
+		return nil
+	}
+
+	for _, name := range c.order {
+		if err := visit(name, nil); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// OnStop 登记关闭容器时停止的组件，与defer一样按登记的相反顺序停止
+func (c *Container) OnStop(comp Component) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stops = append(c.stops, comp)
+}
+
+// Stop 按登记的相反顺序停止组件，重复调用时不再停止
+func (c *Container) Stop() {
+	c.mu.Lock()
+	if c.stopped {
+		c.mu.Unlock()
+		return
+	}
+	c.stopped = true
+	stops := c.stops
+	c.stops = nil
+	c.mu.Unlock()
+
+	for _, comp := range slices.Backward(stops) {
+		comp.Stop()
+	}
+}
+
+// Get 返回模块创建的组件，模块未启用时返回零值
+// 模块启动时只能获取Requires中声明的模块，组件类型与T不一致时panic
+func Get[T any](c *Container, name string) T {
+	if c.current != nil && !slices.Contains(c.current.Requires, name) {
+		panic(fmt.Sprintf("模块%s未声明依赖%s", c.current.Name, name))
+	}
+
+	var zero T
+	value, ok := c.values[name]
+	if !ok {
+		if _, declared := c.modules[name]; !declared {
+			panic(fmt.Sprintf("模块%s不存在", name))
+		}
+		return zero
+	}
+	if value == nil {
+		return zero
+	}
+	typed, ok := value.(T)
+	if !ok {
+		panic(fmt.Sprintf("模块%s的组件类型为%T，不是%s", name, value, reflect.TypeFor[T]()))
+	}
+	return typed
+}
@@ -2,6 +2,9 @@ package config
 
 import (
 	"fmt"
+	"net/url"
+	"path"
+	"regexp"
 	"strings"
 	"sync"
 	"time"
@@ -13,8 +16,23 @@ import (
 var (
 	once   sync.Once
 	config *AppConfig
+
+	// reloadHandlers 配置文件变化并通过校验后调用的函数
+	reloadMu       sync.Mutex
+	reloadHandlers []func(*AppConfig)
+	// rejectHandlers 配置文件变化但无法解析或未通过校验时调用的函数
+	rejectHandlers []func(error)
+
+	// labelNamePattern Prometheus标签名的合法格式
+	labelNamePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+	// unitNamePattern 计数单位名称的合法格式
+	unitNamePattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]{0,31}$`)
 )
 
+// maxTagKeys 按标签组合计数时允许声明的标签数量上限
+const maxTagKeys = 8
+
 // AppConfig 应用配置结构体
 type AppConfig struct {
 	Server   ServerConfig   `mapstructure:"server" env:"SERVER"`
@@ -23,6 +41,19 @@ type AppConfig struct {
 	Limiter  LimiterConfig  `mapstructure:"limiter" env:"LIMITER"`
 	Metrics  MetricsConfig  `mapstructure:"metrics" env:"METRICS"`
 	Shutdown ShutdownConfig `mapstructure:"shutdown" env:"SHUTDOWN"`
+	Events   EventsConfig   `mapstructure:"events" env:"EVENTS"`
+	Storage  StorageConfig  `mapstructure:"storage" env:"STORAGE"`
+	Ingest   IngestConfig   `mapstructure:"ingest" env:"INGEST"`
+
+	Replication ReplicationConfig `mapstructure:"replication" env:"REPLICATION"`
+	Recovery    RecoveryConfig    `mapstructure:"recovery" env:"RECOVERY"`
+	Watchdog    WatchdogConfig    `mapstructure:"watchdog" env:"WATCHDOG"`
+	Outbound    OutboundConfig    `mapstructure:"outbound" env:"OUTBOUND"`
+	Scaling     ScalingConfig     `mapstructure:"scaling" env:"SCALING"`
+	Report      ReportConfig      `mapstructure:"report" env:"REPORT"`
+	LoadGen     LoadGenConfig     `mapstructure:"loadgen" env:"LOADGEN"`
+	Snapshot    SnapshotConfig    `mapstructure:"snapshot" env:"SNAPSHOT"`
+	Tenants     TenantsConfig     `mapstructure:"tenants" env:"TENANTS"`
 }
 
 // ServerConfig 服务器配置
@@ -30,15 +61,116 @@ type ServerConfig struct {
 	Port         int           `mapstructure:"port" env:"PORT"`
 	ReadTimeout  time.Duration `mapstructure:"read_timeout" env:"READ_TIMEOUT"`
 	WriteTimeout time.Duration `mapstructure:"write_timeout" env:"WRITE_TIMEOUT"`
-	ServerType   string        `mapstructure:"server_type" env:"SERVER_TYPE"` // 服务器类型："fasthttp" 或 "gin"
+	ServerType   string        `mapstructure:"server_type" env:"SERVER_TYPE"`     // 服务器类型："fasthttp"、"gin" 或 "both"
+	AdminPort    int           `mapstructure:"admin_port" env:"ADMIN_PORT"`       // server_type为both时Gin监听的端口，提供管理、查询和指标接口
+	AdminToken   string        `mapstructure:"admin_token" env:"ADMIN_TOKEN"`     // 管理员令牌，为空时禁用管理功能
+	Role         string        `mapstructure:"role" env:"ROLE"`                   // 实例角色："full"（默认）、"ingest" 只接受上报、"query" 只提供查询
+	QPSPrecision int           `mapstructure:"qps_precision" env:"QPS_PRECISION"` // /v1/qps 和 /rate 返回的速率保留的小数位数，0表示默认的2位
+	RateUnit     string        `mapstructure:"rate_unit" env:"RATE_UNIT"`         // /v1/qps 和 /rate 返回的速率的时间单位：second（默认）、minute、hour
+	CacheMaxAge  time.Duration `mapstructure:"cache_max_age" env:"CACHE_MAX_AGE"` // /qps、/stats 和 /qps/history 响应的Cache-Control max-age，0表示no-cache
 }
 
 // CounterConfig 计数器配置
 type CounterConfig struct {
-	Type       string        `mapstructure:"type" env:"TYPE"`
-	WindowSize time.Duration `mapstructure:"window_size" env:"WINDOW_SIZE"`
-	SlotNum    int           `mapstructure:"slot_num" env:"SLOT_NUM"`
-	Precision  time.Duration `mapstructure:"precision" env:"PRECISION"`
+	Type        string          `mapstructure:"type" env:"TYPE"`               // lockfree、sharded、shared、sketch或decay
+	SharedPath  string          `mapstructure:"shared_path" env:"SHARED_PATH"` // type为shared时的共享内存文件，默认为/dev/shm/qps-counter
+	WindowSize  time.Duration   `mapstructure:"window_size" env:"WINDOW_SIZE"`
+	Windows     []time.Duration `mapstructure:"windows"` // 同时统计的附加时间窗口，如 [1s, 10s, 1m, 5m]，/qps 返回每个窗口的QPS
+	SlotNum     int             `mapstructure:"slot_num" env:"SLOT_NUM"`
+	Precision   time.Duration   `mapstructure:"precision" env:"PRECISION"`
+	Alignment   string          `mapstructure:"alignment" env:"ALIGNMENT"` // 窗口对齐方式：sliding（默认，连续滑动）或wall（对齐到window_size的整数倍）
+	Unit        string          `mapstructure:"unit" env:"UNIT"`           // 计数单位：events、requests、bytes或自定义名称
+	Trend       TrendConfig     `mapstructure:"trend" env:"TREND"`
+	Tags        TagsConfig      `mapstructure:"tags" env:"TAGS"`
+	Keys        KeysConfig      `mapstructure:"keys" env:"KEYS"`
+	History     HistoryConfig   `mapstructure:"history" env:"HISTORY"`
+	Adaptive    AdaptiveConfig  `mapstructure:"adaptive" env:"ADAPTIVE"`
+	Latency     LatencyConfig   `mapstructure:"latency" env:"LATENCY"`
+	Histogram   string          `mapstructure:"histogram" env:"HISTOGRAM"`       // 延迟直方图的桶划分：log（默认）或hdr
+	MaxNamed    int             `mapstructure:"max_named" env:"MAX_NAMED"`       // 通过API创建的命名计数器数量上限
+	DeleteGrace time.Duration   `mapstructure:"delete_grace" env:"DELETE_GRACE"` // 删除命名计数器后的保留期，期间可查询和恢复但不接受上报，0表示立即清除
+	Idle        IdleConfig      `mapstructure:"idle" env:"IDLE"`
+	Clients     ClientsConfig   `mapstructure:"clients" env:"CLIENTS"`
+	Verify      VerifyConfig    `mapstructure:"verify" env:"VERIFY"`
+	Weighted    WeightedConfig  `mapstructure:"weighted" env:"WEIGHTED"`
+}
+
+// WeightedConfig 加权计数配置，上报数据中的weight计入与全局计数器窗口相同的滑动窗口，得到与QPS并行的加权速率
+type WeightedConfig struct {
+	Enabled bool   `mapstructure:"enabled" env:"ENABLED"`
+	Unit    string `mapstructure:"unit" env:"UNIT"` // 权重的单位，如bytes、cost，默认为units
+}
+
+// VerifyConfig 计数校验配置，用于排查计数器是否丢失计数，会增加每次计数的开销，只在排查问题时启用
+type VerifyConfig struct {
+	Enabled bool `mapstructure:"enabled" env:"ENABLED"`
+}
+
+// ClientsConfig 调用方统计配置，按User-Agent、API Key和来源IP前缀统计窗口内的请求速率
+type ClientsConfig struct {
+	Enabled      bool   `mapstructure:"enabled" env:"ENABLED"`
+	MaxTracked   int    `mapstructure:"max_tracked" env:"MAX_TRACKED"`       // 每个维度跟踪的调用方数量上限
+	TopN         int    `mapstructure:"top_n" env:"TOP_N"`                   // /clients默认返回的调用方数量
+	APIKeyHeader string `mapstructure:"api_key_header" env:"API_KEY_HEADER"` // 携带API Key的请求头，默认为X-API-Key
+	IPv4Prefix   int    `mapstructure:"ipv4_prefix" env:"IPV4_PREFIX"`       // IPv4地址归并的前缀长度，默认为24
+	IPv6Prefix   int    `mapstructure:"ipv6_prefix" env:"IPV6_PREFIX"`       // IPv6地址归并的前缀长度，默认为48
+}
+
+// IdleConfig 空闲节能配置
+type IdleConfig struct {
+	Enabled bool          `mapstructure:"enabled" env:"ENABLED"`
+	Timeout time.Duration `mapstructure:"timeout" env:"TIMEOUT"` // 无事件持续该时长后暂停后台协程
+}
+
+// TagsConfig 按标签组合计数的配置，keys为空时不启用
+type TagsConfig struct {
+	Keys      []string `mapstructure:"keys"`                        // 参与计数的标签名，如 route、method、status
+	MaxSeries int      `mapstructure:"max_series" env:"MAX_SERIES"` // 标签组合数量上限
+}
+
+// KeysConfig 按上报数据中的key（如接口名、租户）分别计数的配置
+type KeysConfig struct {
+	Enabled     bool          `mapstructure:"enabled" env:"ENABLED"`
+	MaxKeys     int           `mapstructure:"max_keys" env:"MAX_KEYS"`         // 跟踪的key数量上限，默认为1000；counter.type为sketch时为列出的候选key数量
+	SketchWidth int           `mapstructure:"sketch_width" env:"SKETCH_WIDTH"` // counter.type为sketch时每行的计数器数量，默认为2048
+	SketchDepth int           `mapstructure:"sketch_depth" env:"SKETCH_DEPTH"` // counter.type为sketch时的行数（哈希函数数量），默认为4
+	IdleTTL     time.Duration `mapstructure:"idle_ttl" env:"IDLE_TTL"`         // 超过该时长没有写入的key被清理，0表示不清理；sketch模式下不生效
+}
+
+// HistoryConfig QPS历史记录配置，每秒采样一次QPS保存在内存中
+type HistoryConfig struct {
+	Enabled   bool          `mapstructure:"enabled" env:"ENABLED"`
+	Retention time.Duration `mapstructure:"retention" env:"RETENTION"` // 保留时长，默认为1h
+}
+
+// LatencyConfig 请求延迟统计配置，上报数据中的latency_ms计入滑动窗口直方图
+type LatencyConfig struct {
+	Enabled   bool          `mapstructure:"enabled" env:"ENABLED"`
+	Window    time.Duration `mapstructure:"window" env:"WINDOW"`         // 统计窗口，默认为1m
+	PerKey    bool          `mapstructure:"per_key" env:"PER_KEY"`       // 按上报数据中的key分别统计延迟
+	PerTag    bool          `mapstructure:"per_tag" env:"PER_TAG"`       // 按counter.tags.keys声明的标签组合分别统计延迟
+	MaxSeries int           `mapstructure:"max_series" env:"MAX_SERIES"` // 按key和标签组合统计的直方图总数上限，默认为100
+}
+
+// AdaptiveConfig 自适应分片配置，修改后通过配置重新加载生效
+type AdaptiveConfig struct {
+	Enabled               bool          `mapstructure:"enabled" env:"ENABLED"`
+	MinShards             int           `mapstructure:"min_shards" env:"MIN_SHARDS"`                         // 最小分片数，默认为CPU核心数
+	MaxShards             int           `mapstructure:"max_shards" env:"MAX_SHARDS"`                         // 最大分片数，默认为CPU核心数的8倍
+	Interval              time.Duration `mapstructure:"interval" env:"INTERVAL"`                             // 调整间隔，默认为10s
+	ChangeThreshold       float64       `mapstructure:"change_threshold" env:"CHANGE_THRESHOLD"`             // 触发调整的QPS变化率，默认为0.3
+	MemoryThreshold       ByteSize      `mapstructure:"memory_threshold" env:"MEMORY_THRESHOLD"`             // 堆内存阈值（字节，可写成 "1GiB"），超过时减少到最小分片数，默认为1GB
+	PressureThreshold     float64       `mapstructure:"pressure_threshold" env:"PRESSURE_THRESHOLD"`         // PSI压力阈值（最近10秒的等待时间百分比），默认为20
+	AccelerationThreshold float64       `mapstructure:"acceleration_threshold" env:"ACCELERATION_THRESHOLD"` // QPS每秒增长超过当前QPS的该比例时提前增加分片，0表示只按change_threshold调整
+	QPSWeight             float64       `mapstructure:"qps_weight" env:"QPS_WEIGHT"`                         // 综合评分中QPS因素的权重，默认为0.6
+	MemoryWeight          float64       `mapstructure:"memory_weight" env:"MEMORY_WEIGHT"`                   // 综合评分中内存因素的权重，默认为0.4
+}
+
+// TrendConfig QPS平滑趋势配置
+type TrendConfig struct {
+	Alpha              float64       `mapstructure:"alpha" env:"ALPHA"`                             // EWMA平滑系数，取值 (0, 1]
+	Interval           time.Duration `mapstructure:"interval" env:"INTERVAL"`                       // 采样间隔
+	AccelerationWindow time.Duration `mapstructure:"acceleration_window" env:"ACCELERATION_WINDOW"` // 计算QPS加速度使用的最近采样的时间范围，默认为10s
 }
 
 // LoggerConfig 日志配置
@@ -53,23 +185,286 @@ type LoggerConfig struct {
 
 // LimiterConfig 限流器配置
 type LimiterConfig struct {
-	Enabled  bool  `mapstructure:"enabled" env:"ENABLED"`
-	Rate     int64 `mapstructure:"rate" env:"RATE"`
-	Burst    int64 `mapstructure:"burst" env:"BURST"`
-	Adaptive bool  `mapstructure:"adaptive" env:"ADAPTIVE"`
+	Enabled  bool   `mapstructure:"enabled" env:"ENABLED"`
+	Rate     int64  `mapstructure:"rate" env:"RATE"`
+	Burst    int64  `mapstructure:"burst" env:"BURST"`
+	Adaptive bool   `mapstructure:"adaptive" env:"ADAPTIVE"`
+	Unit     string `mapstructure:"unit" env:"UNIT"` // 限流单位：requests（默认）或bytes，bytes时rate和burst为字节数
+
+	DefaultCost int64 `mapstructure:"default_cost" env:"DEFAULT_COST"` // 请求未声明cost时消耗的令牌数，默认为1
+	MaxCost     int64 `mapstructure:"max_cost" env:"MAX_COST"`         // 单个请求允许声明的最大cost，默认为100
+
+	Schedules []LimiterScheduleConfig `mapstructure:"schedules"` // 按时间段切换的限流配置，按顺序匹配第一个生效的时间段
+	Rules     []LimiterRuleConfig     `mapstructure:"rules"`     // 按顺序匹配的限流规则，未匹配任何规则的请求使用上面的全局配置
+
+	KeyHeader    string               `mapstructure:"key_header" env:"KEY_HEADER"`       // 携带API Key的请求头，默认为X-API-Key
+	TenantHeader string               `mapstructure:"tenant_header" env:"TENANT_HEADER"` // 携带租户标识的请求头，默认为X-Tenant-ID
+	Failure      LimiterFailureConfig `mapstructure:"failure" env:"FAILURE"`
+	Decisions    DecisionLogConfig    `mapstructure:"decisions" env:"DECISIONS"`
+	Script       LimiterScriptConfig  `mapstructure:"script" env:"SCRIPT"`
+	Auto         LimiterAutoConfig    `mapstructure:"auto" env:"AUTO"`
+}
+
+// LimiterAutoConfig 按全局QPS自动启停限流器的配置，启用后限流器的启用状态由QPS决定，enabled只作为启动时的初始状态
+type LimiterAutoConfig struct {
+	Enabled      bool          `mapstructure:"enabled" env:"ENABLED"`
+	Threshold    int64         `mapstructure:"threshold" env:"THRESHOLD"`         // QPS超过该值时视为高流量
+	EnableAfter  time.Duration `mapstructure:"enable_after" env:"ENABLE_AFTER"`   // QPS持续超过阈值多久后启用限流器，默认为10s
+	DisableAfter time.Duration `mapstructure:"disable_after" env:"DISABLE_AFTER"` // QPS持续不超过阈值多久后停用限流器，默认为5m
+}
+
+// LimiterScriptConfig 限流脚本配置，每个请求执行一次脚本中的decide函数，可以直接放行、拒绝或修改令牌消耗
+// 用于限流规则无法表达的特殊情况；脚本使用Starlark，不能访问文件和网络，每次执行受超时和步数限制
+type LimiterScriptConfig struct {
+	Enabled  bool          `mapstructure:"enabled" env:"ENABLED"`
+	Source   string        `mapstructure:"source" env:"SOURCE"`       // 内联的脚本，与file二选一
+	File     string        `mapstructure:"file" env:"FILE"`           // 脚本文件
+	Timeout  time.Duration `mapstructure:"timeout" env:"TIMEOUT"`     // 每次执行的超时，默认为5ms
+	MaxSteps uint64        `mapstructure:"max_steps" env:"MAX_STEPS"` // 每次执行的最大步数，默认为100000
+}
+
+// DecisionLogConfig 限流决策日志配置，记录所有拒绝和按比例抽样的放行，供离线分析限流模式
+type DecisionLogConfig struct {
+	Enabled       bool          `mapstructure:"enabled" env:"ENABLED"`
+	Sink          string        `mapstructure:"sink" env:"SINK"`                     // file或http，Kafka可以通过REST代理使用http
+	Path          string        `mapstructure:"path" env:"PATH"`                     // file时写入的文件，每行一条JSON
+	URL           string        `mapstructure:"url" env:"URL"`                       // http时POST的地址，请求体为JSON数组
+	SampleRate    float64       `mapstructure:"sample_rate" env:"SAMPLE_RATE"`       // 放行决策的抽样比例，0到1，默认为0只记录拒绝
+	QueueSize     int           `mapstructure:"queue_size" env:"QUEUE_SIZE"`         // 等待写入的决策数上限，默认为10000，超出时丢弃
+	BatchSize     int           `mapstructure:"batch_size" env:"BATCH_SIZE"`         // 每次写入的最大决策数，默认为500
+	FlushInterval time.Duration `mapstructure:"flush_interval" env:"FLUSH_INTERVAL"` // 写入间隔，默认为1s
+}
+
+// LimiterRuleConfig 一条限流规则，match中所有非空条件都满足时匹配
+type LimiterRuleConfig struct {
+	Name      string                 `mapstructure:"name"`
+	Match     LimiterRuleMatchConfig `mapstructure:"match"`
+	Algorithm string                 `mapstructure:"algorithm"` // token_bucket（默认）或fixed_window
+	Rate      int64                  `mapstructure:"rate"`
+	Burst     int64                  `mapstructure:"burst"`  // token_bucket的突发容量，为0时等于rate
+	Action    string                 `mapstructure:"action"` // reject（默认）、shadow、allow或deny
+}
+
+// LimiterRuleMatchConfig 限流规则的匹配条件
+type LimiterRuleMatchConfig struct {
+	Path    string            `mapstructure:"path"`    // 路径前缀
+	Method  string            `mapstructure:"method"`  // 不区分大小写
+	Key     string            `mapstructure:"key"`     // API Key的通配符模式，如 partner-*
+	Tenant  string            `mapstructure:"tenant"`  // 租户标识
+	Headers map[string]string `mapstructure:"headers"` // 请求头必须等于给定值
+}
+
+// LimiterFailureConfig 限流器自身出错时的处理策略，open为放行，closed为拒绝
+type LimiterFailureConfig struct {
+	Default string            `mapstructure:"default" env:"DEFAULT"` // 未匹配任何路由时的策略，默认为open
+	Routes  map[string]string `mapstructure:"routes"`                // 按路径前缀指定策略，最长前缀优先；/admin/默认为closed
+}
+
+// LimiterScheduleConfig 按时间段生效的限流配置
+type LimiterScheduleConfig struct {
+	Name  string   `mapstructure:"name"`
+	Days  []string `mapstructure:"days"`  // 生效的星期（mon、tue、wed、thu、fri、sat、sun），为空时每天生效
+	Start string   `mapstructure:"start"` // 开始时间，格式为HH:MM
+	End   string   `mapstructure:"end"`   // 结束时间，早于开始时间时跨越午夜，与开始时间相同时全天生效
+	Rate  int64    `mapstructure:"rate"`
+	Burst int64    `mapstructure:"burst"` // 为0时使用limiter.burst
 }
 
 // MetricsConfig 指标收集配置
 type MetricsConfig struct {
-	Enabled  bool          `mapstructure:"enabled" env:"ENABLED"`
-	Interval time.Duration `mapstructure:"interval" env:"INTERVAL"`
-	Endpoint string        `mapstructure:"endpoint" env:"ENDPOINT"`
+	Enabled  bool              `mapstructure:"enabled" env:"ENABLED"`
+	Interval time.Duration     `mapstructure:"interval" env:"INTERVAL"`
+	Endpoint string            `mapstructure:"endpoint" env:"ENDPOINT"`
+	Labels   map[string]string `mapstructure:"labels"` // 附加到所有指标的常量标签，值支持 ${ENV} 引用环境变量
 }
 
 // ShutdownConfig 优雅关闭配置
 type ShutdownConfig struct {
-	Timeout time.Duration `mapstructure:"timeout" env:"TIMEOUT"`
-	MaxWait time.Duration `mapstructure:"max_wait" env:"MAX_WAIT"`
+	Timeout time.Duration        `mapstructure:"timeout" env:"TIMEOUT"`
+	MaxWait time.Duration        `mapstructure:"max_wait" env:"MAX_WAIT"`
+	Policy  ShutdownPolicyConfig `mapstructure:"policy" env:"POLICY"`
+}
+
+// ShutdownPolicyConfig 关闭期间各类请求的处理策略，accept为继续接受，reject为返回503
+type ShutdownPolicyConfig struct {
+	Read  string `mapstructure:"read" env:"READ"`   // 查询和统计接口，默认为accept
+	Write string `mapstructure:"write" env:"WRITE"` // 上报接口，默认为reject
+}
+
+// EventsConfig 事件钩子配置
+type EventsConfig struct {
+	Enabled   bool            `mapstructure:"enabled" env:"ENABLED"`
+	QueueSize int             `mapstructure:"queue_size" env:"QUEUE_SIZE"` // 事件队列长度
+	Webhooks  []WebhookConfig `mapstructure:"webhooks"`
+	Burst     BurstConfig     `mapstructure:"burst" env:"BURST"`
+
+	// HealthInterval 检查组件健康状态的间隔，整体状态离开或回到healthy时发布事件，默认5s
+	HealthInterval time.Duration `mapstructure:"health_interval" env:"HEALTH_INTERVAL"`
+}
+
+// WebhookConfig 事件Webhook配置
+type WebhookConfig struct {
+	URL     string        `mapstructure:"url"`
+	Events  []string      `mapstructure:"events"` // 需要投递的事件类型，为空时投递所有事件
+	Timeout time.Duration `mapstructure:"timeout"`
+	Secret  string        `mapstructure:"secret"` // 签名密钥，不为空时请求头携带请求体的HMAC-SHA256签名
+}
+
+// BurstConfig 流量突增检测配置
+type BurstConfig struct {
+	Enabled    bool          `mapstructure:"enabled" env:"ENABLED"`
+	Interval   time.Duration `mapstructure:"interval" env:"INTERVAL"` // 采样间隔
+	Ratio      float64       `mapstructure:"ratio" env:"RATIO"`       // QPS超过基线的倍数时判定为突增
+	MinQPS     int64         `mapstructure:"min_qps" env:"MIN_QPS"`   // 判定突增的最小QPS，避免低流量时误报
+	Alpha      float64       `mapstructure:"alpha" env:"ALPHA"`       // 基线QPS的EWMA平滑系数
+	Thresholds []int64       `mapstructure:"thresholds"`              // QPS跨越这些阈值时发布事件
+}
+
+// StorageConfig 持久化存储配置
+type StorageConfig struct {
+	Path string `mapstructure:"path" env:"PATH"` // 存储目录，为空时仅保存在内存中
+}
+
+// IngestConfig 采集工作池配置，UDP、Kafka等数据源共享该工作池
+type IngestConfig struct {
+	Enabled   bool   `mapstructure:"enabled" env:"ENABLED"`
+	Workers   int    `mapstructure:"workers" env:"WORKERS"`       // 工作协程数量，默认为CPU核心数
+	QueueSize int    `mapstructure:"queue_size" env:"QUEUE_SIZE"` // 队列长度
+	Overflow  string `mapstructure:"overflow" env:"OVERFLOW"`     // 队列已满时的策略：block、drop_oldest、drop_newest
+	PauseMode string `mapstructure:"pause_mode" env:"PAUSE_MODE"` // 采集暂停期间HTTP上报的处理方式：reject（返回503）或drop（返回成功但不计数）
+
+	Duplicates DuplicatesConfig `mapstructure:"duplicates" env:"DUPLICATES"`
+	Signing    SigningConfig    `mapstructure:"signing" env:"SIGNING"`
+	Pipelines  []PipelineConfig `mapstructure:"pipelines"` // 采集管道，每条管道从一个数据源读取事件，经解码、归一化、采样和补充标签后提交到工作池
+}
+
+// PipelineConfig 一条采集管道：source -> decode -> normalize -> enrich -> count
+type PipelineConfig struct {
+	Name       string            `mapstructure:"name"`        // 管道名称，作为事件来源和指标的pipeline标签
+	Source     string            `mapstructure:"source"`      // 数据源：udp（每个数据报一行或多行）或tail（跟踪日志文件新增的行）
+	Address    string            `mapstructure:"address"`     // udp的监听地址，如 :8125
+	Path       string            `mapstructure:"path"`        // tail跟踪的文件路径
+	Format     string            `mapstructure:"format"`      // 每行的格式：json（默认，与/collect的v2格式相同）或line（整行为key，计数为1）
+	Key        PipelineKeyConfig `mapstructure:"key"`         // key的归一化
+	SampleRate float64           `mapstructure:"sample_rate"` // 采样比例(0, 1]，保留的事件按1/sample_rate放大计数，0表示不采样
+	Attributes map[string]string `mapstructure:"attributes"`  // 为每个事件补充的标签，与事件自带的同名标签冲突时以事件为准
+}
+
+// PipelineKeyConfig 采集管道的key归一化
+type PipelineKeyConfig struct {
+	Lowercase  bool `mapstructure:"lowercase"`   // 转为小写
+	StripQuery bool `mapstructure:"strip_query"` // 去掉第一个?之后的部分，key为请求路径时避免查询参数造成基数膨胀
+	MaxLength  int  `mapstructure:"max_length"`  // 超出时截断，0表示256，与/collect的key长度上限相同
+}
+
+// SigningConfig 上报签名配置，启用后上报请求必须携带代理密钥的HMAC签名、时间戳和nonce，
+// 防止不可信网段中伪造或重放的上报抬高计数
+type SigningConfig struct {
+	Enabled     bool          `mapstructure:"enabled" env:"ENABLED"`
+	AgentHeader string        `mapstructure:"agent_header" env:"AGENT_HEADER"` // 标识上报代理的请求头，默认X-Agent-ID
+	MaxSkew     time.Duration `mapstructure:"max_skew" env:"MAX_SKEW"`         // 时间戳与服务器时间允许的最大偏差，默认5m
+	MaxNonces   int           `mapstructure:"max_nonces" env:"MAX_NONCES"`     // 记录的nonce数量上限，默认100000，已满时拒绝上报
+	Agents      []AgentSecret `mapstructure:"agents"`                          // 每个代理的共享密钥
+}
+
+// AgentSecret 一个上报代理的共享密钥
+type AgentSecret struct {
+	Agent  string `mapstructure:"agent"`
+	Secret string `mapstructure:"secret"`
+}
+
+// DuplicatesConfig 重复上报检测配置，用于发现同一主机上多个sidecar代理重复上报相同流量
+type DuplicatesConfig struct {
+	Enabled      bool          `mapstructure:"enabled" env:"ENABLED"`
+	Action       string        `mapstructure:"action" env:"ACTION"`               // flag（默认，只在/diagnostics中标记）或merge（重复的上报流不再计数）
+	SourceHeader string        `mapstructure:"source_header" env:"SOURCE_HEADER"` // 标识上报代理的请求头，默认X-Agent-ID，未携带时使用来源IP
+	Reports      int           `mapstructure:"reports" env:"REPORTS"`             // 比较的连续上报次数，默认6
+	MaxKeys      int           `mapstructure:"max_keys" env:"MAX_KEYS"`           // 跟踪的key数量上限，默认1000
+	IdleTimeout  time.Duration `mapstructure:"idle_timeout" env:"IDLE_TIMEOUT"`   // 超过该时长没有上报的上报流不再跟踪，默认5m
+}
+
+// ReplicationConfig 增量复制配置
+// 上报节点（full或ingest角色）发布增量流，query角色的只读副本订阅leaders中的上报节点
+type ReplicationConfig struct {
+	Enabled  bool          `mapstructure:"enabled" env:"ENABLED"`
+	Interval time.Duration `mapstructure:"interval" env:"INTERVAL"` // 增量汇总间隔，默认100ms
+	Leaders  []string      `mapstructure:"leaders"`                 // 只读副本订阅的上报节点地址，如 http://ingest-0:8080
+}
+
+// RecoveryConfig panic处理配置，作用于HTTP服务器和所有后台协程
+type RecoveryConfig struct {
+	DumpDir            string `mapstructure:"dump_dir" env:"DUMP_DIR"`                           // 崩溃转储目录，为空时不写入转储文件
+	MaxPanicsPerMinute int    `mapstructure:"max_panics_per_minute" env:"MAX_PANICS_PER_MINUTE"` // 一分钟内panic次数达到该值时受控关闭服务，0表示不关闭
+}
+
+// WatchdogConfig 后台协程看门狗配置，检测卡住的清理、指标采集等循环
+type WatchdogConfig struct {
+	Enabled   bool          `mapstructure:"enabled" env:"ENABLED"`
+	Interval  time.Duration `mapstructure:"interval" env:"INTERVAL"`   // 检查间隔，默认10s
+	Threshold time.Duration `mapstructure:"threshold" env:"THRESHOLD"` // 协程超过执行间隔加该时间没有执行时视为卡住，默认30s
+	Restart   bool          `mapstructure:"restart" env:"RESTART"`     // 发现卡住时在新协程中重新运行循环，卡住的协程无法被终止
+}
+
+// ScalingConfig 扩缩容建议配置，未配置的参数使用默认值
+type ScalingConfig struct {
+	Enabled           bool          `mapstructure:"enabled" env:"ENABLED"`
+	Interval          time.Duration `mapstructure:"interval" env:"INTERVAL"`                     // 采样限流拒绝数和CPU使用率的间隔，默认10s
+	Replicas          int           `mapstructure:"replicas" env:"REPLICAS"`                     // 当前副本数，请求可以通过replicas参数覆盖，默认1
+	CapacityQPS       int64         `mapstructure:"capacity_qps" env:"CAPACITY_QPS"`             // 单个副本能承受的QPS，为0时使用限流速率
+	TargetUtilization float64       `mapstructure:"target_utilization" env:"TARGET_UTILIZATION"` // 单个副本的目标负载比例，默认0.7
+	Horizon           time.Duration `mapstructure:"horizon" env:"HORIZON"`                       // 按QPS趋势预测的时长，默认5m
+	CPUThreshold      float64       `mapstructure:"cpu_threshold" env:"CPU_THRESHOLD"`           // CPU使用率（百分比）超过该值时建议扩容，默认80
+	MaxRejectRate     float64       `mapstructure:"max_reject_rate" env:"MAX_REJECT_RATE"`       // 限流拒绝比例超过该值时建议扩容，默认0.01
+}
+
+// ReportConfig 流量报告配置，按日或按周生成报告并投递到Webhook或邮件网关
+type ReportConfig struct {
+	Enabled        bool          `mapstructure:"enabled" env:"ENABLED"`
+	Period         string        `mapstructure:"period" env:"PERIOD"`                   // daily（默认）或weekly
+	At             string        `mapstructure:"at" env:"AT"`                           // 生成报告的时间，格式为HH:MM，默认00:00
+	Weekday        string        `mapstructure:"weekday" env:"WEEKDAY"`                 // 按周生成时的星期（mon、tue等），默认mon
+	SampleInterval time.Duration `mapstructure:"sample_interval" env:"SAMPLE_INTERVAL"` // QPS采样间隔，默认10s
+	TopKeys        int           `mapstructure:"top_keys" env:"TOP_KEYS"`               // 报告中列出的最繁忙标签组合数量，默认10
+	Webhooks       []string      `mapstructure:"webhooks"`                              // 报告以JSON格式POST到这些地址，邮件网关的HTTP接口同样适用
+	Timeout        time.Duration `mapstructure:"timeout" env:"TIMEOUT"`                 // 每次投递的超时时间，默认10s
+}
+
+// LoadGenConfig 内置压测（/admin/loadgen）的上限，未配置的参数使用默认值
+type LoadGenConfig struct {
+	MaxRate     int64         `mapstructure:"max_rate" env:"MAX_RATE"`         // 允许的最大速率（次/秒），默认100000
+	MaxDuration time.Duration `mapstructure:"max_duration" env:"MAX_DURATION"` // 单次压测的最长时间，默认10m
+}
+
+// SnapshotConfig 计数器快照配置，定期把窗口槽位、按key计数和QPS历史写入磁盘，重启时恢复
+type SnapshotConfig struct {
+	Enabled  bool          `mapstructure:"enabled" env:"ENABLED"`
+	Path     string        `mapstructure:"path" env:"PATH"`         // 快照目录，为空时使用storage.path
+	Interval time.Duration `mapstructure:"interval" env:"INTERVAL"` // 写入间隔，默认10s
+}
+
+// TenantsConfig 按租户分区的计数和QPS历史，启用后查询接口按认证的身份限定可见的数据
+type TenantsConfig struct {
+	Enabled    bool          `mapstructure:"enabled" env:"ENABLED"`
+	Header     string        `mapstructure:"header" env:"HEADER"`           // 上报时携带租户标识的请求头，默认X-Tenant-ID
+	MaxTenants int           `mapstructure:"max_tenants" env:"MAX_TENANTS"` // 租户数量上限，默认100
+	Retention  time.Duration `mapstructure:"retention" env:"RETENTION"`     // 每个租户QPS历史的保留时长，默认1h
+	Tokens     []TenantToken `mapstructure:"tokens"`                        // 租户的查询令牌，只能查询本租户的数据
+}
+
+// TenantToken 一个租户的查询令牌
+type TenantToken struct {
+	Tenant string `mapstructure:"tenant"`
+	Token  string `mapstructure:"token"`
+}
+
+// OutboundConfig 出站HTTP请求（事件Webhook、流量报告和限流决策投递、增量复制订阅）的重试和熔断配置，未配置的参数使用默认值
+type OutboundConfig struct {
+	MaxRetries       int           `mapstructure:"max_retries" env:"MAX_RETRIES"`             // 单个请求的最大重试次数，默认2，-1表示不重试
+	BaseBackoff      time.Duration `mapstructure:"base_backoff" env:"BASE_BACKOFF"`           // 第一次重试前的等待时间，之后按指数增长并加入随机抖动，默认100ms
+	MaxBackoff       time.Duration `mapstructure:"max_backoff" env:"MAX_BACKOFF"`             // 重试等待时间的上限，默认2s
+	RetryBudget      float64       `mapstructure:"retry_budget" env:"RETRY_BUDGET"`           // 每个请求增加的重试机会，即重试次数与请求数之比的上限，默认0.2
+	FailureThreshold int           `mapstructure:"failure_threshold" env:"FAILURE_THRESHOLD"` // 对同一目标地址连续失败该次数后熔断，默认5
+	OpenTimeout      time.Duration `mapstructure:"open_timeout" env:"OPEN_TIMEOUT"`           // 熔断后经过该时间放行一个探测请求，默认30s
 }
 
 // Load 加载配置
@@ -100,12 +495,61 @@ func Load(configPath string) (*AppConfig, error) {
 	v.BindEnv("server.read_timeout", "QPS_SERVER_READ_TIMEOUT")
 	v.BindEnv("server.write_timeout", "QPS_SERVER_WRITE_TIMEOUT")
 	v.BindEnv("server.server_type", "QPS_SERVER_SERVER_TYPE")
+	v.BindEnv("server.admin_port", "QPS_SERVER_ADMIN_PORT")
+	v.BindEnv("server.admin_token", "QPS_SERVER_ADMIN_TOKEN")
+	v.BindEnv("server.role", "QPS_SERVER_ROLE")
+	v.BindEnv("server.qps_precision", "QPS_SERVER_QPS_PRECISION")
+	v.BindEnv("server.rate_unit", "QPS_SERVER_RATE_UNIT")
+	v.BindEnv("server.cache_max_age", "QPS_SERVER_CACHE_MAX_AGE")
 
 	// 计数器配置
 	v.BindEnv("counter.type", "QPS_COUNTER_TYPE")
+	v.BindEnv("counter.shared_path", "QPS_COUNTER_SHARED_PATH")
 	v.BindEnv("counter.window_size", "QPS_COUNTER_WINDOW_SIZE")
 	v.BindEnv("counter.slot_num", "QPS_COUNTER_SLOT_NUM")
 	v.BindEnv("counter.precision", "QPS_COUNTER_PRECISION")
+	v.BindEnv("counter.unit", "QPS_COUNTER_UNIT")
+	v.BindEnv("counter.alignment", "QPS_COUNTER_ALIGNMENT")
+	v.BindEnv("counter.trend.alpha", "QPS_COUNTER_TREND_ALPHA")
+	v.BindEnv("counter.trend.interval", "QPS_COUNTER_TREND_INTERVAL")
+	v.BindEnv("counter.trend.acceleration_window", "QPS_COUNTER_TREND_ACCELERATION_WINDOW")
+	v.BindEnv("counter.tags.max_series", "QPS_COUNTER_TAGS_MAX_SERIES")
+	v.BindEnv("counter.keys.enabled", "QPS_COUNTER_KEYS_ENABLED")
+	v.BindEnv("counter.keys.max_keys", "QPS_COUNTER_KEYS_MAX_KEYS")
+	v.BindEnv("counter.keys.sketch_width", "QPS_COUNTER_KEYS_SKETCH_WIDTH")
+	v.BindEnv("counter.keys.sketch_depth", "QPS_COUNTER_KEYS_SKETCH_DEPTH")
+	v.BindEnv("counter.keys.idle_ttl", "QPS_COUNTER_KEYS_IDLE_TTL")
+	v.BindEnv("counter.history.enabled", "QPS_COUNTER_HISTORY_ENABLED")
+	v.BindEnv("counter.history.retention", "QPS_COUNTER_HISTORY_RETENTION")
+	v.BindEnv("counter.latency.enabled", "QPS_COUNTER_LATENCY_ENABLED")
+	v.BindEnv("counter.latency.window", "QPS_COUNTER_LATENCY_WINDOW")
+	v.BindEnv("counter.latency.per_key", "QPS_COUNTER_LATENCY_PER_KEY")
+	v.BindEnv("counter.latency.per_tag", "QPS_COUNTER_LATENCY_PER_TAG")
+	v.BindEnv("counter.latency.max_series", "QPS_COUNTER_LATENCY_MAX_SERIES")
+	v.BindEnv("counter.histogram", "QPS_COUNTER_HISTOGRAM")
+	v.BindEnv("counter.adaptive.enabled", "QPS_COUNTER_ADAPTIVE_ENABLED")
+	v.BindEnv("counter.adaptive.min_shards", "QPS_COUNTER_ADAPTIVE_MIN_SHARDS")
+	v.BindEnv("counter.adaptive.max_shards", "QPS_COUNTER_ADAPTIVE_MAX_SHARDS")
+	v.BindEnv("counter.adaptive.interval", "QPS_COUNTER_ADAPTIVE_INTERVAL")
+	v.BindEnv("counter.adaptive.change_threshold", "QPS_COUNTER_ADAPTIVE_CHANGE_THRESHOLD")
+	v.BindEnv("counter.adaptive.memory_threshold", "QPS_COUNTER_ADAPTIVE_MEMORY_THRESHOLD")
+	v.BindEnv("counter.adaptive.pressure_threshold", "QPS_COUNTER_ADAPTIVE_PRESSURE_THRESHOLD")
+	v.BindEnv("counter.adaptive.acceleration_threshold", "QPS_COUNTER_ADAPTIVE_ACCELERATION_THRESHOLD")
+	v.BindEnv("counter.adaptive.qps_weight", "QPS_COUNTER_ADAPTIVE_QPS_WEIGHT")
+	v.BindEnv("counter.adaptive.memory_weight", "QPS_COUNTER_ADAPTIVE_MEMORY_WEIGHT")
+	v.BindEnv("counter.max_named", "QPS_COUNTER_MAX_NAMED")
+	v.BindEnv("counter.delete_grace", "QPS_COUNTER_DELETE_GRACE")
+	v.BindEnv("counter.idle.enabled", "QPS_COUNTER_IDLE_ENABLED")
+	v.BindEnv("counter.idle.timeout", "QPS_COUNTER_IDLE_TIMEOUT")
+	v.BindEnv("counter.verify.enabled", "QPS_COUNTER_VERIFY_ENABLED")
+	v.BindEnv("counter.weighted.enabled", "QPS_COUNTER_WEIGHTED_ENABLED")
+	v.BindEnv("counter.weighted.unit", "QPS_COUNTER_WEIGHTED_UNIT")
+	v.BindEnv("counter.clients.enabled", "QPS_COUNTER_CLIENTS_ENABLED")
+	v.BindEnv("counter.clients.max_tracked", "QPS_COUNTER_CLIENTS_MAX_TRACKED")
+	v.BindEnv("counter.clients.top_n", "QPS_COUNTER_CLIENTS_TOP_N")
+	v.BindEnv("counter.clients.api_key_header", "QPS_COUNTER_CLIENTS_API_KEY_HEADER")
+	v.BindEnv("counter.clients.ipv4_prefix", "QPS_COUNTER_CLIENTS_IPV4_PREFIX")
+	v.BindEnv("counter.clients.ipv6_prefix", "QPS_COUNTER_CLIENTS_IPV6_PREFIX")
 
 	// 日志配置
 	v.BindEnv("logger.level", "QPS_LOGGER_LEVEL")
@@ -120,6 +564,29 @@ func Load(configPath string) (*AppConfig, error) {
 	v.BindEnv("limiter.rate", "QPS_LIMITER_RATE")
 	v.BindEnv("limiter.burst", "QPS_LIMITER_BURST")
 	v.BindEnv("limiter.adaptive", "QPS_LIMITER_ADAPTIVE")
+	v.BindEnv("limiter.unit", "QPS_LIMITER_UNIT")
+	v.BindEnv("limiter.default_cost", "QPS_LIMITER_DEFAULT_COST")
+	v.BindEnv("limiter.max_cost", "QPS_LIMITER_MAX_COST")
+	v.BindEnv("limiter.failure.default", "QPS_LIMITER_FAILURE_DEFAULT")
+	v.BindEnv("limiter.key_header", "QPS_LIMITER_KEY_HEADER")
+	v.BindEnv("limiter.tenant_header", "QPS_LIMITER_TENANT_HEADER")
+	v.BindEnv("limiter.script.enabled", "QPS_LIMITER_SCRIPT_ENABLED")
+	v.BindEnv("limiter.script.source", "QPS_LIMITER_SCRIPT_SOURCE")
+	v.BindEnv("limiter.script.file", "QPS_LIMITER_SCRIPT_FILE")
+	v.BindEnv("limiter.script.timeout", "QPS_LIMITER_SCRIPT_TIMEOUT")
+	v.BindEnv("limiter.script.max_steps", "QPS_LIMITER_SCRIPT_MAX_STEPS")
+	v.BindEnv("limiter.auto.enabled", "QPS_LIMITER_AUTO_ENABLED")
+	v.BindEnv("limiter.auto.threshold", "QPS_LIMITER_AUTO_THRESHOLD")
+	v.BindEnv("limiter.auto.enable_after", "QPS_LIMITER_AUTO_ENABLE_AFTER")
+	v.BindEnv("limiter.auto.disable_after", "QPS_LIMITER_AUTO_DISABLE_AFTER")
+	v.BindEnv("limiter.decisions.enabled", "QPS_LIMITER_DECISIONS_ENABLED")
+	v.BindEnv("limiter.decisions.sink", "QPS_LIMITER_DECISIONS_SINK")
+	v.BindEnv("limiter.decisions.path", "QPS_LIMITER_DECISIONS_PATH")
+	v.BindEnv("limiter.decisions.url", "QPS_LIMITER_DECISIONS_URL")
+	v.BindEnv("limiter.decisions.sample_rate", "QPS_LIMITER_DECISIONS_SAMPLE_RATE")
+	v.BindEnv("limiter.decisions.queue_size", "QPS_LIMITER_DECISIONS_QUEUE_SIZE")
+	v.BindEnv("limiter.decisions.batch_size", "QPS_LIMITER_DECISIONS_BATCH_SIZE")
+	v.BindEnv("limiter.decisions.flush_interval", "QPS_LIMITER_DECISIONS_FLUSH_INTERVAL")
 
 	// 指标收集配置
 	v.BindEnv("metrics.enabled", "QPS_METRICS_ENABLED")
@@ -129,13 +596,100 @@ func Load(configPath string) (*AppConfig, error) {
 	// 优雅关闭配置
 	v.BindEnv("shutdown.timeout", "QPS_SHUTDOWN_TIMEOUT")
 	v.BindEnv("shutdown.max_wait", "QPS_SHUTDOWN_MAX_WAIT")
+	v.BindEnv("shutdown.policy.read", "QPS_SHUTDOWN_POLICY_READ")
+	v.BindEnv("shutdown.policy.write", "QPS_SHUTDOWN_POLICY_WRITE")
+
+	// 事件钩子配置
+	v.BindEnv("events.enabled", "QPS_EVENTS_ENABLED")
+	v.BindEnv("events.queue_size", "QPS_EVENTS_QUEUE_SIZE")
+	v.BindEnv("events.health_interval", "QPS_EVENTS_HEALTH_INTERVAL")
+	v.BindEnv("events.burst.enabled", "QPS_EVENTS_BURST_ENABLED")
+	v.BindEnv("events.burst.interval", "QPS_EVENTS_BURST_INTERVAL")
+	v.BindEnv("events.burst.ratio", "QPS_EVENTS_BURST_RATIO")
+	v.BindEnv("events.burst.min_qps", "QPS_EVENTS_BURST_MIN_QPS")
+
+	// 持久化存储配置
+	v.BindEnv("storage.path", "QPS_STORAGE_PATH")
+
+	// 采集工作池配置
+	v.BindEnv("ingest.enabled", "QPS_INGEST_ENABLED")
+	v.BindEnv("ingest.workers", "QPS_INGEST_WORKERS")
+	v.BindEnv("ingest.queue_size", "QPS_INGEST_QUEUE_SIZE")
+	v.BindEnv("ingest.overflow", "QPS_INGEST_OVERFLOW")
+	v.BindEnv("ingest.pause_mode", "QPS_INGEST_PAUSE_MODE")
+	v.BindEnv("ingest.duplicates.enabled", "QPS_INGEST_DUPLICATES_ENABLED")
+	v.BindEnv("ingest.duplicates.action", "QPS_INGEST_DUPLICATES_ACTION")
+	v.BindEnv("ingest.duplicates.source_header", "QPS_INGEST_DUPLICATES_SOURCE_HEADER")
+	v.BindEnv("ingest.duplicates.reports", "QPS_INGEST_DUPLICATES_REPORTS")
+	v.BindEnv("ingest.duplicates.max_keys", "QPS_INGEST_DUPLICATES_MAX_KEYS")
+	v.BindEnv("ingest.duplicates.idle_timeout", "QPS_INGEST_DUPLICATES_IDLE_TIMEOUT")
+	v.BindEnv("ingest.signing.enabled", "QPS_INGEST_SIGNING_ENABLED")
+	v.BindEnv("ingest.signing.agent_header", "QPS_INGEST_SIGNING_AGENT_HEADER")
+	v.BindEnv("ingest.signing.max_skew", "QPS_INGEST_SIGNING_MAX_SKEW")
+	v.BindEnv("ingest.signing.max_nonces", "QPS_INGEST_SIGNING_MAX_NONCES")
+
+	// 增量复制配置
+	v.BindEnv("replication.enabled", "QPS_REPLICATION_ENABLED")
+	v.BindEnv("replication.interval", "QPS_REPLICATION_INTERVAL")
+
+	// panic处理配置
+	v.BindEnv("recovery.dump_dir", "QPS_RECOVERY_DUMP_DIR")
+	v.BindEnv("recovery.max_panics_per_minute", "QPS_RECOVERY_MAX_PANICS_PER_MINUTE")
+
+	// 出站请求配置
+	v.BindEnv("outbound.max_retries", "QPS_OUTBOUND_MAX_RETRIES")
+	v.BindEnv("outbound.base_backoff", "QPS_OUTBOUND_BASE_BACKOFF")
+	v.BindEnv("outbound.max_backoff", "QPS_OUTBOUND_MAX_BACKOFF")
+	v.BindEnv("outbound.retry_budget", "QPS_OUTBOUND_RETRY_BUDGET")
+	v.BindEnv("outbound.failure_threshold", "QPS_OUTBOUND_FAILURE_THRESHOLD")
+	v.BindEnv("outbound.open_timeout", "QPS_OUTBOUND_OPEN_TIMEOUT")
+
+	// 看门狗配置
+	v.BindEnv("watchdog.enabled", "QPS_WATCHDOG_ENABLED")
+	v.BindEnv("watchdog.interval", "QPS_WATCHDOG_INTERVAL")
+	v.BindEnv("watchdog.threshold", "QPS_WATCHDOG_THRESHOLD")
+	v.BindEnv("watchdog.restart", "QPS_WATCHDOG_RESTART")
+
+	// 扩缩容建议配置
+	v.BindEnv("scaling.enabled", "QPS_SCALING_ENABLED")
+	v.BindEnv("scaling.interval", "QPS_SCALING_INTERVAL")
+	v.BindEnv("scaling.replicas", "QPS_SCALING_REPLICAS")
+	v.BindEnv("scaling.capacity_qps", "QPS_SCALING_CAPACITY_QPS")
+	v.BindEnv("scaling.target_utilization", "QPS_SCALING_TARGET_UTILIZATION")
+	v.BindEnv("scaling.horizon", "QPS_SCALING_HORIZON")
+	v.BindEnv("scaling.cpu_threshold", "QPS_SCALING_CPU_THRESHOLD")
+	v.BindEnv("scaling.max_reject_rate", "QPS_SCALING_MAX_REJECT_RATE")
+
+	// 流量报告配置
+	v.BindEnv("report.enabled", "QPS_REPORT_ENABLED")
+	v.BindEnv("report.period", "QPS_REPORT_PERIOD")
+	v.BindEnv("report.at", "QPS_REPORT_AT")
+	v.BindEnv("report.weekday", "QPS_REPORT_WEEKDAY")
+	v.BindEnv("report.sample_interval", "QPS_REPORT_SAMPLE_INTERVAL")
+	v.BindEnv("report.top_keys", "QPS_REPORT_TOP_KEYS")
+	v.BindEnv("report.timeout", "QPS_REPORT_TIMEOUT")
+
+	// 内置压测配置
+	v.BindEnv("loadgen.max_rate", "QPS_LOADGEN_MAX_RATE")
+	v.BindEnv("loadgen.max_duration", "QPS_LOADGEN_MAX_DURATION")
+
+	// 计数器快照配置
+	v.BindEnv("snapshot.enabled", "QPS_SNAPSHOT_ENABLED")
+	v.BindEnv("snapshot.path", "QPS_SNAPSHOT_PATH")
+	v.BindEnv("snapshot.interval", "QPS_SNAPSHOT_INTERVAL")
+
+	// 租户分区配置，令牌只能在配置文件中设置
+	v.BindEnv("tenants.enabled", "QPS_TENANTS_ENABLED")
+	v.BindEnv("tenants.header", "QPS_TENANTS_HEADER")
+	v.BindEnv("tenants.max_tenants", "QPS_TENANTS_MAX_TENANTS")
+	v.BindEnv("tenants.retention", "QPS_TENANTS_RETENTION")
 
 	if err := v.ReadInConfig(); err != nil {
 		return nil, fmt.Errorf("failed to read config: %w", err)
 	}
 
 	var cfg AppConfig
-	if err := v.Unmarshal(&cfg); err != nil {
+	if err := v.Unmarshal(&cfg, viper.DecodeHook(decodeHook())); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
 
@@ -146,11 +700,50 @@ func Load(configPath string) (*AppConfig, error) {
 	v.WatchConfig()
 	v.OnConfigChange(func(e fsnotify.Event) {
 		fmt.Println("config file changed:", e.Name)
+		var next AppConfig
+		if err := v.Unmarshal(&next, viper.DecodeHook(decodeHook())); err != nil {
+			rejectReload(fmt.Errorf("failed to unmarshal config: %w", err))
+			return
+		}
+		if err := validateConfig(&next); err != nil {
+			rejectReload(err)
+			return
+		}
+		reloadMu.Lock()
+		handlers := append([]func(*AppConfig){}, reloadHandlers...)
+		reloadMu.Unlock()
+		for _, handler := range handlers {
+			handler(&next)
+		}
 	})
 
 	return &cfg, nil
 }
 
+// OnReload 注册配置文件变化时调用的函数，参数为重新加载的完整配置
+// 只有通过校验的配置才会调用，无效的修改被忽略，继续使用之前的配置
+func OnReload(handler func(*AppConfig)) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	reloadHandlers = append(reloadHandlers, handler)
+}
+
+// OnReloadRejected 注册配置文件变化但被忽略时调用的函数，参数为无法解析或未通过校验的原因
+func OnReloadRejected(handler func(error)) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	rejectHandlers = append(rejectHandlers, handler)
+}
+
+func rejectReload(err error) {
+	reloadMu.Lock()
+	handlers := append([]func(error){}, rejectHandlers...)
+	reloadMu.Unlock()
+	for _, handler := range handlers {
+		handler(err)
+	}
+}
+
 func validateConfig(cfg *AppConfig) error {
 	// 验证计数器配置
 	if cfg.Counter.WindowSize <= 0 {
@@ -165,25 +758,239 @@ func validateConfig(cfg *AppConfig) error {
 		return fmt.Errorf("invalid counter config precision")
 	}
 
+	switch cfg.Counter.Alignment {
+	case "", "sliding":
+	case "wall":
+		// 槽位边界需要与窗口边界重合，且slot_num个槽位恰好覆盖一个窗口，否则上一个完整窗口和正在进行的窗口会共用槽位；
+		// shared类型的槽位布局由共享内存文件决定，不支持对齐
+		if time.Duration(cfg.Counter.SlotNum)*cfg.Counter.Precision != cfg.Counter.WindowSize {
+			return fmt.Errorf("invalid counter config alignment: window_size must equal slot_num * precision")
+		}
+		if cfg.Counter.Type == "shared" || cfg.Counter.Type == "decay" {
+			return fmt.Errorf("invalid counter config alignment: wall is not supported by the %s counter", cfg.Counter.Type)
+		}
+	default:
+		return fmt.Errorf("invalid counter config alignment: %s", cfg.Counter.Alignment)
+	}
+
+	// decay计数器本身给出1m、5m、15m速率，附加窗口和计数校验都基于槽位，不适用
+	if cfg.Counter.Type == "decay" && len(cfg.Counter.Windows) > 0 {
+		return fmt.Errorf("invalid counter config windows: not supported by the decay counter")
+	}
+	if cfg.Counter.Type == "decay" && cfg.Counter.Verify.Enabled {
+		return fmt.Errorf("invalid counter config verify: not supported by the decay counter")
+	}
+
+	windows := make(map[time.Duration]bool, len(cfg.Counter.Windows))
+	for _, window := range cfg.Counter.Windows {
+		if window <= 0 || window < time.Duration(cfg.Counter.SlotNum)*time.Millisecond {
+			return fmt.Errorf("invalid counter config windows: %s", window)
+		}
+		if windows[window] {
+			return fmt.Errorf("invalid counter config windows: duplicate %s", window)
+		}
+		windows[window] = true
+	}
+
+	if cfg.Counter.Unit != "" && !unitNamePattern.MatchString(cfg.Counter.Unit) {
+		return fmt.Errorf("invalid counter config unit: %s", cfg.Counter.Unit)
+	}
+
+	if cfg.Counter.Trend.Alpha < 0 || cfg.Counter.Trend.Alpha > 1 {
+		return fmt.Errorf("invalid counter config trend alpha")
+	}
+	if cfg.Counter.Trend.AccelerationWindow < 0 {
+		return fmt.Errorf("invalid counter config trend acceleration_window")
+	}
+
+	if len(cfg.Counter.Tags.Keys) > maxTagKeys {
+		return fmt.Errorf("invalid counter config tags: at most %d keys", maxTagKeys)
+	}
+
+	for _, key := range cfg.Counter.Tags.Keys {
+		if !labelNamePattern.MatchString(key) {
+			return fmt.Errorf("invalid counter config tag key: %s", key)
+		}
+	}
+
+	if cfg.Counter.Tags.MaxSeries < 0 {
+		return fmt.Errorf("invalid counter config tags max_series")
+	}
+
+	if cfg.Counter.Keys.MaxKeys < 0 {
+		return fmt.Errorf("invalid counter config keys max_keys")
+	}
+
+	if cfg.Counter.Keys.SketchWidth < 0 || cfg.Counter.Keys.SketchDepth < 0 {
+		return fmt.Errorf("invalid counter config keys: sketch_width and sketch_depth must not be negative")
+	}
+
+	if cfg.Counter.Keys.IdleTTL < 0 {
+		return fmt.Errorf("invalid counter config keys idle_ttl")
+	}
+
+	if cfg.Counter.History.Retention < 0 || (cfg.Counter.History.Retention > 0 && cfg.Counter.History.Retention < time.Second) {
+		return fmt.Errorf("invalid counter config history retention")
+	}
+
+	if cfg.Counter.Latency.Window < 0 {
+		return fmt.Errorf("invalid counter config latency window")
+	}
+
+	if cfg.Counter.Latency.MaxSeries < 0 {
+		return fmt.Errorf("invalid counter config latency max_series")
+	}
+
+	if cfg.Counter.Latency.PerTag && len(cfg.Counter.Tags.Keys) == 0 {
+		return fmt.Errorf("invalid counter config latency per_tag: requires counter.tags.keys")
+	}
+
+	switch cfg.Counter.Histogram {
+	case "", "log", "hdr":
+	default:
+		return fmt.Errorf("invalid counter config histogram: %s", cfg.Counter.Histogram)
+	}
+
+	adaptive := cfg.Counter.Adaptive
+	if adaptive.MinShards < 0 || adaptive.MaxShards < 0 || (adaptive.MaxShards > 0 && adaptive.MinShards > adaptive.MaxShards) {
+		return fmt.Errorf("invalid counter config adaptive shards")
+	}
+	if adaptive.Interval < 0 || adaptive.ChangeThreshold < 0 || adaptive.PressureThreshold < 0 || adaptive.AccelerationThreshold < 0 {
+		return fmt.Errorf("invalid counter config adaptive interval or thresholds")
+	}
+	if adaptive.QPSWeight < 0 || adaptive.MemoryWeight < 0 {
+		return fmt.Errorf("invalid counter config adaptive weights")
+	}
+
+	if cfg.Counter.MaxNamed < 0 {
+		return fmt.Errorf("invalid counter config max_named")
+	}
+	if cfg.Counter.DeleteGrace < 0 {
+		return fmt.Errorf("invalid counter config delete_grace")
+	}
+
+	if cfg.Counter.Idle.Timeout < 0 {
+		return fmt.Errorf("invalid counter config idle timeout")
+	}
+
+	clients := cfg.Counter.Clients
+	if clients.MaxTracked < 0 || clients.TopN < 0 {
+		return fmt.Errorf("invalid counter config clients max_tracked or top_n")
+	}
+
+	if clients.IPv4Prefix < 0 || clients.IPv4Prefix > 32 || clients.IPv6Prefix < 0 || clients.IPv6Prefix > 128 {
+		return fmt.Errorf("invalid counter config clients ip prefix")
+	}
+
 	// 验证服务器配置
 	if cfg.Server.Port <= 0 || cfg.Server.Port > 65535 {
 		return fmt.Errorf("invalid server port")
 	}
 
-	// 验证限流器配置
-	if cfg.Limiter.Enabled && cfg.Limiter.Rate <= 0 {
+	if cfg.Server.ServerType == "both" {
+		if cfg.Server.AdminPort <= 0 || cfg.Server.AdminPort > 65535 || cfg.Server.AdminPort == cfg.Server.Port {
+			return fmt.Errorf("invalid server admin_port: must be a different port when server_type is both")
+		}
+	}
+
+	switch cfg.Server.Role {
+	case "", "full", "ingest":
+	case "query":
+		// both模式下fasthttp只处理上报，与query角色矛盾
+		if cfg.Server.ServerType == "both" {
+			return fmt.Errorf("invalid server role: query cannot be used with server_type both")
+		}
+	default:
+		return fmt.Errorf("invalid server role: %s", cfg.Server.Role)
+	}
+	if cfg.Server.QPSPrecision < 0 || cfg.Server.QPSPrecision > 6 {
+		return fmt.Errorf("invalid server qps_precision: must be between 0 and 6")
+	}
+	switch cfg.Server.RateUnit {
+	case "", "second", "minute", "hour":
+	default:
+		return fmt.Errorf("invalid server rate_unit: %s", cfg.Server.RateUnit)
+	}
+	if cfg.Server.CacheMaxAge < 0 {
+		return fmt.Errorf("invalid server cache_max_age: must not be negative")
+	}
+
+	// 验证限流器配置，启用自动启停时限流器随时可能被启用
+	limiterEnabled := cfg.Limiter.Enabled || cfg.Limiter.Auto.Enabled
+	if limiterEnabled && cfg.Limiter.Rate <= 0 {
 		return fmt.Errorf("invalid limiter rate")
 	}
 
-	if cfg.Limiter.Enabled && cfg.Limiter.Burst <= 0 {
+	if limiterEnabled && cfg.Limiter.Burst <= 0 {
 		return fmt.Errorf("invalid limiter burst")
 	}
 
+	switch cfg.Limiter.Unit {
+	case "", "requests", "bytes":
+	default:
+		return fmt.Errorf("invalid limiter unit: %s", cfg.Limiter.Unit)
+	}
+
+	if cfg.Limiter.DefaultCost < 0 || cfg.Limiter.MaxCost < 0 {
+		return fmt.Errorf("invalid limiter cost")
+	}
+
+	if cfg.Limiter.DefaultCost > 0 && cfg.Limiter.MaxCost > 0 && cfg.Limiter.DefaultCost > cfg.Limiter.MaxCost {
+		return fmt.Errorf("invalid limiter cost: default_cost exceeds max_cost")
+	}
+
+	// 超过突发容量的cost永远无法通过限流
+	if limiterEnabled && cfg.Limiter.MaxCost > cfg.Limiter.Burst {
+		return fmt.Errorf("invalid limiter max_cost: exceeds burst")
+	}
+
+	for _, schedule := range cfg.Limiter.Schedules {
+		if err := validateLimiterSchedule(schedule); err != nil {
+			return err
+		}
+	}
+
+	ruleNames := make(map[string]bool, len(cfg.Limiter.Rules))
+	for _, rule := range cfg.Limiter.Rules {
+		if err := validateLimiterRule(rule); err != nil {
+			return err
+		}
+		if ruleNames[rule.Name] {
+			return fmt.Errorf("invalid limiter rule %s: duplicate name", rule.Name)
+		}
+		ruleNames[rule.Name] = true
+	}
+
+	if !validFailurePolicy(cfg.Limiter.Failure.Default) {
+		return fmt.Errorf("invalid limiter failure policy: %s", cfg.Limiter.Failure.Default)
+	}
+	for route, policy := range cfg.Limiter.Failure.Routes {
+		if !strings.HasPrefix(route, "/") || policy == "" || !validFailurePolicy(policy) {
+			return fmt.Errorf("invalid limiter failure policy for route %s: %s", route, policy)
+		}
+	}
+
+	if err := validateDecisionLog(cfg.Limiter.Decisions); err != nil {
+		return err
+	}
+	if err := validateLimiterScript(cfg.Limiter.Script); err != nil {
+		return err
+	}
+	if err := validateLimiterAuto(cfg.Limiter.Auto); err != nil {
+		return err
+	}
+
 	// 验证指标收集配置
 	if cfg.Metrics.Enabled && cfg.Metrics.Interval <= 0 {
 		return fmt.Errorf("invalid metrics interval")
 	}
 
+	for name := range cfg.Metrics.Labels {
+		if !labelNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid metrics label name: %s", name)
+		}
+	}
+
 	// 验证优雅关闭配置
 	if cfg.Shutdown.Timeout <= 0 {
 		return fmt.Errorf("invalid shutdown timeout")
@@ -193,5 +1000,351 @@ func validateConfig(cfg *AppConfig) error {
 		return fmt.Errorf("invalid shutdown max wait")
 	}
 
+	if !validDrainPolicy(cfg.Shutdown.Policy.Read) {
+		return fmt.Errorf("invalid shutdown policy for reads: %s", cfg.Shutdown.Policy.Read)
+	}
+
+	if !validDrainPolicy(cfg.Shutdown.Policy.Write) {
+		return fmt.Errorf("invalid shutdown policy for writes: %s", cfg.Shutdown.Policy.Write)
+	}
+
+	// 验证事件钩子配置
+	for _, webhook := range cfg.Events.Webhooks {
+		if webhook.URL == "" {
+			return fmt.Errorf("invalid events webhook url")
+		}
+	}
+
+	if cfg.Events.Burst.Ratio != 0 && cfg.Events.Burst.Ratio <= 1 {
+		return fmt.Errorf("invalid events burst ratio")
+	}
+
+	if cfg.Events.HealthInterval < 0 {
+		return fmt.Errorf("invalid events health_interval")
+	}
+
+	// 验证采集工作池配置
+	switch cfg.Ingest.Overflow {
+	case "", "block", "drop_oldest", "drop_newest":
+	default:
+		return fmt.Errorf("invalid ingest overflow policy: %s", cfg.Ingest.Overflow)
+	}
+
+	switch cfg.Ingest.PauseMode {
+	case "", "reject", "drop":
+	default:
+		return fmt.Errorf("invalid ingest pause_mode: %s", cfg.Ingest.PauseMode)
+	}
+
+	if cfg.Ingest.Workers < 0 || cfg.Ingest.QueueSize < 0 {
+		return fmt.Errorf("invalid ingest workers or queue_size")
+	}
+
+	switch cfg.Ingest.Duplicates.Action {
+	case "", "flag", "merge":
+	default:
+		return fmt.Errorf("invalid ingest duplicates action: %s", cfg.Ingest.Duplicates.Action)
+	}
+	if cfg.Ingest.Duplicates.Reports == 1 || cfg.Ingest.Duplicates.Reports < 0 {
+		return fmt.Errorf("invalid ingest duplicates reports: must be at least 2")
+	}
+	if cfg.Ingest.Duplicates.MaxKeys < 0 || cfg.Ingest.Duplicates.IdleTimeout < 0 {
+		return fmt.Errorf("invalid ingest duplicates max_keys or idle_timeout")
+	}
+	if err := validateSigning(cfg.Ingest.Signing); err != nil {
+		return err
+	}
+	if err := validatePipelines(cfg.Ingest.Pipelines); err != nil {
+		return err
+	}
+
+	// 验证增量复制配置
+	if cfg.Replication.Interval < 0 {
+		return fmt.Errorf("invalid replication interval")
+	}
+	if cfg.Replication.Enabled && cfg.Server.Role == "query" {
+		if len(cfg.Replication.Leaders) == 0 {
+			return fmt.Errorf("invalid replication config: query role requires leaders")
+		}
+		if cfg.Server.AdminToken == "" {
+			return fmt.Errorf("invalid replication config: admin_token is required to subscribe to leaders")
+		}
+	}
+	for _, leader := range cfg.Replication.Leaders {
+		if u, err := url.Parse(leader); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid replication leader url: %s", leader)
+		}
+	}
+
+	// 验证panic处理配置
+	if cfg.Recovery.MaxPanicsPerMinute < 0 {
+		return fmt.Errorf("invalid recovery max_panics_per_minute")
+	}
+
+	// 验证出站请求配置
+	o := cfg.Outbound
+	if o.MaxRetries < -1 || o.BaseBackoff < 0 || o.MaxBackoff < 0 || o.RetryBudget < 0 || o.FailureThreshold < 0 || o.OpenTimeout < 0 {
+		return fmt.Errorf("invalid outbound config: values must not be negative (max_retries may be -1 to disable retries)")
+	}
+
+	// 验证看门狗配置
+	if cfg.Watchdog.Interval < 0 || cfg.Watchdog.Threshold < 0 {
+		return fmt.Errorf("invalid watchdog config: interval and threshold must not be negative")
+	}
+
+	// 验证扩缩容建议配置
+	s := cfg.Scaling
+	if s.Interval < 0 || s.Replicas < 0 || s.CapacityQPS < 0 || s.Horizon < 0 {
+		return fmt.Errorf("invalid scaling config: values must not be negative")
+	}
+	if s.TargetUtilization < 0 || s.TargetUtilization > 1 || s.MaxRejectRate < 0 || s.MaxRejectRate > 1 {
+		return fmt.Errorf("invalid scaling config: target_utilization and max_reject_rate must be between 0 and 1")
+	}
+	if s.CPUThreshold < 0 || s.CPUThreshold > 100 {
+		return fmt.Errorf("invalid scaling config: cpu_threshold must be between 0 and 100")
+	}
+
+	// 验证流量报告配置
+	r := cfg.Report
+	if r.Period != "" && r.Period != "daily" && r.Period != "weekly" {
+		return fmt.Errorf("invalid report period: %s", r.Period)
+	}
+	if r.At != "" {
+		if _, err := ParseClock(r.At); err != nil {
+			return fmt.Errorf("invalid report time: %w", err)
+		}
+	}
+	if _, ok := Weekdays[r.Weekday]; r.Weekday != "" && !ok {
+		return fmt.Errorf("invalid report weekday: %s", r.Weekday)
+	}
+	if r.SampleInterval < 0 || r.TopKeys < 0 || r.Timeout < 0 {
+		return fmt.Errorf("invalid report config: values must not be negative")
+	}
+	for _, url := range r.Webhooks {
+		if url == "" {
+			return fmt.Errorf("invalid report webhook url")
+		}
+	}
+
+	// 验证内置压测配置
+	if cfg.LoadGen.MaxRate < 0 || cfg.LoadGen.MaxDuration < 0 {
+		return fmt.Errorf("invalid loadgen config: values must not be negative")
+	}
+
+	// 验证计数器快照配置
+	if cfg.Snapshot.Interval < 0 {
+		return fmt.Errorf("invalid snapshot config: interval must not be negative")
+	}
+	if cfg.Snapshot.Enabled && cfg.Snapshot.Path == "" && cfg.Storage.Path == "" {
+		return fmt.Errorf("invalid snapshot config: path or storage.path is required")
+	}
+
+	// 验证租户分区配置
+	if cfg.Tenants.MaxTenants < 0 {
+		return fmt.Errorf("invalid tenants config: max_tenants must not be negative")
+	}
+	if cfg.Tenants.Retention < 0 || (cfg.Tenants.Retention > 0 && cfg.Tenants.Retention < time.Second) {
+		return fmt.Errorf("invalid tenants config: retention must be at least 1s")
+	}
+	tokens := make(map[string]bool, len(cfg.Tenants.Tokens))
+	for _, t := range cfg.Tenants.Tokens {
+		if t.Tenant == "" || t.Token == "" {
+			return fmt.Errorf("invalid tenants config: tokens require tenant and token")
+		}
+		// 与管理员令牌相同时无法区分身份
+		if tokens[t.Token] || t.Token == cfg.Server.AdminToken {
+			return fmt.Errorf("invalid tenants config: duplicate token for tenant %s", t.Tenant)
+		}
+		tokens[t.Token] = true
+	}
+
+	return nil
+}
+
+// Weekdays 限流时间段支持的星期名称
+var Weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// ParseClock 解析HH:MM格式的时间，返回从零点开始的分钟数
+func ParseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// validateDecisionLog 验证限流决策日志配置，未启用时不检查
+func validateDecisionLog(cfg DecisionLogConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	switch cfg.Sink {
+	case "file":
+		if cfg.Path == "" {
+			return fmt.Errorf("invalid limiter decisions path: required for file sink")
+		}
+	case "http":
+		if cfg.URL == "" {
+			return fmt.Errorf("invalid limiter decisions url: required for http sink")
+		}
+	default:
+		return fmt.Errorf("invalid limiter decisions sink: %s", cfg.Sink)
+	}
+	if cfg.SampleRate < 0 || cfg.SampleRate > 1 {
+		return fmt.Errorf("invalid limiter decisions sample_rate: %v", cfg.SampleRate)
+	}
+	if cfg.QueueSize < 0 || cfg.BatchSize < 0 || cfg.FlushInterval < 0 {
+		return fmt.Errorf("invalid limiter decisions queue")
+	}
+	return nil
+}
+
+func validateSigning(cfg SigningConfig) error {
+	if cfg.MaxSkew < 0 || cfg.MaxNonces < 0 {
+		return fmt.Errorf("invalid ingest signing max_skew or max_nonces")
+	}
+	if !cfg.Enabled {
+		return nil
+	}
+	if len(cfg.Agents) == 0 {
+		return fmt.Errorf("invalid ingest signing agents: at least one agent is required")
+	}
+	agents := make(map[string]bool, len(cfg.Agents))
+	for _, a := range cfg.Agents {
+		if a.Agent == "" || a.Secret == "" {
+			return fmt.Errorf("invalid ingest signing agent: agent and secret are required")
+		}
+		if agents[a.Agent] {
+			return fmt.Errorf("invalid ingest signing agent: duplicate agent %s", a.Agent)
+		}
+		agents[a.Agent] = true
+	}
+	return nil
+}
+
+func validatePipelines(pipelines []PipelineConfig) error {
+	names := make(map[string]bool, len(pipelines))
+	for _, p := range pipelines {
+		if p.Name == "" || names[p.Name] {
+			return fmt.Errorf("invalid ingest pipeline name: %q (names must be unique and non-empty)", p.Name)
+		}
+		names[p.Name] = true
+
+		switch p.Source {
+		case "udp":
+			if p.Address == "" {
+				return fmt.Errorf("invalid ingest pipeline %s: udp source requires address", p.Name)
+			}
+		case "tail":
+			if p.Path == "" {
+				return fmt.Errorf("invalid ingest pipeline %s: tail source requires path", p.Name)
+			}
+		default:
+			return fmt.Errorf("invalid ingest pipeline %s source: %s", p.Name, p.Source)
+		}
+		switch p.Format {
+		case "", "json", "line":
+		default:
+			return fmt.Errorf("invalid ingest pipeline %s format: %s", p.Name, p.Format)
+		}
+		if p.SampleRate < 0 || p.SampleRate > 1 {
+			return fmt.Errorf("invalid ingest pipeline %s sample_rate: must be between 0 and 1", p.Name)
+		}
+		if p.Key.MaxLength < 0 {
+			return fmt.Errorf("invalid ingest pipeline %s key max_length", p.Name)
+		}
+	}
+	return nil
+}
+
+func validateLimiterScript(cfg LimiterScriptConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if (cfg.Source == "") == (cfg.File == "") {
+		return fmt.Errorf("invalid limiter script: exactly one of source and file is required")
+	}
+	if cfg.Timeout < 0 {
+		return fmt.Errorf("invalid limiter script timeout: %v", cfg.Timeout)
+	}
+	return nil
+}
+
+func validateLimiterAuto(cfg LimiterAutoConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if cfg.Threshold <= 0 {
+		return fmt.Errorf("invalid limiter auto threshold: %d", cfg.Threshold)
+	}
+	if cfg.EnableAfter < 0 || cfg.DisableAfter < 0 {
+		return fmt.Errorf("invalid limiter auto duration: must not be negative")
+	}
+	return nil
+}
+
+func validFailurePolicy(policy string) bool {
+	return policy == "" || policy == "open" || policy == "closed"
+}
+
+func validDrainPolicy(policy string) bool {
+	return policy == "" || policy == "accept" || policy == "reject"
+}
+
+// validateLimiterRule 验证限流规则，default为未匹配任何规则时使用的全局配置的规则名
+func validateLimiterRule(rule LimiterRuleConfig) error {
+	if rule.Name == "" || rule.Name == "default" {
+		return fmt.Errorf("invalid limiter rule name: %q", rule.Name)
+	}
+	if rule.Match.Path != "" && !strings.HasPrefix(rule.Match.Path, "/") {
+		return fmt.Errorf("invalid limiter rule %s: path must start with /", rule.Name)
+	}
+	if _, err := path.Match(rule.Match.Key, ""); err != nil {
+		return fmt.Errorf("invalid limiter rule %s: key pattern: %w", rule.Name, err)
+	}
+	switch rule.Action {
+	case "allow", "deny":
+		return nil
+	case "", "reject", "shadow":
+	default:
+		return fmt.Errorf("invalid limiter rule %s: action %s", rule.Name, rule.Action)
+	}
+	switch rule.Algorithm {
+	case "", "token_bucket", "fixed_window":
+	default:
+		return fmt.Errorf("invalid limiter rule %s: algorithm %s", rule.Name, rule.Algorithm)
+	}
+	if rule.Rate <= 0 || rule.Burst < 0 {
+		return fmt.Errorf("invalid limiter rule %s: rate or burst", rule.Name)
+	}
+	return nil
+}
+
+func validateLimiterSchedule(schedule LimiterScheduleConfig) error {
+	if schedule.Name == "" {
+		return fmt.Errorf("invalid limiter schedule: name is required")
+	}
+	if schedule.Rate <= 0 || schedule.Burst < 0 {
+		return fmt.Errorf("invalid limiter schedule %s: rate or burst", schedule.Name)
+	}
+	for _, day := range schedule.Days {
+		if _, ok := Weekdays[day]; !ok {
+			return fmt.Errorf("invalid limiter schedule %s: day %s", schedule.Name, day)
+		}
+	}
+	if _, err := ParseClock(schedule.Start); err != nil {
+		return fmt.Errorf("invalid limiter schedule %s: %w", schedule.Name, err)
+	}
+	if _, err := ParseClock(schedule.End); err != nil {
+		return fmt.Errorf("invalid limiter schedule %s: %w", schedule.Name, err)
+	}
 	return nil
 }
@@ -0,0 +1,175 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// countSuffixes 计数的十进制后缀，小写的m容易与毫（milli）混淆，不接受
+var countSuffixes = map[string]int64{
+	"k": 1e3,
+	"K": 1e3,
+	"M": 1e6,
+	"G": 1e9,
+}
+
+// byteSuffixes 字节数的单位，不区分大小写；KB等为1000的幂，KiB等为1024的幂
+var byteSuffixes = map[string]uint64{
+	"b":   1,
+	"kb":  1e3,
+	"mb":  1e6,
+	"gb":  1e9,
+	"tb":  1e12,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+	"tib": 1 << 40,
+}
+
+// ParseCount 解析速率、突发容量、阈值等整数，接受普通整数和带k、M、G后缀的十进制数，如 "1500"、"1.5k"、"2M"
+// 带后缀的小数展开后必须是整数，"1.2345k" 这样的值返回错误而不是截断
+func ParseCount(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	number, multiplier := s, int64(1)
+	for suffix, m := range countSuffixes {
+		if strings.HasSuffix(s, suffix) {
+			number, multiplier = strings.TrimSpace(strings.TrimSuffix(s, suffix)), m
+			break
+		}
+	}
+
+	n, err := parseScaled(number, uint64(multiplier))
+	if err != nil {
+		return 0, fmt.Errorf("invalid count %q: %w", s, err)
+	}
+	return n, nil
+}
+
+// ParseByteSize 解析内存大小等字节数，接受普通整数和带B、KB、MB、GB、TB、KiB、MiB、GiB、TiB单位的数，如 "512MiB"、"1.5GB"
+func ParseByteSize(s string) (uint64, error) {
+	s = strings.TrimSpace(s)
+	number, multiplier := s, uint64(1)
+	if i := strings.IndexFunc(s, func(r rune) bool { return r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' }); i >= 0 {
+		m, ok := byteSuffixes[strings.ToLower(s[i:])]
+		if !ok {
+			return 0, fmt.Errorf("invalid byte size %q: unknown unit %q", s, s[i:])
+		}
+		number, multiplier = strings.TrimSpace(s[:i]), m
+	}
+
+	n, err := parseScaled(number, multiplier)
+	if err != nil {
+		return 0, fmt.Errorf("invalid byte size %q: %w", s, err)
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("invalid byte size %q: must not be negative", s)
+	}
+	return uint64(n), nil
+}
+
+// parseScaled 把十进制数乘以multiplier，按整数和小数部分分别计算，避免浮点误差
+func parseScaled(number string, multiplier uint64) (int64, error) {
+	negative := strings.HasPrefix(number, "-")
+	number = strings.TrimPrefix(strings.TrimPrefix(number, "-"), "+")
+	whole, fraction, _ := strings.Cut(number, ".")
+	if whole == "" && fraction == "" {
+		return 0, fmt.Errorf("missing number")
+	}
+	for _, part := range []string{whole, fraction} {
+		if strings.TrimLeft(part, "0123456789") != "" {
+			return 0, fmt.Errorf("not a decimal number")
+		}
+	}
+
+	var value uint64
+	if whole != "" {
+		w, err := strconv.ParseUint(whole, 10, 64)
+		if err != nil || (w != 0 && multiplier > math.MaxInt64/w) {
+			return 0, fmt.Errorf("out of range")
+		}
+		value = w * multiplier
+	}
+	if fraction = strings.TrimRight(fraction, "0"); fraction != "" {
+		scale := uint64(1)
+		for range fraction {
+			if scale > math.MaxUint64/10 {
+				return 0, fmt.Errorf("too many decimal places")
+			}
+			scale *= 10
+		}
+		f, _ := strconv.ParseUint(fraction, 10, 64)
+		if f > math.MaxUint64/multiplier || f*multiplier%scale != 0 {
+			return 0, fmt.Errorf("not a whole number")
+		}
+		value += f * multiplier / scale
+	}
+	if value > math.MaxInt64 {
+		return 0, fmt.Errorf("out of range")
+	}
+	if negative {
+		return -int64(value), nil
+	}
+	return int64(value), nil
+}
+
+// Count 接口请求中的计数，JSON中可以是整数或ParseCount接受的字符串，如 1500 或 "1.5k"
+type Count int64
+
+// UnmarshalJSON 解析整数或带后缀的字符串，小数和其他类型返回错误
+func (c *Count) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		s = string(data)
+	}
+	n, err := ParseCount(s)
+	if err != nil {
+		return err
+	}
+	*c = Count(n)
+	return nil
+}
+
+// ByteSize 配置中的字节数，可以写成ParseByteSize接受的字符串，如 "1GiB"
+type ByteSize uint64
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	byteSizeType = reflect.TypeOf(ByteSize(0))
+)
+
+// decodeHook 在viper默认的时长和逗号分隔列表转换之外，把配置文件和环境变量中的字符串解析为
+// 整数（ParseCount）和字节数（ParseByteSize），格式错误时加载失败，而不是得到相差1000倍的值
+func decodeHook() mapstructure.DecodeHookFunc {
+	return mapstructure.ComposeDecodeHookFunc(
+		mapstructure.StringToTimeDurationHookFunc(),
+		mapstructure.StringToSliceHookFunc(","),
+		func(from, to reflect.Type, data interface{}) (interface{}, error) {
+			isInteger := to.Kind() == reflect.Int || to.Kind() == reflect.Int64 || to == byteSizeType
+			// YAML中的 1.5 是浮点数，默认的弱类型转换会截断为1
+			if f, ok := data.(float64); ok && isInteger && f != math.Trunc(f) {
+				return nil, fmt.Errorf("invalid count %v: not a whole number", f)
+			}
+			s, ok := data.(string)
+			if !ok {
+				return data, nil
+			}
+			switch {
+			case to == byteSizeType:
+				n, err := ParseByteSize(s)
+				return ByteSize(n), err
+			case to == durationType:
+				return data, nil
+			case isInteger:
+				return ParseCount(s)
+			}
+			return data, nil
+		},
+	)
+}
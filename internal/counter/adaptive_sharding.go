@@ -7,8 +7,80 @@ import (
 
 	"github.com/mant7s/qps-counter/internal/config"
 	"github.com/mant7s/qps-counter/internal/logger"
+	"github.com/mant7s/qps-counter/internal/pressure"
+	"github.com/mant7s/qps-counter/internal/workers"
 )
 
+// 自适应分片参数的默认值，分片数的默认值由各管理器决定
+const (
+	defaultAdaptiveInterval        = 10 * time.Second
+	defaultAdaptiveChangeThreshold = 0.3
+	defaultAdaptiveMemoryThreshold = 1 << 30 // 1GB
+	defaultAdaptiveQPSWeight       = 0.6
+	defaultAdaptiveMemoryWeight    = 0.4
+)
+
+// adaptiveParams counter.adaptive补充默认值后的参数，重新加载配置时整体替换
+type adaptiveParams struct {
+	enabled               bool
+	minShards             int
+	maxShards             int
+	interval              time.Duration
+	changeThreshold       float64
+	memoryThreshold       uint64
+	pressureThreshold     float64
+	accelerationThreshold float64 // 为0时不按QPS加速度增加分片
+	qpsWeight             float64 // 与memoryWeight归一化后的权重
+	memoryWeight          float64
+}
+
+// newAdaptiveParams 用默认值补充cfg中未设置的参数，最大分片数小于最小分片数时取最小分片数
+func newAdaptiveParams(cfg config.AdaptiveConfig, defaultMin, defaultMax int) *adaptiveParams {
+	p := &adaptiveParams{
+		enabled:               cfg.Enabled,
+		minShards:             cfg.MinShards,
+		maxShards:             cfg.MaxShards,
+		interval:              cfg.Interval,
+		changeThreshold:       cfg.ChangeThreshold,
+		memoryThreshold:       uint64(cfg.MemoryThreshold),
+		pressureThreshold:     cfg.PressureThreshold,
+		accelerationThreshold: cfg.AccelerationThreshold,
+		qpsWeight:             defaultAdaptiveQPSWeight,
+		memoryWeight:          defaultAdaptiveMemoryWeight,
+	}
+	if p.minShards <= 0 {
+		p.minShards = defaultMin
+	}
+	if p.maxShards <= 0 {
+		p.maxShards = defaultMax
+	}
+	if p.maxShards < p.minShards {
+		p.maxShards = p.minShards
+	}
+	if p.interval <= 0 {
+		p.interval = defaultAdaptiveInterval
+	}
+	if p.changeThreshold <= 0 {
+		p.changeThreshold = defaultAdaptiveChangeThreshold
+	}
+	if p.memoryThreshold == 0 {
+		p.memoryThreshold = defaultAdaptiveMemoryThreshold
+	}
+	if p.pressureThreshold <= 0 {
+		p.pressureThreshold = pressure.DefaultThreshold
+	}
+	if total := cfg.QPSWeight + cfg.MemoryWeight; cfg.QPSWeight >= 0 && cfg.MemoryWeight >= 0 && total > 0 {
+		p.qpsWeight = cfg.QPSWeight / total
+		p.memoryWeight = cfg.MemoryWeight / total
+	}
+	return p
+}
+
+// clamp 将分片数限制在最小和最大分片数之间
+func (p *adaptiveParams) clamp(shards int32) int32 {
+	return min(max(shards, int32(p.minShards)), int32(p.maxShards))
+}
+
 // AdaptiveShardingManager 管理分片数量的自适应调整
 type AdaptiveShardingManager struct {
 	counter        Counter
@@ -16,49 +88,74 @@ type AdaptiveShardingManager struct {
 	lastQPS        atomic.Int64
 	lastAdjustTime atomic.Int64
 	stopChan       chan struct{}
-	minShards      int
-	maxShards      int
+	params         atomic.Pointer[adaptiveParams]
 	currentShards  atomic.Int32
+	worker         *workers.Worker
 }
 
 // NewAdaptiveShardingManager 创建一个新的自适应分片管理器
+// minShards、maxShards为0时使用cfg.Adaptive中的值，都未设置时为4和64；其余参数取自cfg.Adaptive
+// 创建后即开始调整，不受cfg.Adaptive.Enabled影响，需要按配置启停时调用Configure
 func NewAdaptiveShardingManager(counter Counter, cfg *config.CounterConfig, minShards, maxShards int) *AdaptiveShardingManager {
-	if minShards <= 0 {
-		minShards = 4
+	adaptive := cfg.Adaptive
+	if minShards > 0 {
+		adaptive.MinShards = minShards
 	}
-	if maxShards <= 0 {
-		maxShards = 64
+	if maxShards > 0 {
+		adaptive.MaxShards = maxShards
 	}
+	params := newAdaptiveParams(adaptive, 4, 64)
+	params.enabled = true
 
 	asm := &AdaptiveShardingManager{
 		counter:       counter,
 		config:        cfg,
 		stopChan:      make(chan struct{}),
-		minShards:     minShards,
-		maxShards:     maxShards,
 		currentShards: atomic.Int32{},
 	}
+	asm.params.Store(params)
 
 	// 初始设置为最小分片数
-	asm.currentShards.Store(int32(minShards))
+	asm.currentShards.Store(int32(params.minShards))
 	asm.lastAdjustTime.Store(time.Now().Unix())
 
 	// 启动自适应调整协程
-	go asm.adaptiveWorker()
+	asm.worker = workers.Register("counter.adaptive_sharding", params.interval).WithIdle(IdleDetectorOf(counter).Idle)
+	asm.worker.Go(nil, asm.adaptiveWorker)
 
 	return asm
 }
 
+// Configure 应用新的counter.adaptive配置，分片数的默认值与创建时相同
+// 当前分片数超出新的范围时立即调整到范围内，调整间隔在下一次检查后生效
+func (asm *AdaptiveShardingManager) Configure(cfg config.AdaptiveConfig) {
+	params := newAdaptiveParams(cfg, 4, 64)
+	asm.params.Store(params)
+	asm.currentShards.Store(params.clamp(asm.currentShards.Load()))
+	logger.Info(fmt.Sprintf("更新自适应分片配置: enabled=%t, 分片数范围: %d-%d, 调整间隔: %s",
+		params.enabled, params.minShards, params.maxShards, params.interval))
+}
+
 // adaptiveWorker 周期性检查负载并调整分片数量
 func (asm *AdaptiveShardingManager) adaptiveWorker() {
-	// 每10秒检查一次负载情况
-	ticker := time.NewTicker(10 * time.Second)
+	interval := asm.params.Load().interval
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
+	idle := IdleDetectorOf(asm.counter)
 
 	for {
 		select {
 		case <-ticker.C:
 			asm.adjustShards()
+			asm.worker.Ran()
+			if next := asm.params.Load().interval; next != interval {
+				interval = next
+				ticker.Reset(interval)
+				asm.worker.SetInterval(interval)
+			}
+			if !idle.PauseTicker(ticker, interval, asm.stopChan) {
+				return
+			}
 		case <-asm.stopChan:
 			return
 		}
@@ -67,8 +164,12 @@ func (asm *AdaptiveShardingManager) adaptiveWorker() {
 
 // adjustShards 根据当前QPS调整分片数量
 func (asm *AdaptiveShardingManager) adjustShards() {
+	params := asm.params.Load()
 	currentQPS := asm.counter.CurrentQPS()
 	lastQPS := asm.lastQPS.Swap(currentQPS)
+	if !params.enabled {
+		return
+	}
 	currentShards := asm.currentShards.Load()
 
 	// 计算QPS变化率
@@ -79,18 +180,12 @@ func (asm *AdaptiveShardingManager) adjustShards() {
 
 	// 根据QPS变化率调整分片数量
 	var newShards int32
-	if qpsChangeRate > 0.3 && currentShards < int32(asm.maxShards) {
-		// QPS增长超过30%，增加分片数
-		newShards = currentShards + int32(float64(currentShards)*0.5)
-		if newShards > int32(asm.maxShards) {
-			newShards = int32(asm.maxShards)
-		}
-	} else if qpsChangeRate < -0.3 && currentShards > int32(asm.minShards) {
-		// QPS下降超过30%，减少分片数
-		newShards = currentShards - int32(float64(currentShards)*0.3)
-		if newShards < int32(asm.minShards) {
-			newShards = int32(asm.minShards)
-		}
+	if qpsChangeRate > params.changeThreshold && currentShards < int32(params.maxShards) {
+		// QPS增长超过阈值，增加分片数
+		newShards = params.clamp(currentShards + int32(float64(currentShards)*0.5))
+	} else if qpsChangeRate < -params.changeThreshold && currentShards > int32(params.minShards) {
+		// QPS下降超过阈值，减少分片数
+		newShards = params.clamp(currentShards - int32(float64(currentShards)*0.3))
 	} else {
 		// QPS变化不大，保持当前分片数
 		return
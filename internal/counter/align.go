@@ -0,0 +1,48 @@
+package counter
+
+import "github.com/mant7s/qps-counter/internal/config"
+
+// 窗口对齐方式，对应counter.alignment
+const (
+	AlignSliding = "sliding" // 默认，窗口为当前时间之前的window_size，随时间连续滑动
+	AlignWall    = "wall"    // 窗口起点对齐到window_size的整数倍（如window_size为1s时对齐到整秒），统计最近一个完整的窗口
+)
+
+// windowAlignment 决定窗口覆盖的时间范围
+// 对齐时QPS为最近一个已结束的对齐窗口的计数，与按自然秒、自然分钟聚合的外部面板可以直接比较；
+// 代价是结果最多滞后一个窗口，且正在进行的窗口需要另外的槽位，槽位数为slot_num的两倍
+type windowAlignment struct {
+	windowSize int64
+	wall       bool
+}
+
+func newWindowAlignment(cfg *config.CounterConfig) windowAlignment {
+	return windowAlignment{
+		windowSize: int64(cfg.WindowSize),
+		wall:       cfg.Alignment == AlignWall,
+	}
+}
+
+// bounds 返回now时参与统计的槽位时间戳范围[start, end]
+func (a windowAlignment) bounds(now int64) (start, end int64) {
+	if !a.wall {
+		return now - a.windowSize, now
+	}
+	end = now - now%a.windowSize
+	return end - a.windowSize, end - 1
+}
+
+// retains 返回时间戳为ts的槽位在now时是否需要保留，早于统计范围或晚于now的槽位可以清理
+func (a windowAlignment) retains(ts, now int64) bool {
+	start, _ := a.bounds(now)
+	return ts > 0 && ts >= start && ts <= now
+}
+
+// slotNum 返回需要的槽位数，对齐时同时保留上一个完整窗口和正在进行的窗口
+// 对齐时配置校验保证slot_num*precision等于window_size，两个窗口各占slot_num个槽位
+func (a windowAlignment) slotNum(cfg *config.CounterConfig) int {
+	if a.wall {
+		return cfg.SlotNum * 2
+	}
+	return cfg.SlotNum
+}
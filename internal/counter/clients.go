@@ -0,0 +1,274 @@
+package counter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/netip"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/workers"
+)
+
+// 调用方统计的维度
+const (
+	ClientUserAgent = "user_agent"
+	ClientAPIKey    = "api_key"
+	ClientIPPrefix  = "ip_prefix"
+)
+
+// ClientDimensions 所有调用方统计维度
+var ClientDimensions = []string{ClientUserAgent, ClientAPIKey, ClientIPPrefix}
+
+const (
+	defaultMaxTrackedClients = 1000
+	defaultClientTopN        = 10
+	defaultIPv4PrefixBits    = 24
+	defaultIPv6PrefixBits    = 48
+	defaultAPIKeyHeader      = "X-API-Key"
+	maxUserAgentLength       = 128
+)
+
+// ClientIdentity 一个请求的调用方标识，为空的字段不参与统计
+type ClientIdentity struct {
+	UserAgent string
+	APIKey    string
+	IP        string
+}
+
+// ClientStat 一个调用方及其请求速率
+type ClientStat struct {
+	Value string `json:"value"`
+	QPS   int64  `json:"qps"`
+}
+
+// clientDimension 一个维度下的调用方集合，数量受 max_tracked 限制
+type clientDimension struct {
+	clients  *ShardedMap[*slidingWindow]
+	count    atomic.Int64 // 已跟踪的调用方数量
+	overflow atomic.Int64 // 因超出数量限制未被统计的请求数
+}
+
+// ClientTracker 按User-Agent、API Key和来源IP前缀统计窗口内各调用方的请求速率
+// 每个维度跟踪的调用方数量有上限，整个窗口内没有请求的调用方会被定期清理
+// nil表示未启用调用方统计，RecordWith和Stop可以在nil上调用
+type ClientTracker struct {
+	config     *config.CounterConfig
+	maxTracked int
+	topN       int
+	keyHeader  string
+	ipv4Bits   int
+	ipv6Bits   int
+	dimensions map[string]*clientDimension
+	worker     *workers.Worker
+	stopChan   chan struct{}
+	stopOnce   sync.Once
+	wg         sync.WaitGroup
+}
+
+// NewClientTracker 创建调用方统计器并启动清理协程
+func NewClientTracker(cfg *config.CounterConfig) *ClientTracker {
+	clients := cfg.Clients
+	ct := &ClientTracker{
+		config:     cfg,
+		maxTracked: positiveOr(clients.MaxTracked, defaultMaxTrackedClients),
+		topN:       positiveOr(clients.TopN, defaultClientTopN),
+		keyHeader:  clients.APIKeyHeader,
+		ipv4Bits:   positiveOr(clients.IPv4Prefix, defaultIPv4PrefixBits),
+		ipv6Bits:   positiveOr(clients.IPv6Prefix, defaultIPv6PrefixBits),
+		dimensions: make(map[string]*clientDimension, len(ClientDimensions)),
+		stopChan:   make(chan struct{}),
+	}
+	if ct.keyHeader == "" {
+		ct.keyHeader = defaultAPIKeyHeader
+	}
+	for _, name := range ClientDimensions {
+		ct.dimensions[name] = &clientDimension{clients: NewShardedMap[*slidingWindow](0)}
+	}
+
+	ct.worker = workers.Register("counter.clients", ct.config.WindowSize)
+	ct.worker.Go(&ct.wg, ct.cleanupWorker)
+	return ct
+}
+
+func positiveOr(value, fallback int) int {
+	if value <= 0 {
+		return fallback
+	}
+	return value
+}
+
+// APIKeyHeader 返回携带API Key的请求头名称
+func (ct *ClientTracker) APIKeyHeader() string {
+	return ct.keyHeader
+}
+
+// Record 为请求的调用方增加n次计数，n<=0时忽略
+func (ct *ClientTracker) Record(id ClientIdentity, n int64) {
+	if n <= 0 {
+		return
+	}
+	now := time.Now().UnixNano()
+
+	if id.UserAgent != "" {
+		userAgent := id.UserAgent
+		if len(userAgent) > maxUserAgentLength {
+			userAgent = userAgent[:maxUserAgentLength]
+		}
+		ct.record(ClientUserAgent, userAgent, n, now)
+	}
+	if id.APIKey != "" {
+		ct.record(ClientAPIKey, maskAPIKey(id.APIKey), n, now)
+	}
+	if prefix, ok := ct.ipPrefix(id.IP); ok {
+		ct.record(ClientIPPrefix, prefix, n, now)
+	}
+}
+
+// RecordWith 与Record相同，调用方标识由identity按API Key请求头名称取得
+// ct为nil时不调用identity，请求路径上不再解析请求头
+func (ct *ClientTracker) RecordWith(identity func(apiKeyHeader string) ClientIdentity, n int64) {
+	if ct == nil {
+		return
+	}
+	ct.Record(identity(ct.keyHeader), n)
+}
+
+func (ct *ClientTracker) record(dimension, value string, n, now int64) {
+	d := ct.dimensions[dimension]
+	w, ok := d.clients.LoadOrCreate(value, func() (*slidingWindow, bool) {
+		if d.count.Add(1) > int64(ct.maxTracked) {
+			d.count.Add(-1)
+			return nil, false
+		}
+		return newSlidingWindow(ct.config), true
+	})
+	if !ok {
+		d.overflow.Add(n)
+		return
+	}
+	w.add(n, now)
+}
+
+// maskAPIKey 只保留API Key的前4个字符和摘要，避免在统计结果中暴露完整的密钥
+func maskAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	prefix := key
+	if len(prefix) > 4 {
+		prefix = prefix[:4]
+	}
+	return prefix + "..." + hex.EncodeToString(sum[:4])
+}
+
+// ipPrefix 将来源IP归并为网段，如 10.1.2.3 按/24归并为 10.1.2.0/24
+func (ct *ClientTracker) ipPrefix(ip string) (string, bool) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return "", false
+	}
+	addr = addr.Unmap()
+
+	bits := ct.ipv6Bits
+	if addr.Is4() {
+		bits = ct.ipv4Bits
+	}
+	prefix, err := addr.Prefix(min(bits, addr.BitLen()))
+	if err != nil {
+		return "", false
+	}
+	return prefix.String(), true
+}
+
+// Top 返回某个维度下请求速率最高的n个调用方，n<=0时使用配置的top_n
+func (ct *ClientTracker) Top(dimension string, n int) []ClientStat {
+	d, ok := ct.dimensions[dimension]
+	if !ok {
+		return nil
+	}
+	if n <= 0 {
+		n = ct.topN
+	}
+
+	now := time.Now().UnixNano()
+	result := make([]ClientStat, 0, d.clients.Len())
+	d.clients.Range(func(value string, w *slidingWindow) bool {
+		if qps := w.rate(now); qps > 0 {
+			result = append(result, ClientStat{Value: value, QPS: qps})
+		}
+		return true
+	})
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].QPS != result[j].QPS {
+			return result[i].QPS > result[j].QPS
+		}
+		return result[i].Value < result[j].Value
+	})
+	if len(result) > n {
+		result = result[:n]
+	}
+	return result
+}
+
+// GetStats 获取各维度跟踪的调用方数量和因超出上限未被统计的请求数
+func (ct *ClientTracker) GetStats() map[string]interface{} {
+	tracked := make(map[string]int, len(ct.dimensions))
+	overflow := make(map[string]int64, len(ct.dimensions))
+	for name, d := range ct.dimensions {
+		tracked[name] = d.clients.Len()
+		overflow[name] = d.overflow.Load()
+	}
+	return map[string]interface{}{
+		"tracked":     tracked,
+		"overflow":    overflow,
+		"max_tracked": ct.maxTracked,
+		"top_n":       ct.topN,
+	}
+}
+
+// cleanupWorker 每个窗口清理一次整个窗口内没有请求的调用方，为新的调用方腾出位置
+func (ct *ClientTracker) cleanupWorker() {
+	ticker := time.NewTicker(ct.config.WindowSize)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ct.cleanup(time.Now().UnixNano())
+			ct.worker.Ran()
+		case <-ct.stopChan:
+			return
+		}
+	}
+}
+
+func (ct *ClientTracker) cleanup(now int64) {
+	for _, d := range ct.dimensions {
+		// Range期间持有分片的读锁，先收集再删除
+		var idle []string
+		d.clients.Range(func(value string, w *slidingWindow) bool {
+			if w.rate(now) == 0 {
+				idle = append(idle, value)
+			}
+			return true
+		})
+		for _, value := range idle {
+			d.clients.Delete(value)
+			d.count.Add(-1)
+		}
+	}
+}
+
+// Stop 停止清理协程
+func (ct *ClientTracker) Stop() {
+	if ct == nil {
+		return
+	}
+	ct.stopOnce.Do(func() {
+		close(ct.stopChan)
+	})
+	ct.wg.Wait()
+}
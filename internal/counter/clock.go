@@ -0,0 +1,46 @@
+package counter
+
+import "time"
+
+// Clock 计数器使用的时间源，测试中可以替换为手动推进的时钟，不需要sleep等待窗口滑动
+// 清理协程仍按真实时间的精度周期运行，每次运行时从Clock读取当前时间
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock 系统时钟
+type SystemClock struct{}
+
+// Now 返回当前时间
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// ClockOf 返回计数器使用的时间源，计数器不支持注入时钟时返回系统时钟
+func ClockOf(c Counter) Clock {
+	if aware, ok := c.(interface{ Clock() Clock }); ok {
+		return aware.Clock()
+	}
+	return SystemClock{}
+}
+
+// monotonicClock 以创建时读取的时间为基准，之后按底层时钟的单调读数推进
+// 槽位按纳秒时间戳划分，系统时钟被NTP或手动调整时直接使用挂钟会让写入落到错误的槽位、
+// 或让整个窗口被误判为过期；time.Time.Sub在两端都带有单调读数时使用单调读数，因此调整挂钟不影响窗口。
+// 返回的时间与挂钟的偏差等于启动后挂钟累计被调整的量；底层时钟不带单调读数（如测试时钟）时与底层时钟一致
+type monotonicClock struct {
+	clock Clock
+	base  time.Time
+	wall  time.Time // base去掉单调读数后的挂钟时间
+}
+
+// newMonotonicClock 以clock的当前时间为基准创建单调时钟
+func newMonotonicClock(clock Clock) *monotonicClock {
+	base := clock.Now()
+	return &monotonicClock{clock: clock, base: base, wall: base.Round(0)}
+}
+
+// Now 返回基准时间加上自基准以来经过的单调时长
+func (m *monotonicClock) Now() time.Time {
+	return m.wall.Add(m.clock.Now().Sub(m.base))
+}
@@ -1,14 +1,39 @@
 package counter
 
 import (
+	"time"
+
 	"github.com/mant7s/qps-counter/internal/config"
-	_ "time"
 )
 
 type Counter interface {
 	Incr()
+	Add(n int64) // 一次增加n个计数单位，如一批事件或一次请求的字节数
 	CurrentQPS() int64
+	Reset() // 清空窗口内的所有计数，如在测试流量之后归零；与之并发的写入可能保留也可能被清空
 	Stop()
+	Stats() CounterStats // 窗口的内部状态，/stats 返回全局计数器的状态
+}
+
+// CounterStats 计数器窗口的内部状态，用于排查QPS与预期不符的原因，
+// 例如窗口起点异常说明时钟有问题，有计数的槽位很少说明流量集中在少数时间段，清理时间停滞说明清理协程卡住
+type CounterStats struct {
+	Type          string     `json:"type"`
+	WindowSize    string     `json:"window_size"`
+	WindowStart   time.Time  `json:"window_start"`           // 参与统计的最早时间
+	Slots         int        `json:"slots"`                  // 槽位总数
+	OccupiedSlots int        `json:"occupied_slots"`         // 窗口内有计数的槽位数
+	Events        int64      `json:"events"`                 // 窗口内的计数总和，逐槽位累加，不使用增量维护的总计数
+	LastCleanup   *time.Time `json:"last_cleanup,omitempty"` // 最近一次清理过期槽位的时间，尚未清理时为创建时间；没有清理协程时省略
+}
+
+// cleanupTime 返回CounterStats.LastCleanup，lastCleanup为0表示尚未清理，此时返回创建时间
+func cleanupTime(lastCleanup, created int64) *time.Time {
+	if lastCleanup == 0 {
+		lastCleanup = created
+	}
+	t := time.Unix(0, lastCleanup)
+	return &t
 }
 
 type Type string
@@ -16,13 +41,20 @@ type Type string
 const (
 	ShardedType  = "sharded"
 	LockFreeType = "lockfree"
+	SharedType   = "shared" // 同一台主机的多个进程通过共享内存写入同一个窗口，需要通过OpenShared创建
+	SketchType   = "sketch" // 全局计数与sharded相同，按key计数使用固定内存的count-min sketch，适合key基数很高的场景
 )
 
+// DefaultSharedPath 共享内存计数器的默认文件路径
+const DefaultSharedPath = "/dev/shm/qps-counter"
+
 // NewCounter 配置驱动创建
 func NewCounter(cfg *config.CounterConfig) Counter {
 	switch cfg.Type {
 	case LockFreeType:
 		return NewLockFree(cfg)
+	case DecayType:
+		return NewDecay(cfg)
 	default:
 		return NewSharded(cfg)
 	}
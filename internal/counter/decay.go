@@ -0,0 +1,178 @@
+package counter
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mant7s/qps-counter/internal/config"
+)
+
+// DecayType 指数衰减计数器，与常见指标库的Meter一样给出1m、5m、15m的指数加权移动平均速率
+const DecayType = "decay"
+
+// decayTickInterval 衰减速率的更新间隔，与Dropwizard Metrics等指标库的Meter一致
+const decayTickInterval = 5 * time.Second
+
+// decayWindows 衰减速率的时间常数，CurrentQPS使用第一个
+var decayWindows = []time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute}
+
+// decayRate 一个时间常数的指数加权移动平均速率
+type decayRate struct {
+	name  string
+	alpha float64 // 每个更新间隔的衰减系数，1-e^(-interval/window)
+	rate  float64 // 每秒速率
+}
+
+// DecayCounter 指数衰减计数器，counter.type为decay时使用
+// 写入只对未计入的计数做原子加法；每隔5秒把这段时间的速率按各自的衰减系数并入1m、5m、15m的移动平均，
+// 更新在写入或读取时按需进行，不启动后台协程。与滑动窗口不同，旧的计数不会在某一时刻整体过期，
+// 速率平滑地衰减，适合与其他指标库的rate_1m等指标对照；代价是速率每5秒才变化一次，且突增需要数个时间常数才能完全反映
+// 不支持槽位快照、计数校验和counter.windows，CurrentQPS返回1m速率
+type DecayCounter struct {
+	config    *config.CounterConfig
+	clock     Clock
+	uncounted atomic.Int64 // 上次更新之后写入的计数
+	lastTick  atomic.Int64 // 上次更新的时间（纳秒）
+
+	mu          sync.Mutex
+	rates       []decayRate
+	initialized bool // 第一次更新时直接使用这段时间的速率，而不是从0开始逼近
+}
+
+// NewDecay 创建指数衰减计数器
+func NewDecay(cfg *config.CounterConfig) *DecayCounter {
+	return NewDecayWithClock(cfg, SystemClock{})
+}
+
+// NewDecayWithClock 使用指定的时间源创建指数衰减计数器
+func NewDecayWithClock(cfg *config.CounterConfig, clock Clock) *DecayCounter {
+	clock = newMonotonicClock(clock)
+	d := &DecayCounter{
+		config: cfg,
+		clock:  clock,
+		rates:  make([]decayRate, len(decayWindows)),
+	}
+	for i, window := range decayWindows {
+		d.rates[i] = decayRate{
+			name:  WindowName(window),
+			alpha: 1 - math.Exp(-decayTickInterval.Seconds()/window.Seconds()),
+		}
+	}
+	d.lastTick.Store(clock.Now().UnixNano())
+	return d
+}
+
+func (d *DecayCounter) Incr() {
+	d.Add(1)
+}
+
+// Add 增加n个计数，n<=0时忽略
+func (d *DecayCounter) Add(n int64) {
+	if n <= 0 {
+		return
+	}
+	d.tickIfNecessary(d.clock.Now().UnixNano())
+	addSaturating(&d.uncounted, n)
+}
+
+// tickIfNecessary 距上次更新超过更新间隔时，把未计入的计数并入各移动平均
+// 长时间没有写入和读取时，第一个间隔计入未计入的计数，之后的间隔速率为0，按间隔数一次性衰减
+func (d *DecayCounter) tickIfNecessary(now int64) {
+	interval := int64(decayTickInterval)
+	if now-d.lastTick.Load() < interval {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	last := d.lastTick.Load()
+	ticks := (now - last) / interval
+	if ticks <= 0 {
+		return
+	}
+	d.lastTick.Store(last + ticks*interval)
+
+	instant := float64(d.uncounted.Swap(0)) / decayTickInterval.Seconds()
+	for i := range d.rates {
+		r := &d.rates[i]
+		if d.initialized {
+			r.rate += r.alpha * (instant - r.rate)
+		} else {
+			r.rate = instant
+		}
+		if ticks > 1 {
+			r.rate *= math.Pow(1-r.alpha, float64(ticks-1))
+		}
+	}
+	d.initialized = true
+}
+
+// rate 返回第i个时间常数的每秒速率
+func (d *DecayCounter) rate(i int) float64 {
+	d.tickIfNecessary(d.clock.Now().UnixNano())
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.rates[i].rate
+}
+
+// CurrentQPS 返回1m速率
+func (d *DecayCounter) CurrentQPS() int64 {
+	return int64(d.rate(0))
+}
+
+// CurrentRate 返回1m速率，不取整
+func (d *DecayCounter) CurrentRate() float64 {
+	return d.rate(0)
+}
+
+// Windows 返回1m、5m、15m速率，/qps中显示为qps_1m、qps_5m、qps_15m
+func (d *DecayCounter) Windows() []WindowQPS {
+	d.tickIfNecessary(d.clock.Now().UnixNano())
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	result := make([]WindowQPS, len(d.rates))
+	for i, r := range d.rates {
+		result[i] = WindowQPS{Window: r.name, QPS: int64(r.rate)}
+	}
+	return result
+}
+
+// Reset 清空未计入的计数和所有移动平均
+func (d *DecayCounter) Reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.uncounted.Store(0)
+	d.lastTick.Store(d.clock.Now().UnixNano())
+	for i := range d.rates {
+		d.rates[i].rate = 0
+	}
+	d.initialized = false
+}
+
+// Stats 返回衰减计数器的内部状态
+// 衰减计数器没有槽位：窗口起点为上次更新的时间，events为此后写入、尚未并入移动平均的计数，
+// 更新在写入或读取时进行，没有清理时间
+func (d *DecayCounter) Stats() CounterStats {
+	d.tickIfNecessary(d.clock.Now().UnixNano())
+	return CounterStats{
+		Type:        DecayType,
+		WindowSize:  decayWindows[0].String(),
+		WindowStart: time.Unix(0, d.lastTick.Load()),
+		Events:      d.uncounted.Load(),
+	}
+}
+
+// Stop 衰减计数器没有后台协程，无需停止
+func (d *DecayCounter) Stop() {}
+
+// Unit 返回计数单位
+func (d *DecayCounter) Unit() string {
+	return unitOf(d.config)
+}
+
+// Clock 返回计数器的时间源
+func (d *DecayCounter) Clock() Clock {
+	return d.clock
+}
@@ -3,33 +3,45 @@ package counter
 import (
 	"fmt"
 	"runtime"
+	"slices"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/mant7s/qps-counter/internal/config"
 	"github.com/mant7s/qps-counter/internal/logger"
+	"github.com/mant7s/qps-counter/internal/pressure"
+	"github.com/mant7s/qps-counter/internal/workers"
 	"go.uber.org/zap"
 )
 
-// EnhancedAdaptiveShardingManager 增强的分片管理器，考虑内存使用情况
+// EnhancedAdaptiveShardingManager 增强的分片管理器，考虑内存使用情况和Linux PSI压力
 type EnhancedAdaptiveShardingManager struct {
 	*BaseComponent // 嵌入基础组件
 	counter        Counter
 	config         *config.CounterConfig
 	lastQPS        atomic.Int64
-	minShards      int
-	maxShards      int
 	currentShards  atomic.Int32
 
 	// 增强功能
-	memoryThreshold uint64        // 内存使用阈值（字节）
+	paramsMu        sync.Mutex // 串行化参数的修改，读取时直接Load
+	params          atomic.Pointer[adaptiveParams]
 	lastMemoryUsage atomic.Uint64 // 上次内存使用量
-	memoryWeight    float64       // 内存因素权重
-	qpsWeight       float64       // QPS因素权重
-	adjustInterval  time.Duration // 调整间隔
+	worker          *workers.Worker
+
+	pressureMu       sync.Mutex
+	readPressure     func() pressure.Snapshot // 读取压力数据
+	lastPressure     pressure.Snapshot        // 最近一次读取的压力数据
+	readAcceleration func() float64           // 读取QPS加速度（请求数/秒²），可以为nil
+	lastAcceleration float64
+
+	notifyMu sync.Mutex
+	notify   func(from, to int32, reason string) // 分片数变化时调用，可以为nil
 }
 
 // NewEnhancedAdaptiveShardingManager 创建一个新的增强自适应分片管理器
+// 参数为0时使用cfg.Adaptive中的值，都未设置时分片数为CPU核心数到其8倍、内存阈值为1GB、调整间隔为10秒
+// 创建后即开始调整，不受cfg.Adaptive.Enabled影响，需要按配置启停时调用Configure
 func NewEnhancedAdaptiveShardingManager(
 	counter Counter,
 	cfg *config.CounterConfig,
@@ -37,52 +49,92 @@ func NewEnhancedAdaptiveShardingManager(
 	memoryThreshold uint64,
 	adjustInterval time.Duration,
 ) *EnhancedAdaptiveShardingManager {
-	if minShards <= 0 {
-		minShards = runtime.NumCPU()
+	adaptive := cfg.Adaptive
+	if minShards > 0 {
+		adaptive.MinShards = minShards
 	}
-	if maxShards <= 0 {
-		maxShards = runtime.NumCPU() * 8
+	if maxShards > 0 {
+		adaptive.MaxShards = maxShards
 	}
-	if adjustInterval <= 0 {
-		adjustInterval = 10 * time.Second
+	if memoryThreshold > 0 {
+		adaptive.MemoryThreshold = config.ByteSize(memoryThreshold)
 	}
-	if memoryThreshold == 0 {
-		// 默认内存阈值设为1GB
-		memoryThreshold = 1 << 30
+	if adjustInterval > 0 {
+		adaptive.Interval = adjustInterval
 	}
+	params := newAdaptiveParams(adaptive, runtime.NumCPU(), runtime.NumCPU()*8)
+	params.enabled = true
 
 	asm := &EnhancedAdaptiveShardingManager{
-		BaseComponent:   NewBaseComponent(),
-		counter:         counter,
-		config:          cfg,
-		minShards:       minShards,
-		maxShards:       maxShards,
-		currentShards:   atomic.Int32{},
-		memoryThreshold: memoryThreshold,
-		memoryWeight:    0.4, // 内存因素权重40%
-		qpsWeight:       0.6, // QPS因素权重60%
-		adjustInterval:  adjustInterval,
+		BaseComponent: NewBaseComponent(),
+		counter:       counter,
+		config:        cfg,
+		currentShards: atomic.Int32{},
+		readPressure:  pressure.Read,
 	}
+	asm.params.Store(params)
 
 	// 初始设置为最小分片数
-	asm.currentShards.Store(int32(minShards))
+	asm.currentShards.Store(int32(params.minShards))
 	asm.UpdateTime() // 使用基础组件的方法更新时间
 
 	// 启动自适应调整协程
-	go asm.adaptiveWorker()
+	asm.worker = workers.Register("counter.adaptive_sharding", params.interval).WithIdle(IdleDetectorOf(counter).Idle)
+	asm.worker.Go(nil, asm.adaptiveWorker)
 
 	return asm
 }
 
+// Configure 应用新的counter.adaptive配置，未设置的参数使用默认值而不是保留当前值
+// 当前分片数超出新的范围时立即调整到范围内，调整间隔在下一次检查后生效
+func (asm *EnhancedAdaptiveShardingManager) Configure(cfg config.AdaptiveConfig) {
+	params := newAdaptiveParams(cfg, runtime.NumCPU(), runtime.NumCPU()*8)
+	asm.paramsMu.Lock()
+	asm.params.Store(params)
+	asm.paramsMu.Unlock()
+	asm.currentShards.Store(params.clamp(asm.currentShards.Load()))
+
+	logger.Info("更新自适应分片配置",
+		zap.Bool("enabled", params.enabled),
+		zap.Int("min_shards", params.minShards),
+		zap.Int("max_shards", params.maxShards),
+		zap.Duration("interval", params.interval),
+		zap.Float64("change_threshold", params.changeThreshold),
+		zap.Uint64("memory_threshold", params.memoryThreshold),
+		zap.Float64("pressure_threshold", params.pressureThreshold),
+		zap.Float64("acceleration_threshold", params.accelerationThreshold),
+	)
+}
+
+// updateParams 在当前参数的副本上修改后替换
+func (asm *EnhancedAdaptiveShardingManager) updateParams(update func(p *adaptiveParams)) {
+	asm.paramsMu.Lock()
+	defer asm.paramsMu.Unlock()
+	params := *asm.params.Load()
+	update(&params)
+	asm.params.Store(&params)
+}
+
 // adaptiveWorker 周期性检查负载并调整分片数量
 func (asm *EnhancedAdaptiveShardingManager) adaptiveWorker() {
-	ticker := time.NewTicker(asm.adjustInterval)
+	interval := asm.params.Load().interval
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
+	idle := IdleDetectorOf(asm.counter)
 
 	for {
 		select {
 		case <-ticker.C:
 			asm.adjustShards()
+			asm.worker.Ran()
+			if next := asm.params.Load().interval; next != interval {
+				interval = next
+				ticker.Reset(interval)
+				asm.worker.SetInterval(interval)
+			}
+			if !idle.PauseTicker(ticker, interval, asm.StopChan()) {
+				return
+			}
 		case <-asm.StopChan(): // 使用基础组件的方法获取停止通道
 			return
 		}
@@ -90,6 +142,8 @@ func (asm *EnhancedAdaptiveShardingManager) adaptiveWorker() {
 }
 
 // adjustShards 根据当前QPS、内存使用情况和系统负载调整分片数量
+// 内存压力超过阈值时与堆内存超过阈值一样减少到最小分片数，CPU压力超过阈值时不再增加分片，
+// 更多的分片只会增加CPU已经不足的进程的调度和缓存开销
 func (asm *EnhancedAdaptiveShardingManager) adjustShards() {
 	// 使用基础组件的方法尝试获取锁
 	if !asm.TryLock() {
@@ -97,13 +151,35 @@ func (asm *EnhancedAdaptiveShardingManager) adjustShards() {
 	}
 	defer asm.Unlock()
 
+	params := asm.params.Load()
+	if !params.enabled {
+		asm.lastQPS.Store(asm.counter.CurrentQPS())
+		return
+	}
+
 	// 获取系统资源使用情况
 	var memStats runtime.MemStats
 	runtime.ReadMemStats(&memStats)
 
 	// 计算内存使用率
 	memoryUsage := memStats.Alloc
-	memoryUsageRate := float64(memoryUsage) / float64(asm.memoryThreshold)
+	memoryUsageRate := float64(memoryUsage) / float64(params.memoryThreshold)
+
+	// 读取cgroup或整机的压力数据
+	asm.pressureMu.Lock()
+	readPressure, threshold := asm.readPressure, params.pressureThreshold
+	readAcceleration := asm.readAcceleration
+	asm.pressureMu.Unlock()
+	snapshot := readPressure()
+	stalled := snapshot.Stalled(threshold)
+	var acceleration float64
+	if readAcceleration != nil {
+		acceleration = readAcceleration()
+	}
+	asm.pressureMu.Lock()
+	asm.lastPressure = snapshot
+	asm.lastAcceleration = acceleration
+	asm.pressureMu.Unlock()
 
 	// 获取当前QPS
 	currentQPS := asm.counter.CurrentQPS()
@@ -116,40 +192,56 @@ func (asm *EnhancedAdaptiveShardingManager) adjustShards() {
 		qpsChangeRate = float64(currentQPS-lastQPS) / float64(lastQPS)
 	}
 
+	// QPS仍在快速爬升时，不等两次检查之间的变化率超过阈值就增加分片
+	ramping := params.accelerationThreshold > 0 && currentQPS > 0 &&
+		acceleration/float64(currentQPS) > params.accelerationThreshold
+	increasing := qpsChangeRate > params.changeThreshold || ramping
+
 	// 检查内存使用是否超过阈值
-	if memoryUsage > asm.memoryThreshold && currentShards > int32(asm.minShards) {
+	if memoryUsage > params.memoryThreshold && currentShards > int32(params.minShards) {
 		// 内存使用超过阈值，强制减少分片数到最小值以释放内存
-		newShards := int32(asm.minShards)
+		newShards := int32(params.minShards)
 		logger.Warn("内存使用超过阈值，减少分片数",
 			zap.Uint64("memory_usage", memoryUsage),
-			zap.Uint64("threshold", asm.memoryThreshold),
+			zap.Uint64("threshold", params.memoryThreshold),
+			zap.Int32("new_shards", newShards),
+		)
+		asm.resize(currentShards, newShards, "memory")
+		return
+	}
+
+	// 检查内存压力是否超过阈值，容器内接近内存限制时堆内存可能仍低于阈值
+	if slices.Contains(stalled, "memory") && currentShards > int32(params.minShards) {
+		newShards := int32(params.minShards)
+		logger.Warn("内存压力超过阈值，减少分片数",
+			zap.Float64("memory_pressure", snapshot.Memory.SomeAvg10),
+			zap.Float64("threshold", threshold),
 			zap.Int32("new_shards", newShards),
 		)
-		// 更新分片数量
-		asm.currentShards.Store(newShards)
-		asm.UpdateTime() // 使用基础组件的方法更新时间
+		asm.resize(currentShards, newShards, "memory_pressure")
 		return
 	}
 
 	// 综合评分系统
-	qpsScore := qpsChangeRate * asm.qpsWeight
-	memoryScore := (1 - memoryUsageRate) * asm.memoryWeight
+	qpsScore := qpsChangeRate * params.qpsWeight
+	memoryScore := (1 - memoryUsageRate) * params.memoryWeight
 	totalScore := qpsScore + memoryScore
 
 	// 根据QPS变化率调整分片数量
 	var newShards int32
-	if qpsChangeRate > 0.3 && currentShards < int32(asm.maxShards) {
+	if increasing && slices.Contains(stalled, "cpu") {
+		// CPU压力过高，增加分片无助于处理更多请求
+		logger.Info("CPU压力超过阈值，暂不增加分片数",
+			zap.Float64("cpu_pressure", snapshot.CPU.SomeAvg10),
+			zap.Float64("threshold", threshold),
+		)
+		return
+	} else if increasing && currentShards < int32(params.maxShards) {
 		// QPS显著增加，快速增加分片
-		newShards = currentShards + int32(float64(currentShards)*0.5)
-		if newShards > int32(asm.maxShards) {
-			newShards = int32(asm.maxShards)
-		}
-	} else if qpsChangeRate < -0.3 && currentShards > int32(asm.minShards) {
+		newShards = params.clamp(currentShards + int32(float64(currentShards)*0.5))
+	} else if qpsChangeRate < -params.changeThreshold && currentShards > int32(params.minShards) {
 		// QPS显著下降，快速减少分片
-		newShards = currentShards - int32(float64(currentShards)*0.5)
-		if newShards < int32(asm.minShards) {
-			newShards = int32(asm.minShards)
-		}
+		newShards = params.clamp(currentShards - int32(float64(currentShards)*0.5))
 	} else {
 		// QPS变化不大，保持当前分片数
 		return
@@ -157,16 +249,42 @@ func (asm *EnhancedAdaptiveShardingManager) adjustShards() {
 
 	// 更新分片数量并记录日志
 	if newShards != currentShards {
-		asm.currentShards.Store(newShards)
-		asm.UpdateTime() // 使用基础组件的方法更新时间
+		reason := "qps_increase"
+		if newShards < currentShards {
+			reason = "qps_decrease"
+		} else if qpsChangeRate <= params.changeThreshold {
+			reason = "qps_ramp"
+		}
+		asm.resize(currentShards, newShards, reason)
 		logger.Info(fmt.Sprintf("自适应调整分片数量: %d -> %d", currentShards, newShards),
 			zap.Int64("current_qps", currentQPS),
+			zap.Float64("acceleration", acceleration),
 			zap.Uint64("memory_usage", memoryUsage),
 			zap.Float64("total_score", totalScore),
 		)
 	}
 }
 
+// resize 更新分片数量，并以调整原因通知SetNotify设置的函数
+func (asm *EnhancedAdaptiveShardingManager) resize(from, to int32, reason string) {
+	asm.currentShards.Store(to)
+	asm.UpdateTime() // 使用基础组件的方法更新时间
+
+	asm.notifyMu.Lock()
+	notify := asm.notify
+	asm.notifyMu.Unlock()
+	if notify != nil {
+		notify(from, to, reason)
+	}
+}
+
+// SetNotify 设置分片数变化时调用的函数，reason为memory、memory_pressure、qps_increase、qps_ramp或qps_decrease
+func (asm *EnhancedAdaptiveShardingManager) SetNotify(fn func(from, to int32, reason string)) {
+	asm.notifyMu.Lock()
+	defer asm.notifyMu.Unlock()
+	asm.notify = fn
+}
+
 // Stop 停止自适应分片管理器
 func (asm *EnhancedAdaptiveShardingManager) Stop() {
 	// 使用基础组件的方法停止组件
@@ -178,27 +296,55 @@ func (asm *EnhancedAdaptiveShardingManager) GetCurrentShards() int32 {
 	return asm.currentShards.Load()
 }
 
-// GetStats 获取分片管理器状态
-func (asm *EnhancedAdaptiveShardingManager) GetStats() map[string]interface{} {
+// ShardingStats 自适应分片管理器的状态，/stats/v2、Prometheus指标和qpsctl共用同一个结构
+type ShardingStats struct {
+	Enabled               bool              `json:"enabled"`
+	CurrentShards         int32             `json:"current_shards"`
+	MinShards             int               `json:"min_shards"`
+	MaxShards             int               `json:"max_shards"`
+	CurrentQPS            int64             `json:"current_qps"`
+	MemoryUsage           uint64            `json:"memory_usage"` // 当前堆内存分配的字节数
+	MemoryThreshold       uint64            `json:"memory_threshold"`
+	AdjustInterval        string            `json:"adjust_interval"`
+	ChangeThreshold       float64           `json:"change_threshold"`
+	LastAdjustTime        time.Time         `json:"last_adjust_time"`
+	Pressure              pressure.Snapshot `json:"pressure"` // 最近一次调整时读取的压力数据
+	PressureThreshold     float64           `json:"pressure_threshold"`
+	Acceleration          float64           `json:"acceleration"` // 最近一次调整时读取的QPS加速度
+	AccelerationThreshold float64           `json:"acceleration_threshold"`
+}
+
+// Stats 获取分片管理器状态
+func (asm *EnhancedAdaptiveShardingManager) Stats() ShardingStats {
 	var memStats runtime.MemStats
 	runtime.ReadMemStats(&memStats)
-	memoryUsage := memStats.Alloc
 
-	return map[string]interface{}{
-		"current_shards":   asm.currentShards.Load(),
-		"min_shards":       asm.minShards,
-		"max_shards":       asm.maxShards,
-		"current_qps":      asm.counter.CurrentQPS(),
-		"memory_usage":     memoryUsage,
-		"memory_threshold": asm.memoryThreshold,
-		"last_adjust_time": time.Unix(asm.GetLastUpdateTime(), 0), // 使用基础组件的方法获取上次更新时间
+	params := asm.params.Load()
+	asm.pressureMu.Lock()
+	defer asm.pressureMu.Unlock()
+
+	return ShardingStats{
+		Enabled:               params.enabled,
+		CurrentShards:         asm.currentShards.Load(),
+		MinShards:             params.minShards,
+		MaxShards:             params.maxShards,
+		CurrentQPS:            asm.counter.CurrentQPS(),
+		MemoryUsage:           memStats.Alloc,
+		MemoryThreshold:       params.memoryThreshold,
+		AdjustInterval:        params.interval.String(),
+		ChangeThreshold:       params.changeThreshold,
+		LastAdjustTime:        time.Unix(asm.GetLastUpdateTime(), 0), // 使用基础组件的方法获取上次更新时间
+		Pressure:              asm.lastPressure,
+		PressureThreshold:     params.pressureThreshold,
+		Acceleration:          asm.lastAcceleration,
+		AccelerationThreshold: params.accelerationThreshold,
 	}
 }
 
 // SetMemoryThreshold 设置内存使用阈值
 func (asm *EnhancedAdaptiveShardingManager) SetMemoryThreshold(threshold uint64) {
 	if threshold > 0 {
-		asm.memoryThreshold = threshold
+		asm.updateParams(func(p *adaptiveParams) { p.memoryThreshold = threshold })
 		logger.Info("更新内存阈值", zap.Uint64("new_threshold", threshold))
 	}
 }
@@ -208,10 +354,35 @@ func (asm *EnhancedAdaptiveShardingManager) SetWeights(qpsWeight, memoryWeight f
 	if qpsWeight >= 0 && memoryWeight >= 0 && qpsWeight+memoryWeight > 0 {
 		// 归一化权重
 		total := qpsWeight + memoryWeight
-		asm.qpsWeight = qpsWeight / total
-		asm.memoryWeight = memoryWeight / total
+		asm.updateParams(func(p *adaptiveParams) {
+			p.qpsWeight = qpsWeight / total
+			p.memoryWeight = memoryWeight / total
+		})
 		logger.Info("更新权重配置",
-			zap.Float64("qps_weight", asm.qpsWeight),
-			zap.Float64("memory_weight", asm.memoryWeight))
+			zap.Float64("qps_weight", qpsWeight/total),
+			zap.Float64("memory_weight", memoryWeight/total))
+	}
+}
+
+// SetPressureThreshold 设置PSI压力阈值，单位为最近10秒的等待时间百分比
+func (asm *EnhancedAdaptiveShardingManager) SetPressureThreshold(threshold float64) {
+	if threshold > 0 {
+		asm.updateParams(func(p *adaptiveParams) { p.pressureThreshold = threshold })
+		logger.Info("更新压力阈值", zap.Float64("new_threshold", threshold))
 	}
 }
+
+// SetAccelerationReader 设置QPS加速度（请求数/秒²）的来源，通常为TrendTracker.Acceleration；
+// 配置了acceleration_threshold时，加速度与当前QPS之比超过阈值即增加分片
+func (asm *EnhancedAdaptiveShardingManager) SetAccelerationReader(read func() float64) {
+	asm.pressureMu.Lock()
+	defer asm.pressureMu.Unlock()
+	asm.readAcceleration = read
+}
+
+// SetPressureReader 替换压力数据的来源，用于测试或使用其他来源的压力数据
+func (asm *EnhancedAdaptiveShardingManager) SetPressureReader(read func() pressure.Snapshot) {
+	asm.pressureMu.Lock()
+	defer asm.pressureMu.Unlock()
+	asm.readPressure = read
+}
@@ -15,7 +15,6 @@ type EnhancedGracefulShutdown struct {
 	*BaseComponent   // 嵌入基础组件
 	shutdownTimeout time.Duration
 	doneChan        chan struct{}
-	wg              sync.WaitGroup
 	shutdownOnce    sync.Once
 	shutdownStarted atomic.Bool
 	mu              sync.RWMutex
@@ -23,10 +22,15 @@ type EnhancedGracefulShutdown struct {
 	// 增强功能
 	activeRequests  atomic.Int64    // 当前活跃请求数
 	maxWaitTime     time.Duration   // 最大等待时间
-	shutdownTime    atomic.Int64    // 关闭开始时间
+	shutdownTime    atomic.Int64    // 关闭开始时间（纳秒）
+	finishedAt      atomic.Int64    // 关闭完成时间（纳秒）
+	deadline        atomic.Int64    // 强制关闭的时间（纳秒）
+	notify          func(ShutdownProgress) // 关闭开始和完成时调用，可以为nil
 	forceShutdown   atomic.Bool     // 是否强制关闭
 	shutdownStatus  string          // 关闭状态
 	statusLock      sync.RWMutex    // 状态锁
+	rejectReads     atomic.Bool     // 关闭期间是否拒绝查询请求
+	acceptWrites    atomic.Bool     // 关闭期间是否继续接受上报请求
 }
 
 // NewEnhancedGracefulShutdown 创建一个新的增强优雅关闭管理器
@@ -44,21 +48,20 @@ func NewEnhancedGracefulShutdown(timeout, maxWait time.Duration) *EnhancedGracef
 	}
 }
 
-// StartRequest 标记一个新请求的开始，返回是否接受该请求
+// StartRequest 标记一个新的上报请求的开始，返回是否接受该请求
+// 关闭期间按上报请求的策略决定是否接受，接受的请求同样计入活跃请求，关闭流程会等待其完成
 func (gs *EnhancedGracefulShutdown) StartRequest() bool {
 	// 快速检查是否已开始关闭
-	if gs.shutdownStarted.Load() {
+	if !gs.Accepts(RequestWrite) {
 		return false
 	}
 	
 	// 增加活跃请求计数
 	gs.activeRequests.Add(1)
-	gs.wg.Add(1)
 	
 	// 二次检查，如果在增加计数后开始了关闭，需要回滚
-	if gs.shutdownStarted.Load() {
+	if !gs.Accepts(RequestWrite) {
 		gs.activeRequests.Add(-1)
-		gs.wg.Done()
 		return false
 	}
 	
@@ -68,7 +71,6 @@ func (gs *EnhancedGracefulShutdown) StartRequest() bool {
 // EndRequest 标记一个请求的结束
 func (gs *EnhancedGracefulShutdown) EndRequest() {
 	gs.activeRequests.Add(-1)
-	gs.wg.Done()
 }
 
 // ActiveRequests 返回当前活跃的请求数
@@ -98,7 +100,7 @@ func (gs *EnhancedGracefulShutdown) Shutdown(ctx context.Context) error {
 	gs.shutdownOnce.Do(func() {
 		// 标记开始关闭
 		gs.shutdownStarted.Store(true)
-		gs.shutdownTime.Store(time.Now().Unix())
+		gs.shutdownTime.Store(time.Now().UnixNano())
 		gs.SetStatus("shutting_down")
 		
 		logger.Info("开始优雅关闭服务...", 
@@ -116,13 +118,14 @@ func (gs *EnhancedGracefulShutdown) Shutdown(ctx context.Context) error {
 		// 创建一个带最大等待时间的上下文
 		maxWaitCtx, maxWaitCancel := context.WithTimeout(ctx, gs.maxWaitTime)
 		defer maxWaitCancel()
+		if deadline, ok := maxWaitCtx.Deadline(); ok {
+			gs.deadline.Store(deadline.UnixNano())
+		}
+		gs.notifyProgress()
 		
 		// 等待所有请求完成或超时
 		done := make(chan struct{})
-		go func() {
-			gs.wg.Wait()
-			close(done)
-		}()
+		go gs.waitIdle(done)
 		
 		// 定期报告剩余请求数
 		go gs.reportActiveRequests(done)
@@ -156,12 +159,26 @@ func (gs *EnhancedGracefulShutdown) Shutdown(ctx context.Context) error {
 		}
 		
 		// 关闭完成
+		gs.finishedAt.Store(time.Now().UnixNano())
+		gs.notifyProgress()
 		close(gs.doneChan)
 	})
 	
 	return shutdownErr
 }
 
+// waitIdle 活跃请求数降为0时关闭done
+// 关闭期间仍可能接受新的上报请求，因此按计数轮询而不是使用WaitGroup
+func (gs *EnhancedGracefulShutdown) waitIdle(done chan struct{}) {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	
+	for gs.ActiveRequests() > 0 {
+		<-ticker.C
+	}
+	close(done)
+}
+
 // 定期报告活跃请求数
 func (gs *EnhancedGracefulShutdown) reportActiveRequests(done chan struct{}) {
 	ticker := time.NewTicker(500 * time.Millisecond)
@@ -174,7 +191,7 @@ func (gs *EnhancedGracefulShutdown) reportActiveRequests(done chan struct{}) {
 			if active > 0 {
 				logger.Info("等待请求完成", 
 					zap.Int64("remaining", active),
-					zap.Int64("shutdown_seconds", time.Now().Unix() - gs.shutdownTime.Load()))
+					zap.Int64("shutdown_seconds", time.Now().Unix() - gs.ShutdownTime()))
 			}
 		case <-done:
 			return
@@ -199,5 +216,5 @@ func (gs *EnhancedGracefulShutdown) IsForceShutdown() bool {
 
 // ShutdownTime 返回关闭开始的时间戳
 func (gs *EnhancedGracefulShutdown) ShutdownTime() int64 {
-	return gs.shutdownTime.Load()
+	return gs.shutdownTime.Load() / int64(time.Second)
 }
\ No newline at end of file
@@ -0,0 +1,147 @@
+package counter
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mant7s/qps-counter/internal/workers"
+)
+
+const (
+	defaultHistoryRetention = time.Hour
+	historyInterval         = time.Second
+)
+
+// HistorySample 一次QPS采样
+type HistorySample struct {
+	Time time.Time `json:"time"`
+	QPS  int64     `json:"qps"`
+}
+
+// History 每秒采样一次QPS，保存在固定大小的环形缓冲区中，超过保留时长的采样被覆盖
+// 计数器空闲时采样协程暂停，这段时间没有采样
+type History struct {
+	*BaseComponent // 嵌入基础组件
+	counter        Counter
+	retention      time.Duration
+
+	worker *workers.Worker
+
+	mu      sync.RWMutex
+	samples []HistorySample
+	next    int // 下一次采样写入的位置
+	size    int // 已保存的采样数
+}
+
+// NewHistory 创建一个新的QPS历史记录并启动采样协程，retention为保留时长，不足1秒时使用1小时
+func NewHistory(counter Counter, retention time.Duration) *History {
+	h := newHistoryBuffer(retention)
+	h.counter = counter
+	h.worker = workers.Register("counter.history", historyInterval).WithIdle(IdleDetectorOf(counter).Idle)
+	h.worker.Go(nil, h.sampleWorker)
+	return h
+}
+
+// newHistoryBuffer 创建只保存采样、不启动采样协程的历史记录，由调用方通过Record写入
+func newHistoryBuffer(retention time.Duration) *History {
+	if retention < historyInterval {
+		retention = defaultHistoryRetention
+	}
+	return &History{
+		BaseComponent: NewBaseComponent(),
+		retention:     retention,
+		samples:       make([]HistorySample, int(retention/historyInterval)),
+	}
+}
+
+// sampleWorker 每秒采样当前QPS
+func (h *History) sampleWorker() {
+	ticker := time.NewTicker(historyInterval)
+	defer ticker.Stop()
+	idle := IdleDetectorOf(h.counter)
+
+	for {
+		select {
+		case now := <-ticker.C:
+			h.Record(h.counter.CurrentQPS(), now)
+			h.worker.Ran()
+			if !idle.PauseTicker(ticker, historyInterval, h.StopChan()) {
+				return
+			}
+		case <-h.StopChan():
+			return
+		}
+	}
+}
+
+// Record 记录一次采样，缓冲区已满时覆盖最早的采样
+func (h *History) Record(qps int64, at time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.samples[h.next] = HistorySample{Time: at, QPS: qps}
+	h.next = (h.next + 1) % len(h.samples)
+	if h.size < len(h.samples) {
+		h.size++
+	}
+}
+
+// Samples 返回最近duration内的采样，按时间从早到晚排列
+// duration<=0或超过保留时长时返回全部采样
+func (h *History) Samples(duration time.Duration) []HistorySample {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if h.size == 0 {
+		return []HistorySample{}
+	}
+
+	start := (h.next - h.size + len(h.samples)) % len(h.samples)
+	latest := h.samples[(h.next-1+len(h.samples))%len(h.samples)].Time
+
+	result := make([]HistorySample, 0, h.size)
+	for i := 0; i < h.size; i++ {
+		sample := h.samples[(start+i)%len(h.samples)]
+		if duration > 0 && duration < h.retention && latest.Sub(sample.Time) >= duration {
+			continue
+		}
+		result = append(result, sample)
+	}
+	return result
+}
+
+// Restore 按时间顺序写回保留时长内的采样，已经有采样时不恢复，避免新旧采样交错
+func (h *History) Restore(samples []HistorySample, now time.Time) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.size > 0 {
+		return 0
+	}
+
+	var restored int
+	for _, sample := range samples {
+		if now.Sub(sample.Time) >= h.retention || sample.Time.After(now) {
+			continue
+		}
+		h.samples[h.next] = sample
+		h.next = (h.next + 1) % len(h.samples)
+		restored++
+	}
+	h.size = min(restored, len(h.samples))
+	return h.size
+}
+
+// Retention 返回保留时长
+func (h *History) Retention() time.Duration {
+	return h.retention
+}
+
+// Interval 返回采样间隔
+func (h *History) Interval() time.Duration {
+	return historyInterval
+}
+
+// Stop 停止采样
+func (h *History) Stop() {
+	h.BaseComponent.Stop()
+}
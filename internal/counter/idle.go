@@ -0,0 +1,127 @@
+package counter
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mant7s/qps-counter/internal/config"
+)
+
+const defaultIdleTimeout = 30 * time.Second
+
+// IdleDetector 空闲检测器
+// 计数器在一段时间内没有收到任何事件时判定为空闲，此时清理、指标采集、自适应调整等
+// 后台协程停止各自的ticker并阻塞等待，下一次事件到达时立即唤醒，
+// 使大量几乎无流量的sidecar实例的CPU占用接近于零
+type IdleDetector struct {
+	timeout     time.Duration
+	granularity int64 // 活跃时间的更新粒度（纳秒），避免每次事件都写共享变量
+
+	lastActive atomic.Int64
+	idle       atomic.Bool
+	clock      Clock
+
+	mu   sync.Mutex
+	wake chan struct{} // 唤醒时关闭并替换
+}
+
+// NewIdleDetector 创建一个空闲检测器，timeout 为判定空闲所需的无事件时长
+func NewIdleDetector(timeout time.Duration) *IdleDetector {
+	if timeout <= 0 {
+		timeout = defaultIdleTimeout
+	}
+
+	d := &IdleDetector{
+		timeout:     timeout,
+		granularity: int64(timeout / 10),
+		wake:        make(chan struct{}),
+		clock:       SystemClock{},
+	}
+	d.lastActive.Store(time.Now().UnixNano())
+	return d
+}
+
+// newIdleDetector 根据计数器配置创建空闲检测器，使用计数器的时间源判断空闲时长，未启用时返回nil
+func newIdleDetector(cfg *config.CounterConfig, clock Clock) *IdleDetector {
+	if !cfg.Idle.Enabled {
+		return nil
+	}
+	d := NewIdleDetector(cfg.Idle.Timeout)
+	d.clock = clock
+	d.lastActive.Store(clock.Now().UnixNano())
+	return d
+}
+
+// IdleDetectorOf 返回计数器关联的空闲检测器，计数器未启用空闲检测时返回nil
+func IdleDetectorOf(c Counter) *IdleDetector {
+	if aware, ok := c.(interface{ IdleDetector() *IdleDetector }); ok {
+		return aware.IdleDetector()
+	}
+	return nil
+}
+
+// Touch 记录一次事件，如果当前处于空闲状态则唤醒所有等待的协程
+// now 为事件发生时间（纳秒），d为nil时不做任何操作
+func (d *IdleDetector) Touch(now int64) {
+	if d == nil {
+		return
+	}
+
+	if now-d.lastActive.Load() > d.granularity {
+		d.lastActive.Store(now)
+	}
+	if d.idle.Load() {
+		d.wakeUp()
+	}
+}
+
+// Idle 返回当前是否处于空闲状态
+func (d *IdleDetector) Idle() bool {
+	return d != nil && d.idle.Load()
+}
+
+// PauseTicker 在ticker触发后调用
+// 未达到空闲时长时立即返回true；否则停止ticker并阻塞，直到有新事件到达后
+// 以 interval 重置ticker并返回true，或stop关闭时返回false
+func (d *IdleDetector) PauseTicker(ticker *time.Ticker, interval time.Duration, stop <-chan struct{}) bool {
+	if d == nil || !d.expired() {
+		return true
+	}
+
+	d.mu.Lock()
+	wake := d.wake
+	d.idle.Store(true)
+	d.mu.Unlock()
+
+	// 设置空闲标记后再次检查，避免错过设置标记前到达的事件
+	if !d.expired() {
+		d.wakeUp()
+	}
+
+	ticker.Stop()
+	select {
+	case <-wake:
+		ticker.Reset(interval)
+		return true
+	case <-stop:
+		return false
+	}
+}
+
+// expired 判断距上次事件是否已超过空闲时长
+func (d *IdleDetector) expired() bool {
+	return d.clock.Now().UnixNano()-d.lastActive.Load() >= int64(d.timeout)
+}
+
+// wakeUp 退出空闲状态并唤醒所有等待的协程
+func (d *IdleDetector) wakeUp() {
+	if !d.idle.CompareAndSwap(true, false) {
+		return
+	}
+
+	d.mu.Lock()
+	close(d.wake)
+	d.wake = make(chan struct{})
+	d.mu.Unlock()
+}
@@ -0,0 +1,311 @@
+package counter
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/workers"
+)
+
+const defaultMaxKeys = 1000
+
+// KeyQPS 一个key及其QPS
+type KeyQPS struct {
+	Key string `json:"key"`
+	QPS int64  `json:"qps"`
+}
+
+// KeyedCounter 按上报数据中的key（如接口名、租户、服务名）分别计数
+// key的数量受 max_keys 严格限制，超出的新key会被丢弃并计数；配置idle_ttl时，超过该时长没有写入的key被清理并计数
+// counter.type为sketch时所有key都计入固定大小的count-min sketch，QPS为近似值，
+// 只有估算QPS最高的max_keys个候选key出现在列表中，不会因基数过高丢弃事件
+type KeyedCounter struct {
+	config  *config.CounterConfig
+	maxKeys int
+
+	keys     *ShardedMap[*slidingWindow] // sketch模式下只保存候选key，值为nil
+	count    atomic.Int64                // 已跟踪的key数量，用于严格限制基数
+	overflow atomic.Int64                // 因超出基数限制被丢弃的事件数
+	evicted  atomic.Int64                // 因超过idle_ttl没有写入被清理的key数
+	idleTTL  time.Duration
+
+	sketch      *countMinSketch
+	replaceMu   sync.Mutex   // 替换候选key
+	threshold   atomic.Int64 // 候选key已满时，新key的估算QPS超过该值才尝试替换QPS最低的候选key
+	thresholdAt atomic.Int64 // threshold的计算时间，超过一个精度周期后失效，候选key的QPS回落后可以被替换
+
+	worker   *workers.Worker
+	stopChan chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewKeyedCounter 创建一个按key计数的计数器，配置了idle_ttl时启动清理协程
+func NewKeyedCounter(cfg *config.CounterConfig) *KeyedCounter {
+	maxKeys := cfg.Keys.MaxKeys
+	if maxKeys <= 0 {
+		maxKeys = defaultMaxKeys
+	}
+
+	kc := &KeyedCounter{
+		config:   cfg,
+		maxKeys:  maxKeys,
+		keys:     NewShardedMap[*slidingWindow](0),
+		idleTTL:  cfg.Keys.IdleTTL,
+		stopChan: make(chan struct{}),
+	}
+	if cfg.Type == SketchType {
+		kc.sketch = newCountMinSketch(cfg)
+	}
+	// sketch模式下候选key的数量固定，QPS回落后会被替换，不需要按空闲时长清理
+	if kc.idleTTL > 0 && kc.sketch == nil {
+		kc.worker = workers.Register("counter.keys", kc.cleanupInterval())
+		kc.worker.Go(&kc.wg, kc.cleanupWorker)
+	}
+	return kc
+}
+
+// Add 为key增加n次计数，key数量已达上限时返回false；kc为nil时不计数
+func (kc *KeyedCounter) Add(key string, n int64) bool {
+	if kc == nil || key == "" || n <= 0 {
+		return false
+	}
+	if kc.sketch != nil {
+		now := time.Now().UnixNano()
+		kc.sketch.add(key, n, now)
+		kc.track(key, now)
+		return true
+	}
+
+	w, ok := kc.window(key)
+	if !ok {
+		kc.overflow.Add(n)
+		return false
+	}
+
+	w.add(n, time.Now().UnixNano())
+	return true
+}
+
+// window 返回key的窗口，key不存在时创建，key数量已达上限时返回false
+func (kc *KeyedCounter) window(key string) (*slidingWindow, bool) {
+	return kc.keys.LoadOrCreate(key, func() (*slidingWindow, bool) {
+		if kc.count.Add(1) > int64(kc.maxKeys) {
+			kc.count.Add(-1)
+			return nil, false
+		}
+		return newSlidingWindow(kc.config), true
+	})
+}
+
+// track 把key加入候选key，候选key已满且key的估算QPS超过QPS最低的候选key时替换该候选key
+func (kc *KeyedCounter) track(key string, now int64) {
+	if _, ok := kc.keys.Load(key); ok {
+		return
+	}
+	if _, ok := kc.keys.LoadOrCreate(key, func() (*slidingWindow, bool) {
+		if kc.count.Add(1) > int64(kc.maxKeys) {
+			kc.count.Add(-1)
+			return nil, false
+		}
+		return nil, true
+	}); ok {
+		return
+	}
+
+	qps := kc.sketch.rate(key, now)
+	if now-kc.thresholdAt.Load() < kc.sketch.precision && qps <= kc.threshold.Load() {
+		return
+	}
+
+	kc.replaceMu.Lock()
+	defer kc.replaceMu.Unlock()
+	if _, ok := kc.keys.Load(key); ok {
+		return
+	}
+	lowest, lowestQPS := "", int64(math.MaxInt64)
+	kc.keys.Range(func(candidate string, _ *slidingWindow) bool {
+		if rate := kc.sketch.rate(candidate, now); rate < lowestQPS {
+			lowest, lowestQPS = candidate, rate
+		}
+		return true
+	})
+	kc.threshold.Store(lowestQPS)
+	kc.thresholdAt.Store(now)
+	if lowest == "" || qps <= lowestQPS {
+		return
+	}
+	kc.keys.Delete(lowest)
+	kc.keys.LoadOrCreate(key, func() (*slidingWindow, bool) { return nil, true })
+}
+
+// rate 返回key的当前QPS，sketch模式下为估算值
+func (kc *KeyedCounter) rate(key string, w *slidingWindow, now int64) int64 {
+	if kc.sketch != nil {
+		return kc.sketch.rate(key, now)
+	}
+	return w.rate(now)
+}
+
+// QPS 返回key的当前QPS，key未被跟踪时返回false
+// sketch模式下任意key都有估算值，估算值为0时返回false，哈希冲突可能使从未上报的key也有估算值
+func (kc *KeyedCounter) QPS(key string) (int64, bool) {
+	if kc.sketch != nil {
+		qps := kc.sketch.rate(key, time.Now().UnixNano())
+		return qps, qps > 0
+	}
+	w, ok := kc.keys.Load(key)
+	if !ok {
+		return 0, false
+	}
+	return w.rate(time.Now().UnixNano()), true
+}
+
+// Top 返回QPS最高的n个key，n<=0时返回全部
+func (kc *KeyedCounter) Top(n int) []KeyQPS {
+	result := kc.Rates()
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].QPS != result[j].QPS {
+			return result[i].QPS > result[j].QPS
+		}
+		return result[i].Key < result[j].Key
+	})
+	if n > 0 && len(result) > n {
+		result = result[:n]
+	}
+	return result
+}
+
+// Rates 返回所有key的当前QPS，不排序；sketch模式下只返回候选key
+func (kc *KeyedCounter) Rates() []KeyQPS {
+	now := time.Now().UnixNano()
+
+	result := make([]KeyQPS, 0, kc.keys.Len())
+	kc.keys.Range(func(key string, w *slidingWindow) bool {
+		result = append(result, KeyQPS{Key: key, QPS: kc.rate(key, w, now)})
+		return true
+	})
+	return result
+}
+
+// KeyCount 返回当前跟踪的key数量，sketch模式下为候选key的数量
+func (kc *KeyedCounter) KeyCount() int {
+	return kc.keys.Len()
+}
+
+// MaxKeys 返回key数量上限
+func (kc *KeyedCounter) MaxKeys() int {
+	return kc.maxKeys
+}
+
+// Overflow 返回因超出基数限制被丢弃的事件数，sketch模式下不丢弃事件，始终为0
+func (kc *KeyedCounter) Overflow() int64 {
+	return kc.overflow.Load()
+}
+
+// Evicted 返回因超过idle_ttl没有写入被清理的key数
+func (kc *KeyedCounter) Evicted() int64 {
+	return kc.evicted.Load()
+}
+
+// cleanupInterval 清理间隔为idle_ttl的一半，key最多在没有写入1.5倍idle_ttl后被清理
+func (kc *KeyedCounter) cleanupInterval() time.Duration {
+	return max(kc.idleTTL/2, time.Second)
+}
+
+// cleanupWorker 定期清理空闲的key
+func (kc *KeyedCounter) cleanupWorker() {
+	ticker := time.NewTicker(kc.cleanupInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			kc.Expire(now)
+			kc.worker.Ran()
+		case <-kc.stopChan:
+			return
+		}
+	}
+}
+
+// Expire 清理在now之前超过idle_ttl没有写入的key，返回清理的key数量；未配置idle_ttl或sketch模式下不清理
+// 删除时在分片锁内重新检查最后写入时间，收集之后又有写入的key不会被清理，同一个key也不会被并发的清理重复计数；
+// 写入方在删除前已取得窗口时，这次写入仍可能随被清理的key丢失，只影响空闲了idle_ttl的key的第一次写入
+func (kc *KeyedCounter) Expire(now time.Time) int {
+	if kc == nil || kc.idleTTL <= 0 || kc.sketch != nil {
+		return 0
+	}
+
+	cutoff := now.Add(-kc.idleTTL).UnixNano()
+	idle := func(w *slidingWindow) bool {
+		return w.lastWrite() < cutoff
+	}
+	// Range期间持有分片的读锁，先收集再删除
+	var candidates []string
+	kc.keys.Range(func(key string, w *slidingWindow) bool {
+		if idle(w) {
+			candidates = append(candidates, key)
+		}
+		return true
+	})
+	expired := 0
+	for _, key := range candidates {
+		if kc.keys.DeleteIf(key, idle) {
+			kc.count.Add(-1)
+			expired++
+		}
+	}
+	kc.evicted.Add(int64(expired))
+	return expired
+}
+
+// Stop 停止清理协程，未启动清理协程时直接返回
+func (kc *KeyedCounter) Stop() {
+	if kc == nil {
+		return
+	}
+	kc.stopOnce.Do(func() {
+		close(kc.stopChan)
+	})
+	kc.wg.Wait()
+}
+
+// Snapshot 返回每个key在窗口内的非空槽位；kc为nil或sketch模式下返回nil，sketch不保存在快照中
+func (kc *KeyedCounter) Snapshot(now int64) map[string][]SlotSnapshot {
+	if kc == nil || kc.sketch != nil {
+		return nil
+	}
+
+	result := make(map[string][]SlotSnapshot)
+	kc.keys.Range(func(key string, w *slidingWindow) bool {
+		if slots := w.snapshot(now); len(slots) > 0 {
+			result[key] = slots
+		}
+		return true
+	})
+	return result
+}
+
+// Restore 恢复快照中的key，与上报一样受max_keys限制，返回恢复的key数量；kc为nil或sketch模式下不恢复
+func (kc *KeyedCounter) Restore(keys map[string][]SlotSnapshot, now int64) int {
+	if kc == nil || kc.sketch != nil {
+		return 0
+	}
+
+	var restored int
+	for key, slots := range keys {
+		if key == "" {
+			continue
+		}
+		if w, ok := kc.window(key); ok {
+			w.restore(slots, now)
+			restored++
+		}
+	}
+	return restored
+}
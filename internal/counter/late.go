@@ -0,0 +1,48 @@
+package counter
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// LateStats 带事件时间的延迟写入的统计
+type LateStats struct {
+	Placed  int64 `json:"placed"`  // 写入事件时间所在槽位的次数
+	Dropped int64 `json:"dropped"` // 事件时间已超出窗口、或槽位已被更新的时间段占用而丢弃的次数
+}
+
+var (
+	latePlaced  atomic.Int64
+	lateDropped atomic.Int64
+)
+
+// LateEvents 返回延迟写入的统计
+func LateEvents() LateStats {
+	return LateStats{Placed: latePlaced.Load(), Dropped: lateDropped.Load()}
+}
+
+// AddAt 在时间戳ts（纳秒，按计数器的时间源）所在的槽位上增加n，返回计数是否被写入
+// ts不早于当前时间时与Add相同；计数器不支持按时间写入时同样退化为Add，计入当前槽位
+func AddAt(c Counter, n int64, ts int64) bool {
+	if aware, ok := c.(interface{ AddAt(n int64, ts int64) bool }); ok {
+		return aware.AddAt(n, ts)
+	}
+	c.Add(n)
+	return true
+}
+
+// AddDelayed 把delay之前发生的n个计数写入当时所在的槽位，delay<=0时与Add相同
+// 批量上报的客户端携带事件时间时使用，只能写入仍在窗口内、且未被更新的时间段占用的槽位，
+// 无法写入时丢弃并返回false；每次延迟写入计入LateEvents
+func AddDelayed(c Counter, n int64, delay time.Duration) bool {
+	if delay <= 0 {
+		c.Add(n)
+		return true
+	}
+	if AddAt(c, n, ClockOf(c).Now().UnixNano()-int64(delay)) {
+		latePlaced.Add(1)
+		return true
+	}
+	lateDropped.Add(1)
+	return false
+}
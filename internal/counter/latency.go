@@ -0,0 +1,250 @@
+package counter
+
+import (
+	"math"
+	"math/bits"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mant7s/qps-counter/internal/config"
+)
+
+// 延迟直方图的桶划分方式，由counter.histogram选择
+const (
+	HistogramLog = "log" // 每个2的幂区间8个桶，相对误差不超过1/16，每个槽位约2.5KB
+	HistogramHDR = "hdr" // HdrHistogram的划分方式，保留3位有效数字，每个槽位约224KB
+)
+
+const defaultLatencyWindow = time.Minute
+
+// latencyLayout 延迟直方图的桶划分：延迟（微秒）按2的幂分组，每组再等分为2^subBits个桶，
+// 桶宽与组下界之比不超过1/2^subBits；小于2^subBits微秒的延迟每微秒一个桶，超过最大组的延迟计入最后一个桶
+type latencyLayout struct {
+	subBits     int
+	maxExponent int
+	buckets     int
+}
+
+var (
+	logLatencyLayout = newLatencyLayout(3, 40)  // 2^40微秒约12.7天
+	hdrLatencyLayout = newLatencyLayout(10, 36) // 2^37微秒约38小时，覆盖latency_ms的上限24小时
+)
+
+func newLatencyLayout(subBits, maxExponent int) latencyLayout {
+	sub := 1 << subBits
+	return latencyLayout{
+		subBits:     subBits,
+		maxExponent: maxExponent,
+		buckets:     sub + (maxExponent-subBits+1)*sub,
+	}
+}
+
+// LatencyStats 窗口内的延迟分布，单位为毫秒
+type LatencyStats struct {
+	Window string  `json:"window"`
+	Count  int64   `json:"count"`
+	Mean   float64 `json:"mean_ms"`
+	P50    float64 `json:"p50_ms"`
+	P95    float64 `json:"p95_ms"`
+	P99    float64 `json:"p99_ms"`
+	Max    float64 `json:"max_ms"`
+}
+
+// latencySlot 一个时间槽内的延迟直方图
+type latencySlot struct {
+	mu     sync.Mutex   // 只在槽位切换到新的时间段时加锁
+	period atomic.Int64 // 槽位所属的时间段（纳秒时间戳除以精度）
+	counts []atomic.Int64
+	sum    atomic.Int64 // 延迟之和（微秒）
+	max    atomic.Int64 // 最大延迟（微秒），不受桶宽影响
+}
+
+// LatencyHistogram 滑动窗口内的请求延迟直方图，用于统计p50/p95/p99延迟
+// 窗口按槽位划分，与slidingWindow一样不启动后台协程，读取时忽略过期槽位；
+// 槽位切换与同时写入的观测值之间不加锁，边界上的个别观测值可能计入相邻的时间段
+// nil表示未启用延迟统计，Observe和Record可以在nil上调用
+type LatencyHistogram struct {
+	layout     latencyLayout
+	slots      []latencySlot
+	precision  int64
+	windowSize int64
+}
+
+// NewLatencyHistogram 创建延迟直方图，窗口长度为counter.latency.window，默认为1分钟，槽位数与slot_num相同
+// counter.histogram为hdr时使用HdrHistogram的桶划分，否则使用对数分布的桶
+func NewLatencyHistogram(cfg *config.CounterConfig) *LatencyHistogram {
+	layout := logLatencyLayout
+	if cfg.Histogram == HistogramHDR {
+		layout = hdrLatencyLayout
+	}
+	return newLatencyHistogram(cfg, layout)
+}
+
+// newLatencyHistogram 使用指定的桶划分创建延迟直方图
+func newLatencyHistogram(cfg *config.CounterConfig, layout latencyLayout) *LatencyHistogram {
+	window := cfg.Latency.Window
+	if window <= 0 {
+		window = defaultLatencyWindow
+	}
+	slots := cfg.SlotNum
+	if slots <= 0 {
+		slots = 10
+	}
+
+	h := &LatencyHistogram{
+		layout:     layout,
+		slots:      make([]latencySlot, slots),
+		precision:  int64(window) / int64(slots),
+		windowSize: int64(window),
+	}
+	for i := range h.slots {
+		h.slots[i].counts = make([]atomic.Int64, layout.buckets)
+	}
+	return h
+}
+
+// Observe 记录一次请求的延迟，负数按0处理
+func (h *LatencyHistogram) Observe(latency time.Duration) {
+	if h == nil {
+		return
+	}
+	h.Record(latency, time.Now())
+}
+
+// Record 按给定时间记录一次请求的延迟
+func (h *LatencyHistogram) Record(latency time.Duration, at time.Time) {
+	if h == nil {
+		return
+	}
+	us := max(latency.Microseconds(), 0)
+	now := at.UnixNano()
+	period := now / h.precision
+	slot := &h.slots[period%int64(len(h.slots))]
+
+	if slot.period.Load() != period {
+		slot.mu.Lock()
+		if slot.period.Load() != period {
+			for i := range slot.counts {
+				slot.counts[i].Store(0)
+			}
+			slot.sum.Store(0)
+			slot.max.Store(0)
+			slot.period.Store(period)
+		}
+		slot.mu.Unlock()
+	}
+	slot.counts[h.layout.bucket(uint64(us))].Add(1)
+	slot.sum.Add(us)
+	for {
+		current := slot.max.Load()
+		if us <= current || slot.max.CompareAndSwap(current, us) {
+			break
+		}
+	}
+}
+
+// Stats 返回当前窗口内的延迟分布
+func (h *LatencyHistogram) Stats() LatencyStats {
+	return h.StatsAt(time.Now())
+}
+
+// StatsAt 返回截至给定时间的窗口内的延迟分布
+func (h *LatencyHistogram) StatsAt(at time.Time) LatencyStats {
+	acc := newLatencyAccumulator(h.layout)
+	h.accumulate(acc, at.UnixNano())
+	return acc.stats(time.Duration(h.windowSize))
+}
+
+// accumulate 把窗口内各槽位的计数累加到acc中
+func (h *LatencyHistogram) accumulate(acc *latencyAccumulator, now int64) {
+	current := now / h.precision
+	oldest := (now - h.windowSize) / h.precision
+
+	for i := range h.slots {
+		slot := &h.slots[i]
+		period := slot.period.Load()
+		if period <= oldest || period > current {
+			continue
+		}
+		for b := range slot.counts {
+			n := slot.counts[b].Load()
+			acc.counts[b] += n
+			acc.total += n
+		}
+		acc.sum += slot.sum.Load()
+		acc.max = max(acc.max, slot.max.Load())
+	}
+}
+
+// latencyAccumulator 一个或多个桶划分相同的直方图在窗口内的计数之和，合并后计算分位数
+type latencyAccumulator struct {
+	layout latencyLayout
+	counts []int64
+	total  int64
+	sum    int64 // 延迟之和（微秒）
+	max    int64 // 最大延迟（微秒）
+}
+
+func newLatencyAccumulator(layout latencyLayout) *latencyAccumulator {
+	return &latencyAccumulator{layout: layout, counts: make([]int64, layout.buckets)}
+}
+
+// stats 返回累加的延迟分布
+func (acc *latencyAccumulator) stats(window time.Duration) LatencyStats {
+	stats := LatencyStats{Window: WindowName(window), Count: acc.total}
+	if acc.total == 0 {
+		return stats
+	}
+	stats.Mean = float64(acc.sum) / float64(acc.total) / 1000
+	stats.Max = float64(acc.max) / 1000
+	stats.P50 = acc.quantile(0.50, stats.Max)
+	stats.P95 = acc.quantile(0.95, stats.Max)
+	stats.P99 = acc.quantile(0.99, stats.Max)
+	return stats
+}
+
+// Window 返回窗口长度
+func (h *LatencyHistogram) Window() time.Duration {
+	return time.Duration(h.windowSize)
+}
+
+// bucket 返回延迟（微秒）所在的桶
+func (l latencyLayout) bucket(us uint64) int {
+	sub := 1 << l.subBits
+	if us < uint64(sub) {
+		return int(us)
+	}
+	exponent := bits.Len64(us) - 1
+	if exponent > l.maxExponent {
+		return l.buckets - 1
+	}
+	offset := int(us>>(exponent-l.subBits)) & (sub - 1)
+	return sub + (exponent-l.subBits)*sub + offset
+}
+
+// mid 返回桶的中点（毫秒）
+func (l latencyLayout) mid(bucket int) float64 {
+	sub := 1 << l.subBits
+	if bucket < sub {
+		return float64(bucket) / 1000
+	}
+	exponent := (bucket-sub)/sub + l.subBits
+	offset := (bucket - sub) % sub
+	width := uint64(1) << (exponent - l.subBits)
+	lower := uint64(sub+offset) * width
+	return (float64(lower) + float64(width)/2) / 1000
+}
+
+// quantile 返回第q分位的观测值所在桶的中点（毫秒），不超过窗口内的最大延迟
+func (acc *latencyAccumulator) quantile(q, maxMs float64) float64 {
+	rank := max(int64(math.Ceil(q*float64(acc.total))), 1)
+	var seen int64
+	for bucket, n := range acc.counts {
+		seen += n
+		if seen >= rank {
+			return min(acc.layout.mid(bucket), maxMs)
+		}
+	}
+	return maxMs
+}
@@ -0,0 +1,161 @@
+package counter
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/mant7s/qps-counter/internal/config"
+)
+
+const defaultMaxLatencySeries = 100
+
+// latencyTagSeries 一个标签组合的延迟直方图
+type latencyTagSeries struct {
+	values    []string
+	histogram *LatencyHistogram
+}
+
+// LatencySeries 按key和标签组合分别统计的延迟直方图，单个服务的慢路由不会被全局直方图掩盖
+// key和标签组合共用counter.latency.max_series的上限，超出后新的key或组合不再统计延迟，计入溢出数；
+// 每个序列固定使用对数分布的桶，约占用 2.5KB×slot_num
+// nil表示未启用，Observe可以在nil上调用
+type LatencySeries struct {
+	config    *config.CounterConfig
+	perKey    bool
+	tagKeys   []string // 为空时不按标签统计
+	maxSeries int
+
+	keys     *ShardedMap[*LatencyHistogram]
+	tags     *ShardedMap[*latencyTagSeries]
+	count    atomic.Int64 // 已创建的序列数，用于严格限制基数
+	overflow atomic.Int64 // 因超出序列数上限未统计的观测值
+}
+
+// NewLatencySeries 根据counter.latency.per_key和per_tag创建按维度统计的延迟直方图，两者都未启用时返回nil
+func NewLatencySeries(cfg *config.CounterConfig) *LatencySeries {
+	if !cfg.Latency.PerKey && !cfg.Latency.PerTag {
+		return nil
+	}
+	maxSeries := cfg.Latency.MaxSeries
+	if maxSeries <= 0 {
+		maxSeries = defaultMaxLatencySeries
+	}
+
+	s := &LatencySeries{
+		config:    cfg,
+		perKey:    cfg.Latency.PerKey,
+		maxSeries: maxSeries,
+		keys:      NewShardedMap[*LatencyHistogram](0),
+		tags:      NewShardedMap[*latencyTagSeries](0),
+	}
+	if cfg.Latency.PerTag {
+		s.tagKeys = append([]string(nil), cfg.Tags.Keys...)
+		sort.Strings(s.tagKeys)
+	}
+	return s
+}
+
+// Observe 把一次延迟计入key和标签组合各自的直方图，key为空或事件不包含已声明的标签时跳过对应的维度
+func (s *LatencySeries) Observe(key string, attributes map[string]string, latency time.Duration) {
+	if s == nil {
+		return
+	}
+	now := time.Now()
+	if s.perKey && key != "" {
+		if h, ok := s.keys.LoadOrCreate(key, s.newHistogram); ok {
+			h.Record(latency, now)
+		} else {
+			s.overflow.Add(1)
+		}
+	}
+	if len(s.tagKeys) == 0 {
+		return
+	}
+	values, seriesKey, matched := tagValues(s.tagKeys, attributes)
+	if !matched {
+		return
+	}
+	series, ok := s.tags.LoadOrCreate(seriesKey, func() (*latencyTagSeries, bool) {
+		h, ok := s.newHistogram()
+		return &latencyTagSeries{values: values, histogram: h}, ok
+	})
+	if ok {
+		series.histogram.Record(latency, now)
+	} else {
+		s.overflow.Add(1)
+	}
+}
+
+// newHistogram 在序列数未达上限时创建一个直方图
+func (s *LatencySeries) newHistogram() (*LatencyHistogram, bool) {
+	if s.count.Add(1) > int64(s.maxSeries) {
+		s.count.Add(-1)
+		return nil, false
+	}
+	return newLatencyHistogram(s.config, logLatencyLayout), true
+}
+
+// PerKey 返回是否按key统计延迟
+func (s *LatencySeries) PerKey() bool {
+	return s != nil && s.perKey
+}
+
+// TagKeys 返回按标签统计时使用的标签名（已排序），未按标签统计时返回nil
+func (s *LatencySeries) TagKeys() []string {
+	if s == nil {
+		return nil
+	}
+	return s.tagKeys
+}
+
+// KeyStats 返回key在窗口内的延迟分布，key没有被统计过时返回false
+func (s *LatencySeries) KeyStats(key string) (LatencyStats, bool) {
+	h, ok := s.keys.Load(key)
+	if !ok {
+		return LatencyStats{Window: WindowName(s.window())}, false
+	}
+	return h.Stats(), true
+}
+
+// TagStats 合并标签值与filter匹配的所有组合的直方图，返回合并后的延迟分布和匹配的组合数
+// filter只需要包含部分标签，如只指定route时合并该路由下所有method的延迟
+func (s *LatencySeries) TagStats(filter map[string]string) (LatencyStats, int) {
+	now := time.Now().UnixNano()
+	acc := newLatencyAccumulator(logLatencyLayout)
+	var matched int
+	s.tags.Range(func(_ string, series *latencyTagSeries) bool {
+		tags := make(map[string]string, len(s.tagKeys))
+		for i, key := range s.tagKeys {
+			tags[key] = series.values[i]
+		}
+		if matchTags(tags, filter) {
+			series.histogram.accumulate(acc, now)
+			matched++
+		}
+		return true
+	})
+	return acc.stats(s.window()), matched
+}
+
+func (s *LatencySeries) window() time.Duration {
+	if s.config.Latency.Window > 0 {
+		return s.config.Latency.Window
+	}
+	return defaultLatencyWindow
+}
+
+// SeriesCount 返回当前的序列数
+func (s *LatencySeries) SeriesCount() int {
+	return int(s.count.Load())
+}
+
+// MaxSeries 返回序列数上限
+func (s *LatencySeries) MaxSeries() int {
+	return s.maxSeries
+}
+
+// Overflow 返回因超出序列数上限未统计的观测值
+func (s *LatencySeries) Overflow() int64 {
+	return s.overflow.Load()
+}
@@ -5,76 +5,304 @@ import (
 	"time"
 
 	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/workers"
 )
 
-type atomicSlot struct {
-	timestamp atomic.Int64
+// windowSlot 无锁计数器一个时间段的计数，创建后时间戳不再改变
+// 槽位切换到新的时间段时用CAS整体替换为新的windowSlot，而不是先更新时间戳再重置计数：
+// 同一时间段的写入要么安装新的windowSlot，要么累加到已安装的windowSlot上，两者不会交错，计数不会丢失
+type windowSlot struct {
+	timestamp int64 // 第一次写入的时间（纳秒）
 	count     atomic.Int64
 }
 
 type LockFreeWindow struct {
-	config     *config.CounterConfig
-	slots      []atomicSlot
-	stopChan   chan struct{}
-	totalCount atomic.Int64 // 添加一个原子计数器来跟踪总请求数
+	config      *config.CounterConfig
+	slots       []atomic.Pointer[windowSlot] // 为nil表示空槽位
+	stopChan    chan struct{}
+	totalCount  atomic.Int64  // 窗口内的总请求数，随Incr和过期清理增量维护
+	lastCleanup atomic.Int64  // 上次清理时间（纳秒）
+	created     int64         // 创建时间（纳秒）
+	idle        *IdleDetector // 空闲检测器，未启用时为nil
+	verifier    *Verifier     // 计数校验，未启用时为nil
+	clock       Clock
+	align       windowAlignment
+	worker      *workers.Worker
 }
 
 func NewLockFree(cfg *config.CounterConfig) *LockFreeWindow {
+	return NewLockFreeWithClock(cfg, SystemClock{})
+}
+
+// NewLockFreeWithClock 使用指定的时间源创建无锁计数器，槽位时间戳按时间源的单调读数推进，不受挂钟调整影响
+func NewLockFreeWithClock(cfg *config.CounterConfig, clock Clock) *LockFreeWindow {
+	clock = newMonotonicClock(clock)
+	align := newWindowAlignment(cfg)
 	w := &LockFreeWindow{
 		config:   cfg,
-		slots:    make([]atomicSlot, cfg.SlotNum),
+		slots:    make([]atomic.Pointer[windowSlot], align.slotNum(cfg)),
 		stopChan: make(chan struct{}),
+		idle:     newIdleDetector(cfg, clock),
+		verifier: newVerifier(cfg, clock),
+		clock:    clock,
+		align:    align,
+		created:  clock.Now().UnixNano(),
 	}
 
-	go w.cleanupWorker()
+	w.worker = workers.Register("counter.lockfree_window", cfg.Precision).WithIdle(w.idle.Idle)
+	w.worker.Go(nil, w.cleanupWorker)
 	return w
 }
 
 func (lfw *LockFreeWindow) Incr() {
-	now := time.Now().UnixNano()
-	precision := int64(lfw.config.Precision)
-	idx := (now / precision) % int64(len(lfw.slots))
+	lfw.Add(1)
+}
+
+// Add 在当前槽位上增加n，n<=0时忽略
+func (lfw *LockFreeWindow) Add(n int64) {
+	if n <= 0 {
+		return
+	}
+
+	now := lfw.clock.Now().UnixNano()
+	lfw.idle.Touch(now)
+	lfw.verifier.Record(n, now)
+	period := now / int64(lfw.config.Precision)
+	slot := &lfw.slots[period%int64(len(lfw.slots))]
 
-	// CAS更新槽位
 	for {
-		stored := lfw.slots[idx].timestamp.Load()
-		if stored/precision == now/precision {
-			lfw.slots[idx].count.Add(1)
-			lfw.totalCount.Add(1) // 增加总计数
+		current := slot.Load()
+		if current != nil && current.timestamp/int64(lfw.config.Precision) == period {
+			addSaturating(&current.count, n)
+			addSaturating(&lfw.totalCount, n) // 增加总计数
 			return
 		}
 
-		if stored == 0 || stored < now-precision {
-			if lfw.slots[idx].timestamp.CompareAndSwap(stored, now) {
-				lfw.slots[idx].count.Store(1)
-				lfw.totalCount.Add(1) // 增加总计数
-				return
+		// 空槽位、过期的时间段，或墙上时钟回拨后遗留的"未来"时间段，整体替换为当前时间段
+		next := &windowSlot{timestamp: now}
+		next.count.Store(n)
+		if slot.CompareAndSwap(current, next) {
+			// 从总计数中扣除被替换槽位尚未清理的计数
+			var stale int64
+			if current != nil {
+				stale = current.count.Load()
 			}
+			shiftSaturating(&lfw.totalCount, n-stale)
+			return
 		}
 	}
 }
 
+// AddAt 在时间戳ts所在的槽位上增加n，ts不早于当前时间时与Add相同
+// ts已超出窗口、或槽位已切换到更新的时间段时不写入并返回false
+func (lfw *LockFreeWindow) AddAt(n int64, ts int64) bool {
+	now := lfw.clock.Now().UnixNano()
+	if ts >= now {
+		lfw.Add(n)
+		return true
+	}
+	if n <= 0 {
+		return true
+	}
+	if !lfw.align.retains(ts, now) {
+		return false
+	}
+
+	precision := int64(lfw.config.Precision)
+	period := ts / precision
+	slot := &lfw.slots[period%int64(len(lfw.slots))]
+	for {
+		current := slot.Load()
+		if current != nil && current.timestamp/precision == period {
+			addSaturating(&current.count, n)
+			addSaturating(&lfw.totalCount, n)
+			break
+		}
+		if current != nil && current.timestamp/precision > period {
+			return false
+		}
+		next := &windowSlot{timestamp: ts}
+		next.count.Store(n)
+		if slot.CompareAndSwap(current, next) {
+			var stale int64
+			if current != nil {
+				stale = current.count.Load()
+			}
+			shiftSaturating(&lfw.totalCount, n-stale)
+			break
+		}
+	}
+	lfw.idle.Touch(now)
+	lfw.verifier.Record(n, ts)
+	return true
+}
+
+// CurrentQPS 返回当前QPS
+// 清理协程正常运行时直接使用增量维护的总计数，O(1)且不分配内存，结果最多滞后一个精度周期；
+// 清理滞后（如空闲暂停）时退化为逐槽位计算
 func (lfw *LockFreeWindow) CurrentQPS() int64 {
-	// 计算窗口内的实际QPS，而不是简单返回累计值
-	now := time.Now().UnixNano()
-	windowStart := now - int64(lfw.config.WindowSize)
+	return perSecond(lfw.windowTotal(lfw.clock.Now().UnixNano()), lfw.config.WindowSize)
+}
+
+// CurrentRate 返回当前每秒速率，不取整，低于1的速率不会显示为0
+func (lfw *LockFreeWindow) CurrentRate() float64 {
+	return ratePerSecond(lfw.windowTotal(lfw.clock.Now().UnixNano()), lfw.config.WindowSize)
+}
+
+// windowTotal 返回窗口内的总计数，清理滞后时逐槽位累加
+// 对齐窗口时总计数包含正在进行的窗口，同样逐槽位累加
+func (lfw *LockFreeWindow) windowTotal(now int64) int64 {
+	if !lfw.align.wall && now-lfw.lastCleanup.Load() <= 2*int64(lfw.config.Precision) {
+		return lfw.totalCount.Load()
+	}
+	return lfw.scanTotal(now)
+}
+
+// ScanQPS 逐槽位累加计算QPS，用于校验CurrentQPS的结果
+func (lfw *LockFreeWindow) ScanQPS() int64 {
+	return lfw.scanQPS(lfw.clock.Now().UnixNano())
+}
+
+func (lfw *LockFreeWindow) scanQPS(now int64) int64 {
+	// 计算每秒的请求数
+	return perSecond(lfw.scanTotal(now), lfw.config.WindowSize)
+}
+
+func (lfw *LockFreeWindow) scanTotal(now int64) int64 {
+	windowStart, windowEnd := lfw.align.bounds(now)
 
 	var total int64
 	for i := range lfw.slots {
-		ts := lfw.slots[i].timestamp.Load()
-		if ts >= windowStart {
-			total += lfw.slots[i].count.Load()
+		if s := lfw.slots[i].Load(); s != nil && s.timestamp >= windowStart && s.timestamp <= windowEnd {
+			total = saturatingAdd(total, s.count.Load(), OverflowSum)
 		}
 	}
+	return total
+}
 
-	// 计算每秒的请求数
-	return total * int64(time.Second) / int64(lfw.config.WindowSize)
+// Reset 清空所有槽位
+func (lfw *LockFreeWindow) Reset() {
+	lfw.verifier.Reset(lfw.clock.Now().UnixNano())
+	for i := range lfw.slots {
+		lfw.slots[i].Store(nil)
+	}
+	lfw.totalCount.Store(0)
 }
 
 func (lfw *LockFreeWindow) Stop() {
 	close(lfw.stopChan)
 }
 
+// SlotInfo 返回给定时间对应的槽位
+func (lfw *LockFreeWindow) SlotInfo(now int64) map[string]interface{} {
+	precision := int64(lfw.config.Precision)
+	idx := (now / precision) % int64(len(lfw.slots))
+	var slotTimestamp, slotCount int64
+	if s := lfw.slots[idx].Load(); s != nil {
+		slotTimestamp, slotCount = s.timestamp, s.count.Load()
+	}
+	return map[string]interface{}{
+		"type":            LockFreeType,
+		"slot":            idx,
+		"slot_timestamp":  slotTimestamp,
+		"slot_count":      slotCount,
+		"window_total":    lfw.totalCount.Load(),
+		"last_cleanup_ns": lfw.lastCleanup.Load(),
+	}
+}
+
+// Stats 返回窗口的内部状态，逐槽位统计窗口内的计数
+func (lfw *LockFreeWindow) Stats() CounterStats {
+	now := lfw.clock.Now().UnixNano()
+	windowStart, windowEnd := lfw.align.bounds(now)
+	stats := CounterStats{
+		Type:        LockFreeType,
+		WindowSize:  lfw.config.WindowSize.String(),
+		WindowStart: time.Unix(0, windowStart),
+		Slots:       len(lfw.slots),
+		LastCleanup: cleanupTime(lfw.lastCleanup.Load(), lfw.created),
+	}
+	for i := range lfw.slots {
+		if s := lfw.slots[i].Load(); s != nil && s.timestamp >= windowStart && s.timestamp <= windowEnd {
+			if count := s.count.Load(); count > 0 {
+				stats.OccupiedSlots++
+				stats.Events = saturatingAdd(stats.Events, count, OverflowSum)
+			}
+		}
+	}
+	return stats
+}
+
+// Unit 返回计数单位
+func (lfw *LockFreeWindow) Unit() string {
+	return unitOf(lfw.config)
+}
+
+// IdleDetector 返回计数器的空闲检测器
+func (lfw *LockFreeWindow) IdleDetector() *IdleDetector {
+	return lfw.idle
+}
+
+// Verifier 返回计数器的计数校验
+func (lfw *LockFreeWindow) Verifier() *Verifier {
+	return lfw.verifier
+}
+
+// Clock 返回计数器的时间源，即槽位时间戳使用的单调时钟
+func (lfw *LockFreeWindow) Clock() Clock {
+	return lfw.clock
+}
+
+// periodCount 返回槽位中一个时间段的计数，槽位已切换到其他时间段时返回0
+func (lfw *LockFreeWindow) periodCount(period int64) int64 {
+	s := lfw.slots[period%int64(len(lfw.slots))].Load()
+	if s == nil || s.timestamp/int64(lfw.config.Precision) != period {
+		return 0
+	}
+	return s.count.Load()
+}
+
+// Snapshot 返回窗口内的非空槽位
+func (lfw *LockFreeWindow) Snapshot(now int64) WindowSnapshot {
+	var slots []SlotSnapshot
+	for i := range lfw.slots {
+		if s := lfw.slots[i].Load(); s != nil && s.count.Load() > 0 && lfw.align.retains(s.timestamp, now) {
+			slots = append(slots, SlotSnapshot{Timestamp: s.timestamp, Count: s.count.Load()})
+		}
+	}
+	return WindowSnapshot{Slots: slots}
+}
+
+// Restore 按时间戳把快照中仍在窗口内的槽位写回对应位置，之后重新计算总计数
+func (lfw *LockFreeWindow) Restore(s WindowSnapshot, now int64) {
+	precision := int64(lfw.config.Precision)
+
+	for _, saved := range s.Slots {
+		if saved.Count <= 0 || !lfw.align.retains(saved.Timestamp, now) {
+			continue
+		}
+		period := saved.Timestamp / precision
+		slot := &lfw.slots[period%int64(len(lfw.slots))]
+		for {
+			current := slot.Load()
+			if current != nil && current.timestamp/precision == period {
+				addSaturating(&current.count, saved.Count)
+				break
+			}
+			// 不覆盖更新的时间段
+			if current != nil && current.timestamp/precision > period {
+				break
+			}
+			next := &windowSlot{timestamp: saved.Timestamp}
+			next.count.Store(saved.Count)
+			if slot.CompareAndSwap(current, next) {
+				break
+			}
+		}
+	}
+	lfw.cleanupExpired()
+}
+
 func (lfw *LockFreeWindow) cleanupWorker() {
 	ticker := time.NewTicker(lfw.config.Precision)
 	defer ticker.Stop()
@@ -83,6 +311,11 @@ func (lfw *LockFreeWindow) cleanupWorker() {
 		select {
 		case <-ticker.C:
 			lfw.cleanupExpired()
+			lfw.worker.Ran()
+			// 空闲时所有槽位都已过期，暂停清理直到下一次事件
+			if !lfw.idle.PauseTicker(ticker, lfw.config.Precision, lfw.stopChan) {
+				return
+			}
 		case <-lfw.stopChan:
 			return
 		}
@@ -90,27 +323,33 @@ func (lfw *LockFreeWindow) cleanupWorker() {
 }
 
 func (lfw *LockFreeWindow) cleanupExpired() {
-	now := time.Now().UnixNano()
-	windowStart := now - int64(lfw.config.WindowSize)
+	now := lfw.clock.Now().UnixNano()
+	windowStart, _ := lfw.align.bounds(now)
+	lfw.verifier.Check(now, lfw.periodCount)
 
 	// 清理过期数据，但不替换整个数组
 	for i := range lfw.slots {
-		ts := lfw.slots[i].timestamp.Load()
-		if ts > 0 && ts < windowStart {
-			// 只重置过期的槽位
-			lfw.slots[i].timestamp.Store(0)
-			lfw.slots[i].count.Store(0)
+		s := lfw.slots[i].Load()
+		if s == nil {
+			continue
+		}
+		// 只清空过期的槽位，以及时钟回拨后遗留的"未来"槽位。清理协程可能在取得now之后被挂起，
+		// 这期间写入的槽位晚于now但并非"未来"槽位，需要在读取槽位之后重新取当前时间判断；
+		// 用CAS清空，不会清掉刚被替换为新时间段的槽位
+		if s.timestamp < windowStart || (s.timestamp > now && s.timestamp > lfw.clock.Now().UnixNano()) {
+			lfw.slots[i].CompareAndSwap(s, nil)
 		}
 	}
 
-	// 重新计算总计数
+	// 重新计算总计数，包括清理开始后才写入的槽位
 	var newTotal int64
 	for i := range lfw.slots {
-		if lfw.slots[i].timestamp.Load() >= windowStart {
-			newTotal += lfw.slots[i].count.Load()
+		if s := lfw.slots[i].Load(); s != nil && s.timestamp >= windowStart {
+			newTotal = saturatingAdd(newTotal, s.count.Load(), OverflowSum)
 		}
 	}
 
-	// 更新总计数
+	// 更新总计数，修正并发更新带来的偏差
 	lfw.totalCount.Store(newTotal)
+	lfw.lastCleanup.Store(now)
 }
@@ -0,0 +1,344 @@
+//go:build unix
+
+package counter
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"runtime"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/logger"
+	"go.uber.org/zap"
+)
+
+// 共享内存文件的布局：64字节的文件头，之后为slot_num个槽位，每个槽位为一个uint64，
+// 高28位为槽位所属时间段（纳秒时间戳除以精度）的低28位，低36位为该时间段的计数
+// 时间段和计数位于同一个字，切换时间段只需一次CAS，不会与其他进程的并发写入交错丢失计数
+// 所有字段使用本机字节序，只在同一台主机的进程之间共享
+const (
+	sharedMagic      = 0x3230_4d48_5353_5051 // "QPSSHM02"
+	sharedHeaderSize = 64
+	sharedSlotSize   = 8
+
+	sharedCountBits = 36
+	sharedCountMax  = 1<<sharedCountBits - 1 // 单个槽位计数的上限，超过时停在上限
+	sharedEpochBits = 64 - sharedCountBits
+	sharedEpochMask = 1<<sharedEpochBits - 1
+)
+
+// packSharedSlot 把时间段和计数打包为一个槽位
+func packSharedSlot(period, count int64) uint64 {
+	return uint64(period&sharedEpochMask)<<sharedCountBits | uint64(count)
+}
+
+// unpackSharedSlot 按当前时间段还原槽位所属的时间段（不晚于current的最近一个低28位相同的时间段）和计数
+// 槽位所属的时间段只保存低28位，恰好间隔2^28个时间段（精度为100ms时约310天）没有写入的槽位会被误认为仍在窗口内
+func unpackSharedSlot(word uint64, current int64) (period, count int64) {
+	epoch := int64(word >> sharedCountBits)
+	return current - (current-epoch)&sharedEpochMask, int64(word & sharedCountMax)
+}
+
+// SharedWindow 基于mmap共享内存的滑动窗口，同一台主机上的多个进程（如prefork的worker）
+// 打开同一个文件后直接在共享的槽位上原子累加，不需要经过HTTP或其他进程间通信
+// 与LockFreeWindow一样整体替换槽位，但共享内存中不能保存指针，时间段和计数打包在一个字中用CAS更新；
+// 其他进程的写入不经过本进程，因此不维护增量总计数，查询时逐槽位累加，也不需要清理协程：过期的槽位在下一次写入时被替换
+// 时间源须与其他进程一致，默认使用系统的挂钟
+type SharedWindow struct {
+	config    *config.CounterConfig
+	path      string
+	file      *os.File
+	data      []byte
+	slots     []atomic.Uint64
+	precision int64
+	clock     Clock
+	stopped   atomic.Bool
+	active    atomic.Int64 // 正在访问映射内存的调用数，Stop等待其归零后解除映射
+}
+
+// OpenShared 打开或创建cfg.SharedPath指定的共享内存文件
+// 文件已存在时校验其中的窗口大小、槽位数和精度与配置一致，否则返回错误，避免不同配置的进程写入同一个窗口
+func OpenShared(cfg *config.CounterConfig) (*SharedWindow, error) {
+	return OpenSharedWithClock(cfg, SystemClock{})
+}
+
+// OpenSharedWithClock 使用指定的时间源打开共享内存文件，用于测试中模拟时间推进
+func OpenSharedWithClock(cfg *config.CounterConfig, clock Clock) (*SharedWindow, error) {
+	path := cfg.SharedPath
+	if path == "" {
+		path = DefaultSharedPath
+	}
+	if cfg.SlotNum <= 0 || cfg.Precision <= 0 || cfg.WindowSize <= 0 {
+		return nil, fmt.Errorf("共享计数器的window_size、slot_num和precision必须大于0")
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("打开共享计数器文件失败: %w", err)
+	}
+	size := sharedHeaderSize + cfg.SlotNum*sharedSlotSize
+	if err := initSharedFile(file, cfg, size); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	data, err := syscall.Mmap(int(file.Fd()), 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("映射共享计数器文件失败: %w", err)
+	}
+
+	return &SharedWindow{
+		config:    cfg,
+		path:      path,
+		file:      file,
+		data:      data,
+		slots:     unsafe.Slice((*atomic.Uint64)(unsafe.Pointer(&data[sharedHeaderSize])), cfg.SlotNum),
+		precision: int64(cfg.Precision),
+		clock:     clock,
+	}, nil
+}
+
+// initSharedFile 持有文件锁初始化或校验文件头，多个进程同时启动时只有一个进程写入文件头
+func initSharedFile(file *os.File, cfg *config.CounterConfig, size int) error {
+	fd := int(file.Fd())
+	if err := syscall.Flock(fd, syscall.LOCK_EX); err != nil {
+		return fmt.Errorf("锁定共享计数器文件失败: %w", err)
+	}
+	defer syscall.Flock(fd, syscall.LOCK_UN)
+
+	want := make([]byte, sharedHeaderSize)
+	binary.NativeEndian.PutUint64(want[0:], sharedMagic)
+	binary.NativeEndian.PutUint64(want[8:], uint64(cfg.WindowSize))
+	binary.NativeEndian.PutUint64(want[16:], uint64(cfg.SlotNum))
+	binary.NativeEndian.PutUint64(want[24:], uint64(cfg.Precision))
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("读取共享计数器文件失败: %w", err)
+	}
+	if info.Size() == 0 {
+		if err := file.Truncate(int64(size)); err != nil {
+			return fmt.Errorf("初始化共享计数器文件失败: %w", err)
+		}
+		if _, err := file.WriteAt(want, 0); err != nil {
+			return fmt.Errorf("初始化共享计数器文件失败: %w", err)
+		}
+		return nil
+	}
+
+	header := make([]byte, sharedHeaderSize)
+	if info.Size() != int64(size) {
+		return fmt.Errorf("共享计数器文件 %s 的大小与配置不一致", file.Name())
+	}
+	if _, err := file.ReadAt(header, 0); err != nil {
+		return fmt.Errorf("读取共享计数器文件失败: %w", err)
+	}
+	if string(header) != string(want) {
+		return fmt.Errorf("共享计数器文件 %s 的窗口配置与当前配置不一致", file.Name())
+	}
+	return nil
+}
+
+func (sw *SharedWindow) Incr() {
+	sw.Add(1)
+}
+
+// acquire 标记一次对映射内存的访问，已停止时返回false；返回true时调用方须调用release
+func (sw *SharedWindow) acquire() bool {
+	sw.active.Add(1)
+	if sw.stopped.Load() {
+		sw.active.Add(-1)
+		return false
+	}
+	return true
+}
+
+func (sw *SharedWindow) release() {
+	sw.active.Add(-1)
+}
+
+// Add 在当前槽位上增加n，n<=0或已停止时忽略
+func (sw *SharedWindow) Add(n int64) {
+	if n <= 0 || !sw.acquire() {
+		return
+	}
+	defer sw.release()
+	sw.add(n, sw.clock.Now().UnixNano()/sw.precision)
+}
+
+// add 在时间段period的槽位上增加n，槽位属于其他时间段（过期或时钟回拨后遗留的"未来"时间段）时整体替换
+func (sw *SharedWindow) add(n, period int64) {
+	slot := &sw.slots[period%int64(len(sw.slots))]
+	for {
+		word := slot.Load()
+		stored, count := unpackSharedSlot(word, period)
+		if count == 0 || stored != period {
+			count = 0
+		}
+		if slot.CompareAndSwap(word, packSharedSlot(period, addSharedCount(count, n))) {
+			return
+		}
+	}
+}
+
+// addSharedCount 返回count+n，超过槽位计数的上限时停在上限并计入OverflowAdd
+func addSharedCount(count, n int64) int64 {
+	if n > sharedCountMax-count {
+		overflows[OverflowAdd].Add(1)
+		return sharedCountMax
+	}
+	return count + n
+}
+
+// AddAt 在时间戳ts所在的槽位上增加n，ts不早于当前时间时与Add相同
+// ts已超出窗口、或槽位已被更新的时间段占用时不写入并返回false
+func (sw *SharedWindow) AddAt(n int64, ts int64) bool {
+	if n <= 0 || !sw.acquire() {
+		return true
+	}
+	defer sw.release()
+
+	now := sw.clock.Now().UnixNano()
+	if ts >= now {
+		sw.add(n, now/sw.precision)
+		return true
+	}
+	if !inWindow(ts, now, int64(sw.config.WindowSize)) {
+		return false
+	}
+
+	period, current := ts/sw.precision, now/sw.precision
+	slot := &sw.slots[period%int64(len(sw.slots))]
+	for {
+		word := slot.Load()
+		stored, count := unpackSharedSlot(word, current)
+		switch {
+		case count > 0 && stored == period:
+		case count > 0 && stored > period:
+			return false
+		default:
+			count = 0
+		}
+		if slot.CompareAndSwap(word, packSharedSlot(period, addSharedCount(count, n))) {
+			return true
+		}
+	}
+}
+
+// CurrentQPS 返回所有进程写入的当前QPS
+func (sw *SharedWindow) CurrentQPS() int64 {
+	return perSecond(sw.windowTotal(sw.clock.Now().UnixNano()), sw.config.WindowSize)
+}
+
+// CurrentRate 返回当前每秒速率，不取整
+func (sw *SharedWindow) CurrentRate() float64 {
+	return ratePerSecond(sw.windowTotal(sw.clock.Now().UnixNano()), sw.config.WindowSize)
+}
+
+// windowTotal 累加窗口内各槽位的计数，已停止时返回0
+func (sw *SharedWindow) windowTotal(now int64) int64 {
+	var total int64
+	sw.scan(now, func(_, count int64) {
+		total = saturatingAdd(total, count, OverflowSum)
+	})
+	return total
+}
+
+// scan 对窗口内的每个非空槽位调用fn，参数为槽位所属的时间段和计数，已停止时不调用
+func (sw *SharedWindow) scan(now int64, fn func(period, count int64)) {
+	if !sw.acquire() {
+		return
+	}
+	defer sw.release()
+
+	current := now / sw.precision
+	oldest := (now - int64(sw.config.WindowSize)) / sw.precision
+	for i := range sw.slots {
+		period, count := unpackSharedSlot(sw.slots[i].Load(), current)
+		if count > 0 && period > oldest {
+			fn(period, count)
+		}
+	}
+}
+
+// Reset 清空共享的槽位，同一文件上其他进程看到的计数同样被清空
+func (sw *SharedWindow) Reset() {
+	if !sw.acquire() {
+		return
+	}
+	defer sw.release()
+	for i := range sw.slots {
+		sw.slots[i].Store(0)
+	}
+}
+
+// Stop 停止写入，等待正在进行的调用结束后解除映射并关闭文件，文件保留供其他进程继续使用
+func (sw *SharedWindow) Stop() {
+	if sw.stopped.Swap(true) {
+		return
+	}
+	for sw.active.Load() != 0 {
+		runtime.Gosched()
+	}
+	if err := syscall.Munmap(sw.data); err != nil {
+		logger.Warn("解除共享计数器文件的映射失败", zap.String("path", sw.path), zap.Error(err))
+	}
+	sw.data, sw.slots = nil, nil
+	sw.file.Close()
+}
+
+// SlotInfo 返回给定时间对应的槽位
+func (sw *SharedWindow) SlotInfo(now int64) map[string]interface{} {
+	info := map[string]interface{}{
+		"type":         SharedType,
+		"path":         sw.path,
+		"window_total": sw.windowTotal(now),
+	}
+	if !sw.acquire() {
+		return info
+	}
+	defer sw.release()
+	current := now / sw.precision
+	idx := current % int64(len(sw.slots))
+	period, count := unpackSharedSlot(sw.slots[idx].Load(), current)
+	if count == 0 {
+		period = 0
+	}
+	info["slot"] = idx
+	info["slot_timestamp"] = period * sw.precision
+	info["slot_count"] = count
+	return info
+}
+
+// Stats 返回共享窗口的内部状态，包含所有进程写入的计数
+// 共享窗口没有清理协程，过期的槽位在下一次写入时被替换，因此不返回清理时间
+func (sw *SharedWindow) Stats() CounterStats {
+	now := sw.clock.Now().UnixNano()
+	stats := CounterStats{
+		Type:        SharedType,
+		WindowSize:  sw.config.WindowSize.String(),
+		WindowStart: time.Unix(0, now-int64(sw.config.WindowSize)),
+		Slots:       sw.config.SlotNum,
+	}
+	sw.scan(now, func(_, count int64) {
+		stats.OccupiedSlots++
+		stats.Events += count
+	})
+	return stats
+}
+
+// Unit 返回计数单位
+func (sw *SharedWindow) Unit() string {
+	return unitOf(sw.config)
+}
+
+// Clock 返回共享窗口的时间源
+func (sw *SharedWindow) Clock() Clock {
+	return sw.clock
+}
@@ -0,0 +1,24 @@
+//go:build !unix
+
+package counter
+
+import (
+	"errors"
+
+	"github.com/mant7s/qps-counter/internal/config"
+)
+
+// SharedWindow 基于mmap共享内存的滑动窗口，当前平台不支持
+type SharedWindow struct {
+	Counter
+}
+
+// OpenShared 当前平台不支持共享内存计数器
+func OpenShared(cfg *config.CounterConfig) (*SharedWindow, error) {
+	return nil, errors.New("当前平台不支持共享内存计数器")
+}
+
+// OpenSharedWithClock 当前平台不支持共享内存计数器
+func OpenSharedWithClock(cfg *config.CounterConfig, clock Clock) (*SharedWindow, error) {
+	return OpenShared(cfg)
+}
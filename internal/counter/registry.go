@@ -0,0 +1,621 @@
+package counter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/logger"
+	"github.com/mant7s/qps-counter/internal/storage"
+	"github.com/mant7s/qps-counter/internal/workers"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultMaxNamedCounters = 100
+	namedCounterKeyPrefix   = "counters/"
+
+	// CounterStateActive 命名计数器可以正常上报和查询
+	CounterStateActive = "active"
+	// CounterStateDeleted 命名计数器已删除，保留期内可以查询但不再接受上报
+	CounterStateDeleted = "deleted"
+)
+
+var (
+	ErrCounterExists      = errors.New("计数器已存在")
+	ErrCounterNotFound    = errors.New("计数器不存在")
+	ErrTooManyCounters    = errors.New("计数器数量已达上限")
+	ErrInvalidCounterName = errors.New("无效的计数器名称")
+	ErrInvalidCounterSpec = errors.New("无效的计数器定义")
+	ErrCounterDeleted     = errors.New("计数器已删除")
+
+	counterNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_.-]{1,128}$`)
+)
+
+// CounterSpec 命名计数器的定义
+type CounterSpec struct {
+	Name       string
+	Type       string
+	WindowSize time.Duration
+	SlotNum    int
+	Precision  time.Duration
+	Unit       string
+	Rollup     bool // 上报同时计入名称按 "." 划分的各级上级计数器，如 api.orders.create 计入 api.orders 和 api
+}
+
+// counterSpecJSON CounterSpec的JSON表示，时间使用 "10s" 这样的字符串
+type counterSpecJSON struct {
+	Name       string `json:"name"`
+	Type       string `json:"type,omitempty"`
+	WindowSize string `json:"window,omitempty"`
+	SlotNum    int    `json:"slots,omitempty"`
+	Precision  string `json:"precision,omitempty"`
+	Unit       string `json:"unit,omitempty"`
+	Rollup     bool   `json:"rollup,omitempty"`
+}
+
+// MarshalJSON 实现json.Marshaler接口
+func (s CounterSpec) MarshalJSON() ([]byte, error) {
+	return json.Marshal(counterSpecJSON{
+		Name:       s.Name,
+		Type:       s.Type,
+		WindowSize: s.WindowSize.String(),
+		SlotNum:    s.SlotNum,
+		Precision:  s.Precision.String(),
+		Unit:       s.Unit,
+		Rollup:     s.Rollup,
+	})
+}
+
+// UnmarshalJSON 实现json.Unmarshaler接口
+func (s *CounterSpec) UnmarshalJSON(data []byte) error {
+	var raw counterSpecJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	spec := CounterSpec{Name: raw.Name, Type: raw.Type, SlotNum: raw.SlotNum, Unit: raw.Unit, Rollup: raw.Rollup}
+	var err error
+	if raw.WindowSize != "" {
+		if spec.WindowSize, err = time.ParseDuration(raw.WindowSize); err != nil {
+			return fmt.Errorf("无效的window: %w", err)
+		}
+	}
+	if raw.Precision != "" {
+		if spec.Precision, err = time.ParseDuration(raw.Precision); err != nil {
+			return fmt.Errorf("无效的precision: %w", err)
+		}
+	}
+
+	*s = spec
+	return nil
+}
+
+// config 转换为计数器配置
+func (s CounterSpec) config() *config.CounterConfig {
+	return &config.CounterConfig{
+		Type:       s.Type,
+		WindowSize: s.WindowSize,
+		SlotNum:    s.SlotNum,
+		Precision:  s.Precision,
+		Unit:       s.Unit,
+	}
+}
+
+// CounterInfo 命名计数器的状态
+type CounterInfo struct {
+	Spec      CounterSpec `json:"spec"`
+	QPS       int64       `json:"qps"`
+	CreatedAt time.Time   `json:"created_at"`
+	State     string      `json:"state"`
+	DeletedAt *time.Time  `json:"deleted_at,omitempty"`
+	PurgeAt   *time.Time  `json:"purge_at,omitempty"`  // 保留期结束、计数器被彻底清除的时间
+	RollupTo  []string    `json:"rollup_to,omitempty"` // 上报同时计入的上级计数器，由近及远
+}
+
+type namedCounter struct {
+	spec      CounterSpec
+	counter   Counter
+	createdAt time.Time
+	deletedAt time.Time // 零值表示未删除
+}
+
+// namedCounterRecord 持久化到存储中的记录
+type namedCounterRecord struct {
+	Spec      CounterSpec `json:"spec"`
+	CreatedAt time.Time   `json:"created_at"`
+	DeletedAt *time.Time  `json:"deleted_at,omitempty"`
+}
+
+// Registry 管理运行时通过API创建的命名计数器，定义持久化在Storage中，
+// 平台工具可以为每个新接入的服务创建独立的计数器，无需修改配置文件并重启
+// 配置了删除保留期时，删除的计数器在保留期内仍可查询和恢复，保留期结束后才被清除
+type Registry struct {
+	defaults    config.CounterConfig
+	storage     storage.Storage
+	maxCounters int
+	grace       time.Duration
+
+	mu       sync.RWMutex
+	counters map[string]*namedCounter
+
+	worker   *workers.Worker
+	stopChan chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewRegistry 创建一个命名计数器注册表
+// defaults 为创建计数器时未指定参数的默认值
+func NewRegistry(defaults config.CounterConfig, store storage.Storage, maxCounters int) *Registry {
+	if maxCounters <= 0 {
+		maxCounters = defaultMaxNamedCounters
+	}
+	if store == nil {
+		store = storage.NewMemoryStorage()
+	}
+
+	r := &Registry{
+		defaults:    defaults,
+		storage:     store,
+		maxCounters: maxCounters,
+		grace:       defaults.DeleteGrace,
+		counters:    make(map[string]*namedCounter),
+		stopChan:    make(chan struct{}),
+	}
+	if r.grace > 0 {
+		r.worker = workers.Register("counter.registry_purge", r.purgeInterval())
+		r.worker.Go(&r.wg, r.purgeWorker)
+	}
+	return r
+}
+
+// Restore 从存储中恢复已持久化的计数器定义
+func (r *Registry) Restore() error {
+	records, err := r.storage.List(namedCounterKeyPrefix)
+	if err != nil {
+		return fmt.Errorf("failed to list named counters: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for key, data := range records {
+		var record namedCounterRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			return fmt.Errorf("failed to decode named counter %s: %w", key, err)
+		}
+		if _, ok := r.counters[record.Spec.Name]; ok {
+			continue
+		}
+		// 关闭保留期后，之前软删除的计数器在恢复时直接清除
+		if record.DeletedAt != nil && r.grace <= 0 {
+			if err := r.storage.Delete(key); err != nil {
+				return fmt.Errorf("failed to purge named counter %s: %w", key, err)
+			}
+			continue
+		}
+		nc := &namedCounter{
+			spec:      record.Spec,
+			counter:   r.newCounter(record.Spec),
+			createdAt: record.CreatedAt,
+		}
+		if record.DeletedAt != nil {
+			nc.deletedAt = *record.DeletedAt
+		}
+		r.counters[record.Spec.Name] = nc
+	}
+	return nil
+}
+
+// Normalize 校验计数器定义并补全默认值
+func (r *Registry) Normalize(spec CounterSpec) (CounterSpec, error) {
+	if !counterNamePattern.MatchString(spec.Name) {
+		return spec, ErrInvalidCounterName
+	}
+
+	if spec.Type == "" {
+		spec.Type = r.defaults.Type
+		// 共享内存只用于全局计数器，命名计数器使用无锁窗口；sketch只影响按key计数
+		switch spec.Type {
+		case SharedType:
+			spec.Type = LockFreeType
+		case SketchType:
+			spec.Type = ShardedType
+		}
+	}
+	if spec.WindowSize == 0 {
+		spec.WindowSize = r.defaults.WindowSize
+	}
+	if spec.SlotNum == 0 {
+		spec.SlotNum = r.defaults.SlotNum
+	}
+	if spec.Precision == 0 {
+		spec.Precision = r.defaults.Precision
+	}
+	if spec.Unit == "" {
+		spec.Unit = unitOf(&r.defaults)
+	}
+
+	switch spec.Type {
+	case ShardedType, LockFreeType:
+	default:
+		return spec, fmt.Errorf("%w: 不支持的计数器类型 %s", ErrInvalidCounterSpec, spec.Type)
+	}
+	if spec.WindowSize <= 0 || spec.Precision <= 0 || spec.SlotNum <= 0 {
+		return spec, fmt.Errorf("%w: window、slots、precision必须大于0", ErrInvalidCounterSpec)
+	}
+	if !ValidUnit(spec.Unit) {
+		return spec, fmt.Errorf("%w: 无效的计数单位 %s", ErrInvalidCounterSpec, spec.Unit)
+	}
+	if spec.Precision > spec.WindowSize {
+		return spec, fmt.Errorf("%w: precision不能大于window", ErrInvalidCounterSpec)
+	}
+	return spec, nil
+}
+
+// Validate 校验计数器定义，不检查名称是否已被使用
+func (r *Registry) Validate(spec CounterSpec) error {
+	_, err := r.Normalize(spec)
+	return err
+}
+
+// Create 创建并持久化一个命名计数器
+func (r *Registry) Create(spec CounterSpec) (CounterInfo, error) {
+	spec, err := r.Normalize(spec)
+	if err != nil {
+		return CounterInfo{}, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// 保留期内的已删除计数器仍占用名称和数量上限
+	if _, ok := r.counters[spec.Name]; ok {
+		return CounterInfo{}, ErrCounterExists
+	}
+	if len(r.counters) >= r.maxCounters {
+		return CounterInfo{}, ErrTooManyCounters
+	}
+	if err := r.checkHierarchyLocked(spec); err != nil {
+		return CounterInfo{}, err
+	}
+
+	nc := &namedCounter{spec: spec, createdAt: time.Now()}
+	if err := r.persist(nc); err != nil {
+		return CounterInfo{}, err
+	}
+
+	nc.counter = r.newCounter(spec)
+	r.counters[spec.Name] = nc
+	return r.info(nc), nil
+}
+
+// Delete 删除一个命名计数器
+// 未配置保留期时立即清除；否则标记为已删除，保留期结束后由清除协程清除
+func (r *Registry) Delete(name string) error {
+	if r.grace <= 0 {
+		return r.Purge(name)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	nc, ok := r.counters[name]
+	if !ok {
+		return ErrCounterNotFound
+	}
+	if !nc.deletedAt.IsZero() {
+		return ErrCounterDeleted
+	}
+
+	nc.deletedAt = time.Now()
+	if err := r.persist(nc); err != nil {
+		nc.deletedAt = time.Time{}
+		return err
+	}
+	return nil
+}
+
+// Undelete 恢复保留期内已删除的计数器，计数器未删除时不做任何修改
+func (r *Registry) Undelete(name string) (CounterInfo, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	nc, ok := r.counters[name]
+	if !ok {
+		return CounterInfo{}, ErrCounterNotFound
+	}
+	if nc.deletedAt.IsZero() {
+		return r.info(nc), nil
+	}
+
+	deletedAt := nc.deletedAt
+	nc.deletedAt = time.Time{}
+	if err := r.persist(nc); err != nil {
+		nc.deletedAt = deletedAt
+		return CounterInfo{}, err
+	}
+	return r.info(nc), nil
+}
+
+// Purge 立即清除一个命名计数器及其持久化定义，不经过保留期
+func (r *Registry) Purge(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.purgeLocked(name)
+}
+
+func (r *Registry) purgeLocked(name string) error {
+	nc, ok := r.counters[name]
+	if !ok {
+		return ErrCounterNotFound
+	}
+	if err := r.storage.Delete(namedCounterKeyPrefix + name); err != nil {
+		return fmt.Errorf("failed to delete named counter: %w", err)
+	}
+
+	delete(r.counters, name)
+	nc.counter.Stop()
+	return nil
+}
+
+// persist 将计数器定义和删除状态写入存储
+func (r *Registry) persist(nc *namedCounter) error {
+	record := namedCounterRecord{Spec: nc.spec, CreatedAt: nc.createdAt}
+	if !nc.deletedAt.IsZero() {
+		deletedAt := nc.deletedAt
+		record.DeletedAt = &deletedAt
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if err := r.storage.Put(namedCounterKeyPrefix+nc.spec.Name, data); err != nil {
+		return fmt.Errorf("failed to persist named counter: %w", err)
+	}
+	return nil
+}
+
+// Writable 获取一个接受上报的命名计数器，保留期内的已删除计数器返回ErrCounterDeleted
+// 开启了rollup的计数器返回的计数器在上报时同时计入当前存在且未删除的各级上级计数器
+func (r *Registry) Writable(name string) (Counter, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	nc, ok := r.counters[name]
+	if !ok {
+		return nil, ErrCounterNotFound
+	}
+	if !nc.deletedAt.IsZero() {
+		return nil, ErrCounterDeleted
+	}
+	ancestors := r.ancestorsLocked(nc)
+	if len(ancestors) == 0 {
+		return nc.counter, nil
+	}
+	rollup := &rollupCounter{Counter: nc.counter, ancestors: make([]Counter, len(ancestors))}
+	for i, a := range ancestors {
+		rollup.ancestors[i] = a.counter
+	}
+	return rollup, nil
+}
+
+// ancestorNames 返回名称按 "." 划分的各级上级名称，由近及远，如 api.orders.create 返回 api.orders 和 api
+func ancestorNames(name string) []string {
+	var names []string
+	for i := strings.LastIndexByte(name, '.'); i > 0; i = strings.LastIndexByte(name, '.') {
+		name = name[:i]
+		names = append(names, name)
+	}
+	return names
+}
+
+// ancestorsLocked 返回开启了rollup的计数器当前计入的上级计数器：已存在且未删除的各级上级，由近及远
+// 上级不必开启rollup，中间缺少的层级直接跳过；调用方需持有读锁
+func (r *Registry) ancestorsLocked(nc *namedCounter) []*namedCounter {
+	if !nc.spec.Rollup {
+		return nil
+	}
+	var ancestors []*namedCounter
+	for _, name := range ancestorNames(nc.spec.Name) {
+		if a, ok := r.counters[name]; ok && a.deletedAt.IsZero() {
+			ancestors = append(ancestors, a)
+		}
+	}
+	return ancestors
+}
+
+// checkHierarchyLocked 检查新计数器与层级中已有计数器的计数单位是否一致：
+// 开启rollup时与各级上级比较，同时与开启了rollup的下级比较，不同单位的计数不能汇总；调用方需持有写锁
+func (r *Registry) checkHierarchyLocked(spec CounterSpec) error {
+	if spec.Rollup {
+		for _, name := range ancestorNames(spec.Name) {
+			if a, ok := r.counters[name]; ok && a.spec.Unit != spec.Unit {
+				return fmt.Errorf("%w: 计数单位 %s 与上级计数器 %s 的 %s 不一致", ErrInvalidCounterSpec, spec.Unit, name, a.spec.Unit)
+			}
+		}
+	}
+	prefix := spec.Name + "."
+	for name, nc := range r.counters {
+		if nc.spec.Rollup && strings.HasPrefix(name, prefix) && nc.spec.Unit != spec.Unit {
+			return fmt.Errorf("%w: 计数单位 %s 与下级计数器 %s 的 %s 不一致", ErrInvalidCounterSpec, spec.Unit, name, nc.spec.Unit)
+		}
+	}
+	return nil
+}
+
+// rollupCounter 开启了rollup的命名计数器的写入视图，每次上报同时计入各级上级计数器
+// 查询各级计数器时得到的是该层级及其所有下级的汇总
+type rollupCounter struct {
+	Counter
+	ancestors []Counter
+}
+
+func (c *rollupCounter) Incr() {
+	c.Add(1)
+}
+
+// Add 为计数器及其各级上级增加n个计数
+func (c *rollupCounter) Add(n int64) {
+	c.Counter.Add(n)
+	for _, a := range c.ancestors {
+		a.Add(n)
+	}
+}
+
+// AddAt 在时间戳ts所在的槽位上为计数器及其各级上级增加n个计数，返回计数器本身是否写入
+func (c *rollupCounter) AddAt(n int64, ts int64) bool {
+	placed := AddAt(c.Counter, n, ts)
+	for _, a := range c.ancestors {
+		AddAt(a, n, ts)
+	}
+	return placed
+}
+
+// Unit 返回计数器的计数单位，层级中的计数单位一致
+func (c *rollupCounter) Unit() string {
+	return UnitOf(c.Counter)
+}
+
+// Clock 返回计数器本身的时间源，延迟写入按它换算事件时间
+func (c *rollupCounter) Clock() Clock {
+	return ClockOf(c.Counter)
+}
+
+// SlotInfo 返回计数器本身当前写入的槽位，用于上报的决策追踪
+func (c *rollupCounter) SlotInfo(int64) map[string]interface{} {
+	return SlotInfo(c.Counter)
+}
+
+// Get 获取一个命名计数器，包括保留期内的已删除计数器
+func (r *Registry) Get(name string) (Counter, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	nc, ok := r.counters[name]
+	if !ok {
+		return nil, false
+	}
+	return nc.counter, true
+}
+
+// Info 获取一个命名计数器的状态
+func (r *Registry) Info(name string) (CounterInfo, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	nc, ok := r.counters[name]
+	if !ok {
+		return CounterInfo{}, false
+	}
+	return r.info(nc), true
+}
+
+// List 返回所有命名计数器的状态，按名称排序
+func (r *Registry) List() []CounterInfo {
+	r.mu.RLock()
+	infos := make([]CounterInfo, 0, len(r.counters))
+	for _, nc := range r.counters {
+		infos = append(infos, r.info(nc))
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(infos, func(i, j int) bool {
+		return strings.Compare(infos[i].Spec.Name, infos[j].Spec.Name) < 0
+	})
+	return infos
+}
+
+// Stop 停止清除协程和所有命名计数器
+func (r *Registry) Stop() {
+	r.stopOnce.Do(func() {
+		close(r.stopChan)
+	})
+	r.wg.Wait()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, nc := range r.counters {
+		nc.counter.Stop()
+	}
+}
+
+// newCounter 按定义创建计数器，空闲节能等全局设置沿用默认配置
+func (r *Registry) newCounter(spec CounterSpec) Counter {
+	cfg := spec.config()
+	cfg.Idle = r.defaults.Idle
+	return NewCounter(cfg)
+}
+
+// purgeWorker 定期清除保留期已结束的计数器
+func (r *Registry) purgeWorker() {
+	ticker := time.NewTicker(r.purgeInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			r.purgeExpired(now)
+			r.worker.Ran()
+		case <-r.stopChan:
+			return
+		}
+	}
+}
+
+// purgeInterval 检查保留期是否结束的间隔，为保留期的1/10，限制在1秒到1分钟之间
+func (r *Registry) purgeInterval() time.Duration {
+	interval := r.grace / 10
+	if interval < time.Second {
+		return time.Second
+	} else if interval > time.Minute {
+		return time.Minute
+	}
+	return interval
+}
+
+// purgeExpired 清除保留期在now之前结束的计数器
+func (r *Registry) purgeExpired(now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for name, nc := range r.counters {
+		if nc.deletedAt.IsZero() || now.Before(nc.deletedAt.Add(r.grace)) {
+			continue
+		}
+		if err := r.purgeLocked(name); err != nil {
+			r.worker.Fail(err)
+			logger.Error("清除已删除的计数器失败", zap.String("name", name), zap.Error(err))
+			continue
+		}
+		logger.Info("已清除保留期结束的计数器", zap.String("name", name))
+	}
+}
+
+func (r *Registry) info(nc *namedCounter) CounterInfo {
+	info := CounterInfo{
+		Spec:      nc.spec,
+		QPS:       nc.counter.CurrentQPS(),
+		CreatedAt: nc.createdAt,
+		State:     CounterStateActive,
+	}
+	if !nc.deletedAt.IsZero() {
+		deletedAt, purgeAt := nc.deletedAt, nc.deletedAt.Add(r.grace)
+		info.State = CounterStateDeleted
+		info.DeletedAt = &deletedAt
+		info.PurgeAt = &purgeAt
+	}
+	for _, a := range r.ancestorsLocked(nc) {
+		info.RollupTo = append(info.RollupTo, a.spec.Name)
+	}
+	return info
+}
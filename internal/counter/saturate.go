@@ -0,0 +1,117 @@
+package counter
+
+import (
+	"math"
+	"math/bits"
+	"sync/atomic"
+	"time"
+)
+
+// 计数溢出的类型，作为qps_counter_arithmetic_overflow_total的kind标签
+const (
+	OverflowAdd      = "add"      // 槽位或总计数的写入超过上限（int64，共享窗口的槽位为2^36-1），计数停在上限
+	OverflowSum      = "sum"      // 累加窗口内的槽位时超过int64上限
+	OverflowRate     = "rate"     // 按窗口长度换算每秒速率时超过int64上限
+	OverflowNegative = "negative" // 换算速率时总计数为负（如总计数在时钟回拨后被多扣），按0处理
+)
+
+var overflows = map[string]*atomic.Int64{
+	OverflowAdd:      {},
+	OverflowSum:      {},
+	OverflowRate:     {},
+	OverflowNegative: {},
+}
+
+// Overflows 返回各类型的计数溢出次数
+// 每秒字节数等计数单位在长窗口下可能超过int64，此时计数停在上限而不是回绕为负数，每次截断计入对应的类型
+func Overflows() map[string]int64 {
+	result := make(map[string]int64, len(overflows))
+	for kind, n := range overflows {
+		result[kind] = n.Load()
+	}
+	return result
+}
+
+// saturatingAdd 返回a+b，超出int64范围时返回上限或下限并计入kind
+func saturatingAdd(a, b int64, kind string) int64 {
+	sum, ok := clampedAdd(a, b)
+	if !ok {
+		overflows[kind].Add(1)
+	}
+	return sum
+}
+
+// clampedAdd 返回a+b，超出int64范围时返回上限或下限，ok为false
+func clampedAdd(a, b int64) (sum int64, ok bool) {
+	sum = a + b
+	// a、b同号且和的符号不同说明发生了溢出
+	if (a >= 0) == (b >= 0) && (sum >= 0) != (a >= 0) {
+		if a >= 0 {
+			return math.MaxInt64, false
+		}
+		return math.MinInt64, false
+	}
+	return sum, true
+}
+
+// addSaturating 为原子计数增加n（n>0），超过int64上限时停在上限
+// 没有溢出时只做一次原子加法；溢出后回绕的值接近下限，改回上限，期间其他写入叠加在回绕值上同样会被改回
+func addSaturating(v *atomic.Int64, n int64) {
+	if sum := v.Add(n); sum-n <= sum {
+		return
+	}
+	overflows[OverflowAdd].Add(1)
+	for {
+		current := v.Load()
+		if current > math.MinInt64/2 || v.CompareAndSwap(current, math.MaxInt64) {
+			return
+		}
+	}
+}
+
+// shiftSaturating 为原子计数加上delta（可以为负），结果超出int64范围时停在上限或下限
+// 用于替换槽位时同时扣除旧计数、加上新计数，只在CAS成功后计入溢出次数
+func shiftSaturating(v *atomic.Int64, delta int64) {
+	for {
+		current := v.Load()
+		next, ok := clampedAdd(current, delta)
+		if v.CompareAndSwap(current, next) {
+			if !ok {
+				overflows[OverflowAdd].Add(1)
+			}
+			return
+		}
+	}
+}
+
+// perSecond 把窗口内的总计数换算为每秒速率，total*1s/window超过int64时返回上限，总计数为负时返回0
+func perSecond(total int64, window time.Duration) int64 {
+	if total < 0 {
+		overflows[OverflowNegative].Add(1)
+		return 0
+	}
+	if window <= 0 {
+		return 0
+	}
+	// 128位乘法避免total*1e9溢出
+	hi, lo := bits.Mul64(uint64(total), uint64(time.Second))
+	if hi >= uint64(window) {
+		overflows[OverflowRate].Add(1)
+		return math.MaxInt64
+	}
+	quo, _ := bits.Div64(hi, lo, uint64(window))
+	if quo > math.MaxInt64 {
+		overflows[OverflowRate].Add(1)
+		return math.MaxInt64
+	}
+	return int64(quo)
+}
+
+// ratePerSecond 与perSecond相同，不取整；总计数为负时返回0
+func ratePerSecond(total int64, window time.Duration) float64 {
+	if total < 0 {
+		overflows[OverflowNegative].Add(1)
+		return 0
+	}
+	return float64(total) / window.Seconds()
+}
@@ -7,13 +7,22 @@ import (
 	"time"
 
 	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/workers"
 )
 
 type ShardedWindow struct {
-	config     *config.CounterConfig
-	shards     []*shard
-	stopChan   chan struct{}
-	totalCount atomic.Int64 // 添加一个原子计数器来跟踪总请求数
+	config      *config.CounterConfig
+	shards      []*shard
+	stopChan    chan struct{}
+	totalCount  atomic.Int64  // 窗口内的总请求数，随Incr和过期清理增量维护
+	lastCleanup atomic.Int64  // 上次清理时间（纳秒）
+	created     int64         // 创建时间（纳秒）
+	idle        *IdleDetector // 空闲检测器，未启用时为nil
+	verifier    *Verifier     // 计数校验，未启用时为nil
+	clock       Clock
+	align       windowAlignment
+	slotNum     int // 每个分片的槽位数，对齐窗口时为slot_num的两倍
+	worker      *workers.Worker
 }
 
 type shard struct {
@@ -28,13 +37,26 @@ type slot struct {
 }
 
 func NewSharded(cfg *config.CounterConfig) Counter {
+	return NewShardedWithClock(cfg, SystemClock{})
+}
+
+// NewShardedWithClock 使用指定的时间源创建分片计数器，槽位时间戳按时间源的单调读数推进，不受挂钟调整影响
+func NewShardedWithClock(cfg *config.CounterConfig, clock Clock) *ShardedWindow {
+	clock = newMonotonicClock(clock)
 	shardNum := runtime.NumCPU() * 4
-	slotNum := cfg.SlotNum
+	align := newWindowAlignment(cfg)
+	slotNum := align.slotNum(cfg)
 
 	sw := &ShardedWindow{
 		config:   cfg,
 		shards:   make([]*shard, shardNum),
 		stopChan: make(chan struct{}),
+		idle:     newIdleDetector(cfg, clock),
+		verifier: newVerifier(cfg, clock),
+		clock:    clock,
+		align:    align,
+		slotNum:  slotNum,
+		created:  clock.Now().UnixNano(),
 	}
 
 	for i := range sw.shards {
@@ -47,19 +69,31 @@ func NewSharded(cfg *config.CounterConfig) Counter {
 		}
 	}
 
-	go sw.cleanupWorker()
+	sw.worker = workers.Register("counter.sharded_window", cfg.Precision).WithIdle(sw.idle.Idle)
+	sw.worker.Go(nil, sw.cleanupWorker)
 	return sw
 }
 
 func (sw *ShardedWindow) Incr() {
+	sw.Add(1)
+}
+
+// Add 在当前槽位上增加n，n<=0时忽略
+func (sw *ShardedWindow) Add(n int64) {
+	if n <= 0 {
+		return
+	}
+
 	// 使用请求时间哈希选择分片
-	now := time.Now().UnixNano()
+	now := sw.clock.Now().UnixNano()
+	sw.idle.Touch(now)
+	sw.verifier.Record(n, now)
 	precisionNano := int64(sw.config.Precision)
 
 	slotTime := now - (now % precisionNano)
 	// 使用固定的哈希算法确保分片均匀
 	shardID := (now / precisionNano) % int64(len(sw.shards))
-	slotID := (now / precisionNano) % int64(sw.config.SlotNum)
+	slotID := (now / precisionNano) % int64(sw.slotNum)
 
 	s := sw.shards[shardID]
 	s.shardLock.RLock()
@@ -71,18 +105,99 @@ func (sw *ShardedWindow) Incr() {
 	// 更新时间戳但不重置计数
 	if s.slots[slotID].timestamp < slotTime {
 		s.slots[slotID].timestamp = slotTime
+	} else if s.slots[slotID].timestamp > slotTime {
+		// 槽位时间戳晚于当前时间说明墙上时钟发生了回拨，重新开始计数
+		s.slots[slotID].timestamp = slotTime
+		shiftSaturating(&sw.totalCount, -s.slots[slotID].count)
+		s.slots[slotID].count = 0
 	}
 
 	// 增加计数
-	s.slots[slotID].count++
+	s.slots[slotID].count = saturatingAdd(s.slots[slotID].count, n, OverflowAdd)
 
 	// 同时增加总计数
-	sw.totalCount.Add(1)
+	addSaturating(&sw.totalCount, n)
+}
+
+// AddAt 在时间戳ts所在的槽位上增加n，ts不早于当前时间时与Add相同
+// ts已超出窗口、或槽位已切换到更新的时间段时不写入并返回false
+func (sw *ShardedWindow) AddAt(n int64, ts int64) bool {
+	now := sw.clock.Now().UnixNano()
+	if ts >= now {
+		sw.Add(n)
+		return true
+	}
+	if n <= 0 {
+		return true
+	}
+
+	precisionNano := int64(sw.config.Precision)
+	slotTime := ts - (ts % precisionNano)
+	// 槽位时间戳取时间段的起点，按起点判断是否仍在窗口内
+	if !sw.align.retains(slotTime, now) {
+		return false
+	}
+	shardID := (ts / precisionNano) % int64(len(sw.shards))
+	slotID := (ts / precisionNano) % int64(sw.slotNum)
+
+	s := sw.shards[shardID]
+	s.shardLock.RLock()
+	defer s.shardLock.RUnlock()
+
+	s.slotMutex[slotID].Lock()
+	defer s.slotMutex[slotID].Unlock()
+
+	current := s.slots[slotID]
+	if current.timestamp > slotTime {
+		return false
+	}
+	if current.timestamp < slotTime {
+		// 过期的时间段，重新开始计数
+		shiftSaturating(&sw.totalCount, -current.count)
+		current.timestamp = slotTime
+		current.count = 0
+	}
+	current.count = saturatingAdd(current.count, n, OverflowAdd)
+	addSaturating(&sw.totalCount, n)
+
+	sw.idle.Touch(now)
+	sw.verifier.Record(n, ts)
+	return true
 }
 
+// CurrentQPS 返回当前QPS
+// 清理协程正常运行时直接使用增量维护的总计数，O(1)且无需获取任何锁，结果最多滞后一个精度周期；
+// 清理滞后（如空闲暂停）时退化为逐槽位计算
 func (sw *ShardedWindow) CurrentQPS() int64 {
-	now := time.Now().UnixNano()
-	windowStart := now - int64(sw.config.WindowSize)
+	return perSecond(sw.windowTotal(sw.clock.Now().UnixNano()), sw.config.WindowSize)
+}
+
+// CurrentRate 返回当前每秒速率，不取整，低于1的速率不会显示为0
+func (sw *ShardedWindow) CurrentRate() float64 {
+	return ratePerSecond(sw.windowTotal(sw.clock.Now().UnixNano()), sw.config.WindowSize)
+}
+
+// windowTotal 返回窗口内的总计数，清理滞后时逐槽位累加
+// 对齐窗口时总计数包含正在进行的窗口，同样逐槽位累加
+func (sw *ShardedWindow) windowTotal(now int64) int64 {
+	if !sw.align.wall && now-sw.lastCleanup.Load() <= 2*int64(sw.config.Precision) {
+		return sw.totalCount.Load()
+	}
+	return sw.scanTotal(now)
+}
+
+// ScanQPS 逐槽位累加计算QPS，用于校验CurrentQPS的结果
+func (sw *ShardedWindow) ScanQPS() int64 {
+	return sw.scanQPS(sw.clock.Now().UnixNano())
+}
+
+func (sw *ShardedWindow) scanQPS(now int64) int64 {
+	// 计算每秒的请求数
+	return perSecond(sw.scanTotal(now), sw.config.WindowSize)
+}
+
+func (sw *ShardedWindow) scanTotal(now int64) int64 {
+	windowStart, windowEnd := sw.align.bounds(now)
 
 	var total int64
 	for shardID := range sw.shards {
@@ -91,22 +206,164 @@ func (sw *ShardedWindow) CurrentQPS() int64 {
 		for slotID := range shard.slots {
 			// 使用读锁来允许并发读取
 			shard.slotMutex[slotID].RLock()
-			if shard.slots[slotID].timestamp >= windowStart {
-				total += shard.slots[slotID].count
+			if ts := shard.slots[slotID].timestamp; ts >= windowStart && ts <= windowEnd {
+				total = saturatingAdd(total, shard.slots[slotID].count, OverflowSum)
 			}
 			shard.slotMutex[slotID].RUnlock()
 		}
 		shard.shardLock.RUnlock()
 	}
+	return total
+}
 
-	// 计算每秒的请求数
-	return total * int64(time.Second) / int64(sw.config.WindowSize)
+// Reset 清空所有分片的槽位
+func (sw *ShardedWindow) Reset() {
+	sw.verifier.Reset(sw.clock.Now().UnixNano())
+	for _, s := range sw.shards {
+		s.shardLock.RLock()
+		for slotID := range s.slots {
+			s.slotMutex[slotID].Lock()
+			s.slots[slotID].timestamp = 0
+			s.slots[slotID].count = 0
+			s.slotMutex[slotID].Unlock()
+		}
+		s.shardLock.RUnlock()
+	}
+	sw.totalCount.Store(0)
 }
 
 func (sw *ShardedWindow) Stop() {
 	close(sw.stopChan)
 }
 
+// SlotInfo 返回给定时间对应的分片和槽位
+func (sw *ShardedWindow) SlotInfo(now int64) map[string]interface{} {
+	precisionNano := int64(sw.config.Precision)
+	shardID := (now / precisionNano) % int64(len(sw.shards))
+	slotID := (now / precisionNano) % int64(sw.slotNum)
+
+	s := sw.shards[shardID]
+	s.shardLock.RLock()
+	s.slotMutex[slotID].RLock()
+	slotTimestamp, slotCount := s.slots[slotID].timestamp, s.slots[slotID].count
+	s.slotMutex[slotID].RUnlock()
+	s.shardLock.RUnlock()
+
+	return map[string]interface{}{
+		"type":            ShardedType,
+		"shard":           shardID,
+		"slot":            slotID,
+		"slot_timestamp":  slotTimestamp,
+		"slot_count":      slotCount,
+		"window_total":    sw.totalCount.Load(),
+		"last_cleanup_ns": sw.lastCleanup.Load(),
+	}
+}
+
+// Stats 返回窗口的内部状态，逐槽位统计窗口内的计数
+func (sw *ShardedWindow) Stats() CounterStats {
+	now := sw.clock.Now().UnixNano()
+	windowStart, windowEnd := sw.align.bounds(now)
+	stats := CounterStats{
+		Type:        ShardedType,
+		WindowSize:  sw.config.WindowSize.String(),
+		WindowStart: time.Unix(0, windowStart),
+		Slots:       len(sw.shards) * sw.slotNum,
+		LastCleanup: cleanupTime(sw.lastCleanup.Load(), sw.created),
+	}
+	for _, s := range sw.shards {
+		s.shardLock.RLock()
+		for slotID := range s.slots {
+			s.slotMutex[slotID].RLock()
+			if ts, count := s.slots[slotID].timestamp, s.slots[slotID].count; count > 0 && ts >= windowStart && ts <= windowEnd {
+				stats.OccupiedSlots++
+				stats.Events = saturatingAdd(stats.Events, count, OverflowSum)
+			}
+			s.slotMutex[slotID].RUnlock()
+		}
+		s.shardLock.RUnlock()
+	}
+	return stats
+}
+
+// Unit 返回计数单位
+func (sw *ShardedWindow) Unit() string {
+	return unitOf(sw.config)
+}
+
+// IdleDetector 返回计数器的空闲检测器
+func (sw *ShardedWindow) IdleDetector() *IdleDetector {
+	return sw.idle
+}
+
+// Verifier 返回计数器的计数校验
+func (sw *ShardedWindow) Verifier() *Verifier {
+	return sw.verifier
+}
+
+// Clock 返回计数器的时间源，即槽位时间戳使用的单调时钟
+func (sw *ShardedWindow) Clock() Clock {
+	return sw.clock
+}
+
+// periodCount 返回一个时间段的计数，同一时间段的计数都写入同一个分片的同一个槽位
+func (sw *ShardedWindow) periodCount(period int64) int64 {
+	s := sw.shards[period%int64(len(sw.shards))]
+	slotID := period % int64(sw.slotNum)
+
+	s.shardLock.RLock()
+	defer s.shardLock.RUnlock()
+	s.slotMutex[slotID].RLock()
+	defer s.slotMutex[slotID].RUnlock()
+	if s.slots[slotID].timestamp != period*int64(sw.config.Precision) {
+		return 0
+	}
+	return s.slots[slotID].count
+}
+
+// Snapshot 返回窗口内的非空槽位
+func (sw *ShardedWindow) Snapshot(now int64) WindowSnapshot {
+	var slots []SlotSnapshot
+	for _, s := range sw.shards {
+		s.shardLock.RLock()
+		for slotID := range s.slots {
+			s.slotMutex[slotID].RLock()
+			if ts, count := s.slots[slotID].timestamp, s.slots[slotID].count; count > 0 && sw.align.retains(ts, now) {
+				slots = append(slots, SlotSnapshot{Timestamp: ts, Count: count})
+			}
+			s.slotMutex[slotID].RUnlock()
+		}
+		s.shardLock.RUnlock()
+	}
+	return WindowSnapshot{Slots: slots}
+}
+
+// Restore 把快照中仍在窗口内的槽位写回其时间段对应的分片和槽位，之后重新计算总计数
+// 分片数随CPU核心数变化，槽位按时间戳重新定位，不依赖保存快照时的分片数
+func (sw *ShardedWindow) Restore(snapshot WindowSnapshot, now int64) {
+	precisionNano := int64(sw.config.Precision)
+
+	for _, saved := range snapshot.Slots {
+		if saved.Count <= 0 || !sw.align.retains(saved.Timestamp, now) {
+			continue
+		}
+		period := saved.Timestamp / precisionNano
+		s := sw.shards[period%int64(len(sw.shards))]
+		slotID := period % int64(sw.slotNum)
+
+		s.shardLock.RLock()
+		s.slotMutex[slotID].Lock()
+		if s.slots[slotID].timestamp != period*precisionNano {
+			s.slots[slotID].timestamp = period * precisionNano
+			s.slots[slotID].count = 0
+		}
+		s.slots[slotID].count = saturatingAdd(s.slots[slotID].count, saved.Count, OverflowAdd)
+		s.slotMutex[slotID].Unlock()
+		s.shardLock.RUnlock()
+	}
+	sw.cleanupExpired()
+}
+
 func (sw *ShardedWindow) cleanupWorker() {
 	ticker := time.NewTicker(sw.config.Precision)
 	defer ticker.Stop()
@@ -115,6 +372,11 @@ func (sw *ShardedWindow) cleanupWorker() {
 		select {
 		case <-ticker.C:
 			sw.cleanupExpired()
+			sw.worker.Ran()
+			// 空闲时所有槽位都已过期，暂停清理直到下一次事件
+			if !sw.idle.PauseTicker(ticker, sw.config.Precision, sw.stopChan) {
+				return
+			}
 		case <-sw.stopChan:
 			return
 		}
@@ -122,8 +384,9 @@ func (sw *ShardedWindow) cleanupWorker() {
 }
 
 func (sw *ShardedWindow) cleanupExpired() {
-	now := time.Now().UnixNano()
-	windowStart := now - int64(sw.config.WindowSize)
+	now := sw.clock.Now().UnixNano()
+	windowStart, _ := sw.align.bounds(now)
+	sw.verifier.Check(now, sw.periodCount)
 
 	// 重置totalCount计数器，避免无限增长
 	var newTotal int64
@@ -137,14 +400,14 @@ func (sw *ShardedWindow) cleanupExpired() {
 		for slotID := range shard.slots {
 			shard.slotMutex[slotID].Lock()
 
-			if shard.slots[slotID].timestamp >= windowStart {
-				// 只保留未过期的数据
+			if ts := shard.slots[slotID].timestamp; ts >= windowStart && ts <= now {
+				// 只保留未过期的数据，时钟回拨后遗留的"未来"槽位同样丢弃
 				newSlots[slotID] = &slot{
 					timestamp: shard.slots[slotID].timestamp,
 					count:     shard.slots[slotID].count,
 				}
 				// 累加有效计数到新的总计数
-				newTotal += shard.slots[slotID].count
+				newTotal = saturatingAdd(newTotal, shard.slots[slotID].count, OverflowSum)
 			} else {
 				// 为过期槽位创建新的空对象
 				newSlots[slotID] = &slot{}
@@ -158,6 +421,7 @@ func (sw *ShardedWindow) cleanupExpired() {
 		shard.shardLock.Unlock()
 	}
 
-	// 更新总计数
+	// 更新总计数，修正并发更新带来的偏差
 	sw.totalCount.Store(newTotal)
+	sw.lastCleanup.Store(now)
 }
@@ -0,0 +1,58 @@
+package counter
+
+// 关闭期间的请求类别
+const (
+	RequestRead  = "read"  // 查询和统计接口
+	RequestWrite = "write" // 上报接口
+)
+
+// 关闭期间对一类请求的处理策略
+const (
+	DrainAccept = "accept" // 继续接受请求
+	DrainReject = "reject" // 返回503
+)
+
+// SetPolicy 设置关闭期间各类请求的处理策略，为空时使用默认策略：查询继续接受，上报拒绝
+func (gs *EnhancedGracefulShutdown) SetPolicy(read, write string) {
+	gs.rejectReads.Store(read == DrainReject)
+	gs.acceptWrites.Store(write == DrainAccept)
+}
+
+// Accepts 返回当前是否接受该类请求，未开始关闭时接受所有请求
+func (gs *EnhancedGracefulShutdown) Accepts(class string) bool {
+	if !gs.shutdownStarted.Load() {
+		return true
+	}
+	if class == RequestWrite {
+		return gs.acceptWrites.Load()
+	}
+	return !gs.rejectReads.Load()
+}
+
+// Policy 返回关闭期间各类请求的处理策略
+func (gs *EnhancedGracefulShutdown) Policy() map[string]string {
+	policy := map[string]string{RequestRead: DrainAccept, RequestWrite: DrainReject}
+	if gs.rejectReads.Load() {
+		policy[RequestRead] = DrainReject
+	}
+	if gs.acceptWrites.Load() {
+		policy[RequestWrite] = DrainAccept
+	}
+	return policy
+}
+
+// ShutdownStats 优雅关闭的状态，/stats、/stats/v2、Prometheus指标和qpsctl共用同一个结构
+type ShutdownStats struct {
+	Status         string            `json:"status"`
+	ActiveRequests int64             `json:"active_requests"`
+	Policy         map[string]string `json:"policy"` // 关闭期间各类请求的处理策略
+}
+
+// Stats 返回优雅关闭的状态，关闭进度见Progress
+func (gs *EnhancedGracefulShutdown) Stats() ShutdownStats {
+	return ShutdownStats{
+		Status:         gs.Status(),
+		ActiveRequests: gs.ActiveRequests(),
+		Policy:         gs.Policy(),
+	}
+}
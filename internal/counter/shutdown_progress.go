@@ -0,0 +1,52 @@
+package counter
+
+import "time"
+
+// ShutdownProgress 优雅关闭的进度，供编排系统在滚动发布时跟踪各副本的排空情况
+type ShutdownProgress struct {
+	Phase          string     `json:"phase"` // running、shutting_down、timeout_waiting或关闭完成时的状态
+	ActiveRequests int64      `json:"active_requests"`
+	StartedAt      *time.Time `json:"started_at,omitempty"`
+	ElapsedSeconds float64    `json:"elapsed_seconds"`    // 关闭开始后经过的时间，关闭完成后不再增长
+	Deadline       *time.Time `json:"deadline,omitempty"` // 超过该时间仍有请求时强制关闭，取max_wait和调用方超时中较早的一个
+	Finished       bool       `json:"finished"`
+	Forced         bool       `json:"forced"` // 是否因达到最大等待时间而强制关闭
+}
+
+// SetNotify 设置关闭开始和关闭完成时调用的函数，需要在关闭前设置
+func (gs *EnhancedGracefulShutdown) SetNotify(fn func(ShutdownProgress)) {
+	gs.notify = fn
+}
+
+func (gs *EnhancedGracefulShutdown) notifyProgress() {
+	if gs.notify != nil {
+		gs.notify(gs.Progress())
+	}
+}
+
+// Progress 返回当前的关闭进度，未开始关闭时只有阶段和活跃请求数
+func (gs *EnhancedGracefulShutdown) Progress() ShutdownProgress {
+	progress := ShutdownProgress{
+		Phase:          gs.Status(),
+		ActiveRequests: gs.ActiveRequests(),
+		Forced:         gs.IsForceShutdown(),
+	}
+	ns := gs.shutdownTime.Load()
+	if ns == 0 {
+		return progress
+	}
+
+	startedAt := time.Unix(0, ns)
+	end := time.Now()
+	if finished := gs.finishedAt.Load(); finished > 0 {
+		end = time.Unix(0, finished)
+		progress.Finished = true
+	}
+	progress.StartedAt = &startedAt
+	if deadline := gs.deadline.Load(); deadline > 0 {
+		d := time.Unix(0, deadline)
+		progress.Deadline = &d
+	}
+	progress.ElapsedSeconds = end.Sub(startedAt).Seconds()
+	return progress
+}
@@ -0,0 +1,116 @@
+package counter
+
+import (
+	"hash/maphash"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mant7s/qps-counter/internal/config"
+)
+
+const (
+	defaultSketchWidth = 2048
+	defaultSketchDepth = 4
+)
+
+// sketchSlot 一个时间槽内的计数矩阵
+type sketchSlot struct {
+	mu     sync.Mutex   // 只在槽位切换到新的时间段时加锁
+	period atomic.Int64 // 槽位所属的时间段（纳秒时间戳除以精度）
+	counts []atomic.Int64
+}
+
+// countMinSketch 滑动窗口内的count-min sketch，用固定的内存估算任意数量的key的QPS
+// 每个槽位一个depth×width的计数矩阵，每个key在每一行计入一个哈希位置，估算值取各行的最小值；
+// 哈希冲突只会使估算值偏高，偏差不超过窗口内总计数的e/width，超出的概率不超过e^-depth
+type countMinSketch struct {
+	seed       maphash.Seed
+	width      int
+	depth      int
+	slots      []sketchSlot
+	precision  int64
+	windowSize int64
+}
+
+// newCountMinSketch 按counter.keys.sketch_width和sketch_depth创建sketch，默认为2048×4，
+// 槽位数和精度与计数器相同，每个槽位占用width×depth×8字节
+func newCountMinSketch(cfg *config.CounterConfig) *countMinSketch {
+	width := cfg.Keys.SketchWidth
+	if width <= 0 {
+		width = defaultSketchWidth
+	}
+	depth := cfg.Keys.SketchDepth
+	if depth <= 0 {
+		depth = defaultSketchDepth
+	}
+
+	s := &countMinSketch{
+		seed:       maphash.MakeSeed(),
+		width:      width,
+		depth:      depth,
+		slots:      make([]sketchSlot, cfg.SlotNum),
+		precision:  int64(cfg.Precision),
+		windowSize: int64(cfg.WindowSize),
+	}
+	for i := range s.slots {
+		s.slots[i].counts = make([]atomic.Int64, width*depth)
+	}
+	return s
+}
+
+// hash 返回key的哈希值，高低32位用于双重哈希得到各行的位置
+func (s *countMinSketch) hash(key string) (uint32, uint32) {
+	h := maphash.String(s.seed, key)
+	return uint32(h), uint32(h>>32) | 1
+}
+
+// cell 返回哈希值在第row行中的位置
+func (s *countMinSketch) cell(row int, h1, h2 uint32) int {
+	return row*s.width + int((h1+uint32(row)*h2)%uint32(s.width))
+}
+
+// add 在当前时间所在的槽位上为key增加n
+func (s *countMinSketch) add(key string, n int64, now int64) {
+	period := now / s.precision
+	slot := &s.slots[period%int64(len(s.slots))]
+
+	if slot.period.Load() != period {
+		slot.mu.Lock()
+		if slot.period.Load() != period {
+			for i := range slot.counts {
+				slot.counts[i].Store(0)
+			}
+			slot.period.Store(period)
+		}
+		slot.mu.Unlock()
+	}
+	h1, h2 := s.hash(key)
+	for row := 0; row < s.depth; row++ {
+		addSaturating(&slot.counts[s.cell(row, h1, h2)], n)
+	}
+}
+
+// rate 估算key在窗口内的每秒速率，不会低于实际速率
+func (s *countMinSketch) rate(key string, now int64) int64 {
+	current := now / s.precision
+	oldest := (now - s.windowSize) / s.precision
+
+	h1, h2 := s.hash(key)
+	var estimate int64 = -1
+	for row := 0; row < s.depth; row++ {
+		cell := s.cell(row, h1, h2)
+		var total int64
+		for i := range s.slots {
+			slot := &s.slots[i]
+			if period := slot.period.Load(); period <= oldest || period > current {
+				continue
+			}
+			total = saturatingAdd(total, slot.counts[cell].Load(), OverflowSum)
+		}
+		if estimate < 0 || total < estimate {
+			estimate = total
+		}
+	}
+	return perSecond(estimate, time.Duration(s.windowSize))
+}
@@ -0,0 +1,134 @@
+package counter
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/mant7s/qps-counter/internal/config"
+)
+
+// slidingWindow 轻量级滑动窗口
+// 与LockFreeWindow不同，它不启动后台清理协程，读取时按时间戳过滤过期槽位，
+// 适合按维度划分出的大量序列；槽位切换时与LockFreeWindow一样整体替换windowSlot，并发写入不会丢失计数
+type slidingWindow struct {
+	slots      []atomic.Pointer[windowSlot] // 为nil表示空槽位
+	precision  int64
+	windowSize int64
+}
+
+func newSlidingWindow(cfg *config.CounterConfig) *slidingWindow {
+	return &slidingWindow{
+		slots:      make([]atomic.Pointer[windowSlot], cfg.SlotNum),
+		precision:  int64(cfg.Precision),
+		windowSize: int64(cfg.WindowSize),
+	}
+}
+
+// add 在当前时间所在的槽位上增加n，n<=0时忽略
+func (w *slidingWindow) add(n int64, now int64) {
+	if n <= 0 {
+		return
+	}
+	period := now / w.precision
+	slot := &w.slots[period%int64(len(w.slots))]
+
+	for {
+		current := slot.Load()
+		if current != nil && current.timestamp/w.precision == period {
+			addSaturating(&current.count, n)
+			return
+		}
+
+		// 空槽位、过期的时间段，或时钟回拨遗留的"未来"时间段，整体替换为当前时间段
+		next := &windowSlot{timestamp: now}
+		next.count.Store(n)
+		if slot.CompareAndSwap(current, next) {
+			return
+		}
+	}
+}
+
+// addAt 在时间戳ts所在的槽位上增加n，ts已超出窗口或槽位已被更新的时间段占用时返回false
+func (w *slidingWindow) addAt(n int64, ts int64, now int64) bool {
+	if ts >= now {
+		w.add(n, now)
+		return true
+	}
+	if n <= 0 {
+		return true
+	}
+	if !inWindow(ts, now, w.windowSize) {
+		return false
+	}
+
+	period := ts / w.precision
+	slot := &w.slots[period%int64(len(w.slots))]
+	for {
+		current := slot.Load()
+		if current != nil && current.timestamp/w.precision == period {
+			addSaturating(&current.count, n)
+			return true
+		}
+		if current != nil && current.timestamp/w.precision > period {
+			return false
+		}
+		next := &windowSlot{timestamp: ts}
+		next.count.Store(n)
+		if slot.CompareAndSwap(current, next) {
+			return true
+		}
+	}
+}
+
+// rate 计算窗口内的每秒速率
+func (w *slidingWindow) rate(now int64) int64 {
+	windowStart := now - w.windowSize
+
+	var total int64
+	for i := range w.slots {
+		if s := w.slots[i].Load(); s != nil && s.timestamp >= windowStart && s.timestamp <= now {
+			total = saturatingAdd(total, s.count.Load(), OverflowSum)
+		}
+	}
+
+	return perSecond(total, time.Duration(w.windowSize))
+}
+
+// lastWrite 返回最近一次写入所在精度周期内第一次写入的时间，从未写入时返回0
+func (w *slidingWindow) lastWrite() int64 {
+	var last int64
+	for i := range w.slots {
+		if s := w.slots[i].Load(); s != nil && s.timestamp > last {
+			last = s.timestamp
+		}
+	}
+	return last
+}
+
+// reset 清空所有槽位
+func (w *slidingWindow) reset() {
+	for i := range w.slots {
+		w.slots[i].Store(nil)
+	}
+}
+
+// snapshot 返回窗口内的非空槽位，没有时返回nil
+func (w *slidingWindow) snapshot(now int64) []SlotSnapshot {
+	var slots []SlotSnapshot
+	for i := range w.slots {
+		if s := w.slots[i].Load(); s != nil && s.count.Load() > 0 && inWindow(s.timestamp, now, w.windowSize) {
+			slots = append(slots, SlotSnapshot{Timestamp: s.timestamp, Count: s.count.Load()})
+		}
+	}
+	return slots
+}
+
+// restore 把仍在窗口内的槽位写回对应位置，槽位已有同一时间段的计数时两者相加
+func (w *slidingWindow) restore(slots []SlotSnapshot, now int64) {
+	for _, saved := range slots {
+		if saved.Count <= 0 || !inWindow(saved.Timestamp, now, w.windowSize) {
+			continue
+		}
+		w.addAt(saved.Count, saved.Timestamp, now)
+	}
+}
@@ -0,0 +1,12 @@
+package counter
+
+// SlotInfo 返回计数器在当前时间会写入的槽位，用于请求级别的决策追踪
+// 计数器不支持时返回nil
+func SlotInfo(c Counter) map[string]interface{} {
+	if aware, ok := c.(interface {
+		SlotInfo(now int64) map[string]interface{}
+	}); ok {
+		return aware.SlotInfo(ClockOf(c).Now().UnixNano())
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package counter
+
+// SlotSnapshot 快照中的一个非空槽位
+type SlotSnapshot struct {
+	Timestamp int64 `json:"t"` // 槽位时间戳（纳秒）
+	Count     int64 `json:"c"`
+}
+
+// WindowSnapshot 计数器窗口的快照，只包含窗口内的非空槽位
+type WindowSnapshot struct {
+	Slots   []SlotSnapshot            `json:"slots"`
+	Windows map[string][]SlotSnapshot `json:"windows,omitempty"` // counter.windows中附加窗口的槽位，键为窗口名，如 5m
+}
+
+// SnapshotOf 返回计数器窗口在now时的快照，计数器不支持快照（如shared类型）时返回false
+func SnapshotOf(c Counter, now int64) (WindowSnapshot, bool) {
+	if aware, ok := c.(interface {
+		Snapshot(now int64) WindowSnapshot
+	}); ok {
+		return aware.Snapshot(now), true
+	}
+	return WindowSnapshot{}, false
+}
+
+// RestoreSnapshot 把快照中在now时仍在窗口内的槽位写回计数器，返回计数器是否支持快照
+// 槽位已有同一时间段的计数时两者相加，因此可以在计数器开始接收请求之后恢复
+func RestoreSnapshot(c Counter, s WindowSnapshot, now int64) bool {
+	if aware, ok := c.(interface {
+		Restore(s WindowSnapshot, now int64)
+	}); ok {
+		aware.Restore(s, now)
+		return true
+	}
+	return false
+}
+
+// inWindow 返回槽位时间戳在now时是否仍在窗口内
+func inWindow(ts, now, windowSize int64) bool {
+	return ts > 0 && ts >= now-windowSize && ts <= now
+}
@@ -0,0 +1,152 @@
+package counter
+
+import (
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/mant7s/qps-counter/internal/config"
+)
+
+const defaultMaxTaggedSeries = 1000
+
+// tagSeparator 拼接标签值时使用的分隔符，标签值中不会出现该字符
+const tagSeparator = "\x00"
+
+// TaggedSeries 一个标签组合及其QPS
+type TaggedSeries struct {
+	Tags map[string]string `json:"tags"`
+	QPS  int64             `json:"qps"`
+}
+
+// taggedSeries 一个标签组合对应的滑动窗口
+type taggedSeries struct {
+	values []string
+	window *slidingWindow
+}
+
+// TaggedCounter 按标签组合（如 route、method、status）分别计数
+// 只统计配置中声明的标签，标签组合数量受 max_series 严格限制，超出的新组合会被丢弃并计数
+type TaggedCounter struct {
+	config    *config.CounterConfig
+	keys      []string
+	maxSeries int
+
+	series   *ShardedMap[*taggedSeries]
+	count    atomic.Int64 // 已创建的标签组合数量，用于严格限制基数
+	overflow atomic.Int64 // 因超出基数限制被丢弃的事件数
+}
+
+// NewTaggedCounter 创建一个按标签组合计数的计数器
+func NewTaggedCounter(cfg *config.CounterConfig) *TaggedCounter {
+	maxSeries := cfg.Tags.MaxSeries
+	if maxSeries <= 0 {
+		maxSeries = defaultMaxTaggedSeries
+	}
+
+	keys := append([]string(nil), cfg.Tags.Keys...)
+	sort.Strings(keys)
+
+	return &TaggedCounter{
+		config:    cfg,
+		keys:      keys,
+		maxSeries: maxSeries,
+		series:    NewShardedMap[*taggedSeries](0),
+	}
+}
+
+// Keys 返回参与计数的标签名（已排序）
+func (tc *TaggedCounter) Keys() []string {
+	return tc.keys
+}
+
+// Add 为事件的标签组合增加n次计数
+// 事件不包含任何已声明的标签，或标签组合数已达上限时返回false；tc为nil时不计数
+func (tc *TaggedCounter) Add(attributes map[string]string, n int64) bool {
+	if tc == nil || n <= 0 {
+		return false
+	}
+	values, seriesKey, matched := tagValues(tc.keys, attributes)
+	if !matched {
+		return false
+	}
+
+	s, ok := tc.series.LoadOrCreate(seriesKey, func() (*taggedSeries, bool) {
+		if tc.count.Add(1) > int64(tc.maxSeries) {
+			tc.count.Add(-1)
+			return nil, false
+		}
+		return &taggedSeries{values: values, window: newSlidingWindow(tc.config)}, true
+	})
+	if !ok {
+		tc.overflow.Add(n)
+		return false
+	}
+
+	s.window.add(n, time.Now().UnixNano())
+	return true
+}
+
+// Series 返回所有标签组合及其当前QPS，filter 非空时只返回标签值匹配的组合
+func (tc *TaggedCounter) Series(filter map[string]string) []TaggedSeries {
+	now := time.Now().UnixNano()
+
+	result := make([]TaggedSeries, 0, tc.series.Len())
+	tc.series.Range(func(_ string, s *taggedSeries) bool {
+		tags := make(map[string]string, len(tc.keys))
+		for i, key := range tc.keys {
+			tags[key] = s.values[i]
+		}
+		if matchTags(tags, filter) {
+			result = append(result, TaggedSeries{Tags: tags, QPS: s.window.rate(now)})
+		}
+		return true
+	})
+
+	sort.Slice(result, func(i, j int) bool { return result[i].QPS > result[j].QPS })
+	return result
+}
+
+// SeriesCount 返回当前的标签组合数量
+func (tc *TaggedCounter) SeriesCount() int {
+	return tc.series.Len()
+}
+
+// MaxSeries 返回标签组合数量上限
+func (tc *TaggedCounter) MaxSeries() int {
+	return tc.maxSeries
+}
+
+// Overflow 返回因超出基数限制被丢弃的事件数
+func (tc *TaggedCounter) Overflow() int64 {
+	return tc.overflow.Load()
+}
+
+// tagValues 按keys的顺序取出事件的标签值，返回标签值、拼接后的序列键，以及事件是否包含任一已声明的标签
+func tagValues(keys []string, attributes map[string]string) ([]string, string, bool) {
+	if len(attributes) == 0 {
+		return nil, "", false
+	}
+	values := make([]string, len(keys))
+	matched := false
+	for i, key := range keys {
+		if value, ok := attributes[key]; ok {
+			values[i] = strings.ReplaceAll(value, tagSeparator, "")
+			matched = true
+		}
+	}
+	if !matched {
+		return nil, "", false
+	}
+	return values, strings.Join(values, tagSeparator), true
+}
+
+func matchTags(tags, filter map[string]string) bool {
+	for key, value := range filter {
+		if tags[key] != value {
+			return false
+		}
+	}
+	return true
+}
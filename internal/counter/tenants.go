@@ -0,0 +1,213 @@
+package counter
+
+import (
+	"crypto/subtle"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/workers"
+)
+
+const (
+	defaultTenantHeader    = "X-Tenant-ID"
+	defaultMaxTenants      = 100
+	defaultTenantRetention = time.Hour
+	maxTenantIDLength      = 128
+)
+
+// tenantPartition 一个租户的计数窗口和QPS历史
+type tenantPartition struct {
+	window  *slidingWindow
+	history *History
+}
+
+// TenantStore 按租户分区的计数和QPS历史
+// 每个租户有独立的滑动窗口和历史环形缓冲区，采样协程每秒为所有租户各记录一次QPS；
+// 租户数量受max_tenants严格限制，超出的新租户的计数被丢弃并计入overflow
+// 查询令牌与租户一一对应，API按请求携带的令牌决定可以查询哪个租户的数据
+// nil表示未启用租户分区，所有方法都可以在nil上调用
+type TenantStore struct {
+	config     *config.CounterConfig
+	header     string
+	maxTenants int
+	retention  time.Duration
+	tokens     []config.TenantToken
+
+	partitions *ShardedMap[*tenantPartition]
+	count      atomic.Int64 // 已创建的租户分区数量
+	overflow   atomic.Int64 // 因超出租户数量上限被丢弃的计数
+
+	worker   *workers.Worker
+	stopChan chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewTenantStore 创建租户分区存储并启动采样协程，未启用时返回nil
+func NewTenantStore(cfg *config.CounterConfig, tenants config.TenantsConfig) *TenantStore {
+	if !tenants.Enabled {
+		return nil
+	}
+
+	s := &TenantStore{
+		config:     cfg,
+		header:     tenants.Header,
+		maxTenants: tenants.MaxTenants,
+		retention:  tenants.Retention,
+		tokens:     append([]config.TenantToken(nil), tenants.Tokens...),
+		partitions: NewShardedMap[*tenantPartition](0),
+		stopChan:   make(chan struct{}),
+	}
+	if s.header == "" {
+		s.header = defaultTenantHeader
+	}
+	if s.maxTenants <= 0 {
+		s.maxTenants = defaultMaxTenants
+	}
+	if s.retention < historyInterval {
+		s.retention = defaultTenantRetention
+	}
+
+	s.worker = workers.Register("counter.tenants", historyInterval)
+	s.worker.Go(&s.wg, s.sampleWorker)
+	return s
+}
+
+// Header 返回上报时携带租户标识的请求头名称
+func (s *TenantStore) Header() string {
+	if s == nil {
+		return ""
+	}
+	return s.header
+}
+
+// TenantForToken 返回查询令牌对应的租户，令牌不属于任何租户时返回false
+// 逐个比较所有令牌且每次比较耗时恒定，响应时间不泄露令牌内容
+func (s *TenantStore) TenantForToken(token string) (string, bool) {
+	if s == nil || token == "" {
+		return "", false
+	}
+	tenant, found := "", false
+	for _, t := range s.tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(t.Token)) == 1 {
+			tenant, found = t.Tenant, true
+		}
+	}
+	return tenant, found
+}
+
+// Add 为租户增加n个计数，租户为空、过长或租户数已达上限时不计数
+func (s *TenantStore) Add(tenant string, n int64) bool {
+	if s == nil || n <= 0 || tenant == "" || len(tenant) > maxTenantIDLength {
+		return false
+	}
+
+	p, ok := s.partitions.LoadOrCreate(tenant, func() (*tenantPartition, bool) {
+		if s.count.Add(1) > int64(s.maxTenants) {
+			s.count.Add(-1)
+			return nil, false
+		}
+		return &tenantPartition{window: newSlidingWindow(s.config), history: newHistoryBuffer(s.retention)}, true
+	})
+	if !ok {
+		s.overflow.Add(n)
+		return false
+	}
+
+	p.window.add(n, time.Now().UnixNano())
+	return true
+}
+
+// QPS 返回租户的当前QPS，租户还没有计数时返回false
+func (s *TenantStore) QPS(tenant string) (int64, bool) {
+	if s == nil {
+		return 0, false
+	}
+	p, ok := s.partitions.Load(tenant)
+	if !ok {
+		return 0, false
+	}
+	return p.window.rate(time.Now().UnixNano()), true
+}
+
+// History 返回租户的QPS历史，租户还没有计数时返回nil
+func (s *TenantStore) History(tenant string) *History {
+	if s == nil {
+		return nil
+	}
+	p, ok := s.partitions.Load(tenant)
+	if !ok {
+		return nil
+	}
+	return p.history
+}
+
+// Retention 返回每个租户QPS历史的保留时长
+func (s *TenantStore) Retention() time.Duration {
+	if s == nil {
+		return 0
+	}
+	return s.retention
+}
+
+// Interval 返回QPS历史的采样间隔
+func (s *TenantStore) Interval() time.Duration {
+	return historyInterval
+}
+
+// Sample 为每个租户记录一次at时的QPS
+func (s *TenantStore) Sample(at time.Time) {
+	if s == nil {
+		return
+	}
+	now := at.UnixNano()
+	s.partitions.Range(func(_ string, p *tenantPartition) bool {
+		p.history.Record(p.window.rate(now), at)
+		return true
+	})
+}
+
+// GetStats 获取租户分区的状态，不包含令牌
+func (s *TenantStore) GetStats() map[string]interface{} {
+	if s == nil {
+		return map[string]interface{}{"enabled": false}
+	}
+	return map[string]interface{}{
+		"enabled":     true,
+		"header":      s.header,
+		"tenants":     s.count.Load(),
+		"max_tenants": s.maxTenants,
+		"retention":   s.retention.String(),
+		"tokens":      len(s.tokens),
+		"overflow":    s.overflow.Load(),
+	}
+}
+
+// sampleWorker 每秒为所有租户采样一次QPS
+func (s *TenantStore) sampleWorker() {
+	ticker := time.NewTicker(historyInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			s.Sample(now)
+			s.worker.Ran()
+		case <-s.stopChan:
+			return
+		}
+	}
+}
+
+// Stop 停止采样协程
+func (s *TenantStore) Stop() {
+	if s == nil {
+		return
+	}
+	s.stopOnce.Do(func() {
+		close(s.stopChan)
+	})
+	s.wg.Wait()
+}
@@ -0,0 +1,195 @@
+package counter
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mant7s/qps-counter/internal/workers"
+)
+
+const (
+	defaultTrendAlpha              = 0.3
+	defaultTrendInterval           = time.Second
+	defaultTrendAccelerationWindow = 10 * time.Second
+)
+
+// Trend 平滑后的QPS及其变化率
+type Trend struct {
+	RawQPS       int64     `json:"raw_qps"`      // 最近一次采样的原始QPS
+	SmoothedQPS  float64   `json:"smoothed_qps"` // EWMA平滑后的QPS
+	Derivative   float64   `json:"derivative"`   // 平滑QPS的变化率（QPS/秒）
+	Acceleration float64   `json:"acceleration"` // 最近采样的原始QPS按最小二乘拟合的斜率（请求数/秒²），不经过平滑
+	Alpha        float64   `json:"alpha"`        // 平滑系数
+	SampledAt    time.Time `json:"sampled_at"`   // 最近一次采样时间
+}
+
+// TrendTracker 周期性采样QPS，计算EWMA平滑值及其导数，以及最近采样的原始QPS的加速度，
+// 为自动扩缩容等消费者提供比原始窗口值更稳定的信号
+type TrendTracker struct {
+	*BaseComponent // 嵌入基础组件
+	counter        Counter
+	alpha          float64
+	interval       time.Duration
+
+	worker *workers.Worker
+
+	mu          sync.RWMutex
+	trend       Trend
+	initialized bool
+	recent      []HistorySample // 计算Acceleration的最近采样，环形缓冲区
+	next        int
+	size        int
+}
+
+// NewTrendTracker 创建一个新的趋势跟踪器并启动采样协程
+// alpha 取值范围 (0, 1]，越大越贴近原始值；interval 为采样间隔
+func NewTrendTracker(counter Counter, alpha float64, interval time.Duration) *TrendTracker {
+	if alpha <= 0 || alpha > 1 {
+		alpha = defaultTrendAlpha
+	}
+	if interval <= 0 {
+		interval = defaultTrendInterval
+	}
+
+	tt := &TrendTracker{
+		BaseComponent: NewBaseComponent(),
+		counter:       counter,
+		alpha:         alpha,
+		interval:      interval,
+		trend:         Trend{Alpha: alpha},
+		recent:        make([]HistorySample, recentSamples(defaultTrendAccelerationWindow, interval)),
+	}
+
+	tt.worker = workers.Register("counter.trend", interval).WithIdle(IdleDetectorOf(counter).Idle)
+	tt.worker.Go(nil, tt.sampleWorker)
+	return tt
+}
+
+// sampleWorker 周期性采样当前QPS
+func (tt *TrendTracker) sampleWorker() {
+	ticker := time.NewTicker(tt.interval)
+	defer ticker.Stop()
+	idle := IdleDetectorOf(tt.counter)
+
+	for {
+		select {
+		case now := <-ticker.C:
+			tt.Observe(tt.counter.CurrentQPS(), now)
+			tt.worker.Ran()
+			if !idle.PauseTicker(ticker, tt.interval, tt.StopChan()) {
+				return
+			}
+		case <-tt.StopChan():
+			return
+		}
+	}
+}
+
+// recentSamples 返回覆盖window所需的采样数，至少为2
+func recentSamples(window, interval time.Duration) int {
+	return max(int(window/interval)+1, 2)
+}
+
+// SetAccelerationWindow 设置计算Acceleration使用的时间范围，window<=0时使用10秒，已有的采样被清空
+func (tt *TrendTracker) SetAccelerationWindow(window time.Duration) {
+	if window <= 0 {
+		window = defaultTrendAccelerationWindow
+	}
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+	tt.recent = make([]HistorySample, recentSamples(window, tt.interval))
+	tt.next, tt.size = 0, 0
+	tt.trend.Acceleration = 0
+}
+
+// Observe 记录一次QPS采样并更新平滑值、导数和加速度
+func (tt *TrendTracker) Observe(qps int64, at time.Time) {
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+
+	if !tt.initialized {
+		tt.trend.RawQPS = qps
+		tt.trend.SmoothedQPS = float64(qps)
+		tt.trend.SampledAt = at
+		tt.initialized = true
+		tt.record(qps, at)
+		return
+	}
+
+	elapsed := at.Sub(tt.trend.SampledAt).Seconds()
+	if elapsed <= 0 {
+		// 乱序或重复采样，只更新原始值
+		tt.trend.RawQPS = qps
+		return
+	}
+
+	previous := tt.trend.SmoothedQPS
+	smoothed := tt.alpha*float64(qps) + (1-tt.alpha)*previous
+
+	tt.trend.RawQPS = qps
+	tt.trend.SmoothedQPS = smoothed
+	tt.trend.Derivative = (smoothed - previous) / elapsed
+	tt.trend.SampledAt = at
+	tt.record(qps, at)
+}
+
+// record 把采样写入环形缓冲区并重新计算加速度，调用方持有写锁
+func (tt *TrendTracker) record(qps int64, at time.Time) {
+	tt.recent[tt.next] = HistorySample{Time: at, QPS: qps}
+	tt.next = (tt.next + 1) % len(tt.recent)
+	if tt.size < len(tt.recent) {
+		tt.size++
+	}
+	tt.trend.Acceleration = tt.slope()
+}
+
+// slope 对缓冲区中的采样做最小二乘线性拟合，返回QPS对时间（秒）的斜率
+func (tt *TrendTracker) slope() float64 {
+	if tt.size < 2 {
+		return 0
+	}
+	oldest := (tt.next - tt.size + len(tt.recent)) % len(tt.recent)
+	origin := tt.recent[oldest].Time
+
+	var sumX, sumY float64
+	for i := 0; i < tt.size; i++ {
+		s := tt.recent[(oldest+i)%len(tt.recent)]
+		sumX += s.Time.Sub(origin).Seconds()
+		sumY += float64(s.QPS)
+	}
+	meanX, meanY := sumX/float64(tt.size), sumY/float64(tt.size)
+
+	var cov, variance float64
+	for i := 0; i < tt.size; i++ {
+		s := tt.recent[(oldest+i)%len(tt.recent)]
+		dx := s.Time.Sub(origin).Seconds() - meanX
+		cov += dx * (float64(s.QPS) - meanY)
+		variance += dx * dx
+	}
+	if variance == 0 {
+		return 0
+	}
+	return cov / variance
+}
+
+// Trend 返回当前的趋势数据
+func (tt *TrendTracker) Trend() Trend {
+	tt.mu.RLock()
+	defer tt.mu.RUnlock()
+	return tt.trend
+}
+
+// Acceleration 返回最近一段时间原始QPS的变化率（请求数/秒²），tt为nil时返回0
+func (tt *TrendTracker) Acceleration() float64 {
+	if tt == nil {
+		return 0
+	}
+	tt.mu.RLock()
+	defer tt.mu.RUnlock()
+	return tt.trend.Acceleration
+}
+
+// Stop 停止采样
+func (tt *TrendTracker) Stop() {
+	tt.BaseComponent.Stop()
+}
@@ -0,0 +1,130 @@
+package counter
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+
+	"github.com/mant7s/qps-counter/internal/config"
+)
+
+// 内置计数单位，其他名称（如 tokens、rows）按自定义单位处理
+const (
+	UnitEvents   = "events"
+	UnitRequests = "requests"
+	UnitBytes    = "bytes"
+)
+
+var unitPattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]{0,31}$`)
+
+// ValidUnit 判断计数单位名称是否合法
+func ValidUnit(unit string) bool {
+	return unitPattern.MatchString(unit)
+}
+
+// unitOf 返回配置的计数单位，未配置时为events
+func unitOf(cfg *config.CounterConfig) string {
+	if cfg.Unit == "" {
+		return UnitEvents
+	}
+	return cfg.Unit
+}
+
+// UnitOf 返回计数器的计数单位，计数器未声明单位时为events
+func UnitOf(c Counter) string {
+	if aware, ok := c.(interface{ Unit() string }); ok {
+		return aware.Unit()
+	}
+	return UnitEvents
+}
+
+// RateOf 返回计数器当前的每秒速率，计数器不支持小数速率时使用CurrentQPS
+func RateOf(c Counter) float64 {
+	if aware, ok := c.(interface{ CurrentRate() float64 }); ok {
+		return aware.CurrentRate()
+	}
+	return float64(c.CurrentQPS())
+}
+
+// RoundRate 将速率四舍五入到precision位小数
+func RoundRate(rate float64, precision int) float64 {
+	scale := math.Pow10(precision)
+	return math.Round(rate*scale) / scale
+}
+
+// 速率的时间单位
+const (
+	PerSecond = "second"
+	PerMinute = "minute"
+	PerHour   = "hour"
+)
+
+// perUnits 各时间单位包含的秒数和格式化时使用的缩写
+var perUnits = map[string]struct {
+	seconds float64
+	suffix  string
+}{
+	PerSecond: {1, "s"},
+	PerMinute: {60, "min"},
+	PerHour:   {3600, "h"},
+}
+
+// ValidPer 判断速率的时间单位是否合法
+func ValidPer(per string) bool {
+	_, ok := perUnits[per]
+	return ok
+}
+
+// RatePer 将每秒速率换算为每分钟或每小时的速率，per不合法时按每秒处理
+func RatePer(rate float64, per string) float64 {
+	if u, ok := perUnits[per]; ok {
+		return rate * u.seconds
+	}
+	return rate
+}
+
+var (
+	byteRatePrefixes  = []string{"B", "KB", "MB", "GB", "TB"}
+	countRateSuffixes = []string{"", "k", "M", "G", "T"}
+)
+
+// FormatRate 按计数单位格式化每秒速率
+// bytes 按1024进位，如 "1.5 MB/s"；其他单位按1000进位，如 "1.2k events/s"
+func FormatRate(rate float64, unit string) string {
+	return FormatRatePer(rate, unit, PerSecond)
+}
+
+// FormatRatePer 按计数单位格式化已换算为per时间单位的速率，如 "1.2k requests/min"
+func FormatRatePer(rate float64, unit, per string) string {
+	suffix := "s"
+	if u, ok := perUnits[per]; ok {
+		suffix = u.suffix
+	}
+
+	if unit == UnitBytes {
+		value, idx := scaleRate(rate, 1024, len(byteRatePrefixes))
+		return fmt.Sprintf("%s %s/%s", formatScaled(value, idx), byteRatePrefixes[idx], suffix)
+	}
+
+	value, idx := scaleRate(rate, 1000, len(countRateSuffixes))
+	return fmt.Sprintf("%s%s %s/%s", formatScaled(value, idx), countRateSuffixes[idx], unit, suffix)
+}
+
+// scaleRate 将速率缩放到[1, base)区间，返回缩放后的值和进位次数
+func scaleRate(rate, base float64, levels int) (float64, int) {
+	idx := 0
+	for (rate >= base || rate <= -base) && idx < levels-1 {
+		rate /= base
+		idx++
+	}
+	return rate, idx
+}
+
+// formatScaled 未缩放的值最多保留一位小数并去掉末尾的0，如 "12"、"0.3"，缩放后的值保留一位小数
+func formatScaled(value float64, idx int) string {
+	if idx == 0 {
+		return strconv.FormatFloat(RoundRate(value, 1), 'f', -1, 64)
+	}
+	return fmt.Sprintf("%.1f", value)
+}
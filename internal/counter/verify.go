@@ -0,0 +1,171 @@
+package counter
+
+import (
+	"math/rand/v2"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/logger"
+	"go.uber.org/zap"
+)
+
+// Verifier 计数校验，在窗口之外另行记录每个时间段写入的计数，清理时与窗口中对应槽位的计数比较，
+// 不一致时记录日志，用于排查槽位切换时并发更新丢失计数的问题
+// 账本按分条加锁，与窗口的槽位更新方式无关；时钟回拨同样会造成不一致
+// nil表示未启用校验，所有方法都可以在nil上调用
+type Verifier struct {
+	precision  int64
+	windowSize int64
+	stripes    []verifyStripe
+
+	lastChecked atomic.Int64 // 最近一次校验的时间段
+	checked     atomic.Int64 // 已校验的时间段数
+	mismatches  atomic.Int64 // 计数不一致的时间段数
+	lost        atomic.Int64 // 窗口少于账本的计数之和
+	extra       atomic.Int64 // 窗口多于账本的计数之和
+}
+
+// verifyStripe 一个分条的账本，每个槽位保存一个时间段的计数
+type verifyStripe struct {
+	mu      sync.Mutex
+	entries []verifyEntry
+}
+
+type verifyEntry struct {
+	period int64
+	count  int64 // 写入的计数之和
+	adds   int64 // 写入次数
+}
+
+// newVerifier 根据计数器配置创建计数校验，从clock的当前时间段开始校验，未启用时返回nil
+func newVerifier(cfg *config.CounterConfig, clock Clock) *Verifier {
+	if !cfg.Verify.Enabled {
+		return nil
+	}
+
+	v := &Verifier{
+		precision:  int64(cfg.Precision),
+		windowSize: int64(cfg.WindowSize),
+		stripes:    make([]verifyStripe, runtime.NumCPU()),
+	}
+	for i := range v.stripes {
+		v.stripes[i].entries = make([]verifyEntry, cfg.SlotNum)
+	}
+	v.lastChecked.Store(clock.Now().UnixNano() / v.precision)
+	return v
+}
+
+// VerifierOf 返回计数器的计数校验，计数器不支持或未启用校验时返回nil
+func VerifierOf(c Counter) *Verifier {
+	if aware, ok := c.(interface{ Verifier() *Verifier }); ok {
+		return aware.Verifier()
+	}
+	return nil
+}
+
+// Record 记录在now所在的时间段写入的n个计数，在写入窗口之前调用
+// 延迟写入在写入窗口之后按事件时间调用，账本中对应位置已是更新的时间段时不再记录
+func (v *Verifier) Record(n int64, now int64) {
+	if v == nil {
+		return
+	}
+
+	period := now / v.precision
+	stripe := &v.stripes[rand.IntN(len(v.stripes))]
+	stripe.mu.Lock()
+	e := &stripe.entries[period%int64(len(stripe.entries))]
+	if e.period > period {
+		stripe.mu.Unlock()
+		return
+	}
+	if e.period != period {
+		*e = verifyEntry{period: period}
+	}
+	e.count += n
+	e.adds++
+	stripe.mu.Unlock()
+}
+
+// Reset 计数器被清空时调用，清空之前的时间段不再校验
+func (v *Verifier) Reset(now int64) {
+	if v == nil {
+		return
+	}
+	v.lastChecked.Store(now / v.precision)
+}
+
+// expected 返回账本中一个时间段写入的计数和写入次数
+func (v *Verifier) expected(period int64) (count, adds int64) {
+	for i := range v.stripes {
+		stripe := &v.stripes[i]
+		stripe.mu.Lock()
+		if e := &stripe.entries[period%int64(len(stripe.entries))]; e.period == period {
+			count += e.count
+			adds += e.adds
+		}
+		stripe.mu.Unlock()
+	}
+	return count, adds
+}
+
+// Check 校验尚未校验过的已结束时间段，actual返回窗口中一个时间段的计数
+// 在清理过期槽位之前调用；当前和上一个时间段可能仍有写入，不参与校验
+func (v *Verifier) Check(now int64, actual func(period int64) int64) {
+	if v == nil {
+		return
+	}
+
+	current := now / v.precision
+	last := current - 2
+	// 账本和窗口中仍保留的最早时间段
+	first := max(v.lastChecked.Load()+1, current-int64(len(v.stripes[0].entries))+1, (now-v.windowSize)/v.precision+1)
+	for period := first; period <= last; period++ {
+		expected, adds := v.expected(period)
+		got := actual(period)
+		v.checked.Add(1)
+		if got == expected {
+			continue
+		}
+
+		v.mismatches.Add(1)
+		if got < expected {
+			v.lost.Add(expected - got)
+		} else {
+			v.extra.Add(got - expected)
+		}
+		logger.Warn("计数校验不一致",
+			zap.Time("period", time.Unix(0, period*v.precision)),
+			zap.Int64("expected", expected),
+			zap.Int64("actual", got),
+			zap.Int64("adds", adds))
+	}
+	if last > v.lastChecked.Load() {
+		v.lastChecked.Store(last)
+	}
+}
+
+// VerifierStats 计数校验的统计
+type VerifierStats struct {
+	Enabled    bool  `json:"enabled"`
+	Checked    int64 `json:"checked"`    // 已校验的时间段数
+	Mismatches int64 `json:"mismatches"` // 计数不一致的时间段数
+	Lost       int64 `json:"lost"`       // 窗口少于账本的计数之和
+	Extra      int64 `json:"extra"`      // 窗口多于账本的计数之和
+}
+
+// Stats 获取计数校验的统计，v为nil（未启用校验）时只有Enabled为false
+func (v *Verifier) Stats() VerifierStats {
+	if v == nil {
+		return VerifierStats{}
+	}
+	return VerifierStats{
+		Enabled:    true,
+		Checked:    v.checked.Load(),
+		Mismatches: v.mismatches.Load(),
+		Lost:       v.lost.Load(),
+		Extra:      v.extra.Load(),
+	}
+}
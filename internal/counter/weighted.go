@@ -0,0 +1,133 @@
+package counter
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mant7s/qps-counter/internal/config"
+)
+
+// DefaultWeightUnit 未配置counter.weighted.unit时权重的单位
+const DefaultWeightUnit = "units"
+
+// WeightedStats 窗口内的加权速率
+type WeightedStats struct {
+	Unit   string  `json:"unit"`
+	Window string  `json:"window"`
+	Events int64   `json:"events"` // 窗口内携带权重的上报次数
+	Total  float64 `json:"total"`  // 窗口内的权重之和
+	Rate   float64 `json:"rate"`   // 每秒的权重
+}
+
+// weightedSlot 一个时间槽内的权重之和
+type weightedSlot struct {
+	mu     sync.Mutex   // 只在槽位切换到新的时间段时加锁
+	period atomic.Int64 // 槽位所属的时间段（纳秒时间戳除以精度）
+	sum    atomic.Uint64
+	events atomic.Int64
+}
+
+// WeightedWindow 滑动窗口内的加权计数，每次上报携带一个float64权重（如字节数、成本单位），
+// 与整数计数使用相同的窗口长度、槽位数和精度，得到与QPS并行的任意单位的吞吐量
+// 与LatencyHistogram一样不启动后台协程，读取时忽略过期槽位，边界上的个别权重可能计入相邻的时间段；
+// nil表示未启用加权计数，Record可以在nil上调用
+type WeightedWindow struct {
+	unit       string
+	slots      []weightedSlot
+	precision  int64
+	windowSize int64
+}
+
+// NewWeightedWindow 创建加权计数窗口，窗口长度、槽位数和精度与全局计数器相同
+func NewWeightedWindow(cfg *config.CounterConfig) *WeightedWindow {
+	unit := cfg.Weighted.Unit
+	if unit == "" {
+		unit = DefaultWeightUnit
+	}
+	slots := cfg.SlotNum
+	if slots <= 0 {
+		slots = 10
+	}
+	precision := int64(cfg.Precision)
+	if precision <= 0 {
+		precision = int64(cfg.WindowSize) / int64(slots)
+	}
+	return &WeightedWindow{
+		unit:       unit,
+		slots:      make([]weightedSlot, slots),
+		precision:  precision,
+		windowSize: int64(cfg.WindowSize),
+	}
+}
+
+// Record 把权重计入事件时间at所在的槽位，at已超出窗口或槽位已被更新的时间段占用时返回false
+// 晚于当前时间的at按当前时间计入，负数、NaN和无穷大的权重被忽略
+func (w *WeightedWindow) Record(weight float64, at time.Time) bool {
+	if w == nil || weight <= 0 || math.IsInf(weight, 0) || math.IsNaN(weight) {
+		return true
+	}
+	now := time.Now().UnixNano()
+	period := min(at.UnixNano(), now) / w.precision
+	if period <= (now-w.windowSize)/w.precision {
+		return false
+	}
+
+	slot := &w.slots[period%int64(len(w.slots))]
+	if current := slot.period.Load(); current != period {
+		if current > period {
+			return false
+		}
+		slot.mu.Lock()
+		switch current = slot.period.Load(); {
+		case current > period:
+			slot.mu.Unlock()
+			return false
+		case current < period:
+			slot.sum.Store(0)
+			slot.events.Store(0)
+			slot.period.Store(period)
+		}
+		slot.mu.Unlock()
+	}
+
+	for {
+		old := slot.sum.Load()
+		if slot.sum.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+weight)) {
+			break
+		}
+	}
+	slot.events.Add(1)
+	return true
+}
+
+// Rate 返回窗口内每秒的权重
+func (w *WeightedWindow) Rate() float64 {
+	return w.Stats().Rate
+}
+
+// Stats 返回窗口内的加权速率
+func (w *WeightedWindow) Stats() WeightedStats {
+	now := time.Now().UnixNano()
+	current := now / w.precision
+	oldest := (now - w.windowSize) / w.precision
+
+	stats := WeightedStats{Unit: w.unit, Window: WindowName(time.Duration(w.windowSize))}
+	for i := range w.slots {
+		slot := &w.slots[i]
+		period := slot.period.Load()
+		if period <= oldest || period > current {
+			continue
+		}
+		stats.Total += math.Float64frombits(slot.sum.Load())
+		stats.Events += slot.events.Load()
+	}
+	stats.Rate = stats.Total / time.Duration(w.windowSize).Seconds()
+	return stats
+}
+
+// Unit 返回权重的单位
+func (w *WeightedWindow) Unit() string {
+	return w.unit
+}
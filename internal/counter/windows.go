@@ -0,0 +1,176 @@
+package counter
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/mant7s/qps-counter/internal/config"
+)
+
+// WindowQPS 一个时间窗口及其QPS
+type WindowQPS struct {
+	Window string `json:"window"` // 窗口长度，如 1s、10s、1m、5m
+	QPS    int64  `json:"qps"`
+}
+
+// namedWindow 配置的一个附加时间窗口
+type namedWindow struct {
+	name   string
+	window *slidingWindow
+}
+
+// MultiWindow 包装全局计数器，在counter.windows配置的多个时间窗口上同时计数
+// 被包装的计数器仍按window_size计算CurrentQPS；附加窗口使用与其相同的槽位数，
+// 精度为窗口长度除以槽位数，不启动后台协程，查询时按时间戳过滤过期槽位
+type MultiWindow struct {
+	Counter
+	windows []namedWindow
+}
+
+// NewMultiWindow 为计数器创建附加的时间窗口
+func NewMultiWindow(c Counter, cfg *config.CounterConfig) *MultiWindow {
+	slots := cfg.SlotNum
+	if slots <= 0 {
+		slots = 10
+	}
+
+	m := &MultiWindow{Counter: c, windows: make([]namedWindow, 0, len(cfg.Windows))}
+	for _, size := range cfg.Windows {
+		m.windows = append(m.windows, namedWindow{
+			name: WindowName(size),
+			window: &slidingWindow{
+				slots:      make([]atomic.Pointer[windowSlot], slots),
+				precision:  int64(size) / int64(slots),
+				windowSize: int64(size),
+			},
+		})
+	}
+	return m
+}
+
+// WindowName 返回窗口长度的简写，整小时、整分钟和整秒分别写作 1h、5m、10s
+func WindowName(size time.Duration) string {
+	switch {
+	case size%time.Hour == 0:
+		return fmt.Sprintf("%dh", size/time.Hour)
+	case size%time.Minute == 0:
+		return fmt.Sprintf("%dm", size/time.Minute)
+	case size%time.Second == 0:
+		return fmt.Sprintf("%ds", size/time.Second)
+	}
+	return size.String()
+}
+
+func (m *MultiWindow) Incr() {
+	m.Add(1)
+}
+
+// Add 写入被包装的计数器和所有附加窗口，n<=0时忽略
+func (m *MultiWindow) Add(n int64) {
+	if n <= 0 {
+		return
+	}
+	m.Counter.Add(n)
+	now := ClockOf(m.Counter).Now().UnixNano()
+	for _, w := range m.windows {
+		w.window.add(n, now)
+	}
+}
+
+// AddAt 在时间戳ts所在的槽位上写入被包装的计数器，写入后同样计入各附加窗口中ts所在的槽位
+// 被包装的计数器无法写入时返回false，附加窗口也不写入
+func (m *MultiWindow) AddAt(n int64, ts int64) bool {
+	if n <= 0 {
+		return true
+	}
+	if !AddAt(m.Counter, n, ts) {
+		return false
+	}
+	now := ClockOf(m.Counter).Now().UnixNano()
+	for _, w := range m.windows {
+		w.window.addAt(n, ts, now)
+	}
+	return true
+}
+
+// Reset 清空被包装的计数器和所有附加窗口
+func (m *MultiWindow) Reset() {
+	m.Counter.Reset()
+	for _, w := range m.windows {
+		w.window.reset()
+	}
+}
+
+// Windows 返回各附加窗口的QPS，顺序与配置一致
+func (m *MultiWindow) Windows() []WindowQPS {
+	now := ClockOf(m.Counter).Now().UnixNano()
+	result := make([]WindowQPS, len(m.windows))
+	for i, w := range m.windows {
+		result[i] = WindowQPS{Window: w.name, QPS: w.window.rate(now)}
+	}
+	return result
+}
+
+// CurrentRate 返回被包装计数器当前的每秒速率
+func (m *MultiWindow) CurrentRate() float64 {
+	return RateOf(m.Counter)
+}
+
+// Unit 返回被包装计数器的计数单位
+func (m *MultiWindow) Unit() string {
+	return UnitOf(m.Counter)
+}
+
+// IdleDetector 返回被包装计数器的空闲检测器
+func (m *MultiWindow) IdleDetector() *IdleDetector {
+	return IdleDetectorOf(m.Counter)
+}
+
+// Clock 返回被包装计数器的时间源，附加窗口使用同一个时间源
+func (m *MultiWindow) Clock() Clock {
+	return ClockOf(m.Counter)
+}
+
+// Verifier 返回被包装计数器的计数校验
+func (m *MultiWindow) Verifier() *Verifier {
+	return VerifierOf(m.Counter)
+}
+
+// Snapshot 返回被包装计数器和附加窗口的快照，被包装的计数器不支持快照时只包含附加窗口
+func (m *MultiWindow) Snapshot(now int64) WindowSnapshot {
+	s, _ := SnapshotOf(m.Counter, now)
+	s.Windows = make(map[string][]SlotSnapshot, len(m.windows))
+	for _, w := range m.windows {
+		if slots := w.window.snapshot(now); len(slots) > 0 {
+			s.Windows[w.name] = slots
+		}
+	}
+	return s
+}
+
+// Restore 恢复被包装计数器和附加窗口，快照中没有的附加窗口（如新增的窗口）从零开始
+func (m *MultiWindow) Restore(s WindowSnapshot, now int64) {
+	RestoreSnapshot(m.Counter, s, now)
+	for _, w := range m.windows {
+		w.window.restore(s.Windows[w.name], now)
+	}
+}
+
+// SlotInfo 返回被包装计数器当前写入的槽位
+func (m *MultiWindow) SlotInfo(now int64) map[string]interface{} {
+	if aware, ok := m.Counter.(interface {
+		SlotInfo(now int64) map[string]interface{}
+	}); ok {
+		return aware.SlotInfo(now)
+	}
+	return nil
+}
+
+// WindowsOf 返回计数器附加窗口的QPS，计数器没有附加窗口时返回nil
+func WindowsOf(c Counter) []WindowQPS {
+	if aware, ok := c.(interface{ Windows() []WindowQPS }); ok {
+		return aware.Windows()
+	}
+	return nil
+}
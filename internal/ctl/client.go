@@ -0,0 +1,87 @@
+package ctl
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Client 调用qps-counter HTTP接口的客户端
+type Client struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+// NewClient 创建客户端，timeout为单个请求的超时时间
+func NewClient(profile Profile, timeout time.Duration) *Client {
+	return &Client{
+		baseURL: strings.TrimRight(profile.URL, "/"),
+		token:   profile.Token,
+		http:    &http.Client{Timeout: timeout},
+	}
+}
+
+// APIError 接口返回的非2xx响应
+type APIError struct {
+	Status  int
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.Status, http.StatusText(e.Status), e.Message)
+}
+
+// Do 发送请求并解码JSON响应，body不为nil时编码为JSON请求体
+// 响应不是JSON时返回字符串
+func (c *Client) Do(method, path string, body interface{}) (interface{}, error) {
+	var reader io.Reader
+	if raw, ok := body.([]byte); ok {
+		reader = bytes.NewReader(raw)
+	} else if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if reader != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var result interface{}
+	if err := json.Unmarshal(data, &result); err != nil {
+		result = strings.TrimSpace(string(data))
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		message := fmt.Sprint(result)
+		if m, ok := result.(map[string]interface{}); ok && m["error"] != nil {
+			message = fmt.Sprint(m["error"])
+		}
+		return result, &APIError{Status: resp.StatusCode, Message: message}
+	}
+	return result, nil
+}
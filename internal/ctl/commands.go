@@ -0,0 +1,309 @@
+package ctl
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/mant7s/qps-counter/internal/api"
+)
+
+// ErrUsage 命令或参数无效，调用方应输出用法
+var ErrUsage = errors.New("用法错误")
+
+const usage = `用法: qpsctl [选项] <命令> [参数]
+
+命令:
+  qps                               查询当前QPS
+  rate [计数器]                     查询带单位的速率，可指定命名计数器
+  stats                             查询计数器、限流器、分片和优雅关闭的状态
+  health                            健康检查
+  workers                           列出后台协程及最近一次执行时间
+  limiter rate <速率>               设置限流速率
+  limiter enable|disable            启用或禁用限流器
+  ingest pause|resume               暂停或恢复采集（需要管理员令牌）
+  counters list                     列出命名计数器
+  counters get <名称>               查询命名计数器
+  counters create <名称> [选项]     创建命名计数器，选项: -type -window -slots -precision -unit
+  counters delete <名称>            删除命名计数器
+  counters restore <名称>           恢复保留期内已删除的命名计数器
+  batch <文件|->                    执行批量管理操作（需要管理员令牌）
+  apply [-dry-run] <文件|->         按声明式配置收敛限流器和命名计数器（需要管理员令牌）
+  profiles                          列出配置文件中的环境
+
+选项:
+`
+
+// command 一个子命令，args为去掉命令名后的参数
+type command func(env *runEnv, args []string) (interface{}, error)
+
+// runEnv 子命令运行时使用的客户端和配置
+type runEnv struct {
+	client   *Client
+	profiles ProfileFile
+	stdin    io.Reader
+}
+
+var commands = map[string]command{
+	"qps":      get("/qps"),
+	"stats":    statsCommand,
+	"health":   get("/healthz"),
+	"workers":  get("/debug/workers"),
+	"rate":     rateCommand,
+	"limiter":  limiterCommand,
+	"ingest":   ingestCommand,
+	"counters": countersCommand,
+	"batch":    batchCommand,
+	"apply":    applyCommand,
+	"profiles": profilesCommand,
+}
+
+// Run 解析参数并执行命令，返回进程退出码
+func Run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("qpsctl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	profileName := fs.String("profile", "", "使用配置文件中的环境，默认为QPSCTL_PROFILE或配置文件中的current")
+	configPath := fs.String("config", DefaultProfilePath(), "配置文件路径，默认为QPSCTL_CONFIG或用户配置目录下的qpsctl/config.yaml")
+	baseURL := fs.String("url", "", "服务地址，覆盖环境配置")
+	token := fs.String("token", "", "管理员令牌，覆盖环境配置")
+	output := fs.String("o", OutputTable, "输出格式: table或json")
+	timeout := fs.Duration("timeout", 10*time.Second, "请求超时时间")
+	fs.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	cmd, ok := commands[fs.Arg(0)]
+	if !ok {
+		fmt.Fprintf(stderr, "未知命令 %s\n", fs.Arg(0))
+		fs.Usage()
+		return 2
+	}
+
+	profiles, err := LoadProfiles(*configPath)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	profile, err := profiles.Resolve(*profileName, *baseURL, *token)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	env := &runEnv{client: NewClient(profile, *timeout), profiles: profiles, stdin: stdin}
+	result, err := cmd(env, fs.Args()[1:])
+	if errors.Is(err, ErrUsage) {
+		fmt.Fprintln(stderr, err)
+		fs.Usage()
+		return 2
+	}
+	if err != nil {
+		// 接口返回错误时仍输出响应内容，便于查看批量操作等的详细结果
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && *output == OutputJSON && result != nil {
+			Print(stdout, *output, result)
+		}
+		fmt.Fprintln(stderr, "错误:", err)
+		return 1
+	}
+	if err := Print(stdout, *output, result); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func get(path string) command {
+	return func(env *runEnv, args []string) (interface{}, error) {
+		if len(args) != 0 {
+			return nil, fmt.Errorf("%w: 不需要参数", ErrUsage)
+		}
+		return env.client.Do("GET", path, nil)
+	}
+}
+
+// statsCommand 查询 /stats/v2 并按api.Stats解码，服务端返回的未知字段不输出
+func statsCommand(env *runEnv, args []string) (interface{}, error) {
+	result, err := get("/stats/v2")(env, args)
+	if err != nil {
+		return result, err
+	}
+	var stats api.Stats
+	if err := convert(result, &stats); err != nil {
+		return nil, fmt.Errorf("无法解析服务状态: %w", err)
+	}
+	return stats, nil
+}
+
+func rateCommand(env *runEnv, args []string) (interface{}, error) {
+	switch len(args) {
+	case 0:
+		return env.client.Do("GET", "/rate", nil)
+	case 1:
+		return env.client.Do("GET", "/rate?counter="+url.QueryEscape(args[0]), nil)
+	default:
+		return nil, fmt.Errorf("%w: rate最多指定一个计数器", ErrUsage)
+	}
+}
+
+func limiterCommand(env *runEnv, args []string) (interface{}, error) {
+	switch {
+	case len(args) == 2 && args[0] == "rate":
+		rate, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil || rate <= 0 {
+			return nil, fmt.Errorf("%w: 速率必须是大于0的整数", ErrUsage)
+		}
+		return env.client.Do("POST", "/limiter/rate", map[string]int64{"rate": rate})
+	case len(args) == 1 && (args[0] == "enable" || args[0] == "disable"):
+		return env.client.Do("POST", "/limiter/toggle", map[string]bool{"enabled": args[0] == "enable"})
+	default:
+		return nil, fmt.Errorf("%w: limiter rate <速率> | limiter enable|disable", ErrUsage)
+	}
+}
+
+func ingestCommand(env *runEnv, args []string) (interface{}, error) {
+	if len(args) != 1 || (args[0] != "pause" && args[0] != "resume") {
+		return nil, fmt.Errorf("%w: ingest pause|resume", ErrUsage)
+	}
+	return env.client.Do("POST", "/admin/ingest/"+args[0], nil)
+}
+
+func countersCommand(env *runEnv, args []string) (interface{}, error) {
+	if len(args) == 1 && args[0] == "list" {
+		return listCounters(env)
+	}
+	if len(args) < 2 {
+		return nil, fmt.Errorf("%w: counters list|get|create|delete|restore <名称>", ErrUsage)
+	}
+
+	action, name := args[0], args[1]
+	path := "/counters/" + url.PathEscape(name)
+	if action != "create" && len(args) != 2 {
+		return nil, fmt.Errorf("%w: counters %s只接受一个名称", ErrUsage, action)
+	}
+	switch action {
+	case "get":
+		return env.client.Do("GET", path, nil)
+	case "delete":
+		return env.client.Do("DELETE", path, nil)
+	case "restore":
+		return env.client.Do("POST", path+"/restore", nil)
+	case "create":
+		return createCounter(env, name, args[2:])
+	default:
+		return nil, fmt.Errorf("%w: 未知操作 %s", ErrUsage, action)
+	}
+}
+
+// listCounters 按next_cursor翻页取得所有命名计数器，合并为一个列表
+func listCounters(env *runEnv) (interface{}, error) {
+	counters := []interface{}{}
+	cursor := ""
+	for {
+		resp, err := env.client.Do("GET", "/counters?limit=1000&cursor="+url.QueryEscape(cursor), nil)
+		if err != nil {
+			return nil, err
+		}
+		page, _ := resp.(map[string]interface{})
+		items, _ := page["counters"].([]interface{})
+		counters = append(counters, items...)
+		cursor, _ = page["next_cursor"].(string)
+		if cursor == "" {
+			return map[string]interface{}{"counters": counters}, nil
+		}
+	}
+}
+
+// createCounter 创建命名计数器，未指定的参数由服务端使用默认值
+func createCounter(env *runEnv, name string, args []string) (interface{}, error) {
+	fs := flag.NewFlagSet("counters create", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	spec := map[string]interface{}{"name": name}
+	counterType := fs.String("type", "", "计数器类型")
+	window := fs.String("window", "", "窗口大小，如10s")
+	slots := fs.Int("slots", 0, "槽位数")
+	precision := fs.String("precision", "", "精度，如100ms")
+	unit := fs.String("unit", "", "计数单位")
+	if err := fs.Parse(args); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUsage, err)
+	}
+
+	for key, value := range map[string]string{"type": *counterType, "window": *window, "precision": *precision, "unit": *unit} {
+		if value != "" {
+			spec[key] = value
+		}
+	}
+	if *slots > 0 {
+		spec["slots"] = *slots
+	}
+	return env.client.Do("POST", "/counters", spec)
+}
+
+// batchCommand 从文件或标准输入读取批量操作，请求体原样发送
+func batchCommand(env *runEnv, args []string) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("%w: batch <文件|->", ErrUsage)
+	}
+
+	body, err := readInput(env, args[0])
+	if err != nil {
+		return nil, err
+	}
+	return env.client.Do("POST", "/admin/batch", body)
+}
+
+// applyCommand 提交声明式配置，-dry-run时只输出差异
+func applyCommand(env *runEnv, args []string) (interface{}, error) {
+	fs := flag.NewFlagSet("apply", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	dryRun := fs.Bool("dry-run", false, "只输出差异，不修改状态")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+		return nil, fmt.Errorf("%w: apply [-dry-run] <文件|->", ErrUsage)
+	}
+
+	body, err := readInput(env, fs.Arg(0))
+	if err != nil {
+		return nil, err
+	}
+	return env.client.Do("PUT", "/admin/config?dry_run="+strconv.FormatBool(*dryRun), body)
+}
+
+// readInput 读取文件内容，路径为-时读取标准输入
+func readInput(env *runEnv, path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(env.stdin)
+	}
+	return os.ReadFile(path)
+}
+
+// profilesCommand 列出配置文件中的环境，不会输出令牌
+func profilesCommand(env *runEnv, args []string) (interface{}, error) {
+	if len(args) != 0 {
+		return nil, fmt.Errorf("%w: profiles不需要参数", ErrUsage)
+	}
+
+	list := make([]interface{}, 0, len(env.profiles.Profiles))
+	for _, name := range env.profiles.Names() {
+		p := env.profiles.Profiles[name]
+		list = append(list, map[string]interface{}{
+			"name":    name,
+			"url":     p.URL,
+			"current": name == env.profiles.Current,
+			"token":   p.Token != "",
+		})
+	}
+	return map[string]interface{}{"profiles": list}, nil
+}
@@ -0,0 +1,189 @@
+package ctl
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+const (
+	// OutputTable 以表格输出，嵌套字段展开为以.分隔的键
+	OutputTable = "table"
+	// OutputJSON 原样输出格式化后的JSON
+	OutputJSON = "json"
+)
+
+// Print 按格式输出接口响应
+func Print(w io.Writer, format string, v interface{}) error {
+	switch format {
+	case OutputJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+	case OutputTable, "":
+		return printTable(w, v)
+	default:
+		return fmt.Errorf("不支持的输出格式 %s", format)
+	}
+}
+
+// printTable 对象输出为KEY/VALUE两列；只包含一个对象数组的对象（如计数器列表）输出为每个元素一行
+// 结构体按JSON标签转换为对象后输出
+func printTable(w io.Writer, v interface{}) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	if !isJSONValue(v) {
+		var generic interface{}
+		if err := convert(v, &generic); err != nil {
+			return err
+		}
+		v = generic
+	}
+
+	switch value := v.(type) {
+	case map[string]interface{}:
+		if rows, ok := singleList(value); ok {
+			writeRows(tw, rows)
+			break
+		}
+		fields := make(map[string]string)
+		flatten("", value, fields)
+		fmt.Fprintln(tw, "KEY\tVALUE")
+		for _, key := range sortedKeys(fields) {
+			fmt.Fprintf(tw, "%s\t%s\n", key, fields[key])
+		}
+	case []interface{}:
+		rows, ok := objects(value)
+		if !ok {
+			fmt.Fprintln(tw, formatValue(value))
+			break
+		}
+		writeRows(tw, rows)
+	default:
+		fmt.Fprintln(tw, formatValue(value))
+	}
+	return tw.Flush()
+}
+
+// singleList 对象只有一个字段且为对象数组时返回该数组
+func singleList(m map[string]interface{}) ([]map[string]interface{}, bool) {
+	if len(m) != 1 {
+		return nil, false
+	}
+	for _, v := range m {
+		if list, ok := v.([]interface{}); ok {
+			return objects(list)
+		}
+	}
+	return nil, false
+}
+
+func objects(list []interface{}) ([]map[string]interface{}, bool) {
+	rows := make([]map[string]interface{}, 0, len(list))
+	for _, item := range list {
+		row, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		rows = append(rows, row)
+	}
+	return rows, true
+}
+
+// writeRows 输出对象数组，列为所有元素展开后的字段，名称类字段排在最前
+func writeRows(w io.Writer, rows []map[string]interface{}) {
+	flat := make([]map[string]string, len(rows))
+	seen := make(map[string]bool)
+	for i, row := range rows {
+		flat[i] = make(map[string]string)
+		flatten("", row, flat[i])
+		for key := range flat[i] {
+			seen[key] = true
+		}
+	}
+
+	columns := sortedKeys(seen)
+	sort.SliceStable(columns, func(i, j int) bool {
+		return isNameColumn(columns[i]) && !isNameColumn(columns[j])
+	})
+
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = strings.ToUpper(column)
+	}
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	for _, row := range flat {
+		cells := make([]string, len(columns))
+		for i, column := range columns {
+			cells[i] = row[column]
+		}
+		fmt.Fprintln(w, strings.Join(cells, "\t"))
+	}
+}
+
+func isNameColumn(column string) bool {
+	return column == "name" || strings.HasSuffix(column, ".name")
+}
+
+// flatten 将嵌套对象展开为以.分隔的键，数组以紧凑的JSON输出
+func flatten(prefix string, v interface{}, out map[string]string) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		out[prefix] = formatValue(v)
+		return
+	}
+	for key, value := range m {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		flatten(key, value, out)
+	}
+}
+
+func formatValue(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return "-"
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case bool:
+		return fmt.Sprint(value)
+	default:
+		data, _ := json.Marshal(value)
+		return string(data)
+	}
+}
+
+// isJSONValue 返回v是否为解码JSON得到的类型
+func isJSONValue(v interface{}) bool {
+	switch v.(type) {
+	case nil, map[string]interface{}, []interface{}, string, float64, bool:
+		return true
+	default:
+		return false
+	}
+}
+
+// convert 按JSON标签在结构体和解码JSON得到的对象之间转换
+func convert(from, to interface{}) error {
+	data, err := json.Marshal(from)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, to)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
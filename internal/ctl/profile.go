@@ -0,0 +1,102 @@
+package ctl
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/spf13/viper"
+)
+
+// DefaultURL 未指定服务地址时使用的地址
+const DefaultURL = "http://localhost:8080"
+
+// Profile 一个环境的连接配置
+type Profile struct {
+	URL   string `mapstructure:"url"`
+	Token string `mapstructure:"token"` // 管理员令牌，调用/admin下的接口时使用
+}
+
+// ProfileFile 配置文件的内容，current为未指定环境时使用的环境
+type ProfileFile struct {
+	Current  string             `mapstructure:"current"`
+	Profiles map[string]Profile `mapstructure:"profiles"`
+}
+
+// DefaultProfilePath 返回默认的配置文件路径，QPSCTL_CONFIG优先
+func DefaultProfilePath() string {
+	if path := os.Getenv("QPSCTL_CONFIG"); path != "" {
+		return path
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "qpsctl", "config.yaml")
+}
+
+// LoadProfiles 读取配置文件，文件不存在时返回空配置
+func LoadProfiles(path string) (ProfileFile, error) {
+	var file ProfileFile
+	if path == "" {
+		return file, nil
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return file, nil
+	}
+
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return file, fmt.Errorf("读取配置文件失败: %w", err)
+	}
+	if err := v.Unmarshal(&file); err != nil {
+		return file, fmt.Errorf("解析配置文件失败: %w", err)
+	}
+	return file, nil
+}
+
+// Names 返回所有环境名称，按名称排序
+func (f ProfileFile) Names() []string {
+	names := make([]string, 0, len(f.Profiles))
+	for name := range f.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Resolve 确定使用的连接配置
+// 环境按 name、QPSCTL_PROFILE、current 的顺序选择；地址和令牌的优先级为参数、
+// QPSCTL_URL/QPSCTL_TOKEN、环境配置，地址都未指定时使用DefaultURL
+func (f ProfileFile) Resolve(name, url, token string) (Profile, error) {
+	if name == "" {
+		name = os.Getenv("QPSCTL_PROFILE")
+	}
+	if name == "" {
+		name = f.Current
+	}
+
+	var profile Profile
+	if name != "" {
+		p, ok := f.Profiles[name]
+		if !ok {
+			return profile, fmt.Errorf("环境 %s 不存在", name)
+		}
+		profile = p
+	}
+
+	profile.URL = firstNonEmpty(url, os.Getenv("QPSCTL_URL"), profile.URL, DefaultURL)
+	profile.Token = firstNonEmpty(token, os.Getenv("QPSCTL_TOKEN"), profile.Token)
+	return profile, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
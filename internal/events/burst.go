@@ -0,0 +1,191 @@
+package events
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/counter"
+	"github.com/mant7s/qps-counter/internal/workers"
+)
+
+const (
+	defaultBurstInterval = time.Second
+	defaultBurstRatio    = 2.0
+	defaultBurstAlpha    = 0.2
+)
+
+// BurstDetector 周期性采样QPS，检测流量突增与阈值跨越并通过事件总线发布事件
+// 基线QPS使用EWMA计算，突增期间冻结基线，避免突增流量抬高基线导致提前判定结束
+type BurstDetector struct {
+	counter    counter.Counter
+	bus        *Bus
+	interval   time.Duration
+	ratio      float64
+	minQPS     int64
+	alpha      float64
+	thresholds []int64
+
+	mu          sync.Mutex
+	initialized bool
+	baseline    float64
+	lastQPS     int64
+	inBurst     bool
+	burstStart  time.Time
+	peakQPS     int64
+
+	worker   *workers.Worker
+	stopChan chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewBurstDetector 创建一个新的突增检测器并启动采样协程
+func NewBurstDetector(c counter.Counter, bus *Bus, cfg config.BurstConfig) *BurstDetector {
+	bd := &BurstDetector{
+		counter:    c,
+		bus:        bus,
+		interval:   cfg.Interval,
+		ratio:      cfg.Ratio,
+		minQPS:     cfg.MinQPS,
+		alpha:      cfg.Alpha,
+		thresholds: append([]int64(nil), cfg.Thresholds...),
+		stopChan:   make(chan struct{}),
+	}
+	if bd.interval <= 0 {
+		bd.interval = defaultBurstInterval
+	}
+	if bd.ratio <= 1 {
+		bd.ratio = defaultBurstRatio
+	}
+	if bd.alpha <= 0 || bd.alpha > 1 {
+		bd.alpha = defaultBurstAlpha
+	}
+	sort.Slice(bd.thresholds, func(i, j int) bool { return bd.thresholds[i] < bd.thresholds[j] })
+
+	bd.worker = workers.Register("events.burst", bd.interval).WithIdle(counter.IdleDetectorOf(c).Idle)
+	bd.worker.Go(&bd.wg, bd.detectWorker)
+	return bd
+}
+
+// detectWorker 周期性采样当前QPS
+func (bd *BurstDetector) detectWorker() {
+	ticker := time.NewTicker(bd.interval)
+	defer ticker.Stop()
+	idle := counter.IdleDetectorOf(bd.counter)
+
+	for {
+		select {
+		case now := <-ticker.C:
+			bd.Observe(bd.counter.CurrentQPS(), now)
+			bd.worker.Ran()
+			if !idle.PauseTicker(ticker, bd.interval, bd.stopChan) {
+				return
+			}
+		case <-bd.stopChan:
+			return
+		}
+	}
+}
+
+// Observe 处理一次QPS采样，必要时发布事件
+func (bd *BurstDetector) Observe(qps int64, at time.Time) {
+	bd.mu.Lock()
+	defer bd.mu.Unlock()
+
+	if !bd.initialized {
+		bd.initialized = true
+		bd.baseline = float64(qps)
+		bd.lastQPS = qps
+		return
+	}
+
+	bd.checkThresholds(qps, at)
+	bd.checkBurst(qps, at)
+
+	if !bd.inBurst {
+		bd.baseline = bd.alpha*float64(qps) + (1-bd.alpha)*bd.baseline
+	}
+	bd.lastQPS = qps
+}
+
+// checkThresholds 检查QPS是否跨越了配置的阈值
+func (bd *BurstDetector) checkThresholds(qps int64, at time.Time) {
+	for _, threshold := range bd.thresholds {
+		var direction string
+		switch {
+		case bd.lastQPS < threshold && qps >= threshold:
+			direction = "up"
+		case bd.lastQPS >= threshold && qps < threshold:
+			direction = "down"
+		default:
+			continue
+		}
+
+		bd.bus.Publish(Event{
+			Type: EventThresholdCrossed,
+			Time: at,
+			Data: map[string]interface{}{
+				"threshold": threshold,
+				"direction": direction,
+				"qps":       qps,
+			},
+		})
+	}
+}
+
+// checkBurst 检查突增的开始与结束
+func (bd *BurstDetector) checkBurst(qps int64, at time.Time) {
+	limit := bd.baseline * bd.ratio
+
+	if !bd.inBurst {
+		if qps >= bd.minQPS && float64(qps) > limit {
+			bd.inBurst = true
+			bd.burstStart = at
+			bd.peakQPS = qps
+			bd.bus.Publish(Event{
+				Type: EventBurstStarted,
+				Time: at,
+				Data: map[string]interface{}{
+					"qps":      qps,
+					"baseline": bd.baseline,
+					"ratio":    bd.ratio,
+				},
+			})
+		}
+		return
+	}
+
+	if qps > bd.peakQPS {
+		bd.peakQPS = qps
+	}
+	if float64(qps) <= limit {
+		bd.inBurst = false
+		bd.bus.Publish(Event{
+			Type: EventBurstEnded,
+			Time: at,
+			Data: map[string]interface{}{
+				"qps":              qps,
+				"baseline":         bd.baseline,
+				"peak_qps":         bd.peakQPS,
+				"duration_seconds": at.Sub(bd.burstStart).Seconds(),
+			},
+		})
+	}
+}
+
+// InBurst 返回当前是否处于突增状态
+func (bd *BurstDetector) InBurst() bool {
+	bd.mu.Lock()
+	defer bd.mu.Unlock()
+	return bd.inBurst
+}
+
+// Stop 停止突增检测
+func (bd *BurstDetector) Stop() {
+	bd.stopOnce.Do(func() {
+		close(bd.stopChan)
+	})
+	bd.wg.Wait()
+}
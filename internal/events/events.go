@@ -0,0 +1,165 @@
+package events
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mant7s/qps-counter/internal/logger"
+	"github.com/mant7s/qps-counter/internal/workers"
+	"go.uber.org/zap"
+)
+
+// 事件类型
+const (
+	EventBurstStarted     = "burst_started"     // 流量突增开始
+	EventBurstEnded       = "burst_ended"       // 流量突增结束
+	EventThresholdCrossed = "threshold_crossed" // QPS跨越配置的阈值
+	EventShutdownStarted  = "shutdown_started"  // 开始优雅关闭
+	EventShutdownFinished = "shutdown_finished" // 优雅关闭完成
+	EventStarted          = "started"           // 服务启动完成，开始接收请求
+	EventConfigReloaded   = "config_reloaded"   // 配置文件变化并通过校验后重新加载
+	EventShardsResized    = "shards_resized"    // 自适应分片管理器调整了分片数
+	EventLimiterToggled   = "limiter_toggled"   // 限流器被启用或禁用
+	EventDegradedEntered  = "degraded_entered"  // 组件健康检查的整体状态离开healthy
+	EventDegradedExited   = "degraded_exited"   // 整体状态回到healthy
+)
+
+const defaultQueueSize = 1024
+
+// Event 结构化事件
+type Event struct {
+	Type string                 `json:"type"`
+	Time time.Time              `json:"time"`
+	Data map[string]interface{} `json:"data,omitempty"`
+}
+
+// Hook 事件钩子，外部系统通过钩子接收事件
+type Hook interface {
+	Handle(event Event)
+}
+
+// HookFunc 允许使用普通函数作为事件钩子
+type HookFunc func(event Event)
+
+// Handle 实现Hook接口
+func (f HookFunc) Handle(event Event) {
+	f(event)
+}
+
+// Bus 事件总线，异步分发事件到所有已注册的钩子，发布方不会被慢钩子阻塞
+type Bus struct {
+	mu       sync.RWMutex
+	hooks    []Hook
+	queue    chan Event
+	worker   *workers.Worker
+	stopChan chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+
+	publishedCount atomic.Int64 // 已发布事件数
+	droppedCount   atomic.Int64 // 队列已满被丢弃的事件数
+}
+
+// NewBus 创建一个新的事件总线并启动分发协程
+func NewBus(queueSize int) *Bus {
+	if queueSize <= 0 {
+		queueSize = defaultQueueSize
+	}
+
+	b := &Bus{
+		queue:    make(chan Event, queueSize),
+		stopChan: make(chan struct{}),
+	}
+
+	b.worker = workers.Register("events.dispatch", 0)
+	b.worker.Go(&b.wg, b.dispatchWorker)
+	return b
+}
+
+// Register 注册一个事件钩子
+func (b *Bus) Register(hook Hook) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.hooks = append(b.hooks, hook)
+}
+
+// Publish 发布一个事件，队列已满时丢弃事件而不是阻塞调用方
+func (b *Bus) Publish(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	select {
+	case b.queue <- event:
+		b.publishedCount.Add(1)
+	default:
+		dropped := b.droppedCount.Add(1)
+		if dropped%100 == 1 { // 避免日志过多
+			logger.Warn("事件队列已满，丢弃事件",
+				zap.String("type", event.Type),
+				zap.Int64("dropped_count", dropped))
+		}
+	}
+}
+
+// dispatchWorker 将队列中的事件依次分发给所有钩子
+func (b *Bus) dispatchWorker() {
+	for {
+		select {
+		case event := <-b.queue:
+			b.dispatch(event)
+			b.worker.Ran()
+		case <-b.stopChan:
+			// 尽量投递剩余事件
+			for {
+				select {
+				case event := <-b.queue:
+					b.dispatch(event)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (b *Bus) dispatch(event Event) {
+	b.mu.RLock()
+	hooks := b.hooks
+	b.mu.RUnlock()
+
+	for _, hook := range hooks {
+		hook.Handle(event)
+	}
+}
+
+// Stop 停止事件总线，等待剩余事件分发完成
+func (b *Bus) Stop() {
+	b.stopOnce.Do(func() {
+		close(b.stopChan)
+	})
+	b.wg.Wait()
+}
+
+// GetStats 获取事件总线统计信息
+func (b *Bus) GetStats() map[string]interface{} {
+	b.mu.RLock()
+	hookCount := len(b.hooks)
+	b.mu.RUnlock()
+
+	return map[string]interface{}{
+		"hooks":           hookCount,
+		"queue_length":    len(b.queue),
+		"published_count": b.publishedCount.Load(),
+		"dropped_count":   b.droppedCount.Load(),
+	}
+}
+
+// LogHook 将事件写入日志的钩子
+type LogHook struct{}
+
+// Handle 实现Hook接口
+func (LogHook) Handle(event Event) {
+	logger.Info("事件触发", zap.String("type", event.Type), zap.Any("data", event.Data))
+}
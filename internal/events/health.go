@@ -0,0 +1,104 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mant7s/qps-counter/internal/health"
+	"github.com/mant7s/qps-counter/internal/workers"
+)
+
+const defaultHealthInterval = 5 * time.Second
+
+// HealthWatcher 周期性执行组件健康检查，整体状态离开healthy时发布degraded_entered，
+// 回到healthy时发布degraded_exited，外部系统不需要轮询 /healthz
+type HealthWatcher struct {
+	registry *health.Registry
+	bus      *Bus
+	interval time.Duration
+	instance string
+
+	mu     sync.Mutex
+	status health.Status
+
+	worker   *workers.Worker
+	stopChan chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewHealthWatcher 创建健康状态监视器并启动检查协程，interval为0时每5秒检查一次
+func NewHealthWatcher(registry *health.Registry, bus *Bus, interval time.Duration) *HealthWatcher {
+	if interval <= 0 {
+		interval = defaultHealthInterval
+	}
+	hw := &HealthWatcher{
+		registry: registry,
+		bus:      bus,
+		interval: interval,
+		instance: hostname(),
+		status:   health.Healthy,
+		stopChan: make(chan struct{}),
+	}
+
+	hw.worker = workers.Register("events.health", interval)
+	hw.worker.Go(&hw.wg, hw.watchWorker)
+	return hw
+}
+
+func (hw *HealthWatcher) watchWorker() {
+	ticker := time.NewTicker(hw.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			hw.Observe(hw.registry.Check())
+			hw.worker.Ran()
+		case <-hw.stopChan:
+			return
+		}
+	}
+}
+
+// Observe 处理一次检查结果，整体状态在healthy与非healthy之间变化时发布事件；
+// degraded与unhealthy之间的变化不发布事件，状态码的变化由 /healthz 反映
+func (hw *HealthWatcher) Observe(report health.Report) {
+	hw.mu.Lock()
+	defer hw.mu.Unlock()
+
+	previous := hw.status
+	hw.status = report.Status
+	if (previous == health.Healthy) == (report.Status == health.Healthy) {
+		return
+	}
+
+	eventType := EventDegradedEntered
+	if report.Status == health.Healthy {
+		eventType = EventDegradedExited
+	}
+	hw.bus.Publish(Event{Type: eventType, Data: map[string]interface{}{
+		"instance":   hw.instance,
+		"status":     report.Status,
+		"components": unhealthyComponents(report),
+	}})
+}
+
+// unhealthyComponents 返回状态不是healthy的组件及其原因
+func unhealthyComponents(report health.Report) map[string]health.Result {
+	components := make(map[string]health.Result)
+	for name, result := range report.Components {
+		if result.Status != health.Healthy {
+			components[name] = result
+		}
+	}
+	return components
+}
+
+// Stop 停止检查
+func (hw *HealthWatcher) Stop() {
+	hw.stopOnce.Do(func() {
+		close(hw.stopChan)
+	})
+	hw.wg.Wait()
+}
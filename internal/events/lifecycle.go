@@ -0,0 +1,83 @@
+package events
+
+import (
+	"os"
+	"reflect"
+	"sync"
+
+	"github.com/mant7s/qps-counter/internal/config"
+)
+
+// hostname 返回事件中附带的实例名，编排系统可以据此区分各个副本
+func hostname() string {
+	instance, _ := os.Hostname()
+	return instance
+}
+
+// Started 返回服务启动完成时发布的事件，附带实例角色和监听端口
+func Started(cfg *config.AppConfig) Event {
+	data := map[string]interface{}{
+		"instance":    hostname(),
+		"role":        cfg.Server.Role,
+		"server_type": cfg.Server.ServerType,
+		"port":        cfg.Server.Port,
+	}
+	if cfg.Server.ServerType == "both" {
+		data["admin_port"] = cfg.Server.AdminPort
+	}
+	return Event{Type: EventStarted, Data: data}
+}
+
+// ConfigReloadNotifier 返回配置重新加载时发布事件的函数，用于config.OnReload
+// current为启动时的配置，事件的sections为与上一次配置相比发生变化的顶层配置项，如 limiter、counter
+func ConfigReloadNotifier(bus *Bus, current *config.AppConfig) func(*config.AppConfig) {
+	instance := hostname()
+	var mu sync.Mutex
+	return func(next *config.AppConfig) {
+		mu.Lock()
+		sections := changedSections(current, next)
+		current = next
+		mu.Unlock()
+
+		bus.Publish(Event{Type: EventConfigReloaded, Data: map[string]interface{}{
+			"instance": instance,
+			"sections": sections,
+		}})
+	}
+}
+
+// changedSections 返回两份配置中取值不同的顶层配置项，名称与配置文件中的键一致
+func changedSections(prev, next *config.AppConfig) []string {
+	sections := []string{}
+	pv, nv := reflect.ValueOf(prev).Elem(), reflect.ValueOf(next).Elem()
+	for i := 0; i < pv.NumField(); i++ {
+		if !reflect.DeepEqual(pv.Field(i).Interface(), nv.Field(i).Interface()) {
+			sections = append(sections, pv.Type().Field(i).Tag.Get("mapstructure"))
+		}
+	}
+	return sections
+}
+
+// ShardResizeNotifier 返回分片数变化时发布事件的函数，用于EnhancedAdaptiveShardingManager.SetNotify
+func ShardResizeNotifier(bus *Bus) func(from, to int32, reason string) {
+	instance := hostname()
+	return func(from, to int32, reason string) {
+		bus.Publish(Event{Type: EventShardsResized, Data: map[string]interface{}{
+			"instance": instance,
+			"from":     from,
+			"to":       to,
+			"reason":   reason,
+		}})
+	}
+}
+
+// LimiterNotifier 返回限流器启用状态变化时发布事件的函数，用于RateLimiter.SetNotify
+func LimiterNotifier(bus *Bus) func(enabled bool) {
+	instance := hostname()
+	return func(enabled bool) {
+		bus.Publish(Event{Type: EventLimiterToggled, Data: map[string]interface{}{
+			"instance": instance,
+			"enabled":  enabled,
+		}})
+	}
+}
@@ -0,0 +1,29 @@
+package events
+
+import (
+	"github.com/mant7s/qps-counter/internal/counter"
+)
+
+// ShutdownNotifier 返回在优雅关闭开始和完成时发布事件的函数，用于EnhancedGracefulShutdown.SetNotify
+// 事件中附带主机名，编排系统可以据此区分滚动发布中的各个副本
+func ShutdownNotifier(bus *Bus) func(counter.ShutdownProgress) {
+	instance := hostname()
+	return func(progress counter.ShutdownProgress) {
+		eventType := EventShutdownStarted
+		if progress.Finished {
+			eventType = EventShutdownFinished
+		}
+
+		data := map[string]interface{}{
+			"instance":        instance,
+			"phase":           progress.Phase,
+			"active_requests": progress.ActiveRequests,
+			"elapsed_seconds": progress.ElapsedSeconds,
+			"forced":          progress.Forced,
+		}
+		if progress.Deadline != nil {
+			data["deadline"] = progress.Deadline
+		}
+		bus.Publish(Event{Type: eventType, Data: data})
+	}
+}
@@ -0,0 +1,122 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/logger"
+	"github.com/mant7s/qps-counter/internal/outbound"
+	"go.uber.org/zap"
+)
+
+const defaultWebhookTimeout = 5 * time.Second
+
+// 签名请求头，配置了密钥的Webhook在每个请求中携带
+const (
+	SignatureHeader = "X-QPS-Signature" // sha256=<十六进制HMAC-SHA256>
+	TimestampHeader = "X-QPS-Timestamp" // 签名时的Unix时间戳（秒），接收方可以据此拒绝重放的旧请求
+)
+
+// WebhookHook 以JSON格式将事件POST到外部HTTP端点（如PagerDuty、自动扩缩容控制器）
+type WebhookHook struct {
+	url     string
+	types   map[string]struct{}
+	timeout time.Duration // 单次投递的超时时间，包括重试
+	secret  string        // 签名密钥，为空时不签名
+	client  *outbound.Client
+}
+
+// NewWebhookHook 创建一个Webhook钩子
+// types 为空时投递所有事件，否则只投递指定类型的事件；client为nil时使用默认配置的出站客户端
+func NewWebhookHook(url string, types []string, timeout time.Duration, client *outbound.Client) *WebhookHook {
+	if timeout <= 0 {
+		timeout = defaultWebhookTimeout
+	}
+	if client == nil {
+		client = outbound.NewClient(config.OutboundConfig{})
+	}
+
+	h := &WebhookHook{
+		url:     url,
+		timeout: timeout,
+		client:  client,
+	}
+	if len(types) > 0 {
+		h.types = make(map[string]struct{}, len(types))
+		for _, t := range types {
+			h.types[t] = struct{}{}
+		}
+	}
+	return h
+}
+
+// WithSecret 设置签名密钥，每个请求携带时间戳和请求体的HMAC-SHA256签名，接收方用Sign校验
+func (h *WebhookHook) WithSecret(secret string) *WebhookHook {
+	h.secret = secret
+	return h
+}
+
+// Sign 返回时间戳和请求体的签名，即 "sha256=" 加上 HMAC-SHA256(secret, timestamp + "." + body) 的十六进制
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Handle 实现Hook接口
+func (h *WebhookHook) Handle(event Event) {
+	if h.types != nil {
+		if _, ok := h.types[event.Type]; !ok {
+			return
+		}
+	}
+
+	if err := h.deliver(event); err != nil {
+		logger.Warn("Webhook投递失败",
+			zap.String("url", h.url),
+			zap.String("type", event.Type),
+			zap.Error(err))
+	}
+}
+
+func (h *WebhookHook) deliver(event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), h.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if h.secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(TimestampHeader, timestamp)
+		req.Header.Set(SignatureHeader, Sign(h.secret, timestamp, body))
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post event: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package health
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mant7s/qps-counter/internal/counter"
+	"github.com/mant7s/qps-counter/internal/ingest"
+	"github.com/mant7s/qps-counter/internal/limiter"
+	"github.com/mant7s/qps-counter/internal/outbound"
+	"github.com/mant7s/qps-counter/internal/replication"
+	"github.com/mant7s/qps-counter/internal/snapshot"
+	"github.com/mant7s/qps-counter/internal/workers"
+)
+
+// queueFullRatio 采集队列长度超过容量的该比例时认为即将丢弃事件
+const queueFullRatio = 0.9
+
+// ShutdownCheck 开始优雅关闭后为degraded，关闭期间仍处理已接收的请求，不返回503
+func ShutdownCheck(gs *counter.EnhancedGracefulShutdown) Check {
+	return func() Result {
+		if status := gs.Status(); status != "running" {
+			return Result{Status: Degraded, Reason: "正在关闭: " + status}
+		}
+		return Result{Status: Healthy}
+	}
+}
+
+// WorkersCheck 有后台协程被看门狗判定为卡住时为degraded
+func WorkersCheck() Check {
+	return func() Result {
+		var stalled []string
+		for _, info := range workers.List() {
+			if info.Stalled {
+				stalled = append(stalled, info.Name)
+			}
+		}
+		if len(stalled) > 0 {
+			return Result{Status: Degraded, Reason: "后台协程卡住: " + strings.Join(stalled, ", ")}
+		}
+		return Result{Status: Healthy}
+	}
+}
+
+// LimiterCheck 限流器出错时为degraded，此时按limiter.failure的策略放行或拒绝请求
+func LimiterCheck(rl *limiter.RateLimiter) Check {
+	return func() Result {
+		if err := rl.Err(); err != nil {
+			return Result{Status: Degraded, Reason: "限流器出错: " + err.Error()}
+		}
+		return Result{Status: Healthy}
+	}
+}
+
+// IngestCheck 采集已暂停或队列即将满时为degraded，pool为nil时只检查采集开关
+func IngestCheck(pool *ingest.Pool, sw *ingest.Switch) Check {
+	return func() Result {
+		if sw.Paused() {
+			return Result{Status: Degraded, Reason: "采集已暂停"}
+		}
+		if pool != nil {
+			length, capacity := pool.QueueLength(), pool.QueueCapacity()
+			if capacity > 0 && float64(length) >= float64(capacity)*queueFullRatio {
+				return Result{Status: Degraded, Reason: fmt.Sprintf("采集队列即将满: %d/%d", length, capacity)}
+			}
+		}
+		return Result{Status: Healthy}
+	}
+}
+
+// FollowerCheck 只读副本没有连接任何上报节点时为unhealthy，只连接了部分节点时为degraded
+func FollowerCheck(f *replication.Follower) Check {
+	return func() Result {
+		connected, total := f.Connected()
+		switch {
+		case total > 0 && connected == 0:
+			return Result{Status: Unhealthy, Reason: "未连接任何上报节点"}
+		case connected < total:
+			return Result{Status: Degraded, Reason: fmt.Sprintf("已连接%d/%d个上报节点", connected, total)}
+		}
+		return Result{Status: Healthy}
+	}
+}
+
+// OutboundCheck 有目标地址处于熔断中时为degraded
+func OutboundCheck(client *outbound.Client) Check {
+	return func() Result {
+		var open []string
+		for _, stats := range client.Stats() {
+			if stats.State == outbound.StateOpen {
+				open = append(open, stats.Destination)
+			}
+		}
+		if len(open) > 0 {
+			return Result{Status: Degraded, Reason: "出站请求熔断中: " + strings.Join(open, ", ")}
+		}
+		return Result{Status: Healthy}
+	}
+}
+
+// SnapshotCheck 最近一次写入快照失败时为degraded，重启后可能丢失计数
+func SnapshotCheck(s *snapshot.Snapshotter) Check {
+	return func() Result {
+		if err := s.Err(); err != nil {
+			return Result{Status: Degraded, Reason: "写入快照失败: " + err.Error()}
+		}
+		return Result{Status: Healthy}
+	}
+}
@@ -0,0 +1,91 @@
+package health
+
+import (
+	"net/http"
+	"sync"
+)
+
+// Status 组件的健康状态
+type Status string
+
+const (
+	Healthy   Status = "healthy"   // 正常
+	Degraded  Status = "degraded"  // 仍能提供服务，但部分功能受影响，如采集已暂停
+	Unhealthy Status = "unhealthy" // 不能正常提供服务，负载均衡应摘除该实例
+)
+
+// Level 返回状态的严重程度，healthy为0、degraded为1、unhealthy为2，用于聚合和导出指标
+func (s Status) Level() int {
+	switch s {
+	case Healthy:
+		return 0
+	case Degraded:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// Result 一个组件的检查结果
+type Result struct {
+	Status Status `json:"status"`
+	Reason string `json:"reason,omitempty"` // 不健康的原因，healthy时为空
+}
+
+// Check 检查一个组件的健康状态，在每次请求 /healthz 或抓取指标时调用，不应阻塞
+type Check func() Result
+
+// Report 所有组件的检查结果，整体状态取最严重的组件状态
+type Report struct {
+	Status     Status            `json:"status"`
+	Components map[string]Result `json:"components"`
+}
+
+// StatusCode 返回 /healthz 的HTTP状态码，只有unhealthy时返回503，degraded的实例仍然接收流量
+func (r Report) StatusCode() int {
+	if r.Status == Unhealthy {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusOK
+}
+
+// Registry 组件健康检查的注册表，各子系统启动时注册自己的检查
+// nil表示没有注册任何检查，Check返回healthy
+type Registry struct {
+	mu     sync.RWMutex
+	checks map[string]Check
+}
+
+// NewRegistry 创建一个空的注册表
+func NewRegistry() *Registry {
+	return &Registry{checks: make(map[string]Check)}
+}
+
+// Register 注册组件的健康检查，同名的检查被替换
+func (r *Registry) Register(name string, check Check) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks[name] = check
+}
+
+// Check 执行所有检查并聚合结果
+func (r *Registry) Check() Report {
+	report := Report{Status: Healthy, Components: make(map[string]Result)}
+	if r == nil {
+		return report
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for name, check := range r.checks {
+		result := check()
+		if result.Status == "" {
+			result.Status = Healthy
+		}
+		report.Components[name] = result
+		if result.Status.Level() > report.Status.Level() {
+			report.Status = result.Status
+		}
+	}
+	return report
+}
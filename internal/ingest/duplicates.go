@@ -0,0 +1,370 @@
+package ingest
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/counter"
+	"github.com/mant7s/qps-counter/internal/logger"
+	"github.com/mant7s/qps-counter/internal/workers"
+	"go.uber.org/zap"
+)
+
+// 检测到重复上报时的处理方式
+const (
+	DuplicateFlag  = "flag"  // 只在 /diagnostics 中标记，上报照常计数
+	DuplicateMerge = "merge" // 被判定为重复的上报流不再计数，相当于与原始上报流合并
+)
+
+const (
+	defaultDuplicateSourceHeader = "X-Agent-ID"
+	defaultDuplicateReports      = 6
+	defaultDuplicateMaxKeys      = 1000
+	defaultDuplicateIdleTimeout  = 5 * time.Minute
+	maxDuplicateSourcesPerKey    = 16
+)
+
+// duplicateStream 一个来源对一个key的上报流，保存最近reports次上报的计数和到达时间
+type duplicateStream struct {
+	counts   []int64 // 环形缓冲区，next指向最早的一次上报
+	times    []int64
+	next     int
+	reports  int64
+	lastSeen int64
+
+	duplicateOf string // 与之重复的来源，为空表示未被判定为重复
+	detectedAt  int64
+	duplicates  int64 // 判定为重复之后的上报次数
+	merged      int64 // merge模式下未计数的计数之和
+}
+
+// at 返回倒数第i次上报（0为最近一次）的计数和到达时间
+func (s *duplicateStream) at(i int) (int64, int64) {
+	n := len(s.counts)
+	j := (s.next - 1 - i + 2*n) % n
+	return s.counts[j], s.times[j]
+}
+
+// interval 返回最近reports次上报的平均间隔
+func (s *duplicateStream) interval() int64 {
+	_, latest := s.at(0)
+	_, oldest := s.at(len(s.counts) - 1)
+	return (latest - oldest) / int64(len(s.counts)-1)
+}
+
+// duplicateKey 一个key下各来源的上报流
+type duplicateKey struct {
+	mu      sync.Mutex
+	streams map[string]*duplicateStream
+}
+
+// DuplicateFinding 一对疑似重复的上报流
+type DuplicateFinding struct {
+	Key         string    `json:"key"`
+	Source      string    `json:"source"`       // 被判定为重复的来源
+	DuplicateOf string    `json:"duplicate_of"` // 与之重复的来源
+	Interval    string    `json:"interval"`     // 上报间隔
+	Reports     int64     `json:"reports"`      // 判定为重复之后的上报次数
+	Merged      int64     `json:"merged"`       // merge模式下未计数的计数之和
+	DetectedAt  time.Time `json:"detected_at"`
+	LastSeen    time.Time `json:"last_seen"`
+}
+
+// DuplicateDetector 检测同一主机上多个sidecar代理重复上报相同流量的常见误配置
+// 同一key下来自不同来源的两个上报流，最近reports次上报的计数序列完全相同、上报间隔相差不超过10%，
+// 且最近一次上报相隔不超过一个间隔时判定为重复；计数序列只有一种取值时无法区分巧合，不判定
+// 后判定的上报流标记为重复，flag模式只在 /diagnostics 中列出，merge模式下不再计数，序列不再一致时自动恢复
+// nil表示未启用检测，所有方法都可以在nil上调用
+type DuplicateDetector struct {
+	action       string
+	sourceHeader string
+	reports      int
+	maxKeys      int
+	idleTimeout  time.Duration
+
+	keys     *counter.ShardedMap[*duplicateKey]
+	count    atomic.Int64 // 跟踪的key数量
+	overflow atomic.Int64 // 因超出key数量或单个key的来源数上限未检测的上报次数
+
+	worker   *workers.Worker
+	stopChan chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewDuplicateDetector 创建重复上报检测并启动清理协程，未启用时返回nil
+func NewDuplicateDetector(cfg config.DuplicatesConfig) *DuplicateDetector {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	d := &DuplicateDetector{
+		action:       cfg.Action,
+		sourceHeader: cfg.SourceHeader,
+		reports:      cfg.Reports,
+		maxKeys:      cfg.MaxKeys,
+		idleTimeout:  cfg.IdleTimeout,
+		keys:         counter.NewShardedMap[*duplicateKey](0),
+		stopChan:     make(chan struct{}),
+	}
+	if d.action != DuplicateMerge {
+		d.action = DuplicateFlag
+	}
+	if d.sourceHeader == "" {
+		d.sourceHeader = defaultDuplicateSourceHeader
+	}
+	if d.reports <= 1 {
+		d.reports = defaultDuplicateReports
+	}
+	if d.maxKeys <= 0 {
+		d.maxKeys = defaultDuplicateMaxKeys
+	}
+	if d.idleTimeout <= 0 {
+		d.idleTimeout = defaultDuplicateIdleTimeout
+	}
+
+	d.worker = workers.Register("ingest.duplicates", d.idleTimeout)
+	d.worker.Go(&d.wg, d.cleanupWorker)
+	return d
+}
+
+// SourceHeader 返回标识上报代理的请求头名称
+func (d *DuplicateDetector) SourceHeader() string {
+	if d == nil {
+		return ""
+	}
+	return d.sourceHeader
+}
+
+// Observe 记录source对key的一次上报，返回该上报是否应当丢弃（merge模式下属于重复的上报流）
+func (d *DuplicateDetector) Observe(source, key string, count int64) bool {
+	return d.ObserveAt(source, key, count, time.Now())
+}
+
+// ObserveAt 与Observe相同，使用给定的到达时间
+func (d *DuplicateDetector) ObserveAt(source, key string, count int64, now time.Time) bool {
+	if d == nil || source == "" {
+		return false
+	}
+
+	k, ok := d.keys.LoadOrCreate(key, func() (*duplicateKey, bool) {
+		if d.count.Add(1) > int64(d.maxKeys) {
+			d.count.Add(-1)
+			return nil, false
+		}
+		return &duplicateKey{streams: make(map[string]*duplicateStream)}, true
+	})
+	if !ok {
+		d.overflow.Add(1)
+		return false
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	ts := now.UnixNano()
+	s, ok := k.streams[source]
+	if !ok {
+		if len(k.streams) >= maxDuplicateSourcesPerKey {
+			d.overflow.Add(1)
+			return false
+		}
+		s = &duplicateStream{counts: make([]int64, d.reports), times: make([]int64, d.reports)}
+		k.streams[source] = s
+	}
+	s.counts[s.next], s.times[s.next] = count, ts
+	s.next = (s.next + 1) % d.reports
+	s.reports++
+	s.lastSeen = ts
+
+	d.compare(k, key, source, s, ts)
+	if s.duplicateOf == "" {
+		return false
+	}
+	s.duplicates++
+	if d.action != DuplicateMerge {
+		return false
+	}
+	s.merged += count
+	return true
+}
+
+// compare 把source的上报流与同一key下其他来源的上报流比较，更新其重复状态
+func (d *DuplicateDetector) compare(k *duplicateKey, key, source string, s *duplicateStream, now int64) {
+	if s.duplicateOf != "" {
+		original, ok := k.streams[s.duplicateOf]
+		if ok && d.matches(s, original) {
+			return
+		}
+		// 到达顺序抖动时重复的上报可能先于原始上报到达，原始上报流在一个间隔内没有跟上时才取消判定
+		if _, previous := s.at(1); ok && original.lastSeen < previous && now-original.lastSeen <= s.interval() {
+			return
+		}
+		logger.Info("上报流不再与其他来源重复",
+			zap.String("key", key), zap.String("source", source), zap.String("duplicate_of", s.duplicateOf))
+		s.duplicateOf = ""
+	}
+
+	for other, o := range k.streams {
+		if other == source || o.duplicateOf == source || !d.matches(s, o) {
+			continue
+		}
+		s.duplicateOf, s.detectedAt, s.duplicates, s.merged = other, now, 0, 0
+		logger.Warn("检测到重复上报",
+			zap.String("key", key),
+			zap.String("source", source),
+			zap.String("duplicate_of", other),
+			zap.Duration("interval", time.Duration(s.interval())),
+			zap.String("action", d.action))
+		return
+	}
+}
+
+// matches 返回两个上报流最近reports次上报的计数序列和上报间隔是否一致
+func (d *DuplicateDetector) matches(a, b *duplicateStream) bool {
+	if a.reports < int64(d.reports) || b.reports < int64(d.reports) {
+		return false
+	}
+
+	first, _ := a.at(0)
+	varied := false
+	for i := 0; i < d.reports; i++ {
+		ca, _ := a.at(i)
+		cb, _ := b.at(i)
+		if ca != cb {
+			return false
+		}
+		varied = varied || ca != first
+	}
+	if !varied {
+		return false
+	}
+
+	ia, ib := a.interval(), b.interval()
+	if ia <= 0 || ib <= 0 || abs(ia-ib)*10 > ia {
+		return false
+	}
+	return abs(a.lastSeen-b.lastSeen) <= ia
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// Findings 返回当前被判定为重复的上报流，按key和来源排序
+func (d *DuplicateDetector) Findings() []DuplicateFinding {
+	findings := []DuplicateFinding{}
+	if d == nil {
+		return findings
+	}
+
+	d.keys.Range(func(key string, k *duplicateKey) bool {
+		k.mu.Lock()
+		for source, s := range k.streams {
+			if s.duplicateOf == "" {
+				continue
+			}
+			findings = append(findings, DuplicateFinding{
+				Key:         key,
+				Source:      source,
+				DuplicateOf: s.duplicateOf,
+				Interval:    time.Duration(s.interval()).Round(time.Millisecond).String(),
+				Reports:     s.duplicates,
+				Merged:      s.merged,
+				DetectedAt:  time.Unix(0, s.detectedAt),
+				LastSeen:    time.Unix(0, s.lastSeen),
+			})
+		}
+		k.mu.Unlock()
+		return true
+	})
+	sort.Slice(findings, func(i, j int) bool {
+		if findings[i].Key != findings[j].Key {
+			return findings[i].Key < findings[j].Key
+		}
+		return findings[i].Source < findings[j].Source
+	})
+	return findings
+}
+
+// GetStats 获取重复上报检测的状态
+func (d *DuplicateDetector) GetStats() map[string]interface{} {
+	if d == nil {
+		return map[string]interface{}{"enabled": false}
+	}
+	return map[string]interface{}{
+		"enabled":       true,
+		"action":        d.action,
+		"source_header": d.sourceHeader,
+		"reports":       d.reports,
+		"tracked_keys":  d.count.Load(),
+		"overflow":      d.overflow.Load(),
+		"findings":      d.Findings(),
+	}
+}
+
+// cleanupWorker 每隔idle_timeout清理一次没有上报的上报流和key
+func (d *DuplicateDetector) cleanupWorker() {
+	ticker := time.NewTicker(d.idleTimeout)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			d.Cleanup(time.Now())
+			d.worker.Ran()
+		case <-d.stopChan:
+			return
+		}
+	}
+}
+
+// Cleanup 删除now之前idle_timeout内没有上报的上报流，所有上报流都被删除的key不再跟踪
+func (d *DuplicateDetector) Cleanup(now time.Time) {
+	if d == nil {
+		return
+	}
+
+	cutoff := now.Add(-d.idleTimeout).UnixNano()
+	// Range期间持有分片的读锁，先收集再删除
+	var idle []string
+	d.keys.Range(func(key string, k *duplicateKey) bool {
+		k.mu.Lock()
+		for source, s := range k.streams {
+			if s.lastSeen < cutoff {
+				delete(k.streams, source)
+			}
+		}
+		for _, s := range k.streams {
+			if s.duplicateOf != "" && k.streams[s.duplicateOf] == nil {
+				s.duplicateOf = ""
+			}
+		}
+		if len(k.streams) == 0 {
+			idle = append(idle, key)
+		}
+		k.mu.Unlock()
+		return true
+	})
+	for _, key := range idle {
+		d.keys.Delete(key)
+		d.count.Add(-1)
+	}
+}
+
+// Stop 停止清理协程
+func (d *DuplicateDetector) Stop() {
+	if d == nil {
+		return
+	}
+	d.stopOnce.Do(func() {
+		close(d.stopChan)
+	})
+	d.wg.Wait()
+}
@@ -0,0 +1,92 @@
+package ingest
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/mant7s/qps-counter/internal/logger"
+	"go.uber.org/zap"
+)
+
+// 采集暂停期间新事件的处理方式
+const (
+	PauseReject = "reject" // HTTP上报返回503，上报方可以稍后重试
+	PauseDrop   = "drop"   // HTTP上报返回成功但不计数
+)
+
+// Switch 采集的全局开关
+// 用于计数服务本身被怀疑是故障原因时的应急处理，暂停后所有数据源都不再计入新事件
+// nil表示不支持暂停，所有方法都可以在nil上调用
+type Switch struct {
+	mode         string
+	paused       atomic.Bool
+	pausedAt     atomic.Int64 // 暂停开始时间（纳秒），未暂停时为0
+	droppedCount atomic.Int64 // 暂停期间被拒绝或丢弃的事件数
+}
+
+// NewSwitch 创建采集开关，mode为空时使用reject
+func NewSwitch(mode string) *Switch {
+	if mode != PauseDrop {
+		mode = PauseReject
+	}
+	return &Switch{mode: mode}
+}
+
+// Pause 暂停采集，返回状态是否发生变化
+func (s *Switch) Pause() bool {
+	if !s.paused.CompareAndSwap(false, true) {
+		return false
+	}
+	s.pausedAt.Store(time.Now().UnixNano())
+	logger.Warn("采集已暂停", zap.String("mode", s.mode))
+	return true
+}
+
+// Resume 恢复采集，返回状态是否发生变化
+func (s *Switch) Resume() bool {
+	if !s.paused.CompareAndSwap(true, false) {
+		return false
+	}
+	pausedAt := s.pausedAt.Swap(0)
+	logger.Warn("采集已恢复",
+		zap.Duration("paused_for", time.Since(time.Unix(0, pausedAt))),
+		zap.Int64("dropped_count", s.droppedCount.Load()))
+	return true
+}
+
+// Paused 返回采集是否已暂停
+func (s *Switch) Paused() bool {
+	return s != nil && s.paused.Load()
+}
+
+// Mode 返回暂停期间新事件的处理方式
+func (s *Switch) Mode() string {
+	if s == nil {
+		return PauseReject
+	}
+	return s.mode
+}
+
+// Drop 记录一个暂停期间被拒绝或丢弃的事件
+func (s *Switch) Drop() {
+	if s != nil {
+		s.droppedCount.Add(1)
+	}
+}
+
+// GetStats 获取采集开关状态
+func (s *Switch) GetStats() map[string]interface{} {
+	stats := map[string]interface{}{
+		"paused":        s.Paused(),
+		"mode":          s.Mode(),
+		"dropped_count": int64(0),
+	}
+	if s == nil {
+		return stats
+	}
+	stats["dropped_count"] = s.droppedCount.Load()
+	if pausedAt := s.pausedAt.Load(); pausedAt > 0 {
+		stats["paused_at"] = time.Unix(0, pausedAt).Format(time.RFC3339)
+	}
+	return stats
+}
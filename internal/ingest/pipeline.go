@@ -0,0 +1,271 @@
+package ingest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"math/rand/v2"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/logger"
+	"github.com/mant7s/qps-counter/internal/workers"
+	"go.uber.org/zap"
+)
+
+// 采集管道的数据源
+const (
+	SourceUDP  = "udp"  // 监听UDP端口，每个数据报包含一行或多行
+	SourceTail = "tail" // 跟踪日志文件新增的行，文件被截断或轮转后从头读取新文件
+)
+
+// 采集管道每一行的格式
+const (
+	FormatJSON = "json" // {"key": "...", "count": N, "timestamp": ..., "attributes": {...}}，与/collect的v2格式相同
+	FormatLine = "line" // 整行为key，计数为1，适合每行一个请求路径的访问日志
+)
+
+const defaultPipelineKeyLength = 256
+
+// Source 采集管道的数据源，Run阻塞读取数据直到Close被调用，每读到一行调用一次emit
+// Kafka等其他数据源实现该接口即可复用管道的解码、归一化、采样和指标
+type Source interface {
+	Run(emit func(line []byte)) error
+	Close() error
+}
+
+// PipelineStats 采集管道各阶段的事件数
+type PipelineStats struct {
+	Name      string `json:"name"`
+	Source    string `json:"source"`
+	Received  int64  `json:"received"`  // 从数据源读到的非空行数
+	Invalid   int64  `json:"invalid"`   // 解码或校验失败的行数
+	Sampled   int64  `json:"sampled"`   // 被采样丢弃的事件数
+	Submitted int64  `json:"submitted"` // 提交到工作池的事件数
+	Dropped   int64  `json:"dropped"`   // 工作池未接受（队列已满或采集暂停）的事件数
+}
+
+// Pipeline 一条采集管道：source -> decode -> normalize -> enrich -> count
+// UDP、日志文件等数据源共享同一套解码、key归一化、采样和指标，归一化后的事件提交到共享的工作池计数
+type Pipeline struct {
+	name       string
+	sourceName string
+	source     Source
+	format     string
+	key        config.PipelineKeyConfig
+	sampleRate float64
+	attributes map[string]string
+	pool       *Pool
+
+	received  atomic.Int64
+	invalid   atomic.Int64
+	sampled   atomic.Int64
+	submitted atomic.Int64
+	dropped   atomic.Int64
+
+	worker   *workers.Worker
+	wg       sync.WaitGroup
+	stopOnce sync.Once
+}
+
+// NewPipeline 打开配置的数据源并开始读取，事件提交到pool；数据源无法打开时返回错误
+func NewPipeline(cfg config.PipelineConfig, pool *Pool) (*Pipeline, error) {
+	var (
+		source Source
+		err    error
+	)
+	switch cfg.Source {
+	case SourceUDP:
+		source, err = newUDPSource(cfg.Address)
+	case SourceTail:
+		source = newTailSource(cfg.Path)
+	default:
+		err = fmt.Errorf("不支持的数据源: %s", cfg.Source)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("采集管道%s: %w", cfg.Name, err)
+	}
+	return NewPipelineWithSource(cfg, source, pool), nil
+}
+
+// NewPipelineWithSource 使用给定的数据源创建采集管道并开始读取，用于接入内置数据源以外的数据源
+func NewPipelineWithSource(cfg config.PipelineConfig, source Source, pool *Pool) *Pipeline {
+	format := cfg.Format
+	if format == "" {
+		format = FormatJSON
+	}
+	key := cfg.Key
+	if key.MaxLength <= 0 {
+		key.MaxLength = defaultPipelineKeyLength
+	}
+	p := &Pipeline{
+		name:       cfg.Name,
+		sourceName: cfg.Source,
+		source:     source,
+		format:     format,
+		key:        key,
+		sampleRate: cfg.SampleRate,
+		attributes: cfg.Attributes,
+		pool:       pool,
+	}
+	p.worker = workers.Register("ingest.pipeline", 0)
+	p.worker.Go(&p.wg, p.run)
+	return p
+}
+
+// run 读取数据源直到Stop关闭数据源
+func (p *Pipeline) run() {
+	if err := p.source.Run(func(line []byte) {
+		p.Process(line)
+		p.worker.Ran()
+	}); err != nil {
+		p.worker.Fail(err)
+		logger.Error("采集管道的数据源读取失败", zap.String("pipeline", p.name), zap.Error(err))
+	}
+}
+
+// Process 依次对一行数据解码、归一化key、采样、补充标签后提交到工作池，返回事件是否被工作池接受
+func (p *Pipeline) Process(line []byte) bool {
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 {
+		return false
+	}
+	p.received.Add(1)
+
+	event, err := p.decode(line)
+	if err != nil {
+		if invalid := p.invalid.Add(1); invalid%1000 == 1 { // 避免日志过多
+			logger.Warn("采集管道丢弃无法解码的数据",
+				zap.String("pipeline", p.name),
+				zap.Error(err),
+				zap.Int64("invalid_count", invalid))
+		}
+		return false
+	}
+	event.Key = p.normalize(event.Key)
+	if !p.sample(&event) {
+		p.sampled.Add(1)
+		return false
+	}
+	p.enrich(&event)
+
+	if !p.pool.Submit(event) {
+		p.dropped.Add(1)
+		return false
+	}
+	p.submitted.Add(1)
+	return true
+}
+
+// pipelineRecord json格式的一行
+type pipelineRecord struct {
+	Key        string            `json:"key"`
+	Count      *int64            `json:"count"`
+	Timestamp  int64             `json:"timestamp"`
+	Attributes map[string]string `json:"attributes"`
+}
+
+// decode 按管道的格式解码一行，json格式的count默认为1
+func (p *Pipeline) decode(line []byte) (Event, error) {
+	event := Event{Source: p.name, Count: 1}
+	if p.format == FormatLine {
+		event.Key = string(line)
+		return event, nil
+	}
+
+	var record pipelineRecord
+	if err := json.Unmarshal(line, &record); err != nil {
+		return Event{}, err
+	}
+	if record.Count != nil {
+		event.Count = *record.Count
+	}
+	if event.Count < 0 {
+		return Event{}, errors.New("count不能为负数")
+	}
+	if record.Timestamp < 0 {
+		return Event{}, errors.New("timestamp不能为负数")
+	}
+	event.Key, event.Timestamp, event.Attributes = record.Key, record.Timestamp, record.Attributes
+	return event, nil
+}
+
+// normalize 按配置去掉查询参数、转为小写并截断key
+func (p *Pipeline) normalize(key string) string {
+	if p.key.StripQuery {
+		if i := strings.IndexByte(key, '?'); i >= 0 {
+			key = key[:i]
+		}
+	}
+	if p.key.Lowercase {
+		key = strings.ToLower(key)
+	}
+	if len(key) > p.key.MaxLength {
+		key = key[:p.key.MaxLength]
+	}
+	return key
+}
+
+// sample 按sample_rate决定是否保留事件，保留的事件按1/sample_rate放大计数，使总数的期望不变
+func (p *Pipeline) sample(event *Event) bool {
+	if p.sampleRate <= 0 || p.sampleRate >= 1 {
+		return true
+	}
+	if rand.Float64() >= p.sampleRate {
+		return false
+	}
+	event.Count = int64(math.Round(float64(event.Count) / p.sampleRate))
+	return true
+}
+
+// enrich 为事件补充配置的标签，事件自带的同名标签优先
+func (p *Pipeline) enrich(event *Event) {
+	if len(p.attributes) == 0 {
+		return
+	}
+	attributes := maps.Clone(p.attributes)
+	maps.Copy(attributes, event.Attributes)
+	event.Attributes = attributes
+}
+
+// Name 返回管道名称
+func (p *Pipeline) Name() string {
+	return p.name
+}
+
+// Addr 返回数据源监听的地址，数据源不监听网络地址时返回nil
+func (p *Pipeline) Addr() net.Addr {
+	if aware, ok := p.source.(interface{ Addr() net.Addr }); ok {
+		return aware.Addr()
+	}
+	return nil
+}
+
+// Stats 返回管道各阶段的事件数
+func (p *Pipeline) Stats() PipelineStats {
+	return PipelineStats{
+		Name:      p.name,
+		Source:    p.sourceName,
+		Received:  p.received.Load(),
+		Invalid:   p.invalid.Load(),
+		Sampled:   p.sampled.Load(),
+		Submitted: p.submitted.Load(),
+		Dropped:   p.dropped.Load(),
+	}
+}
+
+// Stop 关闭数据源并等待读取协程退出，应在停止工作池之前调用
+func (p *Pipeline) Stop() {
+	p.stopOnce.Do(func() {
+		if err := p.source.Close(); err != nil {
+			logger.Warn("关闭采集管道的数据源失败", zap.String("pipeline", p.name), zap.Error(err))
+		}
+	})
+	p.wg.Wait()
+}
@@ -0,0 +1,235 @@
+package ingest
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/counter"
+	"github.com/mant7s/qps-counter/internal/logger"
+	"github.com/mant7s/qps-counter/internal/workers"
+	"go.uber.org/zap"
+)
+
+// 队列已满时的溢出策略
+const (
+	OverflowBlock      = "block"       // 阻塞提交方直到队列有空位
+	OverflowDropOldest = "drop_oldest" // 丢弃队列中最早的事件
+	OverflowDropNewest = "drop_newest" // 丢弃新提交的事件
+)
+
+const defaultQueueSize = 4096
+
+// Event 一次待计数的事件
+type Event struct {
+	Source     string            // 事件来源，如 udp、kafka，通过采集管道提交时为管道名称
+	Key        string            // 事件的key，为空时不按key计数
+	Count      int64             // 事件数量
+	Timestamp  int64             // 事件发生的Unix毫秒时间戳，0表示按处理时间计数
+	Attributes map[string]string // 事件标签
+}
+
+// Delay 返回事件时间早于now的时长，未携带时间戳或事件时间晚于now时返回0
+func (e Event) Delay(now time.Time) time.Duration {
+	if e.Timestamp <= 0 {
+		return 0
+	}
+	return max(now.Sub(time.UnixMilli(e.Timestamp)), 0)
+}
+
+// Sink 消费事件的函数，由工作协程调用
+type Sink func(event Event)
+
+// CounterSink 将事件写入计数器，携带时间戳的事件写入事件时间所在的槽位，超出窗口时丢弃
+// taggedCounter、keyedCounter不为nil时同时按标签组合和key计数
+func CounterSink(c counter.Counter, taggedCounter *counter.TaggedCounter, keyedCounter *counter.KeyedCounter) Sink {
+	return func(event Event) {
+		if !counter.AddDelayed(c, event.Count, event.Delay(time.Now())) {
+			return
+		}
+		taggedCounter.Add(event.Attributes, event.Count)
+		keyedCounter.Add(event.Key, event.Count)
+	}
+}
+
+// Pool 有界工作池
+// UDP、Kafka、gRPC等数据源共享同一个工作池向计数器写入事件，
+// 避免每个数据源各自无限制地创建协程
+type Pool struct {
+	sink     Sink
+	pause    *Switch
+	overflow string
+	queue    chan Event
+	stopChan chan struct{}
+	stopOnce sync.Once
+	stopped  atomic.Bool
+	wg       sync.WaitGroup
+	workers  int
+
+	submittedCount atomic.Int64 // 成功入队的事件数
+	processedCount atomic.Int64 // 已处理的事件数
+	droppedCount   atomic.Int64 // 因队列已满或已停止被丢弃的事件数
+}
+
+// NewPool 创建一个工作池并启动工作协程，pause不为nil时采集暂停期间不再接受新事件
+func NewPool(cfg config.IngestConfig, sink Sink, pause *Switch) *Pool {
+	workerCount := cfg.Workers
+	if workerCount <= 0 {
+		workerCount = runtime.NumCPU()
+	}
+	queueSize := cfg.QueueSize
+	if queueSize <= 0 {
+		queueSize = defaultQueueSize
+	}
+	overflow := cfg.Overflow
+	if overflow == "" {
+		overflow = OverflowBlock
+	}
+
+	p := &Pool{
+		sink:     sink,
+		pause:    pause,
+		overflow: overflow,
+		queue:    make(chan Event, queueSize),
+		stopChan: make(chan struct{}),
+		workers:  workerCount,
+	}
+
+	for i := 0; i < workerCount; i++ {
+		worker := workers.Register("ingest.worker", 0)
+		worker.Go(&p.wg, func() { p.worker(worker) })
+	}
+	return p
+}
+
+// Submit 提交一个事件，返回事件是否入队
+// 队列已满时按溢出策略处理：block 阻塞直到有空位，drop_newest 丢弃该事件，
+// drop_oldest 丢弃队列中最早的事件后入队。采集暂停期间直接丢弃新事件
+func (p *Pool) Submit(event Event) bool {
+	if p.pause.Paused() {
+		p.pause.Drop()
+		return false
+	}
+
+	if p.stopped.Load() {
+		p.drop(event)
+		return false
+	}
+
+	select {
+	case p.queue <- event:
+		p.submittedCount.Add(1)
+		return true
+	default:
+	}
+
+	switch p.overflow {
+	case OverflowDropNewest:
+		p.drop(event)
+		return false
+	case OverflowDropOldest:
+		for {
+			select {
+			case p.queue <- event:
+				p.submittedCount.Add(1)
+				return true
+			default:
+			}
+			select {
+			case oldest := <-p.queue:
+				p.drop(oldest)
+			default:
+			}
+		}
+	default:
+		select {
+		case p.queue <- event:
+			p.submittedCount.Add(1)
+			return true
+		case <-p.stopChan:
+			p.drop(event)
+			return false
+		}
+	}
+}
+
+// drop 记录一个被丢弃的事件
+func (p *Pool) drop(event Event) {
+	dropped := p.droppedCount.Add(1)
+	if dropped%1000 == 1 { // 避免日志过多
+		logger.Warn("采集队列已满，丢弃事件",
+			zap.String("source", event.Source),
+			zap.String("overflow", p.overflow),
+			zap.Int64("dropped_count", dropped))
+	}
+}
+
+// worker 从队列中取出事件并写入计数器
+func (p *Pool) worker(worker *workers.Worker) {
+	for {
+		select {
+		case event := <-p.queue:
+			p.process(event)
+			worker.Ran()
+		case <-p.stopChan:
+			// 处理队列中剩余的事件
+			for {
+				select {
+				case event := <-p.queue:
+					p.process(event)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (p *Pool) process(event Event) {
+	p.sink(event)
+	p.processedCount.Add(1)
+}
+
+// QueueLength 返回当前队列长度
+func (p *Pool) QueueLength() int {
+	return len(p.queue)
+}
+
+// QueueCapacity 返回队列容量
+func (p *Pool) QueueCapacity() int {
+	return cap(p.queue)
+}
+
+// Processed 返回已处理的事件数
+func (p *Pool) Processed() int64 {
+	return p.processedCount.Load()
+}
+
+// Dropped 返回被丢弃的事件数
+func (p *Pool) Dropped() int64 {
+	return p.droppedCount.Load()
+}
+
+// Stop 停止工作池，等待队列中剩余的事件处理完成
+func (p *Pool) Stop() {
+	p.stopOnce.Do(func() {
+		p.stopped.Store(true)
+		close(p.stopChan)
+	})
+	p.wg.Wait()
+}
+
+// GetStats 获取工作池统计信息
+func (p *Pool) GetStats() map[string]interface{} {
+	return map[string]interface{}{
+		"workers":         p.workers,
+		"overflow":        p.overflow,
+		"queue_length":    len(p.queue),
+		"queue_capacity":  cap(p.queue),
+		"submitted_count": p.submittedCount.Load(),
+		"processed_count": p.processedCount.Load(),
+		"dropped_count":   p.droppedCount.Load(),
+	}
+}
@@ -0,0 +1,259 @@
+package ingest
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/counter"
+	"github.com/mant7s/qps-counter/internal/workers"
+)
+
+// 签名上报携带的请求头，代理标识的请求头由ingest.signing.agent_header配置
+const (
+	SignatureHeader = "X-QPS-Signature" // sha256=<十六进制HMAC-SHA256>
+	TimestampHeader = "X-QPS-Timestamp" // 签名时的Unix时间戳（秒）
+	NonceHeader     = "X-QPS-Nonce"     // 每次上报不同的随机字符串
+)
+
+const (
+	defaultSigningAgentHeader = "X-Agent-ID"
+	defaultSigningMaxSkew     = 5 * time.Minute
+	defaultSigningMaxNonces   = 100000
+	minNonceLength            = 8
+	maxNonceLength            = 128
+)
+
+var (
+	ErrUnsignedReport = errors.New("上报缺少签名、时间戳或nonce")
+	ErrUnknownAgent   = errors.New("未知的上报代理")
+	ErrStaleReport    = errors.New("上报时间戳超出允许的偏差")
+	ErrBadSignature   = errors.New("上报签名无效")
+	ErrReplayedReport = errors.New("重放的上报")
+	ErrNonceCacheFull = errors.New("nonce记录已满")
+)
+
+// SignedRequest 签名覆盖的请求内容
+// 签名只覆盖这里的字段以及时间戳和nonce，其他请求头（如Content-Type、X-API-Key、租户请求头）不在签名范围内
+type SignedRequest struct {
+	Method   string // 请求方法，签名时统一为大写
+	Path     string // 请求行中的路径，不含查询参数，不做解码
+	RawQuery string // 请求行中"?"之后的原始查询参数，没有时为空
+	Body     []byte
+}
+
+// Sign 返回上报的签名，即 "sha256=" 加上以下内容的HMAC-SHA256的十六进制：
+// timestamp + "." + nonce + "." + METHOD + "\n" + path + "\n" + rawQuery + "\n" + body
+func Sign(secret, timestamp, nonce string, req SignedRequest) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write([]byte(nonce))
+	mac.Write([]byte("."))
+	mac.Write([]byte(strings.ToUpper(req.Method)))
+	mac.Write([]byte("\n"))
+	mac.Write([]byte(req.Path))
+	mac.Write([]byte("\n"))
+	mac.Write([]byte(req.RawQuery))
+	mac.Write([]byte("\n"))
+	mac.Write(req.Body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignatureVerifier 校验上报的HMAC签名并拒绝重放
+// 每个代理有独立的共享密钥，签名覆盖请求方法、路径、查询参数和请求体，签名有效的上报不能被改投到其他计数器或接口；时间戳与服务器时间相差超过max_skew的上报被拒绝，
+// 签名有效的上报记录其nonce直到时间戳超出允许的偏差，期间相同代理的相同nonce被视为重放。
+// 只有签名有效的上报才会记录nonce，未认证的请求无法占满nonce记录；记录已满时拒绝上报而不是放弃重放检查
+// nil表示未启用签名校验，所有方法都可以在nil上调用
+type SignatureVerifier struct {
+	agentHeader string
+	maxSkew     time.Duration
+	maxNonces   int
+	secrets     map[string][]byte
+
+	nonces   *counter.ShardedMap[int64] // 代理和nonce到过期时间（纳秒）
+	count    atomic.Int64
+	verified atomic.Int64
+	rejected atomic.Int64
+	replayed atomic.Int64
+
+	worker   *workers.Worker
+	stopChan chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewSignatureVerifier 创建上报签名校验并启动nonce清理协程，未启用时返回nil
+func NewSignatureVerifier(cfg config.SigningConfig) *SignatureVerifier {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	v := &SignatureVerifier{
+		agentHeader: cfg.AgentHeader,
+		maxSkew:     cfg.MaxSkew,
+		maxNonces:   cfg.MaxNonces,
+		secrets:     make(map[string][]byte, len(cfg.Agents)),
+		nonces:      counter.NewShardedMap[int64](0),
+		stopChan:    make(chan struct{}),
+	}
+	if v.agentHeader == "" {
+		v.agentHeader = defaultSigningAgentHeader
+	}
+	if v.maxSkew <= 0 {
+		v.maxSkew = defaultSigningMaxSkew
+	}
+	if v.maxNonces <= 0 {
+		v.maxNonces = defaultSigningMaxNonces
+	}
+	for _, a := range cfg.Agents {
+		v.secrets[a.Agent] = []byte(a.Secret)
+	}
+
+	v.worker = workers.Register("ingest.signing", v.maxSkew)
+	v.worker.Go(&v.wg, v.cleanupWorker)
+	return v
+}
+
+// AgentHeader 返回标识上报代理的请求头名称
+func (v *SignatureVerifier) AgentHeader() string {
+	if v == nil {
+		return ""
+	}
+	return v.agentHeader
+}
+
+// Verify 校验一次上报，未启用时总是返回nil
+func (v *SignatureVerifier) Verify(agent, timestamp, nonce, signature string, req SignedRequest) error {
+	return v.VerifyAt(agent, timestamp, nonce, signature, req, time.Now())
+}
+
+// VerifyAt 与Verify相同，使用给定的服务器时间
+func (v *SignatureVerifier) VerifyAt(agent, timestamp, nonce, signature string, req SignedRequest, now time.Time) error {
+	if v == nil {
+		return nil
+	}
+	err := v.verify(agent, timestamp, nonce, signature, req, now)
+	switch {
+	case err == nil:
+		v.verified.Add(1)
+	case errors.Is(err, ErrReplayedReport):
+		v.replayed.Add(1)
+	default:
+		v.rejected.Add(1)
+	}
+	return err
+}
+
+func (v *SignatureVerifier) verify(agent, timestamp, nonce, signature string, req SignedRequest, now time.Time) error {
+	if agent == "" || timestamp == "" || signature == "" || len(nonce) < minNonceLength || len(nonce) > maxNonceLength {
+		return ErrUnsignedReport
+	}
+	secret, ok := v.secrets[agent]
+	if !ok {
+		return ErrUnknownAgent
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrUnsignedReport
+	}
+	signedAt := time.Unix(seconds, 0)
+	if signedAt.Before(now.Add(-v.maxSkew)) || signedAt.After(now.Add(v.maxSkew)) {
+		return ErrStaleReport
+	}
+	expected := Sign(string(secret), timestamp, nonce, req)
+	if !hmac.Equal([]byte(strings.ToLower(signature)), []byte(expected)) {
+		return ErrBadSignature
+	}
+
+	// 时间戳超出允许的偏差之后，相同的nonce无法通过时间戳检查，记录可以删除
+	created := false
+	_, ok = v.nonces.LoadOrCreate(agent+"\n"+nonce, func() (int64, bool) {
+		if v.count.Add(1) > int64(v.maxNonces) {
+			v.count.Add(-1)
+			return 0, false
+		}
+		created = true
+		return signedAt.Add(v.maxSkew).UnixNano(), true
+	})
+	if !ok {
+		return ErrNonceCacheFull
+	}
+	if !created {
+		return ErrReplayedReport
+	}
+	return nil
+}
+
+// GetStats 获取签名校验的状态，不包含密钥
+func (v *SignatureVerifier) GetStats() map[string]interface{} {
+	if v == nil {
+		return map[string]interface{}{"enabled": false}
+	}
+	return map[string]interface{}{
+		"enabled":      true,
+		"agent_header": v.agentHeader,
+		"agents":       len(v.secrets),
+		"max_skew":     v.maxSkew.String(),
+		"nonces":       v.count.Load(),
+		"max_nonces":   v.maxNonces,
+		"verified":     v.verified.Load(),
+		"rejected":     v.rejected.Load(),
+		"replayed":     v.replayed.Load(),
+	}
+}
+
+// cleanupWorker 每隔max_skew清理一次已过期的nonce
+func (v *SignatureVerifier) cleanupWorker() {
+	ticker := time.NewTicker(v.maxSkew)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			v.Cleanup(now)
+			v.worker.Ran()
+		case <-v.stopChan:
+			return
+		}
+	}
+}
+
+// Cleanup 删除在now之前过期的nonce
+func (v *SignatureVerifier) Cleanup(now time.Time) {
+	if v == nil {
+		return
+	}
+
+	cutoff := now.UnixNano()
+	// Range期间持有分片的读锁，先收集再删除
+	var expired []string
+	v.nonces.Range(func(key string, expiresAt int64) bool {
+		if expiresAt < cutoff {
+			expired = append(expired, key)
+		}
+		return true
+	})
+	for _, key := range expired {
+		v.nonces.Delete(key)
+		v.count.Add(-1)
+	}
+}
+
+// Stop 停止清理协程
+func (v *SignatureVerifier) Stop() {
+	if v == nil {
+		return
+	}
+	v.stopOnce.Do(func() {
+		close(v.stopChan)
+	})
+	v.wg.Wait()
+}
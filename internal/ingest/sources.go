@@ -0,0 +1,155 @@
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// maxDatagramSize UDP数据报的最大长度
+const maxDatagramSize = 64 * 1024
+
+// tailPollInterval 日志文件没有新内容时重新检查的间隔
+const tailPollInterval = 250 * time.Millisecond
+
+// udpSource 监听UDP端口，每个数据报按换行拆分为多行
+type udpSource struct {
+	conn net.PacketConn
+}
+
+func newUDPSource(address string) (*udpSource, error) {
+	conn, err := net.ListenPacket("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	return &udpSource{conn: conn}, nil
+}
+
+// Addr 返回实际监听的地址，配置的端口为0时用于获取分配的端口
+func (s *udpSource) Addr() net.Addr {
+	return s.conn.LocalAddr()
+}
+
+// Run 读取数据报直到连接被关闭
+func (s *udpSource) Run(emit func(line []byte)) error {
+	buf := make([]byte, maxDatagramSize)
+	for {
+		n, _, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		for _, line := range bytes.Split(buf[:n], []byte{'\n'}) {
+			emit(line)
+		}
+	}
+}
+
+// Close 关闭连接，Run随之返回
+func (s *udpSource) Close() error {
+	return s.conn.Close()
+}
+
+// tailSource 跟踪日志文件新增的行，启动时从文件末尾开始读取
+// 文件被截断时从头读取，被轮转（路径指向了新文件）时读完旧文件后从头读取新文件；文件尚不存在时等待其创建
+type tailSource struct {
+	path     string
+	stopChan chan struct{}
+	stopOnce sync.Once
+}
+
+func newTailSource(path string) *tailSource {
+	return &tailSource{path: path, stopChan: make(chan struct{})}
+}
+
+// Run 轮询读取文件新增的完整行，直到Close被调用
+func (s *tailSource) Run(emit func(line []byte)) error {
+	file, err := os.Open(s.path)
+	switch {
+	case err == nil:
+		// 只读取启动之后写入的行
+		if _, err := file.Seek(0, io.SeekEnd); err != nil {
+			file.Close()
+			return err
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return err
+	}
+	defer func() {
+		if file != nil {
+			file.Close()
+		}
+	}()
+
+	var (
+		reader  *bufio.Reader
+		pending []byte // 尚未读到换行的部分
+	)
+	if file != nil {
+		reader = bufio.NewReader(file)
+	}
+	// drain 读取当前文件中所有完整的行
+	drain := func() error {
+		for reader != nil {
+			chunk, err := reader.ReadBytes('\n')
+			pending = append(pending, chunk...)
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			emit(pending)
+			pending = pending[:0]
+		}
+		return nil
+	}
+
+	ticker := time.NewTicker(tailPollInterval)
+	defer ticker.Stop()
+	for {
+		if err := drain(); err != nil {
+			return err
+		}
+		select {
+		case <-s.stopChan:
+			return nil
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(s.path)
+		if err != nil {
+			continue
+		}
+		if file != nil {
+			if current, err := file.Stat(); err == nil && os.SameFile(info, current) {
+				// 读到的位置超过文件长度说明文件被截断
+				offset, err := file.Seek(0, io.SeekCurrent)
+				if err != nil || info.Size() >= offset {
+					continue
+				}
+			} else if err := drain(); err != nil { // 文件被轮转，读完旧文件中剩余的行
+				return err
+			}
+			file.Close()
+		}
+		if file, err = os.Open(s.path); err != nil {
+			file, reader = nil, nil
+			continue
+		}
+		reader, pending = bufio.NewReader(file), pending[:0]
+	}
+}
+
+// Close 停止读取，Run随之返回
+func (s *tailSource) Close() error {
+	s.stopOnce.Do(func() { close(s.stopChan) })
+	return nil
+}
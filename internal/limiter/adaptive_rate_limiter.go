@@ -7,37 +7,52 @@ import (
 	"time"
 
 	"github.com/mant7s/qps-counter/internal/logger"
+	"github.com/mant7s/qps-counter/internal/pressure"
+	"github.com/mant7s/qps-counter/internal/workers"
 	"go.uber.org/zap"
 	"golang.org/x/time/rate"
 )
 
+// adaptiveInterval 检查系统资源并调整限流参数的间隔
+const adaptiveInterval = 5 * time.Second
+
 // AdaptiveRateLimiter 提供基于系统资源的自适应限流功能
+// 除Go堆内存外还参考Linux PSI压力数据，在容器内反映的是容器自身受到的CPU、内存和IO压力
 type AdaptiveRateLimiter struct {
-	limiter       *rate.Limiter
-	baseRate      float64       // 基础限流速率
-	cpuThreshold  float64       // CPU使用率阈值
-	memThreshold  uint64        // 内存使用阈值
-	adjustFactor  float64       // 调整系数
-	enabled       atomic.Bool   // 是否启用限流
-	mu            sync.RWMutex  // 保护并发访问
-	stopChan      chan struct{} // 停止信号
-	rejectedCount atomic.Int64  // 被拒绝的请求计数
-	totalCount    atomic.Int64  // 总请求计数
+	limiter           *rate.Limiter
+	baseRate          float64       // 基础限流速率
+	cpuThreshold      float64       // CPU使用率阈值
+	memThreshold      uint64        // 内存使用阈值
+	pressureThreshold float64       // PSI压力阈值（最近10秒的等待时间百分比）
+	adjustFactor      float64       // 调整系数
+	enabled           atomic.Bool   // 是否启用限流
+	mu                sync.RWMutex  // 保护并发访问
+	stopChan          chan struct{} // 停止信号
+	rejectedCount     atomic.Int64  // 被拒绝的请求计数
+	totalCount        atomic.Int64  // 总请求计数
+
+	readPressure func() pressure.Snapshot // 读取压力数据
+	lastPressure pressure.Snapshot        // 最近一次读取的压力数据，由mu保护
+
+	worker *workers.Worker
 }
 
 // NewAdaptiveRateLimiter 创建一个新的自适应限流器
 func NewAdaptiveRateLimiter(baseRate float64, burst int) *AdaptiveRateLimiter {
 	arl := &AdaptiveRateLimiter{
-		limiter:      rate.NewLimiter(rate.Limit(baseRate), burst),
-		baseRate:     baseRate,
-		cpuThreshold: 70.0,    // CPU使用率超过70%开始限流
-		memThreshold: 1 << 30, // 内存阈值1GB
-		adjustFactor: 0.8,     // 调整因子
-		stopChan:     make(chan struct{}),
+		limiter:           rate.NewLimiter(rate.Limit(baseRate), burst),
+		baseRate:          baseRate,
+		cpuThreshold:      70.0,    // CPU使用率超过70%开始限流
+		memThreshold:      1 << 30, // 内存阈值1GB
+		pressureThreshold: pressure.DefaultThreshold,
+		adjustFactor:      0.8, // 调整因子
+		stopChan:          make(chan struct{}),
+		readPressure:      pressure.Read,
 	}
 
 	arl.enabled.Store(true)
-	go arl.adaptiveWorker()
+	arl.worker = workers.Register("limiter.adaptive", adaptiveInterval)
+	arl.worker.Go(nil, arl.adaptiveWorker)
 	return arl
 }
 
@@ -64,13 +79,14 @@ func (arl *AdaptiveRateLimiter) Allow() bool {
 
 // adaptiveWorker 周期性检查系统资源并调整限流参数
 func (arl *AdaptiveRateLimiter) adaptiveWorker() {
-	ticker := time.NewTicker(5 * time.Second)
+	ticker := time.NewTicker(adaptiveInterval)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
 			arl.adjustRate()
+			arl.worker.Ran()
 		case <-arl.stopChan:
 			return
 		}
@@ -78,42 +94,87 @@ func (arl *AdaptiveRateLimiter) adaptiveWorker() {
 }
 
 // adjustRate 根据系统资源使用情况调整限流速率
+// 堆内存超过阈值和每种压力超过阈值的资源各使速率乘以一次调整系数
 func (arl *AdaptiveRateLimiter) adjustRate() {
 	// 获取系统资源使用情况
 	var memStats runtime.MemStats
 	runtime.ReadMemStats(&memStats)
 
+	arl.mu.RLock()
+	readPressure, threshold := arl.readPressure, arl.pressureThreshold
+	arl.mu.RUnlock()
+	snapshot := readPressure()
+	stalled := snapshot.Stalled(threshold)
+
 	// 计算调整系数
 	adjustment := 1.0
 	if memStats.Alloc > arl.memThreshold {
 		// 当内存使用超过阈值时，降低限流速率
 		adjustment *= arl.adjustFactor
 	}
+	for range stalled {
+		// 进程因CPU、内存或IO等待的时间过多时，降低限流速率
+		adjustment *= arl.adjustFactor
+	}
 
 	// 应用新的限流速率
 	newRate := arl.baseRate * adjustment
 	arl.mu.Lock()
 	arl.limiter.SetLimit(rate.Limit(newRate))
+	arl.lastPressure = snapshot
 	arl.mu.Unlock()
 
 	logger.Info("限流器参数已调整",
 		zap.Float64("new_rate", newRate),
 		zap.Uint64("memory_usage", memStats.Alloc),
+		zap.Strings("stalled", stalled),
 	)
 }
 
+// SetPressureReader 替换压力数据的来源，用于测试或使用其他来源的压力数据
+func (arl *AdaptiveRateLimiter) SetPressureReader(read func() pressure.Snapshot) {
+	arl.mu.Lock()
+	defer arl.mu.Unlock()
+	arl.readPressure = read
+}
+
+// SetPressureThreshold 设置PSI压力阈值，单位为最近10秒的等待时间百分比
+func (arl *AdaptiveRateLimiter) SetPressureThreshold(threshold float64) {
+	if threshold > 0 {
+		arl.mu.Lock()
+		arl.pressureThreshold = threshold
+		arl.mu.Unlock()
+	}
+}
+
 // Stop 停止自适应限流器
 func (arl *AdaptiveRateLimiter) Stop() {
 	close(arl.stopChan)
 }
 
-// GetStats 获取限流器统计信息
-func (arl *AdaptiveRateLimiter) GetStats() map[string]interface{} {
-	return map[string]interface{}{
-		"base_rate":      arl.baseRate,
-		"current_limit":  float64(arl.limiter.Limit()),
-		"enabled":        arl.enabled.Load(),
-		"rejected_count": arl.rejectedCount.Load(),
-		"total_count":    arl.totalCount.Load(),
+// AdaptiveStats 自适应限流器的状态
+type AdaptiveStats struct {
+	BaseRate          float64           `json:"base_rate"`
+	CurrentLimit      float64           `json:"current_limit"` // 按系统负载调整后的速率
+	Enabled           bool              `json:"enabled"`
+	RejectedCount     int64             `json:"rejected_count"`
+	TotalCount        int64             `json:"total_count"`
+	Pressure          pressure.Snapshot `json:"pressure"`
+	PressureThreshold float64           `json:"pressure_threshold"`
+}
+
+// Stats 获取限流器统计信息
+func (arl *AdaptiveRateLimiter) Stats() AdaptiveStats {
+	arl.mu.RLock()
+	defer arl.mu.RUnlock()
+
+	return AdaptiveStats{
+		BaseRate:          arl.baseRate,
+		CurrentLimit:      float64(arl.limiter.Limit()),
+		Enabled:           arl.enabled.Load(),
+		RejectedCount:     arl.rejectedCount.Load(),
+		TotalCount:        arl.totalCount.Load(),
+		Pressure:          arl.lastPressure,
+		PressureThreshold: arl.pressureThreshold,
 	}
 }
@@ -0,0 +1,143 @@
+package limiter
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/logger"
+	"github.com/mant7s/qps-counter/internal/workers"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultAutoEnableAfter  = 10 * time.Second
+	defaultAutoDisableAfter = 5 * time.Minute
+	autoToggleInterval      = time.Second // 采样QPS的间隔
+)
+
+// AutoToggleStats 自动启停的状态
+type AutoToggleStats struct {
+	Threshold    int64  `json:"threshold"`
+	EnableAfter  string `json:"enable_after"`
+	DisableAfter string `json:"disable_after"`
+	Above        bool   `json:"above"`   // 最近一次采样的QPS是否超过阈值
+	Since        string `json:"since"`   // 当前状态（超过或低于阈值）持续的时间
+	Toggles      int64  `json:"toggles"` // 自动启停的次数
+}
+
+// AutoToggle 按全局QPS自动启停限流器
+// QPS持续enable_after超过阈值时启用，持续disable_after不超过阈值时停用，低流量时不承担限流的开销和误配置的风险
+// 仅在持续状态发生变化时修改限流器，期间通过管理接口手动切换的状态会保留到下一次切换
+type AutoToggle struct {
+	limiter      *RateLimiter
+	qps          func() int64
+	threshold    int64
+	enableAfter  time.Duration
+	disableAfter time.Duration
+	clock        Clock
+
+	mu      sync.Mutex
+	above   bool      // 最近一次采样的QPS是否超过阈值
+	since   time.Time // above开始的时间
+	want    bool      // 最近一次自动切换的状态
+	toggles int64
+
+	worker   *workers.Worker
+	stopChan chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewAutoToggle 创建限流器自动启停控制器并启动采样协程，qps返回全局计数器的当前QPS
+// 启动时视为低于阈值，限流器保持配置的启用状态直到满足切换条件
+func NewAutoToggle(rl *RateLimiter, cfg config.LimiterAutoConfig, qps func() int64, clock Clock) *AutoToggle {
+	a := &AutoToggle{
+		limiter:      rl,
+		qps:          qps,
+		threshold:    cfg.Threshold,
+		enableAfter:  cfg.EnableAfter,
+		disableAfter: cfg.DisableAfter,
+		clock:        clock,
+		since:        clock.Now(),
+		want:         rl.Enabled(),
+		stopChan:     make(chan struct{}),
+	}
+	if a.enableAfter <= 0 {
+		a.enableAfter = defaultAutoEnableAfter
+	}
+	if a.disableAfter <= 0 {
+		a.disableAfter = defaultAutoDisableAfter
+	}
+	rl.auto.Store(a)
+
+	a.worker = workers.Register("limiter.auto", autoToggleInterval)
+	a.worker.Go(&a.wg, a.run)
+	return a
+}
+
+// Update 按指定时间采样一次QPS，满足持续时间时启停限流器，返回自动切换的状态
+func (a *AutoToggle) Update(now time.Time) bool {
+	above := a.qps() > a.threshold
+
+	a.mu.Lock()
+	if above != a.above {
+		a.above, a.since = above, now
+	}
+	elapsed := now.Sub(a.since)
+	changed := (above && !a.want && elapsed >= a.enableAfter) || (!above && a.want && elapsed >= a.disableAfter)
+	if changed {
+		a.want = above
+		a.toggles++
+	}
+	want := a.want
+	a.mu.Unlock()
+
+	// 在锁外修改限流器，限流器的Stats会读取自动启停的状态
+	if changed {
+		logger.Info("QPS持续越过阈值，自动切换限流器",
+			zap.Bool("enabled", want),
+			zap.Int64("threshold", a.threshold),
+			zap.Duration("duration", elapsed))
+		a.limiter.SetEnabled(want)
+	}
+	return want
+}
+
+// Stats 获取自动启停的状态
+func (a *AutoToggle) Stats() AutoToggleStats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return AutoToggleStats{
+		Threshold:    a.threshold,
+		EnableAfter:  a.enableAfter.String(),
+		DisableAfter: a.disableAfter.String(),
+		Above:        a.above,
+		Since:        a.clock.Now().Sub(a.since).Truncate(time.Second).String(),
+		Toggles:      a.toggles,
+	}
+}
+
+// run 每秒采样一次QPS
+func (a *AutoToggle) run() {
+	ticker := time.NewTicker(autoToggleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			a.Update(a.clock.Now())
+			a.worker.Ran()
+		case <-a.stopChan:
+			return
+		}
+	}
+}
+
+// Stop 停止采样协程，限流器保持当前的启用状态
+func (a *AutoToggle) Stop() {
+	a.stopOnce.Do(func() {
+		close(a.stopChan)
+	})
+	a.wg.Wait()
+	a.limiter.auto.CompareAndSwap(a, nil)
+}
@@ -0,0 +1,17 @@
+package limiter
+
+import "time"
+
+// Clock 限流器使用的时间源，便于在测试中模拟时钟跳变
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock 系统时钟
+// time.Now 返回的时间携带单调时钟读数，两次读数相减不受NTP步进等墙上时钟调整的影响
+type SystemClock struct{}
+
+// Now 返回当前时间
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
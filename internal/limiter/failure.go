@@ -0,0 +1,156 @@
+package limiter
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/mant7s/qps-counter/internal/logger"
+	"go.uber.org/zap"
+)
+
+// 限流器自身出错时的处理策略
+const (
+	FailOpen   = "open"   // 放行请求，用于 /collect 等丢失计数代价更高的路由
+	FailClosed = "closed" // 拒绝请求，用于开销较大的管理操作
+)
+
+// DefaultFailureRoute 未匹配任何路由前缀时在统计和指标中使用的路由名
+const DefaultFailureRoute = "default"
+
+// ErrUnavailable 限流器无法给出结果，如后端超时或内部错误
+var ErrUnavailable = errors.New("限流器不可用")
+
+// defaultFailureRoutes 未在配置中指定时使用的路由策略
+var defaultFailureRoutes = map[string]string{
+	"/admin/": FailClosed,
+}
+
+// failureRoute 一个路由前缀的失败策略及其失败次数
+type failureRoute struct {
+	prefix   string
+	policy   string
+	failures atomic.Int64
+}
+
+// FailurePolicy 按路由决定限流器出错时放行还是拒绝请求
+// 路由按路径前缀匹配，最长前缀优先，nil表示所有路由都放行
+type FailurePolicy struct {
+	routes   []*failureRoute // 按前缀长度从长到短排序
+	fallback *failureRoute
+}
+
+// NewFailurePolicy 创建失败策略，defaultPolicy为空时使用open
+// routes中未出现的内置路由（/admin/为closed）同样生效
+func NewFailurePolicy(defaultPolicy string, routes map[string]string) *FailurePolicy {
+	if defaultPolicy != FailClosed {
+		defaultPolicy = FailOpen
+	}
+
+	merged := make(map[string]string, len(defaultFailureRoutes)+len(routes))
+	for prefix, policy := range defaultFailureRoutes {
+		merged[prefix] = policy
+	}
+	for prefix, policy := range routes {
+		merged[prefix] = policy
+	}
+
+	p := &FailurePolicy{fallback: &failureRoute{prefix: DefaultFailureRoute, policy: defaultPolicy}}
+	for prefix, policy := range merged {
+		if policy != FailClosed {
+			policy = FailOpen
+		}
+		p.routes = append(p.routes, &failureRoute{prefix: prefix, policy: policy})
+	}
+	sort.Slice(p.routes, func(i, j int) bool {
+		if len(p.routes[i].prefix) != len(p.routes[j].prefix) {
+			return len(p.routes[i].prefix) > len(p.routes[j].prefix)
+		}
+		return p.routes[i].prefix < p.routes[j].prefix
+	})
+	return p
+}
+
+func (p *FailurePolicy) match(path string) *failureRoute {
+	for _, route := range p.routes {
+		if strings.HasPrefix(path, route.prefix) {
+			return route
+		}
+	}
+	return p.fallback
+}
+
+// For 返回路径适用的失败策略
+func (p *FailurePolicy) For(path string) string {
+	if p == nil {
+		return FailOpen
+	}
+	return p.match(path).policy
+}
+
+// Decide 执行限流检查，检查返回错误或panic时按路径的失败策略决定是否放行
+// 返回的错误为限流器自身的错误，仅用于记录，调用方不需要再处理
+func (p *FailurePolicy) Decide(path string, check func() (bool, error)) (allowed bool, err error) {
+	allowed, err = safeCheck(check)
+	if err == nil {
+		return allowed, nil
+	}
+
+	policy := FailOpen
+	if p != nil {
+		route := p.match(path)
+		route.failures.Add(1)
+		policy = route.policy
+	}
+	logger.Warn("限流器出错，按失败策略处理",
+		zap.String("path", path),
+		zap.String("policy", policy),
+		zap.Error(err))
+	return policy == FailOpen, err
+}
+
+// safeCheck 将限流检查中的panic转换为错误
+func safeCheck(check func() (bool, error)) (allowed bool, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			allowed, err = false, fmt.Errorf("%w: %v", ErrUnavailable, r)
+		}
+	}()
+	return check()
+}
+
+// RoutePolicy 一个路由的失败策略及其累计失败次数
+type RoutePolicy struct {
+	Route    string
+	Policy   string
+	Failures int64
+}
+
+// Policies 返回所有路由的失败策略，未匹配任何前缀的请求计入default
+func (p *FailurePolicy) Policies() []RoutePolicy {
+	if p == nil {
+		return nil
+	}
+	result := make([]RoutePolicy, 0, len(p.routes)+1)
+	for _, route := range p.routes {
+		result = append(result, RoutePolicy{Route: route.prefix, Policy: route.policy, Failures: route.failures.Load()})
+	}
+	return append(result, RoutePolicy{Route: p.fallback.prefix, Policy: p.fallback.policy, Failures: p.fallback.failures.Load()})
+}
+
+// GetStats 获取各路由的失败策略和限流器出错的次数
+func (p *FailurePolicy) GetStats() map[string]interface{} {
+	policies := p.Policies()
+	routes := make(map[string]string, len(policies))
+	failures := make(map[string]int64, len(policies))
+	for _, route := range policies {
+		routes[route.Route] = route.Policy
+		failures[route.Route] = route.Failures
+	}
+	return map[string]interface{}{
+		"routes":   routes,
+		"failures": failures,
+	}
+}
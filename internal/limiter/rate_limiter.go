@@ -1,113 +1,348 @@
 package limiter
 
 import (
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/mant7s/qps-counter/internal/logger"
 	"go.uber.org/zap"
 )
 
+// 限流单位
+const (
+	UnitRequests = "requests" // 按请求数限流，每个请求消耗一个令牌
+	UnitBytes    = "bytes"    // 按字节数限流，每个请求消耗与其大小相同的令牌
+)
+
+// 请求声明的令牌消耗的默认值和上限
+const (
+	DefaultCost    = 1
+	DefaultMaxCost = 100
+)
+
+// ErrInvalidCost 请求声明的令牌消耗无效或超过上限
+var ErrInvalidCost = errors.New("无效的cost")
+
 // RateLimiter 提供基于令牌桶算法的限流功能
 type RateLimiter struct {
-	rate         int64         // 每秒允许的请求数
-	burstSize    int64         // 突发请求容量
-	tokens       int64         // 当前可用令牌数
-	lastRefill   time.Time     // 上次填充令牌的时间
-	enabled      bool          // 是否启用限流
-	mu           sync.Mutex    // 保护并发访问
-	adaptive     bool          // 是否启用自适应限流
-	rejectedCount int64        // 被拒绝的请求计数
-	totalCount    int64        // 总请求计数
+	rate          int64                      // 每秒允许的请求数（bytes单位时为字节数）
+	burstSize     int64                      // 突发请求容量
+	bucket                                   // 全局令牌桶的令牌数和补充进度
+	enabled       atomic.Bool                // 是否启用限流，禁用时请求路径不加锁
+	mu            sync.Mutex                 // 保护并发访问
+	adaptive      bool                       // 是否启用自适应限流
+	rejectedCount int64                      // 被拒绝的请求计数
+	totalCount    int64                      // 总请求计数
+	clock         Clock                      // 时间源
+	unit          string                     // 限流单位
+	profile       string                     // 当前生效的限流时间段
+	defaultCost   int64                      // 请求未声明cost时消耗的令牌数
+	maxCost       int64                      // 单个请求允许声明的最大cost
+	rules         []*rule                    // 按顺序匹配的限流规则，未匹配任何规则时使用全局令牌桶
+	keyHeader     string                     // 携带API Key的请求头
+	tenantHeader  string                     // 携带租户标识的请求头
+	notify        func(bool)                 // 启用状态变化时调用，可以为nil
+	script        atomic.Pointer[Script]     // 每个请求执行的限流脚本，可以为nil
+	auto          atomic.Pointer[AutoToggle] // 按QPS自动启停限流器的控制器，可以为nil
 }
 
 // NewRateLimiter 创建一个新的限流器
 func NewRateLimiter(rate, burstSize int64, adaptive bool) *RateLimiter {
-	return &RateLimiter{
-		rate:       rate,
-		burstSize:  burstSize,
-		tokens:     burstSize, // 初始填满令牌
-		lastRefill: time.Now(),
-		enabled:    true,
-		adaptive:   adaptive,
+	return NewRateLimiterWithClock(rate, burstSize, adaptive, SystemClock{})
+}
+
+// NewRateLimiterWithClock 使用指定的时间源创建限流器
+func NewRateLimiterWithClock(rate, burstSize int64, adaptive bool, clock Clock) *RateLimiter {
+	rl := &RateLimiter{
+		rate:         rate,
+		burstSize:    burstSize,
+		bucket:       bucket{tokens: burstSize, lastRefill: clock.Now()}, // 初始填满令牌
+		adaptive:     adaptive,
+		clock:        clock,
+		unit:         UnitRequests,
+		profile:      DefaultProfile,
+		defaultCost:  DefaultCost,
+		maxCost:      DefaultMaxCost,
+		keyHeader:    DefaultKeyHeader,
+		tenantHeader: DefaultTenantHeader,
 	}
+	rl.enabled.Store(true)
+	return rl
 }
 
 // Allow 检查是否允许当前请求通过
 func (rl *RateLimiter) Allow() bool {
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
+	return rl.AllowN(1)
+}
 
-	if !rl.enabled {
+// AllowN 检查是否允许消耗n个令牌，如一个大小为n字节的请求
+// n<=0时按1处理；n超过突发容量的请求永远无法通过；限流器禁用时直接放行，不计入统计
+func (rl *RateLimiter) AllowN(n int64) bool {
+	if !rl.enabled.Load() {
 		return true
 	}
+	if n <= 0 {
+		n = 1
+	}
 
-	rl.totalCount++
-
-	// 计算从上次填充到现在应该添加的令牌数
-	now := time.Now()
-	elapsed := now.Sub(rl.lastRefill).Seconds()
-	newTokens := int64(elapsed * float64(rl.rate))
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
 
-	if newTokens > 0 {
-		rl.tokens += newTokens
-		if rl.tokens > rl.burstSize {
-			rl.tokens = rl.burstSize
-		}
-		rl.lastRefill = now
-	}
+	rl.totalCount++
+	rl.settle()
 
-	// 如果有可用令牌，则允许请求通过
-	if rl.tokens > 0 {
-		rl.tokens--
+	// 如果有足够的令牌，则允许请求通过
+	if rl.tokens >= n {
+		rl.tokens -= n
 		return true
 	}
 
-	// 记录被拒绝的请求
+	rl.reject()
+	return false
+}
+
+// reject 记录被拒绝的请求，调用方持有锁
+func (rl *RateLimiter) reject() {
 	rl.rejectedCount++
 	if rl.rejectedCount%100 == 0 { // 每100次拒绝记录一次日志，避免日志过多
-		logger.Warn("请求被限流器拒绝", 
+		logger.Warn("请求被限流器拒绝",
 			zap.Int64("rejected_count", rl.rejectedCount),
 			zap.Int64("total_count", rl.totalCount),
 			zap.Float64("reject_rate", float64(rl.rejectedCount)/float64(rl.totalCount)),
 		)
 	}
+}
 
-	return false
+// settle 按当前速率补充到现在的令牌，在调整速率前调用，避免上次补充之后的时间按新的速率计算
+// 调用方持有锁
+func (rl *RateLimiter) settle() {
+	rl.refill(rl.burstSize, rl.rate, rl.clock.Now())
 }
 
-// SetRate 动态调整限流速率
+// bucket 令牌桶的令牌数和补充进度，全局令牌桶和规则的令牌桶共用
+type bucket struct {
+	tokens     int64     // 当前可用令牌数
+	fraction   uint64    // 不足一个令牌的部分，单位为令牌数乘以纳秒/秒，取值 [0, 1e9)
+	lastRefill time.Time // 上次填充令牌的时间
+}
+
+// refill 按速率补充从上次补充到now的令牌
+// 按纳秒整数计算并保留不足一个令牌的部分，低速率（如每秒2个）且请求间隔较短时每次补充的令牌都不足一个，
+// 丢弃小数部分会使实际放行的速率明显低于配置值；调整速率后已累积的部分仍然有效。
+// 时钟回拨时以当前时间为新的基准，避免在时钟追上之前无法补充令牌；
+// 时钟向前跳变时补充的令牌数最多为突发容量，不会超出配置的上限
+func (b *bucket) refill(burst, rate int64, now time.Time) {
+	elapsed := now.Sub(b.lastRefill)
+	b.lastRefill = now
+	if elapsed <= 0 || rate <= 0 {
+		return
+	}
+
+	// elapsed×rate + fraction 可能超出64位，使用128位的乘法和除法
+	hi, lo := bits.Mul64(uint64(elapsed), uint64(rate))
+	lo, carry := bits.Add64(lo, b.fraction, 0)
+	hi += carry
+	if hi >= uint64(time.Second) {
+		// 补充的令牌数超出64位，必然填满令牌桶
+		b.tokens, b.fraction = burst, 0
+		return
+	}
+	newTokens, fraction := bits.Div64(hi, lo, uint64(time.Second))
+	if newTokens == 0 {
+		b.fraction = fraction
+		return
+	}
+	if newTokens >= uint64(math.MaxInt64) || int64(newTokens) >= burst-b.tokens {
+		b.tokens, b.fraction = burst, 0
+		return
+	}
+	b.tokens += int64(newTokens)
+	b.fraction = fraction
+}
+
+// Err 返回限流器当前是否不可用，进程内的令牌桶总是可用
+// 远程后端等其他实现（见api.Allower）在无法给出结果时返回错误，由路由的FailurePolicy决定是否放行
+func (rl *RateLimiter) Err() error {
+	return nil
+}
+
+// SetRate 动态调整限流速率，当前的令牌数保持不变
 func (rl *RateLimiter) SetRate(newRate int64) {
 	rl.mu.Lock()
 	defer rl.mu.Unlock()
 
+	rl.settle()
 	rl.rate = newRate
 	logger.Info("限流器速率已调整", zap.Int64("new_rate", newRate))
 }
 
+// Rate 返回当前的限流速率
+func (rl *RateLimiter) Rate() int64 {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	return rl.rate
+}
+
+// Counts 返回被拒绝的请求数和请求总数
+func (rl *RateLimiter) Counts() (rejected, total int64) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	return rl.rejectedCount, rl.totalCount
+}
+
+// SetProfile 切换到指定时间段的限流速率和突发容量
+// 当前令牌数超过新的突发容量时截断，避免切换到较低的配置后仍放行大量突发请求
+func (rl *RateLimiter) SetProfile(name string, rate, burstSize int64) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.settle()
+	rl.profile = name
+	rl.rate = rate
+	rl.burstSize = burstSize
+	if rl.tokens > burstSize {
+		rl.tokens = burstSize
+	}
+	logger.Info("限流时间段已切换",
+		zap.String("profile", name),
+		zap.Int64("rate", rate),
+		zap.Int64("burst", burstSize))
+}
+
+// Profile 返回当前生效的限流时间段
+func (rl *RateLimiter) Profile() string {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	return rl.profile
+}
+
+// SetUnit 设置限流单位，不支持的单位按requests处理
+func (rl *RateLimiter) SetUnit(unit string) {
+	if unit != UnitBytes {
+		unit = UnitRequests
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.unit = unit
+}
+
+// SetCostLimits 设置请求未声明cost时的默认消耗和允许声明的最大cost，为0的参数保持不变
+func (rl *RateLimiter) SetCostLimits(defaultCost, maxCost int64) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if defaultCost > 0 {
+		rl.defaultCost = defaultCost
+	}
+	if maxCost > 0 {
+		rl.maxCost = maxCost
+	}
+}
+
+// Cost 返回请求应消耗的令牌数，declared为0表示未声明，使用默认消耗
+// 声明的cost为负数或超过上限时返回ErrInvalidCost
+func (rl *RateLimiter) Cost(declared int64) (int64, error) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	switch {
+	case declared == 0:
+		return rl.defaultCost, nil
+	case declared < 0:
+		return 0, fmt.Errorf("%w: 必须大于0", ErrInvalidCost)
+	case declared > rl.maxCost:
+		return 0, fmt.Errorf("%w: 不能超过%d", ErrInvalidCost, rl.maxCost)
+	}
+	return declared, nil
+}
+
+// Unit 返回限流单位
+func (rl *RateLimiter) Unit() string {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	return rl.unit
+}
+
 // SetEnabled 启用或禁用限流器
 func (rl *RateLimiter) SetEnabled(enabled bool) {
+	changed := rl.enabled.Swap(enabled) != enabled
+	logger.Info("限流器状态已更改", zap.Bool("enabled", enabled))
+	if !changed {
+		return
+	}
+
+	rl.mu.Lock()
+	notify := rl.notify
+	rl.mu.Unlock()
+	if notify != nil {
+		notify(enabled)
+	}
+}
+
+// SetNotify 设置启用状态变化时调用的函数，参数为变化后的状态；重复设置为相同的状态时不调用
+func (rl *RateLimiter) SetNotify(fn func(enabled bool)) {
 	rl.mu.Lock()
 	defer rl.mu.Unlock()
+	rl.notify = fn
+}
 
-	rl.enabled = enabled
-	logger.Info("限流器状态已更改", zap.Bool("enabled", enabled))
+// Enabled 返回限流器是否启用
+func (rl *RateLimiter) Enabled() bool {
+	return rl.enabled.Load()
 }
 
-// GetStats 获取限流器统计信息
-func (rl *RateLimiter) GetStats() map[string]interface{} {
+// Stats 限流器的状态，/stats、/stats/v2、Prometheus指标和qpsctl共用同一个结构
+type Stats struct {
+	Rate          int64            `json:"rate"`
+	BurstSize     int64            `json:"burst_size"`
+	CurrentTokens int64            `json:"current_tokens"` // 全局令牌桶当前的令牌数
+	Enabled       bool             `json:"enabled"`
+	Unit          string           `json:"unit"`
+	Profile       string           `json:"profile"`
+	DefaultCost   int64            `json:"default_cost"`
+	MaxCost       int64            `json:"max_cost"`
+	Rules         int              `json:"rules"` // 限流规则的数量
+	RejectedCount int64            `json:"rejected_count"`
+	TotalCount    int64            `json:"total_count"`
+	RejectRate    float64          `json:"reject_rate"`
+	Script        *ScriptStats     `json:"script,omitempty"` // 未设置限流脚本时为nil
+	Auto          *AutoToggleStats `json:"auto,omitempty"`   // 未启用自动启停时为nil
+}
+
+// Stats 获取限流器统计信息
+func (rl *RateLimiter) Stats() Stats {
 	rl.mu.Lock()
 	defer rl.mu.Unlock()
 
-	return map[string]interface{}{
-		"rate":          rl.rate,
-		"burst_size":    rl.burstSize,
-		"current_tokens": rl.tokens,
-		"enabled":       rl.enabled,
-		"rejected_count": rl.rejectedCount,
-		"total_count":   rl.totalCount,
-		"reject_rate":   float64(rl.rejectedCount) / float64(max(rl.totalCount, 1)),
+	stats := Stats{
+		Rate:          rl.rate,
+		BurstSize:     rl.burstSize,
+		CurrentTokens: rl.tokens,
+		Enabled:       rl.enabled.Load(),
+		Unit:          rl.unit,
+		Profile:       rl.profile,
+		DefaultCost:   rl.defaultCost,
+		MaxCost:       rl.maxCost,
+		Rules:         len(rl.rules),
+		RejectedCount: rl.rejectedCount,
+		TotalCount:    rl.totalCount,
+		RejectRate:    float64(rl.rejectedCount) / float64(max(rl.totalCount, 1)),
+	}
+	if script := rl.script.Load(); script != nil {
+		scriptStats := script.Stats()
+		stats.Script = &scriptStats
+	}
+	if auto := rl.auto.Load(); auto != nil {
+		autoStats := auto.Stats()
+		stats.Auto = &autoStats
 	}
+	return stats
 }
 
 // 辅助函数，返回两个int64中的较大值
@@ -122,6 +357,6 @@ func max(a, b int64) int64 {
 func (rl *RateLimiter) SetTokensForTest(tokens int64) {
 	rl.mu.Lock()
 	defer rl.mu.Unlock()
-	
+
 	rl.tokens = tokens
-}
\ No newline at end of file
+}
@@ -0,0 +1,453 @@
+package limiter
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/logger"
+	"go.uber.org/zap"
+)
+
+// DefaultRule 未匹配任何规则时使用的全局令牌桶的规则名
+const DefaultRule = "default"
+
+// 识别调用方的默认请求头
+const (
+	DefaultKeyHeader    = "X-API-Key"
+	DefaultTenantHeader = "X-Tenant-ID"
+)
+
+// 规则的限流算法
+const (
+	AlgorithmTokenBucket = "token_bucket" // 令牌桶，允许burst个令牌的突发
+	AlgorithmFixedWindow = "fixed_window" // 固定窗口，每秒最多rate个令牌，没有跨窗口的突发
+)
+
+// 规则匹配后的动作
+const (
+	ActionReject = "reject" // 超过限额时拒绝
+	ActionShadow = "shadow" // 超过限额时只记录，仍然放行，用于上线新规则前观察效果
+	ActionAllow  = "allow"  // 直接放行，不限流
+	ActionDeny   = "deny"   // 直接拒绝
+)
+
+// Request 参与规则匹配的请求属性
+type Request struct {
+	Method string
+	Path   string
+	Key    string              // API Key
+	Tenant string              // 租户标识
+	Header func(string) string // 读取请求头，为nil时不匹配任何请求头条件
+}
+
+// Verdict 一次限流判断的结果
+type Verdict struct {
+	Allowed bool
+	Rule    string
+	Action  string
+	Limited bool // 超过了规则的限额，shadow动作下Allowed仍为true
+}
+
+// RuleMatch 规则的匹配条件，所有非空条件都满足时匹配
+type RuleMatch struct {
+	Path    string            `json:"path,omitempty"`    // 路径前缀
+	Method  string            `json:"method,omitempty"`  // 不区分大小写
+	Key     string            `json:"key,omitempty"`     // API Key的通配符模式，如 partner-*，没有API Key的请求不匹配
+	Tenant  string            `json:"tenant,omitempty"`  // 租户标识
+	Headers map[string]string `json:"headers,omitempty"` // 请求头必须等于给定值
+}
+
+// RuleSpec 一条限流规则
+type RuleSpec struct {
+	Name      string    `json:"name"`
+	Match     RuleMatch `json:"match"`
+	Algorithm string    `json:"algorithm,omitempty"` // token_bucket（默认）或fixed_window
+	Rate      int64     `json:"rate,omitempty"`      // 每秒允许的令牌数，单位与全局限流器相同
+	Burst     int64     `json:"burst,omitempty"`     // 令牌桶的突发容量，为0时等于rate
+	Action    string    `json:"action,omitempty"`    // reject（默认）、shadow、allow或deny
+}
+
+// RuleStatus 规则及其命中次数
+type RuleStatus struct {
+	RuleSpec
+	Matched int64 `json:"matched"` // 匹配的请求数
+	Limited int64 `json:"limited"` // 超过限额的请求数，deny动作下为全部匹配的请求
+}
+
+// RuleSpecFromConfig 将配置文件中的规则转换为RuleSpec
+func RuleSpecFromConfig(cfg config.LimiterRuleConfig) RuleSpec {
+	return RuleSpec{
+		Name: cfg.Name,
+		Match: RuleMatch{
+			Path:    cfg.Match.Path,
+			Method:  cfg.Match.Method,
+			Key:     cfg.Match.Key,
+			Tenant:  cfg.Match.Tenant,
+			Headers: cfg.Match.Headers,
+		},
+		Algorithm: cfg.Algorithm,
+		Rate:      cfg.Rate,
+		Burst:     cfg.Burst,
+		Action:    cfg.Action,
+	}
+}
+
+// RuleSpecsFromConfig 将配置文件中的规则列表转换为RuleSpec
+func RuleSpecsFromConfig(rules []config.LimiterRuleConfig) []RuleSpec {
+	specs := make([]RuleSpec, len(rules))
+	for i, rule := range rules {
+		specs[i] = RuleSpecFromConfig(rule)
+	}
+	return specs
+}
+
+// RulesReloader 返回配置文件重新加载时更新限流规则的函数，applied为启动时已应用的配置文件中的规则
+// 只有配置文件中的规则与上一次应用的不同时才替换，与规则无关的配置修改（如logger.level）
+// 不会覆盖通过 PUT /admin/limiter/rules 设置的规则
+func RulesReloader(rl *RateLimiter, applied []config.LimiterRuleConfig) func(next []config.LimiterRuleConfig) {
+	var mu sync.Mutex
+	return func(next []config.LimiterRuleConfig) {
+		mu.Lock()
+		defer mu.Unlock()
+		if reflect.DeepEqual(next, applied) || (len(next) == 0 && len(applied) == 0) {
+			return
+		}
+		if err := rl.SetRules(RuleSpecsFromConfig(next)); err != nil {
+			logger.Error("重新加载限流规则失败", zap.Error(err))
+			return
+		}
+		applied = next
+	}
+}
+
+// normalize 校验规则并填充默认值
+func (spec RuleSpec) normalize() (RuleSpec, error) {
+	if spec.Name == "" {
+		return spec, errors.New("规则名不能为空")
+	}
+	if spec.Name == DefaultRule {
+		return spec, fmt.Errorf("规则名 %s 已被默认规则使用", DefaultRule)
+	}
+	if spec.Match.Path != "" && !strings.HasPrefix(spec.Match.Path, "/") {
+		return spec, fmt.Errorf("规则 %s: 路径必须以/开头", spec.Name)
+	}
+	if _, err := path.Match(spec.Match.Key, ""); err != nil {
+		return spec, fmt.Errorf("规则 %s: 无效的API Key模式", spec.Name)
+	}
+	spec.Match.Method = strings.ToUpper(spec.Match.Method)
+
+	if spec.Action == "" {
+		spec.Action = ActionReject
+	}
+	switch spec.Action {
+	case ActionAllow, ActionDeny:
+		// 不限流的规则不使用算法和速率
+		spec.Algorithm, spec.Rate, spec.Burst = "", 0, 0
+		return spec, nil
+	case ActionReject, ActionShadow:
+	default:
+		return spec, fmt.Errorf("规则 %s: 无效的动作 %s", spec.Name, spec.Action)
+	}
+
+	if spec.Algorithm == "" {
+		spec.Algorithm = AlgorithmTokenBucket
+	}
+	if spec.Rate <= 0 || spec.Burst < 0 {
+		return spec, fmt.Errorf("规则 %s: 速率必须大于0", spec.Name)
+	}
+	switch spec.Algorithm {
+	case AlgorithmTokenBucket:
+		if spec.Burst == 0 {
+			spec.Burst = spec.Rate
+		}
+	case AlgorithmFixedWindow:
+		spec.Burst = 0
+	default:
+		return spec, fmt.Errorf("规则 %s: 无效的算法 %s", spec.Name, spec.Algorithm)
+	}
+	return spec, nil
+}
+
+// ruleBucket 规则的限额状态，由RateLimiter的锁保护
+type ruleBucket interface {
+	allow(n int64, now time.Time) bool
+	// migrate 返回使用新规则的算法和速率的限额状态，保留当前剩余的额度
+	migrate(spec RuleSpec, now time.Time) ruleBucket
+}
+
+// tokenBucket 规则使用的令牌桶，与全局令牌桶的补充方式相同
+type tokenBucket struct {
+	rate  int64
+	burst int64
+	bucket
+}
+
+func (b *tokenBucket) allow(n int64, now time.Time) bool {
+	b.refill(b.burst, b.rate, now)
+	if b.tokens >= n {
+		b.tokens -= n
+		return true
+	}
+	return false
+}
+
+// migrate 先按原速率补充到now，剩余的令牌数超过新的突发容量时截断
+func (b *tokenBucket) migrate(spec RuleSpec, now time.Time) ruleBucket {
+	state := b.bucket
+	state.refill(b.burst, b.rate, now)
+	if spec.Algorithm == AlgorithmFixedWindow {
+		// 当前窗口只放行剩余的令牌数
+		return &fixedWindow{rate: spec.Rate, window: now.Truncate(time.Second), used: max(spec.Rate-state.tokens, 0)}
+	}
+	state.tokens = min(state.tokens, spec.Burst)
+	return &tokenBucket{rate: spec.Rate, burst: spec.Burst, bucket: state}
+}
+
+// fixedWindow 按整秒划分窗口，每个窗口最多放行rate个令牌
+type fixedWindow struct {
+	rate   int64
+	window time.Time
+	used   int64
+}
+
+func (w *fixedWindow) allow(n int64, now time.Time) bool {
+	if start := now.Truncate(time.Second); !start.Equal(w.window) {
+		w.window, w.used = start, 0
+	}
+	if w.used+n <= w.rate {
+		w.used += n
+		return true
+	}
+	return false
+}
+
+// migrate 保留当前窗口已放行的令牌数，切换为令牌桶时以窗口的剩余额度作为初始令牌
+func (w *fixedWindow) migrate(spec RuleSpec, now time.Time) ruleBucket {
+	used := w.used
+	if !now.Truncate(time.Second).Equal(w.window) {
+		used = 0
+	}
+	if spec.Algorithm == AlgorithmFixedWindow {
+		return &fixedWindow{rate: spec.Rate, window: w.window, used: used}
+	}
+	return &tokenBucket{rate: spec.Rate, burst: spec.Burst, bucket: bucket{tokens: min(max(w.rate-used, 0), spec.Burst), lastRefill: now}}
+}
+
+// rule 生效中的规则
+type rule struct {
+	spec    RuleSpec
+	bucket  ruleBucket // allow和deny动作为nil
+	matched int64
+	limited int64
+}
+
+// newRule 创建规则，prev为替换前的同名规则，没有时为nil
+// 同名规则的命中次数和限额状态被保留，算法和速率没有变化时继续使用原来的令牌桶或窗口，
+// 否则迁移剩余的额度，避免更新规则后限额重新开始而放行一次完整的突发
+func newRule(spec RuleSpec, now time.Time, prev *rule) *rule {
+	r := &rule{spec: spec}
+	if prev != nil {
+		r.matched, r.limited = prev.matched, prev.limited
+	}
+	switch {
+	case spec.Action == ActionAllow || spec.Action == ActionDeny:
+	case prev != nil && prev.bucket != nil && sameLimit(prev.spec, spec):
+		r.bucket = prev.bucket
+	case prev != nil && prev.bucket != nil:
+		r.bucket = prev.bucket.migrate(spec, now)
+	case spec.Algorithm == AlgorithmFixedWindow:
+		r.bucket = &fixedWindow{rate: spec.Rate}
+	default:
+		r.bucket = &tokenBucket{rate: spec.Rate, burst: spec.Burst, bucket: bucket{tokens: spec.Burst, lastRefill: now}}
+	}
+	return r
+}
+
+// sameLimit 判断两条规则的算法和限额是否相同
+func sameLimit(a, b RuleSpec) bool {
+	return a.Algorithm == b.Algorithm && a.Rate == b.Rate && a.Burst == b.Burst
+}
+
+// matches 判断请求是否满足规则的所有条件
+func (r *rule) matches(req Request) bool {
+	m := r.spec.Match
+	if m.Path != "" && !strings.HasPrefix(req.Path, m.Path) {
+		return false
+	}
+	if m.Method != "" && !strings.EqualFold(req.Method, m.Method) {
+		return false
+	}
+	if m.Key != "" {
+		if req.Key == "" {
+			return false
+		}
+		if ok, _ := path.Match(m.Key, req.Key); !ok {
+			return false
+		}
+	}
+	if m.Tenant != "" && req.Tenant != m.Tenant {
+		return false
+	}
+	for name, value := range m.Headers {
+		if req.Header == nil || req.Header(name) != value {
+			return false
+		}
+	}
+	return true
+}
+
+// SetRules 替换全部限流规则，规则按顺序匹配，第一个匹配的规则决定是否放行
+// 任何一条规则无效时返回错误且不修改现有规则；同名规则保留命中次数和剩余的额度，新增的规则从满额开始
+func (rl *RateLimiter) SetRules(specs []RuleSpec) error {
+	normalized := make([]RuleSpec, 0, len(specs))
+	names := make(map[string]bool, len(specs))
+	for _, spec := range specs {
+		spec, err := spec.normalize()
+		if err != nil {
+			return err
+		}
+		if names[spec.Name] {
+			return fmt.Errorf("规则 %s 重复", spec.Name)
+		}
+		names[spec.Name] = true
+		normalized = append(normalized, spec)
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	previous := make(map[string]*rule, len(rl.rules))
+	for _, r := range rl.rules {
+		previous[r.spec.Name] = r
+	}
+	now := rl.clock.Now()
+	rules := make([]*rule, len(normalized))
+	kept := 0
+	for i, spec := range normalized {
+		prev := previous[spec.Name]
+		if prev != nil {
+			kept++
+		}
+		rules[i] = newRule(spec, now, prev)
+	}
+	rl.rules = rules
+	logger.Info("限流规则已更新", zap.Int("rules", len(rules)), zap.Int("kept", kept))
+	return nil
+}
+
+// Rules 返回全部限流规则及其命中次数
+func (rl *RateLimiter) Rules() []RuleStatus {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	statuses := make([]RuleStatus, len(rl.rules))
+	for i, r := range rl.rules {
+		statuses[i] = RuleStatus{RuleSpec: r.spec, Matched: r.matched, Limited: r.limited}
+	}
+	return statuses
+}
+
+// SetIdentityHeaders 设置识别API Key和租户的请求头，为空的参数保持不变
+func (rl *RateLimiter) SetIdentityHeaders(keyHeader, tenantHeader string) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if keyHeader != "" {
+		rl.keyHeader = keyHeader
+	}
+	if tenantHeader != "" {
+		rl.tenantHeader = tenantHeader
+	}
+}
+
+// Identify 返回带有API Key和租户的请求属性，header用于读取请求头
+func (rl *RateLimiter) Identify(method, path string, header func(string) string) Request {
+	rl.mu.Lock()
+	keyHeader, tenantHeader := rl.keyHeader, rl.tenantHeader
+	rl.mu.Unlock()
+
+	return Request{
+		Method: method,
+		Path:   path,
+		Key:    header(keyHeader),
+		Tenant: header(tenantHeader),
+		Header: header,
+	}
+}
+
+// CheckRequest 按规则检查是否允许请求消耗n个令牌，未匹配任何规则时使用全局令牌桶
+// 进程内的令牌桶不会返回错误，签名与api.Allower一致，其他实现出错时是否放行由调用方的FailurePolicy决定；限流器禁用时不加锁直接放行
+// 设置了限流脚本时先执行脚本，脚本可以直接放行或拒绝请求，或替换令牌消耗后继续按规则判断
+func (rl *RateLimiter) CheckRequest(req Request, n int64) (Verdict, error) {
+	if !rl.enabled.Load() {
+		return Verdict{Allowed: true, Rule: DefaultRule, Action: ActionAllow}, nil
+	}
+	if n <= 0 {
+		n = 1
+	}
+
+	var override scriptOverride
+	if script := rl.script.Load(); script != nil {
+		override = script.run(rl.scriptInput(script, req, n))
+		if override.cost > 0 {
+			n = override.cost
+		}
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if override.action != "" {
+		rl.totalCount++
+		if override.action == ActionDeny {
+			rl.reject()
+			return Verdict{Rule: ScriptRule, Action: ActionDeny, Limited: true}, nil
+		}
+		return Verdict{Allowed: true, Rule: ScriptRule, Action: ActionAllow}, nil
+	}
+
+	var matched *rule
+	for _, r := range rl.rules {
+		if r.matches(req) {
+			matched = r
+			break
+		}
+	}
+
+	rl.totalCount++
+	if matched == nil {
+		rl.settle()
+		if rl.tokens >= n {
+			rl.tokens -= n
+			return Verdict{Allowed: true, Rule: DefaultRule, Action: ActionReject}, nil
+		}
+		rl.reject()
+		return Verdict{Rule: DefaultRule, Action: ActionReject, Limited: true}, nil
+	}
+
+	matched.matched++
+	verdict := Verdict{Allowed: true, Rule: matched.spec.Name, Action: matched.spec.Action}
+	switch {
+	case matched.spec.Action == ActionAllow:
+		return verdict, nil
+	case matched.spec.Action == ActionDeny:
+		verdict.Allowed, verdict.Limited = false, true
+	case !matched.bucket.allow(n, rl.clock.Now()):
+		verdict.Limited = true
+		verdict.Allowed = matched.spec.Action == ActionShadow
+	}
+
+	if verdict.Limited {
+		matched.limited++
+	}
+	if !verdict.Allowed {
+		rl.reject()
+	}
+	return verdict, nil
+}
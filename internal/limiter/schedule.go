@@ -0,0 +1,167 @@
+package limiter
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/workers"
+)
+
+// DefaultProfile 没有时间段生效时使用的限流配置名称
+const DefaultProfile = "default"
+
+const minutesPerDay = 24 * 60
+
+// scheduleRule 解析后的限流时间段
+type scheduleRule struct {
+	name  string
+	days  [7]bool // 按time.Weekday索引，全部为false时每天生效
+	start int     // 从零点开始的分钟数
+	end   int
+	rate  int64
+	burst int64
+}
+
+// activeOn 判断时间段在某一天是否生效
+func (r scheduleRule) activeOn(day time.Weekday) bool {
+	if r.days == [7]bool{} {
+		return true
+	}
+	return r.days[day]
+}
+
+// matches 判断时间段在指定时间是否生效
+// 跨越午夜的时间段按开始时间所在的星期判断，如周五22:00到06:00在周六凌晨仍然生效
+func (r scheduleRule) matches(now time.Time) bool {
+	minute := now.Hour()*60 + now.Minute()
+	day := now.Weekday()
+
+	switch {
+	case r.start == r.end:
+		return r.activeOn(day)
+	case r.start < r.end:
+		return r.activeOn(day) && minute >= r.start && minute < r.end
+	default:
+		if minute >= r.start {
+			return r.activeOn(day)
+		}
+		return minute < r.end && r.activeOn((day+6)%7)
+	}
+}
+
+// Scheduler 按时间段切换限流器的速率和突发容量
+// 仅在生效的时间段发生变化时修改限流器，期间通过管理接口手动调整的速率会保留到下一次切换
+type Scheduler struct {
+	limiter  *RateLimiter
+	base     scheduleRule
+	rules    []scheduleRule
+	clock    Clock
+	active   string
+	mu       sync.Mutex
+	worker   *workers.Worker
+	stopChan chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewScheduler 创建限流时间段调度器，立即应用当前生效的时间段并启动调度协程
+// rate和burst为没有时间段生效时的默认配置
+func NewScheduler(rl *RateLimiter, rate, burst int64, schedules []config.LimiterScheduleConfig, clock Clock) (*Scheduler, error) {
+	rules := make([]scheduleRule, 0, len(schedules))
+	for _, schedule := range schedules {
+		rule, err := parseSchedule(schedule, burst)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+
+	s := &Scheduler{
+		limiter:  rl,
+		base:     scheduleRule{name: DefaultProfile, rate: rate, burst: burst},
+		rules:    rules,
+		clock:    clock,
+		active:   rl.Profile(),
+		stopChan: make(chan struct{}),
+	}
+	s.Update(clock.Now())
+
+	s.worker = workers.Register("limiter.schedule", time.Minute)
+	s.worker.Go(&s.wg, s.run)
+	return s, nil
+}
+
+func parseSchedule(schedule config.LimiterScheduleConfig, defaultBurst int64) (scheduleRule, error) {
+	rule := scheduleRule{name: schedule.Name, rate: schedule.Rate, burst: schedule.Burst}
+	if rule.burst <= 0 {
+		rule.burst = defaultBurst
+	}
+	for _, name := range schedule.Days {
+		day, ok := config.Weekdays[name]
+		if !ok {
+			return rule, fmt.Errorf("limiter schedule %s: invalid day %s", schedule.Name, name)
+		}
+		rule.days[day] = true
+	}
+
+	var err error
+	if rule.start, err = config.ParseClock(schedule.Start); err != nil {
+		return rule, fmt.Errorf("limiter schedule %s: %w", schedule.Name, err)
+	}
+	if rule.end, err = config.ParseClock(schedule.End); err != nil {
+		return rule, fmt.Errorf("limiter schedule %s: %w", schedule.Name, err)
+	}
+	return rule, nil
+}
+
+// Update 按指定时间选择生效的时间段，发生变化时更新限流器，返回生效的时间段名称
+func (s *Scheduler) Update(now time.Time) string {
+	rule := s.base
+	for _, r := range s.rules {
+		if r.matches(now) {
+			rule = r
+			break
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if rule.name != s.active {
+		s.limiter.SetProfile(rule.name, rule.rate, rule.burst)
+		s.active = rule.name
+	}
+	return s.active
+}
+
+// Active 返回当前生效的时间段名称
+func (s *Scheduler) Active() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.active
+}
+
+// run 在每分钟开始时重新选择生效的时间段
+func (s *Scheduler) run() {
+	for {
+		now := s.clock.Now()
+		timer := time.NewTimer(now.Truncate(time.Minute).Add(time.Minute).Sub(now))
+		select {
+		case <-timer.C:
+			s.Update(s.clock.Now())
+			s.worker.Ran()
+		case <-s.stopChan:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// Stop 停止调度协程
+func (s *Scheduler) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stopChan)
+	})
+	s.wg.Wait()
+}
@@ -0,0 +1,260 @@
+package limiter
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/logger"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"go.starlark.net/syntax"
+	"go.uber.org/zap"
+)
+
+// ScriptRule 由限流脚本直接放行或拒绝的请求在决策中的规则名
+const ScriptRule = "script"
+
+const (
+	defaultScriptTimeout  = 5 * time.Millisecond
+	defaultScriptMaxSteps = 100000
+	scriptEntry           = "decide"
+)
+
+// scriptInput 传给decide函数的请求属性和限流状态
+type scriptInput struct {
+	Request
+	cost   int64
+	qps    int64
+	rule   string // 按规则会匹配的规则，未匹配时为default
+	rate   int64  // 全局令牌桶的速率、突发容量和当前令牌数
+	burst  int64
+	tokens int64
+}
+
+func (in scriptInput) value() starlark.Value {
+	return starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+		"method": starlark.String(in.Method),
+		"path":   starlark.String(in.Path),
+		"key":    starlark.String(in.Key),
+		"tenant": starlark.String(in.Tenant),
+		"cost":   starlark.MakeInt64(in.cost),
+		"qps":    starlark.MakeInt64(in.qps),
+		"rule":   starlark.String(in.rule),
+		"rate":   starlark.MakeInt64(in.rate),
+		"burst":  starlark.MakeInt64(in.burst),
+		"tokens": starlark.MakeInt64(in.tokens),
+	})
+}
+
+// scriptOverride decide函数的返回值，零值表示不干预
+type scriptOverride struct {
+	action string // allow或deny，为空时继续按规则和全局令牌桶判断
+	cost   int64  // 替换请求的令牌消耗，为0时不替换
+}
+
+// Script 限流脚本，每个请求执行一次脚本中的 decide(request) 函数
+// decide返回None时不干预；返回 "allow" 或 "deny" 时直接放行或拒绝，不消耗令牌；返回整数时替换请求的令牌消耗；
+// 也可以返回 {"action": ..., "cost": ...} 形式的dict。脚本只能使用Starlark的内置函数，不能load其他模块，
+// 每次执行受超时和步数限制，出错、超时或返回无效的值时按不干预处理并计入failures
+type Script struct {
+	name     string
+	decide   starlark.Callable
+	timeout  time.Duration
+	maxSteps uint64
+	qps      func() int64
+
+	evaluations atomic.Int64
+	overrides   atomic.Int64
+	failures    atomic.Int64
+}
+
+// NewScript 编译限流脚本，qps返回传给脚本的当前QPS，可以为nil
+func NewScript(cfg config.LimiterScriptConfig, qps func() int64) (*Script, error) {
+	name, src := "inline", cfg.Source
+	if cfg.File != "" {
+		data, err := os.ReadFile(cfg.File)
+		if err != nil {
+			return nil, fmt.Errorf("读取限流脚本失败: %w", err)
+		}
+		name, src = cfg.File, string(data)
+	}
+
+	s := &Script{
+		name:     name,
+		timeout:  cfg.Timeout,
+		maxSteps: cfg.MaxSteps,
+		qps:      qps,
+	}
+	if s.timeout <= 0 {
+		s.timeout = defaultScriptTimeout
+	}
+	if s.maxSteps == 0 {
+		s.maxSteps = defaultScriptMaxSteps
+	}
+	if s.qps == nil {
+		s.qps = func() int64 { return 0 }
+	}
+
+	// 顶层代码同样受步数限制，执行后全局变量被冻结，decide可以在多个请求中并发执行
+	thread := s.thread()
+	globals, err := starlark.ExecFileOptions(&syntax.FileOptions{}, thread, name, src, nil)
+	if err != nil {
+		return nil, fmt.Errorf("加载限流脚本失败: %w", err)
+	}
+	decide, ok := globals[scriptEntry].(starlark.Callable)
+	if !ok {
+		return nil, fmt.Errorf("限流脚本没有定义 %s 函数", scriptEntry)
+	}
+	s.decide = decide
+	return s, nil
+}
+
+// thread 创建一次执行使用的线程，print输出到调试日志，load不可用
+func (s *Script) thread() *starlark.Thread {
+	thread := &starlark.Thread{
+		Name: "limiter.script",
+		Print: func(_ *starlark.Thread, msg string) {
+			logger.Debug("限流脚本输出", zap.String("script", s.name), zap.String("message", msg))
+		},
+	}
+	thread.SetMaxExecutionSteps(s.maxSteps)
+	return thread
+}
+
+// run 执行decide函数，出错时按不干预处理
+func (s *Script) run(in scriptInput) scriptOverride {
+	s.evaluations.Add(1)
+
+	thread := s.thread()
+	timer := time.AfterFunc(s.timeout, func() { thread.Cancel("执行超时") })
+	result, err := starlark.Call(thread, s.decide, starlark.Tuple{in.value()}, nil)
+	timer.Stop()
+	if err == nil {
+		var override scriptOverride
+		if override, err = parseOverride(result); err == nil {
+			if override != (scriptOverride{}) {
+				s.overrides.Add(1)
+			}
+			return override
+		}
+	}
+
+	// 每100次失败记录一次日志，避免脚本持续出错时日志过多
+	if failures := s.failures.Add(1); failures%100 == 1 {
+		logger.Warn("限流脚本执行失败，按规则判断", zap.String("script", s.name), zap.Int64("failures", failures), zap.Error(err))
+	}
+	return scriptOverride{}
+}
+
+// parseOverride 解析decide函数的返回值
+func parseOverride(v starlark.Value) (scriptOverride, error) {
+	switch v := v.(type) {
+	case starlark.NoneType:
+		return scriptOverride{}, nil
+	case starlark.String:
+		return parseAction(string(v))
+	case starlark.Int:
+		return parseCost(v)
+	case *starlark.Dict:
+		var override scriptOverride
+		for _, item := range v.Items() {
+			field, ok := item[0].(starlark.String)
+			if !ok {
+				return scriptOverride{}, fmt.Errorf("返回值的键必须是字符串: %s", item[0])
+			}
+			switch field {
+			case "action":
+				action, ok := item[1].(starlark.String)
+				if !ok {
+					return scriptOverride{}, errors.New("action必须是字符串")
+				}
+				parsed, err := parseAction(string(action))
+				if err != nil {
+					return scriptOverride{}, err
+				}
+				override.action = parsed.action
+			case "cost":
+				cost, ok := item[1].(starlark.Int)
+				if !ok {
+					return scriptOverride{}, errors.New("cost必须是整数")
+				}
+				parsed, err := parseCost(cost)
+				if err != nil {
+					return scriptOverride{}, err
+				}
+				override.cost = parsed.cost
+			default:
+				return scriptOverride{}, fmt.Errorf("未知的返回字段 %s", field)
+			}
+		}
+		return override, nil
+	default:
+		return scriptOverride{}, fmt.Errorf("无效的返回值类型 %s", v.Type())
+	}
+}
+
+func parseAction(action string) (scriptOverride, error) {
+	switch action {
+	case ActionAllow, ActionDeny:
+		return scriptOverride{action: action}, nil
+	default:
+		return scriptOverride{}, fmt.Errorf("无效的动作 %s", action)
+	}
+}
+
+func parseCost(v starlark.Int) (scriptOverride, error) {
+	cost, ok := v.Int64()
+	if !ok || cost <= 0 {
+		return scriptOverride{}, fmt.Errorf("cost必须大于0: %s", v)
+	}
+	return scriptOverride{cost: cost}, nil
+}
+
+// ScriptStats 限流脚本的执行统计
+type ScriptStats struct {
+	Name        string `json:"name"`
+	Timeout     string `json:"timeout"`
+	MaxSteps    uint64 `json:"max_steps"`
+	Evaluations int64  `json:"evaluations"`
+	Overrides   int64  `json:"overrides"` // 脚本返回了动作或令牌消耗、覆盖规则判断的次数
+	Failures    int64  `json:"failures"`
+}
+
+// Stats 获取限流脚本的执行统计
+func (s *Script) Stats() ScriptStats {
+	return ScriptStats{
+		Name:        s.name,
+		Timeout:     s.timeout.String(),
+		MaxSteps:    s.maxSteps,
+		Evaluations: s.evaluations.Load(),
+		Overrides:   s.overrides.Load(),
+		Failures:    s.failures.Load(),
+	}
+}
+
+// SetScript 设置每个请求执行的限流脚本，nil表示不使用脚本
+func (rl *RateLimiter) SetScript(script *Script) {
+	rl.script.Store(script)
+}
+
+// scriptInput 在持有锁时读取脚本需要的限流状态，脚本本身在锁外执行
+func (rl *RateLimiter) scriptInput(script *Script, req Request, n int64) scriptInput {
+	in := scriptInput{Request: req, cost: n, qps: script.qps(), rule: DefaultRule}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.settle()
+	in.rate, in.burst, in.tokens = rl.rate, rl.burstSize, rl.tokens
+	for _, r := range rl.rules {
+		if r.matches(req) {
+			in.rule = r.spec.Name
+			break
+		}
+	}
+	return in
+}
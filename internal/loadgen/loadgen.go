@@ -0,0 +1,266 @@
+package loadgen
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/counter"
+	"github.com/mant7s/qps-counter/internal/ingest"
+	"github.com/mant7s/qps-counter/internal/logger"
+	"github.com/mant7s/qps-counter/internal/workers"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultMaxRate     = 100000
+	defaultMaxDuration = 10 * time.Minute
+	defaultDuration    = time.Minute
+	tickInterval       = 10 * time.Millisecond
+)
+
+var (
+	ErrRunning        = errors.New("已有压测在运行")
+	ErrInvalidRequest = errors.New("无效的压测参数")
+)
+
+// Request 一次压测的参数
+type Request struct {
+	Rate     int64         // 每秒生成的计数
+	Duration time.Duration // 压测时长，为0时为1分钟
+	Key      string        // 不为空时同时计入该key，需要启用counter.keys
+}
+
+// requestJSON Request的JSON表示，时长使用 "30s" 这样的字符串
+type requestJSON struct {
+	Rate     config.Count `json:"rate"` // 整数或 "1.5k" 这样的字符串
+	Duration string       `json:"duration,omitempty"`
+	Key      string       `json:"key,omitempty"`
+}
+
+// MarshalJSON 实现json.Marshaler接口
+func (r Request) MarshalJSON() ([]byte, error) {
+	return json.Marshal(requestJSON{Rate: config.Count(r.Rate), Duration: r.Duration.String(), Key: r.Key})
+}
+
+// UnmarshalJSON 实现json.Unmarshaler接口
+func (r *Request) UnmarshalJSON(data []byte) error {
+	var raw requestJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	req := Request{Rate: int64(raw.Rate), Key: raw.Key}
+	if raw.Duration != "" {
+		var err error
+		if req.Duration, err = time.ParseDuration(raw.Duration); err != nil {
+			return fmt.Errorf("无效的duration: %w", err)
+		}
+	}
+
+	*r = req
+	return nil
+}
+
+// Status 最近一次压测的状态，压测结束后仍然保留，直到开始下一次压测
+type Status struct {
+	Running   bool       `json:"running"`
+	Rate      int64      `json:"rate,omitempty"`
+	Duration  string     `json:"duration,omitempty"`
+	Key       string     `json:"key,omitempty"`
+	StartedAt *time.Time `json:"started_at,omitempty"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+	Generated int64      `json:"generated"` // 已写入计数器的计数
+	Dropped   int64      `json:"dropped"`   // 采集暂停期间丢弃的计数
+}
+
+// Generator 内置压测，按给定速率直接向计数器写入计数，不经过网络
+// 用于演示和CI中观察仪表盘和自适应分片等行为，不需要外部压测工具；同一时间只运行一次压测
+type Generator struct {
+	counter     counter.Counter
+	keyed       *counter.KeyedCounter
+	ingest      *ingest.Switch
+	maxRate     int64
+	maxDuration time.Duration
+
+	mu      sync.Mutex
+	current *run // 最近一次压测
+	wg      sync.WaitGroup
+}
+
+// run 一次压测的执行状态
+type run struct {
+	req       Request
+	startedAt time.Time
+	endedAt   atomic.Int64 // 结束时间（纳秒），运行中为0
+	generated atomic.Int64
+	dropped   atomic.Int64
+	stopChan  chan struct{}
+	stopOnce  sync.Once
+	done      chan struct{}
+}
+
+// NewGenerator 创建内置压测，计数写入c，keyed为nil时不能指定key；
+// 与其他数据源一样受采集开关控制，暂停期间生成的计数直接丢弃
+func NewGenerator(cfg config.LoadGenConfig, c counter.Counter, keyed *counter.KeyedCounter, sw *ingest.Switch) *Generator {
+	g := &Generator{
+		counter:     c,
+		keyed:       keyed,
+		ingest:      sw,
+		maxRate:     cfg.MaxRate,
+		maxDuration: cfg.MaxDuration,
+	}
+	if g.maxRate <= 0 {
+		g.maxRate = defaultMaxRate
+	}
+	if g.maxDuration <= 0 {
+		g.maxDuration = defaultMaxDuration
+	}
+	return g
+}
+
+// Start 开始一次压测，已有压测在运行时返回ErrRunning和正在运行的压测的状态
+func (g *Generator) Start(req Request) (Status, error) {
+	if req.Duration == 0 {
+		req.Duration = min(defaultDuration, g.maxDuration)
+	}
+	if err := g.validate(req); err != nil {
+		return Status{}, err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.current != nil && g.current.running() {
+		return g.current.status(), ErrRunning
+	}
+
+	r := &run{req: req, startedAt: time.Now(), stopChan: make(chan struct{}), done: make(chan struct{})}
+	g.current = r
+	worker := workers.Register("loadgen", tickInterval)
+	worker.Go(&g.wg, func() { g.generate(r, worker) })
+	logger.Info("内置压测已开始",
+		zap.Int64("rate", req.Rate), zap.Duration("duration", req.Duration), zap.String("key", req.Key))
+	return r.status(), nil
+}
+
+// validate 检查压测参数是否在配置的上限之内
+func (g *Generator) validate(req Request) error {
+	if req.Rate <= 0 || req.Rate > g.maxRate {
+		return fmt.Errorf("%w: rate必须在1到%d之间", ErrInvalidRequest, g.maxRate)
+	}
+	if req.Duration < 0 || req.Duration > g.maxDuration {
+		return fmt.Errorf("%w: duration必须大于0且不超过%s", ErrInvalidRequest, g.maxDuration)
+	}
+	if req.Key != "" && g.keyed == nil {
+		return fmt.Errorf("%w: 未启用按key计数，不能指定key", ErrInvalidRequest)
+	}
+	return nil
+}
+
+// Status 返回最近一次压测的状态，从未运行过时只有running为false
+func (g *Generator) Status() Status {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.current == nil {
+		return Status{}
+	}
+	return g.current.status()
+}
+
+// Cancel 停止正在运行的压测，等待其退出后返回最终状态
+func (g *Generator) Cancel() Status {
+	g.mu.Lock()
+	r := g.current
+	g.mu.Unlock()
+	if r == nil {
+		return Status{}
+	}
+	r.stop()
+	<-r.done
+	return r.status()
+}
+
+// Stop 停止正在运行的压测
+func (g *Generator) Stop() {
+	g.Cancel()
+	g.wg.Wait()
+}
+
+// generate 每个周期补齐从开始到现在应生成的计数，周期抖动不影响总数
+// 协程panic后重新运行时从已生成的计数继续
+func (g *Generator) generate(r *run, worker *workers.Worker) {
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			elapsed := min(now.Sub(r.startedAt), r.req.Duration)
+			due := int64(elapsed.Seconds() * float64(r.req.Rate))
+			if n := due - r.generated.Load() - r.dropped.Load(); n > 0 {
+				g.add(r, n)
+			}
+			worker.Ran()
+			if elapsed >= r.req.Duration {
+				r.finish()
+				return
+			}
+		case <-r.stopChan:
+			r.finish()
+			return
+		}
+	}
+}
+
+// add 写入n个计数，采集暂停时丢弃
+func (g *Generator) add(r *run, n int64) {
+	if g.ingest.Paused() {
+		r.dropped.Add(n)
+		return
+	}
+	g.counter.Add(n)
+	if r.req.Key != "" {
+		g.keyed.Add(r.req.Key, n)
+	}
+	r.generated.Add(n)
+}
+
+func (r *run) running() bool {
+	return r.endedAt.Load() == 0
+}
+
+func (r *run) stop() {
+	r.stopOnce.Do(func() {
+		close(r.stopChan)
+	})
+}
+
+// finish 记录结束时间，只由generate调用一次
+func (r *run) finish() {
+	r.endedAt.Store(time.Now().UnixNano())
+	close(r.done)
+	logger.Info("内置压测已结束",
+		zap.Int64("generated", r.generated.Load()), zap.Int64("dropped", r.dropped.Load()))
+}
+
+func (r *run) status() Status {
+	startedAt := r.startedAt
+	s := Status{
+		Running:   r.running(),
+		Rate:      r.req.Rate,
+		Duration:  r.req.Duration.String(),
+		Key:       r.req.Key,
+		StartedAt: &startedAt,
+		Generated: r.generated.Load(),
+		Dropped:   r.dropped.Load(),
+	}
+	if endedAt := r.endedAt.Load(); endedAt > 0 {
+		t := time.Unix(0, endedAt)
+		s.EndedAt = &t
+	}
+	return s
+}
@@ -11,6 +11,7 @@ import (
 
 var (
 	globalLogger *zap.Logger
+	traceLogger  *zap.Logger // 不受全局日志级别限制的追踪日志
 	atomicLevel  zap.AtomicLevel
 )
 
@@ -41,7 +42,7 @@ func Init(cfg config.LoggerConfig) {
 		encoder = zapcore.NewJSONEncoder(encoderConfig)
 	}
 
-	var cores []zapcore.Core
+	var cores, traceCores []zapcore.Core
 
 	if cfg.FilePath != "" {
 		fileWriter := zapcore.AddSync(&lumberjack.Logger{
@@ -53,12 +54,16 @@ func Init(cfg config.LoggerConfig) {
 		})
 		fileCore := zapcore.NewCore(encoder, fileWriter, atomicLevel)
 		cores = append(cores, fileCore)
+		traceCores = append(traceCores, zapcore.NewCore(encoder, fileWriter, zapcore.DebugLevel))
 	}
 
-	consoleCore := zapcore.NewCore(encoder, zapcore.AddSync(os.Stdout), atomicLevel)
+	consoleWriter := zapcore.AddSync(os.Stdout)
+	consoleCore := zapcore.NewCore(encoder, consoleWriter, atomicLevel)
 	cores = append(cores, consoleCore)
+	traceCores = append(traceCores, zapcore.NewCore(encoder, consoleWriter, zapcore.DebugLevel))
 
 	globalLogger = zap.New(zapcore.NewTee(cores...), zap.AddCaller())
+	traceLogger = zap.New(zapcore.NewTee(traceCores...), zap.AddCaller())
 
 	zap.RedirectStdLog(globalLogger)
 }
@@ -91,6 +96,11 @@ func Fatal(msg string, fields ...zap.Field) {
 	globalLogger.Fatal(msg, fields...)
 }
 
+// Trace 输出单个请求的追踪日志，不受全局日志级别限制
+func Trace(msg string, fields ...zap.Field) {
+	traceLogger.Info(msg, fields...)
+}
+
 func ErrorWrap(err error, msg string, fields ...zap.Field) {
 	fields = append(fields, zap.Error(err))
 	globalLogger.Error(fmt.Sprintf("%s: %v", msg, err), fields...)
@@ -0,0 +1,37 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/mant7s/qps-counter/internal/health"
+)
+
+// HealthCollector 在抓取时执行组件健康检查并导出各组件的状态
+type HealthCollector struct {
+	registry   *health.Registry
+	healthDesc *prometheus.Desc
+}
+
+// NewHealthCollector 创建一个组件健康指标采集器
+func NewHealthCollector(registry *health.Registry) *HealthCollector {
+	return &HealthCollector{
+		registry: registry,
+		healthDesc: prometheus.NewDesc(
+			"qps_counter_component_health",
+			"组件健康状态，0为healthy、1为degraded、2为unhealthy",
+			[]string{"component"}, nil,
+		),
+	}
+}
+
+// Describe 实现prometheus.Collector接口
+func (c *HealthCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.healthDesc
+}
+
+// Collect 实现prometheus.Collector接口
+func (c *HealthCollector) Collect(ch chan<- prometheus.Metric) {
+	for name, result := range c.registry.Check().Components {
+		ch <- prometheus.MustNewConstMetric(c.healthDesc, prometheus.GaugeValue, float64(result.Status.Level()), name)
+	}
+}
@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/mant7s/qps-counter/internal/ingest"
+)
+
+// IngestCollector 在抓取时导出采集工作池的队列状态
+type IngestCollector struct {
+	pool          *ingest.Pool
+	lengthDesc    *prometheus.Desc
+	capacityDesc  *prometheus.Desc
+	processedDesc *prometheus.Desc
+	droppedDesc   *prometheus.Desc
+}
+
+// NewIngestCollector 创建一个采集工作池指标采集器
+func NewIngestCollector(pool *ingest.Pool) *IngestCollector {
+	return &IngestCollector{
+		pool: pool,
+		lengthDesc: prometheus.NewDesc(
+			"qps_counter_ingest_queue_length",
+			"采集队列当前长度",
+			nil, nil,
+		),
+		capacityDesc: prometheus.NewDesc(
+			"qps_counter_ingest_queue_capacity",
+			"采集队列容量",
+			nil, nil,
+		),
+		processedDesc: prometheus.NewDesc(
+			"qps_counter_ingest_processed_total",
+			"采集工作池已处理的事件数",
+			nil, nil,
+		),
+		droppedDesc: prometheus.NewDesc(
+			"qps_counter_ingest_dropped_total",
+			"因队列已满被丢弃的事件数",
+			nil, nil,
+		),
+	}
+}
+
+// Describe 实现prometheus.Collector接口
+func (c *IngestCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.lengthDesc
+	ch <- c.capacityDesc
+	ch <- c.processedDesc
+	ch <- c.droppedDesc
+}
+
+// Collect 实现prometheus.Collector接口
+func (c *IngestCollector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(c.lengthDesc, prometheus.GaugeValue, float64(c.pool.QueueLength()))
+	ch <- prometheus.MustNewConstMetric(c.capacityDesc, prometheus.GaugeValue, float64(c.pool.QueueCapacity()))
+	ch <- prometheus.MustNewConstMetric(c.processedDesc, prometheus.CounterValue, float64(c.pool.Processed()))
+	ch <- prometheus.MustNewConstMetric(c.droppedDesc, prometheus.CounterValue, float64(c.pool.Dropped()))
+}
@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/mant7s/qps-counter/internal/counter"
+)
+
+// KeysCollector 在抓取时导出按key计数的key数量、溢出和清理计数，不导出每个key的QPS以免指标基数过高
+type KeysCollector struct {
+	counter      *counter.KeyedCounter
+	trackedDesc  *prometheus.Desc
+	overflowDesc *prometheus.Desc
+	evictedDesc  *prometheus.Desc
+}
+
+// NewKeysCollector 创建一个导出按key计数状态的采集器
+func NewKeysCollector(kc *counter.KeyedCounter) *KeysCollector {
+	return &KeysCollector{
+		counter: kc,
+		trackedDesc: prometheus.NewDesc(
+			"qps_counter_keys_tracked",
+			"当前跟踪的key数量",
+			nil, nil,
+		),
+		overflowDesc: prometheus.NewDesc(
+			"qps_counter_keys_overflow_total",
+			"因超出key数量上限被丢弃的事件数",
+			nil, nil,
+		),
+		evictedDesc: prometheus.NewDesc(
+			"qps_counter_keys_evicted_total",
+			"因超过idle_ttl没有写入被清理的key数",
+			nil, nil,
+		),
+	}
+}
+
+// Describe 实现prometheus.Collector接口
+func (c *KeysCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.trackedDesc
+	ch <- c.overflowDesc
+	ch <- c.evictedDesc
+}
+
+// Collect 实现prometheus.Collector接口
+func (c *KeysCollector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(c.trackedDesc, prometheus.GaugeValue, float64(c.counter.KeyCount()))
+	ch <- prometheus.MustNewConstMetric(c.overflowDesc, prometheus.CounterValue, float64(c.counter.Overflow()))
+	ch <- prometheus.MustNewConstMetric(c.evictedDesc, prometheus.CounterValue, float64(c.counter.Evicted()))
+}
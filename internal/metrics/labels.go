@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"os"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// autoLabelEnvs 自动从环境变量（通常由Kubernetes Downward API注入）读取的标签
+var autoLabelEnvs = map[string]string{
+	"pod":       "POD_NAME",
+	"namespace": "POD_NAMESPACE",
+}
+
+// ResolveLabels 解析常量标签配置
+// 配置值支持 ${ENV} 形式引用环境变量，展开后为空的标签会被忽略；
+// 未显式配置时自动补充 instance（主机名）以及 pod、namespace（来自Downward API环境变量）
+func ResolveLabels(configured map[string]string) prometheus.Labels {
+	labels := prometheus.Labels{}
+
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		labels["instance"] = hostname
+	}
+	for name, env := range autoLabelEnvs {
+		if value := os.Getenv(env); value != "" {
+			labels[name] = value
+		}
+	}
+
+	// 显式配置的标签优先级最高
+	for name, value := range configured {
+		value = os.ExpandEnv(value)
+		if value == "" {
+			delete(labels, name)
+			continue
+		}
+		labels[name] = value
+	}
+
+	return labels
+}
@@ -0,0 +1,35 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/mant7s/qps-counter/internal/counter"
+)
+
+// LateCollector 在抓取时导出带事件时间的延迟上报的写入和丢弃次数
+type LateCollector struct {
+	lateDesc *prometheus.Desc
+}
+
+// NewLateCollector 创建一个延迟上报指标采集器
+func NewLateCollector() *LateCollector {
+	return &LateCollector{
+		lateDesc: prometheus.NewDesc(
+			"qps_counter_late_events_total",
+			"携带事件时间的延迟上报次数，按写入事件时间所在的槽位和超出窗口被丢弃区分",
+			[]string{"result"}, nil,
+		),
+	}
+}
+
+// Describe 实现prometheus.Collector接口
+func (c *LateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.lateDesc
+}
+
+// Collect 实现prometheus.Collector接口
+func (c *LateCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := counter.LateEvents()
+	ch <- prometheus.MustNewConstMetric(c.lateDesc, prometheus.CounterValue, float64(stats.Placed), "placed")
+	ch <- prometheus.MustNewConstMetric(c.lateDesc, prometheus.CounterValue, float64(stats.Dropped), "dropped")
+}
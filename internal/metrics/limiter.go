@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/mant7s/qps-counter/internal/limiter"
+)
+
+// LimiterFailureCollector 在抓取时导出各路由的限流器失败策略和失败次数
+type LimiterFailureCollector struct {
+	policy       *limiter.FailurePolicy
+	policyDesc   *prometheus.Desc
+	failuresDesc *prometheus.Desc
+}
+
+// NewLimiterFailureCollector 创建一个限流器失败策略指标采集器
+func NewLimiterFailureCollector(policy *limiter.FailurePolicy) *LimiterFailureCollector {
+	return &LimiterFailureCollector{
+		policy: policy,
+		policyDesc: prometheus.NewDesc(
+			"qps_counter_limiter_failure_policy",
+			"各路由在限流器出错时采用的策略，生效的策略值为1",
+			[]string{"route", "policy"}, nil,
+		),
+		failuresDesc: prometheus.NewDesc(
+			"qps_counter_limiter_failures_total",
+			"限流器出错的次数，按路由和采用的策略区分",
+			[]string{"route", "policy"}, nil,
+		),
+	}
+}
+
+// Describe 实现prometheus.Collector接口
+func (c *LimiterFailureCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.policyDesc
+	ch <- c.failuresDesc
+}
+
+// Collect 实现prometheus.Collector接口
+func (c *LimiterFailureCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, route := range c.policy.Policies() {
+		ch <- prometheus.MustNewConstMetric(c.policyDesc, prometheus.GaugeValue, 1, route.Route, route.Policy)
+		ch <- prometheus.MustNewConstMetric(c.failuresDesc, prometheus.CounterValue, float64(route.Failures), route.Route, route.Policy)
+	}
+}
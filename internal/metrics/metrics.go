@@ -1,101 +1,160 @@
 package metrics
 
 import (
+	"errors"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
 	"runtime"
 	"sync"
 	"time"
 
 	"github.com/mant7s/qps-counter/internal/counter"
+	"github.com/mant7s/qps-counter/internal/workers"
 )
 
 // Metrics 提供系统监控指标收集和导出功能
+// nil表示未启用指标，所有方法都可以在nil上调用，不注册也不采集任何指标
 type Metrics struct {
-	counter       counter.Counter
-	registry      *prometheus.Registry
-	qpsGauge      prometheus.Gauge
-	memoryGauge   prometheus.Gauge
-	cpuGauge      prometheus.Gauge
+	counter        counter.Counter
+	registry       *prometheus.Registry
+	registerer     prometheus.Registerer // 附加了常量标签的注册器
+	qpsGauge       prometheus.Gauge
+	memoryGauge    prometheus.Gauge
+	cpuGauge       prometheus.Gauge
 	goroutineGauge prometheus.Gauge
 	requestCounter prometheus.Counter
 	requestLatency prometheus.Histogram
-	stopChan      chan struct{}
-	wg            sync.WaitGroup
+	stopChan       chan struct{}
+	wg             sync.WaitGroup
 }
 
 // NewMetrics 创建一个新的指标收集器
 func NewMetrics(counter counter.Counter) *Metrics {
-	reg := prometheus.NewRegistry()
+	return NewMetricsWithLabels(counter, nil)
+}
+
+// NewMetricsWithLabels 创建一个指标收集器，所有导出的指标都会附加给定的常量标签，
+// 用于在多副本部署中区分不同实例
+func NewMetricsWithLabels(counter counter.Counter, constLabels prometheus.Labels) *Metrics {
+	return NewMetricsWithRegistry(counter, constLabels, prometheus.NewRegistry())
+}
+
+// NewMetricsWithRegistry 创建一个指标收集器，指标注册到注入的注册表，
+// Gin和fasthttp路由器都通过Registry导出同一个注册表中的指标。
+// 注册表中已有同名指标时复用已注册的指标，不会因重复注册而panic
+func NewMetricsWithRegistry(counter counter.Counter, constLabels prometheus.Labels, reg *prometheus.Registry) *Metrics {
+	wrapped := prometheus.WrapRegistererWith(constLabels, reg)
 
 	m := &Metrics{
-		counter:  counter,
-		registry: reg,
-		qpsGauge: promauto.With(reg).NewGauge(
+		counter:    counter,
+		registry:   reg,
+		registerer: wrapped,
+		qpsGauge: register(wrapped, prometheus.NewGauge(
 			prometheus.GaugeOpts{
 				Name: "qps_counter_current_qps",
 				Help: "当前系统QPS",
 			},
-		),
-		memoryGauge: promauto.With(reg).NewGauge(
+		)),
+		memoryGauge: register(wrapped, prometheus.NewGauge(
 			prometheus.GaugeOpts{
 				Name: "qps_counter_memory_usage_bytes",
 				Help: "当前内存使用量（字节）",
 			},
-		),
-		cpuGauge: promauto.With(reg).NewGauge(
+		)),
+		cpuGauge: register(wrapped, prometheus.NewGauge(
 			prometheus.GaugeOpts{
 				Name: "qps_counter_cpu_usage_percent",
 				Help: "当前CPU使用率",
 			},
-		),
-		goroutineGauge: promauto.With(reg).NewGauge(
+		)),
+		goroutineGauge: register(wrapped, prometheus.NewGauge(
 			prometheus.GaugeOpts{
 				Name: "qps_counter_goroutines",
 				Help: "当前goroutine数量",
 			},
-		),
-		requestCounter: promauto.With(reg).NewCounter(
+		)),
+		requestCounter: register(wrapped, prometheus.NewCounter(
 			prometheus.CounterOpts{
 				Name: "qps_counter_requests_total",
 				Help: "处理的请求总数",
 			},
-		),
-		requestLatency: promauto.With(reg).NewHistogram(
+		)),
+		requestLatency: register(wrapped, prometheus.NewHistogram(
 			prometheus.HistogramOpts{
 				Name:    "qps_counter_request_duration_seconds",
 				Help:    "请求处理时间分布",
 				Buckets: prometheus.DefBuckets,
 			},
-		),
+		)),
 		stopChan: make(chan struct{}),
 	}
 
 	return m
 }
 
+// register 注册指标，注册表中已有相同的指标时返回已注册的指标，
+// 其他注册错误（如同名指标的类型或标签不同）说明指标定义冲突，直接panic
+func register[T prometheus.Collector](r prometheus.Registerer, c T) T {
+	if err := r.Register(c); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if errors.As(err, &are) {
+			if existing, ok := are.ExistingCollector.(T); ok {
+				return existing
+			}
+		}
+		panic(err)
+	}
+	return c
+}
+
 // Start 启动指标收集
 func (m *Metrics) Start(interval time.Duration) {
+	if m == nil {
+		return
+	}
 	if interval <= 0 {
 		interval = 5 * time.Second // 默认5秒间隔
 	}
-	m.wg.Add(1)
-	go m.collectMetrics(interval)
+	idle := counter.IdleDetectorOf(m.counter)
+	worker := workers.Register("metrics.collector", interval).WithIdle(idle.Idle)
+	worker.Go(&m.wg, func() { m.collectMetrics(interval, idle, worker) })
 }
 
 // Stop 停止指标收集
 func (m *Metrics) Stop() {
+	if m == nil {
+		return
+	}
 	close(m.stopChan)
 	m.wg.Wait()
 }
 
-// Registry 返回Prometheus注册表，用于HTTP处理程序
+// Registry 返回Prometheus注册表，用于HTTP处理程序，未启用指标时返回nil
 func (m *Metrics) Registry() *prometheus.Registry {
+	if m == nil {
+		return nil
+	}
 	return m.registry
 }
 
+// Register 注册一个额外的指标采集器，采集器导出的指标同样附加常量标签
+// 同一个采集器重复注册时忽略，导出相同指标的另一个采集器返回prometheus.AlreadyRegisteredError
+func (m *Metrics) Register(collector prometheus.Collector) error {
+	if m == nil {
+		return nil
+	}
+	err := m.registerer.Register(collector)
+	var are prometheus.AlreadyRegisteredError
+	if errors.As(err, &are) && are.ExistingCollector == collector {
+		return nil
+	}
+	return err
+}
+
 // RecordRequest 记录一个请求
 func (m *Metrics) RecordRequest() func() {
+	if m == nil {
+		return func() {}
+	}
 	m.requestCounter.Inc()
 	start := time.Now()
 	return func() {
@@ -104,9 +163,8 @@ func (m *Metrics) RecordRequest() func() {
 	}
 }
 
-// collectMetrics 定期收集系统指标
-func (m *Metrics) collectMetrics(interval time.Duration) {
-	defer m.wg.Done()
+// collectMetrics 定期收集系统指标，计数器空闲时暂停收集
+func (m *Metrics) collectMetrics(interval time.Duration, idle *counter.IdleDetector, worker *workers.Worker) {
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
@@ -124,9 +182,14 @@ func (m *Metrics) collectMetrics(interval time.Duration) {
 
 			// 更新goroutine数量
 			m.goroutineGauge.Set(float64(runtime.NumGoroutine()))
+			worker.Ran()
+
+			if !idle.PauseTicker(ticker, interval, m.stopChan) {
+				return
+			}
 
 		case <-m.stopChan:
 			return
 		}
 	}
-}
\ No newline at end of file
+}
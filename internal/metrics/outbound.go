@@ -0,0 +1,114 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/mant7s/qps-counter/internal/outbound"
+)
+
+// breakerStates 熔断器状态导出为指标时的取值
+var breakerStates = map[string]float64{
+	outbound.StateClosed:   0,
+	outbound.StateHalfOpen: 1,
+	outbound.StateOpen:     2,
+}
+
+// OutboundCollector 在抓取时导出各目标地址的出站请求结果、重试次数、熔断器状态和连接池统计
+type OutboundCollector struct {
+	client       *outbound.Client
+	requestsDesc *prometheus.Desc
+	retriesDesc  *prometheus.Desc
+	breakerDesc  *prometheus.Desc
+
+	inFlightDesc    *prometheus.Desc
+	connsDesc       *prometheus.Desc
+	acquiredDesc    *prometheus.Desc
+	dnsDesc         *prometheus.Desc
+	tlsDesc         *prometheus.Desc
+	tlsFailuresDesc *prometheus.Desc
+}
+
+// NewOutboundCollector 创建一个出站请求指标采集器
+func NewOutboundCollector(client *outbound.Client) *OutboundCollector {
+	return &OutboundCollector{
+		client: client,
+		requestsDesc: prometheus.NewDesc(
+			"qps_counter_outbound_requests_total",
+			"出站请求数，按目标地址和结果（success、failure、rejected）区分，重试不单独计数",
+			[]string{"destination", "result"}, nil,
+		),
+		retriesDesc: prometheus.NewDesc(
+			"qps_counter_outbound_retries_total",
+			"出站请求的重试次数",
+			[]string{"destination"}, nil,
+		),
+		breakerDesc: prometheus.NewDesc(
+			"qps_counter_outbound_breaker_state",
+			"各目标地址的熔断器状态：0为closed，1为half_open，2为open",
+			[]string{"destination"}, nil,
+		),
+		inFlightDesc: prometheus.NewDesc(
+			"qps_counter_outbound_in_flight_requests",
+			"已发出、尚未收到响应头的出站请求数",
+			[]string{"destination"}, nil,
+		),
+		connsDesc: prometheus.NewDesc(
+			"qps_counter_outbound_connections",
+			"出站连接数，按状态（open为所有打开的连接，idle为其中在连接池中空闲的连接）区分",
+			[]string{"destination", "state"}, nil,
+		),
+		acquiredDesc: prometheus.NewDesc(
+			"qps_counter_outbound_connections_acquired_total",
+			"出站请求取得连接的次数，按是否复用连接池中的连接区分",
+			[]string{"destination", "reused"}, nil,
+		),
+		dnsDesc: prometheus.NewDesc(
+			"qps_counter_outbound_dns_duration_seconds",
+			"新建出站连接时DNS解析的耗时",
+			[]string{"destination"}, nil,
+		),
+		tlsDesc: prometheus.NewDesc(
+			"qps_counter_outbound_tls_handshake_duration_seconds",
+			"新建出站连接时TLS握手的耗时，包括失败的握手",
+			[]string{"destination"}, nil,
+		),
+		tlsFailuresDesc: prometheus.NewDesc(
+			"qps_counter_outbound_tls_handshake_failures_total",
+			"失败的TLS握手次数",
+			[]string{"destination"}, nil,
+		),
+	}
+}
+
+// Describe 实现prometheus.Collector接口
+func (c *OutboundCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.requestsDesc
+	ch <- c.retriesDesc
+	ch <- c.breakerDesc
+	ch <- c.inFlightDesc
+	ch <- c.connsDesc
+	ch <- c.acquiredDesc
+	ch <- c.dnsDesc
+	ch <- c.tlsDesc
+	ch <- c.tlsFailuresDesc
+}
+
+// Collect 实现prometheus.Collector接口
+func (c *OutboundCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, s := range c.client.Stats() {
+		ch <- prometheus.MustNewConstMetric(c.requestsDesc, prometheus.CounterValue, float64(s.Successes), s.Destination, "success")
+		ch <- prometheus.MustNewConstMetric(c.requestsDesc, prometheus.CounterValue, float64(s.Failures), s.Destination, "failure")
+		ch <- prometheus.MustNewConstMetric(c.requestsDesc, prometheus.CounterValue, float64(s.Rejected), s.Destination, "rejected")
+		ch <- prometheus.MustNewConstMetric(c.retriesDesc, prometheus.CounterValue, float64(s.Retries), s.Destination)
+		ch <- prometheus.MustNewConstMetric(c.breakerDesc, prometheus.GaugeValue, breakerStates[s.State], s.Destination)
+
+		ch <- prometheus.MustNewConstMetric(c.inFlightDesc, prometheus.GaugeValue, float64(s.InFlight), s.Destination)
+		ch <- prometheus.MustNewConstMetric(c.connsDesc, prometheus.GaugeValue, float64(s.OpenConns), s.Destination, "open")
+		ch <- prometheus.MustNewConstMetric(c.connsDesc, prometheus.GaugeValue, float64(s.IdleConns), s.Destination, "idle")
+		ch <- prometheus.MustNewConstMetric(c.acquiredDesc, prometheus.CounterValue, float64(s.NewConns), s.Destination, "false")
+		ch <- prometheus.MustNewConstMetric(c.acquiredDesc, prometheus.CounterValue, float64(s.ReusedConns), s.Destination, "true")
+		ch <- prometheus.MustNewConstSummary(c.dnsDesc, uint64(s.DNSLookups), s.DNSTime.Seconds(), nil, s.Destination)
+		ch <- prometheus.MustNewConstSummary(c.tlsDesc, uint64(s.TLSHandshakes), s.TLSTime.Seconds(), nil, s.Destination)
+		ch <- prometheus.MustNewConstMetric(c.tlsFailuresDesc, prometheus.CounterValue, float64(s.TLSFailures), s.Destination)
+	}
+}
@@ -0,0 +1,35 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/mant7s/qps-counter/internal/counter"
+)
+
+// OverflowCollector 在抓取时导出计数器各类型的溢出次数
+type OverflowCollector struct {
+	overflowDesc *prometheus.Desc
+}
+
+// NewOverflowCollector 创建一个计数溢出指标采集器
+func NewOverflowCollector() *OverflowCollector {
+	return &OverflowCollector{
+		overflowDesc: prometheus.NewDesc(
+			"qps_counter_arithmetic_overflow_total",
+			"计数或速率超出int64范围被截断的次数，按写入、累加、速率换算和负数总计数区分",
+			[]string{"kind"}, nil,
+		),
+	}
+}
+
+// Describe 实现prometheus.Collector接口
+func (c *OverflowCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.overflowDesc
+}
+
+// Collect 实现prometheus.Collector接口
+func (c *OverflowCollector) Collect(ch chan<- prometheus.Metric) {
+	for kind, n := range counter.Overflows() {
+		ch <- prometheus.MustNewConstMetric(c.overflowDesc, prometheus.CounterValue, float64(n), kind)
+	}
+}
@@ -0,0 +1,46 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/mant7s/qps-counter/internal/ingest"
+)
+
+// PipelineCollector 在抓取时导出各采集管道每个阶段的事件数
+type PipelineCollector struct {
+	pipelines  []*ingest.Pipeline
+	eventsDesc *prometheus.Desc
+}
+
+// NewPipelineCollector 创建一个采集管道指标采集器
+func NewPipelineCollector(pipelines []*ingest.Pipeline) *PipelineCollector {
+	return &PipelineCollector{
+		pipelines: pipelines,
+		eventsDesc: prometheus.NewDesc(
+			"qps_counter_pipeline_events_total",
+			"采集管道各阶段的事件数，按读取、解码失败、采样丢弃、提交到工作池和工作池未接受区分",
+			[]string{"pipeline", "source", "result"}, nil,
+		),
+	}
+}
+
+// Describe 实现prometheus.Collector接口
+func (c *PipelineCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.eventsDesc
+}
+
+// Collect 实现prometheus.Collector接口
+func (c *PipelineCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, p := range c.pipelines {
+		stats := p.Stats()
+		for result, n := range map[string]int64{
+			"received":  stats.Received,
+			"invalid":   stats.Invalid,
+			"sampled":   stats.Sampled,
+			"submitted": stats.Submitted,
+			"dropped":   stats.Dropped,
+		} {
+			ch <- prometheus.MustNewConstMetric(c.eventsDesc, prometheus.CounterValue, float64(n), stats.Name, stats.Source, result)
+		}
+	}
+}
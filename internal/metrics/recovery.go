@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/mant7s/qps-counter/internal/recovery"
+	"github.com/mant7s/qps-counter/internal/workers"
+)
+
+// RecoveryCollector 在抓取时导出各组件已恢复的panic次数
+type RecoveryCollector struct {
+	panicsDesc *prometheus.Desc
+}
+
+// NewRecoveryCollector 创建一个panic指标采集器
+func NewRecoveryCollector() *RecoveryCollector {
+	return &RecoveryCollector{
+		panicsDesc: prometheus.NewDesc(
+			"qps_counter_panics_total",
+			"已恢复的panic次数，按HTTP服务器或后台协程区分",
+			[]string{"component"}, nil,
+		),
+	}
+}
+
+// Describe 实现prometheus.Collector接口
+func (c *RecoveryCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.panicsDesc
+}
+
+// Collect 实现prometheus.Collector接口
+func (c *RecoveryCollector) Collect(ch chan<- prometheus.Metric) {
+	for component, n := range recovery.Panics() {
+		ch <- prometheus.MustNewConstMetric(c.panicsDesc, prometheus.CounterValue, float64(n), component)
+	}
+}
+
+// WorkerCollector 在抓取时导出看门狗发现后台协程卡住和重新启动的次数
+type WorkerCollector struct {
+	stallsDesc   *prometheus.Desc
+	restartsDesc *prometheus.Desc
+}
+
+// NewWorkerCollector 创建一个后台协程看门狗指标采集器
+func NewWorkerCollector() *WorkerCollector {
+	return &WorkerCollector{
+		stallsDesc: prometheus.NewDesc(
+			"qps_counter_worker_stalls_total",
+			"看门狗发现后台协程卡住的次数",
+			[]string{"worker"}, nil,
+		),
+		restartsDesc: prometheus.NewDesc(
+			"qps_counter_worker_restarts_total",
+			"看门狗重新启动卡住的后台协程的次数",
+			[]string{"worker"}, nil,
+		),
+	}
+}
+
+// Describe 实现prometheus.Collector接口
+func (c *WorkerCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.stallsDesc
+	ch <- c.restartsDesc
+}
+
+// Collect 实现prometheus.Collector接口
+func (c *WorkerCollector) Collect(ch chan<- prometheus.Metric) {
+	for worker, n := range workers.Stalls() {
+		ch <- prometheus.MustNewConstMetric(c.stallsDesc, prometheus.CounterValue, float64(n), worker)
+	}
+	for worker, n := range workers.Restarts() {
+		ch <- prometheus.MustNewConstMetric(c.restartsDesc, prometheus.CounterValue, float64(n), worker)
+	}
+}
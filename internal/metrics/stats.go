@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/mant7s/qps-counter/internal/counter"
+	"github.com/mant7s/qps-counter/internal/limiter"
+)
+
+// StatsCollector 在抓取时按限流器、自适应分片和优雅关闭的Stats结构导出指标，与 /stats/v2 读取的是同一份状态
+type StatsCollector struct {
+	limiter  *limiter.RateLimiter
+	sharding *counter.EnhancedAdaptiveShardingManager
+	shutdown *counter.EnhancedGracefulShutdown
+
+	rateDesc           *prometheus.Desc
+	tokensDesc         *prometheus.Desc
+	enabledDesc        *prometheus.Desc
+	checksDesc         *prometheus.Desc
+	rejectedDesc       *prometheus.Desc
+	shardsDesc         *prometheus.Desc
+	activeRequestsDesc *prometheus.Desc
+}
+
+// NewStatsCollector 创建一个状态指标采集器，为nil的组件不导出对应的指标
+func NewStatsCollector(rl *limiter.RateLimiter, sharding *counter.EnhancedAdaptiveShardingManager, shutdown *counter.EnhancedGracefulShutdown) *StatsCollector {
+	return &StatsCollector{
+		limiter:  rl,
+		sharding: sharding,
+		shutdown: shutdown,
+		rateDesc: prometheus.NewDesc(
+			"qps_counter_limiter_rate",
+			"限流器的全局速率（每秒令牌数）",
+			nil, nil,
+		),
+		tokensDesc: prometheus.NewDesc(
+			"qps_counter_limiter_tokens",
+			"全局令牌桶当前的令牌数",
+			nil, nil,
+		),
+		enabledDesc: prometheus.NewDesc(
+			"qps_counter_limiter_enabled",
+			"限流器是否启用，启用时为1",
+			nil, nil,
+		),
+		checksDesc: prometheus.NewDesc(
+			"qps_counter_limiter_checks_total",
+			"经过限流判断的请求数",
+			nil, nil,
+		),
+		rejectedDesc: prometheus.NewDesc(
+			"qps_counter_limiter_rejected_total",
+			"被限流拒绝的请求数",
+			nil, nil,
+		),
+		shardsDesc: prometheus.NewDesc(
+			"qps_counter_shards",
+			"自适应分片管理器当前的分片数",
+			nil, nil,
+		),
+		activeRequestsDesc: prometheus.NewDesc(
+			"qps_counter_shutdown_active_requests",
+			"优雅关闭跟踪的进行中的上报请求数",
+			nil, nil,
+		),
+	}
+}
+
+// Describe 实现prometheus.Collector接口
+func (c *StatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.rateDesc
+	ch <- c.tokensDesc
+	ch <- c.enabledDesc
+	ch <- c.checksDesc
+	ch <- c.rejectedDesc
+	ch <- c.shardsDesc
+	ch <- c.activeRequestsDesc
+}
+
+// Collect 实现prometheus.Collector接口
+func (c *StatsCollector) Collect(ch chan<- prometheus.Metric) {
+	if c.limiter != nil {
+		stats := c.limiter.Stats()
+		enabled := 0.0
+		if stats.Enabled {
+			enabled = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.rateDesc, prometheus.GaugeValue, float64(stats.Rate))
+		ch <- prometheus.MustNewConstMetric(c.tokensDesc, prometheus.GaugeValue, float64(stats.CurrentTokens))
+		ch <- prometheus.MustNewConstMetric(c.enabledDesc, prometheus.GaugeValue, enabled)
+		ch <- prometheus.MustNewConstMetric(c.checksDesc, prometheus.CounterValue, float64(stats.TotalCount))
+		ch <- prometheus.MustNewConstMetric(c.rejectedDesc, prometheus.CounterValue, float64(stats.RejectedCount))
+	}
+	if c.sharding != nil {
+		ch <- prometheus.MustNewConstMetric(c.shardsDesc, prometheus.GaugeValue, float64(c.sharding.Stats().CurrentShards))
+	}
+	if c.shutdown != nil {
+		ch <- prometheus.MustNewConstMetric(c.activeRequestsDesc, prometheus.GaugeValue, float64(c.shutdown.Stats().ActiveRequests))
+	}
+}
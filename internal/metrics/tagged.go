@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/mant7s/qps-counter/internal/counter"
+)
+
+// TaggedCollector 在抓取时导出每个标签组合的QPS，标签名与计数器声明的标签一致
+type TaggedCollector struct {
+	counter      *counter.TaggedCounter
+	qpsDesc      *prometheus.Desc
+	seriesDesc   *prometheus.Desc
+	overflowDesc *prometheus.Desc
+}
+
+// NewTaggedCollector 创建一个按标签组合导出QPS的采集器
+func NewTaggedCollector(tc *counter.TaggedCounter) *TaggedCollector {
+	return &TaggedCollector{
+		counter: tc,
+		qpsDesc: prometheus.NewDesc(
+			"qps_counter_tagged_qps",
+			"按标签组合统计的QPS",
+			tc.Keys(), nil,
+		),
+		seriesDesc: prometheus.NewDesc(
+			"qps_counter_tagged_series",
+			"当前的标签组合数量",
+			nil, nil,
+		),
+		overflowDesc: prometheus.NewDesc(
+			"qps_counter_tagged_overflow_total",
+			"因超出标签组合数量上限被丢弃的事件数",
+			nil, nil,
+		),
+	}
+}
+
+// Describe 实现prometheus.Collector接口
+func (c *TaggedCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.qpsDesc
+	ch <- c.seriesDesc
+	ch <- c.overflowDesc
+}
+
+// Collect 实现prometheus.Collector接口
+func (c *TaggedCollector) Collect(ch chan<- prometheus.Metric) {
+	keys := c.counter.Keys()
+	for _, series := range c.counter.Series(nil) {
+		values := make([]string, len(keys))
+		for i, key := range keys {
+			values[i] = series.Tags[key]
+		}
+		ch <- prometheus.MustNewConstMetric(c.qpsDesc, prometheus.GaugeValue, float64(series.QPS), values...)
+	}
+	ch <- prometheus.MustNewConstMetric(c.seriesDesc, prometheus.GaugeValue, float64(c.counter.SeriesCount()))
+	ch <- prometheus.MustNewConstMetric(c.overflowDesc, prometheus.CounterValue, float64(c.counter.Overflow()))
+}
@@ -0,0 +1,44 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/mant7s/qps-counter/internal/counter"
+)
+
+// TrendCollector 在抓取时导出QPS的变化率和加速度，告警规则可以按流量爬升的速度而不只是QPS的绝对值触发
+type TrendCollector struct {
+	trend            *counter.TrendTracker
+	derivativeDesc   *prometheus.Desc
+	accelerationDesc *prometheus.Desc
+}
+
+// NewTrendCollector 创建一个QPS趋势指标采集器
+func NewTrendCollector(tt *counter.TrendTracker) *TrendCollector {
+	return &TrendCollector{
+		trend: tt,
+		derivativeDesc: prometheus.NewDesc(
+			"qps_counter_qps_derivative",
+			"平滑QPS的变化率（QPS/秒）",
+			nil, nil,
+		),
+		accelerationDesc: prometheus.NewDesc(
+			"qps_counter_qps_acceleration",
+			"最近采样的原始QPS的加速度（请求数/秒²）",
+			nil, nil,
+		),
+	}
+}
+
+// Describe 实现prometheus.Collector接口
+func (c *TrendCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.derivativeDesc
+	ch <- c.accelerationDesc
+}
+
+// Collect 实现prometheus.Collector接口
+func (c *TrendCollector) Collect(ch chan<- prometheus.Metric) {
+	trend := c.trend.Trend()
+	ch <- prometheus.MustNewConstMetric(c.derivativeDesc, prometheus.GaugeValue, trend.Derivative)
+	ch <- prometheus.MustNewConstMetric(c.accelerationDesc, prometheus.GaugeValue, trend.Acceleration)
+}
@@ -0,0 +1,35 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/mant7s/qps-counter/internal/counter"
+)
+
+// WeightedCollector 在抓取时导出与QPS并行的加权速率，单位由counter.weighted.unit指定
+type WeightedCollector struct {
+	weighted *counter.WeightedWindow
+	rateDesc *prometheus.Desc
+}
+
+// NewWeightedCollector 创建一个加权速率指标采集器
+func NewWeightedCollector(w *counter.WeightedWindow) *WeightedCollector {
+	return &WeightedCollector{
+		weighted: w,
+		rateDesc: prometheus.NewDesc(
+			"qps_counter_weighted_rate",
+			"窗口内上报的weight之和换算的每秒速率",
+			[]string{"unit"}, nil,
+		),
+	}
+}
+
+// Describe 实现prometheus.Collector接口
+func (c *WeightedCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.rateDesc
+}
+
+// Collect 实现prometheus.Collector接口
+func (c *WeightedCollector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(c.rateDesc, prometheus.GaugeValue, c.weighted.Rate(), c.weighted.Unit())
+}
@@ -0,0 +1,80 @@
+package outbound
+
+import (
+	"sync"
+	"time"
+)
+
+// 熔断器状态
+const (
+	StateClosed   = "closed"    // 正常放行
+	StateOpen     = "open"      // 熔断中，请求直接失败
+	StateHalfOpen = "half_open" // 熔断超时后放行一个探测请求
+)
+
+// breaker 一个目标地址的熔断器，连续失败达到阈值后熔断，
+// 经过openTimeout后放行一个探测请求，探测成功时恢复，失败时重新熔断
+type breaker struct {
+	threshold   int
+	openTimeout time.Duration
+
+	mu       sync.Mutex
+	state    string
+	failures int // 连续失败次数
+	openedAt time.Time
+	probing  bool // 半开状态下是否已有探测请求
+}
+
+func newBreaker(threshold int, openTimeout time.Duration) *breaker {
+	return &breaker{threshold: threshold, openTimeout: openTimeout, state: StateClosed}
+}
+
+// allow 返回是否放行请求
+func (b *breaker) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateOpen:
+		if now.Sub(b.openedAt) < b.openTimeout {
+			return false
+		}
+		b.state = StateHalfOpen
+		b.probing = true
+		return true
+	case StateHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// record 记录一次请求的结果，返回熔断器状态是否发生变化
+func (b *breaker) record(ok bool, now time.Time) (string, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	previous := b.state
+	if ok {
+		b.state = StateClosed
+		b.failures = 0
+	} else {
+		b.failures++
+		if b.state == StateHalfOpen || b.failures >= b.threshold {
+			b.state = StateOpen
+			b.openedAt = now
+		}
+	}
+	b.probing = false
+	return b.state, b.state != previous
+}
+
+func (b *breaker) current() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
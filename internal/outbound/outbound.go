@@ -0,0 +1,254 @@
+package outbound
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultMaxRetries       = 2
+	defaultBaseBackoff      = 100 * time.Millisecond
+	defaultMaxBackoff       = 2 * time.Second
+	defaultRetryBudget      = 0.2
+	defaultFailureThreshold = 5
+	defaultOpenTimeout      = 30 * time.Second
+
+	// budgetBurst 重试预算的上限，也是启动时可用的重试次数，避免低流量时一次失败就没有重试机会
+	budgetBurst = 10
+)
+
+// ErrCircuitOpen 目标地址已熔断，请求没有发出
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// Client 所有出站HTTP请求（事件Webhook、增量复制订阅）共用的客户端
+// 按目标地址（scheme://host）熔断，失败的请求按指数退避加随机抖动重试，重试次数受重试预算限制；
+// 同时按目标地址统计连接池的使用情况，用于排查告警投递慢和复制延迟
+type Client struct {
+	http             *http.Client
+	maxRetries       int
+	baseBackoff      time.Duration
+	maxBackoff       time.Duration
+	retryBudget      float64
+	failureThreshold int
+	openTimeout      time.Duration
+
+	mu           sync.Mutex
+	destinations map[string]*destination
+}
+
+// destination 一个目标地址的熔断器、重试预算和请求统计
+type destination struct {
+	breaker *breaker
+
+	budgetMu sync.Mutex
+	budget   float64 // 可用的重试次数，每个请求增加retryBudget，每次重试消耗1
+
+	successes atomic.Int64
+	failures  atomic.Int64
+	rejected  atomic.Int64 // 因熔断未发出的请求数
+	retries   atomic.Int64
+
+	pool poolStats
+}
+
+// Stats 一个目标地址的出站请求统计
+type Stats struct {
+	Destination string `json:"destination"`
+	State       string `json:"state"`
+	Successes   int64  `json:"successes"`
+	Failures    int64  `json:"failures"`
+	Rejected    int64  `json:"rejected"`
+	Retries     int64  `json:"retries"`
+
+	InFlight      int64         `json:"in_flight"`
+	OpenConns     int64         `json:"open_conns"`
+	IdleConns     int64         `json:"idle_conns"`
+	NewConns      int64         `json:"new_conns"`
+	ReusedConns   int64         `json:"reused_conns"`
+	DNSLookups    int64         `json:"dns_lookups"`
+	DNSTime       time.Duration `json:"dns_time"` // DNS解析的累计耗时
+	TLSHandshakes int64         `json:"tls_handshakes"`
+	TLSFailures   int64         `json:"tls_failures"`
+	TLSTime       time.Duration `json:"tls_time"` // TLS握手的累计耗时
+}
+
+// NewClient 创建出站客户端，未配置的参数使用默认值
+// 客户端本身不设置超时，调用方通过请求的context控制超时，长连接（如增量流）不受影响
+func NewClient(cfg config.OutboundConfig) *Client {
+	c := &Client{
+		http:             &http.Client{Transport: newTransport()},
+		maxRetries:       cfg.MaxRetries,
+		baseBackoff:      cfg.BaseBackoff,
+		maxBackoff:       cfg.MaxBackoff,
+		retryBudget:      cfg.RetryBudget,
+		failureThreshold: cfg.FailureThreshold,
+		openTimeout:      cfg.OpenTimeout,
+		destinations:     make(map[string]*destination),
+	}
+	switch {
+	case c.maxRetries == 0:
+		c.maxRetries = defaultMaxRetries
+	case c.maxRetries < 0:
+		c.maxRetries = 0
+	}
+	if c.baseBackoff <= 0 {
+		c.baseBackoff = defaultBaseBackoff
+	}
+	if c.maxBackoff <= 0 {
+		c.maxBackoff = defaultMaxBackoff
+	}
+	if c.retryBudget <= 0 {
+		c.retryBudget = defaultRetryBudget
+	}
+	if c.failureThreshold <= 0 {
+		c.failureThreshold = defaultFailureThreshold
+	}
+	if c.openTimeout <= 0 {
+		c.openTimeout = defaultOpenTimeout
+	}
+	return c
+}
+
+// Do 发送请求，网络错误、5xx和429视为失败并按配置重试
+// 请求体不可重放（没有GetBody）时不重试；重试耗尽后返回最后一次的响应或错误，由调用方处理
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	name := destinationOf(req.URL)
+	d := c.destination(name)
+	d.deposit(c.retryBudget)
+	req = d.pool.trace(req)
+
+	for attempt := 0; ; attempt++ {
+		if !d.breaker.allow(time.Now()) {
+			d.rejected.Add(1)
+			return nil, fmt.Errorf("%s: %w", name, ErrCircuitOpen)
+		}
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+
+		d.pool.inFlight.Add(1)
+		resp, err := c.http.Do(req)
+		d.pool.inFlight.Add(-1)
+		failed := err != nil || resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests
+		if state, changed := d.breaker.record(!failed, time.Now()); changed {
+			logger.Warn("出站请求熔断器状态变化", zap.String("destination", name), zap.String("state", state))
+		}
+		if !failed {
+			d.successes.Add(1)
+			return resp, nil
+		}
+
+		if attempt >= c.maxRetries || !replayable(req) || req.Context().Err() != nil || !d.withdraw() {
+			d.failures.Add(1)
+			return resp, err
+		}
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		d.retries.Add(1)
+
+		select {
+		case <-time.After(c.backoff(attempt)):
+		case <-req.Context().Done():
+			d.failures.Add(1)
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+// backoff 第attempt次重试前的等待时间：指数增长并在[d/2, d)内随机抖动，避免多个实例同时重试
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.baseBackoff << attempt
+	if d <= 0 || d > c.maxBackoff {
+		d = c.maxBackoff
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+func (c *Client) destination(name string) *destination {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	d, ok := c.destinations[name]
+	if !ok {
+		d = &destination{breaker: newBreaker(c.failureThreshold, c.openTimeout), budget: budgetBurst}
+		c.destinations[name] = d
+	}
+	return d
+}
+
+// Stats 返回各目标地址的请求统计，按地址排序
+func (c *Client) Stats() []Stats {
+	c.mu.Lock()
+	stats := make([]Stats, 0, len(c.destinations))
+	for name, d := range c.destinations {
+		stats = append(stats, Stats{
+			Destination: name,
+			State:       d.breaker.current(),
+			Successes:   d.successes.Load(),
+			Failures:    d.failures.Load(),
+			Rejected:    d.rejected.Load(),
+			Retries:     d.retries.Load(),
+
+			InFlight:      d.pool.inFlight.Load(),
+			OpenConns:     d.pool.open.Load(),
+			IdleConns:     d.pool.idle.Load(),
+			NewConns:      d.pool.newConns.Load(),
+			ReusedConns:   d.pool.reusedConns.Load(),
+			DNSLookups:    d.pool.dnsLookups.Load(),
+			DNSTime:       time.Duration(d.pool.dnsNanos.Load()),
+			TLSHandshakes: d.pool.tlsHandshakes.Load(),
+			TLSFailures:   d.pool.tlsFailures.Load(),
+			TLSTime:       time.Duration(d.pool.tlsNanos.Load()),
+		})
+	}
+	c.mu.Unlock()
+
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Destination < stats[j].Destination })
+	return stats
+}
+
+// deposit 每个请求增加ratio次重试机会，不超过budgetBurst
+func (d *destination) deposit(ratio float64) {
+	d.budgetMu.Lock()
+	d.budget = min(d.budget+ratio, budgetBurst)
+	d.budgetMu.Unlock()
+}
+
+// withdraw 消耗一次重试机会，预算不足时返回false
+func (d *destination) withdraw() bool {
+	d.budgetMu.Lock()
+	defer d.budgetMu.Unlock()
+	if d.budget < 1 {
+		return false
+	}
+	d.budget--
+	return true
+}
+
+// replayable 请求没有请求体或请求体可以重放时才能重试
+func replayable(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// destinationOf 返回目标地址，熔断和统计按该地址区分
+func destinationOf(u *url.URL) string {
+	return u.Scheme + "://" + u.Host
+}
@@ -0,0 +1,119 @@
+package outbound
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// destinationKey 请求context中的目标地址，拨号时据此把新连接计入目标地址的连接池统计
+type destinationKey struct{}
+
+// poolStats 一个目标地址的连接池统计
+// 空闲连接数由httptrace的GotConn/PutIdleConn和连接关闭共同维护，连接池因超时或超出上限关闭空闲连接时同样会扣减
+type poolStats struct {
+	inFlight    atomic.Int64 // 已发出、尚未收到响应头的请求数
+	open        atomic.Int64 // 当前打开的连接数
+	idle        atomic.Int64 // 当前在连接池中空闲的连接数
+	newConns    atomic.Int64 // 新建的连接数
+	reusedConns atomic.Int64 // 复用连接池中已有连接的请求数
+
+	dnsLookups    atomic.Int64
+	dnsNanos      atomic.Int64 // DNS解析的累计耗时
+	tlsHandshakes atomic.Int64
+	tlsFailures   atomic.Int64 // 握手失败的次数，同样计入tlsHandshakes
+	tlsNanos      atomic.Int64 // TLS握手的累计耗时
+}
+
+// trackedConn 记录打开和空闲状态的连接，关闭时从目标地址的连接数中扣除
+type trackedConn struct {
+	net.Conn
+	pool      *poolStats
+	idle      atomic.Bool
+	closeOnce sync.Once
+}
+
+func (c *trackedConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.pool.open.Add(-1)
+		if c.idle.Swap(false) {
+			c.pool.idle.Add(-1)
+		}
+	})
+	return c.Conn.Close()
+}
+
+// newTransport 创建出站请求的Transport，参数与http.DefaultTransport相同，拨号时记录连接数
+func newTransport() *http.Transport {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		pool, ok := ctx.Value(destinationKey{}).(*poolStats)
+		if !ok {
+			return conn, nil
+		}
+		pool.open.Add(1)
+		return &trackedConn{Conn: conn, pool: pool}, nil
+	}
+	return transport
+}
+
+// trace 返回附加了连接池统计的请求，同一个请求的各次重试共用返回的请求
+// 被取消的拨号可能在后台继续，回调可能与下一次重试并发执行，因此状态都用原子变量保存
+func (p *poolStats) trace(req *http.Request) *http.Request {
+	var conn atomic.Pointer[trackedConn]
+	var dnsStart, tlsStart atomic.Int64
+
+	ctx := context.WithValue(req.Context(), destinationKey{}, p)
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { dnsStart.Store(time.Now().UnixNano()) },
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			p.dnsLookups.Add(1)
+			p.dnsNanos.Add(time.Now().UnixNano() - dnsStart.Load())
+		},
+		TLSHandshakeStart: func() { tlsStart.Store(time.Now().UnixNano()) },
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			p.tlsHandshakes.Add(1)
+			p.tlsNanos.Add(time.Now().UnixNano() - tlsStart.Load())
+			if err != nil {
+				p.tlsFailures.Add(1)
+			}
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				p.reusedConns.Add(1)
+			} else {
+				p.newConns.Add(1)
+			}
+			c := unwrapConn(info.Conn)
+			conn.Store(c)
+			if c != nil && c.idle.Swap(false) {
+				p.idle.Add(-1)
+			}
+		},
+		PutIdleConn: func(err error) {
+			if c := conn.Load(); err == nil && c != nil && !c.idle.Swap(true) {
+				p.idle.Add(1)
+			}
+		},
+	})
+	return req.WithContext(ctx)
+}
+
+// unwrapConn 取出连接池中的连接对应的trackedConn，https连接被tls.Conn包装
+func unwrapConn(c net.Conn) *trackedConn {
+	if tlsConn, ok := c.(*tls.Conn); ok {
+		c = tlsConn.NetConn()
+	}
+	conn, _ := c.(*trackedConn)
+	return conn
+}
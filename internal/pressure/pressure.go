@@ -0,0 +1,162 @@
+package pressure
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// 压力数据的来源
+const (
+	SourceCgroup = "cgroup" // 当前进程所在cgroup v2的 cpu.pressure 等文件，容器内反映容器自身的压力
+	SourceHost   = "host"   // /proc/pressure 下的整机压力
+)
+
+// DefaultThreshold 判定资源紧张的默认阈值：最近10秒内有任务因该资源等待的时间比例（百分比）
+const DefaultThreshold = 20.0
+
+// PSI文件的位置
+const (
+	cgroupRoot = "/sys/fs/cgroup"
+	procCgroup = "/proc/self/cgroup"
+	procDir    = "/proc/pressure"
+)
+
+// Resource 一种资源的压力，单位为等待时间的百分比
+// some为至少一个任务在等待该资源，full为所有非空闲任务同时在等待（cpu在较早的内核上没有full）
+type Resource struct {
+	SomeAvg10 float64 `json:"some_avg10"`
+	SomeAvg60 float64 `json:"some_avg60"`
+	FullAvg10 float64 `json:"full_avg10"`
+	FullAvg60 float64 `json:"full_avg60"`
+}
+
+// Snapshot 一次读取的CPU、内存和IO压力
+// 内核未启用PSI或不是Linux时Available为false，各项均为0
+type Snapshot struct {
+	Available bool     `json:"available"`
+	Source    string   `json:"source"`
+	CPU       Resource `json:"cpu"`
+	Memory    Resource `json:"memory"`
+	IO        Resource `json:"io"`
+}
+
+// Read 读取当前进程的压力，优先使用所在cgroup的数据，不可用时使用整机数据
+func Read() Snapshot {
+	if dir, ok := cgroupDir(); ok {
+		if snapshot, err := ReadDir(dir); err == nil {
+			snapshot.Source = SourceCgroup
+			return snapshot
+		}
+	}
+
+	snapshot, err := readFiles(filepath.Join(procDir, "cpu"), filepath.Join(procDir, "memory"), filepath.Join(procDir, "io"))
+	if err != nil {
+		return Snapshot{}
+	}
+	snapshot.Source = SourceHost
+	return snapshot
+}
+
+// ReadDir 读取cgroup v2目录下的 cpu.pressure、memory.pressure 和 io.pressure
+func ReadDir(dir string) (Snapshot, error) {
+	return readFiles(filepath.Join(dir, "cpu.pressure"), filepath.Join(dir, "memory.pressure"), filepath.Join(dir, "io.pressure"))
+}
+
+func readFiles(cpu, memory, io string) (Snapshot, error) {
+	snapshot := Snapshot{Available: true}
+	for _, f := range []struct {
+		path     string
+		resource *Resource
+	}{{cpu, &snapshot.CPU}, {memory, &snapshot.Memory}, {io, &snapshot.IO}} {
+		resource, err := readResource(f.path)
+		if err != nil {
+			return Snapshot{}, err
+		}
+		*f.resource = resource
+	}
+	return snapshot, nil
+}
+
+// readResource 解析PSI文件，格式为：
+//
+//	some avg10=0.12 avg60=0.05 avg300=0.01 total=12345
+//	full avg10=0.00 avg60=0.00 avg300=0.00 total=0
+func readResource(path string) (Resource, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Resource{}, err
+	}
+	defer file.Close()
+
+	var resource Resource
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		var avg10, avg60 *float64
+		switch fields[0] {
+		case "some":
+			avg10, avg60 = &resource.SomeAvg10, &resource.SomeAvg60
+		case "full":
+			avg10, avg60 = &resource.FullAvg10, &resource.FullAvg60
+		default:
+			return Resource{}, fmt.Errorf("%s: 无法识别的压力类型 %q", path, fields[0])
+		}
+		for _, field := range fields[1:] {
+			key, value, ok := strings.Cut(field, "=")
+			if !ok || (key != "avg10" && key != "avg60") {
+				continue
+			}
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return Resource{}, fmt.Errorf("%s: 无效的%s %q", path, key, value)
+			}
+			if key == "avg10" {
+				*avg10 = parsed
+			} else {
+				*avg60 = parsed
+			}
+		}
+	}
+	return resource, scanner.Err()
+}
+
+// cgroupDir 返回当前进程所在的cgroup v2目录，只有v2的统一层级（0::路径）才提供PSI
+func cgroupDir() (string, bool) {
+	data, err := os.ReadFile(procCgroup)
+	if err != nil {
+		return "", false
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if path, ok := strings.CutPrefix(line, "0::"); ok {
+			return filepath.Join(cgroupRoot, path), true
+		}
+	}
+	return "", false
+}
+
+// Stalled 返回最近10秒内some等待比例超过threshold的资源名（cpu、memory、io）
+func (s Snapshot) Stalled(threshold float64) []string {
+	if !s.Available {
+		return nil
+	}
+
+	var stalled []string
+	if s.CPU.SomeAvg10 > threshold {
+		stalled = append(stalled, "cpu")
+	}
+	if s.Memory.SomeAvg10 > threshold {
+		stalled = append(stalled, "memory")
+	}
+	if s.IO.SomeAvg10 > threshold {
+		stalled = append(stalled, "io")
+	}
+	return stalled
+}
@@ -0,0 +1,204 @@
+package recovery
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"runtime/pprof"
+	"sync"
+	"time"
+
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/logger"
+	"go.uber.org/zap"
+)
+
+// restartDelay 后台协程发生panic后重新运行前的等待时间，避免持续panic时占满CPU
+const restartDelay = 100 * time.Millisecond
+
+var (
+	mu          sync.Mutex
+	cfg         config.RecoveryConfig
+	recent      []time.Time      // 最近一分钟内发生panic的时间
+	panics      map[string]int64 // 各组件发生panic的次数
+	dumps       int64            // 已写入的崩溃转储文件数
+	shutdown    chan struct{}
+	requestOnce *sync.Once
+)
+
+func init() {
+	Init(config.RecoveryConfig{})
+}
+
+// Init 设置panic处理配置，并清空之前记录的panic
+func Init(c config.RecoveryConfig) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	cfg = c
+	recent = nil
+	panics = make(map[string]int64)
+	dumps = 0
+	shutdown = make(chan struct{})
+	requestOnce = &sync.Once{}
+}
+
+// Recover 在defer中调用，恢复panic并记录，用于不需要重新运行的协程
+func Recover(component string) {
+	if r := recover(); r != nil {
+		Handle(component, r)
+	}
+}
+
+// Go 在新协程中运行fn，fn发生panic时记录并重新运行，fn正常返回时协程结束
+// wg不为nil时协程启动前调用wg.Add(1)，结束时调用wg.Done()
+func Go(component string, wg *sync.WaitGroup, fn func()) {
+	if wg != nil {
+		wg.Add(1)
+	}
+	go func() {
+		if wg != nil {
+			defer wg.Done()
+		}
+		for !run(component, fn) {
+			time.Sleep(restartDelay)
+		}
+	}()
+}
+
+// run 运行一次fn，返回fn是否正常返回
+func run(component string, fn func()) (ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			Handle(component, r)
+		}
+	}()
+	fn()
+	return true
+}
+
+// Handle 记录一次已恢复的panic：输出调用栈、累计次数、按配置写入崩溃转储，
+// 一分钟内的panic次数达到上限时请求受控关闭
+func Handle(component string, r interface{}) {
+	stack := debug.Stack()
+	now := time.Now()
+
+	mu.Lock()
+	panics[component]++
+	recent = append(recent, now)
+	for len(recent) > 0 && now.Sub(recent[0]) > time.Minute {
+		recent = recent[1:]
+	}
+	inLastMinute := len(recent)
+	c := cfg
+	mu.Unlock()
+
+	logger.Error("发生panic，已恢复",
+		zap.String("component", component),
+		zap.String("panic", fmt.Sprint(r)),
+		zap.ByteString("stack", stack),
+		zap.Int("panics_last_minute", inLastMinute))
+
+	if c.DumpDir != "" {
+		if path, err := writeDump(c.DumpDir, component, r, stack, now); err != nil {
+			logger.Error("写入崩溃转储失败", zap.String("component", component), zap.Error(err))
+		} else {
+			logger.Info("已写入崩溃转储", zap.String("component", component), zap.String("path", path))
+		}
+	}
+
+	if c.MaxPanicsPerMinute > 0 && inLastMinute >= c.MaxPanicsPerMinute {
+		requestShutdown(inLastMinute)
+	}
+}
+
+// writeDump 将panic信息、调用栈和所有协程的调用栈写入转储目录
+func writeDump(dir, component string, r interface{}, stack []byte, now time.Time) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("crash-%s-%s.txt", filepath.Base(component), now.Format("20060102T150405.000000000")))
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	fmt.Fprintf(f, "time: %s\ncomponent: %s\npanic: %v\n\n%s\n", now.Format(time.RFC3339Nano), component, r, stack)
+	fmt.Fprintln(f, "goroutines:")
+	if err := pprof.Lookup("goroutine").WriteTo(f, 2); err != nil {
+		return "", err
+	}
+
+	mu.Lock()
+	dumps++
+	mu.Unlock()
+	return path, nil
+}
+
+func requestShutdown(inLastMinute int) {
+	mu.Lock()
+	once, ch := requestOnce, shutdown
+	mu.Unlock()
+
+	once.Do(func() {
+		logger.Error("一分钟内panic次数达到上限，开始关闭服务", zap.Int("panics_last_minute", inLastMinute))
+		close(ch)
+	})
+}
+
+// ShutdownRequested 返回一个通道，panic次数达到上限时关闭
+func ShutdownRequested() <-chan struct{} {
+	mu.Lock()
+	defer mu.Unlock()
+	return shutdown
+}
+
+// Panics 返回各组件发生panic的次数
+func Panics() map[string]int64 {
+	mu.Lock()
+	defer mu.Unlock()
+
+	counts := make(map[string]int64, len(panics))
+	for component, n := range panics {
+		counts[component] = n
+	}
+	return counts
+}
+
+// GetStats 获取panic处理状态
+func GetStats() map[string]interface{} {
+	counts := Panics()
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	var total int64
+	for _, n := range counts {
+		total += n
+	}
+	now := time.Now()
+	inLastMinute := 0
+	for _, t := range recent {
+		if now.Sub(t) <= time.Minute {
+			inLastMinute++
+		}
+	}
+
+	shutdownRequested := false
+	select {
+	case <-shutdown:
+		shutdownRequested = true
+	default:
+	}
+
+	return map[string]interface{}{
+		"total":              total,
+		"components":         counts,
+		"last_minute":        inLastMinute,
+		"max_per_minute":     cfg.MaxPanicsPerMinute,
+		"dumps":              dumps,
+		"shutdown_requested": shutdownRequested,
+	}
+}
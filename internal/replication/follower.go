@@ -0,0 +1,191 @@
+package replication
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/counter"
+	"github.com/mant7s/qps-counter/internal/logger"
+	"github.com/mant7s/qps-counter/internal/outbound"
+	"github.com/mant7s/qps-counter/internal/workers"
+	"go.uber.org/zap"
+)
+
+// StreamPath 上报节点提供增量流的路径，需要管理员令牌
+const StreamPath = "/admin/replication/stream"
+
+const (
+	retryInterval = time.Second
+	// idleTimeout 超过该时间没有收到增量（包括心跳）时认为连接已失效并重连
+	idleTimeout = 10 * time.Second
+)
+
+// leader 一个被订阅的上报节点
+type leader struct {
+	url       string
+	epoch     atomic.Int64
+	seq       atomic.Uint64
+	connected atomic.Bool
+	received  atomic.Int64 // 已收到的增量数
+	gaps      atomic.Int64 // 因发布者丢弃或重连超出补发范围而缺失的增量数
+	worker    *workers.Worker
+}
+
+// Follower 订阅上报节点的增量流并写入本地计数器，用于query角色的只读副本
+// 断线后自动重连，并从上次收到的序号继续，发布者缓冲内的增量不会丢失
+type Follower struct {
+	target  counter.Counter
+	token   string
+	client  *outbound.Client
+	leaders []*leader
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// NewFollower 创建订阅者并为每个上报节点启动订阅协程
+// leaders为上报节点的地址，如 http://ingest-0:8080；client为nil时使用默认配置的出站客户端
+func NewFollower(target counter.Counter, leaders []string, token string, client *outbound.Client) *Follower {
+	if client == nil {
+		client = outbound.NewClient(config.OutboundConfig{})
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	f := &Follower{
+		target: target,
+		token:  token,
+		client: client,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	for _, addr := range leaders {
+		l := &leader{url: strings.TrimSuffix(addr, "/")}
+		f.leaders = append(f.leaders, l)
+		l.worker = workers.Register("replication.follower", 0)
+		l.worker.Go(&f.wg, func() { f.follow(l) })
+	}
+	return f
+}
+
+// follow 持续订阅一个上报节点，连接断开后等待retryInterval重连
+func (f *Follower) follow(l *leader) {
+	for {
+		err := f.stream(l)
+		if f.ctx.Err() != nil {
+			return
+		}
+		l.worker.Fail(err)
+		logger.Warn("增量流连接断开，稍后重连", zap.String("leader", l.url), zap.Error(err))
+
+		select {
+		case <-time.After(retryInterval):
+		case <-f.ctx.Done():
+			return
+		}
+	}
+}
+
+func (f *Follower) stream(l *leader) error {
+	ctx, cancel := context.WithCancel(f.ctx)
+	defer cancel()
+	watchdog := time.AfterFunc(idleTimeout, cancel)
+	defer watchdog.Stop()
+
+	query := url.Values{}
+	query.Set("epoch", strconv.FormatInt(l.epoch.Load(), 10))
+	query.Set("after", strconv.FormatUint(l.seq.Load(), 10))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, l.url+StreamPath+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+f.token)
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	l.connected.Store(true)
+	defer l.connected.Store(false)
+	logger.Info("已订阅增量流", zap.String("leader", l.url))
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var d Delta
+		if err := decoder.Decode(&d); err != nil {
+			return err
+		}
+		watchdog.Reset(idleTimeout)
+		f.apply(l, d)
+		l.worker.Ran()
+	}
+}
+
+// apply 将一个增量写入本地计数器，忽略重复的增量并记录缺失的增量
+func (f *Follower) apply(l *leader, d Delta) {
+	if d.Epoch != l.epoch.Load() {
+		// 首次连接或上报节点已重启，从新的序号开始
+		l.epoch.Store(d.Epoch)
+		l.seq.Store(0)
+	}
+
+	last := l.seq.Load()
+	if d.Seq <= last {
+		return
+	}
+	if last > 0 && d.Seq > last+1 {
+		missing := int64(d.Seq - last - 1)
+		l.gaps.Add(missing)
+		logger.Warn("增量流存在缺失", zap.String("leader", l.url), zap.Int64("missing", missing))
+	}
+	l.seq.Store(d.Seq)
+	l.received.Add(1)
+
+	if d.Count > 0 {
+		f.target.Add(d.Count)
+	}
+}
+
+// GetStats 获取各上报节点的订阅状态
+func (f *Follower) GetStats() map[string]interface{} {
+	leaders := make([]map[string]interface{}, 0, len(f.leaders))
+	for _, l := range f.leaders {
+		leaders = append(leaders, map[string]interface{}{
+			"url":       l.url,
+			"connected": l.connected.Load(),
+			"epoch":     l.epoch.Load(),
+			"seq":       l.seq.Load(),
+			"received":  l.received.Load(),
+			"gaps":      l.gaps.Load(),
+		})
+	}
+	return map[string]interface{}{"leaders": leaders}
+}
+
+// Connected 返回已连接的上报节点数和上报节点总数
+func (f *Follower) Connected() (connected, total int) {
+	for _, l := range f.leaders {
+		if l.connected.Load() {
+			connected++
+		}
+	}
+	return connected, len(f.leaders)
+}
+
+// Stop 断开所有订阅并等待订阅协程退出
+func (f *Follower) Stop() {
+	f.cancel()
+	f.wg.Wait()
+}
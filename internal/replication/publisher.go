@@ -0,0 +1,245 @@
+package replication
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mant7s/qps-counter/internal/counter"
+	"github.com/mant7s/qps-counter/internal/workers"
+)
+
+// ContentType 增量流的响应类型，每行一个JSON编码的Delta
+const ContentType = "application/x-ndjson"
+
+const (
+	// replayBufferSize 保留最近的增量数，订阅者断线重连后从中补发错过的增量
+	replayBufferSize = 1024
+	// subscriberBuffer 每个订阅者的发送缓冲，写满时丢弃新的增量
+	subscriberBuffer = replayBufferSize
+)
+
+// Delta 一个汇总间隔内写入全局计数器的增量
+// Epoch为发布者的启动时间，发布者重启后Seq从1重新开始
+type Delta struct {
+	Epoch     int64  `json:"epoch"`
+	Seq       uint64 `json:"seq"`
+	Timestamp int64  `json:"timestamp"` // 汇总间隔的结束时间（Unix毫秒）
+	Count     int64  `json:"count"`
+}
+
+// Publisher 包装上报路径使用的计数器，按固定间隔汇总写入的增量并推送给所有订阅的只读副本
+// 间隔内没有写入时同样推送计数为0的增量，作为订阅者判断连接是否存活的心跳
+type Publisher struct {
+	counter.Counter
+	pending     atomic.Int64
+	epoch       int64
+	interval    time.Duration
+	mu          sync.Mutex
+	seq         uint64
+	replay      []Delta // 环形缓冲，最近的replayBufferSize个增量
+	subscribers map[chan Delta]struct{}
+	dropped     atomic.Int64 // 因订阅者消费过慢被丢弃的增量数
+	worker      *workers.Worker
+	stopChan    chan struct{}
+	stopOnce    sync.Once
+	wg          sync.WaitGroup
+}
+
+// NewPublisher 创建增量发布者并启动汇总协程，interval为汇总间隔
+func NewPublisher(c counter.Counter, interval time.Duration) *Publisher {
+	if interval <= 0 {
+		interval = 100 * time.Millisecond
+	}
+	p := &Publisher{
+		Counter:     c,
+		epoch:       time.Now().UnixNano(),
+		interval:    interval,
+		replay:      make([]Delta, 0, replayBufferSize),
+		subscribers: make(map[chan Delta]struct{}),
+		stopChan:    make(chan struct{}),
+	}
+
+	p.worker = workers.Register("replication.publisher", interval)
+	p.worker.Go(&p.wg, p.publishWorker)
+	return p
+}
+
+// Incr 增加一个计数单位
+func (p *Publisher) Incr() {
+	p.Add(1)
+}
+
+// Add 写入计数器并累计到当前间隔的增量中
+func (p *Publisher) Add(n int64) {
+	p.Counter.Add(n)
+	p.pending.Add(n)
+}
+
+// AddAt 在时间戳ts所在的槽位上写入计数器，写入时累计到当前间隔的增量中
+// 只读副本按增量到达的时间计数，不区分事件时间
+func (p *Publisher) AddAt(n int64, ts int64) bool {
+	if !counter.AddAt(p.Counter, n, ts) {
+		return false
+	}
+	p.pending.Add(n)
+	return true
+}
+
+// Reset 清空被包装的计数器并丢弃尚未发布的增量，只读副本上已同步的计数随窗口滑动自然过期
+func (p *Publisher) Reset() {
+	p.Counter.Reset()
+	p.pending.Store(0)
+}
+
+// CurrentRate 返回被包装计数器当前的每秒速率
+func (p *Publisher) CurrentRate() float64 {
+	return counter.RateOf(p.Counter)
+}
+
+// Unit 返回被包装计数器的计数单位
+func (p *Publisher) Unit() string {
+	return counter.UnitOf(p.Counter)
+}
+
+// Windows 返回被包装计数器附加窗口的QPS
+func (p *Publisher) Windows() []counter.WindowQPS {
+	return counter.WindowsOf(p.Counter)
+}
+
+// IdleDetector 返回被包装计数器的空闲检测器
+func (p *Publisher) IdleDetector() *counter.IdleDetector {
+	return counter.IdleDetectorOf(p.Counter)
+}
+
+// Verifier 返回被包装计数器的计数校验
+func (p *Publisher) Verifier() *counter.Verifier {
+	return counter.VerifierOf(p.Counter)
+}
+
+// Clock 返回被包装计数器的时间源
+func (p *Publisher) Clock() counter.Clock {
+	return counter.ClockOf(p.Counter)
+}
+
+// SlotInfo 返回被包装计数器当前写入的槽位
+func (p *Publisher) SlotInfo(now int64) map[string]interface{} {
+	if aware, ok := p.Counter.(interface {
+		SlotInfo(now int64) map[string]interface{}
+	}); ok {
+		return aware.SlotInfo(now)
+	}
+	return nil
+}
+
+// Epoch 返回发布者的启动时间
+func (p *Publisher) Epoch() int64 {
+	return p.epoch
+}
+
+// Subscribe 订阅增量流，返回增量通道和取消订阅的函数
+// epoch与当前发布者一致时，先补发缓冲中序号大于after的增量
+func (p *Publisher) Subscribe(epoch int64, after uint64) (<-chan Delta, func()) {
+	ch := make(chan Delta, subscriberBuffer)
+
+	p.mu.Lock()
+	if epoch == p.epoch && after > 0 {
+		for _, d := range p.replay {
+			if d.Seq > after {
+				ch <- d
+			}
+		}
+	}
+	p.subscribers[ch] = struct{}{}
+	p.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			p.mu.Lock()
+			if _, ok := p.subscribers[ch]; ok {
+				delete(p.subscribers, ch)
+				close(ch)
+			}
+			p.mu.Unlock()
+		})
+	}
+}
+
+func (p *Publisher) publishWorker() {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			p.publish(now)
+			p.worker.Ran()
+		case <-p.stopChan:
+			p.publish(time.Now())
+			return
+		}
+	}
+}
+
+// publish 将当前间隔的增量推送给所有订阅者
+func (p *Publisher) publish(now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.seq++
+	d := Delta{Epoch: p.epoch, Seq: p.seq, Timestamp: now.UnixMilli(), Count: p.pending.Swap(0)}
+
+	if len(p.replay) < replayBufferSize {
+		p.replay = append(p.replay, d)
+	} else {
+		copy(p.replay, p.replay[1:])
+		p.replay[len(p.replay)-1] = d
+	}
+
+	for ch := range p.subscribers {
+		select {
+		case ch <- d:
+		default:
+			p.dropped.Add(1)
+		}
+	}
+}
+
+// PublisherStats 发布者状态
+type PublisherStats struct {
+	Epoch       int64  `json:"epoch"`
+	Seq         uint64 `json:"seq"`
+	Interval    string `json:"interval"`
+	Subscribers int    `json:"subscribers"`
+	Dropped     int64  `json:"dropped"`
+}
+
+// GetStats 获取发布者状态，Stats为被包装的计数器的状态
+func (p *Publisher) GetStats() PublisherStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return PublisherStats{
+		Epoch:       p.epoch,
+		Seq:         p.seq,
+		Interval:    p.interval.String(),
+		Subscribers: len(p.subscribers),
+		Dropped:     p.dropped.Load(),
+	}
+}
+
+// Stop 推送最后一个增量后关闭所有订阅，不会停止被包装的计数器
+func (p *Publisher) Stop() {
+	p.stopOnce.Do(func() {
+		close(p.stopChan)
+	})
+	p.wg.Wait()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for ch := range p.subscribers {
+		delete(p.subscribers, ch)
+		close(ch)
+	}
+}
@@ -0,0 +1,405 @@
+package report
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/counter"
+	"github.com/mant7s/qps-counter/internal/events"
+	"github.com/mant7s/qps-counter/internal/limiter"
+	"github.com/mant7s/qps-counter/internal/logger"
+	"github.com/mant7s/qps-counter/internal/outbound"
+	"github.com/mant7s/qps-counter/internal/workers"
+	"go.uber.org/zap"
+)
+
+// 报告周期
+const (
+	PeriodDaily  = "daily"
+	PeriodWeekly = "weekly"
+)
+
+const (
+	defaultSampleInterval = 10 * time.Second
+	defaultTopKeys        = 10
+	defaultTimeout        = 10 * time.Second
+
+	// maxAnomalies 一份报告最多记录的异常事件数，超出的只计数
+	maxAnomalies = 100
+)
+
+// Report 一个周期的流量报告
+type Report struct {
+	Period          string     `json:"period"`
+	From            time.Time  `json:"from"`
+	To              time.Time  `json:"to"`
+	Samples         int        `json:"samples"`
+	PeakQPS         int64      `json:"peak_qps"`
+	PeakAt          *time.Time `json:"peak_at,omitempty"`
+	AvgQPS          float64    `json:"avg_qps"`
+	P99QPS          int64      `json:"p99_qps"`
+	BusiestKeys     []KeyStat  `json:"busiest_keys"`
+	LimiterRejected int64      `json:"limiter_rejected"`
+	LimiterTotal    int64      `json:"limiter_total"`
+	Anomalies       []Anomaly  `json:"anomalies"`
+	AnomaliesLost   int64      `json:"anomalies_dropped,omitempty"`
+	Text            string     `json:"text"` // 便于阅读的摘要，可以直接作为邮件正文
+}
+
+// KeyStat 一个标签组合在报告周期内的估算事件数
+type KeyStat struct {
+	Key    string            `json:"key"` // 按标签名排序的 name=value 列表
+	Tags   map[string]string `json:"tags"`
+	Events int64             `json:"events"`
+}
+
+// Anomaly 报告周期内发生的流量突增、阈值跨越等事件
+type Anomaly struct {
+	Type string                 `json:"type"`
+	Time time.Time              `json:"time"`
+	Data map[string]interface{} `json:"data,omitempty"`
+}
+
+// keyTotal 一个标签组合的累计值
+type keyTotal struct {
+	tags   map[string]string
+	events float64
+}
+
+// Reporter 按固定间隔采样QPS和标签组合，在每天或每周的指定时间生成流量报告并投递
+// 同时作为事件钩子记录突增和阈值跨越事件，未启用事件钩子时报告中没有异常事件
+type Reporter struct {
+	counter  counter.Counter
+	tagged   *counter.TaggedCounter // 可以为nil
+	limiter  *limiter.RateLimiter
+	client   *outbound.Client
+	webhooks []string
+	timeout  time.Duration
+
+	period         string
+	at             int // 从零点开始的分钟数
+	weekday        time.Weekday
+	sampleInterval time.Duration
+	topKeys        int
+
+	worker   *workers.Worker
+	stopChan chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+
+	mu            sync.Mutex
+	from          time.Time
+	samples       []int64
+	peak          int64
+	peakAt        time.Time
+	keys          map[string]*keyTotal
+	startRejected int64
+	startTotal    int64
+	anomalies     []Anomaly
+	anomaliesLost int64
+	latest        *Report
+}
+
+// NewReporter 创建流量报告生成器并启动采样协程，client为nil时使用默认配置的出站客户端
+// 配置已通过校验，无效的时间和星期按默认值处理
+func NewReporter(cfg config.ReportConfig, c counter.Counter, tagged *counter.TaggedCounter, rl *limiter.RateLimiter, client *outbound.Client) *Reporter {
+	r := &Reporter{
+		counter:        c,
+		tagged:         tagged,
+		limiter:        rl,
+		client:         client,
+		webhooks:       cfg.Webhooks,
+		timeout:        cfg.Timeout,
+		period:         cfg.Period,
+		weekday:        time.Monday,
+		sampleInterval: cfg.SampleInterval,
+		topKeys:        cfg.TopKeys,
+		stopChan:       make(chan struct{}),
+	}
+	if r.client == nil {
+		r.client = outbound.NewClient(config.OutboundConfig{})
+	}
+	if r.timeout <= 0 {
+		r.timeout = defaultTimeout
+	}
+	if r.period != PeriodWeekly {
+		r.period = PeriodDaily
+	}
+	if cfg.At != "" {
+		r.at, _ = config.ParseClock(cfg.At)
+	}
+	if day, ok := config.Weekdays[cfg.Weekday]; ok {
+		r.weekday = day
+	}
+	if r.sampleInterval <= 0 {
+		r.sampleInterval = defaultSampleInterval
+	}
+	if r.topKeys <= 0 {
+		r.topKeys = defaultTopKeys
+	}
+	r.reset(time.Now())
+
+	r.worker = workers.Register("report.generate", r.sampleInterval)
+	r.worker.Go(&r.wg, r.run)
+	return r
+}
+
+func (r *Reporter) run() {
+	ticker := time.NewTicker(r.sampleInterval)
+	defer ticker.Stop()
+	due := r.NextDue(time.Now())
+
+	for {
+		select {
+		case now := <-ticker.C:
+			r.Sample(now)
+			if !now.Before(due) {
+				r.Deliver(r.Generate(now))
+				due = r.NextDue(now)
+			}
+			r.worker.Ran()
+		case <-r.stopChan:
+			return
+		}
+	}
+}
+
+// NextDue 返回after之后下一次生成报告的时间
+func (r *Reporter) NextDue(after time.Time) time.Time {
+	y, m, d := after.Date()
+	due := time.Date(y, m, d, r.at/60, r.at%60, 0, 0, after.Location())
+	if r.period == PeriodWeekly {
+		due = due.AddDate(0, 0, (int(r.weekday)-int(due.Weekday())+7)%7)
+		if !due.After(after) {
+			due = due.AddDate(0, 0, 7)
+		}
+		return due
+	}
+	if !due.After(after) {
+		due = due.AddDate(0, 0, 1)
+	}
+	return due
+}
+
+// Sample 记录一次QPS和各标签组合的采样，标签组合的事件数按QPS乘以采样间隔估算
+func (r *Reporter) Sample(now time.Time) {
+	qps := r.counter.CurrentQPS()
+	var series []counter.TaggedSeries
+	if r.tagged != nil {
+		series = r.tagged.Series(nil)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.samples = append(r.samples, qps)
+	if qps > r.peak || r.peakAt.IsZero() {
+		r.peak, r.peakAt = qps, now
+	}
+	for _, s := range series {
+		if s.QPS == 0 {
+			continue
+		}
+		key := tagKey(s.Tags)
+		total, ok := r.keys[key]
+		if !ok {
+			total = &keyTotal{tags: s.Tags}
+			r.keys[key] = total
+		}
+		total.events += float64(s.QPS) * r.sampleInterval.Seconds()
+	}
+}
+
+// Handle 实现events.Hook接口，记录突增和阈值跨越事件
+func (r *Reporter) Handle(event events.Event) {
+	if event.Type != events.EventBurstStarted && event.Type != events.EventThresholdCrossed {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.anomalies) >= maxAnomalies {
+		r.anomaliesLost++
+		return
+	}
+	r.anomalies = append(r.anomalies, Anomaly{Type: event.Type, Time: event.Time, Data: event.Data})
+}
+
+// Generate 生成从上一份报告到now的报告，保存为最新的报告并开始新的周期
+func (r *Reporter) Generate(now time.Time) Report {
+	rejected, total := r.limiter.Counts()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	report := Report{
+		Period:          r.period,
+		From:            r.from,
+		To:              now,
+		Samples:         len(r.samples),
+		BusiestKeys:     r.busiestKeys(),
+		LimiterRejected: rejected - r.startRejected,
+		LimiterTotal:    total - r.startTotal,
+		Anomalies:       r.anomalies,
+		AnomaliesLost:   r.anomaliesLost,
+	}
+	if report.Anomalies == nil {
+		report.Anomalies = []Anomaly{}
+	}
+	if len(r.samples) > 0 {
+		peakAt := r.peakAt
+		report.PeakQPS, report.PeakAt = r.peak, &peakAt
+
+		sorted := append([]int64(nil), r.samples...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		var sum int64
+		for _, qps := range sorted {
+			sum += qps
+		}
+		report.AvgQPS = float64(sum*100/int64(len(sorted))) / 100
+		report.P99QPS = sorted[(len(sorted)*99+99)/100-1]
+	}
+	report.Text = report.summary()
+
+	r.latest = &report
+	r.reset(now)
+	r.startRejected, r.startTotal = rejected, total
+	return report
+}
+
+// reset 开始新的报告周期，调用方持有锁或尚未启动采样协程
+func (r *Reporter) reset(now time.Time) {
+	r.from = now
+	r.samples = nil
+	r.peak, r.peakAt = 0, time.Time{}
+	r.keys = make(map[string]*keyTotal)
+	r.anomalies = nil
+	r.anomaliesLost = 0
+	r.startRejected, r.startTotal = r.limiter.Counts()
+}
+
+// busiestKeys 返回估算事件数最多的标签组合，调用方持有锁
+func (r *Reporter) busiestKeys() []KeyStat {
+	stats := make([]KeyStat, 0, len(r.keys))
+	for key, total := range r.keys {
+		stats = append(stats, KeyStat{Key: key, Tags: total.tags, Events: int64(total.events)})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Events != stats[j].Events {
+			return stats[i].Events > stats[j].Events
+		}
+		return stats[i].Key < stats[j].Key
+	})
+	if len(stats) > r.topKeys {
+		stats = stats[:r.topKeys]
+	}
+	return stats
+}
+
+// Latest 返回最近一份报告，尚未生成报告时返回nil
+func (r *Reporter) Latest() *Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.latest
+}
+
+// Deliver 将报告POST到所有配置的地址，失败时只记录日志
+func (r *Reporter) Deliver(report Report) {
+	body, err := json.Marshal(report)
+	if err != nil {
+		logger.Error("序列化流量报告失败", zap.Error(err))
+		return
+	}
+
+	for _, url := range r.webhooks {
+		if err := r.post(url, body); err != nil {
+			logger.Warn("流量报告投递失败", zap.String("url", url), zap.Error(err))
+			r.worker.Fail(err)
+		}
+	}
+}
+
+func (r *Reporter) post(url string, body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post report: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Stop 停止采样协程，不生成未完成周期的报告
+func (r *Reporter) Stop() {
+	r.stopOnce.Do(func() {
+		close(r.stopChan)
+	})
+	r.wg.Wait()
+}
+
+// tagKey 返回按标签名排序的 name=value 列表
+func tagKey(tags map[string]string) string {
+	names := make([]string, 0, len(tags))
+	for name := range tags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + "=" + tags[name]
+	}
+	return strings.Join(pairs, ",")
+}
+
+// summary 生成便于阅读的报告摘要
+func (report Report) summary() string {
+	const layout = "2006-01-02 15:04"
+	title := "QPS日报"
+	if report.Period == PeriodWeekly {
+		title = "QPS周报"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s 至 %s\n", title, report.From.Format(layout), report.To.Format(layout))
+	if report.Samples == 0 {
+		b.WriteString("本周期没有采样数据\n")
+	} else {
+		fmt.Fprintf(&b, "峰值QPS %d（%s），平均QPS %.2f，P99 QPS %d\n", report.PeakQPS, report.PeakAt.Format(layout), report.AvgQPS, report.P99QPS)
+	}
+	fmt.Fprintf(&b, "限流拒绝 %d 次，共 %d 次请求\n", report.LimiterRejected, report.LimiterTotal)
+	if len(report.BusiestKeys) > 0 {
+		b.WriteString("最繁忙的标签组合：\n")
+		for _, key := range report.BusiestKeys {
+			fmt.Fprintf(&b, "  %s 约 %d 个事件\n", key.Key, key.Events)
+		}
+	}
+	if n := int64(len(report.Anomalies)) + report.AnomaliesLost; n > 0 {
+		fmt.Fprintf(&b, "异常事件 %d 个：\n", n)
+		for _, anomaly := range report.Anomalies {
+			fmt.Fprintf(&b, "  %s %s\n", anomaly.Time.Format(layout), anomaly.Type)
+		}
+	} else {
+		b.WriteString("没有异常事件\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,309 @@
+package scaling
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"runtime/debug"
+	"runtime/metrics"
+	"sync"
+	"time"
+
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/counter"
+	"github.com/mant7s/qps-counter/internal/limiter"
+	"github.com/mant7s/qps-counter/internal/workers"
+)
+
+const (
+	defaultInterval          = 10 * time.Second
+	defaultTargetUtilization = 0.7
+	defaultHorizon           = 5 * time.Minute
+	defaultCPUThreshold      = 80.0
+	defaultMaxRejectRate     = 0.01
+
+	// memorySaturation 内存占用超过GOMEMLIMIT的该比例时视为饱和
+	memorySaturation = 0.9
+	// minSamples 采样次数少于该值时降低建议的置信度
+	minSamples = 3
+)
+
+// 建议的操作
+const (
+	ActionScaleUp   = "scale_up"
+	ActionScaleDown = "scale_down"
+	ActionHold      = "hold"
+)
+
+// Advice 扩缩容建议，供自定义的自动扩缩容控制器直接使用
+type Advice struct {
+	Action      string   `json:"action"`
+	Current     int      `json:"current_replicas"`
+	Recommended int      `json:"recommended_replicas"`
+	Delta       int      `json:"delta"`
+	Summary     string   `json:"summary"`    // 如"增加2个副本"
+	Confidence  float64  `json:"confidence"` // 0到1，信号不足或流量变化剧烈时降低
+	Reasons     []string `json:"reasons"`
+	Signals     Signals  `json:"signals"`
+}
+
+// Signals 计算建议时使用的信号，未采集到的信号为0
+type Signals struct {
+	QPS               int64   `json:"qps"`
+	ForecastQPS       float64 `json:"forecast_qps"` // 按趋势预测horizon之后的QPS
+	Horizon           string  `json:"horizon"`
+	CapacityQPS       int64   `json:"capacity_qps"` // 单个副本能承受的QPS，未知时为0
+	TargetUtilization float64 `json:"target_utilization"`
+	RejectRate        float64 `json:"reject_rate"`  // 最近一个采样间隔内限流拒绝的比例
+	CPUPercent        float64 `json:"cpu_percent"`  // 最近一个采样间隔内的CPU使用率，相对GOMAXPROCS
+	MemoryBytes       uint64  `json:"memory_bytes"` // 向操作系统申请且未归还的内存
+	MemoryLimit       int64   `json:"memory_limit,omitempty"`
+}
+
+// Advisor 综合QPS、饱和度（限流拒绝、CPU、内存）和趋势预测给出扩缩容建议
+// 后台协程按固定间隔采样限流拒绝数和CPU时间，建议基于最近一个采样间隔计算
+type Advisor struct {
+	counter counter.Counter
+	trend   *counter.TrendTracker // 可以为nil，此时不做预测
+	limiter *limiter.RateLimiter
+
+	interval          time.Duration
+	replicas          int
+	capacityQPS       int64
+	targetUtilization float64
+	horizon           time.Duration
+	cpuThreshold      float64
+	maxRejectRate     float64
+
+	worker   *workers.Worker
+	stopChan chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+
+	mu           sync.Mutex
+	samples      int
+	rejectRate   float64
+	cpuPercent   float64
+	lastRejected int64
+	lastTotal    int64
+	lastCPU      [2]float64 // 累计的CPU总时间和空闲时间（秒）
+}
+
+// NewAdvisor 创建扩缩容建议器并启动采样协程
+func NewAdvisor(cfg config.ScalingConfig, c counter.Counter, trend *counter.TrendTracker, rl *limiter.RateLimiter) *Advisor {
+	a := &Advisor{
+		counter:           c,
+		trend:             trend,
+		limiter:           rl,
+		interval:          cfg.Interval,
+		replicas:          cfg.Replicas,
+		capacityQPS:       cfg.CapacityQPS,
+		targetUtilization: cfg.TargetUtilization,
+		horizon:           cfg.Horizon,
+		cpuThreshold:      cfg.CPUThreshold,
+		maxRejectRate:     cfg.MaxRejectRate,
+		stopChan:          make(chan struct{}),
+	}
+	if a.interval <= 0 {
+		a.interval = defaultInterval
+	}
+	if a.replicas <= 0 {
+		a.replicas = 1
+	}
+	if a.targetUtilization <= 0 {
+		a.targetUtilization = defaultTargetUtilization
+	}
+	if a.horizon <= 0 {
+		a.horizon = defaultHorizon
+	}
+	if a.cpuThreshold <= 0 {
+		a.cpuThreshold = defaultCPUThreshold
+	}
+	if a.maxRejectRate <= 0 {
+		a.maxRejectRate = defaultMaxRejectRate
+	}
+
+	a.lastRejected, a.lastTotal = rl.Counts()
+	a.lastCPU = readCPU()
+
+	a.worker = workers.Register("scaling.advisor", a.interval)
+	a.worker.Go(&a.wg, a.run)
+	return a
+}
+
+func (a *Advisor) run() {
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			a.Sample()
+			a.worker.Ran()
+		case <-a.stopChan:
+			return
+		}
+	}
+}
+
+// Sample 采样最近一个间隔内的限流拒绝比例和CPU使用率
+func (a *Advisor) Sample() {
+	rejected, total := a.limiter.Counts()
+	cpu := readCPU()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.rejectRate = 0
+	if delta := total - a.lastTotal; delta > 0 {
+		a.rejectRate = float64(rejected-a.lastRejected) / float64(delta)
+	}
+	a.cpuPercent = 0
+	if delta := cpu[0] - a.lastCPU[0]; delta > 0 {
+		a.cpuPercent = math.Max(0, (delta-(cpu[1]-a.lastCPU[1]))/delta*100)
+	}
+	a.lastRejected, a.lastTotal = rejected, total
+	a.lastCPU = cpu
+	a.samples++
+}
+
+// Advice 计算扩缩容建议，replicas为当前副本数，为0时使用配置的副本数
+func (a *Advisor) Advice(replicas int) Advice {
+	if replicas <= 0 {
+		replicas = a.replicas
+	}
+
+	a.mu.Lock()
+	signals := Signals{
+		QPS:               a.counter.CurrentQPS(),
+		Horizon:           a.horizon.String(),
+		CapacityQPS:       a.capacity(),
+		TargetUtilization: a.targetUtilization,
+		RejectRate:        a.rejectRate,
+		CPUPercent:        math.Round(a.cpuPercent*10) / 10,
+	}
+	samples := a.samples
+	a.mu.Unlock()
+
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	signals.MemoryBytes = memStats.Sys - memStats.HeapReleased
+	if limit := debug.SetMemoryLimit(-1); limit < math.MaxInt64 {
+		signals.MemoryLimit = limit
+	}
+
+	advice := Advice{Current: replicas, Recommended: replicas, Confidence: 1}
+
+	// 预测值只用于扩容，流量下降时按当前QPS计算，避免过早缩容
+	demand := float64(signals.QPS)
+	signals.ForecastQPS = demand
+	if a.trend != nil {
+		trend := a.trend.Trend()
+		signals.ForecastQPS = math.Max(0, trend.SmoothedQPS+trend.Derivative*a.horizon.Seconds())
+		demand = math.Max(demand, signals.ForecastQPS)
+		if trend.SmoothedQPS > 0 && math.Abs(signals.ForecastQPS-trend.SmoothedQPS)/trend.SmoothedQPS > 0.5 {
+			advice.Confidence *= 0.7
+			advice.Reasons = append(advice.Reasons, "流量变化剧烈，预测值可能不准确")
+		}
+	} else {
+		advice.Confidence *= 0.8
+		advice.Reasons = append(advice.Reasons, "未启用趋势跟踪，只按当前QPS计算")
+	}
+	signals.ForecastQPS = math.Round(signals.ForecastQPS*100) / 100
+	// 被限流拒绝的请求没有计入QPS，按拒绝比例还原实际需求
+	if signals.RejectRate > 0 && signals.RejectRate < 1 {
+		demand /= 1 - signals.RejectRate
+	}
+
+	if signals.CapacityQPS > 0 {
+		perReplica := float64(signals.CapacityQPS) * a.targetUtilization
+		advice.Recommended = max(1, int(math.Ceil(demand/perReplica)))
+		total := perReplica * float64(replicas)
+		switch {
+		case advice.Recommended > replicas:
+			advice.Reasons = append(advice.Reasons, fmt.Sprintf("需求QPS %.0f 超过%d个副本的目标容量 %.0f", demand, replicas, total))
+		case advice.Recommended < replicas:
+			advice.Reasons = append(advice.Reasons, fmt.Sprintf("需求QPS %.0f 低于%d个副本的目标容量 %.0f", demand, advice.Recommended, perReplica*float64(advice.Recommended)))
+		}
+	} else {
+		advice.Confidence *= 0.5
+		advice.Reasons = append(advice.Reasons, "未配置单个副本的容量，限流速率也无法作为容量，只根据饱和度判断")
+	}
+
+	// 饱和时至少增加一个副本，也不再缩容
+	saturated := false
+	if signals.RejectRate > a.maxRejectRate {
+		saturated = true
+		advice.Reasons = append(advice.Reasons, fmt.Sprintf("限流拒绝比例 %.2f%% 超过 %.2f%%", signals.RejectRate*100, a.maxRejectRate*100))
+	}
+	if signals.CPUPercent > a.cpuThreshold {
+		saturated = true
+		advice.Reasons = append(advice.Reasons, fmt.Sprintf("CPU使用率 %.1f%% 超过 %.1f%%", signals.CPUPercent, a.cpuThreshold))
+	}
+	if signals.MemoryLimit > 0 && float64(signals.MemoryBytes) > memorySaturation*float64(signals.MemoryLimit) {
+		saturated = true
+		advice.Reasons = append(advice.Reasons, fmt.Sprintf("内存占用 %d 字节接近GOMEMLIMIT %d 字节", signals.MemoryBytes, signals.MemoryLimit))
+	}
+	if saturated {
+		advice.Recommended = max(advice.Recommended, replicas+1)
+	}
+
+	if samples < minSamples {
+		advice.Confidence *= 0.5
+		advice.Reasons = append(advice.Reasons, "采样次数不足，饱和度信号可能不准确")
+	}
+
+	advice.Delta = advice.Recommended - replicas
+	switch {
+	case advice.Delta > 0:
+		advice.Action = ActionScaleUp
+		advice.Summary = fmt.Sprintf("增加%d个副本", advice.Delta)
+	case advice.Delta < 0:
+		advice.Action = ActionScaleDown
+		advice.Summary = fmt.Sprintf("减少%d个副本", -advice.Delta)
+	default:
+		advice.Action = ActionHold
+		advice.Summary = "保持当前副本数"
+	}
+	if advice.Reasons == nil {
+		advice.Reasons = []string{}
+	}
+	advice.Confidence = math.Round(advice.Confidence*100) / 100
+	advice.Signals = signals
+	return advice
+}
+
+// capacity 返回单个副本能承受的QPS，未配置时使用限流速率（按字节限流时无法换算为QPS）
+func (a *Advisor) capacity() int64 {
+	if a.capacityQPS > 0 {
+		return a.capacityQPS
+	}
+	if a.limiter.Enabled() && a.limiter.Unit() != limiter.UnitBytes {
+		return a.limiter.Rate()
+	}
+	return 0
+}
+
+// Stop 停止采样协程
+func (a *Advisor) Stop() {
+	a.stopOnce.Do(func() {
+		close(a.stopChan)
+		a.wg.Wait()
+	})
+}
+
+// readCPU 返回进程累计的CPU总时间和空闲时间（秒），总时间按GOMAXPROCS计算
+func readCPU() [2]float64 {
+	samples := []metrics.Sample{
+		{Name: "/cpu/classes/total:cpu-seconds"},
+		{Name: "/cpu/classes/idle:cpu-seconds"},
+	}
+	metrics.Read(samples)
+	var cpu [2]float64
+	for i, s := range samples {
+		if s.Value.Kind() == metrics.KindFloat64 {
+			cpu[i] = s.Value.Float64()
+		}
+	}
+	return cpu
+}
@@ -0,0 +1,181 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/counter"
+	"github.com/mant7s/qps-counter/internal/logger"
+	"github.com/mant7s/qps-counter/internal/storage"
+	"github.com/mant7s/qps-counter/internal/workers"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultInterval = 10 * time.Second
+
+	// snapshotKey 快照在存储中的键，与命名计数器的 counters/ 前缀不冲突
+	snapshotKey     = "snapshot"
+	snapshotVersion = 1
+)
+
+// ErrIncompatible 快照的格式版本或计数器精度与当前配置不一致，不能恢复
+var ErrIncompatible = errors.New("快照与当前配置不兼容")
+
+// Snapshot 持久化的计数器状态
+type Snapshot struct {
+	Version   int                               `json:"version"`
+	SavedAt   time.Time                         `json:"saved_at"`
+	Precision string                            `json:"precision"` // 保存时的counter.precision，如 "100ms"
+	Counter   counter.WindowSnapshot            `json:"counter"`
+	Keys      map[string][]counter.SlotSnapshot `json:"keys,omitempty"`
+	History   []counter.HistorySample           `json:"history,omitempty"`
+}
+
+// Snapshotter 定期把全局计数器的窗口槽位、按key计数和QPS历史写入存储，启动时恢复，
+// 重启后QPS和历史记录不会归零；只恢复仍在窗口内的槽位和保留时长内的采样，
+// 停机时间超过窗口长度时窗口从零开始。shared类型的计数器本身保存在共享内存中，不写入快照
+type Snapshotter struct {
+	store     storage.Storage
+	interval  time.Duration
+	precision time.Duration
+	counter   counter.Counter
+	keyed     *counter.KeyedCounter // 为nil时不保存按key计数
+	history   *counter.History      // 为nil时不保存QPS历史
+
+	errMu   sync.Mutex
+	lastErr error // 最近一次定期写入的错误，写入成功后清除
+
+	worker   *workers.Worker
+	stopChan chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewSnapshotter 创建计数器快照，precision为counter.precision，keyed和history可以为nil
+func NewSnapshotter(cfg config.SnapshotConfig, precision time.Duration, store storage.Storage, c counter.Counter, keyed *counter.KeyedCounter, history *counter.History) *Snapshotter {
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+
+	return &Snapshotter{
+		store:     store,
+		interval:  interval,
+		precision: precision,
+		counter:   c,
+		keyed:     keyed,
+		history:   history,
+		stopChan:  make(chan struct{}),
+	}
+}
+
+// Start 启动定期写入快照的协程
+func (s *Snapshotter) Start() {
+	s.worker = workers.Register("snapshot", s.interval)
+	s.worker.Go(&s.wg, s.saveWorker)
+}
+
+func (s *Snapshotter) saveWorker() {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			err := s.Save()
+			if err != nil {
+				s.worker.Fail(err)
+				logger.Error("写入计数器快照失败", zap.Error(err))
+			}
+			s.setErr(err)
+			s.worker.Ran()
+		case <-s.stopChan:
+			return
+		}
+	}
+}
+
+func (s *Snapshotter) setErr(err error) {
+	s.errMu.Lock()
+	defer s.errMu.Unlock()
+	s.lastErr = err
+}
+
+// Err 返回最近一次定期写入快照的错误，没有出错或最近一次写入成功时返回nil
+func (s *Snapshotter) Err() error {
+	s.errMu.Lock()
+	defer s.errMu.Unlock()
+	return s.lastErr
+}
+
+// Save 把当前状态写入存储
+func (s *Snapshotter) Save() error {
+	now := counter.ClockOf(s.counter).Now()
+	snapshot := Snapshot{
+		Version:   snapshotVersion,
+		SavedAt:   now,
+		Precision: s.precision.String(),
+		Keys:      s.keyed.Snapshot(now.UnixNano()),
+	}
+	snapshot.Counter, _ = counter.SnapshotOf(s.counter, now.UnixNano())
+	if s.history != nil {
+		snapshot.History = s.history.Samples(0)
+	}
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("编码快照失败: %w", err)
+	}
+	return s.store.Put(snapshotKey, data)
+}
+
+// Restore 从存储恢复状态，在计数器开始接收上报之前调用；没有快照时不返回错误
+func (s *Snapshotter) Restore() error {
+	data, err := s.store.Get(snapshotKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("读取快照失败: %w", err)
+	}
+
+	var snapshot Snapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return fmt.Errorf("解析快照失败: %w", err)
+	}
+	// 精度不同时槽位对应的时间段不同，恢复后的计数会落在错误的槽位上
+	if snapshot.Version != snapshotVersion || snapshot.Precision != s.precision.String() {
+		return fmt.Errorf("%w: version=%d precision=%s", ErrIncompatible, snapshot.Version, snapshot.Precision)
+	}
+
+	// 槽位时间戳按计数器的时间源计算，使用同一个时间源判断槽位是否仍在窗口内
+	now := counter.ClockOf(s.counter).Now()
+	counter.RestoreSnapshot(s.counter, snapshot.Counter, now.UnixNano())
+	keys := s.keyed.Restore(snapshot.Keys, now.UnixNano())
+	var samples int
+	if s.history != nil {
+		samples = s.history.Restore(snapshot.History, now)
+	}
+	logger.Info("已从快照恢复计数器",
+		zap.Time("saved_at", snapshot.SavedAt),
+		zap.Int64("qps", s.counter.CurrentQPS()),
+		zap.Int("keys", keys),
+		zap.Int("history_samples", samples))
+	return nil
+}
+
+// Stop 停止定期写入，并写入最后一次快照
+func (s *Snapshotter) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stopChan)
+		s.wg.Wait()
+		if err := s.Save(); err != nil {
+			logger.Error("写入计数器快照失败", zap.Error(err))
+		}
+	})
+}
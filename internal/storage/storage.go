@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"errors"
+	"strings"
+	"sync"
+)
+
+// ErrNotFound 键不存在
+var ErrNotFound = errors.New("storage: key not found")
+
+// Storage 键值存储抽象，用于持久化运行时通过API创建的配置
+type Storage interface {
+	// Get 读取键对应的值，键不存在时返回ErrNotFound
+	Get(key string) ([]byte, error)
+	// Put 写入键值，已存在时覆盖
+	Put(key string, value []byte) error
+	// Delete 删除键，键不存在时不返回错误
+	Delete(key string) error
+	// List 返回所有以prefix开头的键值
+	List(prefix string) (map[string][]byte, error)
+}
+
+// MemoryStorage 基于内存的存储，进程重启后数据丢失
+type MemoryStorage struct {
+	mu   sync.RWMutex
+	data map[string][]byte
+}
+
+// NewMemoryStorage 创建一个内存存储
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{data: make(map[string][]byte)}
+}
+
+// Get 实现Storage接口
+func (s *MemoryStorage) Get(key string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	value, ok := s.data[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]byte(nil), value...), nil
+}
+
+// Put 实现Storage接口
+func (s *MemoryStorage) Put(key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[key] = append([]byte(nil), value...)
+	return nil
+}
+
+// Delete 实现Storage接口
+func (s *MemoryStorage) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data, key)
+	return nil
+}
+
+// List 实现Storage接口
+func (s *MemoryStorage) List(prefix string) (map[string][]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make(map[string][]byte)
+	for key, value := range s.data {
+		if strings.HasPrefix(key, prefix) {
+			result[key] = append([]byte(nil), value...)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,143 @@
+package workers
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultWatchdogInterval 看门狗默认的检查间隔
+	defaultWatchdogInterval = 10 * time.Second
+	// defaultStallThreshold 协程超过执行间隔加该时间没有执行时视为卡住
+	defaultStallThreshold = 30 * time.Second
+)
+
+var (
+	statsMu  sync.Mutex
+	stalls   = make(map[string]int64) // 各协程被发现卡住的次数
+	restarts = make(map[string]int64) // 各协程被看门狗重新启动的次数
+)
+
+// Watchdog 定期检查已登记协程的最近执行时间，发现卡住的循环时输出日志、累计次数，并按配置重新启动
+// 事件驱动的协程（执行间隔为0）和空闲暂停的协程不检查
+type Watchdog struct {
+	interval  time.Duration
+	threshold time.Duration
+	restart   bool
+
+	worker   *Worker
+	stopChan chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewWatchdog 创建并启动看门狗
+func NewWatchdog(cfg config.WatchdogConfig) *Watchdog {
+	wd := &Watchdog{
+		interval:  cfg.Interval,
+		threshold: cfg.Threshold,
+		restart:   cfg.Restart,
+		stopChan:  make(chan struct{}),
+	}
+	if wd.interval <= 0 {
+		wd.interval = defaultWatchdogInterval
+	}
+	if wd.threshold <= 0 {
+		wd.threshold = defaultStallThreshold
+	}
+
+	wd.worker = Register("workers.watchdog", wd.interval)
+	wd.worker.Go(&wd.wg, wd.run)
+	return wd
+}
+
+func (wd *Watchdog) run() {
+	ticker := time.NewTicker(wd.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			wd.Check(time.Now())
+			wd.worker.Ran()
+		case <-wd.stopChan:
+			return
+		}
+	}
+}
+
+// Check 检查所有协程，返回本次新发现卡住的协程
+// 同一次卡住只报告一次，协程再次执行后恢复检查
+func (wd *Watchdog) Check(now time.Time) []Info {
+	var stalled []Info
+	for _, w := range snapshot() {
+		interval := time.Duration(w.interval.Load())
+		if interval <= 0 || (w.idle != nil && w.idle()) {
+			w.stalled.Store(false)
+			continue
+		}
+
+		heartbeat := w.startedAt
+		if ns := w.lastRun.Load(); ns > 0 {
+			heartbeat = time.Unix(0, ns)
+		}
+		if now.Sub(heartbeat) <= interval+wd.threshold {
+			w.stalled.Store(false)
+			continue
+		}
+		if w.stalled.Swap(true) {
+			continue
+		}
+
+		statsMu.Lock()
+		stalls[w.name]++
+		statsMu.Unlock()
+		logger.Error("后台协程长时间没有执行，可能已卡住",
+			zap.String("worker", w.name),
+			zap.Uint64("id", w.id),
+			zap.Duration("interval", interval),
+			zap.Duration("since_last_run", now.Sub(heartbeat)))
+
+		if wd.restart && w.restart() {
+			statsMu.Lock()
+			restarts[w.name]++
+			statsMu.Unlock()
+			logger.Warn("已重新启动卡住的后台协程", zap.String("worker", w.name), zap.Uint64("id", w.id))
+		}
+		stalled = append(stalled, w.Info())
+	}
+	return stalled
+}
+
+// Stop 停止看门狗
+func (wd *Watchdog) Stop() {
+	wd.stopOnce.Do(func() {
+		close(wd.stopChan)
+		wd.wg.Wait()
+	})
+}
+
+// Stalls 返回各协程被发现卡住的次数
+func Stalls() map[string]int64 {
+	return copyCounts(stalls)
+}
+
+// Restarts 返回各协程被看门狗重新启动的次数
+func Restarts() map[string]int64 {
+	return copyCounts(restarts)
+}
+
+func copyCounts(counts map[string]int64) map[string]int64 {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+
+	result := make(map[string]int64, len(counts))
+	for name, n := range counts {
+		result[name] = n
+	}
+	return result
+}
@@ -0,0 +1,201 @@
+package workers
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mant7s/qps-counter/internal/recovery"
+)
+
+var (
+	mu      sync.Mutex
+	nextID  uint64
+	running = make(map[uint64]*Worker)
+)
+
+// Worker 一个已登记的后台协程，记录循环的执行情况，用于排查卡住的循环
+// Ran、Fail、SetInterval、Unregister对nil安全
+type Worker struct {
+	id        uint64
+	name      string
+	startedAt time.Time
+	idle      func() bool // 返回协程是否因计数器空闲而暂停，可以为nil
+
+	interval atomic.Int64 // 循环的执行间隔（纳秒），事件驱动的协程为0
+	lastRun  atomic.Int64 // 最近一次执行的时间（纳秒）
+	runs     atomic.Int64
+	stalled  atomic.Bool // 看门狗发现循环卡住后置位，循环再次执行后清除
+	restarts atomic.Int64
+
+	stateMu     sync.Mutex
+	fn          func() // 循环函数，看门狗重新启动时使用
+	wg          *sync.WaitGroup
+	lastError   string
+	lastErrorAt time.Time
+}
+
+// Info 后台协程的状态
+type Info struct {
+	ID          uint64     `json:"id"`
+	Name        string     `json:"name"`
+	Interval    string     `json:"interval,omitempty"`
+	StartedAt   time.Time  `json:"started_at"`
+	LastRun     *time.Time `json:"last_run,omitempty"`
+	Runs        int64      `json:"runs"`
+	Idle        bool       `json:"idle"`
+	Stalled     bool       `json:"stalled"`
+	Restarts    int64      `json:"restarts"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+}
+
+// Register 登记一个后台协程，name与recovery中的组件名一致，interval为循环的执行间隔
+func Register(name string, interval time.Duration) *Worker {
+	mu.Lock()
+	defer mu.Unlock()
+
+	nextID++
+	w := &Worker{id: nextID, name: name, startedAt: time.Now()}
+	w.interval.Store(int64(interval))
+	running[w.id] = w
+	return w
+}
+
+// WithIdle 设置空闲探测函数，空闲暂停的协程不会被视为卡住
+func (w *Worker) WithIdle(idle func() bool) *Worker {
+	if w != nil {
+		w.idle = idle
+	}
+	return w
+}
+
+// SetInterval 更新循环的执行间隔，循环在运行时修改间隔后调用，避免看门狗按旧的间隔判断是否卡住
+func (w *Worker) SetInterval(interval time.Duration) {
+	if w != nil {
+		w.interval.Store(int64(interval))
+	}
+}
+
+// Go 通过recovery.Go运行fn，fn发生panic时记录为最近一次错误后重新运行，fn正常返回时注销
+func (w *Worker) Go(wg *sync.WaitGroup, fn func()) {
+	w.stateMu.Lock()
+	w.fn, w.wg = fn, wg
+	w.stateMu.Unlock()
+	w.start(wg, fn)
+}
+
+// restart 在新协程中重新运行循环，卡住的协程无法被终止，仍然保留
+func (w *Worker) restart() bool {
+	w.stateMu.Lock()
+	fn, wg := w.fn, w.wg
+	w.stateMu.Unlock()
+	if fn == nil {
+		return false
+	}
+	w.restarts.Add(1)
+	w.start(wg, fn)
+	return true
+}
+
+func (w *Worker) start(wg *sync.WaitGroup, fn func()) {
+	recovery.Go(w.name, wg, func() {
+		defer func() {
+			if r := recover(); r != nil {
+				w.Fail(fmt.Errorf("panic: %v", r))
+				panic(r)
+			}
+		}()
+		fn()
+		w.Unregister()
+	})
+}
+
+// Ran 记录一次循环执行
+func (w *Worker) Ran() {
+	if w == nil {
+		return
+	}
+	w.lastRun.Store(time.Now().UnixNano())
+	w.runs.Add(1)
+}
+
+// Fail 记录一次错误
+func (w *Worker) Fail(err error) {
+	if w == nil || err == nil {
+		return
+	}
+	w.stateMu.Lock()
+	w.lastError = err.Error()
+	w.lastErrorAt = time.Now()
+	w.stateMu.Unlock()
+}
+
+// Unregister 注销协程，协程退出时调用
+func (w *Worker) Unregister() {
+	if w == nil {
+		return
+	}
+	mu.Lock()
+	delete(running, w.id)
+	mu.Unlock()
+}
+
+// Info 返回协程的状态
+func (w *Worker) Info() Info {
+	info := Info{
+		ID:        w.id,
+		Name:      w.name,
+		StartedAt: w.startedAt,
+		Runs:      w.runs.Load(),
+		Idle:      w.idle != nil && w.idle(),
+		Stalled:   w.stalled.Load(),
+		Restarts:  w.restarts.Load(),
+	}
+	if interval := time.Duration(w.interval.Load()); interval > 0 {
+		info.Interval = interval.String()
+	}
+	if ns := w.lastRun.Load(); ns > 0 {
+		lastRun := time.Unix(0, ns)
+		info.LastRun = &lastRun
+	}
+
+	w.stateMu.Lock()
+	if w.lastError != "" {
+		lastErrorAt := w.lastErrorAt
+		info.LastError = w.lastError
+		info.LastErrorAt = &lastErrorAt
+	}
+	w.stateMu.Unlock()
+	return info
+}
+
+// List 返回所有运行中的协程的状态，按名称和登记顺序排序
+func List() []Info {
+	list := snapshot()
+	infos := make([]Info, len(list))
+	for i, w := range list {
+		infos[i] = w.Info()
+	}
+	return infos
+}
+
+// snapshot 返回所有运行中的协程，按名称和登记顺序排序
+func snapshot() []*Worker {
+	mu.Lock()
+	list := make([]*Worker, 0, len(running))
+	for _, w := range running {
+		list = append(list, w)
+	}
+	mu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].name != list[j].name {
+			return list[i].name < list[j].name
+		}
+		return list[i].id < list[j].id
+	})
+	return list
+}
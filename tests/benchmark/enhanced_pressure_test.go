@@ -52,7 +52,7 @@ func TestEnhancedPressure(t *testing.T) {
 	metricsCollector := metrics.NewMetrics(qpsCounter)
 
 	// 创建路由
-	router := api.NewRouter(qpsCounter, gracefulShutdown, rateLimiter, metricsCollector, "/metrics", true)
+	router := api.NewRouter(api.RouterOptions{Counter: qpsCounter, GracefulShutdown: gracefulShutdown, RateLimiter: rateLimiter, Metrics: metricsCollector, MetricsEndpoint: "/metrics", MetricsEnabled: true})
 	ts := httptest.NewServer(router)
 	defer ts.Close()
 
@@ -130,7 +130,7 @@ func TestEnhancedPressure(t *testing.T) {
 		testLimiter := limiter.NewRateLimiter(10000, 2000, true)
 		// 创建指标收集器
 		testMetrics := metrics.NewMetrics(testCounter)
-		testRouter := api.NewRouter(testCounter, testGS, testLimiter, testMetrics, "/metrics", true)
+		testRouter := api.NewRouter(api.RouterOptions{Counter: testCounter, GracefulShutdown: testGS, RateLimiter: testLimiter, Metrics: testMetrics, MetricsEndpoint: "/metrics", MetricsEnabled: true})
 		testServer := httptest.NewServer(testRouter)
 		defer testServer.Close()
 		defer testCounter.Stop()
@@ -50,7 +50,7 @@ func TestPressure(t *testing.T) {
 	metricsCollector := metrics.NewMetrics(qpsCounter)
 
 	// 创建路由
-	router := api.NewRouter(qpsCounter, gracefulShutdown, rateLimiter, metricsCollector, "/metrics", true)
+	router := api.NewRouter(api.RouterOptions{Counter: qpsCounter, GracefulShutdown: gracefulShutdown, RateLimiter: rateLimiter, Metrics: metricsCollector, MetricsEndpoint: "/metrics", MetricsEnabled: true})
 	ts := httptest.NewServer(router)
 	defer ts.Close()
 
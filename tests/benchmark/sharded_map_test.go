@@ -0,0 +1,124 @@
+package benchmark_test
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/mant7s/qps-counter/internal/counter"
+)
+
+// 按键计数的负载以写入为主：每次上报都要按键找到（或创建）对应的窗口并累加。
+// 以下基准测试比较 ShardedMap、sync.Map 与单个 RWMutex 保护的 map 在 10k+ 键下的表现：
+//
+//	go test -run '^$' -bench KeyedMap -benchmem ./tests/benchmark/
+
+const benchmarkKeyCount = 16384
+
+var benchmarkKeys = func() []string {
+	keys := make([]string, benchmarkKeyCount)
+	for i := range keys {
+		keys[i] = "service-" + strconv.Itoa(i)
+	}
+	return keys
+}()
+
+type keyedMap interface {
+	incr(key string)
+}
+
+type shardedKeyedMap struct {
+	m *counter.ShardedMap[*atomic.Int64]
+}
+
+func (s *shardedKeyedMap) incr(key string) {
+	v, _ := s.m.LoadOrCreate(key, func() (*atomic.Int64, bool) {
+		return new(atomic.Int64), true
+	})
+	v.Add(1)
+}
+
+type syncKeyedMap struct {
+	m sync.Map
+}
+
+func (s *syncKeyedMap) incr(key string) {
+	v, ok := s.m.Load(key)
+	if !ok {
+		v, _ = s.m.LoadOrStore(key, new(atomic.Int64))
+	}
+	v.(*atomic.Int64).Add(1)
+}
+
+type mutexKeyedMap struct {
+	mu sync.RWMutex
+	m  map[string]*atomic.Int64
+}
+
+func (s *mutexKeyedMap) incr(key string) {
+	s.mu.RLock()
+	v, ok := s.m[key]
+	s.mu.RUnlock()
+	if !ok {
+		s.mu.Lock()
+		if v, ok = s.m[key]; !ok {
+			v = new(atomic.Int64)
+			s.m[key] = v
+		}
+		s.mu.Unlock()
+	}
+	v.Add(1)
+}
+
+func benchmarkKeyedMaps() []struct {
+	name string
+	new  func() keyedMap
+} {
+	return []struct {
+		name string
+		new  func() keyedMap
+	}{
+		{"ShardedMap", func() keyedMap { return &shardedKeyedMap{m: counter.NewShardedMap[*atomic.Int64](0)} }},
+		{"SyncMap", func() keyedMap { return &syncKeyedMap{} }},
+		{"RWMutexMap", func() keyedMap { return &mutexKeyedMap{m: make(map[string]*atomic.Int64)} }},
+	}
+}
+
+// BenchmarkKeyedMapIncr 已存在的键上并发累加
+func BenchmarkKeyedMapIncr(b *testing.B) {
+	for _, impl := range benchmarkKeyedMaps() {
+		b.Run(impl.name, func(b *testing.B) {
+			m := impl.new()
+			for _, key := range benchmarkKeys {
+				m.incr(key)
+			}
+
+			var seq atomic.Uint64
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := seq.Add(7919)
+				for pb.Next() {
+					m.incr(benchmarkKeys[i%benchmarkKeyCount])
+					i++
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkKeyedMapChurn 持续出现新键时的并发写入，模拟键基数不断增长的场景
+func BenchmarkKeyedMapChurn(b *testing.B) {
+	for _, impl := range benchmarkKeyedMaps() {
+		b.Run(impl.name, func(b *testing.B) {
+			m := impl.new()
+			var seq atomic.Uint64
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					m.incr(strconv.FormatUint(seq.Add(1), 10))
+				}
+			})
+		})
+	}
+}
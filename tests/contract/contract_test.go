@@ -0,0 +1,308 @@
+package contract_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+
+	"github.com/mant7s/qps-counter/internal/analytics"
+	"github.com/mant7s/qps-counter/internal/api"
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/counter"
+	"github.com/mant7s/qps-counter/internal/events"
+	"github.com/mant7s/qps-counter/internal/ingest"
+	"github.com/mant7s/qps-counter/internal/limiter"
+	"github.com/mant7s/qps-counter/internal/logger"
+	"github.com/mant7s/qps-counter/internal/metrics"
+	"github.com/mant7s/qps-counter/internal/report"
+	"github.com/mant7s/qps-counter/internal/scaling"
+	"github.com/mant7s/qps-counter/internal/storage"
+)
+
+// 使用 go test ./tests/contract -update 重新生成golden文件
+// 删除字段或修改字段类型时必须先提升api.ContractVersion，否则拒绝更新
+var update = flag.Bool("update", false, "更新golden文件")
+
+// 请求携带的调用方标识，使 /clients 返回非空的结果
+const (
+	adminToken = "contract-token"
+	userAgent  = "contract-test/1.0"
+	apiKey     = "contract-key"
+	remoteAddr = "192.0.2.10:1234"
+)
+
+// contractCase 一个公开接口的请求，按顺序执行，后面的请求可以依赖前面请求产生的状态
+type contractCase struct {
+	name        string
+	method      string
+	path        string
+	contentType string
+	body        string
+	admin       bool
+}
+
+var contractCases = []contractCase{
+	{name: "contract_version", method: "GET", path: "/contract-version"},
+	{name: "healthz", method: "GET", path: "/healthz"},
+	{name: "collect", method: "POST", path: "/collect", contentType: "application/json", body: `{"count":3}`},
+	{name: "collect_v2", method: "POST", path: "/collect", contentType: api.CollectV2ContentType, body: `{"key":"checkout","count":2,"attributes":{"route":"/pay"}}`},
+	{name: "collect_invalid", method: "POST", path: "/collect", contentType: "application/json", body: `{"count":`},
+	{name: "collect_batch", method: "POST", path: "/collect/batch", contentType: "application/json", body: `[{"count":1},{"version":2,"count":-1}]`},
+	{name: "collect_batch_aborted", method: "POST", path: "/collect/batch", contentType: "application/json", body: `[{"count":1},{"count":`},
+	{name: "qps", method: "GET", path: "/qps"},
+	{name: "qps_v1", method: "GET", path: "/v1/qps?format=human"},
+	{name: "qps_v1_invalid", method: "GET", path: "/v1/qps?precision=-1"},
+	{name: "rate", method: "GET", path: "/rate"},
+	{name: "rate_not_found", method: "GET", path: "/rate?counter=missing"},
+	{name: "qps_trend", method: "GET", path: "/qps/trend"},
+	{name: "qps_history", method: "GET", path: "/qps/history?duration=5m"},
+	{name: "qps_history_invalid", method: "GET", path: "/qps/history?duration=abc"},
+	{name: "qps_tags", method: "GET", path: "/qps/tags"},
+	{name: "qps_key", method: "GET", path: "/qps?key=checkout"},
+	{name: "qps_keys", method: "GET", path: "/qps/keys?top=10"},
+	{name: "qps_keys_invalid", method: "GET", path: "/qps/keys?top=0"},
+	{name: "qps_keys_page", method: "GET", path: "/qps/keys?limit=1"},
+	{name: "qps_keys_page_invalid", method: "GET", path: "/qps/keys?cursor=invalid"},
+	{name: "clients", method: "GET", path: "/clients"},
+	{name: "clients_invalid", method: "GET", path: "/clients?top=0"},
+	{name: "scaling_advice", method: "GET", path: "/scaling/advice?replicas=2"},
+	{name: "scaling_advice_invalid", method: "GET", path: "/scaling/advice?replicas=0"},
+	{name: "reports_latest", method: "GET", path: "/reports/latest"},
+	{name: "stats", method: "GET", path: "/stats"},
+	{name: "stats_v2", method: "GET", path: "/stats/v2"},
+	{name: "shutdown_status", method: "GET", path: "/shutdown/status"},
+	{name: "limiter_rate", method: "POST", path: "/limiter/rate", contentType: "application/json", body: `{"rate":5000}`},
+	{name: "limiter_rate_invalid", method: "POST", path: "/limiter/rate", contentType: "application/json", body: `{"rate":-1}`},
+	{name: "limiter_toggle", method: "POST", path: "/limiter/toggle", contentType: "application/json", body: `{"enabled":true}`},
+	{name: "counters_create_unauthorized", method: "POST", path: "/counters", contentType: "application/json", body: `{"name":"upload"}`},
+	{name: "counters_create", method: "POST", path: "/counters", contentType: "application/json", body: `{"name":"upload","unit":"bytes"}`, admin: true},
+	{name: "counters_create_conflict", method: "POST", path: "/counters", contentType: "application/json", body: `{"name":"upload"}`, admin: true},
+	{name: "counters_list", method: "GET", path: "/counters"},
+	{name: "counters_get", method: "GET", path: "/counters/upload"},
+	{name: "counters_get_not_found", method: "GET", path: "/counters/missing"},
+	{name: "counters_collect", method: "POST", path: "/counters/upload/collect", contentType: "application/json", body: `{"count":1}`},
+	{name: "counters_delete_unauthorized", method: "DELETE", path: "/counters/upload"},
+	{name: "counters_delete", method: "DELETE", path: "/counters/upload", admin: true},
+	{name: "admin_pause_unauthorized", method: "POST", path: "/admin/ingest/pause"},
+	{name: "admin_pause", method: "POST", path: "/admin/ingest/pause", admin: true},
+	{name: "collect_paused", method: "POST", path: "/collect", contentType: "application/json", body: `{"count":1}`},
+	{name: "admin_resume", method: "POST", path: "/admin/ingest/resume", admin: true},
+	{name: "admin_batch", method: "POST", path: "/admin/batch", contentType: "application/json", body: `{"operations":[{"op":"set_rate","rate":8000},{"op":"create_counter","counter":{"name":"batch"}}]}`, admin: true},
+	{name: "admin_batch_invalid", method: "POST", path: "/admin/batch", contentType: "application/json", body: `{"operations":[{"op":"set_rate","rate":0}]}`, admin: true},
+	{name: "admin_config", method: "PUT", path: "/admin/config", contentType: "application/json", body: `{"limiter":{"rate":9000},"counters":[{"name":"declared"}]}`, admin: true},
+	{name: "admin_config_invalid", method: "PUT", path: "/admin/config", contentType: "application/json", body: `{"limiter":{"rate":0}}`, admin: true},
+	{name: "limiter_rules_put", method: "PUT", path: "/admin/limiter/rules", contentType: "application/json", body: `{"rules":[{"name":"partners","match":{"key":"partner-*","method":"post"},"rate":100},{"name":"trial","match":{"tenant":"trial"},"algorithm":"fixed_window","rate":10,"action":"shadow"}]}`, admin: true},
+	{name: "limiter_rules_get", method: "GET", path: "/admin/limiter/rules", admin: true},
+	{name: "limiter_rules_invalid", method: "PUT", path: "/admin/limiter/rules", contentType: "application/json", body: `{"rules":[{"name":"default","rate":1}]}`, admin: true},
+}
+
+// golden golden文件的内容
+type golden struct {
+	ContractVersion int         `json:"contract_version"`
+	Status          int         `json:"status"`
+	Body            interface{} `json:"body"`
+}
+
+type response struct {
+	status int
+	body   []byte
+}
+
+type server func(tc contractCase) response
+
+func init() {
+	logger.Init(config.LoggerConfig{Level: "error", Format: "console"})
+}
+
+// newContractOptions 启用所有功能的路由器选项，保证每个接口都返回正常的响应结构
+func newContractOptions(t *testing.T) api.RouterOptions {
+	cfg := &config.CounterConfig{
+		Type:       counter.LockFreeType,
+		WindowSize: time.Second,
+		SlotNum:    10,
+		Precision:  100 * time.Millisecond,
+		Tags:       config.TagsConfig{Keys: []string{"route"}},
+	}
+	c := counter.NewCounter(cfg)
+	t.Cleanup(c.Stop)
+	tt := counter.NewTrendTracker(c, 0.3, time.Second)
+	t.Cleanup(tt.Stop)
+	history := counter.NewHistory(c, time.Hour)
+	t.Cleanup(history.Stop)
+	history.Record(3, time.Now())
+	ct := counter.NewClientTracker(cfg)
+	t.Cleanup(ct.Stop)
+	registry := counter.NewRegistry(*cfg, storage.NewMemoryStorage(), 0)
+	t.Cleanup(registry.Stop)
+	rl := limiter.NewRateLimiter(10000, 10000, false)
+	sharding := counter.NewEnhancedAdaptiveShardingManager(c, cfg, 0, 0, 0, 0)
+	t.Cleanup(sharding.Stop)
+	advisor := scaling.NewAdvisor(config.ScalingConfig{}, c, tt, rl)
+	t.Cleanup(advisor.Stop)
+	tagged := counter.NewTaggedCounter(cfg)
+	keyed := counter.NewKeyedCounter(cfg)
+	decisionCfg := config.DecisionLogConfig{Enabled: true, Sink: "file", Path: filepath.Join(t.TempDir(), "decisions.jsonl")}
+	sink, err := analytics.NewSink(decisionCfg, nil)
+	require.NoError(t, err)
+	decisions := analytics.NewDecisionLog(decisionCfg, sink)
+	t.Cleanup(decisions.Stop)
+
+	// 预先生成一份包含标签组合和异常事件的报告
+	reporter := report.NewReporter(config.ReportConfig{SampleInterval: time.Hour}, c, tagged, rl, nil)
+	t.Cleanup(reporter.Stop)
+	tagged.Add(map[string]string{"route": "/pay"}, 1)
+	reporter.Handle(events.Event{Type: events.EventBurstStarted, Time: time.Now(), Data: map[string]interface{}{"qps": 1}})
+	reporter.Sample(time.Now())
+	reporter.Generate(time.Now())
+
+	return api.RouterOptions{
+		Counter:          c,
+		GracefulShutdown: counter.NewEnhancedGracefulShutdown(time.Second, 2*time.Second),
+		RateLimiter:      rl,
+		FailurePolicy:    limiter.NewFailurePolicy(limiter.FailOpen, nil),
+		DecisionLog:      decisions,
+		Sharding:         sharding,
+		TrendTracker:     tt,
+		History:          history,
+		Advisor:          advisor,
+		Reporter:         reporter,
+		TaggedCounter:    tagged,
+		KeyedCounter:     keyed,
+		ClientTracker:    ct,
+		Registry:         registry,
+		IngestSwitch:     ingest.NewSwitch(ingest.PauseReject),
+		AdminToken:       adminToken,
+		Metrics:          metrics.NewMetrics(c),
+		MetricsEndpoint:  "/metrics",
+		MetricsEnabled:   true,
+	}
+}
+
+func newGinServer(t *testing.T) server {
+	gin.SetMode(gin.TestMode)
+	router := api.NewRouter(newContractOptions(t))
+
+	return func(tc contractCase) response {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(tc.method, tc.path, bytes.NewBufferString(tc.body))
+		if tc.contentType != "" {
+			req.Header.Set("Content-Type", tc.contentType)
+		}
+		if tc.admin {
+			req.Header.Set("Authorization", "Bearer "+adminToken)
+		}
+		req.Header.Set("User-Agent", userAgent)
+		req.Header.Set("X-API-Key", apiKey)
+		req.RemoteAddr = remoteAddr
+		router.ServeHTTP(w, req)
+		return response{status: w.Code, body: w.Body.Bytes()}
+	}
+}
+
+func newFastHTTPServer(t *testing.T) server {
+	router := api.NewFastHTTPRouter(newContractOptions(t))
+
+	return func(tc contractCase) response {
+		var ctx fasthttp.RequestCtx
+		ctx.Request.Header.SetMethod(tc.method)
+		ctx.Request.SetRequestURI(tc.path)
+		if tc.contentType != "" {
+			ctx.Request.Header.SetContentType(tc.contentType)
+		}
+		if tc.admin {
+			ctx.Request.Header.Set("Authorization", "Bearer "+adminToken)
+		}
+		ctx.Request.Header.SetUserAgent(userAgent)
+		ctx.Request.Header.Set("X-API-Key", apiKey)
+		ctx.Request.SetBodyString(tc.body)
+		router.Handler()(&ctx)
+		return response{status: ctx.Response.StatusCode(), body: append([]byte(nil), ctx.Response.Body()...)}
+	}
+}
+
+// TestResponseContracts 两种路由器的每个公开接口都必须返回与golden文件一致的状态码和响应结构
+func TestResponseContracts(t *testing.T) {
+	servers := []struct {
+		name string
+		new  func(t *testing.T) server
+	}{
+		{"gin", newGinServer},
+		{"fasthttp", newFastHTTPServer},
+	}
+
+	for _, s := range servers {
+		t.Run(s.name, func(t *testing.T) {
+			do := s.new(t)
+			for _, tc := range contractCases {
+				resp := do(tc)
+				actual := golden{ContractVersion: api.ContractVersion, Status: resp.status, Body: bodyShape(resp.body)}
+				path := filepath.Join("testdata", tc.name+".json")
+
+				// 两种路由器共用同一份golden文件，只需由第一个路由器更新
+				if *update && s.name == servers[0].name {
+					writeGolden(t, path, actual)
+					continue
+				}
+
+				expected := readGolden(t, path)
+				require.Equal(t, api.ContractVersion, expected.ContractVersion,
+					"%s: golden文件的版本与api.ContractVersion不一致，请使用 -update 重新生成", tc.name)
+				require.Equal(t, expected.Status, actual.Status, "%s: 状态码发生变化", tc.name)
+				if diff := diffShape(expected.Body, actual.Body, "body"); len(diff) > 0 {
+					t.Errorf("%s %s %s: 响应结构发生变化:\n%s", s.name, tc.method, tc.path, joinLines(diff))
+				}
+			}
+		})
+	}
+}
+
+// TestContractVersion /contract-version返回当前的版本号
+func TestContractVersion(t *testing.T) {
+	resp := newGinServer(t)(contractCase{method: "GET", path: "/contract-version"})
+	require.Equal(t, http.StatusOK, resp.status)
+
+	var body struct {
+		ContractVersion int `json:"contract_version"`
+	}
+	require.NoError(t, json.Unmarshal(resp.body, &body))
+	require.Equal(t, api.ContractVersion, body.ContractVersion)
+}
+
+func readGolden(t *testing.T, path string) golden {
+	data, err := os.ReadFile(path)
+	require.NoError(t, err, "缺少golden文件，请使用 -update 生成")
+
+	var g golden
+	require.NoError(t, json.Unmarshal(data, &g))
+	return g
+}
+
+// writeGolden 更新golden文件，不兼容的变更要求先提升api.ContractVersion
+func writeGolden(t *testing.T, path string, actual golden) {
+	if data, err := os.ReadFile(path); err == nil {
+		var previous golden
+		require.NoError(t, json.Unmarshal(data, &previous))
+		if previous.ContractVersion == actual.ContractVersion {
+			breaking := breakingChanges(previous.Body, actual.Body, "body")
+			if previous.Status != actual.Status {
+				breaking = append(breaking, "status changed")
+			}
+			require.Empty(t, breaking, "%s: 不兼容的响应结构变化需要提升api.ContractVersion", path)
+		}
+	}
+
+	data, err := json.MarshalIndent(actual, "", "  ")
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, append(data, '\n'), 0o644))
+}
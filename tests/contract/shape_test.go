@@ -0,0 +1,125 @@
+package contract_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// bodyShape 将响应体转换为只包含字段名和类型的结构，字段值不参与比较
+// 空响应体为null，非JSON响应体为"text"
+func bodyShape(body []byte) interface{} {
+	if len(strings.TrimSpace(string(body))) == 0 {
+		return nil
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return "text"
+	}
+	return shapeOf(value)
+}
+
+func shapeOf(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		shape := make(map[string]interface{}, len(v))
+		for key, field := range v {
+			shape[key] = shapeOf(field)
+		}
+		return shape
+	case []interface{}:
+		// 数组只记录第一个元素的结构
+		if len(v) == 0 {
+			return []interface{}{}
+		}
+		return []interface{}{shapeOf(v[0])}
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "bool"
+	default:
+		return "null"
+	}
+}
+
+// diffShape 返回两个结构之间的所有差异
+func diffShape(expected, actual interface{}, path string) []string {
+	return compareShape(expected, actual, path, true)
+}
+
+// breakingChanges 返回不兼容的差异：删除字段或修改字段类型，新增字段是兼容的
+func breakingChanges(previous, current interface{}, path string) []string {
+	return compareShape(previous, current, path, false)
+}
+
+func compareShape(expected, actual interface{}, path string, reportAdded bool) []string {
+	switch e := expected.(type) {
+	case map[string]interface{}:
+		a, ok := actual.(map[string]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: 类型从 %s 变为 %s", path, kindOf(expected), kindOf(actual))}
+		}
+		var diff []string
+		for _, key := range sortedKeys(e) {
+			field, ok := a[key]
+			if !ok {
+				diff = append(diff, fmt.Sprintf("%s.%s: 字段被删除", path, key))
+				continue
+			}
+			diff = append(diff, compareShape(e[key], field, path+"."+key, reportAdded)...)
+		}
+		if reportAdded {
+			for _, key := range sortedKeys(a) {
+				if _, ok := e[key]; !ok {
+					diff = append(diff, fmt.Sprintf("%s.%s: 新增字段", path, key))
+				}
+			}
+		}
+		return diff
+	case []interface{}:
+		a, ok := actual.([]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: 类型从 %s 变为 %s", path, kindOf(expected), kindOf(actual))}
+		}
+		// 空数组无法确定元素结构
+		if len(e) == 0 || len(a) == 0 {
+			return nil
+		}
+		return compareShape(e[0], a[0], path+"[]", reportAdded)
+	default:
+		if kindOf(expected) != kindOf(actual) {
+			return []string{fmt.Sprintf("%s: 类型从 %s 变为 %s", path, kindOf(expected), kindOf(actual))}
+		}
+		return nil
+	}
+}
+
+func kindOf(shape interface{}) string {
+	switch s := shape.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return s
+	default:
+		return "null"
+	}
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func joinLines(lines []string) string {
+	return "  " + strings.Join(lines, "\n  ")
+}
@@ -0,0 +1,223 @@
+package integration_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+
+	"github.com/mant7s/qps-counter/internal/api"
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/counter"
+	"github.com/mant7s/qps-counter/internal/ingest"
+	"github.com/mant7s/qps-counter/internal/loadgen"
+)
+
+func TestIngestPauseResume(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	type doFunc func(method, path, authorization string) int
+
+	servers := map[string]func(t *testing.T, sw *ingest.Switch) (doFunc, func() int64){
+		"gin": func(t *testing.T, sw *ingest.Switch) (doFunc, func() int64) {
+			c, gs, rl, m := newCollectTestComponents(t)
+			router := api.NewRouter(api.RouterOptions{Counter: c, GracefulShutdown: gs, RateLimiter: rl, IngestSwitch: sw, AdminToken: "secret", Metrics: m, MetricsEndpoint: "/metrics", MetricsEnabled: true})
+			return func(method, path, authorization string) int {
+				w := httptest.NewRecorder()
+				req, _ := http.NewRequest(method, path, strings.NewReader(`{"count":1}`))
+				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set("Authorization", authorization)
+				router.ServeHTTP(w, req)
+				return w.Code
+			}, c.CurrentQPS
+		},
+		"fasthttp": func(t *testing.T, sw *ingest.Switch) (doFunc, func() int64) {
+			c, gs, rl, m := newCollectTestComponents(t)
+			router := api.NewFastHTTPRouter(api.RouterOptions{Counter: c, GracefulShutdown: gs, RateLimiter: rl, IngestSwitch: sw, AdminToken: "secret", Metrics: m, MetricsEndpoint: "/metrics", MetricsEnabled: true})
+			return func(method, path, authorization string) int {
+				var ctx fasthttp.RequestCtx
+				ctx.Request.Header.SetMethod(method)
+				ctx.Request.SetRequestURI(path)
+				ctx.Request.Header.SetContentType("application/json")
+				ctx.Request.Header.Set("Authorization", authorization)
+				ctx.Request.SetBodyString(`{"count":1}`)
+				router.Handler()(&ctx)
+				return ctx.Response.StatusCode()
+			}, c.CurrentQPS
+		},
+	}
+
+	for name, newServer := range servers {
+		for _, mode := range []string{ingest.PauseReject, ingest.PauseDrop} {
+			t.Run(name+"/"+mode, func(t *testing.T) {
+				sw := ingest.NewSwitch(mode)
+				do, qps := newServer(t, sw)
+
+				assert.Equal(t, http.StatusAccepted, do("POST", "/collect", ""))
+
+				// 管理接口需要管理员令牌
+				assert.Equal(t, http.StatusUnauthorized, do("POST", "/admin/ingest/pause", ""))
+				assert.Equal(t, http.StatusUnauthorized, do("POST", "/admin/ingest/pause", "Bearer wrong"))
+				assert.False(t, sw.Paused())
+
+				assert.Equal(t, http.StatusOK, do("POST", "/admin/ingest/pause", "Bearer secret"))
+				assert.True(t, sw.Paused())
+				wantStatus := http.StatusServiceUnavailable
+				if mode == ingest.PauseDrop {
+					wantStatus = http.StatusAccepted
+				}
+				assert.Equal(t, wantStatus, do("POST", "/collect", ""))
+				assert.Equal(t, int64(1), qps(), "暂停期间不计数")
+
+				assert.Equal(t, http.StatusOK, do("POST", "/admin/ingest/resume", "Bearer secret"))
+				assert.Equal(t, http.StatusAccepted, do("POST", "/collect", ""))
+				assert.Equal(t, int64(2), qps())
+				assert.Equal(t, int64(1), sw.GetStats()["dropped_count"])
+			})
+		}
+	}
+}
+
+func TestLoadGen(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	type doFunc func(method, path, body string) (int, string)
+
+	servers := map[string]func(opts api.RouterOptions) doFunc{
+		"gin": func(opts api.RouterOptions) doFunc {
+			router := api.NewRouter(opts)
+			return func(method, path, body string) (int, string) {
+				w := httptest.NewRecorder()
+				req, _ := http.NewRequest(method, path, strings.NewReader(body))
+				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set("Authorization", "Bearer secret")
+				router.ServeHTTP(w, req)
+				return w.Code, w.Body.String()
+			}
+		},
+		"fasthttp": func(opts api.RouterOptions) doFunc {
+			router := api.NewFastHTTPRouter(opts)
+			return func(method, path, body string) (int, string) {
+				var ctx fasthttp.RequestCtx
+				ctx.Request.Header.SetMethod(method)
+				ctx.Request.SetRequestURI(path)
+				ctx.Request.Header.SetContentType("application/json")
+				ctx.Request.Header.Set("Authorization", "Bearer secret")
+				ctx.Request.SetBodyString(body)
+				router.Handler()(&ctx)
+				return ctx.Response.StatusCode(), string(ctx.Response.Body())
+			}
+		},
+	}
+
+	for name, newServer := range servers {
+		t.Run(name, func(t *testing.T) {
+			c, gs, rl, _ := newCollectTestComponents(t)
+			generator := loadgen.NewGenerator(config.LoadGenConfig{MaxRate: 1000}, c, nil, nil)
+			defer generator.Stop()
+			do := newServer(api.RouterOptions{Counter: c, GracefulShutdown: gs, RateLimiter: rl, LoadGenerator: generator, AdminToken: "secret"})
+
+			code, body := do("POST", "/admin/loadgen", `{"rate":2000}`)
+			assert.Equal(t, http.StatusBadRequest, code, body)
+			code, body = do("POST", "/admin/loadgen", `{"rate":500,"duration":"1m"}`)
+			assert.Equal(t, http.StatusAccepted, code, body)
+			assert.Contains(t, body, `"running":true`)
+			code, _ = do("POST", "/admin/loadgen", `{"rate":500}`)
+			assert.Equal(t, http.StatusConflict, code)
+
+			// 不经过网络直接写入计数器
+			assert.Eventually(t, func() bool { return c.CurrentQPS() > 0 }, time.Second, 10*time.Millisecond)
+
+			code, body = do("DELETE", "/admin/loadgen", "")
+			assert.Equal(t, http.StatusOK, code)
+			assert.Contains(t, body, `"running":false`)
+			code, body = do("GET", "/admin/loadgen", "")
+			assert.Equal(t, http.StatusOK, code)
+			assert.Contains(t, body, `"rate":500`)
+
+			// 未提供内置压测时不注册接口
+			do = newServer(api.RouterOptions{Counter: c, GracefulShutdown: gs, RateLimiter: rl, AdminToken: "secret"})
+			code, _ = do("GET", "/admin/loadgen", "")
+			assert.Equal(t, http.StatusNotFound, code)
+		})
+	}
+}
+
+func TestResetCounter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	type doFunc func(method, path string) (int, string)
+
+	servers := map[string]func(opts api.RouterOptions) doFunc{
+		"gin": func(opts api.RouterOptions) doFunc {
+			router := api.NewRouter(opts)
+			return func(method, path string) (int, string) {
+				w := httptest.NewRecorder()
+				req, _ := http.NewRequest(method, path, nil)
+				req.Header.Set("Authorization", "Bearer secret")
+				router.ServeHTTP(w, req)
+				return w.Code, w.Body.String()
+			}
+		},
+		"fasthttp": func(opts api.RouterOptions) doFunc {
+			router := api.NewFastHTTPRouter(opts)
+			return func(method, path string) (int, string) {
+				var ctx fasthttp.RequestCtx
+				ctx.Request.Header.SetMethod(method)
+				ctx.Request.SetRequestURI(path)
+				ctx.Request.Header.Set("Authorization", "Bearer secret")
+				router.Handler()(&ctx)
+				return ctx.Response.StatusCode(), string(ctx.Response.Body())
+			}
+		},
+	}
+
+	for name, newServer := range servers {
+		t.Run(name, func(t *testing.T) {
+			c, gs, rl, _ := newCollectTestComponents(t)
+			registry := counter.NewRegistry(config.CounterConfig{
+				Type:       counter.LockFreeType,
+				WindowSize: time.Second,
+				SlotNum:    10,
+				Precision:  100 * time.Millisecond,
+			}, nil, 0)
+			defer registry.Stop()
+			_, err := registry.Create(counter.CounterSpec{Name: "orders"})
+			require.NoError(t, err)
+			orders, _ := registry.Get("orders")
+
+			c.Add(100)
+			orders.Add(100)
+			do := newServer(api.RouterOptions{Counter: c, GracefulShutdown: gs, RateLimiter: rl, Registry: registry, AdminToken: "secret"})
+
+			code, body := do("POST", "/counters/reset")
+			assert.Equal(t, http.StatusOK, code, body)
+			assert.Zero(t, c.CurrentQPS())
+			assert.NotZero(t, orders.CurrentQPS(), "只清空全局计数器")
+
+			code, body = do("POST", "/counters/reset?name=orders")
+			assert.Equal(t, http.StatusOK, code, body)
+			assert.Contains(t, body, `"name":"orders"`)
+			assert.Zero(t, orders.CurrentQPS())
+
+			code, _ = do("POST", "/counters/reset?name=missing")
+			assert.Equal(t, http.StatusNotFound, code)
+
+			// 重置之后继续计数
+			c.Add(10)
+			assert.NotZero(t, c.CurrentQPS())
+
+			// 需要管理员令牌
+			do = newServer(api.RouterOptions{Counter: c, GracefulShutdown: gs, RateLimiter: rl, AdminToken: "other"})
+			code, _ = do("POST", "/counters/reset")
+			assert.Equal(t, http.StatusUnauthorized, code)
+			assert.NotZero(t, c.CurrentQPS())
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package integration_test
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -14,6 +15,7 @@ import (
 	"github.com/mant7s/qps-counter/internal/limiter"
 	"github.com/mant7s/qps-counter/internal/metrics"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestAPIEndpoints(t *testing.T) {
@@ -44,7 +46,7 @@ func TestAPIEndpoints(t *testing.T) {
 	metricsCollector := metrics.NewMetrics(qpsCounter)
 
 	// 使用api.NewRouter创建测试路由，与实际应用保持一致
-	router := api.NewRouter(qpsCounter, gracefulShutdown, rateLimiter, metricsCollector, "/metrics", true)
+	router := api.NewRouter(api.RouterOptions{Counter: qpsCounter, GracefulShutdown: gracefulShutdown, RateLimiter: rateLimiter, Metrics: metricsCollector, MetricsEndpoint: "/metrics", MetricsEnabled: true})
 
 	// 设置测试模式
 	gin.SetMode(gin.TestMode)
@@ -70,3 +72,29 @@ func TestAPIEndpoints(t *testing.T) {
 		assert.JSONEq(t, `{"qps":10}`, w.Body.String())
 	})
 }
+
+// TestStatsV2Verify 启用计数校验时 /stats/v2 返回类型化的校验统计
+func TestStatsV2Verify(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c := counter.NewCounter(&config.CounterConfig{
+		Type:       counter.LockFreeType,
+		WindowSize: time.Second,
+		SlotNum:    10,
+		Precision:  100 * time.Millisecond,
+		Verify:     config.VerifyConfig{Enabled: true},
+	})
+	t.Cleanup(c.Stop)
+	_, gs, rl, m := newCollectTestComponents(t)
+	router := api.NewRouter(api.RouterOptions{Counter: c, GracefulShutdown: gs, RateLimiter: rl, Metrics: m})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/stats/v2", nil)
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var stats api.Stats
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	require.NotNil(t, stats.Verify)
+	assert.True(t, stats.Verify.Enabled)
+	assert.Zero(t, stats.Verify.Mismatches)
+}
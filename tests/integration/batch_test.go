@@ -0,0 +1,133 @@
+package integration_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+
+	"github.com/mant7s/qps-counter/internal/api"
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/counter"
+	"github.com/mant7s/qps-counter/internal/ingest"
+	"github.com/mant7s/qps-counter/internal/storage"
+)
+
+type batchResponse struct {
+	Applied bool              `json:"applied"`
+	Results []api.BatchResult `json:"results"`
+}
+
+func batchStatuses(resp batchResponse) []string {
+	statuses := make([]string, len(resp.Results))
+	for i, result := range resp.Results {
+		statuses[i] = result.Status
+	}
+	return statuses
+}
+
+// TestAdminBatch 批量管理操作全部校验通过后才执行，执行失败时撤销已执行的操作
+func TestAdminBatch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	type doFunc func(body string) (int, batchResponse)
+
+	servers := map[string]func(opts api.RouterOptions) doFunc{
+		"gin": func(opts api.RouterOptions) doFunc {
+			router := api.NewRouter(opts)
+			return func(body string) (int, batchResponse) {
+				w := httptest.NewRecorder()
+				req, _ := http.NewRequest("POST", "/admin/batch", strings.NewReader(body))
+				req.Header.Set("Authorization", "Bearer secret")
+				router.ServeHTTP(w, req)
+				var resp batchResponse
+				json.Unmarshal(w.Body.Bytes(), &resp)
+				return w.Code, resp
+			}
+		},
+		"fasthttp": func(opts api.RouterOptions) doFunc {
+			handler := api.NewFastHTTPRouter(opts).Handler()
+			return func(body string) (int, batchResponse) {
+				var ctx fasthttp.RequestCtx
+				ctx.Request.Header.SetMethod("POST")
+				ctx.Request.SetRequestURI("/admin/batch")
+				ctx.Request.Header.Set("Authorization", "Bearer secret")
+				ctx.Request.SetBodyString(body)
+				handler(&ctx)
+				var resp batchResponse
+				json.Unmarshal(ctx.Response.Body(), &resp)
+				return ctx.Response.StatusCode(), resp
+			}
+		},
+	}
+
+	for name, newServer := range servers {
+		t.Run(name, func(t *testing.T) {
+			c, gs, rl, m := newCollectTestComponents(t)
+			sw := ingest.NewSwitch(ingest.PauseReject)
+			// 最多两个命名计数器，用于触发执行阶段的失败
+			registry := counter.NewRegistry(config.CounterConfig{
+				Type:       counter.LockFreeType,
+				WindowSize: time.Second,
+				SlotNum:    10,
+				Precision:  100 * time.Millisecond,
+			}, storage.NewMemoryStorage(), 2)
+			t.Cleanup(registry.Stop)
+
+			do := newServer(api.RouterOptions{Counter: c, GracefulShutdown: gs, RateLimiter: rl, Registry: registry, IngestSwitch: sw, AdminToken: "secret", Metrics: m})
+
+			status, resp := do(`{"operations":[
+				{"op":"set_rate","rate":500},
+				{"op":"toggle_limiter","enabled":false},
+				{"op":"pause_ingest"},
+				{"op":"create_counter","counter":{"name":"upload","unit":"bytes"}}
+			]}`)
+			require.Equal(t, http.StatusOK, status)
+			assert.True(t, resp.Applied)
+			assert.Equal(t, []string{"applied", "applied", "applied", "applied"}, batchStatuses(resp))
+			assert.Equal(t, int64(500), rl.Rate())
+			assert.False(t, rl.Enabled())
+			assert.True(t, sw.Paused())
+			_, ok := registry.Info("upload")
+			assert.True(t, ok)
+
+			// 任意一项校验失败时整个批次都不执行
+			status, resp = do(`{"operations":[
+				{"op":"set_rate","rate":800},
+				{"op":"set_rate","rate":-1},
+				{"op":"create_counter","counter":{"name":"upload"}},
+				{"op":"unknown"}
+			]}`)
+			assert.Equal(t, http.StatusBadRequest, status)
+			assert.False(t, resp.Applied)
+			assert.Equal(t, []string{"skipped", "invalid", "invalid", "invalid"}, batchStatuses(resp))
+			assert.Equal(t, int64(500), rl.Rate())
+
+			// 执行阶段失败（超出计数器数量上限）时撤销已执行的操作
+			status, resp = do(`{"operations":[
+				{"op":"set_rate","rate":800},
+				{"op":"resume_ingest"},
+				{"op":"create_counter","counter":{"name":"download"}},
+				{"op":"create_counter","counter":{"name":"events"}},
+				{"op":"toggle_limiter","enabled":true}
+			]}`)
+			assert.Equal(t, http.StatusConflict, status)
+			assert.False(t, resp.Applied)
+			assert.Equal(t, []string{"rolled_back", "rolled_back", "rolled_back", "failed", "skipped"}, batchStatuses(resp))
+			assert.Equal(t, int64(500), rl.Rate())
+			assert.True(t, sw.Paused())
+			_, ok = registry.Info("download")
+			assert.False(t, ok)
+
+			status, _ = do(`{"operations":[]}`)
+			assert.Equal(t, http.StatusBadRequest, status)
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package integration_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+
+	"github.com/mant7s/qps-counter/internal/api"
+)
+
+// TestCacheHeaders 两种路由器的 /qps 返回ETag和Cache-Control，If-None-Match匹配时返回304
+func TestCacheHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, gs, rl, _ := newCollectTestComponents(t)
+
+	type response struct {
+		code         int
+		etag         string
+		cacheControl string
+		body         []byte
+	}
+
+	newGet := func(opts api.RouterOptions) map[string]func(path, ifNoneMatch string) response {
+		ginRouter := api.NewRouter(opts)
+		fastRouter := api.NewFastHTTPRouter(opts).Handler()
+		return map[string]func(path, ifNoneMatch string) response{
+			"gin": func(path, ifNoneMatch string) response {
+				w := httptest.NewRecorder()
+				req, _ := http.NewRequest("GET", path, nil)
+				if ifNoneMatch != "" {
+					req.Header.Set("If-None-Match", ifNoneMatch)
+				}
+				ginRouter.ServeHTTP(w, req)
+				return response{w.Code, w.Header().Get("ETag"), w.Header().Get("Cache-Control"), w.Body.Bytes()}
+			},
+			"fasthttp": func(path, ifNoneMatch string) response {
+				var ctx fasthttp.RequestCtx
+				ctx.Request.Header.SetMethod("GET")
+				ctx.Request.SetRequestURI(path)
+				if ifNoneMatch != "" {
+					ctx.Request.Header.Set("If-None-Match", ifNoneMatch)
+				}
+				fastRouter(&ctx)
+				return response{ctx.Response.StatusCode(), string(ctx.Response.Header.Peek("ETag")),
+					string(ctx.Response.Header.Peek("Cache-Control")), ctx.Response.Body()}
+			},
+		}
+	}
+
+	for name, get := range newGet(api.RouterOptions{Counter: c, GracefulShutdown: gs, RateLimiter: rl}) {
+		t.Run(name, func(t *testing.T) {
+			first := get("/qps", "")
+			require.Equal(t, http.StatusOK, first.code)
+			assert.Regexp(t, `^W/"[0-9a-f]{16}"$`, first.etag)
+			assert.Equal(t, "no-cache", first.cacheControl)
+			assert.JSONEq(t, `{"qps":0}`, string(first.body))
+
+			// 内容未变化时返回不带响应体的304
+			notModified := get("/qps", first.etag)
+			assert.Equal(t, http.StatusNotModified, notModified.code)
+			assert.Equal(t, first.etag, notModified.etag)
+			assert.Empty(t, notModified.body)
+			assert.Equal(t, http.StatusNotModified, get("/qps", `"other", `+first.etag).code)
+
+			// 不匹配时返回完整响应
+			other := get("/qps", `W/"0000000000000000"`)
+			assert.Equal(t, http.StatusOK, other.code)
+			assert.Equal(t, first.body, other.body)
+
+			stats := get("/stats", "")
+			assert.Equal(t, http.StatusOK, stats.code)
+			assert.NotEmpty(t, stats.etag)
+
+			// 其他查询接口不设置ETag
+			assert.Empty(t, get("/rate", "").etag)
+		})
+	}
+
+	for name, get := range newGet(api.RouterOptions{Counter: c, GracefulShutdown: gs, RateLimiter: rl, CacheMaxAge: 1500 * time.Millisecond}) {
+		t.Run(name+"/max-age", func(t *testing.T) {
+			resp := get("/qps/history", "")
+			assert.Equal(t, http.StatusServiceUnavailable, resp.code) // 未启用历史记录
+			assert.Empty(t, resp.etag, "只有成功的响应设置ETag")
+
+			assert.Equal(t, "public, max-age=2", get("/qps", "").cacheControl)
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package integration_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mant7s/qps-counter/internal/api"
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/counter"
+)
+
+func TestQueryClients(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	c, gs, rl, m := newCollectTestComponents(t)
+	ct := counter.NewClientTracker(&config.CounterConfig{
+		WindowSize: time.Second,
+		SlotNum:    10,
+		Precision:  100 * time.Millisecond,
+	})
+	t.Cleanup(ct.Stop)
+	router := api.NewRouter(api.RouterOptions{Counter: c, GracefulShutdown: gs, RateLimiter: rl, ClientTracker: ct, Metrics: m, MetricsEndpoint: "/metrics", MetricsEnabled: true})
+
+	for i, agent := range []string{"agent/2.0", "agent/2.0", "agent/1.9"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/collect", strings.NewReader(`{"count":1}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", agent)
+		req.Header.Set("X-API-Key", "key-"+string(rune('a'+i%2)))
+		req.RemoteAddr = "192.168.7.10:1234"
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusAccepted, w.Code)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/clients?top=1", nil)
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp struct {
+		Clients map[string][]counter.ClientStat `json:"clients"`
+		Tracked map[string]int                  `json:"tracked"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, []counter.ClientStat{{Value: "agent/2.0", QPS: 2}}, resp.Clients[counter.ClientUserAgent])
+	assert.Equal(t, []counter.ClientStat{{Value: "192.168.7.0/24", QPS: 3}}, resp.Clients[counter.ClientIPPrefix])
+	assert.Len(t, resp.Clients[counter.ClientAPIKey], 1)
+	assert.Equal(t, 2, resp.Tracked[counter.ClientUserAgent])
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/clients?top=0", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
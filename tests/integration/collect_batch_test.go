@@ -0,0 +1,123 @@
+package integration_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+
+	"github.com/mant7s/qps-counter/internal/api"
+	"github.com/mant7s/qps-counter/internal/limiter"
+)
+
+// collectBatchCase 批量上报接口的测试用例
+type collectBatchCase struct {
+	name        string
+	contentType string
+	body        string
+	wantStatus  int
+	wantCount   int64
+	wantResult  string
+}
+
+var collectBatchCases = []collectBatchCase{
+	{"JSON数组", "application/json", `[{"count":3},{"version":2,"key":"checkout","count":4},{"count":1}]`,
+		http.StatusAccepted, 8, `{"accepted":3,"rejected":0,"aborted":false}`},
+	{"NDJSON", api.CollectBatchNDJSONContentType, "{\"count\":2}\n{\"version\":2,\"count\":5}\n",
+		http.StatusAccepted, 7, `{"accepted":2,"rejected":0,"aborted":false}`},
+	{"拒绝无效条目并继续", "application/json", `[{"count":3},{"version":2,"count":-1},{"version":9},{"count":1}]`,
+		http.StatusAccepted, 4, `{"accepted":2,"rejected":2,"aborted":false,"errors":[{"index":1,"error":"count不能为负数"},{"index":2,"error":"不支持的数据版本"}]}`},
+	{"空数组", "application/json", `[]`,
+		http.StatusAccepted, 0, `{"accepted":0,"rejected":0,"aborted":false}`},
+	{"格式错误时中止并保留已写入的条目", "application/json", `[{"count":3},{"count":2},{"count":`,
+		http.StatusBadRequest, 5, `{"accepted":2,"rejected":0,"aborted":true,"abort_index":2,"abort_reason":"unexpected EOF"}`},
+	{"不是数组", "application/json", `{"count":1}`,
+		http.StatusBadRequest, 0, `{"accepted":0,"rejected":0,"aborted":true,"abort_index":0,"abort_reason":"批量上报必须是JSON数组或NDJSON"}`},
+}
+
+func TestCollectBatch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	for _, tc := range collectBatchCases {
+		t.Run("gin/"+tc.name, func(t *testing.T) {
+			c, gs, rl, m := newCollectTestComponents(t)
+			router := api.NewRouter(api.RouterOptions{Counter: c, GracefulShutdown: gs, RateLimiter: rl, Metrics: m})
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/collect/batch", strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", tc.contentType)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.wantStatus, w.Code, w.Body.String())
+			assert.JSONEq(t, tc.wantResult, w.Body.String())
+			assert.Equal(t, tc.wantCount, c.CurrentQPS())
+		})
+
+		t.Run("fasthttp/"+tc.name, func(t *testing.T) {
+			c, gs, rl, m := newCollectTestComponents(t)
+			router := api.NewFastHTTPRouter(api.RouterOptions{Counter: c, GracefulShutdown: gs, RateLimiter: rl, Metrics: m})
+
+			var ctx fasthttp.RequestCtx
+			ctx.Request.Header.SetMethod("POST")
+			ctx.Request.SetRequestURI("/collect/batch")
+			ctx.Request.Header.SetContentType(tc.contentType)
+			ctx.Request.SetBodyString(tc.body)
+			router.CollectHandler()(&ctx)
+
+			assert.Equal(t, tc.wantStatus, ctx.Response.StatusCode(), string(ctx.Response.Body()))
+			assert.JSONEq(t, tc.wantResult, string(ctx.Response.Body()))
+			assert.Equal(t, tc.wantCount, c.CurrentQPS())
+		})
+	}
+}
+
+// TestCollectBatchAbort 被限流或拒绝条目过多时中止，已写入的条目保留
+func TestCollectBatchAbort(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	t.Run("被限流", func(t *testing.T) {
+		c, gs, _, m := newCollectTestComponents(t)
+		rl := limiter.NewRateLimiter(1, 3, true)
+		router := api.NewRouter(api.RouterOptions{Counter: c, GracefulShutdown: gs, RateLimiter: rl, Metrics: m})
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/collect/batch", strings.NewReader(strings.Repeat("{\"count\":1}\n", 10)))
+		req.Header.Set("Content-Type", api.CollectBatchNDJSONContentType)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		var result api.CollectBatchResult
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+		assert.True(t, result.Aborted)
+		assert.Equal(t, 3, result.Accepted)
+		require.NotNil(t, result.AbortIndex)
+		assert.Equal(t, 3, *result.AbortIndex)
+		assert.Equal(t, int64(3), c.CurrentQPS())
+	})
+
+	t.Run("拒绝条目过多", func(t *testing.T) {
+		c, gs, rl, m := newCollectTestComponents(t)
+		router := api.NewRouter(api.RouterOptions{Counter: c, GracefulShutdown: gs, RateLimiter: rl, Metrics: m})
+
+		body := "[" + strings.Repeat(`{"count":1},{"version":9},`, 150) + `{"count":1}]`
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/collect/batch", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		var result api.CollectBatchResult
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+		assert.True(t, result.Aborted)
+		assert.Equal(t, 100, result.Rejected)
+		assert.Equal(t, 100, result.Accepted)
+		assert.Equal(t, 200, *result.AbortIndex)
+		assert.Equal(t, int64(100), c.CurrentQPS())
+	})
+}
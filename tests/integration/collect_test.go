@@ -0,0 +1,647 @@
+package integration_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+
+	"github.com/mant7s/qps-counter/internal/api"
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/counter"
+	"github.com/mant7s/qps-counter/internal/limiter"
+	"github.com/mant7s/qps-counter/internal/metrics"
+	"github.com/mant7s/qps-counter/internal/storage"
+)
+
+// collectCase 上报接口的测试用例
+type collectCase struct {
+	name        string
+	contentType string
+	body        string
+	wantStatus  int
+	wantCount   int64
+}
+
+var collectCases = []collectCase{
+	{"v1格式", "application/json", `{"count":3}`, http.StatusAccepted, 3},
+	{"v1格式忽略未知字段", "application/json", `{"count":2,"extra":true}`, http.StatusAccepted, 2},
+	{"v2格式通过version字段协商", "application/json", `{"version":2,"key":"checkout","count":4,"attributes":{"route":"/pay"}}`, http.StatusAccepted, 4},
+	{"v2格式通过Content-Type协商", api.CollectV2ContentType, `{"key":"checkout"}`, http.StatusAccepted, 1},
+	{"超出窗口的timestamp被丢弃", api.CollectV2ContentType, `{"key":"checkout","timestamp":1700000000000}`, http.StatusAccepted, 0},
+	{"v1格式拒绝负数timestamp", "application/json", `{"count":1,"timestamp":-1}`, http.StatusBadRequest, 0},
+	{"v2格式拒绝负数", api.CollectV2ContentType, `{"count":-1}`, http.StatusBadRequest, 0},
+	{"不支持的版本", "application/json", `{"version":3,"count":1}`, http.StatusBadRequest, 0},
+	{"Content-Type与version冲突", api.CollectV2ContentType, `{"version":1,"count":1}`, http.StatusBadRequest, 0},
+	{"无效的JSON", "application/json", `{"count":`, http.StatusBadRequest, 0},
+	{"v1格式附带延迟", "application/json", `{"count":1,"latency_ms":12.5}`, http.StatusAccepted, 1},
+	{"拒绝负数延迟", api.CollectV2ContentType, `{"latency_ms":-1}`, http.StatusBadRequest, 0},
+}
+
+func newCollectTestComponents(t *testing.T) (counter.Counter, *counter.EnhancedGracefulShutdown, *limiter.RateLimiter, *metrics.Metrics) {
+	initTestLogger()
+	c := counter.NewCounter(&config.CounterConfig{
+		Type:       counter.LockFreeType,
+		WindowSize: time.Second,
+		SlotNum:    10,
+		Precision:  100 * time.Millisecond,
+	})
+	t.Cleanup(c.Stop)
+
+	gs := counter.NewEnhancedGracefulShutdown(time.Second, 2*time.Second)
+	rl := limiter.NewRateLimiter(10000, 10000, false)
+	return c, gs, rl, metrics.NewMetrics(c)
+}
+
+func TestCollectPayloadVersions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	for _, tc := range collectCases {
+		t.Run("gin/"+tc.name, func(t *testing.T) {
+			c, gs, rl, m := newCollectTestComponents(t)
+			router := api.NewRouter(api.RouterOptions{Counter: c, GracefulShutdown: gs, RateLimiter: rl, Metrics: m, MetricsEndpoint: "/metrics", MetricsEnabled: true})
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/collect", strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", tc.contentType)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.wantStatus, w.Code, w.Body.String())
+			assert.Equal(t, tc.wantCount, c.CurrentQPS())
+		})
+
+		t.Run("fasthttp/"+tc.name, func(t *testing.T) {
+			c, gs, rl, m := newCollectTestComponents(t)
+			router := api.NewFastHTTPRouter(api.RouterOptions{Counter: c, GracefulShutdown: gs, RateLimiter: rl, Metrics: m, MetricsEndpoint: "/metrics", MetricsEnabled: true})
+
+			var ctx fasthttp.RequestCtx
+			ctx.Request.Header.SetMethod("POST")
+			ctx.Request.SetRequestURI("/collect")
+			ctx.Request.Header.SetContentType(tc.contentType)
+			ctx.Request.SetBodyString(tc.body)
+			router.Handler()(&ctx)
+
+			assert.Equal(t, tc.wantStatus, ctx.Response.StatusCode(), string(ctx.Response.Body()))
+			assert.Equal(t, tc.wantCount, c.CurrentQPS())
+		})
+	}
+}
+
+// TestFastHTTPCollectHandler 与Gin同时运行时fasthttp只处理上报请求
+func TestFastHTTPCollectHandler(t *testing.T) {
+	c, gs, rl, m := newCollectTestComponents(t)
+	registry := counter.NewRegistry(config.CounterConfig{
+		Type:       counter.LockFreeType,
+		WindowSize: time.Second,
+		SlotNum:    10,
+		Precision:  100 * time.Millisecond,
+	}, storage.NewMemoryStorage(), 0)
+	t.Cleanup(registry.Stop)
+	_, err := registry.Create(counter.CounterSpec{Name: "upload"})
+	assert.NoError(t, err)
+
+	handler := api.NewFastHTTPRouter(api.RouterOptions{Counter: c, GracefulShutdown: gs, RateLimiter: rl, Registry: registry, Metrics: m, MetricsEndpoint: "/metrics", MetricsEnabled: true}).CollectHandler()
+	do := func(method, path string) int {
+		var ctx fasthttp.RequestCtx
+		ctx.Request.Header.SetMethod(method)
+		ctx.Request.SetRequestURI(path)
+		ctx.Request.Header.SetContentType("application/json")
+		ctx.Request.SetBodyString(`{"count":2}`)
+		handler(&ctx)
+		return ctx.Response.StatusCode()
+	}
+
+	assert.Equal(t, http.StatusAccepted, do("POST", "/collect"))
+	assert.Equal(t, http.StatusAccepted, do("POST", "/counters/upload/collect"))
+	assert.Equal(t, http.StatusOK, do("GET", "/healthz"))
+	assert.Equal(t, int64(2), c.CurrentQPS())
+
+	// 管理和查询接口由Gin提供
+	for _, path := range []string{"/stats", "/qps", "/counters", "/counters/upload", "/metrics"} {
+		assert.Equal(t, http.StatusNotFound, do("GET", path), path)
+	}
+	assert.Equal(t, http.StatusNotFound, do("POST", "/limiter/rate"))
+	assert.Equal(t, http.StatusNotFound, do("POST", "/counters/upload/extra/collect"))
+}
+
+// TestCollectCost 上报请求通过cost参数声明消耗的令牌数
+func TestCollectCost(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	type doFunc func(query string) int
+
+	servers := map[string]func(opts api.RouterOptions) doFunc{
+		"gin": func(opts api.RouterOptions) doFunc {
+			router := api.NewRouter(opts)
+			return func(query string) int {
+				w := httptest.NewRecorder()
+				req, _ := http.NewRequest("POST", "/collect"+query, strings.NewReader(`{"count":1}`))
+				req.Header.Set("Content-Type", "application/json")
+				router.ServeHTTP(w, req)
+				return w.Code
+			}
+		},
+		"fasthttp": func(opts api.RouterOptions) doFunc {
+			handler := api.NewFastHTTPRouter(opts).Handler()
+			return func(query string) int {
+				var ctx fasthttp.RequestCtx
+				ctx.Request.Header.SetMethod("POST")
+				ctx.Request.SetRequestURI("/collect" + query)
+				ctx.Request.Header.SetContentType("application/json")
+				ctx.Request.SetBodyString(`{"count":1}`)
+				handler(&ctx)
+				return ctx.Response.StatusCode()
+			}
+		},
+	}
+
+	for name, newServer := range servers {
+		t.Run(name, func(t *testing.T) {
+			c, gs, _, m := newCollectTestComponents(t)
+			rl := limiter.NewRateLimiter(1, 10, false)
+			rl.SetCostLimits(0, 8)
+			do := newServer(api.RouterOptions{Counter: c, GracefulShutdown: gs, RateLimiter: rl, Metrics: m})
+
+			assert.Equal(t, http.StatusBadRequest, do("?cost=9"), "超过max_cost")
+			assert.Equal(t, http.StatusBadRequest, do("?cost=0"))
+			assert.Equal(t, http.StatusBadRequest, do("?cost=abc"))
+
+			assert.Equal(t, http.StatusAccepted, do("?cost=8"))
+			assert.Equal(t, http.StatusAccepted, do(""), "未声明时消耗1个令牌")
+			assert.Equal(t, http.StatusTooManyRequests, do("?cost=2"))
+			assert.Equal(t, http.StatusAccepted, do("?cost=1"))
+			assert.Equal(t, int64(3), c.CurrentQPS(), "cost不影响计数值")
+		})
+	}
+}
+
+// TestCollectKeyed 上报数据中的key分别计数，通过 /qps?key= 查询
+func TestCollectKeyed(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	newOptions := func(t *testing.T) (api.RouterOptions, counter.Counter) {
+		c, gs, rl, m := newCollectTestComponents(t)
+		keyed := counter.NewKeyedCounter(&config.CounterConfig{WindowSize: time.Second, SlotNum: 10, Precision: 100 * time.Millisecond})
+		return api.RouterOptions{Counter: c, GracefulShutdown: gs, RateLimiter: rl, KeyedCounter: keyed, Metrics: m}, c
+	}
+	bodies := []string{`{"key":"checkout","count":5}`, `{"version":2,"key":"checkout","count":2}`, `{"key":"search","count":1}`, `{"count":4}`}
+
+	t.Run("gin", func(t *testing.T) {
+		opts, c := newOptions(t)
+		router := api.NewRouter(opts)
+		do := func(method, path, body string) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(method, path, strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+			return w
+		}
+		for _, body := range bodies {
+			assert.Equal(t, http.StatusAccepted, do("POST", "/collect", body).Code)
+		}
+
+		assert.Equal(t, int64(12), c.CurrentQPS())
+		assert.JSONEq(t, `{"key":"checkout","qps":7,"tracked":true}`, do("GET", "/qps?key=checkout", "").Body.String())
+		assert.JSONEq(t, `{"key":"missing","qps":0,"tracked":false}`, do("GET", "/qps?key=missing", "").Body.String())
+		assert.JSONEq(t, `{"qps":12}`, do("GET", "/qps", "").Body.String())
+		assert.JSONEq(t, `{"keys":[{"key":"checkout","qps":7}],"tracked":2,"max_keys":1000,"overflow":0,"evicted":0}`, do("GET", "/qps/keys?top=1", "").Body.String())
+
+		opts.KeyedCounter = nil
+		router = api.NewRouter(opts)
+		assert.Equal(t, http.StatusServiceUnavailable, do("GET", "/qps?key=checkout", "").Code)
+		assert.Equal(t, http.StatusOK, do("GET", "/qps", "").Code)
+	})
+
+	t.Run("fasthttp", func(t *testing.T) {
+		opts, c := newOptions(t)
+		handler := api.NewFastHTTPRouter(opts).Handler()
+		do := func(method, path, body string) *fasthttp.RequestCtx {
+			var ctx fasthttp.RequestCtx
+			ctx.Request.Header.SetMethod(method)
+			ctx.Request.SetRequestURI(path)
+			ctx.Request.Header.SetContentType("application/json")
+			ctx.Request.SetBodyString(body)
+			handler(&ctx)
+			return &ctx
+		}
+		for _, body := range bodies {
+			assert.Equal(t, http.StatusAccepted, do("POST", "/collect", body).Response.StatusCode())
+		}
+
+		assert.Equal(t, int64(12), c.CurrentQPS())
+		assert.JSONEq(t, `{"key":"checkout","qps":7,"tracked":true}`, string(do("GET", "/qps?key=checkout", "").Response.Body()))
+		assert.JSONEq(t, `{"keys":[{"key":"checkout","qps":7},{"key":"search","qps":1}],"next_cursor":"","total_estimate":2,"tracked":2,"max_keys":1000,"overflow":0,"evicted":0}`, string(do("GET", "/qps/keys", "").Response.Body()))
+	})
+}
+
+// TestKeysPagination /qps/keys 按cursor分页，翻页结果不重复也不遗漏
+func TestKeysPagination(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, gs, rl, m := newCollectTestComponents(t)
+	keyed := counter.NewKeyedCounter(&config.CounterConfig{WindowSize: time.Second, SlotNum: 10, Precision: 100 * time.Millisecond})
+	for i := 0; i < 250; i++ {
+		keyed.Add(fmt.Sprintf("key-%03d", i), int64(i%5+1))
+	}
+	opts := api.RouterOptions{Counter: c, GracefulShutdown: gs, RateLimiter: rl, KeyedCounter: keyed, Metrics: m}
+	router := api.NewRouter(opts)
+
+	type keysPage struct {
+		Keys          []counter.KeyQPS `json:"keys"`
+		NextCursor    string           `json:"next_cursor"`
+		TotalEstimate int              `json:"total_estimate"`
+	}
+	get := func(path string) (int, keysPage) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		router.ServeHTTP(w, req)
+		var page keysPage
+		json.Unmarshal(w.Body.Bytes(), &page)
+		return w.Code, page
+	}
+	walk := func(query string) []counter.KeyQPS {
+		var all []counter.KeyQPS
+		cursor := ""
+		for pages := 0; pages < 10; pages++ {
+			code, page := get("/qps/keys?" + query + "&cursor=" + cursor)
+			require.Equal(t, http.StatusOK, code)
+			assert.Equal(t, 250, page.TotalEstimate)
+			all = append(all, page.Keys...)
+			if page.NextCursor == "" {
+				return all
+			}
+			cursor = page.NextCursor
+		}
+		t.Fatal("分页没有结束")
+		return nil
+	}
+
+	byName := walk("sort=name&limit=100")
+	require.Len(t, byName, 250)
+	for i, k := range byName {
+		assert.Equal(t, fmt.Sprintf("key-%03d", i), k.Key)
+	}
+
+	byQPS := walk("limit=60")
+	require.Len(t, byQPS, 250)
+	assert.True(t, slices.IsSortedFunc(byQPS, func(a, b counter.KeyQPS) int {
+		if a.QPS != b.QPS {
+			return int(b.QPS - a.QPS)
+		}
+		return strings.Compare(a.Key, b.Key)
+	}))
+
+	// 默认每页100个
+	_, first := get("/qps/keys")
+	assert.Len(t, first.Keys, 100)
+	assert.NotEmpty(t, first.NextCursor)
+
+	for _, path := range []string{"/qps/keys?limit=0", "/qps/keys?limit=1001", "/qps/keys?sort=size", "/qps/keys?cursor=abc", "/qps/keys?sort=name&cursor=" + first.NextCursor} {
+		code, _ := get(path)
+		assert.Equal(t, http.StatusBadRequest, code, path)
+	}
+
+	handler := api.NewFastHTTPRouter(opts).Handler()
+	var ctx fasthttp.RequestCtx
+	ctx.Request.SetRequestURI("/qps/keys?sort=name&limit=1&cursor=" + first.NextCursor)
+	handler(&ctx)
+	assert.Equal(t, http.StatusBadRequest, ctx.Response.StatusCode(), "cursor与sort不匹配")
+}
+
+func TestCollectMultiWindow(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	newOptions := func(t *testing.T) api.RouterOptions {
+		c, gs, rl, m := newCollectTestComponents(t)
+		windows := counter.NewMultiWindow(c, &config.CounterConfig{SlotNum: 10, Windows: []time.Duration{time.Second, 10 * time.Second, time.Minute}})
+		return api.RouterOptions{Counter: windows, GracefulShutdown: gs, RateLimiter: rl, Metrics: m}
+	}
+	expected := `{"qps":60,"qps_1s":60,"qps_10s":6,"qps_1m":1}`
+
+	t.Run("gin", func(t *testing.T) {
+		router := api.NewRouter(newOptions(t))
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/collect", strings.NewReader(`{"count":60}`))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusAccepted, w.Code)
+
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("GET", "/qps", nil)
+		router.ServeHTTP(w, req)
+		assert.JSONEq(t, expected, w.Body.String())
+	})
+
+	t.Run("fasthttp", func(t *testing.T) {
+		handler := api.NewFastHTTPRouter(newOptions(t)).Handler()
+		var ctx fasthttp.RequestCtx
+		ctx.Request.Header.SetMethod("POST")
+		ctx.Request.SetRequestURI("/collect")
+		ctx.Request.Header.SetContentType("application/json")
+		ctx.Request.SetBodyString(`{"count":60}`)
+		handler(&ctx)
+		assert.Equal(t, http.StatusAccepted, ctx.Response.StatusCode())
+
+		var query fasthttp.RequestCtx
+		query.Request.Header.SetMethod("GET")
+		query.Request.SetRequestURI("/qps")
+		handler(&query)
+		assert.JSONEq(t, expected, string(query.Response.Body()))
+	})
+}
+
+// TestCollectTimestamp 携带timestamp的上报计入事件时间所在的槽位
+func TestCollectTimestamp(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	body := func(delay time.Duration) string {
+		return fmt.Sprintf(`{"count":5,"timestamp":%d}`, time.Now().Add(-delay).UnixMilli())
+	}
+	check := func(t *testing.T, c counter.Counter, before counter.LateStats) {
+		after := counter.LateEvents()
+		assert.Equal(t, int64(1), after.Placed-before.Placed)
+		assert.Equal(t, int64(1), after.Dropped-before.Dropped)
+		assert.Equal(t, int64(5), c.CurrentQPS())
+		// 延迟500ms的事件写入当时的槽位，当前时间的槽位没有计数
+		assert.Equal(t, 1, c.Stats().OccupiedSlots)
+		assert.Equal(t, int64(0), counter.SlotInfo(c)["slot_count"])
+	}
+
+	t.Run("gin", func(t *testing.T) {
+		c, gs, rl, m := newCollectTestComponents(t)
+		router := api.NewRouter(api.RouterOptions{Counter: c, GracefulShutdown: gs, RateLimiter: rl, Metrics: m})
+		before := counter.LateEvents()
+		for _, delay := range []time.Duration{500 * time.Millisecond, time.Minute} {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/collect", strings.NewReader(body(delay)))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusAccepted, w.Code)
+		}
+		check(t, c, before)
+	})
+
+	t.Run("fasthttp", func(t *testing.T) {
+		c, gs, rl, m := newCollectTestComponents(t)
+		handler := api.NewFastHTTPRouter(api.RouterOptions{Counter: c, GracefulShutdown: gs, RateLimiter: rl, Metrics: m}).Handler()
+		before := counter.LateEvents()
+		for _, delay := range []time.Duration{500 * time.Millisecond, time.Minute} {
+			var ctx fasthttp.RequestCtx
+			ctx.Request.Header.SetMethod("POST")
+			ctx.Request.SetRequestURI("/collect")
+			ctx.Request.Header.SetContentType("application/json")
+			ctx.Request.SetBodyString(body(delay))
+			handler(&ctx)
+			assert.Equal(t, http.StatusAccepted, ctx.Response.StatusCode())
+		}
+		check(t, c, before)
+	})
+}
+
+func TestCollectLatency(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	newOptions := func(t *testing.T) api.RouterOptions {
+		c, gs, rl, m := newCollectTestComponents(t)
+		latency := counter.NewLatencyHistogram(&config.CounterConfig{SlotNum: 10})
+		return api.RouterOptions{Counter: c, GracefulShutdown: gs, RateLimiter: rl, Metrics: m, Latency: latency}
+	}
+	bodies := []string{`{"count":1,"latency_ms":10}`, `{"count":1,"latency_ms":10}`, `{"count":1,"latency_ms":10}`, `{"count":1,"latency_ms":200}`, `{"count":1}`}
+
+	// 4次带延迟的上报，p50落在10ms的桶内，p99为200ms所在的桶
+	assertLatency := func(t *testing.T, body []byte) {
+		var stats struct {
+			Latency counter.LatencyStats `json:"latency"`
+		}
+		assert.NoError(t, json.Unmarshal(body, &stats))
+		assert.Equal(t, "1m", stats.Latency.Window)
+		assert.Equal(t, int64(4), stats.Latency.Count)
+		assert.InDelta(t, 10, stats.Latency.P50, 10*0.07)
+		assert.InDelta(t, 200, stats.Latency.P99, 200*0.07)
+		assert.InDelta(t, 57.5, stats.Latency.Mean, 0.01)
+	}
+
+	t.Run("gin", func(t *testing.T) {
+		router := api.NewRouter(newOptions(t))
+		for _, body := range bodies {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/collect", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusAccepted, w.Code)
+		}
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/stats", nil)
+		router.ServeHTTP(w, req)
+		assertLatency(t, w.Body.Bytes())
+	})
+
+	t.Run("fasthttp", func(t *testing.T) {
+		handler := api.NewFastHTTPRouter(newOptions(t)).Handler()
+		for _, body := range bodies {
+			var ctx fasthttp.RequestCtx
+			ctx.Request.Header.SetMethod("POST")
+			ctx.Request.SetRequestURI("/collect")
+			ctx.Request.Header.SetContentType("application/json")
+			ctx.Request.SetBodyString(body)
+			handler(&ctx)
+			assert.Equal(t, http.StatusAccepted, ctx.Response.StatusCode())
+		}
+
+		var query fasthttp.RequestCtx
+		query.Request.Header.SetMethod("GET")
+		query.Request.SetRequestURI("/stats")
+		handler(&query)
+		assertLatency(t, query.Response.Body())
+	})
+}
+
+// TestCollectWeight 上报的weight计入与QPS并行的加权速率，/v1/qps和/stats返回
+func TestCollectWeight(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	newOptions := func(t *testing.T) api.RouterOptions {
+		c, gs, rl, m := newCollectTestComponents(t)
+		weighted := counter.NewWeightedWindow(&config.CounterConfig{WindowSize: 10 * time.Second, SlotNum: 10, Precision: time.Second, Weighted: config.WeightedConfig{Enabled: true, Unit: "bytes"}})
+		return api.RouterOptions{Counter: c, GracefulShutdown: gs, RateLimiter: rl, Metrics: m, Weighted: weighted}
+	}
+	bodies := []struct {
+		body string
+		code int
+	}{
+		{`{"count":1,"weight":1000.5}`, http.StatusAccepted},
+		{`{"version":2,"count":3,"weight":23.5}`, http.StatusAccepted},
+		{`{"count":1}`, http.StatusAccepted},
+		{`{"count":1,"weight":-1}`, http.StatusBadRequest},
+		{`{"version":2,"weight":-0.5}`, http.StatusBadRequest},
+	}
+
+	assertWeighted := func(t *testing.T, v1, stats []byte) {
+		var qps struct {
+			Weighted struct {
+				Rate float64 `json:"rate"`
+				Unit string  `json:"unit"`
+				Per  string  `json:"per"`
+			} `json:"weighted"`
+		}
+		require.NoError(t, json.Unmarshal(v1, &qps))
+		assert.InDelta(t, 102.4, qps.Weighted.Rate, 0.001)
+		assert.Equal(t, "bytes", qps.Weighted.Unit)
+		assert.Equal(t, "second", qps.Weighted.Per)
+
+		var resp struct {
+			Weighted counter.WeightedStats `json:"weighted"`
+		}
+		require.NoError(t, json.Unmarshal(stats, &resp))
+		assert.Equal(t, counter.WeightedStats{Unit: "bytes", Window: "10s", Events: 2, Total: 1024, Rate: 102.4}, resp.Weighted)
+	}
+
+	t.Run("gin", func(t *testing.T) {
+		router := api.NewRouter(newOptions(t))
+		for _, tc := range bodies {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/collect", strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tc.code, w.Code, tc.body)
+		}
+
+		get := func(path string) []byte {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", path, nil)
+			router.ServeHTTP(w, req)
+			return w.Body.Bytes()
+		}
+		assertWeighted(t, get("/v1/qps"), get("/stats"))
+	})
+
+	t.Run("fasthttp", func(t *testing.T) {
+		handler := api.NewFastHTTPRouter(newOptions(t)).Handler()
+		for _, tc := range bodies {
+			var ctx fasthttp.RequestCtx
+			ctx.Request.Header.SetMethod("POST")
+			ctx.Request.SetRequestURI("/collect")
+			ctx.Request.Header.SetContentType("application/json")
+			ctx.Request.SetBodyString(tc.body)
+			handler(&ctx)
+			assert.Equal(t, tc.code, ctx.Response.StatusCode(), tc.body)
+		}
+
+		get := func(path string) []byte {
+			var ctx fasthttp.RequestCtx
+			ctx.Request.Header.SetMethod("GET")
+			ctx.Request.SetRequestURI(path)
+			handler(&ctx)
+			return ctx.Response.Body()
+		}
+		assertWeighted(t, get("/v1/qps"), get("/stats"))
+	})
+}
+
+// TestQueryLatency /latency 按key和标签组合返回上报的延迟分布
+func TestQueryLatency(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	newOptions := func(t *testing.T) api.RouterOptions {
+		c, gs, rl, m := newCollectTestComponents(t)
+		cfg := &config.CounterConfig{
+			SlotNum: 10,
+			Tags:    config.TagsConfig{Keys: []string{"route"}},
+			Latency: config.LatencyConfig{Enabled: true, PerKey: true, PerTag: true},
+		}
+		return api.RouterOptions{Counter: c, GracefulShutdown: gs, RateLimiter: rl, Metrics: m,
+			Latency: counter.NewLatencyHistogram(cfg), LatencySeries: counter.NewLatencySeries(cfg)}
+	}
+	bodies := []string{
+		`{"version":2,"key":"checkout","count":1,"latency_ms":10,"attributes":{"route":"/pay"}}`,
+		`{"version":2,"key":"checkout","count":1,"latency_ms":10,"attributes":{"route":"/pay"}}`,
+		`{"version":2,"key":"search","count":1,"latency_ms":300,"attributes":{"route":"/search"}}`,
+	}
+
+	type response struct {
+		code int
+		body []byte
+	}
+	check := func(t *testing.T, get func(path string) response) {
+		var resp struct {
+			Key     string               `json:"key"`
+			Tracked bool                 `json:"tracked"`
+			Series  int                  `json:"series"`
+			Latency counter.LatencyStats `json:"latency"`
+		}
+
+		r := get("/latency?key=checkout")
+		require.Equal(t, http.StatusOK, r.code)
+		require.NoError(t, json.Unmarshal(r.body, &resp))
+		assert.True(t, resp.Tracked)
+		assert.Equal(t, int64(2), resp.Latency.Count)
+		assert.InDelta(t, 10, resp.Latency.P99, 10*0.07)
+
+		r = get("/latency?route=/search")
+		require.Equal(t, http.StatusOK, r.code)
+		require.NoError(t, json.Unmarshal(r.body, &resp))
+		assert.Equal(t, 1, resp.Series)
+		assert.InDelta(t, 300, resp.Latency.P50, 300*0.07)
+
+		r = get("/latency")
+		require.Equal(t, http.StatusOK, r.code)
+		require.NoError(t, json.Unmarshal(r.body, &resp))
+		assert.Equal(t, int64(3), resp.Latency.Count)
+		assert.Equal(t, 4, resp.Series, "2个key和2个标签组合")
+
+		r = get("/latency?key=unknown")
+		require.NoError(t, json.Unmarshal(r.body, &resp))
+		assert.False(t, resp.Tracked)
+
+		assert.Equal(t, http.StatusBadRequest, get("/latency?status=500").code, "未声明的标签")
+		assert.Equal(t, http.StatusBadRequest, get("/latency?key=checkout&route=/pay").code)
+	}
+
+	t.Run("gin", func(t *testing.T) {
+		router := api.NewRouter(newOptions(t))
+		for _, body := range bodies {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/collect", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+			require.Equal(t, http.StatusAccepted, w.Code)
+		}
+		check(t, func(path string) response {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", path, nil)
+			router.ServeHTTP(w, req)
+			return response{w.Code, w.Body.Bytes()}
+		})
+	})
+
+	t.Run("fasthttp", func(t *testing.T) {
+		handler := api.NewFastHTTPRouter(newOptions(t)).Handler()
+		for _, body := range bodies {
+			var ctx fasthttp.RequestCtx
+			ctx.Request.Header.SetMethod("POST")
+			ctx.Request.SetRequestURI("/collect")
+			ctx.Request.Header.SetContentType("application/json")
+			ctx.Request.SetBodyString(body)
+			handler(&ctx)
+			require.Equal(t, http.StatusAccepted, ctx.Response.StatusCode())
+		}
+		check(t, func(path string) response {
+			var ctx fasthttp.RequestCtx
+			ctx.Request.Header.SetMethod("GET")
+			ctx.Request.SetRequestURI(path)
+			handler(&ctx)
+			return response{ctx.Response.StatusCode(), ctx.Response.Body()}
+		})
+	})
+
+	t.Run("未启用延迟统计", func(t *testing.T) {
+		c, gs, rl, _ := newCollectTestComponents(t)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/latency", nil)
+		api.NewRouter(api.RouterOptions{Counter: c, GracefulShutdown: gs, RateLimiter: rl}).ServeHTTP(w, req)
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	})
+}
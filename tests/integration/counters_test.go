@@ -0,0 +1,164 @@
+package integration_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+
+	"github.com/mant7s/qps-counter/internal/api"
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/counter"
+	"github.com/mant7s/qps-counter/internal/storage"
+)
+
+// TestCounterSoftDelete 保留期内删除的计数器出现在列表中，上报返回410，可以通过restore恢复
+// 创建、删除和恢复需要管理员令牌
+func TestCounterSoftDelete(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	type doFunc func(method, path, authorization string) (int, []byte)
+	const admin = "Bearer secret"
+
+	servers := map[string]func(opts api.RouterOptions) doFunc{
+		"gin": func(opts api.RouterOptions) doFunc {
+			router := api.NewRouter(opts)
+			return func(method, path, authorization string) (int, []byte) {
+				w := httptest.NewRecorder()
+				req, _ := http.NewRequest(method, path, strings.NewReader(`{"count":1}`))
+				req.Header.Set("Content-Type", "application/json")
+				if authorization != "" {
+					req.Header.Set("Authorization", authorization)
+				}
+				router.ServeHTTP(w, req)
+				return w.Code, w.Body.Bytes()
+			}
+		},
+		"fasthttp": func(opts api.RouterOptions) doFunc {
+			handler := api.NewFastHTTPRouter(opts).Handler()
+			return func(method, path, authorization string) (int, []byte) {
+				var ctx fasthttp.RequestCtx
+				ctx.Request.Header.SetMethod(method)
+				ctx.Request.SetRequestURI(path)
+				ctx.Request.Header.SetContentType("application/json")
+				if authorization != "" {
+					ctx.Request.Header.Set("Authorization", authorization)
+				}
+				ctx.Request.SetBodyString(`{"count":1}`)
+				handler(&ctx)
+				return ctx.Response.StatusCode(), ctx.Response.Body()
+			}
+		},
+	}
+
+	for name, newServer := range servers {
+		t.Run(name, func(t *testing.T) {
+			c, gs, rl, m := newCollectTestComponents(t)
+			registry := counter.NewRegistry(config.CounterConfig{
+				Type:        counter.LockFreeType,
+				WindowSize:  time.Second,
+				SlotNum:     10,
+				Precision:   100 * time.Millisecond,
+				DeleteGrace: time.Hour,
+			}, storage.NewMemoryStorage(), 0)
+			t.Cleanup(registry.Stop)
+			_, err := registry.Create(counter.CounterSpec{Name: "upload"})
+			require.NoError(t, err)
+			do := newServer(api.RouterOptions{Counter: c, GracefulShutdown: gs, RateLimiter: rl, Registry: registry, AdminToken: "secret", Metrics: m})
+
+			// 没有管理员令牌时不能创建、删除或恢复计数器
+			for _, req := range []struct{ method, path string }{
+				{"POST", "/counters"},
+				{"DELETE", "/counters/upload"},
+				{"POST", "/counters/upload/restore"},
+			} {
+				code, _ := do(req.method, req.path, "")
+				assert.Equal(t, http.StatusUnauthorized, code, req.path)
+				code, _ = do(req.method, req.path, "Bearer wrong")
+				assert.Equal(t, http.StatusUnauthorized, code, req.path)
+			}
+			_, ok := registry.Info("upload")
+			require.True(t, ok)
+
+			code, body := do("DELETE", "/counters/upload", admin)
+			require.Equal(t, http.StatusOK, code, string(body))
+			var deleted map[string]interface{}
+			require.NoError(t, json.Unmarshal(body, &deleted))
+			assert.Equal(t, counter.CounterStateDeleted, deleted["state"])
+			assert.NotEmpty(t, deleted["purge_at"])
+
+			code, _ = do("DELETE", "/counters/upload", admin)
+			assert.Equal(t, http.StatusGone, code)
+			code, _ = do("POST", "/counters/upload/collect", "")
+			assert.Equal(t, http.StatusGone, code)
+
+			code, body = do("GET", "/counters", "")
+			require.Equal(t, http.StatusOK, code)
+			var list struct {
+				Counters []counter.CounterInfo `json:"counters"`
+			}
+			require.NoError(t, json.Unmarshal(body, &list))
+			require.Len(t, list.Counters, 1)
+			assert.Equal(t, counter.CounterStateDeleted, list.Counters[0].State)
+
+			code, body = do("POST", "/counters/upload/restore", admin)
+			require.Equal(t, http.StatusOK, code, string(body))
+			var info counter.CounterInfo
+			require.NoError(t, json.Unmarshal(body, &info))
+			assert.Equal(t, counter.CounterStateActive, info.State)
+
+			code, _ = do("POST", "/counters/upload/collect", "")
+			assert.Equal(t, http.StatusAccepted, code)
+			code, _ = do("POST", "/counters/missing/restore", admin)
+			assert.Equal(t, http.StatusNotFound, code)
+		})
+	}
+}
+
+// TestCounterRollup 通过API创建开启rollup的计数器后，向下级上报的计数可以在各级上级查询到
+func TestCounterRollup(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, gs, rl, m := newCollectTestComponents(t)
+	registry := counter.NewRegistry(config.CounterConfig{
+		Type:       counter.LockFreeType,
+		WindowSize: time.Second,
+		SlotNum:    10,
+		Precision:  100 * time.Millisecond,
+	}, storage.NewMemoryStorage(), 0)
+	t.Cleanup(registry.Stop)
+	router := api.NewRouter(api.RouterOptions{Counter: c, GracefulShutdown: gs, RateLimiter: rl, Registry: registry, AdminToken: "secret", Metrics: m})
+
+	do := func(method, path, body string) (int, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer secret")
+		router.ServeHTTP(w, req)
+		var resp map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp
+	}
+
+	for _, body := range []string{`{"name":"api"}`, `{"name":"api.orders","rollup":true}`, `{"name":"api.orders.create","rollup":true}`} {
+		code, resp := do("POST", "/counters", body)
+		require.Equal(t, http.StatusCreated, code, resp)
+	}
+	code, _ := do("POST", "/counters/api.orders.create/collect", `{"count":4}`)
+	require.Equal(t, http.StatusAccepted, code)
+
+	for _, name := range []string{"api.orders.create", "api.orders", "api"} {
+		code, resp := do("GET", "/counters/"+name, "")
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, float64(4), resp["qps"], name)
+	}
+	_, resp := do("GET", "/counters/api.orders.create", "")
+	assert.Equal(t, []interface{}{"api.orders", "api"}, resp["rollup_to"])
+	assert.Equal(t, true, resp["spec"].(map[string]interface{})["rollup"])
+}
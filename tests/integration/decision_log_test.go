@@ -0,0 +1,78 @@
+package integration_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+
+	"github.com/mant7s/qps-counter/internal/analytics"
+	"github.com/mant7s/qps-counter/internal/api"
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/limiter"
+)
+
+// TestDecisionLog 两种路由器都把被限流的上报连同API Key和租户写入决策日志
+func TestDecisionLog(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, gs, _, m := newCollectTestComponents(t)
+	path := filepath.Join(t.TempDir(), "decisions.jsonl")
+	cfg := config.DecisionLogConfig{Enabled: true, Sink: "file", Path: path}
+	sink, err := analytics.NewSink(cfg, nil)
+	require.NoError(t, err)
+	decisions := analytics.NewDecisionLog(cfg, sink)
+
+	// 每个路由器的突发容量只够放行一个请求
+	newOpts := func() api.RouterOptions {
+		return api.RouterOptions{Counter: c, GracefulShutdown: gs, RateLimiter: limiter.NewRateLimiter(1, 1, false), Metrics: m, DecisionLog: decisions}
+	}
+	ginRouter := api.NewRouter(newOpts())
+	fastRouter := api.NewFastHTTPRouter(newOpts()).Handler()
+
+	statuses := make([]int, 0, 4)
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/collect", strings.NewReader(`{"count":1}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", "gin-key")
+		req.Header.Set("X-Tenant-ID", "acme")
+		ginRouter.ServeHTTP(w, req)
+		statuses = append(statuses, w.Code)
+
+		var ctx fasthttp.RequestCtx
+		ctx.Request.Header.SetMethod("POST")
+		ctx.Request.SetRequestURI("/collect/batch")
+		ctx.Request.Header.SetContentType("application/json")
+		ctx.Request.Header.Set("X-API-Key", "fast-key")
+		ctx.Request.SetBodyString(`[{"count":1}]`)
+		fastRouter(&ctx)
+		statuses = append(statuses, ctx.Response.StatusCode())
+	}
+	assert.Equal(t, []int{http.StatusAccepted, http.StatusAccepted, http.StatusTooManyRequests, http.StatusTooManyRequests}, statuses)
+
+	decisions.Stop()
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+	var got []analytics.Decision
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var d analytics.Decision
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &d))
+		got = append(got, d)
+	}
+
+	// 默认只记录拒绝
+	require.Len(t, got, 2)
+	assert.Equal(t, analytics.Decision{Time: got[0].Time, Limited: true, Rule: limiter.DefaultRule, Action: limiter.ActionReject, Key: "gin-key", Tenant: "acme", Method: "POST", Path: "/collect", Cost: 1}, got[0])
+	assert.Equal(t, analytics.Decision{Time: got[1].Time, Limited: true, Rule: limiter.DefaultRule, Action: limiter.ActionReject, Key: "fast-key", Method: "POST", Path: "/collect/batch", Cost: 1}, got[1])
+}
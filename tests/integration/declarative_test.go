@@ -0,0 +1,142 @@
+package integration_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+
+	"github.com/mant7s/qps-counter/internal/api"
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/counter"
+	"github.com/mant7s/qps-counter/internal/storage"
+)
+
+type configResponse struct {
+	Applied bool               `json:"applied"`
+	DryRun  bool               `json:"dry_run"`
+	Changes []api.ConfigChange `json:"changes"`
+	Error   string             `json:"error"`
+}
+
+func configActions(resp configResponse) []string {
+	actions := make([]string, len(resp.Changes))
+	for i, change := range resp.Changes {
+		actions[i] = change.Action + " " + change.Resource + "/" + change.Name
+	}
+	return actions
+}
+
+// TestApplyConfig 声明式配置返回差异并收敛运行时状态，执行失败时撤销已执行的变更
+func TestApplyConfig(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	type doFunc func(query, body string) (int, configResponse)
+
+	servers := map[string]func(opts api.RouterOptions) doFunc{
+		"gin": func(opts api.RouterOptions) doFunc {
+			router := api.NewRouter(opts)
+			return func(query, body string) (int, configResponse) {
+				w := httptest.NewRecorder()
+				req, _ := http.NewRequest("PUT", "/admin/config"+query, strings.NewReader(body))
+				req.Header.Set("Authorization", "Bearer secret")
+				router.ServeHTTP(w, req)
+				var resp configResponse
+				json.Unmarshal(w.Body.Bytes(), &resp)
+				return w.Code, resp
+			}
+		},
+		"fasthttp": func(opts api.RouterOptions) doFunc {
+			handler := api.NewFastHTTPRouter(opts).Handler()
+			return func(query, body string) (int, configResponse) {
+				var ctx fasthttp.RequestCtx
+				ctx.Request.Header.SetMethod("PUT")
+				ctx.Request.SetRequestURI("/admin/config" + query)
+				ctx.Request.Header.Set("Authorization", "Bearer secret")
+				ctx.Request.SetBodyString(body)
+				handler(&ctx)
+				var resp configResponse
+				json.Unmarshal(ctx.Response.Body(), &resp)
+				return ctx.Response.StatusCode(), resp
+			}
+		},
+	}
+
+	for name, newServer := range servers {
+		t.Run(name, func(t *testing.T) {
+			c, gs, rl, m := newCollectTestComponents(t)
+			registry := counter.NewRegistry(config.CounterConfig{
+				Type:       counter.LockFreeType,
+				WindowSize: time.Second,
+				SlotNum:    10,
+				Precision:  100 * time.Millisecond,
+			}, storage.NewMemoryStorage(), 2)
+			t.Cleanup(registry.Stop)
+			_, err := registry.Create(counter.CounterSpec{Name: "legacy"})
+			require.NoError(t, err)
+			_, err = registry.Create(counter.CounterSpec{Name: "upload"})
+			require.NoError(t, err)
+
+			do := newServer(api.RouterOptions{Counter: c, GracefulShutdown: gs, RateLimiter: rl, Registry: registry, AdminToken: "secret", Metrics: m})
+			doc := `{"limiter":{"rate":500},"counters":[{"name":"upload","unit":"bytes"},{"name":"checkout"}]}`
+
+			// dry_run只返回差异
+			status, resp := do("?dry_run=true", doc)
+			require.Equal(t, http.StatusOK, status, resp.Error)
+			assert.False(t, resp.Applied)
+			assert.True(t, resp.DryRun)
+			want := []string{"update limiter/rate", "delete counter/legacy", "replace counter/upload", "create counter/checkout"}
+			assert.Equal(t, want, configActions(resp))
+			_, ok := registry.Info("legacy")
+			assert.True(t, ok)
+
+			status, resp = do("", doc)
+			require.Equal(t, http.StatusOK, status, resp.Error)
+			assert.True(t, resp.Applied)
+			assert.Equal(t, want, configActions(resp))
+			assert.Equal(t, int64(500), rl.Rate())
+			names := make([]string, 0)
+			for _, info := range registry.List() {
+				names = append(names, info.Spec.Name)
+			}
+			assert.Equal(t, []string{"checkout", "upload"}, names)
+			info, _ := registry.Info("upload")
+			assert.Equal(t, "bytes", info.Spec.Unit)
+
+			// 再次执行相同的文档没有差异
+			status, resp = do("", doc)
+			require.Equal(t, http.StatusOK, status)
+			assert.Empty(t, resp.Changes)
+
+			// 执行阶段失败（超出计数器数量上限）时撤销已执行的变更
+			status, resp = do("", `{"limiter":{"rate":800,"enabled":false},"counters":[{"name":"upload","unit":"bytes"},{"name":"checkout"},{"name":"events"}]}`)
+			assert.Equal(t, http.StatusConflict, status)
+			assert.False(t, resp.Applied)
+			assert.NotEmpty(t, resp.Error)
+			assert.Equal(t, int64(500), rl.Rate())
+			assert.True(t, rl.Enabled())
+			_, ok = registry.Info("events")
+			assert.False(t, ok)
+
+			// 省略counters时不管理命名计数器
+			status, resp = do("", `{"limiter":{"rate":500}}`)
+			require.Equal(t, http.StatusOK, status)
+			assert.Empty(t, resp.Changes)
+			assert.Len(t, registry.List(), 2)
+
+			for _, body := range []string{`{"counter":[]}`, `{"counters":[{"name":"a"},{"name":"a"}]}`, `{"limiter":{"rate":0}}`, `{"counters":[{"name":"bad name"}]}`} {
+				status, _ = do("", body)
+				assert.Equal(t, http.StatusBadRequest, status, body)
+			}
+			status, _ = do("?dry_run=maybe", doc)
+			assert.Equal(t, http.StatusBadRequest, status)
+		})
+	}
+}
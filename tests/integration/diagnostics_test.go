@@ -0,0 +1,114 @@
+package integration_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+
+	"github.com/mant7s/qps-counter/internal/api"
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/ingest"
+)
+
+// TestDuplicateReports 两个代理重复上报相同的流量时，merge模式只计数一次，/diagnostics列出重复的上报流
+func TestDuplicateReports(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	type router struct {
+		collect func(agent, body string) int
+		get     func(path string) []byte
+	}
+	routers := map[string]func(opts api.RouterOptions) router{
+		"gin": func(opts api.RouterOptions) router {
+			r := api.NewRouter(opts)
+			return router{
+				collect: func(agent, body string) int {
+					w := httptest.NewRecorder()
+					req, _ := http.NewRequest("POST", "/collect", strings.NewReader(body))
+					req.Header.Set("Content-Type", "application/json")
+					req.Header.Set("X-Agent-ID", agent)
+					r.ServeHTTP(w, req)
+					return w.Code
+				},
+				get: func(path string) []byte {
+					w := httptest.NewRecorder()
+					req, _ := http.NewRequest("GET", path, nil)
+					r.ServeHTTP(w, req)
+					return w.Body.Bytes()
+				},
+			}
+		},
+		"fasthttp": func(opts api.RouterOptions) router {
+			handler := api.NewFastHTTPRouter(opts).Handler()
+			return router{
+				collect: func(agent, body string) int {
+					var ctx fasthttp.RequestCtx
+					ctx.Request.Header.SetMethod("POST")
+					ctx.Request.SetRequestURI("/collect")
+					ctx.Request.Header.SetContentType("application/json")
+					ctx.Request.Header.Set("X-Agent-ID", agent)
+					ctx.Request.SetBodyString(body)
+					handler(&ctx)
+					return ctx.Response.StatusCode()
+				},
+				get: func(path string) []byte {
+					var ctx fasthttp.RequestCtx
+					ctx.Request.Header.SetMethod("GET")
+					ctx.Request.SetRequestURI(path)
+					handler(&ctx)
+					return ctx.Response.Body()
+				},
+			}
+		},
+	}
+
+	for name, newRouter := range routers {
+		t.Run(name, func(t *testing.T) {
+			c, gs, rl, _ := newCollectTestComponents(t)
+			detector := ingest.NewDuplicateDetector(config.DuplicatesConfig{Enabled: true, Reports: 4, Action: ingest.DuplicateMerge})
+			t.Cleanup(detector.Stop)
+
+			// 两个代理此前每10秒上报一次相同的计数
+			now := time.Now()
+			for i, count := range []int64{12, 30, 18} {
+				at := now.Add(time.Duration(i-3) * 10 * time.Second)
+				detector.ObserveAt("agent-a", "checkout", count, at)
+				detector.ObserveAt("agent-b", "checkout", count, at)
+			}
+
+			r := newRouter(api.RouterOptions{Counter: c, GracefulShutdown: gs, RateLimiter: rl, Duplicates: detector})
+			assert.Equal(t, http.StatusAccepted, r.collect("agent-a", `{"key":"checkout","count":25}`))
+			assert.Equal(t, http.StatusAccepted, r.collect("agent-b", `{"key":"checkout","count":25}`))
+			assert.Equal(t, int64(25), c.CurrentQPS(), "重复的上报不计数")
+
+			var diagnostics struct {
+				Duplicates struct {
+					Enabled  bool                      `json:"enabled"`
+					Action   string                    `json:"action"`
+					Findings []ingest.DuplicateFinding `json:"findings"`
+				} `json:"duplicates"`
+			}
+			require.NoError(t, json.Unmarshal(r.get("/diagnostics"), &diagnostics))
+			assert.True(t, diagnostics.Duplicates.Enabled)
+			assert.Equal(t, ingest.DuplicateMerge, diagnostics.Duplicates.Action)
+			require.Len(t, diagnostics.Duplicates.Findings, 1)
+			assert.Equal(t, "agent-b", diagnostics.Duplicates.Findings[0].Source)
+			assert.Equal(t, "agent-a", diagnostics.Duplicates.Findings[0].DuplicateOf)
+			assert.Equal(t, int64(25), diagnostics.Duplicates.Findings[0].Merged)
+		})
+	}
+
+	t.Run("未启用检测", func(t *testing.T) {
+		c, gs, rl, _ := newCollectTestComponents(t)
+		body := routers["gin"](api.RouterOptions{Counter: c, GracefulShutdown: gs, RateLimiter: rl}).get("/diagnostics")
+		assert.JSONEq(t, `{"duplicates":{"enabled":false},"signing":{"enabled":false}}`, string(body))
+	})
+}
@@ -0,0 +1,235 @@
+package integration_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+
+	"github.com/mant7s/qps-counter/internal/api"
+	"github.com/mant7s/qps-counter/internal/counter"
+	"github.com/mant7s/qps-counter/internal/limiter"
+)
+
+// stubLimiter 按预设结果判断的限流器，记录每次判断的请求
+type stubLimiter struct {
+	mu      sync.Mutex
+	allow   bool
+	checked []limiter.Request
+	rate    int64
+	enabled bool
+}
+
+func (l *stubLimiter) Identify(method, path string, header func(string) string) limiter.Request {
+	return limiter.Request{Method: method, Path: path, Key: header("X-Key")}
+}
+
+func (l *stubLimiter) Cost(declared int64) (int64, error) {
+	return max(declared, 1), nil
+}
+
+func (l *stubLimiter) CheckRequest(req limiter.Request, n int64) (limiter.Verdict, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.checked = append(l.checked, req)
+	return limiter.Verdict{Allowed: l.allow, Rule: "stub", Limited: !l.allow}, nil
+}
+
+func (l *stubLimiter) Unit() string { return limiter.UnitRequests }
+func (l *stubLimiter) Err() error   { return nil }
+func (l *stubLimiter) Stats() limiter.Stats {
+	return limiter.Stats{Enabled: l.Enabled(), Rate: l.Rate(), Profile: "stub"}
+}
+
+func (l *stubLimiter) Rate() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate
+}
+
+func (l *stubLimiter) SetRate(rate int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rate = rate
+}
+
+func (l *stubLimiter) Enabled() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.enabled
+}
+
+func (l *stubLimiter) SetEnabled(enabled bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.enabled = enabled
+}
+
+func (l *stubLimiter) Rules() []limiter.RuleStatus             { return nil }
+func (l *stubLimiter) SetRules(specs []limiter.RuleSpec) error { return nil }
+
+// failingLimiter 包装默认限流器，设置err后判断和可用性检查都返回该错误，模拟远程限流后端不可用
+type failingLimiter struct {
+	*limiter.RateLimiter
+	mu  sync.Mutex
+	err error
+}
+
+func (l *failingLimiter) fail(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.err = err
+}
+
+func (l *failingLimiter) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.err
+}
+
+func (l *failingLimiter) CheckRequest(req limiter.Request, n int64) (limiter.Verdict, error) {
+	if err := l.Err(); err != nil {
+		return limiter.Verdict{}, err
+	}
+	return l.RateLimiter.CheckRequest(req, n)
+}
+
+// stubShutdown 记录开始和结束的请求数，closing为true时拒绝上报
+type stubShutdown struct {
+	mu      sync.Mutex
+	closing bool
+	started int
+	ended   int
+}
+
+func (s *stubShutdown) StartRequest() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closing {
+		return false
+	}
+	s.started++
+	return true
+}
+
+func (s *stubShutdown) EndRequest() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ended++
+}
+
+func (s *stubShutdown) Accepts(class string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !s.closing || class == counter.RequestRead
+}
+
+func (s *stubShutdown) ActiveRequests() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return int64(s.started - s.ended)
+}
+
+func (s *stubShutdown) Status() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closing {
+		return "shutting_down"
+	}
+	return "running"
+}
+
+func (s *stubShutdown) Progress() counter.ShutdownProgress {
+	return counter.ShutdownProgress{Phase: s.Status(), ActiveRequests: s.ActiveRequests()}
+}
+
+func (s *stubShutdown) Stats() counter.ShutdownStats {
+	return counter.ShutdownStats{
+		Status:         s.Status(),
+		ActiveRequests: s.ActiveRequests(),
+		Policy:         map[string]string{counter.RequestRead: counter.DrainAccept, counter.RequestWrite: counter.DrainReject},
+	}
+}
+
+// TestRouterTestDoubles 路由器只依赖限流和优雅关闭的接口，替换为测试替身后上报、限流和关闭行为不变
+func TestRouterTestDoubles(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	type request func(method, path, body string) (int, string)
+	routers := map[string]func(opts api.RouterOptions) request{
+		"gin": func(opts api.RouterOptions) request {
+			r := api.NewRouter(opts)
+			return func(method, path, body string) (int, string) {
+				w := httptest.NewRecorder()
+				req, _ := http.NewRequest(method, path, strings.NewReader(body))
+				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set("X-Key", "checkout")
+				r.ServeHTTP(w, req)
+				return w.Code, w.Body.String()
+			}
+		},
+		"fasthttp": func(opts api.RouterOptions) request {
+			handler := api.NewFastHTTPRouter(opts).Handler()
+			return func(method, path, body string) (int, string) {
+				var ctx fasthttp.RequestCtx
+				ctx.Request.Header.SetMethod(method)
+				ctx.Request.SetRequestURI(path)
+				ctx.Request.Header.SetContentType("application/json")
+				ctx.Request.Header.Set("X-Key", "checkout")
+				ctx.Request.SetBodyString(body)
+				handler(&ctx)
+				return ctx.Response.StatusCode(), string(ctx.Response.Body())
+			}
+		},
+	}
+
+	for name, newRouter := range routers {
+		t.Run(name, func(t *testing.T) {
+			c, _, _, _ := newCollectTestComponents(t)
+			rl := &stubLimiter{allow: true, rate: 100, enabled: true}
+			gs := &stubShutdown{}
+			do := newRouter(api.RouterOptions{Counter: c, GracefulShutdown: gs, RateLimiter: rl})
+
+			status, _ := do("POST", "/collect", `{"count":3}`)
+			require.Equal(t, http.StatusAccepted, status)
+			assert.Equal(t, int64(3), c.CurrentQPS())
+			require.Len(t, rl.checked, 1)
+			assert.Equal(t, "checkout", rl.checked[0].Key, "限流判断使用替身提取的请求属性")
+
+			rl.allow = false
+			status, _ = do("POST", "/collect", `{"count":3}`)
+			assert.Equal(t, http.StatusTooManyRequests, status)
+			assert.Equal(t, int64(3), c.CurrentQPS())
+
+			status, body := do("GET", "/stats", "")
+			require.Equal(t, http.StatusOK, status)
+			assert.Contains(t, body, `"profile":"stub"`)
+
+			status, body = do("GET", "/stats/v2", "")
+			require.Equal(t, http.StatusOK, status)
+			var stats api.Stats
+			require.NoError(t, json.Unmarshal([]byte(body), &stats))
+			assert.Equal(t, "stub", stats.Limiter.Profile)
+			assert.Equal(t, int64(100), stats.Limiter.Rate)
+			assert.Equal(t, "running", stats.Shutdown.Status)
+			assert.Nil(t, stats.Sharding, "没有分片管理器时省略sharding")
+			assert.Nil(t, stats.Verify, "未启用计数校验时省略verify")
+
+			// 关闭期间拒绝上报，查询仍然可用；接受的请求都已结束
+			gs.closing = true
+			status, _ = do("POST", "/collect", `{"count":3}`)
+			assert.Equal(t, http.StatusServiceUnavailable, status)
+			status, _ = do("GET", "/qps", "")
+			assert.Equal(t, http.StatusOK, status)
+			assert.Equal(t, 2, gs.started)
+			assert.Equal(t, gs.started, gs.ended)
+		})
+	}
+}
@@ -53,7 +53,7 @@ func TestEnhancedAPIEndpoints(t *testing.T) {
 	metricsCollector := metrics.NewMetrics(qpsCounter)
 
 	// 使用api.NewRouter创建测试路由，与实际应用保持一致
-	router := api.NewRouter(qpsCounter, gracefulShutdown, rateLimiter, metricsCollector, "/metrics", true)
+	router := api.NewRouter(api.RouterOptions{Counter: qpsCounter, GracefulShutdown: gracefulShutdown, RateLimiter: rateLimiter, Metrics: metricsCollector, MetricsEndpoint: "/metrics", MetricsEnabled: true})
 
 	// 设置测试模式
 	gin.SetMode(gin.TestMode)
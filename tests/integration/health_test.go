@@ -0,0 +1,81 @@
+package integration_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+
+	"github.com/mant7s/qps-counter/internal/api"
+	"github.com/mant7s/qps-counter/internal/health"
+	"github.com/mant7s/qps-counter/internal/metrics"
+)
+
+// TestHealthz 两种路由器的 /healthz 都聚合组件状态，只有unhealthy时返回503
+func TestHealthz(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, gs, rl, m := newCollectTestComponents(t)
+
+	replicationStatus := health.Healthy
+	registry := health.NewRegistry()
+	registry.Register("shutdown", health.ShutdownCheck(gs))
+	registry.Register("replication", func() health.Result {
+		if replicationStatus == health.Healthy {
+			return health.Result{Status: health.Healthy}
+		}
+		return health.Result{Status: replicationStatus, Reason: "未连接任何上报节点"}
+	})
+	require.NoError(t, m.Register(metrics.NewHealthCollector(registry)))
+
+	opts := api.RouterOptions{Counter: c, GracefulShutdown: gs, RateLimiter: rl, Health: registry,
+		Metrics: m, MetricsEndpoint: "/metrics", MetricsEnabled: true}
+	ginRouter := api.NewRouter(opts)
+	fastRouter := api.NewFastHTTPRouter(opts).Handler()
+
+	get := map[string]func(path string) (int, []byte){
+		"gin": func(path string) (int, []byte) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", path, nil)
+			ginRouter.ServeHTTP(w, req)
+			return w.Code, w.Body.Bytes()
+		},
+		"fasthttp": func(path string) (int, []byte) {
+			var ctx fasthttp.RequestCtx
+			ctx.Request.Header.SetMethod("GET")
+			ctx.Request.SetRequestURI(path)
+			fastRouter(&ctx)
+			return ctx.Response.StatusCode(), ctx.Response.Body()
+		},
+	}
+
+	for _, tc := range []struct {
+		status   health.Status
+		wantCode int
+	}{
+		{health.Healthy, http.StatusOK},
+		{health.Degraded, http.StatusOK},
+		{health.Unhealthy, http.StatusServiceUnavailable},
+	} {
+		replicationStatus = tc.status
+		for name, do := range get {
+			code, body := do("/healthz")
+			assert.Equal(t, tc.wantCode, code, "%s %s", name, tc.status)
+
+			var report health.Report
+			require.NoError(t, json.Unmarshal(body, &report))
+			assert.Equal(t, tc.status, report.Status, name)
+			assert.Equal(t, health.Result{Status: health.Healthy}, report.Components["shutdown"], name)
+			assert.Equal(t, tc.status, report.Components["replication"].Status, name)
+		}
+	}
+
+	// 每个组件一个健康状态指标
+	_, body := get["gin"]("/metrics")
+	assert.Contains(t, string(body), `qps_counter_component_health{component="replication"} 2`)
+	assert.Contains(t, string(body), `qps_counter_component_health{component="shutdown"} 0`)
+}
@@ -0,0 +1,73 @@
+package integration_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mant7s/qps-counter/internal/api"
+	"github.com/mant7s/qps-counter/internal/ingest"
+	"github.com/mant7s/qps-counter/internal/limiter"
+	"github.com/mant7s/qps-counter/internal/metrics"
+)
+
+// TestLimiterFailurePolicy 限流器出错时上报放行，管理操作拒绝，失败次数显示在/stats中
+func TestLimiterFailurePolicy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, gs, base, m := newCollectTestComponents(t)
+	rl := &failingLimiter{RateLimiter: base}
+	sw := ingest.NewSwitch(ingest.PauseReject)
+	policy := limiter.NewFailurePolicy(limiter.FailOpen, nil)
+	require.NoError(t, m.Register(metrics.NewLimiterFailureCollector(policy)))
+	router := api.NewRouter(api.RouterOptions{
+		Counter:          c,
+		GracefulShutdown: gs,
+		RateLimiter:      rl,
+		IngestSwitch:     sw,
+		FailurePolicy:    policy,
+		AdminToken:       "secret",
+		Metrics:          m,
+		MetricsEnabled:   true,
+	})
+	do := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, strings.NewReader(`{"count":1}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer secret")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	rl.fail(limiter.ErrUnavailable)
+
+	assert.Equal(t, http.StatusAccepted, do("POST", "/collect").Code)
+	assert.Equal(t, int64(1), c.CurrentQPS(), "open策略放行的请求正常计数")
+	assert.Equal(t, http.StatusServiceUnavailable, do("POST", "/admin/ingest/pause").Code)
+	assert.False(t, sw.Paused())
+
+	var stats struct {
+		Limiter struct {
+			FailurePolicy struct {
+				Routes   map[string]string `json:"routes"`
+				Failures map[string]int64  `json:"failures"`
+			} `json:"failure_policy"`
+		} `json:"limiter"`
+	}
+	require.NoError(t, json.Unmarshal(do("GET", "/stats").Body.Bytes(), &stats))
+	assert.Equal(t, limiter.FailClosed, stats.Limiter.FailurePolicy.Routes["/admin/"])
+	assert.Equal(t, int64(1), stats.Limiter.FailurePolicy.Failures["/admin/"])
+	assert.Equal(t, int64(1), stats.Limiter.FailurePolicy.Failures[limiter.DefaultFailureRoute])
+
+	metricsBody := do("GET", "/metrics").Body.String()
+	assert.Contains(t, metricsBody, `qps_counter_limiter_failures_total{policy="closed",route="/admin/"} 1`)
+
+	rl.fail(nil)
+	assert.Equal(t, http.StatusOK, do("POST", "/admin/ingest/pause").Code)
+	assert.True(t, sw.Paused())
+}
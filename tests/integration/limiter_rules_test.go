@@ -0,0 +1,112 @@
+package integration_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+
+	"github.com/mant7s/qps-counter/internal/api"
+	"github.com/mant7s/qps-counter/internal/limiter"
+)
+
+type limiterRulesResponse struct {
+	Rules []limiter.RuleStatus `json:"rules"`
+	Error string               `json:"error"`
+}
+
+// TestLimiterRules 通过管理接口替换限流规则后，匹配的API Key按规则限流，其余请求使用全局令牌桶
+func TestLimiterRules(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	type doFunc func(method, path, apiKey, body string) (int, []byte)
+
+	servers := map[string]func(opts api.RouterOptions) doFunc{
+		"gin": func(opts api.RouterOptions) doFunc {
+			router := api.NewRouter(opts)
+			return func(method, path, apiKey, body string) (int, []byte) {
+				w := httptest.NewRecorder()
+				req, _ := http.NewRequest(method, path, strings.NewReader(body))
+				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set("Authorization", "Bearer secret")
+				if apiKey != "" {
+					req.Header.Set("X-API-Key", apiKey)
+				}
+				router.ServeHTTP(w, req)
+				return w.Code, w.Body.Bytes()
+			}
+		},
+		"fasthttp": func(opts api.RouterOptions) doFunc {
+			handler := api.NewFastHTTPRouter(opts).Handler()
+			return func(method, path, apiKey, body string) (int, []byte) {
+				var ctx fasthttp.RequestCtx
+				ctx.Request.Header.SetMethod(method)
+				ctx.Request.SetRequestURI(path)
+				ctx.Request.Header.SetContentType("application/json")
+				ctx.Request.Header.Set("Authorization", "Bearer secret")
+				if apiKey != "" {
+					ctx.Request.Header.Set("X-API-Key", apiKey)
+				}
+				ctx.Request.SetBodyString(body)
+				handler(&ctx)
+				return ctx.Response.StatusCode(), ctx.Response.Body()
+			}
+		},
+	}
+
+	for name, newServer := range servers {
+		t.Run(name, func(t *testing.T) {
+			c, gs, _, m := newCollectTestComponents(t)
+			rl := limiter.NewRateLimiter(1000, 1000, false)
+			do := newServer(api.RouterOptions{Counter: c, GracefulShutdown: gs, RateLimiter: rl, AdminToken: "secret", Metrics: m})
+
+			status, body := do("PUT", "/admin/limiter/rules", "", `{"rules":[{"name":"partners","match":{"key":"partner-*"},"rate":1,"burst":1}]}`)
+			require.Equal(t, http.StatusOK, status, string(body))
+			var resp limiterRulesResponse
+			require.NoError(t, json.Unmarshal(body, &resp))
+			require.Len(t, resp.Rules, 1)
+			assert.Equal(t, limiter.ActionReject, resp.Rules[0].Action)
+			assert.Equal(t, limiter.AlgorithmTokenBucket, resp.Rules[0].Algorithm)
+
+			collect := func(apiKey string) int {
+				status, _ := do("POST", "/collect", apiKey, `{"count":1}`)
+				return status
+			}
+			assert.Equal(t, http.StatusAccepted, collect("partner-a"))
+			assert.Equal(t, http.StatusTooManyRequests, collect("partner-a"))
+			assert.Equal(t, http.StatusTooManyRequests, collect("partner-b"), "同一规则的所有Key共享限额")
+			assert.Equal(t, http.StatusAccepted, collect("internal"))
+			assert.Equal(t, http.StatusAccepted, collect(""))
+
+			status, body = do("GET", "/admin/limiter/rules", "", "")
+			require.Equal(t, http.StatusOK, status)
+			resp = limiterRulesResponse{}
+			require.NoError(t, json.Unmarshal(body, &resp))
+			require.Len(t, resp.Rules, 1)
+			assert.Equal(t, int64(3), resp.Rules[0].Matched)
+			assert.Equal(t, int64(2), resp.Rules[0].Limited)
+
+			// 无效的规则列表不修改现有规则
+			for _, invalid := range []string{`{}`, `{"rules":[{"name":"a"}]}`, `{"rules":[],"extra":1}`, `not json`} {
+				status, body = do("PUT", "/admin/limiter/rules", "", invalid)
+				assert.Equal(t, http.StatusBadRequest, status, invalid)
+				resp = limiterRulesResponse{}
+				json.Unmarshal(body, &resp)
+				assert.NotEmpty(t, resp.Error, invalid)
+			}
+			assert.Len(t, rl.Rules(), 1)
+
+			// 空数组删除所有规则
+			status, _ = do("PUT", "/admin/limiter/rules", "", `{"rules":[]}`)
+			require.Equal(t, http.StatusOK, status)
+			assert.Empty(t, rl.Rules())
+			assert.Equal(t, http.StatusAccepted, collect("partner-a"))
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package integration_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+
+	"github.com/mant7s/qps-counter/internal/api"
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/counter"
+	"github.com/mant7s/qps-counter/internal/limiter"
+	"github.com/mant7s/qps-counter/internal/metrics"
+)
+
+// exportedMetrics 从文本格式的指标中提取指标名称
+func exportedMetrics(body string) []string {
+	var names []string
+	for _, line := range strings.Split(body, "\n") {
+		if fields := strings.Fields(line); len(fields) == 4 && fields[0] == "#" && fields[1] == "TYPE" {
+			names = append(names, fields[2])
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// TestMetricsRegistry 两种路由器从注入的同一个注册表导出相同的指标，包括额外注册的采集器
+func TestMetricsRegistry(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, gs, rl, _ := newCollectTestComponents(t)
+
+	registry := prometheus.NewRegistry()
+	m := metrics.NewMetricsWithRegistry(c, nil, registry)
+	collector := metrics.NewLimiterFailureCollector(limiter.NewFailurePolicy(limiter.FailOpen, nil))
+	require.NoError(t, m.Register(collector))
+	require.NoError(t, m.Register(collector), "同一个采集器重复注册应被忽略")
+	assert.Error(t, m.Register(metrics.NewLimiterFailureCollector(limiter.NewFailurePolicy(limiter.FailOpen, nil))), "导出相同指标的另一个采集器应返回错误")
+
+	// 同一个注册表上再创建指标收集器时复用已注册的指标
+	require.NotPanics(t, func() { metrics.NewMetricsWithRegistry(c, nil, registry).RecordRequest()() })
+
+	opts := api.RouterOptions{Counter: c, GracefulShutdown: gs, RateLimiter: rl, Metrics: m, MetricsEnabled: true}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/metrics", nil)
+	api.NewRouter(opts).ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var ctx fasthttp.RequestCtx
+	ctx.Request.Header.SetMethod("GET")
+	ctx.Request.SetRequestURI("/metrics")
+	api.NewFastHTTPRouter(opts).Handler()(&ctx)
+	require.Equal(t, http.StatusOK, ctx.Response.StatusCode())
+
+	want := []string{
+		"qps_counter_cpu_usage_percent",
+		"qps_counter_current_qps",
+		"qps_counter_goroutines",
+		"qps_counter_limiter_failure_policy",
+		"qps_counter_limiter_failures_total",
+		"qps_counter_memory_usage_bytes",
+		"qps_counter_request_duration_seconds",
+		"qps_counter_requests_total",
+	}
+	assert.Equal(t, want, exportedMetrics(w.Body.String()), "gin")
+	assert.Equal(t, want, exportedMetrics(string(ctx.Response.Body())), "fasthttp")
+	assert.Contains(t, w.Body.String(), "qps_counter_requests_total 1")
+	assert.Contains(t, string(ctx.Response.Body()), "qps_counter_requests_total 1")
+}
+
+// TestStatsCollector 限流器、分片和关闭的指标与各组件Stats返回的状态一致，为nil的组件不导出指标
+func TestStatsCollector(t *testing.T) {
+	c, gs, rl, _ := newCollectTestComponents(t)
+	sharding := counter.NewEnhancedAdaptiveShardingManager(c, &config.CounterConfig{}, 4, 8, 0, time.Hour)
+	t.Cleanup(sharding.Stop)
+	rl.SetRate(500)
+	require.True(t, gs.StartRequest())
+	defer gs.EndRequest()
+
+	expected := `
+# HELP qps_counter_limiter_rate 限流器的全局速率（每秒令牌数）
+# TYPE qps_counter_limiter_rate gauge
+qps_counter_limiter_rate 500
+# HELP qps_counter_shards 自适应分片管理器当前的分片数
+# TYPE qps_counter_shards gauge
+qps_counter_shards 4
+# HELP qps_counter_shutdown_active_requests 优雅关闭跟踪的进行中的上报请求数
+# TYPE qps_counter_shutdown_active_requests gauge
+qps_counter_shutdown_active_requests 1
+`
+	collector := metrics.NewStatsCollector(rl, sharding, gs)
+	require.NoError(t, testutil.CollectAndCompare(collector, strings.NewReader(expected),
+		"qps_counter_limiter_rate", "qps_counter_shards", "qps_counter_shutdown_active_requests"))
+	assert.Equal(t, 7, testutil.CollectAndCount(collector))
+
+	assert.Equal(t, 5, testutil.CollectAndCount(metrics.NewStatsCollector(rl, nil, nil)))
+}
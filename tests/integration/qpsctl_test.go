@@ -0,0 +1,127 @@
+package integration_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mant7s/qps-counter/internal/api"
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/counter"
+	"github.com/mant7s/qps-counter/internal/ctl"
+	"github.com/mant7s/qps-counter/internal/ingest"
+	"github.com/mant7s/qps-counter/internal/storage"
+)
+
+// TestQPSCtl 命令行工具通过配置文件中的环境调用接口
+func TestQPSCtl(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	c, gs, rl, m := newCollectTestComponents(t)
+	registry := counter.NewRegistry(config.CounterConfig{
+		Type:       counter.LockFreeType,
+		WindowSize: time.Second,
+		SlotNum:    10,
+		Precision:  100 * time.Millisecond,
+	}, storage.NewMemoryStorage(), 0)
+	t.Cleanup(registry.Stop)
+	sw := ingest.NewSwitch(ingest.PauseReject)
+	srv := httptest.NewServer(api.NewRouter(api.RouterOptions{Counter: c, GracefulShutdown: gs, RateLimiter: rl, Registry: registry, IngestSwitch: sw, AdminToken: "secret", Metrics: m}))
+	t.Cleanup(srv.Close)
+
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+current: local
+profiles:
+  local:
+    url: `+srv.URL+`
+  admin:
+    url: `+srv.URL+`
+    token: secret
+  broken:
+    url: http://127.0.0.1:1
+`), 0o600))
+	t.Setenv("QPSCTL_PROFILE", "")
+	t.Setenv("QPSCTL_URL", "")
+	t.Setenv("QPSCTL_TOKEN", "")
+
+	run := func(args ...string) (int, string, string) {
+		var stdout, stderr bytes.Buffer
+		code := ctl.Run(append([]string{"-config", configPath}, args...), strings.NewReader(""), &stdout, &stderr)
+		return code, stdout.String(), stderr.String()
+	}
+
+	code, out, _ := run("-o", "json", "limiter", "rate", "500")
+	require.Equal(t, 0, code)
+	var resp map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(out), &resp))
+	assert.Equal(t, float64(500), resp["new_rate"])
+	assert.Equal(t, int64(500), rl.Stats().Rate)
+
+	// stats按 /stats/v2 的结构解码，表格输出展开嵌套字段
+	code, out, _ = run("stats")
+	require.Equal(t, 0, code)
+	assert.Regexp(t, `limiter\.rate\s+500\n`, out)
+	assert.Contains(t, out, "shutdown.status")
+	code, out, _ = run("-o", "json", "stats")
+	require.Equal(t, 0, code)
+	var stats api.Stats
+	require.NoError(t, json.Unmarshal([]byte(out), &stats))
+	assert.Equal(t, int64(500), stats.Limiter.Rate)
+	assert.Equal(t, "running", stats.Shutdown.Status)
+
+	// 创建计数器需要管理员令牌
+	code, _, errOut := run("counters", "create", "checkout")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, errOut, "401")
+	code, out, _ = run("-profile", "admin", "counters", "create", "checkout", "-window", "5s", "-unit", "requests")
+	require.Equal(t, 0, code)
+	assert.Contains(t, out, "spec.window")
+	info, ok := registry.Info("checkout")
+	require.True(t, ok)
+	assert.Equal(t, 5*time.Second, info.Spec.WindowSize)
+
+	code, out, _ = run("counters", "list")
+	require.Equal(t, 0, code)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	require.Len(t, lines, 2)
+	assert.True(t, strings.HasPrefix(lines[0], "SPEC.NAME"), lines[0])
+	assert.True(t, strings.HasPrefix(lines[1], "checkout"), lines[1])
+
+	// 管理接口需要环境中配置的令牌
+	code, _, errOut = run("ingest", "pause")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, errOut, "401")
+	code, _, _ = run("-profile", "admin", "ingest", "pause")
+	assert.Equal(t, 0, code)
+	assert.True(t, sw.Paused())
+
+	code, _, _ = run("-profile", "broken", "-url", srv.URL, "health")
+	assert.Equal(t, 0, code)
+	code, _, _ = run("-profile", "missing", "stats")
+	assert.Equal(t, 1, code)
+	code, _, _ = run("limiter", "rate", "abc")
+	assert.Equal(t, 2, code)
+
+	doc := filepath.Join(t.TempDir(), "desired.json")
+	require.NoError(t, os.WriteFile(doc, []byte(`{"counters":[{"name":"search"}]}`), 0o600))
+	code, out, _ = run("-profile", "admin", "apply", "-dry-run", doc)
+	require.Equal(t, 0, code)
+	assert.Contains(t, out, "checkout")
+	_, ok = registry.Info("search")
+	assert.False(t, ok)
+
+	code, out, _ = run("-o", "json", "profiles")
+	require.Equal(t, 0, code)
+	assert.NotContains(t, out, "secret")
+	assert.Contains(t, out, `"current": true`)
+}
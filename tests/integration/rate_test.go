@@ -0,0 +1,160 @@
+package integration_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+
+	"github.com/mant7s/qps-counter/internal/api"
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/counter"
+	"github.com/mant7s/qps-counter/internal/limiter"
+	"github.com/mant7s/qps-counter/internal/storage"
+)
+
+func TestRateWithUnits(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	c, gs, rl, m := newCollectTestComponents(t)
+	registry := counter.NewRegistry(config.CounterConfig{
+		Type:       counter.LockFreeType,
+		WindowSize: time.Second,
+		SlotNum:    10,
+		Precision:  100 * time.Millisecond,
+	}, storage.NewMemoryStorage(), 0)
+	t.Cleanup(registry.Stop)
+	router := api.NewRouter(api.RouterOptions{Counter: c, GracefulShutdown: gs, RateLimiter: rl, Registry: registry, AdminToken: "secret", Metrics: m, MetricsEndpoint: "/metrics", MetricsEnabled: true})
+
+	do := func(method, path, contentType, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		req.Header.Set("Authorization", "Bearer secret")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("POST", "/counters", "application/json", `{"name":"upload","unit":"bytes"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	// bytes单位的计数器使用size，events单位的主计数器使用count
+	w = do("POST", "/counters/upload/collect", api.CollectV2ContentType, `{"count":2,"size":3072}`)
+	require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+	w = do("POST", "/collect", api.CollectV2ContentType, `{"count":2,"size":3072}`)
+	require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+
+	var rate struct {
+		Rate      float64 `json:"rate"`
+		Unit      string  `json:"unit"`
+		Formatted string  `json:"formatted"`
+	}
+
+	w = do("GET", "/rate?counter=upload", "", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rate))
+	assert.Equal(t, float64(3072), rate.Rate)
+	assert.Equal(t, counter.UnitBytes, rate.Unit)
+	assert.Equal(t, "3.0 KB/s", rate.Formatted)
+
+	w = do("GET", "/rate", "", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rate))
+	assert.Equal(t, float64(2), rate.Rate)
+	assert.Equal(t, counter.UnitEvents, rate.Unit)
+	assert.Equal(t, "2 events/s", rate.Formatted)
+
+	w = do("GET", "/rate?counter=missing", "", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+// TestQueryV1 /v1/qps 返回小数形式的QPS，/qps 仍返回整数
+func TestQueryV1(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.CounterConfig{
+		Type:       counter.LockFreeType,
+		WindowSize: 3 * time.Second,
+		SlotNum:    30,
+		Precision:  100 * time.Millisecond,
+	}
+	c := counter.NewCounter(cfg)
+	t.Cleanup(c.Stop)
+	c.Add(2)
+
+	opts := api.RouterOptions{
+		Counter:          c,
+		GracefulShutdown: counter.NewEnhancedGracefulShutdown(time.Second, 2*time.Second),
+		RateLimiter:      limiter.NewRateLimiter(10000, 10000, false),
+		QPSPrecision:     3,
+	}
+	ginRouter := api.NewRouter(opts)
+	fast := api.NewFastHTTPRouter(opts).Handler()
+
+	for _, tc := range []struct {
+		path   string
+		status int
+		want   string
+	}{
+		{"/qps", http.StatusOK, `{"qps":0}`},
+		{"/v1/qps", http.StatusOK, `{"qps":0.667,"per":"second"}`},
+		{"/v1/qps?precision=1&format=human", http.StatusOK, `{"qps":0.7,"per":"second","formatted":"0.7 events/s"}`},
+		{"/v1/qps?unit=minute&format=human", http.StatusOK, `{"qps":40,"per":"minute","formatted":"40 events/min"}`},
+		{"/rate?unit=hour", http.StatusOK, `{"rate":2400,"unit":"events","per":"hour","formatted":"2.4k events/h"}`},
+		{"/v1/qps?unit=day", http.StatusBadRequest, ""},
+		{"/v1/qps?precision=7", http.StatusBadRequest, ""},
+		{"/v1/qps?format=xml", http.StatusBadRequest, ""},
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", tc.path, nil)
+		ginRouter.ServeHTTP(w, req)
+
+		var ctx fasthttp.RequestCtx
+		ctx.Request.Header.SetMethod("GET")
+		ctx.Request.SetRequestURI(tc.path)
+		fast(&ctx)
+
+		for name, resp := range map[string]struct {
+			code int
+			body []byte
+		}{"gin": {w.Code, w.Body.Bytes()}, "fasthttp": {ctx.Response.StatusCode(), ctx.Response.Body()}} {
+			assert.Equal(t, tc.status, resp.code, "%s %s", name, tc.path)
+			if tc.want != "" {
+				assert.JSONEq(t, tc.want, string(resp.body), "%s %s", name, tc.path)
+			}
+		}
+	}
+}
+
+func TestCollectByteLimiter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	c, gs, _, m := newCollectTestComponents(t)
+	rl := limiter.NewRateLimiter(1, 4096, false)
+	rl.SetUnit(limiter.UnitBytes)
+	router := api.NewRouter(api.RouterOptions{Counter: c, GracefulShutdown: gs, RateLimiter: rl, Metrics: m, MetricsEndpoint: "/metrics", MetricsEnabled: true})
+
+	collect := func(body string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/collect", strings.NewReader(body))
+		req.Header.Set("Content-Type", api.CollectV2ContentType)
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// 按上报的size消耗令牌
+	assert.Equal(t, http.StatusAccepted, collect(`{"size":4000}`))
+	assert.Equal(t, http.StatusTooManyRequests, collect(`{"size":200}`))
+	// 未提供size时按请求体长度消耗令牌
+	assert.Equal(t, http.StatusAccepted, collect(`{"count":1}`))
+	assert.Equal(t, int64(2), c.CurrentQPS())
+}
@@ -0,0 +1,59 @@
+package integration_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+
+	"github.com/mant7s/qps-counter/internal/api"
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/recovery"
+)
+
+// TestRecoveryMiddleware 两种服务器在请求处理发生panic时返回500并计入panic统计
+func TestRecoveryMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recovery.Init(config.RecoveryConfig{})
+	t.Cleanup(func() { recovery.Init(config.RecoveryConfig{}) })
+
+	c, gs, rl, m := newCollectTestComponents(t)
+	opts := api.RouterOptions{
+		Counter:          c,
+		GracefulShutdown: gs,
+		RateLimiter:      rl,
+		Metrics:          m,
+		GinMiddleware: []gin.HandlerFunc{func(c *gin.Context) {
+			if c.Request.URL.Path == "/stats" {
+				panic("gin handler panic")
+			}
+		}},
+		FastHTTPMiddleware: []api.FastHTTPMiddleware{func(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+			return func(ctx *fasthttp.RequestCtx) {
+				if string(ctx.Path()) == "/stats" {
+					panic("fasthttp handler panic")
+				}
+				next(ctx)
+			}
+		}},
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/stats", nil)
+	api.NewRouter(opts).ServeHTTP(w, req)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	var ctx fasthttp.RequestCtx
+	ctx.Request.Header.SetMethod("GET")
+	ctx.Request.SetRequestURI("/stats")
+	api.NewFastHTTPRouter(opts).Handler()(&ctx)
+	assert.Equal(t, http.StatusInternalServerError, ctx.Response.StatusCode())
+	assert.JSONEq(t, `{"error":"服务器内部错误"}`, string(ctx.Response.Body()))
+
+	panics := recovery.Panics()
+	assert.Equal(t, int64(1), panics["http.gin"])
+	assert.Equal(t, int64(1), panics["http.fasthttp"])
+}
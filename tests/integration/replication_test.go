@@ -0,0 +1,131 @@
+package integration_test
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+
+	"github.com/mant7s/qps-counter/internal/api"
+	"github.com/mant7s/qps-counter/internal/counter"
+	"github.com/mant7s/qps-counter/internal/replication"
+)
+
+// totalCounter 记录只读副本收到的计数总量
+type totalCounter struct {
+	total atomic.Int64
+}
+
+func (c *totalCounter) Incr()             { c.Add(1) }
+func (c *totalCounter) Add(n int64)       { c.total.Add(n) }
+func (c *totalCounter) CurrentQPS() int64 { return c.total.Load() }
+func (c *totalCounter) Reset()            { c.total.Store(0) }
+func (c *totalCounter) Stop()             {}
+
+func (c *totalCounter) Stats() counter.CounterStats {
+	return counter.CounterStats{Type: "total", Events: c.total.Load()}
+}
+
+// TestReplicationStream 只读副本订阅上报节点的增量流，计数与上报节点一致
+func TestReplicationStream(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	servers := map[string]func(t *testing.T, opts api.RouterOptions) string{
+		"gin": func(t *testing.T, opts api.RouterOptions) string {
+			srv := httptest.NewServer(api.NewRouter(opts))
+			t.Cleanup(srv.Close)
+			return srv.URL
+		},
+		"fasthttp": func(t *testing.T, opts api.RouterOptions) string {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+			srv := &fasthttp.Server{Handler: api.NewFastHTTPRouter(opts).Handler(), WriteTimeout: 50 * time.Millisecond}
+			go srv.Serve(ln)
+			t.Cleanup(func() {
+				// fasthttp关闭时等待所有保持连接的客户端断开
+				http.DefaultClient.CloseIdleConnections()
+				srv.Shutdown()
+			})
+			return "http://" + ln.Addr().String()
+		},
+	}
+
+	for name, serve := range servers {
+		t.Run(name, func(t *testing.T) {
+			c, gs, rl, m := newCollectTestComponents(t)
+			publisher := replication.NewPublisher(c, 20*time.Millisecond)
+			leader := serve(t, api.RouterOptions{Counter: publisher, GracefulShutdown: gs, RateLimiter: rl, Publisher: publisher, AdminToken: "secret", Metrics: m})
+			// 先结束增量流再关闭服务器
+			t.Cleanup(publisher.Stop)
+
+			resp, err := http.Get(leader + replication.StreamPath)
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+			replica := &totalCounter{}
+			follower := replication.NewFollower(replica, []string{leader}, "secret", nil)
+
+			collect := func(body string) {
+				resp, err := http.Post(leader+"/collect", "application/json", strings.NewReader(body))
+				require.NoError(t, err)
+				resp.Body.Close()
+				require.Equal(t, http.StatusAccepted, resp.StatusCode)
+			}
+			collect(`{"count":3}`)
+			assert.Eventually(t, func() bool { return replica.CurrentQPS() == 3 }, 2*time.Second, 10*time.Millisecond)
+
+			// 超过服务器写超时后增量流仍然保持
+			time.Sleep(100 * time.Millisecond)
+			collect(`{"count":4}`)
+			assert.Eventually(t, func() bool { return replica.CurrentQPS() == 7 }, 2*time.Second, 10*time.Millisecond)
+
+			leaders := follower.GetStats()["leaders"].([]map[string]interface{})
+			require.Len(t, leaders, 1)
+			assert.Equal(t, true, leaders[0]["connected"])
+			assert.Equal(t, int64(0), leaders[0]["gaps"])
+			assert.Equal(t, 1, publisher.GetStats().Subscribers)
+
+			// 只读副本断开后上报节点释放订阅
+			follower.Stop()
+			assert.Eventually(t, func() bool { return publisher.GetStats().Subscribers == 0 }, 2*time.Second, 10*time.Millisecond)
+		})
+	}
+}
+
+// TestReplicationResume 重连时从上次收到的序号继续，补发断线期间的增量
+func TestReplicationResume(t *testing.T) {
+	c, _, _, _ := newCollectTestComponents(t)
+	publisher := replication.NewPublisher(c, 10*time.Millisecond)
+	t.Cleanup(publisher.Stop)
+
+	deltas, cancel := publisher.Subscribe(0, 0)
+	publisher.Add(2)
+	var last replication.Delta
+	for last.Count == 0 {
+		last = <-deltas
+	}
+	cancel()
+	assert.Equal(t, publisher.Epoch(), last.Epoch)
+
+	publisher.Add(5)
+	time.Sleep(50 * time.Millisecond)
+
+	resumed, cancel := publisher.Subscribe(last.Epoch, last.Seq)
+	defer cancel()
+	var total int64
+	for next := last.Seq + 1; total < 5; next++ {
+		d := <-resumed
+		assert.Equal(t, next, d.Seq)
+		total += d.Count
+	}
+	assert.Equal(t, int64(5), total)
+}
@@ -0,0 +1,61 @@
+package integration_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+
+	"github.com/mant7s/qps-counter/internal/api"
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/report"
+)
+
+// TestLatestReport 两种路由器都通过 /reports/latest 返回最近一份流量报告
+func TestLatestReport(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, gs, rl, m := newCollectTestComponents(t)
+
+	get := func(opts api.RouterOptions) [][]byte {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/reports/latest", nil)
+		api.NewRouter(opts).ServeHTTP(w, req)
+
+		var ctx fasthttp.RequestCtx
+		ctx.Request.Header.SetMethod("GET")
+		ctx.Request.SetRequestURI("/reports/latest")
+		api.NewFastHTTPRouter(opts).Handler()(&ctx)
+
+		assert.Equal(t, w.Code, ctx.Response.StatusCode())
+		return [][]byte{w.Body.Bytes(), ctx.Response.Body()}
+	}
+
+	opts := api.RouterOptions{Counter: c, GracefulShutdown: gs, RateLimiter: rl, Metrics: m}
+	for _, body := range get(opts) {
+		assert.Contains(t, string(body), "流量报告未启用")
+	}
+
+	reporter := report.NewReporter(config.ReportConfig{SampleInterval: time.Hour}, c, nil, rl, nil)
+	defer reporter.Stop()
+	opts.Reporter = reporter
+	for _, body := range get(opts) {
+		assert.Contains(t, string(body), "暂无报告")
+	}
+
+	c.Add(5)
+	reporter.Sample(time.Now())
+	generated := reporter.Generate(time.Now())
+	for _, body := range get(opts) {
+		var got report.Report
+		require.NoError(t, json.Unmarshal(body, &got))
+		assert.Equal(t, generated.PeakQPS, got.PeakQPS)
+		assert.Equal(t, 1, got.Samples)
+		assert.Equal(t, generated.Text, got.Text)
+	}
+}
@@ -0,0 +1,145 @@
+package integration_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+
+	"github.com/mant7s/qps-counter/internal/api"
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/counter"
+	"github.com/mant7s/qps-counter/internal/storage"
+)
+
+// TestRouterOptions 两种路由器都按选项注册中间件和指标接口
+func TestRouterOptions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, gs, rl, m := newCollectTestComponents(t)
+
+	opts := api.RouterOptions{
+		Counter:          c,
+		GracefulShutdown: gs,
+		RateLimiter:      rl,
+		Metrics:          m,
+		MetricsEndpoint:  "/internal/metrics",
+		MetricsEnabled:   true,
+		GinMiddleware: []gin.HandlerFunc{func(c *gin.Context) {
+			c.Header("X-Middleware", "gin")
+		}},
+		FastHTTPMiddleware: []api.FastHTTPMiddleware{
+			func(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+				return func(ctx *fasthttp.RequestCtx) {
+					ctx.Response.Header.Set("X-Middleware", "first")
+					next(ctx)
+				}
+			},
+			func(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+				return func(ctx *fasthttp.RequestCtx) {
+					// 第一个中间件位于最外层，先于此处执行
+					ctx.Response.Header.Set("X-Middleware", string(ctx.Response.Header.Peek("X-Middleware"))+",second")
+					next(ctx)
+				}
+			},
+		},
+	}
+
+	t.Run("gin", func(t *testing.T) {
+		router := api.NewRouter(opts)
+		for path, want := range map[string]int{"/internal/metrics": http.StatusOK, "/metrics": http.StatusNotFound, "/healthz": http.StatusOK} {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", path, nil)
+			router.ServeHTTP(w, req)
+			assert.Equal(t, want, w.Code, path)
+			if want == http.StatusOK {
+				assert.Equal(t, "gin", w.Header().Get("X-Middleware"), path)
+			}
+		}
+	})
+
+	t.Run("fasthttp", func(t *testing.T) {
+		router := api.NewFastHTTPRouter(opts)
+		for path, want := range map[string]int{"/internal/metrics": http.StatusOK, "/metrics": http.StatusNotFound, "/healthz": http.StatusOK} {
+			var ctx fasthttp.RequestCtx
+			ctx.Request.Header.SetMethod("GET")
+			ctx.Request.SetRequestURI(path)
+			router.Handler()(&ctx)
+			assert.Equal(t, want, ctx.Response.StatusCode(), path)
+			assert.Equal(t, "first,second", string(ctx.Response.Header.Peek("X-Middleware")), path)
+		}
+	})
+
+	t.Run("metrics disabled", func(t *testing.T) {
+		disabled := opts
+		disabled.MetricsEnabled = false
+		var ctx fasthttp.RequestCtx
+		ctx.Request.Header.SetMethod("GET")
+		ctx.Request.SetRequestURI("/internal/metrics")
+		api.NewFastHTTPRouter(disabled).Handler()(&ctx)
+		assert.Equal(t, http.StatusNotFound, ctx.Response.StatusCode())
+	})
+}
+
+// TestRouterRoles query角色不接受上报，ingest角色不提供查询和历史接口
+func TestRouterRoles(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	type endpoint struct{ method, path string }
+	ingestEndpoints := []endpoint{{"POST", "/collect"}, {"POST", "/collect/batch"}, {"POST", "/counters/upload/collect"}}
+	queryEndpoints := []endpoint{{"GET", "/qps"}, {"GET", "/v1/qps"}, {"GET", "/rate"}, {"GET", "/qps/trend"}, {"GET", "/qps/history"}, {"GET", "/qps/tags"}, {"GET", "/qps/keys"}, {"GET", "/latency"}, {"GET", "/clients"}, {"GET", "/scaling/advice"}, {"GET", "/reports/latest"}, {"GET", "/counters"}, {"GET", "/counters/upload"}}
+	sharedEndpoints := []endpoint{{"GET", "/stats"}, {"GET", "/healthz"}, {"GET", "/contract-version"}, {"GET", "/debug/workers"}, {"GET", "/diagnostics"}, {"GET", "/metrics"}}
+
+	for _, role := range []string{"", api.RoleFull, api.RoleIngest, api.RoleQuery} {
+		c, gs, rl, m := newCollectTestComponents(t)
+		registry := counter.NewRegistry(config.CounterConfig{
+			Type:       counter.LockFreeType,
+			WindowSize: time.Second,
+			SlotNum:    10,
+			Precision:  100 * time.Millisecond,
+		}, storage.NewMemoryStorage(), 0)
+		t.Cleanup(registry.Stop)
+		_, err := registry.Create(counter.CounterSpec{Name: "upload"})
+		require.NoError(t, err)
+		opts := api.RouterOptions{Counter: c, GracefulShutdown: gs, RateLimiter: rl, Registry: registry, Role: role, Metrics: m, MetricsEnabled: true}
+
+		ginRouter := api.NewRouter(opts)
+		fastHandler := api.NewFastHTTPRouter(opts).Handler()
+		check := func(e endpoint, available bool) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(e.method, e.path, strings.NewReader(`{"count":1}`))
+			req.Header.Set("Content-Type", "application/json")
+			ginRouter.ServeHTTP(w, req)
+
+			var ctx fasthttp.RequestCtx
+			ctx.Request.Header.SetMethod(e.method)
+			ctx.Request.SetRequestURI(e.path)
+			ctx.Request.Header.SetContentType("application/json")
+			ctx.Request.SetBodyString(`{"count":1}`)
+			fastHandler(&ctx)
+
+			for name, code := range map[string]int{"gin": w.Code, "fasthttp": ctx.Response.StatusCode()} {
+				if available {
+					assert.NotEqual(t, http.StatusNotFound, code, "%s %s %s %s", role, name, e.method, e.path)
+				} else {
+					assert.Equal(t, http.StatusNotFound, code, "%s %s %s %s", role, name, e.method, e.path)
+				}
+			}
+		}
+
+		for _, e := range ingestEndpoints {
+			check(e, role != api.RoleQuery)
+		}
+		for _, e := range queryEndpoints {
+			check(e, role != api.RoleIngest)
+		}
+		for _, e := range sharedEndpoints {
+			check(e, true)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package integration_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+
+	"github.com/mant7s/qps-counter/internal/api"
+	"github.com/mant7s/qps-counter/internal/counter"
+)
+
+// TestShutdownPolicy 关闭期间按shutdown.policy分别处理查询和上报请求
+func TestShutdownPolicy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cases := []struct {
+		name        string
+		read, write string
+		wantRead    int
+		wantWrite   int
+	}{
+		{"默认策略", "", "", http.StatusOK, http.StatusServiceUnavailable},
+		{"拒绝查询", counter.DrainReject, "", http.StatusServiceUnavailable, http.StatusServiceUnavailable},
+		{"继续接受上报", "", counter.DrainAccept, http.StatusOK, http.StatusAccepted},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, gs, rl, m := newCollectTestComponents(t)
+			gs.SetPolicy(tc.read, tc.write)
+			opts := api.RouterOptions{Counter: c, GracefulShutdown: gs, RateLimiter: rl, Metrics: m, MetricsEndpoint: "/metrics", MetricsEnabled: true}
+			ginRouter := api.NewRouter(opts)
+			fastRouter := api.NewFastHTTPRouter(opts).Handler()
+
+			// 保持一个进行中的请求，使关闭流程停留在等待阶段
+			assert.True(t, gs.StartRequest())
+			go gs.Shutdown(context.Background())
+			assert.Eventually(t, func() bool { return gs.Status() != "running" }, time.Second, 10*time.Millisecond)
+
+			for _, path := range []string{"/qps", "/stats"} {
+				w := httptest.NewRecorder()
+				req, _ := http.NewRequest("GET", path, nil)
+				ginRouter.ServeHTTP(w, req)
+				assert.Equal(t, tc.wantRead, w.Code, "gin "+path)
+
+				var ctx fasthttp.RequestCtx
+				ctx.Request.Header.SetMethod("GET")
+				ctx.Request.SetRequestURI(path)
+				fastRouter(&ctx)
+				assert.Equal(t, tc.wantRead, ctx.Response.StatusCode(), "fasthttp "+path)
+			}
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/collect", strings.NewReader(`{"count":1}`))
+			req.Header.Set("Content-Type", "application/json")
+			ginRouter.ServeHTTP(w, req)
+			assert.Equal(t, tc.wantWrite, w.Code, "gin /collect")
+
+			var ctx fasthttp.RequestCtx
+			ctx.Request.Header.SetMethod("POST")
+			ctx.Request.SetRequestURI("/collect")
+			ctx.Request.Header.SetContentType("application/json")
+			ctx.Request.SetBodyString(`{"count":1}`)
+			fastRouter(&ctx)
+			assert.Equal(t, tc.wantWrite, ctx.Response.StatusCode(), "fasthttp /collect")
+
+			// 健康检查不受关闭策略影响
+			w = httptest.NewRecorder()
+			req, _ = http.NewRequest("GET", "/healthz", nil)
+			ginRouter.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			gs.EndRequest()
+			select {
+			case <-gs.DoneChan():
+			case <-time.After(time.Second):
+				t.Fatal("关闭流程没有在请求结束后完成")
+			}
+			assert.Equal(t, "graceful_shutdown_complete", gs.Status())
+		})
+	}
+}
+
+// TestShutdownStatus 两种路由器都通过 /shutdown/status 报告关闭进度，拒绝查询时仍然可用
+func TestShutdownStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, gs, rl, m := newCollectTestComponents(t)
+	gs.SetPolicy(counter.DrainReject, "")
+	opts := api.RouterOptions{Counter: c, GracefulShutdown: gs, RateLimiter: rl, Metrics: m}
+	ginRouter := api.NewRouter(opts)
+	fastRouter := api.NewFastHTTPRouter(opts).Handler()
+
+	status := func() []counter.ShutdownProgress {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/shutdown/status", nil)
+		ginRouter.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		var fromGin counter.ShutdownProgress
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &fromGin))
+
+		var ctx fasthttp.RequestCtx
+		ctx.Request.Header.SetMethod("GET")
+		ctx.Request.SetRequestURI("/shutdown/status")
+		fastRouter(&ctx)
+		require.Equal(t, http.StatusOK, ctx.Response.StatusCode())
+		var fromFast counter.ShutdownProgress
+		require.NoError(t, json.Unmarshal(ctx.Response.Body(), &fromFast))
+		return []counter.ShutdownProgress{fromGin, fromFast}
+	}
+
+	for _, p := range status() {
+		assert.Equal(t, "running", p.Phase)
+		assert.Nil(t, p.StartedAt)
+		assert.Nil(t, p.Deadline)
+		assert.False(t, p.Finished)
+	}
+
+	require.True(t, gs.StartRequest())
+	go gs.Shutdown(context.Background())
+	assert.Eventually(t, func() bool { return gs.Progress().Deadline != nil }, time.Second, 10*time.Millisecond)
+
+	for _, p := range status() {
+		assert.Equal(t, "shutting_down", p.Phase)
+		assert.Equal(t, int64(1), p.ActiveRequests)
+		require.NotNil(t, p.StartedAt)
+		require.NotNil(t, p.Deadline)
+		assert.Equal(t, 2*time.Second, p.Deadline.Sub(*p.StartedAt).Round(time.Millisecond))
+		assert.False(t, p.Finished)
+	}
+
+	gs.EndRequest()
+	<-gs.DoneChan()
+	for _, p := range status() {
+		assert.Equal(t, "graceful_shutdown_complete", p.Phase)
+		assert.True(t, p.Finished)
+		assert.False(t, p.Forced)
+		assert.Greater(t, p.ElapsedSeconds, 0.0)
+	}
+}
@@ -0,0 +1,114 @@
+package integration_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+
+	"github.com/mant7s/qps-counter/internal/api"
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/ingest"
+)
+
+// TestSignedCollect 启用上报签名时只计入签名有效且未重放的上报，/collect 和 /collect/batch 都需要签名
+func TestSignedCollect(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	type request func(path string, headers map[string]string, body string) (int, []byte)
+	routers := map[string]func(opts api.RouterOptions) request{
+		"gin": func(opts api.RouterOptions) request {
+			r := api.NewRouter(opts)
+			return func(path string, headers map[string]string, body string) (int, []byte) {
+				w := httptest.NewRecorder()
+				req, _ := http.NewRequest("POST", path, strings.NewReader(body))
+				req.Header.Set("Content-Type", "application/json")
+				for k, v := range headers {
+					req.Header.Set(k, v)
+				}
+				r.ServeHTTP(w, req)
+				return w.Code, w.Body.Bytes()
+			}
+		},
+		"fasthttp": func(opts api.RouterOptions) request {
+			handler := api.NewFastHTTPRouter(opts).Handler()
+			return func(path string, headers map[string]string, body string) (int, []byte) {
+				var ctx fasthttp.RequestCtx
+				ctx.Request.Header.SetMethod("POST")
+				ctx.Request.SetRequestURI(path)
+				ctx.Request.Header.SetContentType("application/json")
+				for k, v := range headers {
+					ctx.Request.Header.Set(k, v)
+				}
+				ctx.Request.SetBodyString(body)
+				handler(&ctx)
+				return ctx.Response.StatusCode(), ctx.Response.Body()
+			}
+		},
+	}
+
+	// target为签名的路径和查询参数
+	signed := func(secret, nonce, target, body string) map[string]string {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		path, query, _ := strings.Cut(target, "?")
+		return map[string]string{
+			"X-Agent-ID":           "agent-1",
+			ingest.TimestampHeader: ts,
+			ingest.NonceHeader:     nonce,
+			ingest.SignatureHeader: ingest.Sign(secret, ts, nonce, ingest.SignedRequest{Method: "POST", Path: path, RawQuery: query, Body: []byte(body)}),
+		}
+	}
+
+	for name, newRouter := range routers {
+		t.Run(name, func(t *testing.T) {
+			c, gs, rl, _ := newCollectTestComponents(t)
+			verifier := ingest.NewSignatureVerifier(config.SigningConfig{
+				Enabled: true,
+				Agents:  []config.AgentSecret{{Agent: "agent-1", Secret: "secret-1"}},
+			})
+			t.Cleanup(verifier.Stop)
+			do := newRouter(api.RouterOptions{Counter: c, GracefulShutdown: gs, RateLimiter: rl, Signatures: verifier})
+
+			body := `{"count":5}`
+			headers := signed("secret-1", "nonce-aaaa", "/collect", body)
+			status, resp := do("/collect", headers, body)
+			require.Equal(t, http.StatusAccepted, status, string(resp))
+
+			// 重放、篡改计数、未签名和使用错误密钥的上报都不计数
+			status, _ = do("/collect", headers, body)
+			assert.Equal(t, http.StatusUnauthorized, status)
+			status, _ = do("/collect", signed("secret-1", "nonce-bbbb", "/collect", body), `{"count":500}`)
+			assert.Equal(t, http.StatusUnauthorized, status)
+			status, _ = do("/collect", nil, body)
+			assert.Equal(t, http.StatusUnauthorized, status)
+			status, _ = do("/collect", signed("wrong", "nonce-cccc", "/collect", body), body)
+			assert.Equal(t, http.StatusUnauthorized, status)
+			// 签名覆盖路径和查询参数，不能改投到其他接口或附加查询参数
+			status, _ = do("/collect/batch", signed("secret-1", "nonce-eeee", "/collect", body), body)
+			assert.Equal(t, http.StatusUnauthorized, status)
+			status, _ = do("/collect?unit=bytes", signed("secret-1", "nonce-ffff", "/collect", body), body)
+			assert.Equal(t, http.StatusUnauthorized, status)
+			status, resp = do("/collect?unit=bytes", signed("secret-1", "nonce-gggg", "/collect?unit=bytes", body), body)
+			require.Equal(t, http.StatusAccepted, status, string(resp))
+
+			batch := `[{"count":2},{"count":3}]`
+			status, resp = do("/collect/batch", signed("secret-1", "nonce-dddd", "/collect/batch", batch), batch)
+			require.Equal(t, http.StatusAccepted, status, string(resp))
+			status, _ = do("/collect/batch", nil, batch)
+			assert.Equal(t, http.StatusUnauthorized, status)
+
+			assert.Equal(t, int64(15), c.CurrentQPS())
+			stats := verifier.GetStats()
+			assert.Equal(t, int64(3), stats["verified"])
+			assert.Equal(t, int64(1), stats["replayed"])
+			assert.Equal(t, int64(6), stats["rejected"])
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package integration_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+
+	"github.com/mant7s/qps-counter/internal/api"
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/counter"
+)
+
+// TestTenantScoping 启用租户分区时，租户令牌只能查询本租户的 /qps 和 /qps/history，未认证的查询返回401，
+// 未认证的上报不计入任何租户
+func TestTenantScoping(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	type request func(method, path, token, tenantHeader, body string) (int, []byte)
+	routers := map[string]func(opts api.RouterOptions) request{
+		"gin": func(opts api.RouterOptions) request {
+			r := api.NewRouter(opts)
+			return func(method, path, token, tenantHeader, body string) (int, []byte) {
+				w := httptest.NewRecorder()
+				req, _ := http.NewRequest(method, path, strings.NewReader(body))
+				req.Header.Set("Content-Type", "application/json")
+				if token != "" {
+					req.Header.Set("Authorization", "Bearer "+token)
+				}
+				if tenantHeader != "" {
+					req.Header.Set("X-Tenant-ID", tenantHeader)
+				}
+				r.ServeHTTP(w, req)
+				return w.Code, w.Body.Bytes()
+			}
+		},
+		"fasthttp": func(opts api.RouterOptions) request {
+			handler := api.NewFastHTTPRouter(opts).Handler()
+			return func(method, path, token, tenantHeader, body string) (int, []byte) {
+				var ctx fasthttp.RequestCtx
+				ctx.Request.Header.SetMethod(method)
+				ctx.Request.SetRequestURI(path)
+				ctx.Request.Header.SetContentType("application/json")
+				if token != "" {
+					ctx.Request.Header.Set("Authorization", "Bearer "+token)
+				}
+				if tenantHeader != "" {
+					ctx.Request.Header.Set("X-Tenant-ID", tenantHeader)
+				}
+				ctx.Request.SetBodyString(body)
+				handler(&ctx)
+				return ctx.Response.StatusCode(), ctx.Response.Body()
+			}
+		},
+	}
+
+	for name, newRouter := range routers {
+		t.Run(name, func(t *testing.T) {
+			c, gs, rl, _ := newCollectTestComponents(t)
+			store := counter.NewTenantStore(&config.CounterConfig{WindowSize: time.Second, SlotNum: 10, Precision: 100 * time.Millisecond}, config.TenantsConfig{
+				Enabled: true,
+				Tokens: []config.TenantToken{
+					{Tenant: "acme", Token: "acme-token"},
+					{Tenant: "globex", Token: "globex-token"},
+				},
+			})
+			t.Cleanup(store.Stop)
+			do := newRouter(api.RouterOptions{Counter: c, GracefulShutdown: gs, RateLimiter: rl, Tenants: store, AdminToken: "admin-token"})
+
+			// 租户来自租户令牌，租户令牌忽略租户请求头；管理员令牌可以通过请求头指定租户
+			status, _ := do("POST", "/collect", "acme-token", "globex", `{"count":30}`)
+			require.Equal(t, http.StatusAccepted, status)
+			status, _ = do("POST", "/collect", "globex-token", "", `{"count":2}`)
+			require.Equal(t, http.StatusAccepted, status)
+			status, _ = do("POST", "/collect/batch", "admin-token", "globex", `[{"count":2},{"count":1}]`)
+			require.Equal(t, http.StatusAccepted, status)
+			assert.Equal(t, int64(35), c.CurrentQPS())
+
+			// 未认证的上报只计入全局计数器：编造的租户不会创建分区，也不能写入其他租户
+			for _, tenant := range []string{"acme", "made-up-1", "made-up-2"} {
+				status, _ = do("POST", "/collect", "", tenant, `{"count":100}`)
+				require.Equal(t, http.StatusAccepted, status)
+			}
+			status, _ = do("POST", "/collect", "unknown", "acme", `{"count":100}`)
+			require.Equal(t, http.StatusAccepted, status)
+			assert.Equal(t, int64(2), store.GetStats()["tenants"])
+			assert.Zero(t, store.GetStats()["overflow"])
+			_, tracked := store.QPS("made-up-1")
+			assert.False(t, tracked)
+			assert.Equal(t, int64(435), c.CurrentQPS())
+
+			status, body := do("GET", "/qps", "acme-token", "", "")
+			require.Equal(t, http.StatusOK, status, string(body))
+			assert.JSONEq(t, `{"tenant":"acme","qps":30,"tracked":true}`, string(body))
+			status, body = do("GET", "/qps", "globex-token", "", "")
+			require.Equal(t, http.StatusOK, status)
+			assert.JSONEq(t, `{"tenant":"globex","qps":5,"tracked":true}`, string(body))
+
+			store.Sample(time.Now())
+			status, body = do("GET", "/qps/history", "acme-token", "", "")
+			require.Equal(t, http.StatusOK, status)
+			var history struct {
+				Tenant  string                  `json:"tenant"`
+				Samples []counter.HistorySample `json:"samples"`
+			}
+			require.NoError(t, json.Unmarshal(body, &history))
+			assert.Equal(t, "acme", history.Tenant)
+			require.NotEmpty(t, history.Samples)
+			assert.Equal(t, int64(30), history.Samples[len(history.Samples)-1].QPS)
+
+			// 租户令牌不能查询其他租户、全局数据或其他查询接口
+			status, _ = do("GET", "/qps?tenant=globex", "acme-token", "", "")
+			assert.Equal(t, http.StatusForbidden, status)
+			status, _ = do("GET", "/stats", "acme-token", "", "")
+			assert.Equal(t, http.StatusForbidden, status)
+			status, _ = do("GET", "/v1/qps", "acme-token", "", "")
+			assert.Equal(t, http.StatusForbidden, status)
+
+			// 未认证的查询返回401
+			status, _ = do("GET", "/qps", "", "acme", "")
+			assert.Equal(t, http.StatusUnauthorized, status)
+			status, _ = do("GET", "/qps", "unknown", "", "")
+			assert.Equal(t, http.StatusUnauthorized, status)
+
+			// 管理员查询全局数据或通过tenant参数查询任一租户
+			status, body = do("GET", "/qps", "admin-token", "", "")
+			require.Equal(t, http.StatusOK, status)
+			assert.JSONEq(t, `{"qps":435}`, string(body))
+			status, body = do("GET", "/qps?tenant=globex", "admin-token", "", "")
+			require.Equal(t, http.StatusOK, status)
+			assert.JSONEq(t, `{"tenant":"globex","qps":5,"tracked":true}`, string(body))
+			status, body = do("GET", "/qps/history?tenant=initech", "admin-token", "", "")
+			require.Equal(t, http.StatusOK, status)
+			assert.Contains(t, string(body), `"samples":[]`)
+			status, _ = do("GET", "/stats", "admin-token", "", "")
+			assert.Equal(t, http.StatusOK, status)
+		})
+	}
+
+	t.Run("响应只允许私有缓存", func(t *testing.T) {
+		c, gs, rl, _ := newCollectTestComponents(t)
+		store := counter.NewTenantStore(&config.CounterConfig{WindowSize: time.Second, SlotNum: 10, Precision: 100 * time.Millisecond}, config.TenantsConfig{
+			Enabled: true,
+			Tokens:  []config.TenantToken{{Tenant: "acme", Token: "acme-token"}},
+		})
+		t.Cleanup(store.Stop)
+		r := api.NewRouter(api.RouterOptions{Counter: c, GracefulShutdown: gs, RateLimiter: rl, Tenants: store, CacheMaxAge: time.Second})
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/qps", nil)
+		req.Header.Set("Authorization", "Bearer acme-token")
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "private, max-age=1", w.Header().Get("Cache-Control"))
+	})
+}
@@ -0,0 +1,67 @@
+package integration_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mant7s/qps-counter/internal/api"
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/logger"
+)
+
+func TestCollectDecisionTrace(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	c, gs, rl, m := newCollectTestComponents(t)
+	router := api.NewRouter(api.RouterOptions{Counter: c, GracefulShutdown: gs, RateLimiter: rl, AdminToken: "secret", Metrics: m, MetricsEndpoint: "/metrics", MetricsEnabled: true})
+
+	// 日志级别为error时追踪日志仍然输出
+	logFile := filepath.Join(t.TempDir(), "app.log")
+	logger.Init(config.LoggerConfig{Level: "error", Format: "json", FilePath: logFile})
+	t.Cleanup(initTestLogger)
+
+	collect := func(authorization, trace string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/collect", strings.NewReader(`{"count":1}`))
+		req.Header.Set("Content-Type", "application/json")
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		if trace != "" {
+			req.Header.Set(api.DebugTraceHeader, trace)
+		}
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	readLog := func() string {
+		data, err := os.ReadFile(logFile)
+		if os.IsNotExist(err) {
+			return ""
+		}
+		require.NoError(t, err)
+		return string(data)
+	}
+
+	// 未认证或令牌错误时忽略追踪请求头
+	assert.Equal(t, http.StatusAccepted, collect("", "1"))
+	assert.Equal(t, http.StatusAccepted, collect("Bearer wrong", "1"))
+	assert.Equal(t, http.StatusAccepted, collect("Bearer secret", ""))
+	assert.NotContains(t, readLog(), "请求决策追踪")
+
+	assert.Equal(t, http.StatusAccepted, collect("Bearer secret", "true"))
+	log := readLog()
+	assert.Contains(t, log, "请求决策追踪")
+	for _, step := range []string{`"shutdown"`, `"limiter"`, `"counter"`, `"tokens_before"`, `"slot_count"`} {
+		assert.Contains(t, log, step)
+	}
+	assert.Equal(t, int64(4), c.CurrentQPS())
+}
@@ -0,0 +1,117 @@
+package unit_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mant7s/qps-counter/internal/app"
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stopRecorder 记录停止顺序的组件
+type stopRecorder struct {
+	name    string
+	stopped *[]string
+}
+
+func (s stopRecorder) Stop() {
+	*s.stopped = append(*s.stopped, s.name)
+}
+
+func TestContainer(t *testing.T) {
+	cfg := &config.AppConfig{}
+
+	t.Run("按依赖顺序启动并按相反顺序停止", func(t *testing.T) {
+		var started, stopped []string
+		module := func(name string, requires ...string) app.Module {
+			return app.Module{
+				Name:     name,
+				Requires: requires,
+				Start: func(c *app.Container) (any, error) {
+					started = append(started, name)
+					c.OnStop(stopRecorder{name, &stopped})
+					return name, nil
+				},
+			}
+		}
+
+		c := app.New(cfg)
+		c.Provide(module("api", "counter", "limiter"), module("limiter"), module("counter"))
+		require.NoError(t, c.Start())
+		assert.Equal(t, []string{"counter", "limiter", "api"}, started)
+		assert.Equal(t, "limiter", app.Get[string](c, "limiter"))
+
+		c.Stop()
+		c.Stop()
+		assert.Equal(t, []string{"api", "limiter", "counter"}, stopped)
+	})
+
+	t.Run("未启用的模块取得零值", func(t *testing.T) {
+		c := app.New(cfg)
+		c.Provide(
+			app.Module{
+				Name:    "history",
+				Enabled: func(cfg *config.AppConfig) bool { return cfg.Counter.History.Enabled },
+				Start:   func(c *app.Container) (any, error) { return &struct{}{}, nil },
+			},
+			app.Module{
+				Name:     "api",
+				Requires: []string{"history"},
+				Start: func(c *app.Container) (any, error) {
+					return app.Get[*struct{}](c, "history") == nil, nil
+				},
+			},
+		)
+		require.NoError(t, c.Start())
+		assert.True(t, app.Get[bool](c, "api"))
+	})
+
+	t.Run("未声明的依赖", func(t *testing.T) {
+		c := app.New(cfg)
+		c.Provide(
+			app.Module{Name: "counter", Start: func(c *app.Container) (any, error) { return 1, nil }},
+			app.Module{Name: "api", Start: func(c *app.Container) (any, error) {
+				return app.Get[int](c, "counter"), nil
+			}},
+		)
+		assert.PanicsWithValue(t, "模块api未声明依赖counter", func() { _ = c.Start() })
+	})
+
+	t.Run("依赖错误", func(t *testing.T) {
+		noop := func(c *app.Container) (any, error) { return nil, nil }
+
+		c := app.New(cfg)
+		c.Provide(app.Module{Name: "api", Requires: []string{"cluster"}, Start: noop})
+		assert.EqualError(t, c.Start(), "模块api依赖的模块cluster不存在")
+
+		c = app.New(cfg)
+		c.Provide(
+			app.Module{Name: "a", Requires: []string{"b"}, Start: noop},
+			app.Module{Name: "b", Requires: []string{"c"}, Start: noop},
+			app.Module{Name: "c", Requires: []string{"b"}, Start: noop},
+		)
+		assert.EqualError(t, c.Start(), "模块之间存在循环依赖: b -> c -> b")
+
+		c = app.New(cfg)
+		c.Provide(app.Module{Name: "a", Start: noop}, app.Module{Name: "a", Start: noop})
+		assert.EqualError(t, c.Start(), "模块a重复登记")
+	})
+
+	t.Run("启动失败时停止已启动的组件", func(t *testing.T) {
+		var stopped []string
+		c := app.New(cfg)
+		c.Provide(
+			app.Module{Name: "counter", Start: func(c *app.Container) (any, error) {
+				c.OnStop(stopRecorder{"counter", &stopped})
+				return nil, nil
+			}},
+			app.Module{Name: "storage", Start: func(c *app.Container) (any, error) {
+				return nil, errors.New("目录不可写")
+			}},
+		)
+		assert.EqualError(t, c.Start(), "启动模块storage失败: 目录不可写")
+		assert.Equal(t, []string{"counter"}, stopped)
+	})
+}
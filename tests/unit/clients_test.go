@@ -0,0 +1,55 @@
+package unit_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/counter"
+)
+
+func TestClientTracker(t *testing.T) {
+	cfg := &config.CounterConfig{
+		WindowSize: time.Second,
+		SlotNum:    10,
+		Precision:  100 * time.Millisecond,
+		Clients:    config.ClientsConfig{Enabled: true, MaxTracked: 3, TopN: 2},
+	}
+	ct := counter.NewClientTracker(cfg)
+	defer ct.Stop()
+
+	for i := 0; i < 5; i++ {
+		ct.Record(counter.ClientIdentity{UserAgent: "agent/2.0", APIKey: "sk-live-123456", IP: "10.1.2.3"}, 1)
+	}
+	for i := 0; i < 3; i++ {
+		ct.Record(counter.ClientIdentity{UserAgent: "agent/1.9", IP: "10.1.2.200"}, 1)
+	}
+	ct.Record(counter.ClientIdentity{UserAgent: "curl/8.0", IP: "2001:db8:1:2::1"}, 1)
+	// 超出max_tracked的新调用方不被统计
+	ct.Record(counter.ClientIdentity{UserAgent: "agent/1.0", IP: "not-an-ip"}, 1)
+
+	assert.Equal(t, []counter.ClientStat{{Value: "agent/2.0", QPS: 5}, {Value: "agent/1.9", QPS: 3}}, ct.Top(counter.ClientUserAgent, 0))
+	assert.Len(t, ct.Top(counter.ClientUserAgent, 10), 3)
+
+	// 同一网段的IP归并统计
+	assert.Equal(t, []counter.ClientStat{{Value: "10.1.2.0/24", QPS: 8}, {Value: "2001:db8:1::/48", QPS: 1}}, ct.Top(counter.ClientIPPrefix, 0))
+
+	// 不暴露完整的API Key
+	keys := ct.Top(counter.ClientAPIKey, 0)
+	require.Len(t, keys, 1)
+	assert.True(t, strings.HasPrefix(keys[0].Value, "sk-l..."))
+	assert.NotContains(t, keys[0].Value, "123456")
+
+	stats := ct.GetStats()
+	assert.Equal(t, int64(1), stats["overflow"].(map[string]int64)[counter.ClientUserAgent])
+
+	// 整个窗口内没有请求的调用方被清理
+	assert.Eventually(t, func() bool {
+		return ct.GetStats()["tracked"].(map[string]int)[counter.ClientUserAgent] == 0
+	}, 3*time.Second, 50*time.Millisecond)
+	assert.Empty(t, ct.Top(counter.ClientUserAgent, 0))
+}
@@ -1,11 +1,17 @@
 package unit_test
 
 import (
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/mant7s/qps-counter/internal/config"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestConfigLoad(t *testing.T) {
@@ -21,3 +27,205 @@ func TestConfigLoad(t *testing.T) {
 		assert.Error(t, err)
 	})
 }
+
+func TestConfigCounterWindows(t *testing.T) {
+	example, err := os.ReadFile("../../config/config.example.yaml")
+	require.NoError(t, err)
+
+	load := func(t *testing.T, windows string) (*config.AppConfig, error) {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		content := strings.Replace(string(example), "  windows: []", "  windows: "+windows, 1)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		return config.Load(path)
+	}
+
+	cfg, err := load(t, "[1s, 10s, 1m, 5m]")
+	require.NoError(t, err)
+	assert.Equal(t, []time.Duration{time.Second, 10 * time.Second, time.Minute, 5 * time.Minute}, cfg.Counter.Windows)
+
+	_, err = load(t, "[10s, 10s]")
+	assert.Error(t, err)
+	_, err = load(t, "[0s]")
+	assert.Error(t, err)
+}
+
+func TestConfigQuantities(t *testing.T) {
+	example, err := os.ReadFile("../../config/config.example.yaml")
+	require.NoError(t, err)
+
+	load := func(t *testing.T, rate, memory string) (*config.AppConfig, error) {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		content := strings.Replace(string(example), "  rate: 1M ", "  rate: "+rate+" ", 1)
+		content = strings.Replace(content, "memory_threshold: 1GiB ", "memory_threshold: "+memory+" ", 1)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		return config.Load(path)
+	}
+
+	cfg, err := load(t, "1M", "1GiB")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1_000_000), cfg.Limiter.Rate)
+	assert.Equal(t, int64(10_000), cfg.Limiter.Burst)
+	assert.Equal(t, config.ByteSize(1<<30), cfg.Counter.Adaptive.MemoryThreshold)
+
+	cfg, err = load(t, `"1.5k"`, "512MB")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1500), cfg.Limiter.Rate)
+	assert.Equal(t, config.ByteSize(512_000_000), cfg.Counter.Adaptive.MemoryThreshold)
+
+	// 格式错误时加载失败，不会静默得到其他值
+	for _, rate := range []string{"1.5", "10m", "1.2345k", "1,000", "fast"} {
+		_, err = load(t, rate, "1GiB")
+		assert.Error(t, err, rate)
+	}
+	_, err = load(t, "1M", "1GX")
+	assert.Error(t, err)
+
+	// 环境变量同样支持
+	t.Setenv("QPS_LIMITER_BURST", "2.5k")
+	cfg, err = load(t, "1M", "1GiB")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2500), cfg.Limiter.Burst)
+}
+
+func TestParseQuantities(t *testing.T) {
+	for s, want := range map[string]int64{"0": 0, "1500": 1500, "-1": -1, "1.5k": 1500, "2M": 2_000_000, "0.5G": 500_000_000, " 3 k ": 3000, "9223372036854775807": math.MaxInt64} {
+		got, err := config.ParseCount(s)
+		require.NoError(t, err, s)
+		assert.Equal(t, want, got, s)
+	}
+	for _, s := range []string{"", "k", "1.5", "1e3", "2m", "1.0001k", "10G0", "9223372036854775808", "10000000000G"} {
+		_, err := config.ParseCount(s)
+		assert.Error(t, err, s)
+	}
+
+	for s, want := range map[string]uint64{"1024": 1024, "1KiB": 1024, "1.5kb": 1500, "2 GiB": 2 << 30, "64B": 64, "1TB": 1e12} {
+		got, err := config.ParseByteSize(s)
+		require.NoError(t, err, s)
+		assert.Equal(t, want, got, s)
+	}
+	for _, s := range []string{"", "1K", "1.5B", "-1MB", "GB", "1 GiBs"} {
+		_, err := config.ParseByteSize(s)
+		assert.Error(t, err, s)
+	}
+
+	var body struct {
+		Rate config.Count `json:"rate"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(`{"rate": "1.5k"}`), &body))
+	assert.Equal(t, config.Count(1500), body.Rate)
+	require.NoError(t, json.Unmarshal([]byte(`{"rate": 200}`), &body))
+	assert.Equal(t, config.Count(200), body.Rate)
+	assert.Error(t, json.Unmarshal([]byte(`{"rate": 1.5}`), &body))
+	assert.Error(t, json.Unmarshal([]byte(`{"rate": "lots"}`), &body))
+}
+
+func TestConfigIngestPipelines(t *testing.T) {
+	example, err := os.ReadFile("../../config/config.example.yaml")
+	require.NoError(t, err)
+
+	load := func(t *testing.T, pipelines string) (*config.AppConfig, error) {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		content := strings.Replace(string(example), "  pipelines: []", "  pipelines: "+pipelines, 1)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		return config.Load(path)
+	}
+
+	cfg, err := load(t, `[{name: edge, source: udp, address: ":8125", format: line, sample_rate: 0.5, key: {lowercase: true, max_length: 64}, attributes: {region: cn-east}}]`)
+	require.NoError(t, err)
+	assert.Equal(t, []config.PipelineConfig{{
+		Name:       "edge",
+		Source:     "udp",
+		Address:    ":8125",
+		Format:     "line",
+		Key:        config.PipelineKeyConfig{Lowercase: true, MaxLength: 64},
+		SampleRate: 0.5,
+		Attributes: map[string]string{"region": "cn-east"},
+	}}, cfg.Ingest.Pipelines)
+
+	for _, pipelines := range []string{
+		`[{name: a, source: udp, address: ":1"}, {name: a, source: tail, path: /var/log/a.log}]`,
+		`[{name: a, source: kafka}]`,
+		`[{name: a, source: udp}]`,
+		`[{name: a, source: tail}]`,
+		`[{name: a, source: udp, address: ":1", format: csv}]`,
+		`[{name: a, source: udp, address: ":1", sample_rate: 2}]`,
+	} {
+		_, err = load(t, pipelines)
+		assert.Error(t, err, pipelines)
+	}
+}
+
+func TestConfigLimiterAuto(t *testing.T) {
+	example, err := os.ReadFile("../../config/config.example.yaml")
+	require.NoError(t, err)
+
+	load := func(t *testing.T, auto string) (*config.AppConfig, error) {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		content := strings.Replace(string(example), "    enabled: false\n    threshold: 5000 ", auto+" ", 1)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		return config.Load(path)
+	}
+
+	cfg, err := load(t, "    enabled: true\n    threshold: 2k")
+	require.NoError(t, err)
+	assert.Equal(t, config.LimiterAutoConfig{Enabled: true, Threshold: 2000, EnableAfter: 10 * time.Second, DisableAfter: 5 * time.Minute}, cfg.Limiter.Auto)
+
+	for _, auto := range []string{
+		"    enabled: true\n    threshold: 0",
+		"    enabled: true\n    threshold: 10\n    enable_after: -1s\n   ",
+	} {
+		_, err = load(t, auto)
+		assert.Error(t, err, auto)
+	}
+}
+
+func TestConfigAlignment(t *testing.T) {
+	example, err := os.ReadFile("../../config/config.example.yaml")
+	require.NoError(t, err)
+
+	load := func(t *testing.T, slotNum, precision string) (*config.AppConfig, error) {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		content := strings.Replace(string(example), "  alignment: sliding ", "  alignment: wall ", 1)
+		content = strings.Replace(content, "  slot_num: 10 ", "  slot_num: "+slotNum+" ", 1)
+		content = strings.Replace(content, "  precision: 100ms ", "  precision: "+precision+" ", 1)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		return config.Load(path)
+	}
+
+	cfg, err := load(t, "10", "100ms")
+	require.NoError(t, err)
+	assert.Equal(t, "wall", cfg.Counter.Alignment)
+
+	// 槽位覆盖的时间与窗口长度不一致时拒绝
+	for _, c := range [][2]string{{"5", "100ms"}, {"20", "100ms"}, {"10", "300ms"}} {
+		_, err = load(t, c[0], c[1])
+		assert.Error(t, err, c)
+	}
+}
+
+func TestConfigReloadRejected(t *testing.T) {
+	example, err := os.ReadFile("../../config/config.example.yaml")
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, example, 0o600))
+	_, err = config.Load(path)
+	require.NoError(t, err)
+
+	rejected := make(chan error, 1)
+	config.OnReloadRejected(func(err error) {
+		select {
+		case rejected <- err:
+		default:
+		}
+	})
+
+	// 无效的修改不会应用，原因通过回调报告
+	invalid := strings.Replace(string(example), "  slot_num: 10 ", "  slot_num: 0 ", 1)
+	require.NoError(t, os.WriteFile(path, []byte(invalid), 0o600))
+	select {
+	case err := <-rejected:
+		assert.ErrorContains(t, err, "slot_num")
+	case <-time.After(5 * time.Second):
+		t.Fatal("无效的配置修改没有报告")
+	}
+}
@@ -0,0 +1,73 @@
+package unit_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/counter"
+)
+
+func TestCounterOverflow(t *testing.T) {
+	cfg := &config.CounterConfig{WindowSize: 2 * time.Second, SlotNum: 20, Precision: 100 * time.Millisecond}
+
+	counters := map[string]counter.Counter{
+		"lockfree": counter.NewLockFreeWithClock(cfg, newFakeClock()),
+		"sharded":  counter.NewShardedWithClock(cfg, newFakeClock()),
+	}
+	for name, c := range counters {
+		t.Run(name, func(t *testing.T) {
+			defer c.Stop()
+
+			// 总计数乘以1秒超过int64，换算速率时不回绕
+			c.Add(math.MaxInt64 / 2)
+			assert.Equal(t, int64(math.MaxInt64/4), c.CurrentQPS())
+
+			// 写入超过int64上限时计数停在上限
+			before := counter.Overflows()[counter.OverflowAdd]
+			c.Add(math.MaxInt64)
+			assert.Equal(t, int64(math.MaxInt64/2), c.CurrentQPS())
+			assert.Greater(t, counter.Overflows()[counter.OverflowAdd], before)
+
+			// 负数不计数
+			c.Add(-5)
+			assert.Equal(t, int64(math.MaxInt64/2), c.CurrentQPS())
+		})
+	}
+
+	// 两个槽位都停在上限时，替换槽位和清理协程重新累加总计数都不回绕为负数
+	for _, cType := range []string{"lockfree", "sharded"} {
+		t.Run(cType+"/多个槽位饱和", func(t *testing.T) {
+			clock := newFakeClock()
+			c := createCounterWithClock(cfg, cType, clock)
+			defer c.Stop()
+
+			c.Add(math.MaxInt64)
+			clock.Advance(cfg.Precision)
+			before := counter.Overflows()
+			c.Add(math.MaxInt64)
+			assert.Equal(t, int64(math.MaxInt64/2), c.CurrentQPS())
+			assert.Greater(t, counter.Overflows()[counter.OverflowAdd], before[counter.OverflowAdd])
+
+			// 等待清理协程在当前时间运行一次
+			now := clock.Now()
+			require.Eventually(t, func() bool { return !c.Stats().LastCleanup.Before(now) }, time.Second, 10*time.Millisecond)
+			assert.Equal(t, int64(math.MaxInt64/2), c.CurrentQPS())
+			assert.Equal(t, int64(math.MaxInt64), c.Stats().Events)
+			assert.Greater(t, counter.Overflows()[counter.OverflowSum], before[counter.OverflowSum])
+		})
+	}
+
+	t.Run("按维度计数忽略负数", func(t *testing.T) {
+		tagged := counter.NewTaggedCounter(&config.CounterConfig{
+			WindowSize: time.Second, SlotNum: 10, Precision: 100 * time.Millisecond,
+			Tags: config.TagsConfig{Keys: []string{"route"}},
+		})
+		assert.False(t, tagged.Add(map[string]string{"route": "/pay"}, -3))
+		assert.Zero(t, tagged.SeriesCount())
+	})
+}
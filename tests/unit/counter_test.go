@@ -1,11 +1,16 @@
 package unit_test
 
 import (
+	"math"
+	"path/filepath"
+	"runtime"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/mant7s/qps-counter/internal/config"
 	"github.com/mant7s/qps-counter/internal/counter"
@@ -24,6 +29,14 @@ func createCounter(t *testing.T, cfg *config.CounterConfig, counterType string)
 	return c
 }
 
+// createCounterWithClock 创建使用指定时间源的lockfree或sharded计数器，测试可以手动推进时间
+func createCounterWithClock(cfg *config.CounterConfig, counterType string, clock counter.Clock) counter.Counter {
+	if counterType == counter.ShardedType {
+		return counter.NewShardedWithClock(cfg, clock)
+	}
+	return counter.NewLockFreeWithClock(cfg, clock)
+}
+
 func TestCounter(t *testing.T) {
 	cfg := &config.CounterConfig{
 		// 使用1秒的窗口大小，简化计算
@@ -37,8 +50,8 @@ func TestCounter(t *testing.T) {
 
 	for _, cType := range counterTypes {
 		t.Run("concurrency safety for "+cType, func(t *testing.T) {
-			// 创建指定类型的计数器
-			c := createCounter(t, cfg, cType)
+			// 时钟不走动，所有计数都落在窗口内
+			c := createCounterWithClock(cfg, cType, newFakeClock())
 			defer c.Stop()
 
 			const (
@@ -47,10 +60,6 @@ func TestCounter(t *testing.T) {
 				total     = perWorker * workers
 			)
 
-			// 确保在窗口开始时进行测试
-			start := time.Now().Truncate(cfg.WindowSize).Add(cfg.WindowSize)
-			time.Sleep(time.Until(start))
-
 			var wg sync.WaitGroup
 			wg.Add(workers)
 			for i := 0; i < workers; i++ {
@@ -63,11 +72,692 @@ func TestCounter(t *testing.T) {
 			}
 			wg.Wait()
 
-			// 增加等待时间，确保计数器有足够时间更新
-			time.Sleep(5 * cfg.Precision)
-
 			reportedQPS := c.CurrentQPS()
 			assert.Equal(t, int64(total), reportedQPS, "Expected reported QPS to be %d, got %d", total, reportedQPS)
 		})
 	}
 }
+
+// TestCounterClock 注入的时钟决定计数落入的槽位和窗口的滑动，测试不需要sleep
+func TestCounterClock(t *testing.T) {
+	for _, cType := range []string{counter.ShardedType, counter.LockFreeType} {
+		t.Run(cType, func(t *testing.T) {
+			cfg := &config.CounterConfig{
+				WindowSize: time.Second,
+				Windows:    []time.Duration{10 * time.Second},
+				SlotNum:    10,
+				Precision:  100 * time.Millisecond,
+			}
+			clock := newFakeClock()
+			base := createCounterWithClock(cfg, cType, clock)
+			defer base.Stop()
+			c := counter.NewMultiWindow(base, cfg)
+			// 槽位使用以注入时钟为基准的单调时钟，不带单调读数的测试时钟下两者一致
+			assert.True(t, clock.Now().Equal(counter.ClockOf(c).Now()))
+
+			// 从时间段的起点开始，sharded类型的槽位时间戳按精度对齐
+			now := clock.Now()
+			clock.Advance(now.Truncate(cfg.Precision).Add(cfg.Precision).Sub(now))
+			c.Add(100)
+			clock.Advance(cfg.Precision)
+			c.Add(50)
+			assert.Equal(t, int64(150), c.CurrentQPS())
+
+			// 第一个时间段滑出窗口
+			clock.Advance(cfg.WindowSize)
+			assert.Equal(t, int64(50), c.CurrentQPS())
+			assert.Equal(t, []counter.WindowQPS{{Window: "10s", QPS: 15}}, c.Windows())
+
+			clock.Advance(cfg.Precision)
+			assert.Zero(t, c.CurrentQPS())
+		})
+	}
+}
+
+// TestCounterAddDelayed 延迟上报写入事件时间所在的槽位，超出窗口的事件被丢弃
+func TestCounterAddDelayed(t *testing.T) {
+	for _, cType := range []string{counter.ShardedType, counter.LockFreeType} {
+		t.Run(cType, func(t *testing.T) {
+			cfg := &config.CounterConfig{
+				WindowSize: time.Second,
+				Windows:    []time.Duration{10 * time.Second},
+				SlotNum:    10,
+				Precision:  100 * time.Millisecond,
+			}
+			clock := newFakeClock()
+			base := createCounterWithClock(cfg, cType, clock)
+			defer base.Stop()
+			c := counter.NewMultiWindow(base, cfg)
+			before := counter.LateEvents()
+
+			now := clock.Now()
+			clock.Advance(now.Truncate(cfg.Precision).Add(cfg.Precision).Sub(now))
+			c.Add(100)
+			clock.Advance(5 * cfg.Precision)
+
+			// 第二个时间段的事件延迟到达，与当前时间的写入一起计入窗口
+			assert.True(t, counter.AddDelayed(c, 30, 4*cfg.Precision))
+			assert.True(t, counter.AddDelayed(c, 20, 0))
+			assert.False(t, counter.AddDelayed(c, 5, 2*cfg.WindowSize))
+			assert.Equal(t, int64(150), c.CurrentQPS())
+			assert.Equal(t, []counter.WindowQPS{{Window: "10s", QPS: 15}}, c.Windows())
+
+			after := counter.LateEvents()
+			assert.Equal(t, int64(1), after.Placed-before.Placed)
+			assert.Equal(t, int64(1), after.Dropped-before.Dropped)
+
+			// 第一个时间段滑出窗口，延迟写入的计数随所在的时间段过期
+			clock.Advance(6 * cfg.Precision)
+			assert.Equal(t, int64(50), c.CurrentQPS())
+			clock.Advance(5 * cfg.Precision)
+			assert.Zero(t, c.CurrentQPS())
+		})
+	}
+
+	t.Run("槽位已被更新的时间段占用", func(t *testing.T) {
+		cfg := &config.CounterConfig{WindowSize: time.Second, SlotNum: 10, Precision: 100 * time.Millisecond}
+		clock := newFakeClock()
+		c := counter.NewLockFreeWithClock(cfg, clock)
+		defer c.Stop()
+
+		now := clock.Now()
+		clock.Advance(now.Truncate(cfg.Precision).Add(cfg.Precision).Sub(now))
+		c.Add(10)
+		// 恰好早一个窗口的事件对应同一个槽位，不能覆盖当前时间段的计数
+		assert.False(t, c.AddAt(5, clock.Now().Add(-cfg.WindowSize).UnixNano()))
+		assert.Equal(t, int64(10), c.CurrentQPS())
+	})
+}
+
+// TestCounterAddAtConcurrent 延迟写入与当前时间的写入并发切换过期槽位，计数不会丢失
+func TestCounterAddAtConcurrent(t *testing.T) {
+	cfg := &config.CounterConfig{
+		WindowSize: time.Second,
+		Windows:    []time.Duration{10 * time.Second},
+		SlotNum:    10,
+		Precision:  100 * time.Millisecond,
+	}
+	// 分片计数器的槽位由互斥锁保护，且依赖清理协程重置过期槽位，这里只覆盖用CAS切换槽位的计数器
+	constructors := map[string]func(clock counter.Clock) (counter.Counter, error){
+		counter.LockFreeType: func(clock counter.Clock) (counter.Counter, error) {
+			return counter.NewLockFreeWithClock(cfg, clock), nil
+		},
+		counter.SharedType: func(clock counter.Clock) (counter.Counter, error) {
+			shared := *cfg
+			shared.SharedPath = filepath.Join(t.TempDir(), "qps-counter")
+			return counter.OpenSharedWithClock(&shared, clock)
+		},
+	}
+
+	for cType, newCounter := range constructors {
+		t.Run(cType, func(t *testing.T) {
+			clock := newFakeClock()
+			base, err := newCounter(clock)
+			require.NoError(t, err)
+			defer base.Stop()
+
+			// 先写满所有槽位再让它们全部过期，之后的写入都要切换槽位
+			now := clock.Now()
+			clock.Advance(now.Truncate(cfg.Precision).Add(cfg.Precision).Sub(now))
+			for i := 0; i < cfg.SlotNum; i++ {
+				base.Add(100)
+				clock.Advance(cfg.Precision)
+			}
+			clock.Advance(cfg.WindowSize)
+			require.Zero(t, base.CurrentQPS())
+
+			c := counter.NewMultiWindow(base, cfg)
+			late := clock.Now().Add(-3 * cfg.Precision).UnixNano()
+			const (
+				goroutines = 8
+				perWorker  = 500
+			)
+			var dropped atomic.Int64
+			var wg sync.WaitGroup
+			for i := 0; i < goroutines; i++ {
+				wg.Add(2)
+				go func() {
+					defer wg.Done()
+					for j := 0; j < perWorker; j++ {
+						c.Add(1)
+					}
+				}()
+				go func() {
+					defer wg.Done()
+					for j := 0; j < perWorker; j++ {
+						if !counter.AddAt(c, 1, late) {
+							dropped.Add(1)
+						}
+					}
+				}()
+			}
+			wg.Wait()
+
+			assert.Zero(t, dropped.Load())
+			assert.Equal(t, int64(2*goroutines*perWorker), c.CurrentQPS())
+			assert.Equal(t, []counter.WindowQPS{{Window: "10s", QPS: 2 * goroutines * perWorker / 10}}, c.Windows())
+		})
+	}
+}
+
+// TestCounterAlignment 对齐窗口时QPS为最近一个完整的整秒窗口的计数，窗口结束前不变
+func TestCounterAlignment(t *testing.T) {
+	for _, cType := range []string{counter.ShardedType, counter.LockFreeType} {
+		t.Run(cType, func(t *testing.T) {
+			cfg := &config.CounterConfig{
+				WindowSize: time.Second,
+				SlotNum:    10,
+				Precision:  100 * time.Millisecond,
+				Alignment:  counter.AlignWall,
+			}
+			clock := newFakeClock()
+			c := createCounterWithClock(cfg, cType, clock)
+			defer c.Stop()
+
+			// 从整秒开始
+			now := clock.Now()
+			clock.Advance(now.Truncate(time.Second).Add(time.Second).Sub(now))
+			c.Add(100)
+			clock.Advance(500 * time.Millisecond)
+			c.Add(50)
+			assert.Zero(t, c.CurrentQPS(), "窗口尚未结束")
+
+			clock.Advance(500 * time.Millisecond)
+			assert.Equal(t, int64(150), c.CurrentQPS())
+			c.Add(30)
+			clock.Advance(900 * time.Millisecond)
+			c.Add(5)
+			// 正在进行的窗口使用另外的槽位，不覆盖上一个窗口
+			assert.Equal(t, int64(150), c.CurrentQPS())
+			assert.Equal(t, int64(150), c.(interface{ ScanQPS() int64 }).ScanQPS())
+
+			clock.Advance(100 * time.Millisecond)
+			assert.Equal(t, int64(35), c.CurrentQPS())
+			assert.Equal(t, 35.0, counter.RateOf(c))
+
+			clock.Advance(time.Second)
+			assert.Zero(t, c.CurrentQPS())
+		})
+	}
+}
+
+// TestCounterStats Stats返回窗口起点、有计数的槽位数、窗口内的计数和清理时间
+func TestCounterStats(t *testing.T) {
+	for _, cType := range []string{counter.ShardedType, counter.LockFreeType} {
+		t.Run(cType, func(t *testing.T) {
+			cfg := &config.CounterConfig{
+				WindowSize: time.Second,
+				Windows:    []time.Duration{10 * time.Second},
+				SlotNum:    10,
+				Precision:  100 * time.Millisecond,
+			}
+			clock := newFakeClock()
+			base := createCounterWithClock(cfg, cType, clock)
+			defer base.Stop()
+			// 附加窗口不影响全局计数器的状态
+			c := counter.NewMultiWindow(base, cfg)
+
+			stats := c.Stats()
+			assert.Equal(t, cType, stats.Type)
+			assert.Equal(t, "1s", stats.WindowSize)
+			assert.Zero(t, stats.OccupiedSlots)
+			assert.Zero(t, stats.Events)
+			assert.GreaterOrEqual(t, stats.Slots, cfg.SlotNum)
+			require.NotNil(t, stats.LastCleanup, "尚未清理时为创建时间")
+			created := *stats.LastCleanup
+
+			// 从时间段的起点开始，sharded类型的槽位时间戳按精度对齐
+			now := clock.Now()
+			clock.Advance(now.Truncate(cfg.Precision).Add(cfg.Precision).Sub(now))
+			c.Add(100)
+			clock.Advance(cfg.Precision)
+			c.Add(20)
+			clock.Advance(cfg.Precision)
+			c.Add(3)
+			stats = c.Stats()
+			assert.Equal(t, 3, stats.OccupiedSlots)
+			assert.Equal(t, int64(123), stats.Events)
+			assert.True(t, stats.WindowStart.Equal(counter.ClockOf(c).Now().Add(-cfg.WindowSize)))
+
+			// 第一个时间段滑出窗口
+			clock.Advance(cfg.WindowSize - cfg.Precision)
+			stats = c.Stats()
+			assert.Equal(t, 2, stats.OccupiedSlots)
+			assert.Equal(t, int64(23), stats.Events)
+
+			// 清理协程运行后返回清理时间
+			require.Eventually(t, func() bool { return c.Stats().LastCleanup.After(created) }, time.Second, 10*time.Millisecond)
+		})
+	}
+}
+
+// TestCounterRunningTotal 校验增量维护的总计数与逐槽位计算的结果一致
+func TestCounterRunningTotal(t *testing.T) {
+	cfg := &config.CounterConfig{
+		WindowSize: 500 * time.Millisecond,
+		SlotNum:    10,
+		Precision:  50 * time.Millisecond,
+	}
+
+	for _, cType := range []string{counter.ShardedType, counter.LockFreeType} {
+		t.Run(cType, func(t *testing.T) {
+			clock := newFakeClock()
+			c := createCounterWithClock(cfg, cType, clock)
+			defer c.Stop()
+			scanner := c.(interface{ ScanQPS() int64 })
+
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for j := 0; j < 100; j++ {
+						c.Incr()
+					}
+				}()
+			}
+			wg.Wait()
+
+			// 等待清理协程运行后使用O(1)路径
+			time.Sleep(2 * cfg.Precision)
+			assert.Equal(t, int64(2000), c.CurrentQPS())
+			assert.Equal(t, scanner.ScanQPS(), c.CurrentQPS())
+
+			allocs := testing.AllocsPerRun(100, func() { c.CurrentQPS() })
+			assert.Equal(t, float64(0), allocs)
+
+			// 窗口过期后两种计算都归零
+			clock.Advance(cfg.WindowSize + cfg.Precision)
+			assert.Equal(t, int64(0), c.CurrentQPS())
+			assert.Equal(t, int64(0), scanner.ScanQPS())
+		})
+	}
+}
+
+func TestFormatRate(t *testing.T) {
+	cases := []struct {
+		rate float64
+		unit string
+		want string
+	}{
+		{0, counter.UnitEvents, "0 events/s"},
+		{0.3, counter.UnitEvents, "0.3 events/s"},
+		{12.34, counter.UnitRequests, "12.3 requests/s"},
+		{999, counter.UnitRequests, "999 requests/s"},
+		{1234, counter.UnitEvents, "1.2k events/s"},
+		{2500000, "tokens", "2.5M tokens/s"},
+		{512, counter.UnitBytes, "512 B/s"},
+		{1536, counter.UnitBytes, "1.5 KB/s"},
+		{5 * 1024 * 1024, counter.UnitBytes, "5.0 MB/s"},
+	}
+
+	for _, tc := range cases {
+		assert.Equal(t, tc.want, counter.FormatRate(tc.rate, tc.unit))
+	}
+
+	assert.Equal(t, "1.2k requests/min", counter.FormatRatePer(counter.RatePer(20, counter.PerMinute), counter.UnitRequests, counter.PerMinute))
+	assert.Equal(t, "3.5 MB/h", counter.FormatRatePer(counter.RatePer(1024, counter.PerHour), counter.UnitBytes, counter.PerHour))
+	assert.Equal(t, float64(5), counter.RatePer(5, "fortnight"), "不合法的时间单位按每秒处理")
+}
+
+func TestCounterAdd(t *testing.T) {
+	cfg := &config.CounterConfig{
+		WindowSize: time.Second,
+		SlotNum:    10,
+		Precision:  100 * time.Millisecond,
+		Unit:       counter.UnitBytes,
+	}
+
+	for _, cType := range []string{counter.ShardedType, counter.LockFreeType} {
+		t.Run(cType, func(t *testing.T) {
+			c := createCounter(t, cfg, cType)
+			defer c.Stop()
+
+			c.Add(1024)
+			c.Add(0)
+			c.Add(-5) // 非正数被忽略
+			c.Incr()
+
+			assert.Equal(t, int64(1025), c.CurrentQPS())
+			assert.Equal(t, counter.UnitBytes, counter.UnitOf(c))
+		})
+	}
+}
+
+// TestCounterRate 低于1的速率通过RateOf返回小数，CurrentQPS仍为整数
+func TestCounterRate(t *testing.T) {
+	cfg := &config.CounterConfig{
+		WindowSize: 10 * time.Second,
+		SlotNum:    100,
+		Precision:  100 * time.Millisecond,
+	}
+
+	for _, cType := range []string{counter.ShardedType, counter.LockFreeType} {
+		t.Run(cType, func(t *testing.T) {
+			c := createCounter(t, cfg, cType)
+			defer c.Stop()
+
+			c.Add(3)
+			assert.Equal(t, int64(0), c.CurrentQPS())
+			assert.InDelta(t, 0.3, counter.RateOf(c), 1e-9)
+		})
+	}
+
+	assert.Equal(t, 0.33, counter.RoundRate(1.0/3, 2))
+	assert.Equal(t, float64(1), counter.RoundRate(0.5, 0))
+}
+
+func TestSharedCounter(t *testing.T) {
+	cfg := &config.CounterConfig{
+		Type:       counter.SharedType,
+		WindowSize: time.Second,
+		SlotNum:    10,
+		Precision:  100 * time.Millisecond,
+		SharedPath: filepath.Join(t.TempDir(), "qps-counter"),
+	}
+
+	// 两个实例模拟同一台主机上的两个进程
+	server, err := counter.OpenShared(cfg)
+	require.NoError(t, err)
+	defer server.Stop()
+	worker, err := counter.OpenShared(cfg)
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 250; j++ {
+				worker.Incr()
+			}
+		}()
+	}
+	wg.Wait()
+	server.Add(500)
+	assert.Equal(t, int64(1500), server.CurrentQPS())
+	assert.Equal(t, int64(1500), worker.CurrentQPS())
+
+	// 停止后的写入被忽略，其他进程仍然可以继续写入
+	worker.Stop()
+	worker.Incr()
+	server.Incr()
+	assert.Equal(t, int64(1501), server.CurrentQPS())
+
+	// 窗口配置不一致时拒绝打开
+	mismatched := *cfg
+	mismatched.Precision = 50 * time.Millisecond
+	mismatched.SlotNum = 20
+	_, err = counter.OpenShared(&mismatched)
+	assert.Error(t, err)
+}
+
+func TestSharedCounterMultiWriter(t *testing.T) {
+	cfg := &config.CounterConfig{
+		Type:       counter.SharedType,
+		WindowSize: time.Second,
+		SlotNum:    10,
+		Precision:  100 * time.Millisecond,
+		SharedPath: filepath.Join(t.TempDir(), "qps-counter"),
+	}
+	clock := newFakeClock()
+
+	// 多个实例模拟多个进程，共用同一个时钟
+	writers := make([]*counter.SharedWindow, 3)
+	for i := range writers {
+		w, err := counter.OpenSharedWithClock(cfg, clock)
+		require.NoError(t, err)
+		defer w.Stop()
+		writers[i] = w
+	}
+
+	// 先写满所有槽位再让它们全部过期，之后的写入都要切换槽位
+	for i := 0; i < cfg.SlotNum; i++ {
+		writers[0].Add(100)
+		clock.Advance(cfg.Precision)
+	}
+	clock.Advance(cfg.WindowSize)
+	require.Equal(t, int64(0), writers[0].CurrentQPS())
+
+	var written atomic.Int64
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for _, w := range writers {
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func(w *counter.SharedWindow) {
+				defer wg.Done()
+				for {
+					select {
+					case <-stop:
+						return
+					default:
+						w.Incr()
+						written.Add(1)
+					}
+				}
+			}(w)
+		}
+	}
+	// 写入期间推进时钟，多个实例并发地切换到新的时间段，总推进时间不超过窗口长度
+	for i := 0; i < 5; i++ {
+		time.Sleep(20 * time.Millisecond)
+		clock.Advance(cfg.Precision)
+	}
+	close(stop)
+	wg.Wait()
+
+	for _, w := range writers {
+		assert.Equal(t, written.Load(), w.CurrentQPS())
+	}
+}
+
+func TestMultiWindow(t *testing.T) {
+	cfg := &config.CounterConfig{
+		Type:       counter.LockFreeType,
+		WindowSize: time.Second,
+		SlotNum:    10,
+		Precision:  100 * time.Millisecond,
+		Windows:    []time.Duration{time.Second, 10 * time.Second, time.Minute, 5 * time.Minute},
+	}
+	base := counter.NewCounter(cfg)
+	defer base.Stop()
+
+	c := counter.NewMultiWindow(base, cfg)
+	c.Add(600)
+	c.Incr()
+	c.Add(-1)
+
+	// 被包装的计数器按window_size计算，附加窗口按各自的长度换算为每秒
+	assert.Equal(t, int64(601), c.CurrentQPS())
+	assert.Equal(t, []counter.WindowQPS{
+		{Window: "1s", QPS: 601},
+		{Window: "10s", QPS: 60},
+		{Window: "1m", QPS: 10},
+		{Window: "5m", QPS: 2},
+	}, counter.WindowsOf(c))
+	assert.Nil(t, counter.WindowsOf(base))
+
+	assert.Equal(t, "90s", counter.WindowName(90*time.Second))
+	assert.Equal(t, "1h", counter.WindowName(time.Hour))
+	assert.Equal(t, "1.5s", counter.WindowName(1500*time.Millisecond))
+}
+
+func TestCounterVerify(t *testing.T) {
+	cfg := &config.CounterConfig{
+		WindowSize: 500 * time.Millisecond,
+		SlotNum:    10,
+		Precision:  50 * time.Millisecond,
+		Verify:     config.VerifyConfig{Enabled: true},
+	}
+
+	for _, cType := range []string{counter.ShardedType, counter.LockFreeType} {
+		t.Run(cType, func(t *testing.T) {
+			c := createCounter(t, cfg, cType)
+			defer c.Stop()
+			verifier := counter.VerifierOf(counter.NewMultiWindow(c, cfg))
+			require.NotNil(t, verifier)
+
+			// 单个协程写入时不会发生并发更新，窗口与账本一致
+			deadline := time.Now().Add(300 * time.Millisecond)
+			for time.Now().Before(deadline) {
+				c.Add(3)
+				time.Sleep(time.Millisecond)
+			}
+
+			require.Eventually(t, func() bool {
+				return verifier.Stats().Checked >= 4
+			}, time.Second, 10*time.Millisecond)
+			stats := verifier.Stats()
+			assert.True(t, stats.Enabled)
+			assert.Zero(t, stats.Mismatches)
+			assert.Zero(t, stats.Lost)
+		})
+	}
+
+	t.Run("未启用", func(t *testing.T) {
+		c := counter.NewCounter(&config.CounterConfig{WindowSize: time.Second, SlotNum: 10, Precision: 100 * time.Millisecond})
+		defer c.Stop()
+		assert.Nil(t, counter.VerifierOf(c))
+		assert.Equal(t, counter.VerifierStats{}, counter.VerifierOf(c).Stats())
+	})
+}
+
+// TestLockFreeWindowRollover 多个协程在频繁切换槽位时并发写入，窗口中的计数与写入的总数完全一致
+func TestLockFreeWindowRollover(t *testing.T) {
+	cfg := &config.CounterConfig{
+		WindowSize: 2 * time.Second,
+		SlotNum:    200,
+		Precision:  10 * time.Millisecond,
+		// 账本的加锁使清理协程更容易在取得当前时间之后被挂起
+		Verify: config.VerifyConfig{Enabled: true},
+	}
+	c := createCounter(t, cfg, counter.LockFreeType)
+	defer c.Stop()
+
+	var written atomic.Int64
+	var wg sync.WaitGroup
+	deadline := time.Now().Add(500 * time.Millisecond)
+	for i := 0; i < 4*runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for time.Now().Before(deadline) {
+				c.Add(1)
+				written.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	snapshot, ok := counter.SnapshotOf(c, time.Now().UnixNano())
+	require.True(t, ok)
+	var total int64
+	for _, slot := range snapshot.Slots {
+		total += slot.Count
+	}
+	assert.Equal(t, written.Load(), total)
+	assert.Equal(t, written.Load()*int64(time.Second)/int64(cfg.WindowSize), c.(*counter.LockFreeWindow).ScanQPS())
+}
+
+// TestSlidingWindowRollover 附加窗口、按key和标签组合计数使用的滑动窗口在频繁切换槽位时并发写入，计数不会丢失
+func TestSlidingWindowRollover(t *testing.T) {
+	cfg := &config.CounterConfig{
+		WindowSize: 2 * time.Second,
+		SlotNum:    2000,
+		Precision:  time.Millisecond,
+		Windows:    []time.Duration{2 * time.Second},
+	}
+	base := createCounter(t, cfg, counter.LockFreeType)
+	defer base.Stop()
+	c := counter.NewMultiWindow(base, cfg)
+
+	var written atomic.Int64
+	var wg sync.WaitGroup
+	deadline := time.Now().Add(500 * time.Millisecond)
+	for i := 0; i < 4*runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for time.Now().Before(deadline) {
+				c.Add(1)
+				written.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	snapshot, ok := counter.SnapshotOf(c, time.Now().UnixNano())
+	require.True(t, ok)
+	var total int64
+	for _, slot := range snapshot.Windows["2s"] {
+		total += slot.Count
+	}
+	assert.Equal(t, written.Load(), total)
+}
+
+func TestCounterReset(t *testing.T) {
+	cfg := &config.CounterConfig{
+		WindowSize: time.Second,
+		Windows:    []time.Duration{time.Minute},
+		SlotNum:    10,
+		Precision:  100 * time.Millisecond,
+		Verify:     config.VerifyConfig{Enabled: true},
+	}
+
+	for _, cType := range []string{counter.ShardedType, counter.LockFreeType} {
+		t.Run(cType, func(t *testing.T) {
+			base := createCounter(t, cfg, cType)
+			defer base.Stop()
+			c := counter.NewMultiWindow(base, cfg)
+
+			c.Add(100)
+			require.Equal(t, int64(100), c.CurrentQPS())
+			c.Reset()
+			assert.Zero(t, c.CurrentQPS())
+			assert.Zero(t, c.Windows()[0].QPS, "附加窗口同时清空")
+
+			// 清空之后继续计数，被清空的计数不算作校验不一致
+			c.Add(5)
+			assert.Equal(t, int64(5), c.CurrentQPS())
+			time.Sleep(350 * time.Millisecond)
+			assert.Zero(t, counter.VerifierOf(c).Stats().Mismatches)
+		})
+	}
+}
+
+func TestDecayCounter(t *testing.T) {
+	cfg := &config.CounterConfig{Type: counter.DecayType, WindowSize: time.Second, SlotNum: 10, Precision: 100 * time.Millisecond}
+	_, ok := counter.NewCounter(cfg).(*counter.DecayCounter)
+	require.True(t, ok)
+
+	clock := newFakeClock()
+	c := counter.NewDecayWithClock(cfg, clock)
+	defer c.Stop()
+
+	// 速率每5秒更新一次，第一次更新直接使用这段时间的速率
+	c.Add(500)
+	assert.Zero(t, c.CurrentQPS())
+	clock.Advance(5 * time.Second)
+	assert.Equal(t, int64(100), c.CurrentQPS())
+	assert.Equal(t, []counter.WindowQPS{{Window: "1m", QPS: 100}, {Window: "5m", QPS: 100}, {Window: "15m", QPS: 100}}, c.Windows())
+
+	// 停止写入后按各自的时间常数衰减，1分钟后1m速率约为原来的1/e
+	clock.Advance(time.Minute)
+	assert.InDelta(t, 100*math.Exp(-1), c.CurrentRate(), 0.01)
+	windows := c.Windows()
+	assert.Equal(t, int64(81), windows[1].QPS) // e^(-1/5)
+	assert.Equal(t, int64(93), windows[2].QPS) // e^(-1/15)
+
+	// 持续写入时逐步逼近真实速率
+	for i := 0; i < 120; i++ {
+		c.Add(1000)
+		clock.Advance(5 * time.Second)
+	}
+	assert.InDelta(t, 200, c.CurrentRate(), 0.1)
+	assert.Less(t, c.Windows()[2].QPS, int64(200), "15m速率逼近得更慢")
+
+	c.Reset()
+	assert.Zero(t, c.CurrentRate())
+	assert.Zero(t, c.Windows()[2].QPS)
+}
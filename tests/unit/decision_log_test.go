@@ -0,0 +1,173 @@
+package unit_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mant7s/qps-counter/internal/analytics"
+	"github.com/mant7s/qps-counter/internal/config"
+)
+
+// memorySink 保存写入的决策，可以模拟写入失败
+type memorySink struct {
+	mu      sync.Mutex
+	batches [][]analytics.Decision
+	err     error
+	closed  bool
+}
+
+func (s *memorySink) Name() string { return "memory" }
+
+func (s *memorySink) Write(batch []analytics.Decision) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.batches = append(s.batches, append([]analytics.Decision(nil), batch...))
+	return nil
+}
+
+func (s *memorySink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+func (s *memorySink) decisions() []analytics.Decision {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var all []analytics.Decision
+	for _, batch := range s.batches {
+		all = append(all, batch...)
+	}
+	return all
+}
+
+func TestDecisionLog(t *testing.T) {
+	t.Run("记录所有拒绝和超过限额的决策，放行按抽样比例记录", func(t *testing.T) {
+		sink := &memorySink{}
+		log := analytics.NewDecisionLog(config.DecisionLogConfig{FlushInterval: time.Hour}, sink)
+		log.Record(analytics.Decision{Allowed: true, Path: "/collect"})
+		log.Record(analytics.Decision{Allowed: false, Limited: true, Path: "/collect", Rule: "default", Cost: 2})
+		log.Record(analytics.Decision{Allowed: true, Limited: true, Path: "/collect", Rule: "trial", Action: "shadow"})
+		log.Stop()
+
+		decisions := sink.decisions()
+		require.Len(t, decisions, 2)
+		assert.False(t, decisions[0].Allowed)
+		assert.Equal(t, int64(2), decisions[0].Cost)
+		assert.False(t, decisions[0].Time.IsZero())
+		assert.Zero(t, decisions[0].SampleRate)
+		assert.Equal(t, "trial", decisions[1].Rule)
+		assert.Zero(t, decisions[1].SampleRate)
+		assert.True(t, sink.closed)
+
+		sink = &memorySink{}
+		log = analytics.NewDecisionLog(config.DecisionLogConfig{SampleRate: 1, FlushInterval: time.Hour}, sink)
+		for i := 0; i < 3; i++ {
+			log.Record(analytics.Decision{Allowed: true})
+		}
+		log.Stop()
+		decisions = sink.decisions()
+		require.Len(t, decisions, 3)
+		assert.Equal(t, 1.0, decisions[0].SampleRate)
+	})
+
+	t.Run("按批写入", func(t *testing.T) {
+		sink := &memorySink{}
+		log := analytics.NewDecisionLog(config.DecisionLogConfig{BatchSize: 2, FlushInterval: time.Hour}, sink)
+		for i := 0; i < 5; i++ {
+			log.Record(analytics.Decision{Cost: int64(i)})
+		}
+		log.Stop()
+
+		require.Len(t, sink.batches, 3)
+		assert.Len(t, sink.batches[0], 2)
+		assert.Len(t, sink.batches[2], 1)
+		stats := log.GetStats()
+		assert.Equal(t, int64(5), stats["recorded"])
+		assert.Equal(t, int64(5), stats["written"])
+	})
+
+	t.Run("队列已满时丢弃，写入失败时计数", func(t *testing.T) {
+		sink := &memorySink{err: errors.New("sink unavailable")}
+		log := analytics.NewDecisionLog(config.DecisionLogConfig{QueueSize: 1, BatchSize: 100, FlushInterval: time.Hour}, sink)
+		for i := 0; i < 1000; i++ {
+			log.Record(analytics.Decision{})
+		}
+		log.Stop()
+
+		stats := log.GetStats()
+		assert.Equal(t, int64(1000), stats["recorded"].(int64)+stats["dropped"].(int64))
+		assert.Greater(t, stats["dropped"], int64(0))
+		assert.Equal(t, stats["recorded"], stats["failed"])
+		assert.Equal(t, int64(0), stats["written"])
+	})
+
+	t.Run("未启用时所有方法都可以在nil上调用", func(t *testing.T) {
+		var disabled *analytics.DecisionLog
+		disabled.Record(analytics.Decision{})
+		assert.Equal(t, false, disabled.GetStats()["enabled"])
+		disabled.Stop()
+	})
+}
+
+func TestDecisionSinks(t *testing.T) {
+	batch := []analytics.Decision{
+		{Rule: "default", Action: "reject", Limited: true, Key: "key-1", Path: "/collect", Cost: 1},
+		{Rule: "partners", Action: "reject", Tenant: "acme", Path: "/collect", Cost: 3, Allowed: true, SampleRate: 0.1},
+	}
+
+	t.Run("文件中每行一条JSON", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "decisions.jsonl")
+		sink, err := analytics.NewSink(config.DecisionLogConfig{Sink: "file", Path: path}, nil)
+		require.NoError(t, err)
+		require.NoError(t, sink.Write(batch))
+		require.NoError(t, sink.Close())
+
+		file, err := os.Open(path)
+		require.NoError(t, err)
+		defer file.Close()
+		var got []analytics.Decision
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			var d analytics.Decision
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &d))
+			got = append(got, d)
+		}
+		assert.Equal(t, batch, got)
+	})
+
+	t.Run("HTTP以JSON数组POST", func(t *testing.T) {
+		received := make(chan []analytics.Decision, 1)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var got []analytics.Decision
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+			received <- got
+		}))
+		defer server.Close()
+
+		sink, err := analytics.NewSink(config.DecisionLogConfig{Sink: "http", URL: server.URL}, nil)
+		require.NoError(t, err)
+		require.NoError(t, sink.Write(batch))
+		assert.Equal(t, batch, <-received)
+	})
+
+	t.Run("不支持的类型", func(t *testing.T) {
+		_, err := analytics.NewSink(config.DecisionLogConfig{Sink: "kafka"}, nil)
+		assert.Error(t, err)
+	})
+}
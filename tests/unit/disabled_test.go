@@ -0,0 +1,39 @@
+package unit_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mant7s/qps-counter/internal/counter"
+	"github.com/mant7s/qps-counter/internal/metrics"
+)
+
+// 未启用的子系统为nil，调用方不需要判断是否启用
+func TestDisabledComponents(t *testing.T) {
+	var tagged *counter.TaggedCounter
+	assert.False(t, tagged.Add(map[string]string{"route": "/collect"}, 1))
+
+	var keyed *counter.KeyedCounter
+	assert.False(t, keyed.Add("orders", 1))
+
+	var latency *counter.LatencyHistogram
+	latency.Observe(time.Millisecond)
+	latency.Record(time.Millisecond, time.Now())
+
+	var clients *counter.ClientTracker
+	clients.RecordWith(func(string) counter.ClientIdentity {
+		t.Fatal("未启用调用方统计时不应解析调用方")
+		return counter.ClientIdentity{}
+	}, 1)
+	clients.Stop()
+
+	var m *metrics.Metrics
+	assert.NoError(t, m.Register(prometheus.NewCounter(prometheus.CounterOpts{Name: "qps_counter_test_total"})))
+	assert.Nil(t, m.Registry())
+	m.RecordRequest()()
+	m.Start(time.Second)
+	m.Stop()
+}
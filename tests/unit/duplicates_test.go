@@ -0,0 +1,107 @@
+package unit_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/ingest"
+)
+
+func TestDuplicateDetector(t *testing.T) {
+	assert.Nil(t, ingest.NewDuplicateDetector(config.DuplicatesConfig{}))
+
+	start := time.Unix(1700000000, 0)
+	counts := []int64{120, 95, 130, 101, 99, 140, 88, 120}
+	// report 模拟两个代理每10秒上报一次相同的计数，duplicate晚到200ms
+	report := func(d *ingest.DuplicateDetector, i int) (dropOriginal, dropDuplicate bool) {
+		at := start.Add(time.Duration(i) * 10 * time.Second)
+		dropOriginal = d.ObserveAt("agent-a", "checkout", counts[i], at)
+		dropDuplicate = d.ObserveAt("agent-b", "checkout", counts[i], at.Add(200*time.Millisecond))
+		return dropOriginal, dropDuplicate
+	}
+
+	t.Run("flag模式只标记", func(t *testing.T) {
+		d := ingest.NewDuplicateDetector(config.DuplicatesConfig{Enabled: true, Reports: 4})
+		t.Cleanup(d.Stop)
+		for i := 0; i < 3; i++ {
+			report(d, i)
+		}
+		assert.Empty(t, d.Findings(), "上报次数不足")
+
+		for i := 3; i < 6; i++ {
+			dropOriginal, dropDuplicate := report(d, i)
+			assert.False(t, dropOriginal)
+			assert.False(t, dropDuplicate)
+		}
+		findings := d.Findings()
+		require.Len(t, findings, 1)
+		assert.Equal(t, "checkout", findings[0].Key)
+		assert.Equal(t, "agent-b", findings[0].Source)
+		assert.Equal(t, "agent-a", findings[0].DuplicateOf)
+		assert.Equal(t, "10s", findings[0].Interval)
+		assert.Equal(t, int64(3), findings[0].Reports)
+		assert.Zero(t, findings[0].Merged)
+	})
+
+	t.Run("merge模式丢弃重复的上报", func(t *testing.T) {
+		d := ingest.NewDuplicateDetector(config.DuplicatesConfig{Enabled: true, Reports: 4, Action: ingest.DuplicateMerge})
+		t.Cleanup(d.Stop)
+		var dropped []int
+		for i := range counts {
+			dropOriginal, dropDuplicate := report(d, i)
+			assert.False(t, dropOriginal, "原始上报流照常计数")
+			if dropDuplicate {
+				dropped = append(dropped, i)
+			}
+		}
+		assert.Equal(t, []int{3, 4, 5, 6, 7}, dropped)
+		assert.Equal(t, counts[3]+counts[4]+counts[5]+counts[6]+counts[7], d.Findings()[0].Merged)
+
+		// 重复的上报偶尔先于原始上报到达时不改变判定
+		at := start.Add(80 * time.Second)
+		assert.True(t, d.ObserveAt("agent-b", "checkout", 110, at.Add(-100*time.Millisecond)))
+		assert.False(t, d.ObserveAt("agent-a", "checkout", 110, at))
+		require.Len(t, d.Findings(), 1)
+
+		// 计数不再一致时恢复计数
+		at = start.Add(90 * time.Second)
+		d.ObserveAt("agent-a", "checkout", 100, at)
+		assert.False(t, d.ObserveAt("agent-b", "checkout", 50, at.Add(200*time.Millisecond)))
+		assert.Empty(t, d.Findings())
+	})
+
+	t.Run("不同的计数或间隔不判定为重复", func(t *testing.T) {
+		d := ingest.NewDuplicateDetector(config.DuplicatesConfig{Enabled: true, Reports: 4})
+		t.Cleanup(d.Stop)
+		for i := 0; i < 6; i++ {
+			at := start.Add(time.Duration(i) * 10 * time.Second)
+			d.ObserveAt("agent-a", "checkout", counts[i], at)
+			d.ObserveAt("agent-b", "checkout", counts[i]+1, at)
+			// 计数相同但间隔为15秒
+			d.ObserveAt("agent-c", "search", counts[i], start.Add(time.Duration(i)*15*time.Second))
+			d.ObserveAt("agent-d", "search", counts[i], at)
+			// 计数始终相同的上报流无法区分巧合
+			d.ObserveAt("agent-e", "login", 1, at)
+			d.ObserveAt("agent-f", "login", 1, at)
+		}
+		assert.Empty(t, d.Findings())
+	})
+
+	t.Run("清理没有上报的上报流", func(t *testing.T) {
+		d := ingest.NewDuplicateDetector(config.DuplicatesConfig{Enabled: true, Reports: 4, IdleTimeout: time.Minute})
+		t.Cleanup(d.Stop)
+		for i := 0; i < 6; i++ {
+			report(d, i)
+		}
+		require.Len(t, d.Findings(), 1)
+		assert.Equal(t, int64(1), d.GetStats()["tracked_keys"])
+
+		d.Cleanup(start.Add(50*time.Second + 2*time.Minute))
+		assert.Empty(t, d.Findings())
+		assert.Equal(t, int64(0), d.GetStats()["tracked_keys"])
+	})
+}
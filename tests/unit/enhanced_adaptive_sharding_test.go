@@ -8,6 +8,7 @@ import (
 	"github.com/mant7s/qps-counter/internal/config"
 	"github.com/mant7s/qps-counter/internal/counter"
 	"github.com/mant7s/qps-counter/internal/logger"
+	"github.com/mant7s/qps-counter/internal/pressure"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -40,10 +41,24 @@ func (m *mockCounter) SetQPS(qps int64) {
 
 func (m *mockCounter) Stop() {}
 
+func (m *mockCounter) Stats() counter.CounterStats {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return counter.CounterStats{Type: "mock", Events: m.qps}
+}
+
+func (m *mockCounter) Reset() {
+	m.SetQPS(0)
+}
+
 func (m *mockCounter) Incr() {
+	m.Add(1)
+}
+
+func (m *mockCounter) Add(n int64) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	m.qps++
+	m.qps += n
 }
 
 func TestEnhancedAdaptiveShardingManager(t *testing.T) {
@@ -80,12 +95,11 @@ func TestEnhancedAdaptiveShardingManager(t *testing.T) {
 		assert.Equal(t, int32(minShards), asm.GetCurrentShards())
 
 		// 获取状态信息
-		stats := asm.GetStats()
-		assert.NotNil(t, stats)
-		assert.Equal(t, minShards, stats["min_shards"])
-		assert.Equal(t, maxShards, stats["max_shards"])
-		assert.Equal(t, int64(1000), stats["current_qps"])
-		assert.Equal(t, memoryThreshold, stats["memory_threshold"])
+		stats := asm.Stats()
+		assert.Equal(t, minShards, stats.MinShards)
+		assert.Equal(t, maxShards, stats.MaxShards)
+		assert.Equal(t, int64(1000), stats.CurrentQPS)
+		assert.Equal(t, memoryThreshold, stats.MemoryThreshold)
 	})
 
 	t.Run("QPS增加时分片数增加测试", func(t *testing.T) {
@@ -192,4 +206,142 @@ func TestEnhancedAdaptiveShardingManager(t *testing.T) {
 		// 防止memoryHog被过早GC
 		_ = memoryHog
 	})
+	t.Run("压力超过阈值时调整分片数测试", func(t *testing.T) {
+		mock := &mockCounter{qps: 1000}
+		asm := counter.NewEnhancedAdaptiveShardingManager(
+			mock,
+			cfg,
+			minShards,
+			maxShards,
+			1<<40, // 堆内存不会超过阈值，只由压力数据决定
+			adjustInterval,
+		)
+		defer asm.Stop()
+
+		var mu sync.Mutex
+		snapshot := pressure.Snapshot{Available: true, Source: pressure.SourceCgroup}
+		asm.SetPressureReader(func() pressure.Snapshot {
+			mu.Lock()
+			defer mu.Unlock()
+			return snapshot
+		})
+		setPressure := func(cpu, memory float64) {
+			mu.Lock()
+			defer mu.Unlock()
+			snapshot.CPU.SomeAvg10 = cpu
+			snapshot.Memory.SomeAvg10 = memory
+		}
+
+		// CPU压力过高时QPS增加也不增加分片
+		setPressure(50, 0)
+		time.Sleep(adjustInterval * 2)
+		mock.SetQPS(5000)
+		time.Sleep(adjustInterval * 2)
+		assert.Equal(t, int32(minShards), asm.GetCurrentShards())
+
+		// CPU压力恢复后按QPS增加分片
+		setPressure(0, 0)
+		mock.SetQPS(50000)
+		time.Sleep(adjustInterval * 2)
+		assert.Greater(t, int(asm.GetCurrentShards()), minShards)
+
+		// 内存压力过高时减少到最小分片数
+		setPressure(0, 50)
+		time.Sleep(adjustInterval * 3)
+		assert.Equal(t, int32(minShards), asm.GetCurrentShards())
+		stats := asm.Stats()
+		assert.Equal(t, 50.0, stats.Pressure.Memory.SomeAvg10)
+		assert.Equal(t, pressure.DefaultThreshold, stats.PressureThreshold)
+	})
+
+	t.Run("重新配置分片范围和停用测试", func(t *testing.T) {
+		mock := &mockCounter{qps: 1000}
+		asm := counter.NewEnhancedAdaptiveShardingManager(
+			mock,
+			cfg,
+			minShards,
+			maxShards,
+			1<<40,
+			adjustInterval,
+		)
+		defer asm.Stop()
+		asm.SetPressureReader(func() pressure.Snapshot { return pressure.Snapshot{} })
+
+		// 新的最小分片数高于当前分片数时立即调整
+		asm.Configure(config.AdaptiveConfig{
+			Enabled:         true,
+			MinShards:       4,
+			MaxShards:       6,
+			Interval:        adjustInterval,
+			MemoryThreshold: 1 << 40,
+		})
+		assert.Equal(t, int32(4), asm.GetCurrentShards())
+		stats := asm.Stats()
+		assert.Equal(t, 4, stats.MinShards)
+		assert.Equal(t, 6, stats.MaxShards)
+		assert.Equal(t, 0.3, stats.ChangeThreshold)
+
+		// QPS大幅增加时不超过新的最大分片数
+		time.Sleep(adjustInterval * 2)
+		mock.SetQPS(100000)
+		time.Sleep(adjustInterval * 3)
+		assert.Equal(t, int32(6), asm.GetCurrentShards())
+
+		// 停用后QPS变化不再调整分片数
+		asm.Configure(config.AdaptiveConfig{
+			MinShards:       4,
+			MaxShards:       6,
+			Interval:        adjustInterval,
+			MemoryThreshold: 1 << 40,
+		})
+		mock.SetQPS(10)
+		time.Sleep(adjustInterval * 3)
+		assert.Equal(t, int32(6), asm.GetCurrentShards())
+		assert.False(t, asm.Stats().Enabled)
+	})
+
+	t.Run("QPS加速度超过阈值时提前增加分片", func(t *testing.T) {
+		mock := &mockCounter{qps: 1000}
+		asm := counter.NewEnhancedAdaptiveShardingManager(
+			mock,
+			cfg,
+			minShards,
+			maxShards,
+			1<<40,
+			adjustInterval,
+		)
+		defer asm.Stop()
+		asm.SetPressureReader(func() pressure.Snapshot { return pressure.Snapshot{} })
+		var reasons sync.Map
+		asm.SetNotify(func(_, _ int32, reason string) { reasons.Store(reason, true) })
+		asm.Configure(config.AdaptiveConfig{
+			Enabled:               true,
+			MinShards:             minShards,
+			MaxShards:             maxShards,
+			Interval:              adjustInterval,
+			MemoryThreshold:       1 << 40,
+			AccelerationThreshold: 0.1,
+		})
+
+		// QPS不变、加速度低于阈值时不调整
+		acceleration := 50.0
+		var mu sync.Mutex
+		asm.SetAccelerationReader(func() float64 {
+			mu.Lock()
+			defer mu.Unlock()
+			return acceleration
+		})
+		time.Sleep(adjustInterval * 3)
+		assert.Equal(t, int32(minShards), asm.GetCurrentShards())
+
+		// 每秒增长超过当前QPS的10%时，两次检查之间的变化率未超过阈值也增加分片
+		mu.Lock()
+		acceleration = 200
+		mu.Unlock()
+		time.Sleep(adjustInterval * 3)
+		assert.Greater(t, int(asm.GetCurrentShards()), minShards)
+		_, ramped := reasons.Load("qps_ramp")
+		assert.True(t, ramped)
+		assert.Equal(t, 200.0, asm.Stats().Acceleration)
+	})
 }
@@ -0,0 +1,215 @@
+package unit_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/counter"
+	"github.com/mant7s/qps-counter/internal/events"
+	"github.com/mant7s/qps-counter/internal/health"
+	"github.com/mant7s/qps-counter/internal/limiter"
+)
+
+// eventRecorder 记录收到的事件，用于测试
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []events.Event
+}
+
+func (r *eventRecorder) Handle(event events.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *eventRecorder) types() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	types := make([]string, 0, len(r.events))
+	for _, e := range r.events {
+		types = append(types, e.Type)
+	}
+	return types
+}
+
+func TestBurstDetector(t *testing.T) {
+	bus := events.NewBus(16)
+	recorder := &eventRecorder{}
+	bus.Register(recorder)
+
+	// 使用较长的采样间隔，避免后台采样干扰手动注入的数据
+	bd := events.NewBurstDetector(&mockCounter{}, bus, config.BurstConfig{
+		Interval:   time.Hour,
+		Ratio:      2,
+		MinQPS:     50,
+		Thresholds: []int64{1000},
+	})
+	defer bd.Stop()
+
+	start := time.Now()
+	samples := []int64{100, 110, 100, 500, 1200, 150, 100}
+	for i, qps := range samples {
+		bd.Observe(qps, start.Add(time.Duration(i)*time.Second))
+	}
+	assert.False(t, bd.InBurst())
+
+	bus.Stop()
+	assert.Equal(t, []string{
+		events.EventBurstStarted,
+		events.EventThresholdCrossed,
+		events.EventThresholdCrossed,
+		events.EventBurstEnded,
+	}, recorder.types())
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	assert.Equal(t, "up", recorder.events[1].Data["direction"])
+	assert.Equal(t, "down", recorder.events[2].Data["direction"])
+	assert.Equal(t, int64(1200), recorder.events[3].Data["peak_qps"])
+	assert.Equal(t, 2.0, recorder.events[3].Data["duration_seconds"])
+}
+
+func TestWebhookHook(t *testing.T) {
+	received := make(chan events.Event, 4)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event events.Event
+		if err := json.NewDecoder(r.Body).Decode(&event); err == nil {
+			received <- event
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	bus := events.NewBus(16)
+	bus.Register(events.NewWebhookHook(server.URL, []string{events.EventBurstStarted}, time.Second, nil))
+
+	bus.Publish(events.Event{Type: events.EventThresholdCrossed})
+	bus.Publish(events.Event{Type: events.EventBurstStarted, Data: map[string]interface{}{"qps": 500}})
+	bus.Stop()
+
+	require.Len(t, received, 1, "只应投递订阅的事件类型")
+	event := <-received
+	assert.Equal(t, events.EventBurstStarted, event.Type)
+	assert.Equal(t, float64(500), event.Data["qps"])
+	assert.False(t, event.Time.IsZero())
+}
+
+func TestWebhookSignature(t *testing.T) {
+	type delivery struct {
+		signature, timestamp string
+		body                 []byte
+	}
+	received := make(chan delivery, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- delivery{r.Header.Get(events.SignatureHeader), r.Header.Get(events.TimestampHeader), body}
+	}))
+	defer server.Close()
+
+	bus := events.NewBus(16)
+	bus.Register(events.NewWebhookHook(server.URL, nil, time.Second, nil).WithSecret("s3cret"))
+	bus.Register(events.NewWebhookHook(server.URL, nil, time.Second, nil))
+	bus.Publish(events.Event{Type: events.EventStarted})
+	bus.Stop()
+
+	require.Len(t, received, 2)
+	signed, unsigned := <-received, <-received
+	assert.NotEmpty(t, signed.timestamp)
+	assert.Equal(t, events.Sign("s3cret", signed.timestamp, signed.body), signed.signature)
+	assert.NotEqual(t, events.Sign("other", signed.timestamp, signed.body), signed.signature)
+	assert.Empty(t, unsigned.signature, "未配置密钥时不签名")
+	assert.Empty(t, unsigned.timestamp)
+}
+
+func TestLifecycleEvents(t *testing.T) {
+	bus := events.NewBus(16)
+	recorder := &eventRecorder{}
+	bus.Register(recorder)
+
+	// 限流器只在状态变化时发布事件
+	rl := limiter.NewRateLimiter(100, 100, false)
+	rl.SetEnabled(true)
+	rl.SetNotify(events.LimiterNotifier(bus))
+	rl.SetEnabled(true)
+	rl.SetEnabled(false)
+
+	events.ShardResizeNotifier(bus)(8, 12, "qps_increase")
+
+	cfg := &config.AppConfig{Limiter: config.LimiterConfig{Rate: 100}}
+	reload := events.ConfigReloadNotifier(bus, cfg)
+	reload(&config.AppConfig{Limiter: config.LimiterConfig{Rate: 200}, Events: config.EventsConfig{Enabled: true}})
+
+	bus.Publish(events.Started(&config.AppConfig{Server: config.ServerConfig{Role: "query", ServerType: "gin", Port: 8080}}))
+	bus.Stop()
+
+	require.Equal(t, []string{
+		events.EventLimiterToggled,
+		events.EventShardsResized,
+		events.EventConfigReloaded,
+		events.EventStarted,
+	}, recorder.types())
+	assert.Equal(t, false, recorder.events[0].Data["enabled"])
+	assert.Equal(t, int32(12), recorder.events[1].Data["to"])
+	assert.Equal(t, "qps_increase", recorder.events[1].Data["reason"])
+	assert.Equal(t, []string{"limiter", "events"}, recorder.events[2].Data["sections"])
+	assert.Equal(t, "query", recorder.events[3].Data["role"])
+	assert.NotContains(t, recorder.events[3].Data, "admin_port")
+}
+
+func TestHealthWatcher(t *testing.T) {
+	bus := events.NewBus(16)
+	recorder := &eventRecorder{}
+	bus.Register(recorder)
+	hw := events.NewHealthWatcher(health.NewRegistry(), bus, time.Hour)
+	defer hw.Stop()
+
+	degraded := health.Report{Status: health.Degraded, Components: map[string]health.Result{
+		"ingest":  {Status: health.Degraded, Reason: "采集已暂停"},
+		"limiter": {Status: health.Healthy},
+	}}
+	hw.Observe(health.Report{Status: health.Healthy})
+	hw.Observe(degraded)
+	hw.Observe(health.Report{Status: health.Unhealthy}) // 仍不是healthy，不重复发布
+	hw.Observe(health.Report{Status: health.Healthy})
+	bus.Stop()
+
+	require.Equal(t, []string{events.EventDegradedEntered, events.EventDegradedExited}, recorder.types())
+	assert.Equal(t, health.Degraded, recorder.events[0].Data["status"])
+	assert.Equal(t, map[string]health.Result{"ingest": {Status: health.Degraded, Reason: "采集已暂停"}}, recorder.events[0].Data["components"])
+}
+
+func TestShutdownNotifier(t *testing.T) {
+	bus := events.NewBus(16)
+	recorder := &eventRecorder{}
+	bus.Register(recorder)
+
+	gs := counter.NewEnhancedGracefulShutdown(time.Second, 2*time.Second)
+	gs.SetNotify(events.ShutdownNotifier(bus))
+	require.True(t, gs.StartRequest())
+
+	go gs.Shutdown(context.Background())
+	time.Sleep(50 * time.Millisecond)
+	gs.EndRequest()
+	<-gs.DoneChan()
+	bus.Stop()
+
+	require.Equal(t, []string{events.EventShutdownStarted, events.EventShutdownFinished}, recorder.types())
+	started, finished := recorder.events[0], recorder.events[1]
+	assert.Equal(t, "shutting_down", started.Data["phase"])
+	assert.Equal(t, int64(1), started.Data["active_requests"])
+	assert.NotNil(t, started.Data["deadline"])
+	assert.Equal(t, "graceful_shutdown_complete", finished.Data["phase"])
+	assert.Equal(t, int64(0), finished.Data["active_requests"])
+	assert.Equal(t, false, finished.Data["forced"])
+	assert.Greater(t, finished.Data["elapsed_seconds"], 0.0)
+}
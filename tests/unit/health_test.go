@@ -0,0 +1,90 @@
+package unit_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/counter"
+	"github.com/mant7s/qps-counter/internal/health"
+	"github.com/mant7s/qps-counter/internal/ingest"
+	"github.com/mant7s/qps-counter/internal/replication"
+	"github.com/mant7s/qps-counter/internal/snapshot"
+	"github.com/mant7s/qps-counter/internal/storage"
+)
+
+// failingStorage 写入总是失败的存储
+type failingStorage struct {
+	storage.Storage
+}
+
+func (failingStorage) Put(string, []byte) error {
+	return errors.New("disk full")
+}
+
+func TestHealth(t *testing.T) {
+	t.Run("整体状态取最严重的组件状态", func(t *testing.T) {
+		registry := health.NewRegistry()
+		registry.Register("a", func() health.Result { return health.Result{Status: health.Healthy} })
+		registry.Register("b", func() health.Result { return health.Result{Status: health.Degraded, Reason: "b"} })
+		report := registry.Check()
+		assert.Equal(t, health.Degraded, report.Status)
+		assert.Equal(t, http.StatusOK, report.StatusCode())
+		assert.Len(t, report.Components, 2)
+
+		registry.Register("c", func() health.Result { return health.Result{Status: health.Unhealthy, Reason: "c"} })
+		report = registry.Check()
+		assert.Equal(t, health.Unhealthy, report.Status)
+		assert.Equal(t, http.StatusServiceUnavailable, report.StatusCode())
+
+		var empty *health.Registry
+		assert.Equal(t, health.Healthy, empty.Check().Status)
+	})
+
+	t.Run("开始关闭后为degraded", func(t *testing.T) {
+		gs := counter.NewEnhancedGracefulShutdown(time.Second, time.Second)
+		check := health.ShutdownCheck(gs)
+		assert.Equal(t, health.Healthy, check().Status)
+
+		require.NoError(t, gs.Shutdown(context.Background()))
+		assert.Equal(t, health.Degraded, check().Status)
+	})
+
+	t.Run("采集暂停后为degraded", func(t *testing.T) {
+		sw := ingest.NewSwitch("")
+		check := health.IngestCheck(nil, sw)
+		assert.Equal(t, health.Healthy, check().Status)
+
+		sw.Pause()
+		assert.Equal(t, health.Result{Status: health.Degraded, Reason: "采集已暂停"}, check())
+	})
+
+	t.Run("只读副本未连接上报节点时为unhealthy", func(t *testing.T) {
+		c := createCounter(t, &config.CounterConfig{WindowSize: time.Second, SlotNum: 10, Precision: 100 * time.Millisecond}, counter.LockFreeType)
+		defer c.Stop()
+		follower := replication.NewFollower(c, []string{"http://127.0.0.1:1"}, "", nil)
+		defer follower.Stop()
+
+		result := health.FollowerCheck(follower)()
+		assert.Equal(t, health.Unhealthy, result.Status)
+		assert.NotEmpty(t, result.Reason)
+	})
+
+	t.Run("写入快照失败后为degraded", func(t *testing.T) {
+		c := createCounter(t, &config.CounterConfig{WindowSize: time.Second, SlotNum: 10, Precision: 100 * time.Millisecond}, counter.LockFreeType)
+		defer c.Stop()
+		s := snapshot.NewSnapshotter(config.SnapshotConfig{Interval: 10 * time.Millisecond}, 100*time.Millisecond, failingStorage{storage.NewMemoryStorage()}, c, nil, nil)
+		check := health.SnapshotCheck(s)
+		assert.Equal(t, health.Healthy, check().Status)
+
+		s.Start()
+		defer s.Stop()
+		assert.Eventually(t, func() bool { return check().Status == health.Degraded }, time.Second, 10*time.Millisecond)
+	})
+}
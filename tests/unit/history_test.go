@@ -0,0 +1,55 @@
+package unit_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mant7s/qps-counter/internal/counter"
+)
+
+func TestHistory(t *testing.T) {
+	mock := &mockCounter{}
+	h := counter.NewHistory(mock, 5*time.Second)
+	defer h.Stop()
+
+	assert.Equal(t, 5*time.Second, h.Retention())
+	assert.Equal(t, time.Second, h.Interval())
+	assert.Empty(t, h.Samples(0))
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		h.Record(int64(i*10), start.Add(time.Duration(i)*time.Second))
+	}
+	assert.Equal(t, []counter.HistorySample{
+		{Time: start, QPS: 0},
+		{Time: start.Add(time.Second), QPS: 10},
+		{Time: start.Add(2 * time.Second), QPS: 20},
+	}, h.Samples(0))
+
+	t.Run("缓冲区已满时覆盖最早的采样", func(t *testing.T) {
+		for i := 3; i < 8; i++ {
+			h.Record(int64(i*10), start.Add(time.Duration(i)*time.Second))
+		}
+		samples := h.Samples(0)
+		assert.Len(t, samples, 5)
+		assert.Equal(t, int64(30), samples[0].QPS)
+		assert.Equal(t, int64(70), samples[4].QPS)
+	})
+
+	t.Run("按时长返回最近的采样", func(t *testing.T) {
+		samples := h.Samples(2 * time.Second)
+		assert.Equal(t, []counter.HistorySample{
+			{Time: start.Add(6 * time.Second), QPS: 60},
+			{Time: start.Add(7 * time.Second), QPS: 70},
+		}, samples)
+		assert.Len(t, h.Samples(time.Hour), 5)
+	})
+
+	t.Run("保留时长不足1秒时使用默认值", func(t *testing.T) {
+		h := counter.NewHistory(mock, 0)
+		defer h.Stop()
+		assert.Equal(t, time.Hour, h.Retention())
+	})
+}
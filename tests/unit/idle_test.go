@@ -0,0 +1,102 @@
+package unit_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/counter"
+)
+
+func TestIdleDetectorPauseAndWake(t *testing.T) {
+	detector := counter.NewIdleDetector(50 * time.Millisecond)
+	stop := make(chan struct{})
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	// 未达到空闲时长时立即返回
+	assert.True(t, detector.PauseTicker(ticker, 10*time.Millisecond, stop))
+	assert.False(t, detector.Idle())
+
+	time.Sleep(60 * time.Millisecond)
+
+	resumed := make(chan bool, 1)
+	go func() {
+		resumed <- detector.PauseTicker(ticker, 10*time.Millisecond, stop)
+	}()
+
+	require.Eventually(t, detector.Idle, time.Second, 5*time.Millisecond)
+	select {
+	case <-resumed:
+		t.Fatal("空闲时不应返回")
+	case <-time.After(30 * time.Millisecond):
+	}
+
+	detector.Touch(time.Now().UnixNano())
+	select {
+	case ok := <-resumed:
+		assert.True(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("新事件到达后应立即唤醒")
+	}
+	assert.False(t, detector.Idle())
+}
+
+func TestIdleDetectorStop(t *testing.T) {
+	detector := counter.NewIdleDetector(10 * time.Millisecond)
+	stop := make(chan struct{})
+	ticker := time.NewTicker(time.Millisecond)
+	defer ticker.Stop()
+
+	time.Sleep(20 * time.Millisecond)
+
+	resumed := make(chan bool, 1)
+	go func() {
+		resumed <- detector.PauseTicker(ticker, time.Millisecond, stop)
+	}()
+	require.Eventually(t, detector.Idle, time.Second, time.Millisecond)
+
+	close(stop)
+	select {
+	case ok := <-resumed:
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("停止后应返回")
+	}
+}
+
+func TestCounterIdleMode(t *testing.T) {
+	for _, counterType := range []string{counter.LockFreeType, counter.ShardedType} {
+		t.Run(counterType, func(t *testing.T) {
+			cfg := &config.CounterConfig{
+				Type:       counterType,
+				WindowSize: 100 * time.Millisecond,
+				SlotNum:    10,
+				Precision:  10 * time.Millisecond,
+				Idle:       config.IdleConfig{Enabled: true, Timeout: 150 * time.Millisecond},
+			}
+			c := counter.NewCounter(cfg)
+			defer c.Stop()
+
+			detector := counter.IdleDetectorOf(c)
+			require.NotNil(t, detector)
+
+			// 无事件时清理协程进入空闲状态
+			require.Eventually(t, detector.Idle, time.Second, 10*time.Millisecond)
+			assert.Equal(t, int64(0), c.CurrentQPS())
+
+			// 新事件立即唤醒并正常计数
+			c.Incr()
+			assert.False(t, detector.Idle())
+			assert.Greater(t, c.CurrentQPS(), int64(0))
+		})
+	}
+
+	// 未启用时不创建检测器
+	c := counter.NewCounter(&config.CounterConfig{Type: counter.LockFreeType, WindowSize: time.Second, SlotNum: 10, Precision: 100 * time.Millisecond})
+	defer c.Stop()
+	assert.Nil(t, counter.IdleDetectorOf(c))
+}
@@ -0,0 +1,198 @@
+package unit_test
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/counter"
+	"github.com/mant7s/qps-counter/internal/ingest"
+)
+
+// stubSource 测试用的数据源，不读取任何数据，行由测试直接通过Process提交
+type stubSource struct {
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newStubSource() *stubSource {
+	return &stubSource{closed: make(chan struct{})}
+}
+
+func (s *stubSource) Run(func(line []byte)) error {
+	<-s.closed
+	return nil
+}
+
+func (s *stubSource) Close() error {
+	s.once.Do(func() { close(s.closed) })
+	return nil
+}
+
+// ingestRecorder 记录工作池处理的事件
+type ingestRecorder struct {
+	mu     sync.Mutex
+	events []ingest.Event
+}
+
+func (r *ingestRecorder) sink(event ingest.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *ingestRecorder) keys() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	keys := make([]string, len(r.events))
+	for i, e := range r.events {
+		keys[i] = e.Key
+	}
+	return keys
+}
+
+// TestIngestPipelineStages 管道依次解码、归一化key、补充标签后提交到工作池，无法解码的行只计入invalid
+func TestIngestPipelineStages(t *testing.T) {
+	var recorder ingestRecorder
+	pool := ingest.NewPool(config.IngestConfig{Workers: 1}, recorder.sink, nil)
+	p := ingest.NewPipelineWithSource(config.PipelineConfig{
+		Name:       "edge",
+		Source:     "stub",
+		Key:        config.PipelineKeyConfig{Lowercase: true, StripQuery: true, MaxLength: 8},
+		Attributes: map[string]string{"env": "prod", "route": "unknown"},
+	}, newStubSource(), pool)
+
+	assert.True(t, p.Process([]byte(`{"key":"/Pay?id=1","count":3,"timestamp":1700000000000,"attributes":{"route":"/pay"}}`)))
+	assert.True(t, p.Process([]byte(`{"key":"ABCDEFGHIJ"}`)))
+	assert.False(t, p.Process([]byte(`not json`)))
+	assert.False(t, p.Process([]byte(`{"count":-1}`)))
+	assert.False(t, p.Process([]byte("  \n")))
+	p.Stop()
+	pool.Stop()
+
+	require.Len(t, recorder.events, 2)
+	assert.Equal(t, ingest.Event{
+		Source:     "edge",
+		Key:        "/pay",
+		Count:      3,
+		Timestamp:  1700000000000,
+		Attributes: map[string]string{"env": "prod", "route": "/pay"},
+	}, recorder.events[0])
+	assert.Equal(t, "abcdefgh", recorder.events[1].Key)
+	assert.Equal(t, int64(1), recorder.events[1].Count)
+	assert.Equal(t, ingest.PipelineStats{Name: "edge", Source: "stub", Received: 4, Invalid: 2, Submitted: 2}, p.Stats())
+}
+
+// TestIngestPipelineSampling 采样保留的事件按1/sample_rate放大计数
+func TestIngestPipelineSampling(t *testing.T) {
+	var recorder ingestRecorder
+	pool := ingest.NewPool(config.IngestConfig{Workers: 1}, recorder.sink, nil)
+	p := ingest.NewPipelineWithSource(config.PipelineConfig{Name: "sampled", Format: ingest.FormatLine, SampleRate: 0.5}, newStubSource(), pool)
+
+	for i := 0; i < 1000; i++ {
+		p.Process([]byte("/checkout"))
+	}
+	p.Stop()
+	pool.Stop()
+
+	stats := p.Stats()
+	assert.Equal(t, int64(1000), stats.Sampled+stats.Submitted)
+	assert.Positive(t, stats.Sampled)
+	assert.Positive(t, stats.Submitted)
+	for _, e := range recorder.events {
+		assert.Equal(t, int64(2), e.Count)
+		assert.Equal(t, "/checkout", e.Key)
+	}
+}
+
+// TestIngestPipelineUDP 每个数据报可以包含多行
+func TestIngestPipelineUDP(t *testing.T) {
+	var recorder ingestRecorder
+	pool := ingest.NewPool(config.IngestConfig{Workers: 1}, recorder.sink, nil)
+	defer pool.Stop()
+	p, err := ingest.NewPipeline(config.PipelineConfig{Name: "udp", Source: ingest.SourceUDP, Address: "127.0.0.1:0", Format: ingest.FormatLine}, pool)
+	require.NoError(t, err)
+	defer p.Stop()
+
+	conn, err := net.Dial("udp", p.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("/a\n/b\n"))
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool { return p.Stats().Submitted == 2 }, time.Second, 10*time.Millisecond)
+	assert.Eventually(t, func() bool { return slices.Equal(recorder.keys(), []string{"/a", "/b"}) }, time.Second, 10*time.Millisecond)
+}
+
+// TestIngestPipelineTail 只读取启动后写入的完整行，文件被截断或轮转后从头读取
+func TestIngestPipelineTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	require.NoError(t, os.WriteFile(path, []byte("/before\n"), 0o600))
+
+	var recorder ingestRecorder
+	pool := ingest.NewPool(config.IngestConfig{Workers: 1}, recorder.sink, nil)
+	defer pool.Stop()
+	p, err := ingest.NewPipeline(config.PipelineConfig{Name: "tail", Source: ingest.SourceTail, Path: path, Format: ingest.FormatLine}, pool)
+	require.NoError(t, err)
+	defer p.Stop()
+	assert.Nil(t, p.Addr())
+
+	appendLine := func(line string) {
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+		require.NoError(t, err)
+		_, err = f.WriteString(line)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+	}
+	seen := func(key string) func() bool {
+		return func() bool { return slices.Contains(recorder.keys(), key) }
+	}
+
+	// 数据源在协程中打开文件，反复写入直到读到第一行
+	assert.Eventually(t, func() bool {
+		appendLine("/probe\n")
+		return p.Stats().Received > 0
+	}, 2*time.Second, 50*time.Millisecond)
+	assert.NotContains(t, recorder.keys(), "/before")
+
+	// 没有换行的部分等到整行写完再提交
+	appendLine("/par")
+	time.Sleep(300 * time.Millisecond)
+	assert.NotContains(t, recorder.keys(), "/par")
+	appendLine("tial\n")
+	assert.Eventually(t, seen("/partial"), 2*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, os.WriteFile(path, []byte("/truncated\n"), 0o600))
+	assert.Eventually(t, seen("/truncated"), 2*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, os.Rename(path, path+".1"))
+	require.NoError(t, os.WriteFile(path, []byte("/rotated\n"), 0o600))
+	assert.Eventually(t, seen("/rotated"), 2*time.Second, 10*time.Millisecond)
+}
+
+// TestIngestCounterSink 携带时间戳的事件写入事件时间所在的槽位，超出窗口的事件不计数
+func TestIngestCounterSink(t *testing.T) {
+	cfg := &config.CounterConfig{Type: counter.LockFreeType, WindowSize: time.Second, SlotNum: 10, Precision: 100 * time.Millisecond}
+	c := counter.NewCounter(cfg)
+	defer c.Stop()
+	keyed := counter.NewKeyedCounter(cfg)
+	defer keyed.Stop()
+
+	sink := ingest.CounterSink(c, nil, keyed)
+	sink(ingest.Event{Key: "checkout", Count: 3, Timestamp: time.Now().Add(-300 * time.Millisecond).UnixMilli()})
+	sink(ingest.Event{Key: "checkout", Count: 5, Timestamp: time.Now().Add(-time.Minute).UnixMilli()})
+	sink(ingest.Event{Count: 2})
+
+	assert.Equal(t, int64(5), c.CurrentQPS())
+	qps, ok := keyed.QPS("checkout")
+	assert.True(t, ok)
+	assert.Equal(t, int64(3), qps)
+}
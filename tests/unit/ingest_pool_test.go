@@ -0,0 +1,103 @@
+package unit_test
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/ingest"
+)
+
+func TestIngestPoolBlock(t *testing.T) {
+	var total atomic.Int64
+	pool := ingest.NewPool(config.IngestConfig{Workers: 4, QueueSize: 8}, func(event ingest.Event) {
+		total.Add(event.Count)
+	}, nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				assert.True(t, pool.Submit(ingest.Event{Source: "test", Count: 2}))
+			}
+		}()
+	}
+	wg.Wait()
+	pool.Stop()
+
+	// block策略下不丢弃事件，停止时处理完队列中剩余的事件
+	assert.Equal(t, int64(2000), total.Load())
+	assert.Equal(t, int64(1000), pool.Processed())
+	assert.Equal(t, int64(0), pool.Dropped())
+	assert.False(t, pool.Submit(ingest.Event{Count: 1}))
+}
+
+func TestIngestPoolDropPolicies(t *testing.T) {
+	for _, overflow := range []string{ingest.OverflowDropNewest, ingest.OverflowDropOldest} {
+		t.Run(overflow, func(t *testing.T) {
+			release := make(chan struct{})
+			var mu sync.Mutex
+			var processed []int64
+			pool := ingest.NewPool(config.IngestConfig{Workers: 1, QueueSize: 2, Overflow: overflow}, func(event ingest.Event) {
+				<-release
+				mu.Lock()
+				processed = append(processed, event.Count)
+				mu.Unlock()
+			}, nil)
+
+			// 第一个事件被工作协程取出后阻塞，随后的两个事件填满队列
+			assert.True(t, pool.Submit(ingest.Event{Count: 1}))
+			assert.Eventually(t, func() bool { return pool.QueueLength() == 0 }, time.Second, time.Millisecond)
+			assert.True(t, pool.Submit(ingest.Event{Count: 2}))
+			assert.True(t, pool.Submit(ingest.Event{Count: 3}))
+
+			accepted := pool.Submit(ingest.Event{Count: 4})
+			assert.Equal(t, int64(1), pool.Dropped())
+
+			close(release)
+			pool.Stop()
+
+			if overflow == ingest.OverflowDropNewest {
+				assert.False(t, accepted)
+				assert.Equal(t, []int64{1, 2, 3}, processed)
+			} else {
+				assert.True(t, accepted)
+				assert.Equal(t, []int64{1, 3, 4}, processed)
+			}
+		})
+	}
+}
+
+func TestIngestPoolPause(t *testing.T) {
+	var total atomic.Int64
+	pause := ingest.NewSwitch("")
+	pool := ingest.NewPool(config.IngestConfig{Workers: 1, QueueSize: 8}, func(event ingest.Event) {
+		total.Add(event.Count)
+	}, pause)
+	defer pool.Stop()
+
+	assert.Equal(t, ingest.PauseReject, pause.Mode())
+	assert.True(t, pool.Submit(ingest.Event{Count: 1}))
+
+	assert.True(t, pause.Pause())
+	assert.False(t, pause.Pause(), "重复暂停不改变状态")
+	assert.False(t, pool.Submit(ingest.Event{Count: 10}))
+	assert.Equal(t, int64(1), pause.GetStats()["dropped_count"])
+	assert.Contains(t, pause.GetStats(), "paused_at")
+
+	assert.True(t, pause.Resume())
+	assert.True(t, pool.Submit(ingest.Event{Count: 2}))
+	assert.Eventually(t, func() bool { return total.Load() == 3 }, time.Second, time.Millisecond)
+	assert.Equal(t, false, pause.GetStats()["paused"])
+
+	// nil开关表示不支持暂停
+	var none *ingest.Switch
+	assert.False(t, none.Paused())
+	none.Drop()
+}
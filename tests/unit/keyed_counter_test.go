@@ -0,0 +1,160 @@
+package unit_test
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/counter"
+)
+
+func TestKeyedCounter(t *testing.T) {
+	cfg := &config.CounterConfig{
+		WindowSize: time.Second,
+		SlotNum:    10,
+		Precision:  100 * time.Millisecond,
+		Keys:       config.KeysConfig{Enabled: true, MaxKeys: 2},
+	}
+	kc := counter.NewKeyedCounter(cfg)
+
+	t.Run("按key分别计数", func(t *testing.T) {
+		assert.True(t, kc.Add("checkout", 5))
+		assert.True(t, kc.Add("checkout", 2))
+		assert.True(t, kc.Add("search", 1))
+
+		qps, tracked := kc.QPS("checkout")
+		assert.True(t, tracked)
+		assert.Equal(t, int64(7), qps)
+
+		qps, tracked = kc.QPS("missing")
+		assert.False(t, tracked)
+		assert.Zero(t, qps)
+
+		assert.Equal(t, []counter.KeyQPS{{Key: "checkout", QPS: 7}, {Key: "search", QPS: 1}}, kc.Top(0))
+		assert.Equal(t, []counter.KeyQPS{{Key: "checkout", QPS: 7}}, kc.Top(1))
+	})
+
+	t.Run("空key和非正数不计数", func(t *testing.T) {
+		assert.False(t, kc.Add("", 1))
+		assert.False(t, kc.Add("search", 0))
+		assert.Equal(t, int64(0), kc.Overflow())
+	})
+
+	t.Run("超出基数限制的新key被丢弃", func(t *testing.T) {
+		assert.False(t, kc.Add("new", 4))
+		assert.Equal(t, 2, kc.KeyCount())
+		assert.Equal(t, int64(4), kc.Overflow())
+
+		// 已有key不受影响
+		assert.True(t, kc.Add("search", 1))
+	})
+}
+
+func TestKeyedCounterSketch(t *testing.T) {
+	cfg := &config.CounterConfig{
+		Type:       counter.SketchType,
+		WindowSize: time.Second,
+		SlotNum:    10,
+		Precision:  100 * time.Millisecond,
+		Keys:       config.KeysConfig{Enabled: true, MaxKeys: 3},
+	}
+	kc := counter.NewKeyedCounter(cfg)
+
+	t.Run("高基数下不丢弃事件", func(t *testing.T) {
+		for i := 0; i < 5000; i++ {
+			assert.True(t, kc.Add(fmt.Sprintf("tenant-%d", i), 1))
+		}
+		assert.Equal(t, int64(0), kc.Overflow())
+		assert.Equal(t, 3, kc.KeyCount(), "只列出max_keys个候选key")
+
+		// 估算值不会低于实际值，偏差不超过总计数的e/width
+		qps, tracked := kc.QPS("tenant-42")
+		assert.True(t, tracked)
+		assert.GreaterOrEqual(t, qps, int64(1))
+		assert.LessOrEqual(t, qps, int64(1+5000*3/2048))
+	})
+
+	t.Run("热点key替换候选key", func(t *testing.T) {
+		for i := 0; i < 10; i++ {
+			kc.Add("hot", 100)
+			kc.Add("warm", 50)
+		}
+
+		top := kc.Top(2)
+		if assert.Len(t, top, 2) {
+			assert.Equal(t, "hot", top[0].Key)
+			assert.GreaterOrEqual(t, top[0].QPS, int64(1000))
+			assert.Equal(t, "warm", top[1].Key)
+			assert.GreaterOrEqual(t, top[1].QPS, int64(500))
+		}
+		assert.Equal(t, 3, kc.KeyCount())
+	})
+}
+
+func TestKeyedCounterIdleTTL(t *testing.T) {
+	cfg := &config.CounterConfig{
+		WindowSize: time.Second,
+		SlotNum:    10,
+		Precision:  100 * time.Millisecond,
+		Keys:       config.KeysConfig{Enabled: true, MaxKeys: 2, IdleTTL: time.Minute},
+	}
+	kc := counter.NewKeyedCounter(cfg)
+	t.Cleanup(kc.Stop)
+
+	assert.True(t, kc.Add("checkout", 1))
+	assert.True(t, kc.Add("search", 1))
+	assert.False(t, kc.Add("new", 1))
+
+	now := time.Now()
+	assert.Zero(t, kc.Expire(now.Add(30*time.Second)), "未超过idle_ttl的key不清理")
+	assert.Equal(t, 2, kc.KeyCount())
+
+	assert.Equal(t, 2, kc.Expire(now.Add(2*time.Minute)))
+	assert.Zero(t, kc.KeyCount())
+	assert.Equal(t, int64(2), kc.Evicted())
+
+	// 清理后释放的名额可以跟踪新key，被清理的key重新写入时从零开始计数
+	assert.True(t, kc.Add("new", 3))
+	assert.True(t, kc.Add("checkout", 1))
+	qps, tracked := kc.QPS("checkout")
+	assert.True(t, tracked)
+	assert.Equal(t, int64(1), qps)
+
+	t.Run("并发清理时每个key只计数一次", func(t *testing.T) {
+		kc := counter.NewKeyedCounter(cfg)
+		defer kc.Stop()
+		kc.Add("checkout", 1)
+		kc.Add("search", 1)
+
+		var expired atomic.Int64
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				expired.Add(int64(kc.Expire(now.Add(2 * time.Minute))))
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, int64(2), expired.Load())
+		assert.Equal(t, int64(2), kc.Evicted())
+
+		// 名额没有被重复释放，仍然最多跟踪max_keys个key
+		assert.True(t, kc.Add("a", 1))
+		assert.True(t, kc.Add("b", 1))
+		assert.False(t, kc.Add("c", 1))
+	})
+
+	t.Run("未配置idle_ttl时不清理", func(t *testing.T) {
+		kc := counter.NewKeyedCounter(&config.CounterConfig{WindowSize: time.Second, SlotNum: 10, Precision: 100 * time.Millisecond})
+		kc.Add("checkout", 1)
+		assert.Zero(t, kc.Expire(time.Now().Add(24*time.Hour)))
+		assert.Equal(t, 1, kc.KeyCount())
+		kc.Stop()
+	})
+}
@@ -0,0 +1,129 @@
+package unit_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/counter"
+)
+
+func TestLatencyHistogram(t *testing.T) {
+	h := counter.NewLatencyHistogram(&config.CounterConfig{
+		SlotNum: 10,
+		Latency: config.LatencyConfig{Window: 10 * time.Second},
+	})
+	assert.Equal(t, 10*time.Second, h.Window())
+
+	start := time.Unix(1700000000, 0)
+	assert.Equal(t, counter.LatencyStats{Window: "10s"}, h.StatsAt(start))
+
+	// 1ms到100ms各一次
+	for i := 1; i <= 100; i++ {
+		h.Record(time.Duration(i)*time.Millisecond, start)
+	}
+	stats := h.StatsAt(start)
+	assert.Equal(t, int64(100), stats.Count)
+	assert.InDelta(t, 50.5, stats.Mean, 0.001)
+	// 桶的中点与真实值的相对误差不超过1/16
+	assert.InEpsilon(t, 50, stats.P50, 1.0/16)
+	assert.InEpsilon(t, 95, stats.P95, 1.0/16)
+	assert.InEpsilon(t, 99, stats.P99, 1.0/16)
+	assert.Equal(t, 100.0, stats.Max, "最大延迟不受桶宽影响")
+
+	t.Run("小于8微秒的延迟精确统计", func(t *testing.T) {
+		small := counter.NewLatencyHistogram(&config.CounterConfig{SlotNum: 10})
+		small.Record(5*time.Microsecond, start)
+		small.Record(-time.Millisecond, start)
+		stats := small.StatsAt(start)
+		assert.Equal(t, int64(2), stats.Count)
+		assert.Equal(t, 0.005, stats.Max)
+		assert.Equal(t, 0.0, stats.P50)
+	})
+
+	t.Run("超出窗口的观测值不再统计", func(t *testing.T) {
+		later := start.Add(5 * time.Second)
+		h.Record(time.Second, later)
+		stats := h.StatsAt(later)
+		assert.Equal(t, int64(101), stats.Count)
+		assert.InEpsilon(t, 1000, stats.Max, 1.0/16)
+
+		stats = h.StatsAt(start.Add(10 * time.Second))
+		assert.Equal(t, int64(1), stats.Count)
+		assert.InEpsilon(t, 1000, stats.P50, 1.0/16)
+
+		assert.Equal(t, int64(0), h.StatsAt(start.Add(time.Minute)).Count)
+	})
+
+	t.Run("槽位复用时清除过期的观测值", func(t *testing.T) {
+		reused := start.Add(20 * time.Second)
+		h.Record(2*time.Millisecond, reused)
+		stats := h.StatsAt(reused)
+		assert.Equal(t, int64(1), stats.Count)
+		assert.InEpsilon(t, 2, stats.P99, 1.0/16)
+	})
+
+	t.Run("hdr保留3位有效数字", func(t *testing.T) {
+		hdr := counter.NewLatencyHistogram(&config.CounterConfig{SlotNum: 10, Histogram: counter.HistogramHDR})
+		// 1ms到10s各一次，跨越4个数量级
+		for i := 1; i <= 10000; i++ {
+			hdr.Record(time.Duration(i)*time.Millisecond, start)
+		}
+		hdr.Record(1234*time.Microsecond, start)
+		stats := hdr.StatsAt(start)
+		assert.Equal(t, int64(10001), stats.Count)
+		assert.InEpsilon(t, 5000, stats.P50, 1.0/2048)
+		assert.InEpsilon(t, 9500, stats.P95, 1.0/2048)
+		assert.InEpsilon(t, 9900, stats.P99, 1.0/2048)
+		assert.Equal(t, 10000.0, stats.Max)
+
+		// 小于1024微秒的延迟精确统计
+		small := counter.NewLatencyHistogram(&config.CounterConfig{SlotNum: 10, Histogram: counter.HistogramHDR})
+		small.Record(999*time.Microsecond, start)
+		assert.Equal(t, 0.999, small.StatsAt(start).P50)
+	})
+}
+
+func TestLatencySeries(t *testing.T) {
+	assert.Nil(t, counter.NewLatencySeries(&config.CounterConfig{SlotNum: 10}), "per_key和per_tag都未启用")
+
+	s := counter.NewLatencySeries(&config.CounterConfig{
+		SlotNum: 10,
+		Tags:    config.TagsConfig{Keys: []string{"route", "method"}},
+		Latency: config.LatencyConfig{Enabled: true, PerKey: true, PerTag: true, MaxSeries: 3},
+	})
+	assert.True(t, s.PerKey())
+	assert.Equal(t, []string{"method", "route"}, s.TagKeys())
+
+	s.Observe("checkout", map[string]string{"route": "/pay", "method": "POST"}, 10*time.Millisecond)
+	s.Observe("checkout", map[string]string{"route": "/pay", "method": "GET"}, 200*time.Millisecond)
+	s.Observe("", map[string]string{"status": "500"}, time.Millisecond) // 没有key和已声明的标签，不计入任何序列
+
+	stats, tracked := s.KeyStats("checkout")
+	assert.True(t, tracked)
+	assert.Equal(t, int64(2), stats.Count)
+	assert.InEpsilon(t, 200, stats.Max, 1.0/16)
+
+	stats, matched := s.TagStats(map[string]string{"route": "/pay"})
+	assert.Equal(t, 2, matched, "只指定route时合并所有method")
+	assert.Equal(t, int64(2), stats.Count)
+	assert.InEpsilon(t, 10, stats.P50, 1.0/16)
+
+	stats, matched = s.TagStats(map[string]string{"method": "GET"})
+	assert.Equal(t, 1, matched)
+	assert.InEpsilon(t, 200, stats.P50, 1.0/16)
+
+	t.Run("序列数达到上限后计入溢出", func(t *testing.T) {
+		assert.Equal(t, 3, s.SeriesCount())
+		s.Observe("search", nil, time.Millisecond)
+		s.Observe("checkout", nil, time.Millisecond)
+
+		_, tracked := s.KeyStats("search")
+		assert.False(t, tracked)
+		assert.Equal(t, int64(1), s.Overflow())
+		assert.Equal(t, 3, s.SeriesCount())
+		assert.Equal(t, 3, s.MaxSeries())
+	})
+}
@@ -0,0 +1,252 @@
+package unit_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/limiter"
+)
+
+func TestLimiterRules(t *testing.T) {
+	t.Run("按顺序匹配，第一个匹配的规则生效", func(t *testing.T) {
+		rl := limiter.NewRateLimiterWithClock(100, 100, false, newFakeClock())
+		require.NoError(t, rl.SetRules([]limiter.RuleSpec{
+			{Name: "blocked", Match: limiter.RuleMatch{Key: "blocked-*"}, Action: limiter.ActionDeny},
+			{Name: "partners", Match: limiter.RuleMatch{Key: "partner-*", Method: "post"}, Rate: 1},
+			{Name: "acme", Match: limiter.RuleMatch{Tenant: "acme"}, Action: limiter.ActionAllow},
+			{Name: "batch", Match: limiter.RuleMatch{Path: "/collect/batch", Headers: map[string]string{"X-Source": "edge"}}, Rate: 1},
+		}))
+
+		edge := func(name string) string {
+			if name == "X-Source" {
+				return "edge"
+			}
+			return ""
+		}
+		cases := []struct {
+			req  limiter.Request
+			rule string
+		}{
+			{limiter.Request{Method: "POST", Path: "/collect", Key: "blocked-1", Tenant: "acme"}, "blocked"},
+			{limiter.Request{Method: "POST", Path: "/collect", Key: "partner-1", Tenant: "acme"}, "partners"},
+			{limiter.Request{Method: "GET", Path: "/collect", Key: "partner-1", Tenant: "acme"}, "acme"},
+			{limiter.Request{Method: "POST", Path: "/collect/batch", Header: edge}, "batch"},
+			{limiter.Request{Method: "POST", Path: "/collect/batch"}, limiter.DefaultRule},
+			{limiter.Request{Method: "POST", Path: "/collect"}, limiter.DefaultRule},
+		}
+		for _, tc := range cases {
+			verdict, err := rl.CheckRequest(tc.req, 1)
+			require.NoError(t, err)
+			assert.Equal(t, tc.rule, verdict.Rule, "请求 %+v", tc.req)
+		}
+
+		statuses := rl.Rules()
+		require.Len(t, statuses, 4)
+		assert.Equal(t, "blocked", statuses[0].Name)
+		assert.Equal(t, int64(1), statuses[0].Matched)
+		assert.Equal(t, int64(1), statuses[0].Limited)
+		assert.Equal(t, "POST", statuses[1].Match.Method, "方法统一为大写")
+		assert.Equal(t, int64(1), statuses[1].Burst, "令牌桶的突发容量默认等于速率")
+		assert.Equal(t, 4, rl.Stats().Rules)
+	})
+
+	t.Run("各动作的判断结果", func(t *testing.T) {
+		rl := limiter.NewRateLimiterWithClock(100, 100, false, newFakeClock())
+		require.NoError(t, rl.SetRules([]limiter.RuleSpec{
+			{Name: "shadow", Match: limiter.RuleMatch{Key: "shadow"}, Rate: 1, Action: limiter.ActionShadow},
+			{Name: "reject", Match: limiter.RuleMatch{Key: "reject"}, Rate: 1},
+			{Name: "allow", Match: limiter.RuleMatch{Key: "allow"}, Rate: 1, Action: limiter.ActionAllow},
+			{Name: "deny", Match: limiter.RuleMatch{Key: "deny"}, Action: limiter.ActionDeny},
+		}))
+
+		check := func(key string) limiter.Verdict {
+			verdict, err := rl.CheckRequest(limiter.Request{Key: key}, 1)
+			require.NoError(t, err)
+			return verdict
+		}
+		assert.Equal(t, limiter.Verdict{Allowed: true, Rule: "shadow", Action: limiter.ActionShadow}, check("shadow"))
+		assert.Equal(t, limiter.Verdict{Allowed: true, Rule: "shadow", Action: limiter.ActionShadow, Limited: true}, check("shadow"))
+		assert.Equal(t, limiter.Verdict{Allowed: true, Rule: "reject", Action: limiter.ActionReject}, check("reject"))
+		assert.Equal(t, limiter.Verdict{Rule: "reject", Action: limiter.ActionReject, Limited: true}, check("reject"))
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, limiter.Verdict{Allowed: true, Rule: "allow", Action: limiter.ActionAllow}, check("allow"))
+		}
+		assert.Equal(t, limiter.Verdict{Rule: "deny", Action: limiter.ActionDeny, Limited: true}, check("deny"))
+
+		// shadow放行的请求不计入拒绝数
+		stats := rl.Stats()
+		assert.Equal(t, int64(8), stats.TotalCount)
+		assert.Equal(t, int64(2), stats.RejectedCount)
+		assert.Zero(t, rl.Rules()[2].Rate, "allow动作不使用速率")
+	})
+
+	t.Run("令牌桶和固定窗口", func(t *testing.T) {
+		clock := newFakeClock()
+		clock.now = time.Date(2024, 6, 7, 12, 0, 0, 0, time.Local)
+		rl := limiter.NewRateLimiterWithClock(100, 100, false, clock)
+		require.NoError(t, rl.SetRules([]limiter.RuleSpec{
+			{Name: "bucket", Match: limiter.RuleMatch{Path: "/bucket"}, Rate: 10, Burst: 5},
+			{Name: "window", Match: limiter.RuleMatch{Path: "/window"}, Algorithm: limiter.AlgorithmFixedWindow, Rate: 5},
+		}))
+
+		allowed := func(path string, n int) int {
+			count := 0
+			for i := 0; i < n; i++ {
+				verdict, err := rl.CheckRequest(limiter.Request{Path: path}, 1)
+				require.NoError(t, err)
+				if verdict.Allowed {
+					count++
+				}
+			}
+			return count
+		}
+		assert.Equal(t, 5, allowed("/bucket", 10))
+		assert.Equal(t, 5, allowed("/window", 10))
+
+		// 半秒后令牌桶补充5个令牌，固定窗口仍在同一秒内
+		clock.Advance(500 * time.Millisecond)
+		assert.Equal(t, 5, allowed("/bucket", 10))
+		assert.Equal(t, 0, allowed("/window", 10))
+
+		// 进入下一个窗口后重新计数
+		clock.Advance(500 * time.Millisecond)
+		assert.Equal(t, 5, allowed("/window", 10))
+	})
+
+	t.Run("更新规则时保留限额状态", func(t *testing.T) {
+		clock := newFakeClock()
+		clock.now = time.Date(2024, 6, 7, 12, 0, 0, 0, time.Local)
+		rl := limiter.NewRateLimiterWithClock(100, 100, false, clock)
+		specs := []limiter.RuleSpec{
+			{Name: "same", Match: limiter.RuleMatch{Path: "/same"}, Rate: 10, Burst: 5},
+			{Name: "resized", Match: limiter.RuleMatch{Path: "/resized"}, Rate: 10, Burst: 5},
+			{Name: "window", Match: limiter.RuleMatch{Path: "/window"}, Algorithm: limiter.AlgorithmFixedWindow, Rate: 5},
+			{Name: "switched", Match: limiter.RuleMatch{Path: "/switched"}, Rate: 10, Burst: 10},
+		}
+		require.NoError(t, rl.SetRules(specs))
+
+		allowed := func(path string, n int) int {
+			count := 0
+			for i := 0; i < n; i++ {
+				verdict, err := rl.CheckRequest(limiter.Request{Path: path}, 1)
+				require.NoError(t, err)
+				if verdict.Allowed {
+					count++
+				}
+			}
+			return count
+		}
+		assert.Equal(t, 5, allowed("/same", 10))
+		assert.Equal(t, 5, allowed("/resized", 10))
+		assert.Equal(t, 4, allowed("/window", 4))
+		assert.Equal(t, 4, allowed("/switched", 4))
+
+		// 只修改匹配条件的规则继续使用原来的令牌桶，速率变化的规则不会重新填满
+		specs[0].Match.Path = "/sam"
+		specs[1].Burst = 50
+		specs[2].Rate = 6
+		specs[3].Algorithm = limiter.AlgorithmFixedWindow
+		specs = append(specs, limiter.RuleSpec{Name: "added", Match: limiter.RuleMatch{Path: "/added"}, Rate: 3})
+		require.NoError(t, rl.SetRules(specs))
+
+		assert.Equal(t, 0, allowed("/same", 10))
+		assert.Equal(t, 0, allowed("/resized", 10))
+		assert.Equal(t, 2, allowed("/window", 10), "同一窗口内已放行的令牌数保留")
+		assert.Equal(t, 6, allowed("/switched", 10), "当前窗口只放行令牌桶剩余的令牌")
+		assert.Equal(t, 3, allowed("/added", 10), "新增的规则从满额开始")
+
+		statuses := rl.Rules()
+		assert.Equal(t, int64(20), statuses[0].Matched, "命中次数保留")
+		assert.Equal(t, int64(15), statuses[0].Limited)
+
+		// 按新的突发容量补充
+		clock.Advance(time.Second)
+		assert.Equal(t, 5, allowed("/same", 10))
+		assert.Equal(t, 10, allowed("/resized", 20))
+	})
+
+	t.Run("无效的规则不修改现有规则", func(t *testing.T) {
+		rl := limiter.NewRateLimiter(100, 100, false)
+		require.NoError(t, rl.SetRules([]limiter.RuleSpec{{Name: "keep", Rate: 1}}))
+
+		invalid := [][]limiter.RuleSpec{
+			{{Rate: 1}},
+			{{Name: limiter.DefaultRule, Rate: 1}},
+			{{Name: "a", Rate: 1}, {Name: "a", Rate: 1}},
+			{{Name: "a"}},
+			{{Name: "a", Rate: 1, Algorithm: "leaky_bucket"}},
+			{{Name: "a", Rate: 1, Action: "throttle"}},
+			{{Name: "a", Rate: 1, Match: limiter.RuleMatch{Path: "collect"}}},
+			{{Name: "a", Rate: 1, Match: limiter.RuleMatch{Key: "[partner"}}},
+		}
+		for _, specs := range invalid {
+			assert.Error(t, rl.SetRules(specs), "规则 %+v", specs)
+		}
+		statuses := rl.Rules()
+		require.Len(t, statuses, 1)
+		assert.Equal(t, "keep", statuses[0].Name)
+
+		require.NoError(t, rl.SetRules(nil))
+		assert.Empty(t, rl.Rules())
+	})
+
+	t.Run("与规则无关的配置修改不覆盖管理接口设置的规则", func(t *testing.T) {
+		fileRules := []config.LimiterRuleConfig{{Name: "file", Match: config.LimiterRuleMatchConfig{Path: "/collect"}, Rate: 10}}
+		rl := limiter.NewRateLimiter(100, 100, false)
+		require.NoError(t, rl.SetRules(limiter.RuleSpecsFromConfig(fileRules)))
+		reload := limiter.RulesReloader(rl, fileRules)
+
+		// 通过 PUT /admin/limiter/rules 替换规则
+		require.NoError(t, rl.SetRules([]limiter.RuleSpec{{Name: "admin", Rate: 1}}))
+
+		// 修改logger.level等配置触发重新加载，配置文件中的规则未变化
+		reload([]config.LimiterRuleConfig{{Name: "file", Match: config.LimiterRuleMatchConfig{Path: "/collect"}, Rate: 10}})
+		statuses := rl.Rules()
+		require.Len(t, statuses, 1)
+		assert.Equal(t, "admin", statuses[0].Name)
+
+		// 配置文件中的规则被修改后才替换
+		reload([]config.LimiterRuleConfig{{Name: "file", Match: config.LimiterRuleMatchConfig{Path: "/collect"}, Rate: 20}})
+		statuses = rl.Rules()
+		require.Len(t, statuses, 1)
+		assert.Equal(t, "file", statuses[0].Name)
+		assert.Equal(t, int64(20), statuses[0].Rate)
+
+		// 无效的规则不修改现有规则，修正后再次加载时重新应用
+		reload([]config.LimiterRuleConfig{{Rate: 1}})
+		assert.Equal(t, "file", rl.Rules()[0].Name)
+		require.NoError(t, rl.SetRules(nil))
+		reload([]config.LimiterRuleConfig{{Name: "file", Match: config.LimiterRuleMatchConfig{Path: "/collect"}, Rate: 20}})
+		assert.Empty(t, rl.Rules(), "与上一次成功应用的规则相同，不覆盖")
+	})
+
+	t.Run("从请求头识别API Key和租户", func(t *testing.T) {
+		headers := map[string]string{"X-API-Key": "key-1", "X-Tenant-ID": "acme", "X-Org": "org-1"}
+		header := func(name string) string { return headers[name] }
+
+		rl := limiter.NewRateLimiter(100, 100, false)
+		req := rl.Identify("POST", "/collect", header)
+		assert.Equal(t, "key-1", req.Key)
+		assert.Equal(t, "acme", req.Tenant)
+		assert.Equal(t, "POST", req.Method)
+		assert.Equal(t, "/collect", req.Path)
+
+		rl.SetIdentityHeaders("", "X-Org")
+		req = rl.Identify("POST", "/collect", header)
+		assert.Equal(t, "key-1", req.Key, "为空的参数保持不变")
+		assert.Equal(t, "org-1", req.Tenant)
+	})
+
+	t.Run("未启用时全部放行", func(t *testing.T) {
+		rl := limiter.NewRateLimiter(1, 1, false)
+		require.NoError(t, rl.SetRules([]limiter.RuleSpec{{Name: "deny", Action: limiter.ActionDeny}}))
+		rl.SetEnabled(false)
+		verdict, err := rl.CheckRequest(limiter.Request{}, 1)
+		require.NoError(t, err)
+		assert.True(t, verdict.Allowed)
+	})
+}
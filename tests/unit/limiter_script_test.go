@@ -0,0 +1,122 @@
+package unit_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/limiter"
+)
+
+const limiterTestScript = `
+def decide(req):
+    if req.key == "vip":
+        return "allow"
+    if req.tenant == "abuser":
+        return "deny"
+    if req.path == "/collect/batch":
+        return {"cost": req.cost * 10}
+    if req.qps > 1000 and req.rule == "default":
+        return 5
+    if req.key == "broken":
+        return "maybe"
+    if req.key == "slow":
+        for i in range(1000000):
+            pass
+    return None
+`
+
+func TestLimiterScript(t *testing.T) {
+	qps := int64(0)
+	script, err := limiter.NewScript(config.LimiterScriptConfig{Source: limiterTestScript, Timeout: time.Second, MaxSteps: 10000}, func() int64 { return qps })
+	require.NoError(t, err)
+
+	rl := limiter.NewRateLimiterWithClock(100, 100, false, newFakeClock())
+	rl.SetScript(script)
+	tokens := func() int64 { return rl.Stats().CurrentTokens }
+
+	t.Run("直接放行或拒绝，不消耗令牌", func(t *testing.T) {
+		rl.SetTokensForTest(0)
+		verdict, err := rl.CheckRequest(limiter.Request{Path: "/collect", Key: "vip"}, 1)
+		require.NoError(t, err)
+		assert.Equal(t, limiter.Verdict{Allowed: true, Rule: limiter.ScriptRule, Action: limiter.ActionAllow}, verdict)
+
+		rl.SetTokensForTest(100)
+		verdict, err = rl.CheckRequest(limiter.Request{Path: "/collect", Tenant: "abuser"}, 1)
+		require.NoError(t, err)
+		assert.Equal(t, limiter.Verdict{Rule: limiter.ScriptRule, Action: limiter.ActionDeny, Limited: true}, verdict)
+		assert.Equal(t, int64(100), tokens())
+	})
+
+	t.Run("替换令牌消耗后按规则判断", func(t *testing.T) {
+		rl.SetTokensForTest(100)
+		verdict, err := rl.CheckRequest(limiter.Request{Path: "/collect/batch"}, 3)
+		require.NoError(t, err)
+		assert.True(t, verdict.Allowed)
+		assert.Equal(t, limiter.DefaultRule, verdict.Rule)
+		assert.Equal(t, int64(70), tokens())
+
+		qps = 5000
+		_, err = rl.CheckRequest(limiter.Request{Path: "/collect"}, 1)
+		require.NoError(t, err)
+		assert.Equal(t, int64(65), tokens(), "脚本可以读取当前QPS")
+		qps = 0
+
+		_, err = rl.CheckRequest(limiter.Request{Path: "/collect"}, 1)
+		require.NoError(t, err)
+		assert.Equal(t, int64(64), tokens(), "返回None时不干预")
+	})
+
+	t.Run("出错或超出步数时按规则判断", func(t *testing.T) {
+		rl.SetTokensForTest(100)
+		for _, key := range []string{"broken", "slow"} {
+			verdict, err := rl.CheckRequest(limiter.Request{Path: "/collect", Key: key}, 1)
+			require.NoError(t, err)
+			assert.Equal(t, limiter.DefaultRule, verdict.Rule, key)
+		}
+		assert.Equal(t, int64(98), tokens())
+
+		stats := rl.Stats().Script
+		require.NotNil(t, stats)
+		assert.Equal(t, int64(2), stats.Failures)
+		assert.Equal(t, int64(4), stats.Overrides)
+		assert.Equal(t, int64(7), stats.Evaluations)
+	})
+
+	t.Run("执行超时", func(t *testing.T) {
+		slow, err := limiter.NewScript(config.LimiterScriptConfig{
+			Source:   "def decide(req):\n    for i in range(100000000):\n        pass\n    return 'deny'\n",
+			Timeout:  10 * time.Millisecond,
+			MaxSteps: 1 << 40,
+		}, nil)
+		require.NoError(t, err)
+		rl := limiter.NewRateLimiterWithClock(100, 100, false, newFakeClock())
+		rl.SetScript(slow)
+
+		start := time.Now()
+		verdict, err := rl.CheckRequest(limiter.Request{Path: "/collect"}, 1)
+		require.NoError(t, err)
+		assert.True(t, verdict.Allowed)
+		assert.Less(t, time.Since(start), time.Second)
+	})
+
+	t.Run("无效的脚本", func(t *testing.T) {
+		_, err := limiter.NewScript(config.LimiterScriptConfig{Source: "def decide(req):\n  return ("}, nil)
+		assert.Error(t, err)
+		_, err = limiter.NewScript(config.LimiterScriptConfig{Source: "x = 1"}, nil)
+		assert.ErrorContains(t, err, "decide")
+		_, err = limiter.NewScript(config.LimiterScriptConfig{Source: "load('os.star', 'os')\ndef decide(req):\n  return None"}, nil)
+		assert.Error(t, err, "脚本不能load其他模块")
+
+		path := filepath.Join(t.TempDir(), "limiter.star")
+		require.NoError(t, os.WriteFile(path, []byte("def decide(req):\n  return 'allow'\n"), 0o644))
+		fromFile, err := limiter.NewScript(config.LimiterScriptConfig{File: path}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, path, fromFile.Stats().Name)
+	})
+}
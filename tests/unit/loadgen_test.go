@@ -0,0 +1,91 @@
+package unit_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/counter"
+	"github.com/mant7s/qps-counter/internal/ingest"
+	"github.com/mant7s/qps-counter/internal/loadgen"
+)
+
+func TestLoadGenerator(t *testing.T) {
+	t.Run("按速率生成到结束", func(t *testing.T) {
+		c := &mockCounter{}
+		keyed := counter.NewKeyedCounter(&config.CounterConfig{
+			WindowSize: time.Second,
+			SlotNum:    10,
+			Precision:  100 * time.Millisecond,
+			Keys:       config.KeysConfig{Enabled: true},
+		})
+		g := loadgen.NewGenerator(config.LoadGenConfig{}, c, keyed, nil)
+		defer g.Stop()
+
+		status, err := g.Start(loadgen.Request{Rate: 1000, Duration: 200 * time.Millisecond, Key: "demo"})
+		require.NoError(t, err)
+		assert.True(t, status.Running)
+		assert.Equal(t, "200ms", status.Duration)
+
+		// 同一时间只运行一次压测
+		_, err = g.Start(loadgen.Request{Rate: 10})
+		assert.ErrorIs(t, err, loadgen.ErrRunning)
+
+		require.Eventually(t, func() bool { return !g.Status().Running }, 2*time.Second, 10*time.Millisecond)
+		status = g.Status()
+		assert.Equal(t, int64(200), status.Generated, "结束时补齐到rate*duration")
+		assert.Equal(t, int64(200), c.CurrentQPS())
+		assert.NotNil(t, status.EndedAt)
+		assert.Equal(t, 1, keyed.KeyCount())
+
+		// 上一次结束后可以开始新的压测
+		_, err = g.Start(loadgen.Request{Rate: 10})
+		assert.NoError(t, err)
+	})
+
+	t.Run("停止和采集暂停", func(t *testing.T) {
+		c := &mockCounter{}
+		sw := ingest.NewSwitch(ingest.PauseDrop)
+		sw.Pause()
+		g := loadgen.NewGenerator(config.LoadGenConfig{}, c, nil, sw)
+		defer g.Stop()
+
+		_, err := g.Start(loadgen.Request{Rate: 1000, Duration: time.Minute})
+		require.NoError(t, err)
+		require.Eventually(t, func() bool { return g.Status().Dropped > 0 }, time.Second, 10*time.Millisecond)
+
+		status := g.Cancel()
+		assert.False(t, status.Running)
+		assert.Zero(t, status.Generated, "暂停期间生成的计数直接丢弃")
+		assert.Zero(t, c.CurrentQPS())
+	})
+
+	t.Run("参数检查", func(t *testing.T) {
+		g := loadgen.NewGenerator(config.LoadGenConfig{MaxRate: 100, MaxDuration: time.Minute}, &mockCounter{}, nil, nil)
+		defer g.Stop()
+
+		for _, req := range []loadgen.Request{
+			{Rate: 0},
+			{Rate: 101},
+			{Rate: 10, Duration: 2 * time.Minute},
+			{Rate: 10, Key: "demo"}, // 未启用按key计数
+		} {
+			_, err := g.Start(req)
+			assert.True(t, errors.Is(err, loadgen.ErrInvalidRequest), "%+v: %v", req, err)
+		}
+		assert.False(t, g.Status().Running)
+		assert.Nil(t, g.Status().StartedAt)
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		var req loadgen.Request
+		require.NoError(t, json.Unmarshal([]byte(`{"rate":500,"duration":"30s","key":"demo"}`), &req))
+		assert.Equal(t, loadgen.Request{Rate: 500, Duration: 30 * time.Second, Key: "demo"}, req)
+		assert.Error(t, json.Unmarshal([]byte(`{"rate":500,"duration":"30"}`), &req))
+	})
+}
@@ -0,0 +1,57 @@
+package unit_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/counter"
+	"github.com/mant7s/qps-counter/internal/metrics"
+)
+
+func TestMetricsConstLabels(t *testing.T) {
+	t.Setenv("POD_NAME", "qps-counter-0")
+	t.Setenv("ZONE", "zone-a")
+
+	labels := metrics.ResolveLabels(map[string]string{
+		"zone":     "${ZONE}",
+		"cluster":  "prod",
+		"instance": "",
+		"missing":  "${QPS_TEST_UNSET_ENV}",
+	})
+	assert.Equal(t, "qps-counter-0", labels["pod"])
+	assert.Equal(t, "zone-a", labels["zone"])
+	assert.Equal(t, "prod", labels["cluster"])
+	assert.NotContains(t, labels, "instance", "显式配置为空的标签应被去除")
+	assert.NotContains(t, labels, "missing", "展开后为空的标签应被忽略")
+
+	c := counter.NewCounter(&config.CounterConfig{
+		Type:       counter.LockFreeType,
+		WindowSize: time.Second,
+		SlotNum:    10,
+		Precision:  100 * time.Millisecond,
+	})
+	defer c.Stop()
+
+	m := metrics.NewMetricsWithLabels(c, labels)
+	m.RecordRequest()()
+
+	families, err := m.Registry().Gather()
+	require.NoError(t, err)
+	require.NotEmpty(t, families)
+
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			got := map[string]string{}
+			for _, pair := range metric.GetLabel() {
+				got[pair.GetName()] = pair.GetValue()
+			}
+			assert.Equal(t, "qps-counter-0", got["pod"], family.GetName())
+			assert.Equal(t, "zone-a", got["zone"], family.GetName())
+			assert.Equal(t, "prod", got["cluster"], family.GetName())
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package unit_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/outbound"
+)
+
+func TestOutboundClient(t *testing.T) {
+	t.Run("5xx后重试并重放请求体", func(t *testing.T) {
+		var calls atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			assert.Equal(t, "payload", string(body))
+			if calls.Add(1) < 3 {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		client := outbound.NewClient(config.OutboundConfig{BaseBackoff: time.Millisecond})
+		req, _ := http.NewRequest("POST", server.URL, strings.NewReader("payload"))
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, int32(3), calls.Load())
+
+		stats := client.Stats()
+		require.Len(t, stats, 1)
+		assert.Equal(t, int64(1), stats[0].Successes)
+		assert.Equal(t, int64(2), stats[0].Retries)
+		assert.Equal(t, outbound.StateClosed, stats[0].State)
+	})
+
+	t.Run("重试次数耗尽后返回最后一次响应，4xx不重试", func(t *testing.T) {
+		var calls atomic.Int32
+		status := atomic.Int32{}
+		status.Store(http.StatusServiceUnavailable)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			w.WriteHeader(int(status.Load()))
+		}))
+		defer server.Close()
+
+		client := outbound.NewClient(config.OutboundConfig{MaxRetries: 1, BaseBackoff: time.Millisecond})
+		req, _ := http.NewRequest("GET", server.URL, nil)
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+		assert.Equal(t, int32(2), calls.Load())
+
+		status.Store(http.StatusNotFound)
+		resp, err = client.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, int32(3), calls.Load())
+	})
+
+	t.Run("连续失败后熔断，超时后放行探测请求", func(t *testing.T) {
+		var healthy atomic.Bool
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !healthy.Load() {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		}))
+		defer server.Close()
+
+		client := outbound.NewClient(config.OutboundConfig{MaxRetries: -1, FailureThreshold: 2, OpenTimeout: 50 * time.Millisecond})
+		do := func() error {
+			req, _ := http.NewRequest("GET", server.URL, nil)
+			resp, err := client.Do(req)
+			if err == nil {
+				resp.Body.Close()
+			}
+			return err
+		}
+
+		require.NoError(t, do())
+		require.NoError(t, do())
+		assert.True(t, errors.Is(do(), outbound.ErrCircuitOpen), "连续失败达到阈值后应熔断")
+		assert.Equal(t, outbound.StateOpen, client.Stats()[0].State)
+
+		healthy.Store(true)
+		time.Sleep(60 * time.Millisecond)
+		require.NoError(t, do())
+		stats := client.Stats()[0]
+		assert.Equal(t, outbound.StateClosed, stats.State)
+		assert.Equal(t, int64(1), stats.Rejected)
+		assert.Equal(t, int64(2), stats.Failures)
+	})
+
+	t.Run("重试预算耗尽后不再重试", func(t *testing.T) {
+		var calls atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			w.WriteHeader(http.StatusTooManyRequests)
+		}))
+		defer server.Close()
+
+		// 预算初始为10次重试，每个请求最多重试5次，熔断阈值足够大
+		client := outbound.NewClient(config.OutboundConfig{MaxRetries: 5, BaseBackoff: time.Millisecond, MaxBackoff: time.Millisecond, FailureThreshold: 1000, RetryBudget: 0.01})
+		for i := 0; i < 4; i++ {
+			req, _ := http.NewRequest("GET", server.URL, nil)
+			resp, err := client.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+		}
+		assert.Equal(t, int64(10), client.Stats()[0].Retries)
+		assert.Equal(t, int32(14), calls.Load())
+	})
+
+	t.Run("连接池统计", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "ok")
+		}))
+		defer server.Close()
+
+		// 通过localhost访问，新建连接时需要DNS解析
+		url := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+		client := outbound.NewClient(config.OutboundConfig{})
+		for i := 0; i < 3; i++ {
+			req, _ := http.NewRequest("GET", url, nil)
+			resp, err := client.Do(req)
+			require.NoError(t, err)
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			// 等待连接放回连接池后再发送下一个请求
+			require.Eventually(t, func() bool { return client.Stats()[0].IdleConns == 1 }, time.Second, time.Millisecond)
+		}
+
+		stats := client.Stats()[0]
+		assert.Equal(t, int64(0), stats.InFlight)
+		assert.Equal(t, int64(1), stats.OpenConns)
+		assert.Equal(t, int64(1), stats.NewConns)
+		assert.Equal(t, int64(2), stats.ReusedConns)
+		assert.Equal(t, int64(1), stats.DNSLookups)
+		assert.Zero(t, stats.TLSHandshakes)
+
+		// 服务端关闭连接后，空闲连接从连接池中移除
+		server.CloseClientConnections()
+		require.Eventually(t, func() bool {
+			stats := client.Stats()[0]
+			return stats.OpenConns == 0 && stats.IdleConns == 0
+		}, time.Second, time.Millisecond)
+	})
+}
@@ -0,0 +1,40 @@
+package unit_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mant7s/qps-counter/internal/pressure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPressureReadDir(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+	// 较早内核的cpu.pressure只有some一行
+	write("cpu.pressure", "some avg10=35.50 avg60=12.00 avg300=3.10 total=1234\n")
+	write("memory.pressure", "some avg10=4.00 avg60=2.50 avg300=1.00 total=99\nfull avg10=1.25 avg60=0.50 avg300=0.10 total=10\n")
+	write("io.pressure", "some avg10=0.00 avg60=0.00 avg300=0.00 total=0\nfull avg10=0.00 avg60=0.00 avg300=0.00 total=0\n")
+
+	snapshot, err := pressure.ReadDir(dir)
+	require.NoError(t, err)
+	assert.True(t, snapshot.Available)
+	assert.Equal(t, pressure.Resource{SomeAvg10: 35.5, SomeAvg60: 12}, snapshot.CPU)
+	assert.Equal(t, pressure.Resource{SomeAvg10: 4, SomeAvg60: 2.5, FullAvg10: 1.25, FullAvg60: 0.5}, snapshot.Memory)
+	assert.Equal(t, []string{"cpu"}, snapshot.Stalled(pressure.DefaultThreshold))
+	assert.Equal(t, []string{"cpu", "memory"}, snapshot.Stalled(3))
+
+	// 不可用的压力数据不会判定为紧张
+	assert.Nil(t, pressure.Snapshot{}.Stalled(0))
+
+	write("io.pressure", "some avg10=abc\n")
+	_, err = pressure.ReadDir(dir)
+	assert.Error(t, err)
+
+	_, err = pressure.ReadDir(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,129 @@
+package unit_test
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/quick"
+	"time"
+
+	"github.com/mant7s/qps-counter/internal/limiter"
+)
+
+// limiterScenario 随机生成的限流场景：速率、突发容量和每一步时钟前进的时间
+type limiterScenario struct {
+	Rate    int64
+	Burst   int64
+	Steps   []time.Duration
+	MaxCost int64 // 每个请求随机消耗1到MaxCost个令牌
+	Workers int   // 每一步并发请求的协程数
+}
+
+// Generate 实现quick.Generator接口
+// 每一步前进的时间不超过补充burst-1个令牌所需的时间，加上上一步留下的不足一个令牌的部分也不会填满令牌桶，
+// 桶在每一步都被耗尽，因此不会因为溢出而损失令牌
+func (limiterScenario) Generate(r *rand.Rand, size int) reflect.Value {
+	s := limiterScenario{
+		Rate:    1 + r.Int63n(5000),
+		MaxCost: 1 + r.Int63n(3),
+		Workers: 1 + r.Intn(8),
+	}
+	s.Burst = s.MaxCost + 1 + r.Int63n(2*s.Rate+1)
+	fill := time.Duration((s.Burst - 1) * int64(time.Second) / s.Rate)
+	s.Steps = make([]time.Duration, 20+r.Intn(80))
+	for i := range s.Steps {
+		// 一部分步长很短，只补充不足一个令牌，用于检查小数部分不会丢失
+		if r.Intn(3) == 0 {
+			s.Steps[i] = time.Duration(r.Int63n(int64(time.Second)/s.Rate + 1))
+		} else {
+			s.Steps[i] = time.Duration(r.Int63n(int64(fill) + 1))
+		}
+	}
+	// 第一步不前进时钟，先耗尽初始的突发容量
+	s.Steps[0] = 0
+	return reflect.ValueOf(s)
+}
+
+func (s limiterScenario) String() string {
+	return fmt.Sprintf("rate=%d burst=%d max_cost=%d workers=%d steps=%d", s.Rate, s.Burst, s.MaxCost, s.Workers, len(s.Steps))
+}
+
+// run 按场景执行：每一步先前进时钟，再由多个协程并发请求直到被拒绝，返回每一步结束时的时间和累计放行的令牌数
+func (s limiterScenario) run(seed int64) ([]time.Duration, []int64) {
+	clock := newFakeClock()
+	rl := limiter.NewRateLimiterWithClock(s.Rate, s.Burst, false, clock)
+
+	times := make([]time.Duration, len(s.Steps)+1)
+	admitted := make([]int64, len(s.Steps)+1)
+	var elapsed time.Duration
+	var total atomic.Int64
+	for i, step := range s.Steps {
+		clock.Advance(step)
+		elapsed += step
+
+		var wg sync.WaitGroup
+		for w := 0; w < s.Workers; w++ {
+			wg.Add(1)
+			go func(r *rand.Rand) {
+				defer wg.Done()
+				for {
+					cost := 1 + r.Int63n(s.MaxCost)
+					if !rl.AllowN(cost) {
+						// 时钟在这一步内不变，消耗1个令牌也失败时桶已耗尽
+						if cost == 1 || !rl.AllowN(1) {
+							return
+						}
+						cost = 1
+					}
+					total.Add(cost)
+				}
+			}(rand.New(rand.NewSource(seed + int64(i*s.Workers+w))))
+		}
+		wg.Wait()
+
+		times[i+1] = elapsed
+		admitted[i+1] = total.Load()
+	}
+	return times, admitted
+}
+
+// TestRateLimiterProperties 随机场景下令牌桶的两个性质：
+// 任意时间段内放行的令牌数不超过突发容量加速率乘以时长；持续有请求时放行的令牌数不低于同样的上限减去一个令牌
+func TestRateLimiterProperties(t *testing.T) {
+	if testing.Short() {
+		t.Skip("跳过随机场景测试")
+	}
+
+	property := func(s limiterScenario) bool {
+		times, admitted := s.run(s.Rate * s.Burst)
+
+		for i := range times {
+			for j := i + 1; j < len(times); j++ {
+				// 第i步结束时桶已耗尽，(i, j]内最多补充rate*(t_j-t_i)个令牌，i为0时再加上初始的突发容量
+				limit := int64(float64(s.Rate) * (times[j] - times[i]).Seconds())
+				if i == 0 {
+					limit += s.Burst
+				}
+				if got := admitted[j] - admitted[i]; got > limit+1 {
+					t.Logf("%v: (%v, %v] 放行%d个令牌，超过上限%d", s, times[i], times[j], got, limit)
+					return false
+				}
+			}
+		}
+
+		last := len(times) - 1
+		floor := s.Burst + int64(float64(s.Rate)*times[last].Seconds()) - 1
+		if admitted[last] < floor {
+			t.Logf("%v: %v内只放行%d个令牌，低于%d", s, times[last], admitted[last], floor)
+			return false
+		}
+		return true
+	}
+
+	if err := quick.Check(property, &quick.Config{MaxCount: 200}); err != nil {
+		t.Fatal(err)
+	}
+}
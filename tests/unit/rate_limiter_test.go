@@ -1,7 +1,9 @@
 package unit_test
 
 import (
+	"fmt"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -9,6 +11,7 @@ import (
 	"github.com/mant7s/qps-counter/internal/limiter"
 	"github.com/mant7s/qps-counter/internal/logger"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func init() {
@@ -75,6 +78,21 @@ func TestRateLimiter(t *testing.T) {
 		assert.False(t, rl.Allow(), "重新启用限流后应恢复限流功能")
 	})
 
+	t.Run("禁用时不计入统计", func(t *testing.T) {
+		rl := limiter.NewRateLimiter(1, 1, false)
+		rl.SetEnabled(false)
+
+		for i := 0; i < 10; i++ {
+			assert.True(t, rl.AllowN(1))
+		}
+		verdict, err := rl.CheckRequest(limiter.Request{Method: "POST", Path: "/collect"}, 1)
+		assert.NoError(t, err)
+		assert.True(t, verdict.Allowed)
+
+		_, total := rl.Counts()
+		assert.Zero(t, total, "禁用的限流器不加锁，也不计入请求总数")
+	})
+
 	t.Run("动态调整速率测试", func(t *testing.T) {
 		// 创建限流器，初始速率较低
 		initialRate := int64(5)
@@ -173,7 +191,7 @@ func TestRateLimiter(t *testing.T) {
 		}
 
 		// 消耗剩余令牌
-		for i := 0; i < int(burstSize) - allowedCount; i++ {
+		for i := 0; i < int(burstSize)-allowedCount; i++ {
 			rl.Allow()
 		}
 
@@ -184,13 +202,383 @@ func TestRateLimiter(t *testing.T) {
 		}
 
 		// 获取统计信息
-		stats := rl.GetStats()
+		stats := rl.Stats()
 
 		// 验证统计信息
-		assert.Equal(t, rate, stats["rate"], "速率应匹配")
-		assert.Equal(t, burstSize, stats["burst_size"], "突发容量应匹配")
-		assert.True(t, stats["enabled"].(bool), "限流器应该是启用状态")
-		assert.Equal(t, int64(rejectedCount), stats["rejected_count"], "拒绝计数应匹配")
-		assert.Equal(t, int64(burstSize) + int64(rejectedCount), stats["total_count"], "总请求数应匹配")
+		assert.Equal(t, rate, stats.Rate, "速率应匹配")
+		assert.Equal(t, burstSize, stats.BurstSize, "突发容量应匹配")
+		assert.True(t, stats.Enabled, "限流器应该是启用状态")
+		assert.Equal(t, int64(rejectedCount), stats.RejectedCount, "拒绝计数应匹配")
+		assert.Equal(t, int64(burstSize)+int64(rejectedCount), stats.TotalCount, "总请求数应匹配")
+	})
+}
+
+// fakeClock 可手动控制的时钟，用于模拟NTP步进等墙上时钟跳变
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	// Round(0) 去除单调时钟读数，模拟纯墙上时钟
+	return &fakeClock{now: time.Now().Round(0)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestRateLimiterClockJumps(t *testing.T) {
+	t.Run("时钟回拨后令牌继续补充", func(t *testing.T) {
+		clock := newFakeClock()
+		rl := limiter.NewRateLimiterWithClock(10, 5, false, clock)
+
+		for i := 0; i < 5; i++ {
+			assert.True(t, rl.Allow())
+		}
+		assert.False(t, rl.Allow())
+
+		// 墙上时钟回拨1小时
+		clock.Advance(-time.Hour)
+		assert.False(t, rl.Allow(), "回拨本身不应补充令牌")
+
+		// 回拨后经过1秒，应按速率补充令牌而不是等待时钟追上
+		clock.Advance(time.Second)
+		for i := 0; i < 5; i++ {
+			assert.True(t, rl.Allow(), "回拨后第%d个请求应该通过", i+1)
+		}
+		assert.False(t, rl.Allow())
+	})
+
+	t.Run("时钟前跳补充的令牌不超过突发容量", func(t *testing.T) {
+		clock := newFakeClock()
+		rl := limiter.NewRateLimiterWithClock(10, 5, false, clock)
+
+		for i := 0; i < 5; i++ {
+			assert.True(t, rl.Allow())
+		}
+
+		// 墙上时钟前跳1天
+		clock.Advance(24 * time.Hour)
+		allowed := 0
+		for i := 0; i < 100; i++ {
+			if rl.Allow() {
+				allowed++
+			}
+		}
+		assert.Equal(t, 5, allowed, "前跳后最多只能放行突发容量的请求")
+	})
+
+	t.Run("正常流逝按速率补充令牌", func(t *testing.T) {
+		clock := newFakeClock()
+		rl := limiter.NewRateLimiterWithClock(10, 10, false, clock)
+
+		for i := 0; i < 10; i++ {
+			assert.True(t, rl.Allow())
+		}
+		assert.False(t, rl.Allow())
+
+		clock.Advance(500 * time.Millisecond)
+		allowed := 0
+		for i := 0; i < 10; i++ {
+			if rl.Allow() {
+				allowed++
+			}
+		}
+		assert.Equal(t, 5, allowed)
+	})
+
+	t.Run("调整速率前的时间按原速率补充", func(t *testing.T) {
+		clock := newFakeClock()
+		rl := limiter.NewRateLimiterWithClock(10, 100, false, clock)
+		rl.SetTokensForTest(0)
+
+		clock.Advance(500 * time.Millisecond)
+		rl.SetRate(100)
+		assert.Equal(t, int64(5), rl.Stats().CurrentTokens)
+	})
+}
+
+func TestRateLimiterAllowN(t *testing.T) {
+	clock := newFakeClock()
+	// 每秒1MB，突发4KB
+	rl := limiter.NewRateLimiterWithClock(1<<20, 4096, false, clock)
+	rl.SetUnit(limiter.UnitBytes)
+	assert.Equal(t, limiter.UnitBytes, rl.Unit())
+
+	assert.True(t, rl.AllowN(3000))
+	assert.False(t, rl.AllowN(2000), "剩余令牌不足时应拒绝")
+	assert.True(t, rl.AllowN(1096))
+	assert.False(t, rl.AllowN(8192), "超过突发容量的请求永远无法通过")
+
+	// 经过1ms补充约1048字节
+	clock.Advance(time.Millisecond)
+	assert.True(t, rl.AllowN(1000))
+	assert.False(t, rl.AllowN(100))
+
+	stats := rl.Stats()
+	assert.Equal(t, limiter.UnitBytes, stats.Unit)
+	assert.Equal(t, int64(3), stats.RejectedCount)
+
+	// 不支持的单位按requests处理
+	rl.SetUnit("packets")
+	assert.Equal(t, limiter.UnitRequests, rl.Unit())
+}
+
+func TestLimiterScheduler(t *testing.T) {
+	clock := newFakeClock()
+	// 2024-06-07 是周五
+	clock.now = time.Date(2024, 6, 7, 12, 0, 0, 0, time.Local)
+	rl := limiter.NewRateLimiterWithClock(100, 10, false, clock)
+
+	scheduler, err := limiter.NewScheduler(rl, 100, 10, []config.LimiterScheduleConfig{
+		{Name: "off_peak", Days: []string{"mon", "tue", "wed", "thu", "fri"}, Start: "22:00", End: "06:00", Rate: 1000, Burst: 200},
+		{Name: "weekend", Days: []string{"sat", "sun"}, Start: "00:00", End: "00:00", Rate: 500},
+	}, clock)
+	require.NoError(t, err)
+	defer scheduler.Stop()
+
+	cases := []struct {
+		at      time.Time
+		profile string
+		rate    int64
+		burst   int64
+	}{
+		{time.Date(2024, 6, 7, 12, 0, 0, 0, time.Local), limiter.DefaultProfile, 100, 10},
+		{time.Date(2024, 6, 7, 22, 0, 0, 0, time.Local), "off_peak", 1000, 200},
+		// 周五开始的时间段跨越午夜，在周六凌晨仍然生效
+		{time.Date(2024, 6, 8, 5, 59, 0, 0, time.Local), "off_peak", 1000, 200},
+		{time.Date(2024, 6, 8, 6, 0, 0, 0, time.Local), "weekend", 500, 10},
+		// 周日开始的时间段没有配置夜间规则
+		{time.Date(2024, 6, 10, 3, 0, 0, 0, time.Local), limiter.DefaultProfile, 100, 10},
+		{time.Date(2024, 6, 10, 23, 30, 0, 0, time.Local), "off_peak", 1000, 200},
+	}
+
+	for _, tc := range cases {
+		assert.Equal(t, tc.profile, scheduler.Update(tc.at), tc.at.String())
+		stats := rl.Stats()
+		assert.Equal(t, tc.profile, stats.Profile)
+		assert.Equal(t, tc.rate, stats.Rate)
+		assert.Equal(t, tc.burst, stats.BurstSize)
+		assert.LessOrEqual(t, stats.CurrentTokens, tc.burst)
+	}
+
+	// 时间段不变时保留手动调整的速率
+	rl.SetRate(2000)
+	scheduler.Update(time.Date(2024, 6, 10, 23, 45, 0, 0, time.Local))
+	assert.Equal(t, int64(2000), rl.Stats().Rate)
+
+	_, err = limiter.NewScheduler(rl, 100, 10, []config.LimiterScheduleConfig{
+		{Name: "bad", Start: "25:00", End: "06:00", Rate: 1},
+	}, clock)
+	assert.Error(t, err)
+}
+
+func TestLimiterAutoToggle(t *testing.T) {
+	clock := newFakeClock()
+	rl := limiter.NewRateLimiterWithClock(100, 10, false, clock)
+	rl.SetEnabled(false)
+	var qps atomic.Int64
+	auto := limiter.NewAutoToggle(rl, config.LimiterAutoConfig{Enabled: true, Threshold: 1000, EnableAfter: 10 * time.Second, DisableAfter: time.Minute}, qps.Load, clock)
+	defer auto.Stop()
+
+	step := func(d time.Duration) bool {
+		clock.Advance(d)
+		return auto.Update(clock.Now())
+	}
+
+	// 短暂的尖峰不会启用限流器
+	qps.Store(5000)
+	assert.False(t, step(time.Second))
+	assert.False(t, step(5*time.Second))
+	qps.Store(10)
+	assert.False(t, step(time.Second))
+
+	// 持续超过阈值后启用
+	qps.Store(5000)
+	assert.False(t, step(time.Second))
+	assert.False(t, step(9*time.Second))
+	assert.True(t, step(time.Second))
+	assert.True(t, rl.Enabled())
+
+	// 等于阈值不算超过，持续到disable_after后停用
+	qps.Store(1000)
+	assert.True(t, step(time.Second))
+	assert.True(t, step(30*time.Second))
+	assert.False(t, step(30*time.Second))
+	assert.False(t, rl.Enabled())
+
+	// 低流量期间手动启用的状态保留到下一次自动切换
+	rl.SetEnabled(true)
+	assert.False(t, step(10*time.Minute))
+	assert.True(t, rl.Enabled())
+
+	stats := rl.Stats().Auto
+	require.NotNil(t, stats)
+	assert.Equal(t, limiter.AutoToggleStats{Threshold: 1000, EnableAfter: "10s", DisableAfter: "1m0s", Above: false, Since: "11m0s", Toggles: 2}, *stats)
+
+	auto.Stop()
+	assert.Nil(t, rl.Stats().Auto)
+}
+
+func TestLimiterFailurePolicy(t *testing.T) {
+	policy := limiter.NewFailurePolicy("", map[string]string{
+		"/counters/":       limiter.FailClosed,
+		"/counters/public": limiter.FailOpen,
+	})
+
+	// 最长前缀优先，未配置时/admin/为closed
+	assert.Equal(t, limiter.FailOpen, policy.For("/collect"))
+	assert.Equal(t, limiter.FailClosed, policy.For("/admin/ingest/pause"))
+	assert.Equal(t, limiter.FailClosed, policy.For("/counters/upload/collect"))
+	assert.Equal(t, limiter.FailOpen, policy.For("/counters/public/collect"))
+
+	// 模拟远程限流后端，fault不为nil时无法给出结果
+	rl := limiter.NewRateLimiter(1, 1, false)
+	var fault error
+	check := func() (bool, error) {
+		if fault != nil {
+			return false, fault
+		}
+		return rl.AllowN(1), nil
+	}
+
+	allowed, err := policy.Decide("/collect", check)
+	assert.True(t, allowed)
+	assert.NoError(t, err)
+	allowed, err = policy.Decide("/collect", check)
+	assert.False(t, allowed, "限流器正常时按令牌桶拒绝")
+	assert.NoError(t, err)
+
+	fault = limiter.ErrUnavailable
+	allowed, err = policy.Decide("/collect", check)
+	assert.True(t, allowed, "open策略在出错时放行")
+	assert.ErrorIs(t, err, limiter.ErrUnavailable)
+	allowed, _ = policy.Decide("/counters/upload/collect", check)
+	assert.False(t, allowed, "closed策略在出错时拒绝")
+
+	// panic同样视为出错
+	allowed, err = policy.Decide("/collect", func() (bool, error) { panic("backend") })
+	assert.True(t, allowed)
+	assert.ErrorIs(t, err, limiter.ErrUnavailable)
+
+	failures := policy.GetStats()["failures"].(map[string]int64)
+	assert.Equal(t, int64(2), failures[limiter.DefaultFailureRoute])
+	assert.Equal(t, int64(1), failures["/counters/"])
+
+	// nil策略全部放行
+	var none *limiter.FailurePolicy
+	allowed, _ = none.Decide("/admin/ingest/pause", check)
+	assert.True(t, allowed)
+}
+
+func TestRateLimiterCost(t *testing.T) {
+	rl := limiter.NewRateLimiter(1, 10, false)
+
+	cost, err := rl.Cost(0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(limiter.DefaultCost), cost)
+
+	rl.SetCostLimits(2, 5)
+	cost, err = rl.Cost(0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), cost)
+	cost, err = rl.Cost(5)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), cost)
+
+	_, err = rl.Cost(6)
+	assert.ErrorIs(t, err, limiter.ErrInvalidCost)
+	_, err = rl.Cost(-1)
+	assert.ErrorIs(t, err, limiter.ErrInvalidCost)
+
+	// 为0的参数保持不变
+	rl.SetCostLimits(0, 8)
+	assert.Equal(t, int64(2), rl.Stats().DefaultCost)
+	assert.Equal(t, int64(8), rl.Stats().MaxCost)
+}
+
+// TestRateLimiterLowRate 低速率时每次补充不足一个令牌，小数部分累积到下次补充，长期放行的速率等于配置值
+func TestRateLimiterLowRate(t *testing.T) {
+	for _, tc := range []struct {
+		rate int64
+		step time.Duration
+	}{
+		{rate: 2, step: 100 * time.Millisecond},
+		{rate: 3, step: 7 * time.Millisecond},
+		{rate: 7, step: 333 * time.Millisecond},
+		{rate: 1, step: 999_999_937 * time.Nanosecond},
+		{rate: 1_000_003, step: 13 * time.Microsecond},
+	} {
+		t.Run(fmt.Sprintf("rate=%d step=%s", tc.rate, tc.step), func(t *testing.T) {
+			clock := newFakeClock()
+			// 每一步补充的令牌不会填满令牌桶，不会因为溢出而损失令牌
+			burst := tc.rate + 1
+			rl := limiter.NewRateLimiterWithClock(tc.rate, burst, false, clock)
+
+			var allowed int64
+			var elapsed time.Duration
+			for i := 0; i < 100_000; i++ {
+				for rl.Allow() {
+					allowed++
+				}
+				clock.Advance(tc.step)
+				elapsed += tc.step
+			}
+			for rl.Allow() {
+				allowed++
+			}
+			// 放行数为初始的突发容量加上时长乘以速率向下取整
+			assert.Equal(t, burst+int64(elapsed)*tc.rate/int64(time.Second), allowed)
+		})
+	}
+
+	t.Run("调整速率后保留不足一个令牌的部分", func(t *testing.T) {
+		clock := newFakeClock()
+		rl := limiter.NewRateLimiterWithClock(2, 1, false, clock)
+		require.True(t, rl.Allow())
+
+		// 按每秒2个补充了0.8个令牌，调整为每秒1个后再补充0.2个即可放行
+		clock.Advance(400 * time.Millisecond)
+		rl.SetRate(1)
+		clock.Advance(199 * time.Millisecond)
+		assert.False(t, rl.Allow())
+		clock.Advance(time.Millisecond)
+		assert.True(t, rl.Allow())
+	})
+
+	t.Run("规则的令牌桶同样累积小数部分", func(t *testing.T) {
+		clock := newFakeClock()
+		rl := limiter.NewRateLimiterWithClock(1000, 1000, false, clock)
+		require.NoError(t, rl.SetRules([]limiter.RuleSpec{{Name: "slow", Match: limiter.RuleMatch{Path: "/slow"}, Rate: 2, Burst: 1}}))
+
+		allowed := 0
+		for i := 0; i < 100; i++ {
+			verdict, err := rl.CheckRequest(limiter.Request{Path: "/slow"}, 1)
+			require.NoError(t, err)
+			if verdict.Allowed {
+				allowed++
+			}
+			clock.Advance(100 * time.Millisecond)
+		}
+		// 初始的1个令牌加上最后一次请求前9.9秒内补充的19个
+		assert.Equal(t, 20, allowed)
+	})
+
+	t.Run("长时间空闲后补充到突发容量", func(t *testing.T) {
+		clock := newFakeClock()
+		rl := limiter.NewRateLimiterWithClock(1<<40, 1<<50, false, clock)
+		rl.SetTokensForTest(0)
+		clock.Advance(1000 * time.Hour)
+		assert.True(t, rl.AllowN(1<<50))
+		assert.False(t, rl.Allow())
 	})
 }
@@ -0,0 +1,81 @@
+package unit_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/recovery"
+)
+
+func TestRecovery(t *testing.T) {
+	t.Run("后台协程panic后重新运行", func(t *testing.T) {
+		recovery.Init(config.RecoveryConfig{})
+
+		var runs atomic.Int32
+		var wg sync.WaitGroup
+		recovery.Go("test.worker", &wg, func() {
+			if runs.Add(1) < 3 {
+				panic("boom")
+			}
+		})
+		wg.Wait()
+
+		assert.Equal(t, int32(3), runs.Load())
+		assert.Equal(t, int64(2), recovery.Panics()["test.worker"])
+		select {
+		case <-recovery.ShutdownRequested():
+			t.Fatal("未配置上限时不应关闭服务")
+		default:
+		}
+	})
+
+	t.Run("写入崩溃转储", func(t *testing.T) {
+		dir := t.TempDir()
+		recovery.Init(config.RecoveryConfig{DumpDir: dir})
+
+		func() {
+			defer recovery.Recover("test.dump")
+			panic("dump me")
+		}()
+
+		files, err := filepath.Glob(filepath.Join(dir, "crash-test.dump-*.txt"))
+		require.NoError(t, err)
+		require.Len(t, files, 1)
+		content, err := os.ReadFile(files[0])
+		require.NoError(t, err)
+		assert.True(t, strings.Contains(string(content), "panic: dump me"))
+		assert.True(t, strings.Contains(string(content), "goroutines:"))
+		assert.Equal(t, int64(1), recovery.GetStats()["dumps"])
+	})
+
+	t.Run("一分钟内panic次数达到上限时请求关闭", func(t *testing.T) {
+		recovery.Init(config.RecoveryConfig{MaxPanicsPerMinute: 3})
+
+		for i := 0; i < 3; i++ {
+			func() {
+				defer recovery.Recover("test.limit")
+				panic(i)
+			}()
+		}
+
+		select {
+		case <-recovery.ShutdownRequested():
+		case <-time.After(time.Second):
+			t.Fatal("panic次数达到上限后应请求关闭")
+		}
+		stats := recovery.GetStats()
+		assert.Equal(t, int64(3), stats["total"])
+		assert.Equal(t, true, stats["shutdown_requested"])
+	})
+
+	recovery.Init(config.RecoveryConfig{})
+}
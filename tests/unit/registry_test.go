@@ -0,0 +1,205 @@
+package unit_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/counter"
+	"github.com/mant7s/qps-counter/internal/storage"
+)
+
+func registryDefaults() config.CounterConfig {
+	return config.CounterConfig{
+		Type:       counter.LockFreeType,
+		WindowSize: time.Second,
+		SlotNum:    10,
+		Precision:  100 * time.Millisecond,
+	}
+}
+
+func TestRegistryCreateAndDelete(t *testing.T) {
+	registry := counter.NewRegistry(registryDefaults(), storage.NewMemoryStorage(), 2)
+	defer registry.Stop()
+
+	info, err := registry.Create(counter.CounterSpec{Name: "checkout"})
+	require.NoError(t, err)
+	assert.Equal(t, counter.LockFreeType, info.Spec.Type)
+	assert.Equal(t, time.Second, info.Spec.WindowSize)
+
+	_, err = registry.Create(counter.CounterSpec{Name: "checkout"})
+	assert.ErrorIs(t, err, counter.ErrCounterExists)
+
+	_, err = registry.Create(counter.CounterSpec{Name: "bad name"})
+	assert.ErrorIs(t, err, counter.ErrInvalidCounterName)
+
+	_, err = registry.Create(counter.CounterSpec{Name: "search", Type: "unknown"})
+	assert.ErrorIs(t, err, counter.ErrInvalidCounterSpec)
+
+	_, err = registry.Create(counter.CounterSpec{Name: "search"})
+	require.NoError(t, err)
+	_, err = registry.Create(counter.CounterSpec{Name: "payments"})
+	assert.ErrorIs(t, err, counter.ErrTooManyCounters)
+
+	c, ok := registry.Get("checkout")
+	require.True(t, ok)
+	c.Incr()
+
+	infos := registry.List()
+	require.Len(t, infos, 2)
+	assert.Equal(t, "checkout", infos[0].Spec.Name)
+	assert.Equal(t, "search", infos[1].Spec.Name)
+
+	require.NoError(t, registry.Delete("checkout"))
+	assert.ErrorIs(t, registry.Delete("checkout"), counter.ErrCounterNotFound)
+	_, ok = registry.Get("checkout")
+	assert.False(t, ok)
+}
+
+func TestRegistryRestore(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := storage.NewFileStorage(dir)
+	require.NoError(t, err)
+	registry := counter.NewRegistry(registryDefaults(), store, 0)
+	_, err = registry.Create(counter.CounterSpec{Name: "checkout", WindowSize: 5 * time.Second, SlotNum: 50})
+	require.NoError(t, err)
+	_, err = registry.Create(counter.CounterSpec{Name: "search"})
+	require.NoError(t, err)
+	require.NoError(t, registry.Delete("search"))
+	registry.Stop()
+
+	// 模拟重启：使用同一目录重新创建注册表
+	store, err = storage.NewFileStorage(dir)
+	require.NoError(t, err)
+	restored := counter.NewRegistry(registryDefaults(), store, 0)
+	defer restored.Stop()
+	require.NoError(t, restored.Restore())
+
+	infos := restored.List()
+	require.Len(t, infos, 1)
+	assert.Equal(t, "checkout", infos[0].Spec.Name)
+	assert.Equal(t, 5*time.Second, infos[0].Spec.WindowSize)
+	assert.Equal(t, 50, infos[0].Spec.SlotNum)
+}
+
+// TestRegistrySoftDelete 配置保留期时删除的计数器可查询、不可上报，可以恢复，保留期结束后被清除
+func TestRegistrySoftDelete(t *testing.T) {
+	defaults := registryDefaults()
+	defaults.DeleteGrace = 200 * time.Millisecond
+	store := storage.NewMemoryStorage()
+	registry := counter.NewRegistry(defaults, store, 1)
+	defer registry.Stop()
+
+	_, err := registry.Create(counter.CounterSpec{Name: "checkout"})
+	require.NoError(t, err)
+	require.NoError(t, registry.Delete("checkout"))
+	assert.ErrorIs(t, registry.Delete("checkout"), counter.ErrCounterDeleted)
+
+	info, ok := registry.Info("checkout")
+	require.True(t, ok)
+	assert.Equal(t, counter.CounterStateDeleted, info.State)
+	require.NotNil(t, info.PurgeAt)
+	assert.Equal(t, info.DeletedAt.Add(defaults.DeleteGrace), *info.PurgeAt)
+
+	_, err = registry.Writable("checkout")
+	assert.ErrorIs(t, err, counter.ErrCounterDeleted)
+	_, ok = registry.Get("checkout")
+	assert.True(t, ok)
+
+	// 保留期内名称和数量上限仍被占用
+	_, err = registry.Create(counter.CounterSpec{Name: "checkout"})
+	assert.ErrorIs(t, err, counter.ErrCounterExists)
+	_, err = registry.Create(counter.CounterSpec{Name: "search"})
+	assert.ErrorIs(t, err, counter.ErrTooManyCounters)
+
+	// 删除状态持久化，重启后保留
+	restored := counter.NewRegistry(defaults, store, 1)
+	defer restored.Stop()
+	require.NoError(t, restored.Restore())
+	info, ok = restored.Info("checkout")
+	require.True(t, ok)
+	assert.Equal(t, counter.CounterStateDeleted, info.State)
+
+	info, err = registry.Undelete("checkout")
+	require.NoError(t, err)
+	assert.Equal(t, counter.CounterStateActive, info.State)
+	assert.Nil(t, info.DeletedAt)
+	_, err = registry.Writable("checkout")
+	assert.NoError(t, err)
+
+	require.NoError(t, registry.Delete("checkout"))
+	assert.Eventually(t, func() bool {
+		_, ok := registry.Info("checkout")
+		return !ok
+	}, 3*time.Second, 50*time.Millisecond)
+	records, err := store.List("counters/")
+	require.NoError(t, err)
+	assert.Empty(t, records)
+}
+
+// TestRegistryRollup 开启rollup的计数器上报时同时计入各级上级计数器，查询任一层级得到该层级的汇总
+func TestRegistryRollup(t *testing.T) {
+	defaults := registryDefaults()
+	defaults.DeleteGrace = time.Minute
+	registry := counter.NewRegistry(defaults, storage.NewMemoryStorage(), 0)
+	defer registry.Stop()
+
+	for _, spec := range []counter.CounterSpec{
+		{Name: "api"},
+		{Name: "api.orders", Rollup: true},
+		{Name: "api.orders.create", Rollup: true},
+		{Name: "api.users.get", Rollup: true}, // 缺少的中间层级被跳过
+		{Name: "api.search"},                  // 未开启rollup
+	} {
+		_, err := registry.Create(spec)
+		require.NoError(t, err, spec.Name)
+	}
+
+	collect := func(name string, n int64) {
+		target, err := registry.Writable(name)
+		require.NoError(t, err)
+		target.Add(n)
+	}
+	collect("api.orders.create", 5)
+	collect("api.orders", 2)
+	collect("api.users.get", 3)
+	collect("api.search", 7)
+
+	qps := func(name string) int64 {
+		info, ok := registry.Info(name)
+		require.True(t, ok, name)
+		return info.QPS
+	}
+	assert.Equal(t, int64(5), qps("api.orders.create"))
+	assert.Equal(t, int64(7), qps("api.orders"))
+	assert.Equal(t, int64(3), qps("api.users.get"))
+	assert.Equal(t, int64(10), qps("api"))
+	assert.Equal(t, int64(7), qps("api.search"))
+
+	info, _ := registry.Info("api.orders.create")
+	assert.Equal(t, []string{"api.orders", "api"}, info.RollupTo)
+	info, _ = registry.Info("api.search")
+	assert.Empty(t, info.RollupTo)
+
+	t.Run("已删除的上级不再计入", func(t *testing.T) {
+		require.NoError(t, registry.Delete("api.orders"))
+		collect("api.orders.create", 1)
+		assert.Equal(t, int64(7), qps("api.orders"))
+		assert.Equal(t, int64(11), qps("api"))
+		info, _ := registry.Info("api.orders.create")
+		assert.Equal(t, []string{"api"}, info.RollupTo)
+	})
+
+	t.Run("层级中的计数单位必须一致", func(t *testing.T) {
+		_, err := registry.Create(counter.CounterSpec{Name: "api.orders.update", Unit: counter.UnitBytes, Rollup: true})
+		assert.ErrorIs(t, err, counter.ErrInvalidCounterSpec)
+		_, err = registry.Create(counter.CounterSpec{Name: "api.users", Unit: counter.UnitBytes})
+		assert.ErrorIs(t, err, counter.ErrInvalidCounterSpec)
+		_, err = registry.Create(counter.CounterSpec{Name: "api.search.bytes", Unit: counter.UnitBytes})
+		assert.NoError(t, err, "未开启rollup的计数器不受上级单位限制")
+	})
+}
@@ -0,0 +1,130 @@
+package unit_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/counter"
+	"github.com/mant7s/qps-counter/internal/events"
+	"github.com/mant7s/qps-counter/internal/limiter"
+	"github.com/mant7s/qps-counter/internal/report"
+)
+
+func TestReporter(t *testing.T) {
+	// 由测试手动采样，采样间隔只用于估算标签组合的事件数
+	cfg := config.ReportConfig{SampleInterval: time.Hour, TopKeys: 1}
+
+	t.Run("汇总峰值、P99、最繁忙的标签组合和限流拒绝数", func(t *testing.T) {
+		c := &mockCounter{}
+		tagged := counter.NewTaggedCounter(&config.CounterConfig{
+			WindowSize: time.Minute,
+			SlotNum:    60,
+			Precision:  time.Second,
+			Tags:       config.TagsConfig{Keys: []string{"route"}, MaxSeries: 10},
+		})
+		rl := limiter.NewRateLimiterWithClock(10, 10, false, newFakeClock())
+		reporter := report.NewReporter(cfg, c, tagged, rl, nil)
+		defer reporter.Stop()
+		assert.Nil(t, reporter.Latest())
+
+		start := time.Now()
+		tagged.Add(map[string]string{"route": "/pay"}, 60)
+		tagged.Add(map[string]string{"route": "/list"}, 6)
+		for i := 1; i <= 100; i++ {
+			c.SetQPS(int64(i))
+			reporter.Sample(start.Add(time.Duration(i) * time.Second))
+		}
+		for i := 0; i < 15; i++ {
+			rl.Allow()
+		}
+		reporter.Handle(events.Event{Type: events.EventBurstStarted, Time: start, Data: map[string]interface{}{"qps": 100}})
+		reporter.Handle(events.Event{Type: events.EventShutdownStarted, Time: start})
+
+		r := reporter.Generate(start.Add(200 * time.Second))
+		assert.Equal(t, report.PeriodDaily, r.Period)
+		assert.Equal(t, 100, r.Samples)
+		assert.Equal(t, int64(100), r.PeakQPS)
+		require.NotNil(t, r.PeakAt)
+		assert.Equal(t, start.Add(100*time.Second), *r.PeakAt)
+		assert.Equal(t, 50.5, r.AvgQPS)
+		assert.Equal(t, int64(99), r.P99QPS)
+		assert.Equal(t, int64(5), r.LimiterRejected)
+		assert.Equal(t, int64(15), r.LimiterTotal)
+
+		// 每次采样按QPS乘以采样间隔估算事件数，只保留最繁忙的一个组合
+		require.Len(t, r.BusiestKeys, 1)
+		assert.Equal(t, "route=/pay", r.BusiestKeys[0].Key)
+		assert.Equal(t, int64(100*3600), r.BusiestKeys[0].Events)
+
+		// 只记录突增和阈值跨越事件
+		require.Len(t, r.Anomalies, 1)
+		assert.Equal(t, events.EventBurstStarted, r.Anomalies[0].Type)
+		assert.Contains(t, r.Text, "峰值QPS 100")
+		assert.Contains(t, r.Text, "限流拒绝 5 次，共 15 次请求")
+		assert.Contains(t, r.Text, "route=/pay")
+
+		latest := reporter.Latest()
+		require.NotNil(t, latest)
+		assert.Equal(t, r.To, latest.To)
+
+		// 生成报告后开始新的周期
+		next := reporter.Generate(start.Add(300 * time.Second))
+		assert.Equal(t, r.To, next.From)
+		assert.Equal(t, 0, next.Samples)
+		assert.Nil(t, next.PeakAt)
+		assert.Empty(t, next.Anomalies)
+		assert.Equal(t, int64(0), next.LimiterTotal)
+		assert.Contains(t, next.Text, "本周期没有采样数据")
+	})
+
+	t.Run("按每天或每周的指定时间生成", func(t *testing.T) {
+		rl := limiter.NewRateLimiter(10, 10, false)
+		now := time.Date(2024, 5, 15, 9, 30, 0, 0, time.UTC) // 星期三
+
+		daily := report.NewReporter(config.ReportConfig{SampleInterval: time.Hour, At: "08:00"}, &mockCounter{}, nil, rl, nil)
+		defer daily.Stop()
+		assert.Equal(t, time.Date(2024, 5, 16, 8, 0, 0, 0, time.UTC), daily.NextDue(now))
+		assert.Equal(t, time.Date(2024, 5, 15, 8, 0, 0, 0, time.UTC), daily.NextDue(now.Add(-2*time.Hour)))
+
+		weekly := report.NewReporter(config.ReportConfig{SampleInterval: time.Hour, Period: report.PeriodWeekly, At: "09:30", Weekday: "wed"}, &mockCounter{}, nil, rl, nil)
+		defer weekly.Stop()
+		assert.Equal(t, time.Date(2024, 5, 22, 9, 30, 0, 0, time.UTC), weekly.NextDue(now))
+		assert.Equal(t, time.Date(2024, 5, 15, 9, 30, 0, 0, time.UTC), weekly.NextDue(now.Add(-time.Minute)))
+
+		monday := report.NewReporter(config.ReportConfig{SampleInterval: time.Hour, Period: report.PeriodWeekly}, &mockCounter{}, nil, rl, nil)
+		defer monday.Stop()
+		assert.Equal(t, time.Date(2024, 5, 20, 0, 0, 0, 0, time.UTC), monday.NextDue(now))
+	})
+
+	t.Run("投递到所有webhook地址", func(t *testing.T) {
+		received := make(chan report.Report, 2)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+			var got report.Report
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+			received <- got
+		}))
+		defer server.Close()
+
+		reporter := report.NewReporter(config.ReportConfig{
+			SampleInterval: time.Hour,
+			Webhooks:       []string{server.URL + "/a", server.URL + "/b"},
+		}, &mockCounter{qps: 7}, nil, limiter.NewRateLimiter(10, 10, false), nil)
+		defer reporter.Stop()
+
+		reporter.Sample(time.Now())
+		reporter.Deliver(reporter.Generate(time.Now()))
+		for i := 0; i < 2; i++ {
+			got := <-received
+			assert.Equal(t, int64(7), got.PeakQPS)
+			assert.NotEmpty(t, got.Text)
+		}
+	})
+}
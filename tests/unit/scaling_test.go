@@ -0,0 +1,102 @@
+package unit_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/counter"
+	"github.com/mant7s/qps-counter/internal/limiter"
+	"github.com/mant7s/qps-counter/internal/scaling"
+)
+
+func TestScalingAdvisor(t *testing.T) {
+	cfg := config.ScalingConfig{
+		Interval:          time.Hour, // 由测试手动采样
+		Replicas:          2,
+		CapacityQPS:       1000,
+		TargetUtilization: 0.5,
+		CPUThreshold:      100,
+	}
+
+	t.Run("需求超过目标容量时扩容", func(t *testing.T) {
+		c := &mockCounter{qps: 1800}
+		advisor := scaling.NewAdvisor(cfg, c, nil, limiter.NewRateLimiter(10000, 10000, false))
+		defer advisor.Stop()
+
+		advice := advisor.Advice(0)
+		assert.Equal(t, scaling.ActionScaleUp, advice.Action)
+		assert.Equal(t, 2, advice.Current)
+		assert.Equal(t, 4, advice.Recommended)
+		assert.Equal(t, 2, advice.Delta)
+		assert.Equal(t, "增加2个副本", advice.Summary)
+		assert.Equal(t, int64(1000), advice.Signals.CapacityQPS)
+		// 未启用趋势跟踪且采样不足，置信度降低
+		assert.Equal(t, 0.4, advice.Confidence)
+		assert.NotEmpty(t, advice.Reasons)
+	})
+
+	t.Run("需求下降时缩容，不少于一个副本", func(t *testing.T) {
+		c := &mockCounter{qps: 100}
+		advisor := scaling.NewAdvisor(cfg, c, nil, limiter.NewRateLimiter(10000, 10000, false))
+		defer advisor.Stop()
+
+		advice := advisor.Advice(3)
+		assert.Equal(t, scaling.ActionScaleDown, advice.Action)
+		assert.Equal(t, 1, advice.Recommended)
+		assert.Equal(t, -2, advice.Delta)
+	})
+
+	t.Run("趋势上升时按预测值扩容", func(t *testing.T) {
+		c := &mockCounter{qps: 400}
+		trend := counter.NewTrendTracker(c, 1, time.Hour)
+		defer trend.Stop()
+		now := time.Now()
+		trend.Observe(300, now)
+		trend.Observe(400, now.Add(time.Second))
+
+		advisor := scaling.NewAdvisor(config.ScalingConfig{Interval: time.Hour, CapacityQPS: 1000, Horizon: 10 * time.Second, CPUThreshold: 100}, c, trend, limiter.NewRateLimiter(10000, 10000, false))
+		defer advisor.Stop()
+
+		// 预测10秒后QPS为1400，单个副本的目标容量为700
+		advice := advisor.Advice(1)
+		assert.Equal(t, 1400.0, advice.Signals.ForecastQPS)
+		assert.Equal(t, 2, advice.Recommended)
+	})
+
+	t.Run("限流拒绝比例过高时至少扩容一个副本", func(t *testing.T) {
+		c := &mockCounter{qps: 100}
+		rl := limiter.NewRateLimiterWithClock(10, 10, false, newFakeClock())
+		advisor := scaling.NewAdvisor(config.ScalingConfig{Interval: time.Hour, CapacityQPS: 1000, CPUThreshold: 100}, c, nil, rl)
+		defer advisor.Stop()
+
+		for i := 0; i < 20; i++ {
+			rl.Allow()
+		}
+		advisor.Sample()
+
+		advice := advisor.Advice(1)
+		assert.Equal(t, 0.5, advice.Signals.RejectRate)
+		assert.Equal(t, scaling.ActionScaleUp, advice.Action)
+		assert.Equal(t, 2, advice.Recommended)
+		assert.Contains(t, advice.Reasons, "限流拒绝比例 50.00% 超过 1.00%")
+	})
+
+	t.Run("未配置容量时使用限流速率，都没有时只根据饱和度判断", func(t *testing.T) {
+		c := &mockCounter{qps: 100000}
+		rl := limiter.NewRateLimiter(10, 10, false)
+		advisor := scaling.NewAdvisor(config.ScalingConfig{Interval: time.Hour, Replicas: 3, CPUThreshold: 100}, c, nil, rl)
+		defer advisor.Stop()
+
+		// 启用限流时以限流速率作为单个副本的容量
+		assert.Equal(t, int64(10), advisor.Advice(0).Signals.CapacityQPS)
+
+		rl.SetEnabled(false)
+		advice := advisor.Advice(0)
+		assert.Equal(t, scaling.ActionHold, advice.Action)
+		assert.Equal(t, 3, advice.Recommended)
+		assert.Equal(t, int64(0), advice.Signals.CapacityQPS)
+	})
+}
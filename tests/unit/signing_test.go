@@ -0,0 +1,95 @@
+package unit_test
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/ingest"
+)
+
+func TestSignatureVerifier(t *testing.T) {
+	assert.Nil(t, ingest.NewSignatureVerifier(config.SigningConfig{}))
+	var disabled *ingest.SignatureVerifier
+	assert.NoError(t, disabled.Verify("", "", "", "", ingest.SignedRequest{}), "未启用时不校验")
+
+	v := ingest.NewSignatureVerifier(config.SigningConfig{
+		Enabled:   true,
+		MaxSkew:   time.Minute,
+		MaxNonces: 2,
+		Agents: []config.AgentSecret{
+			{Agent: "agent-1", Secret: "secret-1"},
+			{Agent: "agent-2", Secret: "secret-2"},
+		},
+	})
+	t.Cleanup(v.Stop)
+	assert.Equal(t, "X-Agent-ID", v.AgentHeader())
+
+	now := time.Unix(1700000000, 0)
+	body := ingest.SignedRequest{Method: "POST", Path: "/collect", Body: []byte(`{"count":5}`)}
+	ts := strconv.FormatInt(now.Unix(), 10)
+	verify := func(agent, timestamp, nonce, signature string, req ingest.SignedRequest) error {
+		return v.VerifyAt(agent, timestamp, nonce, signature, req, now)
+	}
+
+	t.Run("签名有效的上报只接受一次", func(t *testing.T) {
+		sig := ingest.Sign("secret-1", ts, "nonce-0001", body)
+		require.NoError(t, verify("agent-1", ts, "nonce-0001", sig, body))
+		assert.ErrorIs(t, verify("agent-1", ts, "nonce-0001", sig, body), ingest.ErrReplayedReport)
+		// 不同代理的nonce互不影响
+		require.NoError(t, verify("agent-2", ts, "nonce-0001", ingest.Sign("secret-2", ts, "nonce-0001", body), body))
+	})
+
+	t.Run("拒绝伪造和过期的上报", func(t *testing.T) {
+		sig := ingest.Sign("secret-1", ts, "nonce-0002", body)
+		assert.ErrorIs(t, verify("agent-1", ts, "nonce-0002", sig, ingest.SignedRequest{Method: "POST", Path: "/collect", Body: []byte(`{"count":500}`)}), ingest.ErrBadSignature)
+		assert.ErrorIs(t, verify("agent-2", ts, "nonce-0002", sig, body), ingest.ErrBadSignature, "使用其他代理的密钥")
+		assert.ErrorIs(t, verify("agent-3", ts, "nonce-0002", sig, body), ingest.ErrUnknownAgent)
+		assert.ErrorIs(t, verify("agent-1", ts, "", sig, body), ingest.ErrUnsignedReport)
+		assert.ErrorIs(t, verify("agent-1", ts, "nonce-0002", "", body), ingest.ErrUnsignedReport)
+
+		old := strconv.FormatInt(now.Add(-2*time.Minute).Unix(), 10)
+		assert.ErrorIs(t, verify("agent-1", old, "nonce-0003", ingest.Sign("secret-1", old, "nonce-0003", body), body), ingest.ErrStaleReport)
+		future := strconv.FormatInt(now.Add(2*time.Minute).Unix(), 10)
+		assert.ErrorIs(t, verify("agent-1", future, "nonce-0003", ingest.Sign("secret-1", future, "nonce-0003", body), body), ingest.ErrStaleReport)
+	})
+
+	t.Run("签名覆盖请求方法、路径和查询参数", func(t *testing.T) {
+		signed := ingest.SignedRequest{Method: "POST", Path: "/counters/orders/collect", RawQuery: "unit=bytes", Body: body.Body}
+		sig := ingest.Sign("secret-1", ts, "nonce-0005", signed)
+
+		changed := []ingest.SignedRequest{
+			{Method: "POST", Path: "/counters/payments/collect", RawQuery: "unit=bytes", Body: body.Body},
+			{Method: "POST", Path: "/collect", RawQuery: "unit=bytes", Body: body.Body},
+			{Method: "POST", Path: "/counters/orders/collect", RawQuery: "unit=events", Body: body.Body},
+			{Method: "POST", Path: "/counters/orders/collect", Body: body.Body},
+			{Method: "PUT", Path: "/counters/orders/collect", RawQuery: "unit=bytes", Body: body.Body},
+		}
+		for _, req := range changed {
+			assert.ErrorIs(t, verify("agent-1", ts, "nonce-0005", sig, req), ingest.ErrBadSignature, "请求 %+v", req)
+		}
+		// 方法不区分大小写
+		signed.Method = "post"
+		assert.Equal(t, sig, ingest.Sign("secret-1", ts, "nonce-0005", signed))
+	})
+
+	t.Run("nonce记录已满时拒绝，过期后清理", func(t *testing.T) {
+		sig := ingest.Sign("secret-1", ts, "nonce-0004", body)
+		assert.ErrorIs(t, verify("agent-1", ts, "nonce-0004", sig, body), ingest.ErrNonceCacheFull)
+
+		v.Cleanup(now.Add(2 * time.Minute))
+		later := now.Add(2 * time.Minute)
+		lts := strconv.FormatInt(later.Unix(), 10)
+		assert.NoError(t, v.VerifyAt("agent-1", lts, "nonce-0004", ingest.Sign("secret-1", lts, "nonce-0004", body), body, later))
+
+		stats := v.GetStats()
+		assert.Equal(t, int64(3), stats["verified"])
+		assert.Equal(t, int64(1), stats["replayed"])
+		assert.Equal(t, int64(1), stats["nonces"])
+		assert.NotContains(t, stats, "secret-1")
+	})
+}
@@ -0,0 +1,111 @@
+package unit_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/counter"
+	"github.com/mant7s/qps-counter/internal/snapshot"
+	"github.com/mant7s/qps-counter/internal/storage"
+)
+
+func TestSnapshot(t *testing.T) {
+	newConfig := func() *config.CounterConfig {
+		return &config.CounterConfig{
+			WindowSize: 10 * time.Second,
+			Windows:    []time.Duration{time.Minute},
+			SlotNum:    100,
+			Precision:  100 * time.Millisecond,
+			Keys:       config.KeysConfig{Enabled: true},
+		}
+	}
+
+	for _, counterType := range []string{counter.LockFreeType, counter.ShardedType} {
+		t.Run(counterType, func(t *testing.T) {
+			store, err := storage.NewFileStorage(t.TempDir())
+			require.NoError(t, err)
+
+			// 第一个进程
+			cfg := newConfig()
+			base := createCounter(t, cfg, counterType)
+			c := counter.NewMultiWindow(base, cfg)
+			keyed := counter.NewKeyedCounter(cfg)
+			history := counter.NewHistory(c, time.Minute)
+			c.Add(500)
+			keyed.Add("api", 200)
+			history.Record(c.CurrentQPS(), time.Now())
+
+			s := snapshot.NewSnapshotter(config.SnapshotConfig{}, cfg.Precision, store, c, keyed, history)
+			s.Start()
+			s.Stop() // 停止时写入最后一次快照
+			history.Stop()
+			base.Stop()
+
+			// 重启后恢复
+			cfg = newConfig()
+			base = createCounter(t, cfg, counterType)
+			defer base.Stop()
+			restored := counter.NewMultiWindow(base, cfg)
+			restoredKeys := counter.NewKeyedCounter(cfg)
+			restoredHistory := counter.NewHistory(restored, time.Minute)
+			defer restoredHistory.Stop()
+
+			s = snapshot.NewSnapshotter(config.SnapshotConfig{}, cfg.Precision, store, restored, restoredKeys, restoredHistory)
+			require.NoError(t, s.Restore())
+			assert.Equal(t, int64(50), restored.CurrentQPS())
+			assert.Equal(t, []counter.WindowQPS{{Window: "1m", QPS: 8}}, restored.Windows())
+			qps, ok := restoredKeys.QPS("api")
+			assert.True(t, ok)
+			assert.Equal(t, int64(20), qps)
+			assert.Len(t, restoredHistory.Samples(0), 1)
+
+			// 恢复的计数与之后的上报相加
+			restored.Add(100)
+			assert.Equal(t, int64(60), restored.CurrentQPS())
+		})
+	}
+
+	t.Run("精度变化时不恢复", func(t *testing.T) {
+		store := storage.NewMemoryStorage()
+		cfg := newConfig()
+		c := createCounter(t, cfg, counter.LockFreeType)
+		defer c.Stop()
+		c.Add(100)
+		require.NoError(t, snapshot.NewSnapshotter(config.SnapshotConfig{}, cfg.Precision, store, c, nil, nil).Save())
+
+		cfg = newConfig()
+		cfg.Precision = time.Second
+		cfg.SlotNum = 10
+		restored := createCounter(t, cfg, counter.LockFreeType)
+		defer restored.Stop()
+		err := snapshot.NewSnapshotter(config.SnapshotConfig{}, cfg.Precision, store, restored, nil, nil).Restore()
+		assert.ErrorIs(t, err, snapshot.ErrIncompatible)
+		assert.Zero(t, restored.CurrentQPS())
+	})
+
+	t.Run("没有快照", func(t *testing.T) {
+		cfg := newConfig()
+		c := createCounter(t, cfg, counter.LockFreeType)
+		defer c.Stop()
+		assert.NoError(t, snapshot.NewSnapshotter(config.SnapshotConfig{}, cfg.Precision, storage.NewMemoryStorage(), c, nil, nil).Restore())
+	})
+
+	t.Run("过期槽位不恢复", func(t *testing.T) {
+		cfg := newConfig()
+		c := createCounter(t, cfg, counter.ShardedType)
+		defer c.Stop()
+		now := time.Now().UnixNano()
+		c.Add(100)
+		s, ok := counter.SnapshotOf(c, now)
+		require.True(t, ok)
+
+		restored := createCounter(t, cfg, counter.ShardedType)
+		defer restored.Stop()
+		counter.RestoreSnapshot(restored, s, now+int64(cfg.WindowSize)+int64(time.Second))
+		assert.Zero(t, restored.CurrentQPS())
+	})
+}
@@ -0,0 +1,112 @@
+package unit_test
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/counter"
+	"github.com/mant7s/qps-counter/internal/metrics"
+)
+
+func TestTaggedCounter(t *testing.T) {
+	cfg := &config.CounterConfig{
+		WindowSize: time.Second,
+		SlotNum:    10,
+		Precision:  100 * time.Millisecond,
+		Tags: config.TagsConfig{
+			Keys:      []string{"route", "method"},
+			MaxSeries: 2,
+		},
+	}
+
+	tc := counter.NewTaggedCounter(cfg)
+	assert.Equal(t, []string{"method", "route"}, tc.Keys(), "标签名应排序")
+
+	t.Run("按标签组合分别计数", func(t *testing.T) {
+		assert.True(t, tc.Add(map[string]string{"route": "/pay", "method": "POST", "ignored": "x"}, 3))
+		assert.True(t, tc.Add(map[string]string{"route": "/pay", "method": "POST"}, 2))
+		assert.True(t, tc.Add(map[string]string{"route": "/list"}, 1))
+
+		series := tc.Series(nil)
+		assert.Len(t, series, 2)
+		assert.Equal(t, map[string]string{"route": "/pay", "method": "POST"}, series[0].Tags)
+		assert.Equal(t, int64(5), series[0].QPS)
+		assert.Equal(t, map[string]string{"route": "/list", "method": ""}, series[1].Tags)
+		assert.Equal(t, int64(1), series[1].QPS)
+	})
+
+	t.Run("按标签过滤", func(t *testing.T) {
+		series := tc.Series(map[string]string{"route": "/list"})
+		assert.Len(t, series, 1)
+		assert.Equal(t, int64(1), series[0].QPS)
+	})
+
+	t.Run("不含已声明标签的事件不计数", func(t *testing.T) {
+		assert.False(t, tc.Add(map[string]string{"status": "200"}, 1))
+		assert.Equal(t, int64(0), tc.Overflow())
+	})
+
+	t.Run("超出基数限制的新组合被丢弃", func(t *testing.T) {
+		assert.False(t, tc.Add(map[string]string{"route": "/new"}, 4))
+		assert.Equal(t, 2, tc.SeriesCount())
+		assert.Equal(t, int64(4), tc.Overflow())
+
+		// 已有组合不受影响
+		assert.True(t, tc.Add(map[string]string{"route": "/list"}, 1))
+	})
+
+	t.Run("Prometheus导出", func(t *testing.T) {
+		collector := metrics.NewTaggedCollector(tc)
+		assert.Equal(t, 4, testutil.CollectAndCount(collector))
+		assert.Equal(t, 2, testutil.CollectAndCount(collector, "qps_counter_tagged_qps"))
+		assert.Equal(t, 1, testutil.CollectAndCount(collector, "qps_counter_tagged_overflow_total"))
+	})
+}
+
+func TestShardedMap(t *testing.T) {
+	m := counter.NewShardedMap[int](3)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				m.LoadOrCreate(strconv.Itoa(j), func() (int, bool) { return j, true })
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1000, m.Len())
+
+	v, ok := m.Load("42")
+	assert.True(t, ok)
+	assert.Equal(t, 42, v)
+
+	_, ok = m.LoadOrCreate("new", func() (int, bool) { return 0, false })
+	assert.False(t, ok)
+	assert.Equal(t, 1000, m.Len())
+
+	m.Delete("42")
+	m.Delete("42")
+	assert.Equal(t, 999, m.Len())
+
+	// 条件不满足或键不存在时不删除
+	assert.False(t, m.DeleteIf("43", func(v int) bool { return v != 43 }))
+	assert.False(t, m.DeleteIf("42", func(int) bool { return true }))
+	assert.True(t, m.DeleteIf("43", func(v int) bool { return v == 43 }))
+	assert.Equal(t, 998, m.Len())
+
+	visited := 0
+	m.Range(func(string, int) bool {
+		visited++
+		return true
+	})
+	assert.Equal(t, 998, visited)
+}
@@ -0,0 +1,83 @@
+package unit_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/counter"
+)
+
+func TestTenantStore(t *testing.T) {
+	cfg := &config.CounterConfig{WindowSize: time.Second, SlotNum: 10, Precision: 100 * time.Millisecond}
+	assert.Nil(t, counter.NewTenantStore(cfg, config.TenantsConfig{}))
+
+	store := counter.NewTenantStore(cfg, config.TenantsConfig{
+		Enabled:    true,
+		MaxTenants: 2,
+		Retention:  3 * time.Second,
+		Tokens: []config.TenantToken{
+			{Tenant: "acme", Token: "acme-token"},
+			{Tenant: "globex", Token: "globex-token"},
+		},
+	})
+	t.Cleanup(store.Stop)
+	assert.Equal(t, "X-Tenant-ID", store.Header())
+	assert.Equal(t, 3*time.Second, store.Retention())
+
+	t.Run("令牌对应租户", func(t *testing.T) {
+		tenant, ok := store.TenantForToken("globex-token")
+		assert.True(t, ok)
+		assert.Equal(t, "globex", tenant)
+		_, ok = store.TenantForToken("acme")
+		assert.False(t, ok)
+		_, ok = store.TenantForToken("")
+		assert.False(t, ok)
+	})
+
+	t.Run("按租户分别计数", func(t *testing.T) {
+		assert.True(t, store.Add("acme", 30))
+		assert.True(t, store.Add("globex", 5))
+		assert.False(t, store.Add("", 5), "没有租户的上报不计入任何租户")
+
+		qps, tracked := store.QPS("acme")
+		assert.True(t, tracked)
+		assert.Equal(t, int64(30), qps)
+		qps, _ = store.QPS("globex")
+		assert.Equal(t, int64(5), qps)
+		_, tracked = store.QPS("initech")
+		assert.False(t, tracked)
+	})
+
+	t.Run("租户数量受上限限制", func(t *testing.T) {
+		assert.False(t, store.Add("initech", 7))
+		stats := store.GetStats()
+		assert.Equal(t, int64(2), stats["tenants"])
+		assert.Equal(t, int64(7), stats["overflow"])
+		assert.Equal(t, 2, stats["tokens"])
+		assert.NotContains(t, stats, "acme-token")
+	})
+
+	t.Run("每个租户有独立的历史", func(t *testing.T) {
+		start := time.Now()
+		store.Sample(start)
+		// 采样协程可能同时写入采样，按时间查找
+		sampleAt := func(tenant string) int64 {
+			h := store.History(tenant)
+			require.NotNil(t, h)
+			for _, s := range h.Samples(0) {
+				if s.Time.Equal(start) {
+					return s.QPS
+				}
+			}
+			t.Fatalf("%s 没有 %v 的采样", tenant, start)
+			return 0
+		}
+		assert.Equal(t, int64(30), sampleAt("acme"))
+		assert.Equal(t, int64(5), sampleAt("globex"))
+		assert.Nil(t, store.History("initech"))
+	})
+}
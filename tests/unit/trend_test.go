@@ -0,0 +1,80 @@
+package unit_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mant7s/qps-counter/internal/counter"
+)
+
+func TestTrendTracker(t *testing.T) {
+	mock := &mockCounter{}
+	// 使用较长的采样间隔，避免后台采样干扰手动注入的数据
+	tt := counter.NewTrendTracker(mock, 0.5, time.Hour)
+	defer tt.Stop()
+
+	start := time.Now()
+
+	t.Run("首次采样直接作为平滑值", func(t *testing.T) {
+		tt.Observe(100, start)
+		trend := tt.Trend()
+		assert.Equal(t, int64(100), trend.RawQPS)
+		assert.Equal(t, 100.0, trend.SmoothedQPS)
+		assert.Equal(t, 0.0, trend.Derivative)
+		assert.Equal(t, 0.5, trend.Alpha)
+	})
+
+	t.Run("后续采样按EWMA平滑并计算导数", func(t *testing.T) {
+		tt.Observe(300, start.Add(2*time.Second))
+		trend := tt.Trend()
+		assert.Equal(t, int64(300), trend.RawQPS)
+		assert.InDelta(t, 200.0, trend.SmoothedQPS, 1e-9)
+		// 平滑值在2秒内上升了100
+		assert.InDelta(t, 50.0, trend.Derivative, 1e-9)
+	})
+
+	t.Run("流量下降时导数为负", func(t *testing.T) {
+		tt.Observe(0, start.Add(3*time.Second))
+		trend := tt.Trend()
+		assert.InDelta(t, 100.0, trend.SmoothedQPS, 1e-9)
+		assert.InDelta(t, -100.0, trend.Derivative, 1e-9)
+	})
+
+	t.Run("乱序采样不影响平滑值", func(t *testing.T) {
+		tt.Observe(1000, start.Add(time.Second))
+		trend := tt.Trend()
+		assert.Equal(t, int64(1000), trend.RawQPS)
+		assert.InDelta(t, 100.0, trend.SmoothedQPS, 1e-9)
+	})
+
+	t.Run("加速度为最近采样的最小二乘斜率", func(t *testing.T) {
+		tt := counter.NewTrendTracker(mock, 0.5, time.Hour)
+		defer tt.Stop()
+		tt.SetAccelerationWindow(3 * time.Hour)
+
+		tt.Observe(100, start)
+		assert.Zero(t, tt.Acceleration(), "只有一个采样时为0")
+
+		// 每小时增长100，斜率不受平滑影响
+		for i, qps := range []int64{200, 300, 400} {
+			tt.Observe(qps, start.Add(time.Duration(i+1)*time.Hour))
+		}
+		assert.InDelta(t, 100.0/3600, tt.Acceleration(), 1e-9)
+		assert.InDelta(t, 100.0/3600, tt.Trend().Acceleration, 1e-9)
+
+		// 缓冲区只保留覆盖3小时的4个采样，最早的采样被覆盖后按最近的采样计算
+		tt.Observe(100, start.Add(4*time.Hour))
+		assert.InDelta(t, -20.0/3600, tt.Acceleration(), 1e-9)
+
+		var nilTracker *counter.TrendTracker
+		assert.Zero(t, nilTracker.Acceleration())
+	})
+
+	t.Run("非法平滑系数使用默认值", func(t *testing.T) {
+		other := counter.NewTrendTracker(mock, 1.5, 0)
+		defer other.Stop()
+		assert.Equal(t, 0.3, other.Trend().Alpha)
+	})
+}
@@ -0,0 +1,61 @@
+package unit_test
+
+import (
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/counter"
+)
+
+func TestWeightedWindow(t *testing.T) {
+	w := counter.NewWeightedWindow(&config.CounterConfig{WindowSize: 10 * time.Second, SlotNum: 10, Precision: time.Second})
+	assert.Equal(t, counter.DefaultWeightUnit, w.Unit())
+	assert.Equal(t, counter.WeightedStats{Unit: "units", Window: "10s"}, w.Stats())
+
+	now := time.Now()
+	assert.True(t, w.Record(0.25, now))
+	assert.True(t, w.Record(1.5, now.Add(-3*time.Second)), "窗口内的事件时间写入对应的槽位")
+	assert.True(t, w.Record(2, now.Add(time.Hour)), "晚于当前时间的事件按当前时间计入")
+	assert.False(t, w.Record(100, now.Add(-time.Minute)), "超出窗口的事件被丢弃")
+
+	// 无效的权重被忽略
+	for _, weight := range []float64{0, -1, math.NaN(), math.Inf(1)} {
+		assert.True(t, w.Record(weight, now))
+	}
+
+	stats := w.Stats()
+	assert.Equal(t, int64(3), stats.Events)
+	assert.InDelta(t, 3.75, stats.Total, 1e-9)
+	assert.InDelta(t, 0.375, stats.Rate, 1e-9)
+	assert.InDelta(t, 0.375, w.Rate(), 1e-9)
+
+	var disabled *counter.WeightedWindow
+	assert.True(t, disabled.Record(1, now))
+}
+
+// TestWeightedWindowConcurrent 并发写入的小数权重不丢失
+func TestWeightedWindowConcurrent(t *testing.T) {
+	w := counter.NewWeightedWindow(&config.CounterConfig{WindowSize: time.Minute, SlotNum: 60, Precision: time.Second, Weighted: config.WeightedConfig{Unit: "cost"}})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				w.Record(0.5, time.Now())
+			}
+		}()
+	}
+	wg.Wait()
+
+	stats := w.Stats()
+	assert.Equal(t, "cost", stats.Unit)
+	assert.Equal(t, int64(8000), stats.Events)
+	assert.InDelta(t, 4000, stats.Total, 1e-9)
+}
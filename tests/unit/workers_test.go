@@ -0,0 +1,140 @@
+package unit_test
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mant7s/qps-counter/internal/config"
+	"github.com/mant7s/qps-counter/internal/recovery"
+	"github.com/mant7s/qps-counter/internal/workers"
+)
+
+// findWorker 按ID查找运行中的协程
+func findWorker(id uint64) (workers.Info, bool) {
+	for _, info := range workers.List() {
+		if info.ID == id {
+			return info, true
+		}
+	}
+	return workers.Info{}, false
+}
+
+func TestWorkers(t *testing.T) {
+	t.Run("记录执行次数和最近一次错误，返回后注销", func(t *testing.T) {
+		w := workers.Register("test.inventory", time.Second).WithIdle(func() bool { return true })
+		id := w.Info().ID
+
+		release := make(chan struct{})
+		var wg sync.WaitGroup
+		w.Go(&wg, func() {
+			w.Ran()
+			w.Ran()
+			w.Fail(errors.New("cleanup failed"))
+			<-release
+		})
+
+		require.Eventually(t, func() bool {
+			info, ok := findWorker(id)
+			return ok && info.Runs == 2
+		}, time.Second, 10*time.Millisecond)
+		info, _ := findWorker(id)
+		assert.Equal(t, "test.inventory", info.Name)
+		assert.Equal(t, "1s", info.Interval)
+		assert.True(t, info.Idle)
+		require.NotNil(t, info.LastRun)
+		assert.Equal(t, "cleanup failed", info.LastError)
+		require.NotNil(t, info.LastErrorAt)
+
+		close(release)
+		wg.Wait()
+		_, ok := findWorker(id)
+		assert.False(t, ok, "协程返回后应注销")
+	})
+
+	t.Run("panic记录为最近一次错误", func(t *testing.T) {
+		recovery.Init(config.RecoveryConfig{})
+		w := workers.Register("test.inventory_panic", 0)
+
+		var wg sync.WaitGroup
+		var errSeen string
+		first := true
+		w.Go(&wg, func() {
+			if first {
+				first = false
+				panic("boom")
+			}
+			errSeen = w.Info().LastError
+		})
+		wg.Wait()
+
+		assert.Equal(t, "panic: boom", errSeen)
+		assert.Empty(t, w.Info().Interval)
+	})
+
+	t.Run("nil协程的记录方法为空操作", func(t *testing.T) {
+		var w *workers.Worker
+		assert.NotPanics(t, func() {
+			w.Ran()
+			w.Fail(errors.New("ignored"))
+			w.Unregister()
+		})
+	})
+}
+
+func TestWatchdog(t *testing.T) {
+	// 检查间隔足够长，只通过Check手动检查
+	wd := workers.NewWatchdog(config.WatchdogConfig{Interval: time.Hour, Threshold: 20 * time.Millisecond, Restart: true})
+	t.Cleanup(wd.Stop)
+
+	stallsBefore, restartsBefore := workers.Stalls()["test.stalled"], workers.Restarts()["test.stalled"]
+	w := workers.Register("test.stalled", 10*time.Millisecond)
+	id := w.Info().ID
+	release := make(chan struct{})
+	var starts atomic.Int32
+	var wg sync.WaitGroup
+	w.Go(&wg, func() {
+		// 第一次运行时卡住，看门狗重新启动后正常执行
+		if starts.Add(1) > 1 {
+			w.Ran()
+		}
+		<-release
+	})
+	t.Cleanup(func() {
+		close(release)
+		wg.Wait()
+	})
+
+	stalledIn := func(infos []workers.Info) bool {
+		for _, info := range infos {
+			if info.ID == id {
+				return true
+			}
+		}
+		return false
+	}
+
+	assert.False(t, stalledIn(wd.Check(time.Now())), "未超过阈值时不应视为卡住")
+
+	time.Sleep(50 * time.Millisecond)
+	require.True(t, stalledIn(wd.Check(time.Now())))
+	assert.False(t, stalledIn(wd.Check(time.Now())), "同一次卡住只报告一次")
+	assert.Equal(t, stallsBefore+1, workers.Stalls()["test.stalled"])
+	assert.Equal(t, restartsBefore+1, workers.Restarts()["test.stalled"])
+
+	require.Eventually(t, func() bool { return starts.Load() == 2 }, time.Second, 10*time.Millisecond)
+	info, ok := findWorker(id)
+	require.True(t, ok)
+	assert.True(t, info.Stalled)
+	assert.Equal(t, int64(1), info.Restarts)
+
+	// 重新启动的循环执行后清除卡住状态
+	wd.Check(time.Now())
+	info, _ = findWorker(id)
+	assert.False(t, info.Stalled)
+}